@@ -0,0 +1,48 @@
+package loge
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAbort(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+	db.SetOne("test", "one", &TestObj{ "One" })
+
+	var t = db.CreateTransaction()
+	t.Write("test", "one").(*TestObj).Name = "Aborted"
+	t.Read("test", "two")
+	t.Abort()
+	t.Abort()
+	if len(db.cache) != 0 {
+		test.Errorf("Objects still held: %d", len(db.cache))
+	}
+	if t.state != ABORTED || !errors.Is(t.Err(), ErrAborted) || t.Commit() {
+		test.Errorf("Wrong state after abort: %s (%v)", t, t.Err())
+	}
+	if db.ReadOne("test", "one").(*TestObj).Name != "One" {
+		test.Error("Aborted write committed")
+	}
+
+	// Deferred after a commit
+	t = db.CreateTransaction()
+	t.Set("test", "two", &TestObj{ "Two" })
+	if !t.Commit() {
+		test.Fatal("Commit failed")
+	}
+	t.Rollback()
+	if t.state != FINISHED || !db.ExistsOne("test", "two") {
+		test.Error("Rollback undid commit")
+	}
+
+	var attempts = 0
+	var ok = db.Transact(func (t *Transaction) {
+		attempts++
+		t.Set("test", "three", &TestObj{ "Three" })
+		t.Abort()
+	}, 0)
+	if ok || attempts != 1 || db.ExistsOne("test", "three") {
+		test.Errorf("Wrong abort within Transact: %d attempts", attempts)
+	}
+}
@@ -0,0 +1,85 @@
+package loge
+
+import (
+	"sync/atomic"
+)
+
+type Stats struct {
+	Store string
+	Types int
+	CachedObjects int
+	CachedVersions int
+	LastSnapshotID uint64
+	Commits uint64
+	Aborts uint64
+	Subscribers int
+}
+
+type dbCounters struct {
+	commits uint64
+	aborts uint64
+}
+
+func (db *LogeDB) Stats() Stats {
+	var stats = Stats{
+		Store: db.store.describe(),
+		Types: len(db.types),
+		LastSnapshotID: atomic.LoadUint64(&db.lastSnapshotID),
+		Commits: atomic.LoadUint64(&db.counters.commits),
+		Aborts: atomic.LoadUint64(&db.counters.aborts),
+	}
+
+	db.lock.SpinLock()
+	stats.CachedObjects = len(db.cache)
+	for _, obj := range db.cache {
+		for version := obj.Current; version != nil; version = version.Previous {
+			stats.CachedVersions++
+		}
+	}
+	db.lock.Unlock()
+
+	db.feed.lock.SpinLock()
+	stats.Subscribers = len(db.feed.subs)
+	db.feed.lock.Unlock()
+
+	return stats
+}
+
+// Drops superseded versions from cached objects, returning how many went.
+// Transactions keep the versions they already hold, and anything older
+// needed later is read from the store's snapshot again. Versions pinned
+// snapshots can see are kept.
+func (db *LogeDB) FlushCache() int {
+	var pinned = db.pins.ids()
+
+	db.lock.SpinLock()
+	defer db.lock.Unlock()
+
+	var dropped = 0
+	for _, obj := range db.cache {
+		obj.Lock.SpinLock()
+		dropped += obj.dropVersions(pinned)
+		obj.Lock.Unlock()
+	}
+	return dropped
+}
+
+// Writes a consistent copy of the store to a new database at path
+func (db *LogeDB) Backup(path string) error {
+	return db.store.backup(path)
+}
+
+// Rewrites the link indexes used by Find from the links themselves,
+// returning how many entries were written. Run it while the database is
+// quiet: links committed during the rebuild may not be indexed.
+func (db *LogeDB) RebuildIndexes() int {
+	return db.store.rebuildIndexes(db)
+}
+
+// Removes every object of a type, with its links and their indexes,
+// directly in the store, returning how many objects went. It isn't a
+// transaction: run it while nothing is using the type. Links to these
+// objects from other types are left alone.
+func (db *LogeDB) Truncate(typeName string) int {
+	return db.store.truncate(db.lookupType(typeName))
+}
@@ -0,0 +1,65 @@
+package loge
+
+import (
+	"testing"
+)
+
+func TestStats(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+
+	db.SetOne("test", "one", &TestObj{ "One" })
+
+	var trans = db.CreateTransaction()
+	trans.Write("test", "one")
+	db.SetOne("test", "one", &TestObj{ "Uno" })
+	if trans.Commit() {
+		test.Error("Conflicting commit succeeded")
+	}
+
+	var stats = db.Stats()
+	if stats.Store != "Memory" || stats.Types != 1 {
+		test.Errorf("Wrong store info: %#v", stats)
+	}
+	if stats.Commits != 2 || stats.Aborts != 1 {
+		test.Errorf("Wrong counters: %#v", stats)
+	}
+	if stats.CachedObjects != 0 {
+		test.Errorf("Objects left in cache: %#v", stats)
+	}
+}
+
+func TestFlushCache(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+
+	var holder = db.CreateTransaction()
+	holder.Read("test", "one")
+
+	db.SetOne("test", "one", &TestObj{ "One" })
+	db.SetOne("test", "one", &TestObj{ "Uno" })
+
+	var stats = db.Stats()
+	if stats.CachedObjects != 1 || stats.CachedVersions < 3 {
+		test.Fatalf("Versions not cached: %#v", stats)
+	}
+
+	if dropped := db.FlushCache(); dropped != stats.CachedVersions - 1 {
+		test.Errorf("Wrong drop count: %d", dropped)
+	}
+	if stats = db.Stats(); stats.CachedVersions != 1 {
+		test.Errorf("Versions left after flush: %#v", stats)
+	}
+
+	if holder.Exists("test", "one") {
+		test.Error("Held version changed by flush")
+	}
+	if db.ReadOne("test", "one").(*TestObj).Name != "Uno" {
+		test.Error("Wrong current version after flush")
+	}
+
+	var old = NewTransaction(db, 2)
+	if old.Read("test", "one").(*TestObj).Name != "One" {
+		test.Error("Old snapshot not reloaded after flush")
+	}
+}
@@ -0,0 +1,40 @@
+package loge
+
+import (
+	"context"
+)
+
+// Bounds the number of transactions committing at once. Waiters queue
+// on the channel in arrival order.
+type admission struct {
+	slots chan struct{}
+}
+
+func newAdmission(limit int) *admission {
+	if limit <= 0 {
+		return nil
+	}
+	return &admission{
+		slots: make(chan struct{}, limit),
+	}
+}
+
+func (a *admission) acquire(ctx context.Context) error {
+	if a == nil {
+		return nil
+	}
+
+	select {
+	case a.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (a *admission) release() {
+	if a == nil {
+		return
+	}
+	<-a.slots
+}
@@ -0,0 +1,56 @@
+package loge
+
+import (
+	"testing"
+	"context"
+	"time"
+)
+
+func TestCommitLimit(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+	db.SetCommitLimit(1)
+
+	// Hold the only slot
+	db.admission.acquire(context.Background())
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 10 * time.Millisecond)
+	defer cancel()
+
+	var trans = db.CreateTransaction()
+	trans.Set("test", "one", &TestObj{Name: "One"})
+	if trans.CommitContext(ctx) {
+		test.Error("Commit succeeded without a slot")
+	}
+
+	if trans.GetState() != CANCELLED {
+		test.Errorf("Wrong state after admission timeout: %s", trans.GetState())
+	}
+
+	if db.CreateTransaction().Exists("test", "one") {
+		test.Error("Object created by cancelled commit")
+	}
+
+	var done = make(chan bool)
+	go func() {
+		done <- db.Transact(func (t *Transaction) {
+			t.Set("test", "one", &TestObj{Name: "One"})
+		}, 0)
+	}()
+
+	select {
+	case <-done:
+		test.Fatal("Transaction committed while limit was reached")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	db.admission.release()
+
+	if !<-done {
+		test.Error("Queued transaction failed")
+	}
+
+	if !db.ExistsOne("test", "one") {
+		test.Error("Queued transaction didn't commit")
+	}
+}
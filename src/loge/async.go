@@ -0,0 +1,118 @@
+package loge
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// Commits without waiting for the store: conflicts are settled and the
+// objects updated in the cache, as with Commit, and the store write is
+// queued. done, if not nil, is called in a goroutine of its own once the
+// store has the write, with nil, or with a *StoreError if it failed.
+// It's only called if CommitAsync returns true.
+//
+// Transactions opened meanwhile see the database as of the last commit
+// the store has, so the commit becomes visible once it's durable, and
+// transactions using its objects before then conflict until it is.
+// Synchronous commits wait for queued ones first, keeping the store's
+// writes in commit order. A failed write leaves the cache ahead of the
+// store, so treat it as the store failing underneath.
+func (t *Transaction) CommitAsync(done func(error)) bool {
+	return t.CommitAsyncContext(context.Background(), done)
+}
+
+func (t *Transaction) CommitAsyncContext(ctx context.Context, done func(error)) bool {
+	t.async = true
+	t.durable = done
+	return t.CommitContext(ctx)
+}
+
+func (t *Transaction) nothingToWrite() {
+	if t.async && t.durable != nil {
+		go t.durable(nil)
+	}
+}
+
+// Waits for the store to have every commit queued so far
+func (db *LogeDB) Sync() {
+	db.async.drain()
+}
+
+type asyncWrite struct {
+	context transactionContext
+	commits *commitSequence
+	sID uint64
+	label string
+	done func(error)
+}
+
+type asyncWriter struct {
+	lock sync.Mutex
+	cond *sync.Cond
+	queue []asyncWrite
+	writing bool
+}
+
+func (db *LogeDB) visibleSnapshotID() uint64 {
+	var last = atomic.LoadUint64(&db.lastSnapshotID)
+	if visible := atomic.LoadUint64(&db.commits.visible); visible != 0 && visible < last {
+		return visible
+	}
+	return last
+}
+
+// Under the snapshot lock, so writes queue in snapshot ID order. sID
+// is already reserved in commits.
+func (writer *asyncWriter) enqueue(context transactionContext, commits *commitSequence, sID uint64, label string, done func(error)) {
+	writer.lock.Lock()
+	defer writer.lock.Unlock()
+	if writer.cond == nil {
+		writer.cond = sync.NewCond(&writer.lock)
+	}
+
+	writer.queue = append(writer.queue, asyncWrite{ context, commits, sID, label, done })
+	if !writer.writing {
+		writer.writing = true
+		go writer.run()
+	}
+}
+
+func (writer *asyncWriter) run() {
+	writer.lock.Lock()
+	for len(writer.queue) > 0 {
+		var write = writer.queue[0]
+		writer.lock.Unlock()
+
+		write.commits.wait(write.sID)
+		var err = write.context.commit(write.sID)
+		write.commits.done(write.sID)
+
+		writer.lock.Lock()
+		writer.queue = writer.queue[1:]
+
+		if err != nil {
+			err = &StoreError{ err }
+			if write.label != "" {
+				fmt.Printf("Async commit error in %s: %v\n", write.label, err)
+			} else {
+				fmt.Printf("Async commit error: %v\n", err)
+			}
+		}
+		if write.done != nil {
+			go write.done(err)
+		}
+	}
+	writer.writing = false
+	writer.cond.Broadcast()
+	writer.lock.Unlock()
+}
+
+func (writer *asyncWriter) drain() {
+	writer.lock.Lock()
+	defer writer.lock.Unlock()
+	for writer.writing {
+		writer.cond.Wait()
+	}
+}
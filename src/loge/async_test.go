@@ -0,0 +1,67 @@
+package loge
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// Sleeps until released
+type gateClock struct {
+	release chan bool
+}
+
+func (clock *gateClock) Now() time.Time {
+	return time.Now()
+}
+
+func (clock *gateClock) Sleep(d time.Duration) {
+	<-clock.release
+}
+
+func TestCommitAsync(test *testing.T) {
+	var store = NewFaultStore(NewMemStore())
+	var clock = &gateClock{ make(chan bool) }
+	store.Clock = clock
+	var db = NewLogeDB(store)
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+	db.SetOne("test", "one", &TestObj{ "One" })
+
+	store.Script(FaultCommit, Fault{ Delay: time.Second })
+	var durable = make(chan error, 1)
+	var t = db.CreateTransaction()
+	t.Write("test", "one").(*TestObj).Name = "Uno"
+	if !t.CommitAsync(func (err error) { durable <- err }) {
+		test.Fatal("Async commit failed")
+	}
+
+	// Not visible, or writable, until the store has it
+	db.ReadTransact(func (t *Transaction) {
+		if t.Read("test", "one").(*TestObj).Name != "One" {
+			test.Error("Async commit visible before store write")
+		}
+	})
+	var writer = db.CreateTransaction()
+	writer.Write("test", "one")
+	if writer.Commit() {
+		test.Error("Commit over queued write")
+	}
+
+	clock.release <- true
+	if err := <-durable; err != nil {
+		test.Errorf("Async commit error: %v", err)
+	}
+	db.Sync()
+	if db.ReadOne("test", "one").(*TestObj).Name != "Uno" {
+		test.Error("Async commit not visible once durable")
+	}
+
+	store.Script(FaultCommit, Fault{ Err: io.ErrUnexpectedEOF })
+	t = db.CreateTransaction()
+	t.Set("test", "two", &TestObj{ "Two" })
+	t.CommitAsync(func (err error) { durable <- err })
+	if err := <-durable; !errors.Is(err, io.ErrUnexpectedEOF) {
+		test.Errorf("Wrong async store error: %v", err)
+	}
+}
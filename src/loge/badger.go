@@ -0,0 +1,460 @@
+package loge
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/brendonh/spack"
+	badger "github.com/dgraph-io/badger/v4"
+)
+
+// One keyspace, split by a leading byte:
+//
+//   o <type> \0 <key>                       object
+//   l <type> \0 <link> \0 <source>          link set
+//   i <type> \0 <link> \0 <target> \0 <source>  empty
+//   m <name>                                format stamp, type:<name> -> spack type
+const badger_OBJECT = 'o'
+const badger_LINK = 'l'
+const badger_INDEX = 'i'
+const badger_META = 'm'
+
+const badger_FORMAT_VERSION uint32 = 1
+
+var badgerFormatKey = []byte("mformat")
+
+
+type badgerStore struct {
+	path string
+	db *badger.DB
+	types *spack.TypeSet
+	typeNames map[uint16]string
+}
+
+// Holds a read-only badger transaction as its snapshot. Transactions
+// aren't safe for concurrent use, so reads take the lock.
+type badgerContext struct {
+	bstore *badgerStore
+	ctx context.Context
+	lock sync.Mutex
+	txn *badger.Txn
+	snapshotID uint64
+	batch []badgerWriteEntry
+}
+
+type badgerWriteEntry struct {
+	Key []byte
+	Val []byte
+}
+
+// Pure Go, so builds without cgo. Commits are single badger
+// transactions; one too big for badger fails rather than landing in
+// parts.
+func NewBadgerStore(path string) LogeStore {
+	store, err := OpenBadgerStore(path)
+	if err != nil {
+		panic(err)
+	}
+	return store
+}
+
+func OpenBadgerStore(path string) (store LogeStore, err error) {
+	defer recoverError(&err)
+
+	db, err := badger.Open(badger.DefaultOptions(path).WithLogger(nil))
+	if err != nil {
+		return nil, storeError("Can't open DB at %s: %v", path, err)
+	}
+
+	var badgerStore = &badgerStore{
+		path: path,
+		db: db,
+		types: spack.NewTypeSet(),
+		typeNames: make(map[uint16]string),
+	}
+
+	if err := badgerStore.checkFormat(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	badgerStore.loadTypeMetadata()
+	return badgerStore, nil
+}
+
+func (store *badgerStore) close() {
+	store.db.Close()
+}
+
+// Rewrites value log files until there's nothing left worth reclaiming
+func (store *badgerStore) compact() {
+	for {
+		var err = store.db.RunValueLogGC(0.5)
+		if errors.Is(err, badger.ErrNoRewrite) {
+			return
+		}
+		if err != nil {
+			panic(storeError("Compaction error: %v", err))
+		}
+	}
+}
+
+// Badger keeps old versions, but only for its own transactions' sake
+func (store *badgerStore) retainsVersions() bool {
+	return false
+}
+
+// A full badger backup stream, loadable with badger's Load
+func (store *badgerStore) backup(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := store.db.Backup(file, 0); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+func (store *badgerStore) describe() string {
+	return fmt.Sprintf("Badger: %s", store.path)
+}
+
+func (store *badgerStore) rebuildIndexes(db *LogeDB) int {
+	if err := store.db.DropPrefix([]byte{ badger_INDEX }); err != nil {
+		panic(storeError("Can't clear index: %v", err))
+	}
+
+	var count = 0
+	var err = store.db.Update(func(txn *badger.Txn) error {
+		for _, typ := range db.types {
+			for linkName := range typ.Links {
+				var prefix = badgerLinkKey(typ.Name, linkName, "")
+				var it = txn.NewIterator(badger.IteratorOptions{ Prefix: prefix, PrefetchValues: true })
+				for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+					var item = it.Item()
+					var source = LogeKey(item.Key()[len(prefix):])
+					var val, err = item.ValueCopy(nil)
+					if err != nil {
+						it.Close()
+						return err
+					}
+					var targets []string
+					spack.DecodeFromBytes(&targets, db.linkTypeSpec, val)
+					for _, target := range targets {
+						if err := txn.Set(badgerIndexKey(typ.Name, linkName, LogeKey(target), source), []byte{}); err != nil {
+							it.Close()
+							return err
+						}
+						count++
+					}
+				}
+				it.Close()
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		panic(storeError("Write error: %v", err))
+	}
+	return count
+}
+
+func (store *badgerStore) truncate(typ *logeType) int {
+	var prefix = badgerObjectKey(typ.Name, "")
+	var count = 0
+	store.db.View(func(txn *badger.Txn) error {
+		var it = txn.NewIterator(badger.IteratorOptions{ Prefix: prefix })
+		defer it.Close()
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			count++
+		}
+		return nil
+	})
+
+	var err = store.db.DropPrefix(
+		prefix,
+		append([]byte{ badger_LINK }, typ.Name + "\x00"...),
+		append([]byte{ badger_INDEX }, typ.Name + "\x00"...))
+	if err != nil {
+		panic(storeError("Can't truncate %s: %v", typ.Name, err))
+	}
+	return count
+}
+
+func (store *badgerStore) registerType(typ *logeType) {
+	store.typeNames[typ.SpackType.Tag] = typ.Name
+	registerTypeInfo(store.types, typ, func(name string, info []byte) error {
+		return store.db.Update(func(txn *badger.Txn) error {
+			return txn.Set(badgerMetaKey("type:" + name), info)
+		})
+	})
+}
+
+func (store *badgerStore) getSpackType(name string) *spack.VersionedType {
+	return store.types.RegisterType(name)
+}
+
+
+// -----------------------------------------------
+// Transaction Contexts
+// -----------------------------------------------
+
+func (store *badgerStore) newContext(ctx context.Context, sID uint64) transactionContext {
+	return &badgerContext{
+		bstore: store,
+		ctx: ctx,
+		txn: store.db.NewTransaction(false),
+		snapshotID: sID,
+	}
+}
+
+func (context *badgerContext) getSnapshotID() uint64 {
+	return context.snapshotID
+}
+
+func (context *badgerContext) commit(sID uint64) error {
+	context.cleanup()
+	if len(context.batch) == 0 {
+		return nil
+	}
+
+	return context.bstore.db.Update(func(txn *badger.Txn) error {
+		for _, entry := range context.batch {
+			var err error
+			if entry.Val == nil {
+				err = txn.Delete(entry.Key)
+			} else {
+				err = txn.Set(entry.Key, entry.Val)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (context *badgerContext) rollback() {
+	context.cleanup()
+}
+
+func (context *badgerContext) cleanup() {
+	context.lock.Lock()
+	defer context.lock.Unlock()
+	if context.txn != nil {
+		context.txn.Discard()
+		context.txn = nil
+	}
+}
+
+
+// -----------------------------------------------
+// transactionContext API
+// -----------------------------------------------
+
+func (context *badgerContext) get(ref objRef) []byte {
+	checkContext(context.ctx)
+	context.lock.Lock()
+	defer context.lock.Unlock()
+
+	item, err := context.txn.Get(badgerRefKey(ref))
+	if err == badger.ErrKeyNotFound {
+		return nil
+	}
+	if err != nil {
+		panic(storeError("Read error: %v", err))
+	}
+	val, err := item.ValueCopy(nil)
+	if err != nil {
+		panic(storeError("Read error: %v", err))
+	}
+	return val
+}
+
+func (context *badgerContext) contains(ref objRef) bool {
+	return context.get(ref) != nil
+}
+
+func (context *badgerContext) store(ref objRef, enc []byte) error {
+	if len(enc) == 0 {
+		enc = nil
+	}
+	context.batch = append(context.batch, badgerWriteEntry{ badgerRefKey(ref), enc })
+	return nil
+}
+
+func (context *badgerContext) addIndex(ref objRef, source LogeKey) {
+	var key = badgerIndexKey(ref.Type.Name, ref.LinkName, ref.Key, source)
+	context.batch = append(context.batch, badgerWriteEntry{ key, []byte{} })
+}
+
+func (context *badgerContext) remIndex(ref objRef, source LogeKey) {
+	var key = badgerIndexKey(ref.Type.Name, ref.LinkName, ref.Key, source)
+	context.batch = append(context.batch, badgerWriteEntry{ key, nil })
+}
+
+func (context *badgerContext) find(ref objRef) ResultSet {
+	return context.findSlice(ref, "", "", -1)
+}
+
+func (context *badgerContext) findSlice(ref objRef, keyPrefix LogeKey, from LogeKey, limit int) ResultSet {
+	var base = badgerIndexKey(ref.Type.Name, ref.LinkName, ref.Key, "")
+	return context.slice(base, keyPrefix, from, limit)
+}
+
+func (context *badgerContext) listSlice(typePrefix []byte, keyPrefix LogeKey, from LogeKey, limit int) ResultSet {
+	var tag = uint16(binary.BigEndian.Uint32(typePrefix) >> 16)
+	var name, ok = context.bstore.typeNames[tag]
+	if !ok {
+		panic(storeError("No type with tag %d", tag))
+	}
+	return context.slice(badgerObjectKey(name, ""), keyPrefix, from, limit)
+}
+
+// Keys under base which start with keyPrefix, after from. Iterators
+// can't outlive the snapshot, so each page opens its own.
+func (context *badgerContext) slice(base []byte, keyPrefix LogeKey, from LogeKey, limit int) ResultSet {
+	checkContext(context.ctx)
+	if limit == 0 {
+		return &pagedResultSet{ closed: true }
+	}
+
+	if from != "" && !from.HasPrefix(keyPrefix) {
+		if from > keyPrefix {
+			return &pagedResultSet{ closed: true }
+		}
+		from = ""
+	}
+
+	var prefix = append(append([]byte{}, base...), keyPrefix...)
+	var fetch = func(after LogeKey) []LogeKey {
+		context.lock.Lock()
+		defer context.lock.Unlock()
+		if context.txn == nil {
+			return nil
+		}
+
+		var it = context.txn.NewIterator(badger.IteratorOptions{ Prefix: prefix })
+		defer it.Close()
+
+		var keys = make([]LogeKey, 0, store_PAGE_SIZE)
+		if after == "" {
+			it.Seek(prefix)
+		} else {
+			var start = append(append([]byte{}, base...), after...)
+			it.Seek(start)
+			if it.ValidForPrefix(prefix) && bytes.Equal(it.Item().Key(), start) {
+				it.Next()
+			}
+		}
+		for ; it.ValidForPrefix(prefix) && len(keys) < store_PAGE_SIZE; it.Next() {
+			keys = append(keys, LogeKey(it.Item().Key()[len(base):]))
+		}
+		return keys
+	}
+
+	return &pagedResultSet{
+		ctx: context.ctx,
+		fetch: fetch,
+		last: from,
+		limit: limit,
+	}
+}
+
+
+// -----------------------------------------------
+// Internals
+// -----------------------------------------------
+
+func badgerRefKey(ref objRef) []byte {
+	if ref.IsLink() {
+		return badgerLinkKey(ref.Type.Name, ref.LinkName, ref.Key)
+	}
+	return badgerObjectKey(ref.Type.Name, ref.Key)
+}
+
+func badgerObjectKey(typeName string, key LogeKey) []byte {
+	var buf = make([]byte, 0, len(typeName) + len(key) + 2)
+	buf = append(append(append(buf, badger_OBJECT), typeName...), 0)
+	return append(buf, key...)
+}
+
+func badgerLinkKey(typeName string, linkName string, source LogeKey) []byte {
+	var key = make([]byte, 0, len(typeName) + len(linkName) + len(source) + 3)
+	key = append(append(append(key, badger_LINK), typeName...), 0)
+	key = append(append(key, linkName...), 0)
+	return append(key, source...)
+}
+
+func badgerIndexKey(typeName string, linkName string, target LogeKey, source LogeKey) []byte {
+	var key = badgerLinkKey(typeName, linkName, target)
+	key[0] = badger_INDEX
+	key = append(key, 0)
+	return append(key, source...)
+}
+
+func badgerMetaKey(name string) []byte {
+	return append([]byte{ badger_META }, name...)
+}
+
+func (store *badgerStore) loadTypeMetadata() {
+	var typeType = store.types.Type("_type")
+	var prefix = badgerMetaKey("type:")
+
+	var err = store.db.View(func(txn *badger.Txn) error {
+		var it = txn.NewIterator(badger.IteratorOptions{ Prefix: prefix, PrefetchValues: true })
+		defer it.Close()
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			var val, err = it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			typeInfo, _, err := typeType.DecodeObj(val, false)
+			if err != nil {
+				return fmt.Errorf("Error loading type info: %v", err)
+			}
+			store.types.LoadType(typeInfo.(*spack.VersionedType))
+		}
+		return nil
+	})
+	if err != nil {
+		panic(storeError("%v", err))
+	}
+}
+
+func (store *badgerStore) checkFormat() error {
+	var stamp []byte
+	var err = store.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(badgerFormatKey)
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		stamp, err = item.ValueCopy(nil)
+		return err
+	})
+	if err != nil {
+		return storeError("Read error: %v", err)
+	}
+
+	return checkFormatStamp(store.path, stamp, badger_FORMAT_VERSION, false,
+		func (stamp []byte) error {
+			var err = store.db.Update(func(txn *badger.Txn) error {
+				return txn.Set(badgerFormatKey, stamp)
+			})
+			if err != nil {
+				return storeError("Write error: %v", err)
+			}
+			return nil
+		})
+}
@@ -0,0 +1,68 @@
+package loge
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestBadgerReopen(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "loge-badger")
+	defer os.RemoveAll(dir)
+
+	var open = func() *LogeDB {
+		var db = NewLogeDB(NewBadgerStore(dir))
+		var def = NewTypeDef("test", 1, &TestObj{})
+		def.Links = LinkSpec{ "other": "test" }
+		db.CreateType(def)
+		db.CreateType(NewTypeDef("kept", 1, &TestObj{}))
+		return db
+	}
+
+	var db = open()
+	db.Transact(func (t *Transaction) {
+		for i := 0; i < store_PAGE_SIZE + 10; i++ {
+			t.Set("test", Key("many", fmt.Sprintf("%04d", i)), &TestObj{ "Many" })
+		}
+		t.Set("test", "one", &TestObj{ "One" })
+		t.Set("kept", "one", &TestObj{ "Kept" })
+		t.AddLink("test", "other", "one", Key("many", "0001"))
+	}, 0)
+	db.Close()
+
+	db = open()
+	defer db.Close()
+	if obj := db.ReadOne("test", "one").(*TestObj); obj == nil || obj.Name != "One" {
+		test.Errorf("Object lost on reopen: %v", obj)
+	}
+	var find = func() (found []LogeKey) {
+		db.Transact(func (t *Transaction) {
+			found = t.Find("test", "other", Key("many", "0001")).All()
+		}, 0)
+		return
+	}
+	if found := find(); len(found) != 1 || found[0] != "one" {
+		test.Errorf("Index lost on reopen: %v", found)
+	}
+	db.Transact(func (t *Transaction) {
+		var keys = t.ListPrefix("test", KeyPrefix("many"), "", -1).All()
+		if len(keys) != store_PAGE_SIZE + 10 {
+			test.Errorf("Wrong keys across pages: %d", len(keys))
+		}
+		var from = t.ListPrefix("test", KeyPrefix("many"), Key("many", "0002"), 2).All()
+		if len(from) != 2 || from[0] != Key("many", "0003") {
+			test.Errorf("Wrong slice: %v", from)
+		}
+	}, 0)
+
+	if count := db.Truncate("test"); count != store_PAGE_SIZE + 11 {
+		test.Errorf("Wrong truncate count: %d", count)
+	}
+	if db.ExistsOne("test", "one") || len(find()) != 0 {
+		test.Error("Type survived truncate")
+	}
+	if db.ReadOne("kept", "one").(*TestObj) == nil {
+		test.Error("Truncate went past its type")
+	}
+}
@@ -0,0 +1,149 @@
+package loge
+
+import (
+	"fmt"
+)
+
+// Many writes to apply in one go, for transactions writing thousands of
+// objects, where taking each one separately adds up:
+//
+//   var batch = loge.NewBatch()
+//   for _, row := range rows {
+//       batch.Set("person", row.Key, row.Person)
+//       batch.AddLink("person", "team", row.Key, row.Team)
+//   }
+//   db.Transact(func (t *loge.Transaction) {
+//       t.Apply(batch)
+//   }, 0)
+//
+// A batch can be applied more than once, e.g. by retries, and isn't
+// changed by it; objects in it are stored as they are, as with Set.
+type Batch struct {
+	ops []batchOp
+}
+
+type batchOpKind int
+
+const (
+	batchSet batchOpKind = iota
+	batchDelete
+	batchAddLink
+	batchRemoveLink
+	batchSetLinks
+)
+
+type batchOp struct {
+	kind batchOpKind
+	typeName string
+	linkName string
+	key LogeKey
+	obj interface{}
+	targets []LogeKey
+}
+
+func NewBatch() *Batch {
+	return &Batch{}
+}
+
+func (batch *Batch) Len() int {
+	return len(batch.ops)
+}
+
+func (batch *Batch) Set(typeName string, key LogeKey, obj interface{}) {
+	batch.ops = append(batch.ops, batchOp{ kind: batchSet, typeName: typeName, key: key, obj: obj })
+}
+
+func (batch *Batch) Delete(typeName string, key LogeKey) {
+	batch.ops = append(batch.ops, batchOp{ kind: batchDelete, typeName: typeName, key: key })
+}
+
+func (batch *Batch) AddLink(typeName string, linkName string, key LogeKey, target LogeKey) {
+	batch.ops = append(batch.ops, batchOp{ kind: batchAddLink, typeName: typeName, linkName: linkName,
+		key: key, targets: []LogeKey{ target } })
+}
+
+func (batch *Batch) RemoveLink(typeName string, linkName string, key LogeKey, target LogeKey) {
+	batch.ops = append(batch.ops, batchOp{ kind: batchRemoveLink, typeName: typeName, linkName: linkName,
+		key: key, targets: []LogeKey{ target } })
+}
+
+func (batch *Batch) SetLinks(typeName string, linkName string, key LogeKey, targets []LogeKey) {
+	batch.ops = append(batch.ops, batchOp{ kind: batchSetLinks, typeName: typeName, linkName: linkName,
+		key: key, targets: targets })
+}
+
+// Applies the batch's operations in order, as the matching Transaction
+// methods would. Objects only Set are taken from the cache all at once;
+// those deleted and link sets are loaded in parallel, as by ReadMany.
+// Unknown types and links panic before anything is applied.
+func (t *Transaction) Apply(batch *Batch) {
+	if t.state != ACTIVE {
+		panic(fmt.Errorf("%w: %s", ErrInactive, t))
+	}
+	if t.ReadOnly() {
+		panic(fmt.Errorf("%w: %s", ErrReadOnly, t))
+	}
+
+	var refs = make([]objRef, len(batch.ops))
+	var loads = make([]objRef, 0)
+	for i, op := range batch.ops {
+		checkKey(op.key)
+		if op.kind == batchAddLink || op.kind == batchSetLinks {
+			for _, target := range op.targets {
+				checkKey(target)
+			}
+		}
+		if op.kind == batchSet || op.kind == batchDelete {
+			refs[i] = t.db.makeObjRef(op.typeName, op.key)
+		} else {
+			refs[i] = t.db.makeLinkRef(op.typeName, op.linkName, op.key)
+		}
+		if op.kind != batchSet {
+			loads = append(loads, refs[i])
+		}
+	}
+
+	t.checkLimits(len(t.missingRefs(refs)))
+	t.loadMany(loads)
+	t.acquireMany(refs)
+
+	for i, op := range batch.ops {
+		switch op.kind {
+		case batchSet:
+			var lv = t.getVersion(refs[i], true, false)
+			lv.object = op.obj
+			lv.version.LogeObj.populateMeta(op.obj, t.snapshotID)
+		case batchDelete:
+			var lv = t.getVersion(refs[i], true, true)
+			lv.object = lv.version.LogeObj.Type.NilValue()
+		case batchAddLink:
+			t.getLink(refs[i], true, true).Add(op.targets[0])
+		case batchRemoveLink:
+			t.getLink(refs[i], true, true).Remove(op.targets[0])
+		case batchSetLinks:
+			t.getLink(refs[i], true, true).Set(op.targets)
+		}
+	}
+}
+
+// Unloaded versions of whichever refs the transaction doesn't have yet
+func (t *Transaction) acquireMany(refs []objRef) {
+	var missing = t.missingRefs(refs)
+	for i, version := range t.db.acquireVersions(missing, t.context) {
+		t.addVersion(missing[i].CacheKey, version, false)
+	}
+}
+
+// Those of refs the transaction doesn't have yet, without repeats
+func (t *Transaction) missingRefs(refs []objRef) []objRef {
+	var missing = make([]objRef, 0, len(refs))
+	var seen = make(map[string]bool)
+	for _, ref := range refs {
+		if _, ok := t.versions[ref.CacheKey]; ok || seen[ref.CacheKey] {
+			continue
+		}
+		seen[ref.CacheKey] = true
+		missing = append(missing, ref)
+	}
+	return missing
+}
@@ -0,0 +1,56 @@
+package loge
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestBatch(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	var def = NewTypeDef("test", 1, &TestObj{})
+	def.Links = LinkSpec{ "other": "test" }
+	db.CreateType(def)
+	db.SetOne("test", "old", &TestObj{ "Old" })
+
+	var batch = NewBatch()
+	for i := 0; i < 100; i++ {
+		var key = LogeKey(fmt.Sprintf("%03d", i))
+		batch.Set("test", key, &TestObj{ string(key) })
+		batch.AddLink("test", "other", key, "old")
+	}
+	batch.Set("test", "000", &TestObj{ "Replaced" })
+	batch.Delete("test", "old")
+	batch.SetLinks("test", "other", "001", []LogeKey{ "002", "003" })
+	batch.RemoveLink("test", "other", "001", "002")
+
+	if !db.Transact(func (t *Transaction) {
+		t.Apply(batch)
+	}, 0) {
+		test.Fatal("Batch not committed")
+	}
+
+	db.Transact(func (t *Transaction) {
+		if t.Read("test", "050").(*TestObj).Name != "050" || t.Read("test", "000").(*TestObj).Name != "Replaced" {
+			test.Error("Wrong batch objects")
+		}
+		if t.Exists("test", "old") {
+			test.Error("Batch delete not applied")
+		}
+		if links := t.ReadLinks("test", "other", "001"); !reflect.DeepEqual(links, []LogeKey{ "003" }) {
+			test.Errorf("Wrong batch links: %v", links)
+		}
+	}, 0)
+	if len(db.cache) != 0 {
+		test.Errorf("Objects still held: %d", len(db.cache))
+	}
+
+	var bad = NewBatch()
+	bad.Set("test", "new", &TestObj{ "New" })
+	bad.Set("missing", "new", &TestObj{ "New" })
+	if _, err := db.TryTransact(func (t *Transaction) {
+		t.Apply(bad)
+	}, 0); err == nil || db.ExistsOne("test", "new") {
+		test.Errorf("Batch with unknown type applied: %v", err)
+	}
+}
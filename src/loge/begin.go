@@ -0,0 +1,67 @@
+package loge
+
+import (
+	"context"
+)
+
+// Linear alternative to Transact:
+//
+//   func rename(db *loge.LogeDB, key loge.LogeKey, name string) (err error) {
+//       var t = db.Begin()
+//       defer t.End(&err)
+//
+//       var person = t.MustWrite("person", key).(*Person)
+//       if name == "" {
+//           return errors.New("Empty name")
+//       }
+//       person.Name = name
+//       return nil
+//   }
+//
+// Unlike Transact, a conflicting commit isn't retried: End reports it
+// as ErrConflict, which is also ErrNotCommitted.
+func (db *LogeDB) Begin() *Transaction {
+	return db.CreateTransaction()
+}
+
+func (db *LogeDB) BeginContext(ctx context.Context) *Transaction {
+	return db.CreateTransactionContext(ctx)
+}
+
+// Deferred after Begin. Commits if *err is nil and nothing panicked, and
+// otherwise cancels. Loge errors raised in between, and commit failures,
+// are stored in *err; other panics carry on once the transaction is
+// cancelled. With a nil err, failures panic instead.
+func (t *Transaction) End(err *error) {
+	var r = recover()
+
+	if t.state != ACTIVE {
+		if r != nil {
+			panic(r)
+		}
+		return
+	}
+
+	if r != nil {
+		t.abandon()
+		if rerr, ok := r.(error); ok && err != nil && isLogeError(rerr) {
+			*err = rerr
+			return
+		}
+		panic(r)
+	}
+
+	if err != nil && *err != nil {
+		t.abandon()
+		return
+	}
+
+	_, cerr := t.TryCommit()
+	if cerr == nil {
+		return
+	}
+	if err == nil {
+		panic(cerr)
+	}
+	*err = cerr
+}
@@ -0,0 +1,64 @@
+package loge
+
+import (
+	"testing"
+	"errors"
+)
+
+func TestBeginEnd(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+	db.SetOne("test", "one", &TestObj{ "One" })
+
+	var rename = func(key LogeKey, name string) (err error) {
+		var t = db.Begin()
+		defer t.End(&err)
+
+		var obj = t.MustWrite("test", key).(*TestObj)
+		if name == "" {
+			return errors.New("Empty name")
+		}
+		obj.Name = name
+		return nil
+	}
+
+	if err := rename("one", "Uno"); err != nil {
+		test.Errorf("Rename failed: %v", err)
+	}
+	if err := rename("one", ""); err == nil || err.Error() != "Empty name" {
+		test.Errorf("Wrong error: %v", err)
+	}
+	if err := rename("two", "Dos"); !errors.Is(err, ErrNoSuchObject) {
+		test.Errorf("Wrong loge error: %v", err)
+	}
+	if db.ReadOne("test", "one").(*TestObj).Name != "Uno" {
+		test.Error("Wrong name after renames")
+	}
+
+	var conflicted = func() (err error) {
+		var t = db.Begin()
+		defer t.End(&err)
+		t.Write("test", "one").(*TestObj).Name = "Mine"
+		db.SetOne("test", "one", &TestObj{ "Theirs" })
+		return nil
+	}
+	if err := conflicted(); !errors.Is(err, ErrNotCommitted) {
+		test.Errorf("Conflict gave %v", err)
+	}
+
+	func() {
+		defer func() {
+			if recover() != "boom" {
+				test.Error("Foreign panic swallowed")
+			}
+		}()
+		var t = db.Begin()
+		defer t.End(nil)
+		t.Write("test", "one")
+		panic("boom")
+	}()
+
+	if db.Stats().CachedObjects != 0 {
+		test.Error("Objects left in cache")
+	}
+}
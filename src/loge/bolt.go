@@ -0,0 +1,566 @@
+package loge
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/brendonh/spack"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Top-level buckets. Each type gets a bucket of objects by key under
+// objects, and a bucket per link under links and index:
+//
+//   objects/<type>        key -> object
+//   links/<type>/<link>   source key -> link set
+//   index/<type>/<link>   target \0 source -> empty
+//   meta                  format stamp, and types/<name> -> spack type
+var boltObjects = []byte("objects")
+var boltLinks = []byte("links")
+var boltIndex = []byte("index")
+var boltMeta = []byte("meta")
+var boltTypes = []byte("types")
+var boltFormatKey = []byte("format")
+
+const bolt_FORMAT_VERSION uint32 = 1
+
+// Keys fetched per cursor pass by result sets
+const bolt_PAGE_SIZE = 256
+
+// How long Open waits for another process to let go of the file
+var BoltOpenTimeout = time.Second
+
+
+type boltStore struct {
+	path string
+	db *bolt.DB
+	types *spack.TypeSet
+	typeNames map[uint16]string
+}
+
+// Holds a read-only bolt transaction as its snapshot. Bolt transactions
+// aren't safe for concurrent use, so reads take the lock.
+type boltContext struct {
+	bstore *boltStore
+	ctx context.Context
+	lock sync.Mutex
+	tx *bolt.Tx
+	snapshotID uint64
+	batch []boltWriteEntry
+}
+
+type boltWriteEntry struct {
+	Path [][]byte
+	Key []byte
+	Val []byte
+	Delete bool
+}
+
+type boltResultSet struct {
+	ctx context.Context
+	context *boltContext
+	path [][]byte
+	prefix []byte
+	stripLen int
+	last []byte
+	page []LogeKey
+	exhausted bool
+	limit int
+	count int
+	closed bool
+}
+
+// A single-file store. Commits are bolt write transactions, so a batch
+// lands entirely or not at all. Open transactions and snapshots hold
+// bolt read transactions, which stop the file growing until they end:
+// keep them short.
+func NewBoltStore(path string) LogeStore {
+	store, err := OpenBoltStore(path)
+	if err != nil {
+		panic(err)
+	}
+	return store
+}
+
+func OpenBoltStore(path string) (store LogeStore, err error) {
+	defer recoverError(&err)
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{ Timeout: BoltOpenTimeout })
+	if err != nil {
+		return nil, storeError("Can't open DB at %s: %v", path, err)
+	}
+
+	var boltStore = &boltStore{
+		path: path,
+		db: db,
+		types: spack.NewTypeSet(),
+		typeNames: make(map[uint16]string),
+	}
+
+	if err := boltStore.checkFormat(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	boltStore.loadTypeMetadata()
+	return boltStore, nil
+}
+
+func (store *boltStore) close() {
+	store.db.Close()
+}
+
+// Bolt reuses freed pages but never shrinks the file in place
+func (store *boltStore) compact() {
+}
+
+// Commits overwrite, so only live snapshots can see the past
+func (store *boltStore) retainsVersions() bool {
+	return false
+}
+
+func (store *boltStore) backup(path string) error {
+	return store.db.View(func (tx *bolt.Tx) error {
+		return tx.CopyFile(path, 0600)
+	})
+}
+
+func (store *boltStore) describe() string {
+	return fmt.Sprintf("Bolt: %s", store.path)
+}
+
+func (store *boltStore) rebuildIndexes(db *LogeDB) int {
+	var count = 0
+	var err = store.db.Update(func (tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(boltIndex); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(boltIndex); err != nil {
+			return err
+		}
+
+		for _, typ := range db.types {
+			for linkName := range typ.Links {
+				var links = boltBucket(tx, boltLinks, []byte(typ.Name), []byte(linkName))
+				if links == nil {
+					continue
+				}
+				index, err := boltCreateBucket(tx, boltIndex, []byte(typ.Name), []byte(linkName))
+				if err != nil {
+					return err
+				}
+
+				var cursor = links.Cursor()
+				for source, val := cursor.First(); source != nil; source, val = cursor.Next() {
+					var targets []string
+					spack.DecodeFromBytes(&targets, db.linkTypeSpec, val)
+					for _, target := range targets {
+						if err := index.Put(boltIndexKey(LogeKey(target), LogeKey(source)), []byte{}); err != nil {
+							return err
+						}
+						count++
+					}
+				}
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		panic(storeError("Write error: %v", err))
+	}
+	return count
+}
+
+func (store *boltStore) truncate(typ *logeType) int {
+	var count = 0
+	var name = []byte(typ.Name)
+	var err = store.db.Update(func (tx *bolt.Tx) error {
+		if objects := boltBucket(tx, boltObjects, name); objects != nil {
+			count = objects.Stats().KeyN
+		}
+		for _, top := range [][]byte{ boltObjects, boltLinks, boltIndex } {
+			var bucket = tx.Bucket(top)
+			if bucket.Bucket(name) == nil {
+				continue
+			}
+			if err := bucket.DeleteBucket(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		panic(storeError("Write error: %v", err))
+	}
+	return count
+}
+
+func (store *boltStore) registerType(typ *logeType) {
+	store.typeNames[typ.SpackType.Tag] = typ.Name
+	registerTypeInfo(store.types, typ, func(name string, info []byte) error {
+		return store.db.Update(func (tx *bolt.Tx) error {
+			return tx.Bucket(boltMeta).Bucket(boltTypes).Put([]byte(name), info)
+		})
+	})
+}
+
+func (store *boltStore) getSpackType(name string) *spack.VersionedType {
+	return store.types.RegisterType(name)
+}
+
+
+// -----------------------------------------------
+// Search
+// -----------------------------------------------
+
+func (rs *boltResultSet) Valid() bool {
+	if rs.closed {
+		return false
+	}
+	if rs.limit >= 0 && rs.count >= rs.limit {
+		rs.Close()
+		return false
+	}
+	if len(rs.page) == 0 && !rs.exhausted {
+		rs.fill()
+	}
+	if len(rs.page) == 0 {
+		rs.Close()
+		return false
+	}
+	return true
+}
+
+func (rs *boltResultSet) Next() LogeKey {
+	if !rs.Valid() {
+		return ""
+	}
+	if rs.ctx.Err() != nil {
+		rs.Close()
+		checkContext(rs.ctx)
+	}
+	var next = rs.page[0]
+	rs.page = rs.page[1:]
+	rs.count++
+	return next
+}
+
+func (rs *boltResultSet) All() []LogeKey {
+	var keys = make([]LogeKey, 0)
+	for rs.Valid() {
+		keys = append(keys, rs.Next())
+	}
+	return keys
+}
+
+func (rs *boltResultSet) Close() {
+	rs.closed = true
+	rs.page = nil
+}
+
+// Reads the next page of keys after last, under the context's lock
+func (rs *boltResultSet) fill() {
+	var context = rs.context
+	context.lock.Lock()
+	defer context.lock.Unlock()
+
+	if context.tx == nil {
+		panic(storeError("Result set read after its transaction ended"))
+	}
+
+	var bucket = boltBucket(context.tx, rs.path...)
+	if bucket == nil {
+		rs.exhausted = true
+		return
+	}
+
+	var cursor = bucket.Cursor()
+	var key []byte
+	if rs.last == nil {
+		key, _ = cursor.Seek(rs.prefix)
+	} else {
+		key, _ = cursor.Seek(rs.last)
+		if bytes.Equal(key, rs.last) {
+			key, _ = cursor.Next()
+		}
+	}
+
+	for ; key != nil && bytes.HasPrefix(key, rs.prefix); key, _ = cursor.Next() {
+		if len(rs.page) == bolt_PAGE_SIZE {
+			return
+		}
+		rs.page = append(rs.page, LogeKey(key[rs.stripLen:]))
+		rs.last = append(rs.last[:0], key...)
+	}
+	rs.exhausted = true
+}
+
+
+// -----------------------------------------------
+// Transaction Contexts
+// -----------------------------------------------
+
+func (store *boltStore) newContext(ctx context.Context, sID uint64) transactionContext {
+	tx, err := store.db.Begin(false)
+	if err != nil {
+		panic(storeError("Can't start read: %v", err))
+	}
+	return &boltContext{
+		bstore: store,
+		ctx: ctx,
+		tx: tx,
+		snapshotID: sID,
+		batch: make([]boltWriteEntry, 0),
+	}
+}
+
+func (context *boltContext) getSnapshotID() uint64 {
+	return context.snapshotID
+}
+
+// The read transaction ends first: bolt can deadlock a writer waiting
+// on a reader in its own goroutine when the file has to grow.
+func (context *boltContext) commit(sID uint64) error {
+	context.cleanup()
+	if len(context.batch) == 0 {
+		return nil
+	}
+
+	return context.bstore.db.Update(func (tx *bolt.Tx) error {
+		for _, entry := range context.batch {
+			bucket, err := boltCreateBucket(tx, entry.Path...)
+			if err != nil {
+				return err
+			}
+			if entry.Delete {
+				err = bucket.Delete(entry.Key)
+			} else {
+				err = bucket.Put(entry.Key, entry.Val)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (context *boltContext) rollback() {
+	context.cleanup()
+}
+
+func (context *boltContext) cleanup() {
+	context.lock.Lock()
+	defer context.lock.Unlock()
+	if context.tx != nil {
+		context.tx.Rollback()
+		context.tx = nil
+	}
+}
+
+
+// -----------------------------------------------
+// transactionContext API
+// -----------------------------------------------
+
+func (context *boltContext) get(ref objRef) []byte {
+	checkContext(context.ctx)
+	context.lock.Lock()
+	defer context.lock.Unlock()
+
+	if context.tx == nil {
+		panic(storeError("Read after transaction ended"))
+	}
+
+	var bucket = boltBucket(context.tx, boltRefPath(ref)...)
+	if bucket == nil {
+		return nil
+	}
+
+	// Bolt's values only live as long as its transaction
+	var val = bucket.Get([]byte(ref.Key))
+	if val == nil {
+		return nil
+	}
+	return append([]byte{}, val...)
+}
+
+func (context *boltContext) contains(ref objRef) bool {
+	return context.get(ref) != nil
+}
+
+func (context *boltContext) store(ref objRef, enc []byte) error {
+	var path = boltRefPath(ref)
+	var key = []byte(ref.Key)
+
+	if len(enc) == 0 {
+		context.delete(path, key)
+		return nil
+	}
+
+	context.put(path, key, enc)
+	return nil
+}
+
+func (context *boltContext) addIndex(ref objRef, source LogeKey) {
+	context.put(boltIndexPath(ref), boltIndexKey(ref.Key, source), []byte{})
+}
+
+func (context *boltContext) remIndex(ref objRef, source LogeKey) {
+	context.delete(boltIndexPath(ref), boltIndexKey(ref.Key, source))
+}
+
+func (context *boltContext) find(ref objRef) ResultSet {
+	return context.findSlice(ref, "", "", -1)
+}
+
+func (context *boltContext) findSlice(ref objRef, keyPrefix LogeKey, from LogeKey, limit int) ResultSet {
+	var base = boltIndexKey(ref.Key, "")
+	return context.slice(boltIndexPath(ref), base, keyPrefix, from, limit)
+}
+
+func (context *boltContext) listSlice(typePrefix []byte, keyPrefix LogeKey, from LogeKey, limit int) ResultSet {
+	var tag = uint16(binary.BigEndian.Uint32(typePrefix) >> 16)
+	var name, ok = context.bstore.typeNames[tag]
+	if !ok {
+		panic(storeError("No type with tag %d", tag))
+	}
+	return context.slice([][]byte{ boltObjects, []byte(name) }, []byte{}, keyPrefix, from, limit)
+}
+
+// Keys in the bucket at path under base which start with keyPrefix,
+// after from
+func (context *boltContext) slice(path [][]byte, base []byte, keyPrefix LogeKey, from LogeKey, limit int) ResultSet {
+	checkContext(context.ctx)
+	if limit == 0 {
+		return &boltResultSet{ closed: true }
+	}
+
+	if from != "" && !from.HasPrefix(keyPrefix) {
+		if from > keyPrefix {
+			return &boltResultSet{ closed: true }
+		}
+		from = ""
+	}
+
+	var rs = &boltResultSet{
+		ctx: context.ctx,
+		context: context,
+		path: path,
+		prefix: append(append([]byte{}, base...), keyPrefix...),
+		stripLen: len(base),
+		limit: limit,
+	}
+	if from != "" {
+		rs.last = append(append([]byte{}, base...), from...)
+	}
+	return rs
+}
+
+// -----------------------------------------------
+// Helpers
+// -----------------------------------------------
+
+func (context *boltContext) put(path [][]byte, key []byte, val []byte) {
+	context.batch = append(context.batch, boltWriteEntry{ path, key, val, false })
+}
+
+func (context *boltContext) delete(path [][]byte, key []byte) {
+	context.batch = append(context.batch, boltWriteEntry{ path, key, nil, true })
+}
+
+func boltRefPath(ref objRef) [][]byte {
+	if ref.IsLink() {
+		return [][]byte{ boltLinks, []byte(ref.Type.Name), []byte(ref.LinkName) }
+	}
+	return [][]byte{ boltObjects, []byte(ref.Type.Name) }
+}
+
+func boltIndexPath(ref objRef) [][]byte {
+	return [][]byte{ boltIndex, []byte(ref.Type.Name), []byte(ref.LinkName) }
+}
+
+func boltIndexKey(target LogeKey, source LogeKey) []byte {
+	var key = make([]byte, 0, len(target) + 1 + len(source))
+	key = append(key, target...)
+	key = append(key, 0)
+	return append(key, source...)
+}
+
+// Nil if any bucket along path is missing
+func boltBucket(tx *bolt.Tx, path ...[]byte) *bolt.Bucket {
+	var bucket = tx.Bucket(path[0])
+	for _, name := range path[1:] {
+		if bucket == nil {
+			return nil
+		}
+		bucket = bucket.Bucket(name)
+	}
+	return bucket
+}
+
+func boltCreateBucket(tx *bolt.Tx, path ...[]byte) (*bolt.Bucket, error) {
+	bucket, err := tx.CreateBucketIfNotExists(path[0])
+	for _, name := range path[1:] {
+		if err != nil {
+			return nil, err
+		}
+		bucket, err = bucket.CreateBucketIfNotExists(name)
+	}
+	return bucket, err
+}
+
+// -----------------------------------------------
+// Internals
+// -----------------------------------------------
+
+func (store *boltStore) loadTypeMetadata() {
+	var typeType = store.types.Type("_type")
+	var err = store.db.View(func (tx *bolt.Tx) error {
+		var cursor = tx.Bucket(boltMeta).Bucket(boltTypes).Cursor()
+		for name, val := cursor.First(); name != nil; name, val = cursor.Next() {
+			var typeInfo, _, err = typeType.DecodeObj(val, false)
+			if err != nil {
+				return err
+			}
+			store.types.LoadType(typeInfo.(*spack.VersionedType))
+		}
+		return nil
+	})
+
+	if err != nil {
+		panic(storeError("Error loading type info: %v", err))
+	}
+}
+
+// Creates the top-level buckets and checks the format stamp
+func (store *boltStore) checkFormat() error {
+	var err = store.db.Update(func (tx *bolt.Tx) error {
+		for _, name := range [][]byte{ boltObjects, boltLinks, boltIndex } {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		if _, err := boltCreateBucket(tx, boltMeta, boltTypes); err != nil {
+			return err
+		}
+
+		var meta = tx.Bucket(boltMeta)
+		return checkFormatStamp(store.path, meta.Get(boltFormatKey), bolt_FORMAT_VERSION, false,
+			func (stamp []byte) error {
+				return meta.Put(boltFormatKey, stamp)
+			})
+	})
+
+	if err != nil && !errors.Is(err, ErrIncompatibleFormat) {
+		return storeError("Can't initialise %s: %v", store.path, err)
+	}
+	return err
+}
@@ -0,0 +1,56 @@
+package loge
+
+import (
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestBoltReopen(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "loge-bolt")
+	defer os.RemoveAll(dir)
+	var path = filepath.Join(dir, "loge.db")
+
+	var open = func() *LogeDB {
+		var db = NewLogeDB(NewBoltStore(path))
+		var def = NewTypeDef("test", 1, &TestObj{})
+		def.Links = LinkSpec{ "other": "test" }
+		db.CreateType(def)
+		return db
+	}
+
+	var db = open()
+	db.Transact(func (t *Transaction) {
+		t.Set("test", "one", &TestObj{ "One" })
+		t.Set("test", "two", &TestObj{ "Two" })
+		t.AddLink("test", "other", "two", "one")
+	}, 0)
+	db.Close()
+
+	db = open()
+	if obj := db.ReadOne("test", "one").(*TestObj); obj == nil || obj.Name != "One" {
+		test.Errorf("Object lost on reopen: %v", obj)
+	}
+	db.Transact(func (t *Transaction) {
+		var found = t.Find("test", "other", "one").All()
+		if len(found) != 1 || found[0] != "two" {
+			test.Errorf("Index lost on reopen: %v", found)
+		}
+	}, 0)
+
+	var newer = make([]byte, 4)
+	binary.BigEndian.PutUint32(newer, bolt_FORMAT_VERSION + 1)
+	db.store.(*boltStore).db.Update(func (tx *bolt.Tx) error {
+		return tx.Bucket(boltMeta).Put(boltFormatKey, newer)
+	})
+	db.Close()
+
+	if _, err := OpenBoltStore(path); !errors.Is(err, ErrIncompatibleFormat) {
+		test.Errorf("Opened newer format: %v", err)
+	}
+}
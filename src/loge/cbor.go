@@ -0,0 +1,603 @@
+package loge
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Objects as CBOR (RFC 8949) in its deterministic form: integers and
+// lengths as short as they go, floats in the smallest of 16, 32 or 64
+// bits that holds them exactly, and map entries, struct fields included,
+// ordered by their encoded keys. Equal objects always make the same
+// bytes, and with the version in front so do their blobs, so a store can
+// hash them to find duplicates.
+//
+// Structs are maps of field name, or the name in a `cbor:"..."` tag ("-"
+// to leave a field out), to value. Values with a MarshalText method
+// (time.Time, say) are stored as its text.
+var CBORCodec Codec = cborCodec{}
+
+type cborCodec struct{}
+
+type cborField struct {
+	name string
+	index []int
+}
+
+var cborFieldCache sync.Map
+
+var cborTextMarshaler = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+var cborTextUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+const (
+	cbor_UINT = 0
+	cbor_NEGINT = 1
+	cbor_BYTES = 2
+	cbor_TEXT = 3
+	cbor_ARRAY = 4
+	cbor_MAP = 5
+	cbor_TAG = 6
+	cbor_SIMPLE = 7
+)
+
+func (cborCodec) Name() string {
+	return "cbor"
+}
+
+func (cborCodec) Marshal(obj interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := cborEncode(&buf, reflect.ValueOf(obj)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (cborCodec) Unmarshal(blob []byte, obj interface{}) error {
+	var target = reflect.ValueOf(obj)
+	if target.Kind() != reflect.Ptr || target.IsNil() {
+		return fmt.Errorf("Can't decode into %T", obj)
+	}
+	var dec = &cborDecoder{ data: blob }
+	value, err := dec.value()
+	if err != nil {
+		return err
+	}
+	if dec.pos != len(blob) {
+		return fmt.Errorf("%d bytes left over", len(blob) - dec.pos)
+	}
+	return cborAssign(target.Elem(), value)
+}
+
+
+// -----------------------------------------------
+// Encoding
+// -----------------------------------------------
+
+func cborHead(buf *bytes.Buffer, major byte, n uint64) {
+	var b [9]byte
+	switch {
+	case n < 24:
+		buf.WriteByte(major << 5 | byte(n))
+		return
+	case n <= math.MaxUint8:
+		b[0], b[1] = major << 5 | 24, byte(n)
+		buf.Write(b[:2])
+	case n <= math.MaxUint16:
+		b[0] = major << 5 | 25
+		binary.BigEndian.PutUint16(b[1:], uint16(n))
+		buf.Write(b[:3])
+	case n <= math.MaxUint32:
+		b[0] = major << 5 | 26
+		binary.BigEndian.PutUint32(b[1:], uint32(n))
+		buf.Write(b[:5])
+	default:
+		b[0] = major << 5 | 27
+		binary.BigEndian.PutUint64(b[1:], n)
+		buf.Write(b[:9])
+	}
+}
+
+func cborInt(buf *bytes.Buffer, n int64) {
+	if n < 0 {
+		cborHead(buf, cbor_NEGINT, uint64(-1 - n))
+	} else {
+		cborHead(buf, cbor_UINT, uint64(n))
+	}
+}
+
+func cborFloat(buf *bytes.Buffer, f float64) {
+	if math.IsNaN(f) {
+		buf.Write([]byte{ 0xf9, 0x7e, 0x00 })
+		return
+	}
+	if float64(float32(f)) == f {
+		var bits = math.Float32bits(float32(f))
+		if half, ok := cborHalf(bits); ok {
+			buf.WriteByte(0xf9)
+			binary.Write(buf, binary.BigEndian, half)
+			return
+		}
+		buf.WriteByte(0xfa)
+		binary.Write(buf, binary.BigEndian, bits)
+		return
+	}
+	buf.WriteByte(0xfb)
+	binary.Write(buf, binary.BigEndian, math.Float64bits(f))
+}
+
+// The half-precision float for a single-precision one, if it's exact
+func cborHalf(bits uint32) (uint16, bool) {
+	var sign = uint16(bits >> 16) & 0x8000
+	var exp = int(bits >> 23) & 0xff
+	var mant = bits & 0x7fffff
+
+	switch {
+	case exp == 0xff:
+		return sign | 0x7c00 | uint16(mant >> 13), mant & 0x1fff == 0
+	case exp == 0 && mant == 0:
+		return sign, true
+	case exp == 0:
+		return 0, false
+	}
+
+	var unbiased = exp - 127
+	switch {
+	case unbiased >= -14 && unbiased <= 15:
+		return sign | uint16(unbiased + 15) << 10 | uint16(mant >> 13), mant & 0x1fff == 0
+	case unbiased >= -24 && unbiased < -14:
+		var shift = uint(-unbiased - 1)
+		var full = mant | 0x800000
+		return sign | uint16(full >> shift), full & (1 << shift - 1) == 0
+	}
+	return 0, false
+}
+
+func cborEncode(buf *bytes.Buffer, v reflect.Value) error {
+	if !v.IsValid() || ((v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil()) {
+		buf.WriteByte(0xf6)
+		return nil
+	}
+	if v.Type().Implements(cborTextMarshaler) {
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return err
+		}
+		cborHead(buf, cbor_TEXT, uint64(len(text)))
+		buf.Write(text)
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return cborEncode(buf, v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			buf.WriteByte(0xf5)
+		} else {
+			buf.WriteByte(0xf4)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		cborInt(buf, v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		cborHead(buf, cbor_UINT, v.Uint())
+	case reflect.Float32, reflect.Float64:
+		cborFloat(buf, v.Float())
+	case reflect.String:
+		cborHead(buf, cbor_TEXT, uint64(v.Len()))
+		buf.WriteString(v.String())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			buf.WriteByte(0xf6)
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			var data = make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(data), v)
+			cborHead(buf, cbor_BYTES, uint64(len(data)))
+			buf.Write(data)
+			return nil
+		}
+		cborHead(buf, cbor_ARRAY, uint64(v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			if err := cborEncode(buf, v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			buf.WriteByte(0xf6)
+			return nil
+		}
+		return cborEncodeMap(buf, v)
+	case reflect.Struct:
+		var fields = cborFields(v.Type())
+		cborHead(buf, cbor_MAP, uint64(len(fields)))
+		for _, field := range fields {
+			cborHead(buf, cbor_TEXT, uint64(len(field.name)))
+			buf.WriteString(field.name)
+			if err := cborEncode(buf, v.FieldByIndex(field.index)); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("Can't encode %s", v.Type())
+	}
+	return nil
+}
+
+// Entries in the order of their encoded keys
+func cborEncodeMap(buf *bytes.Buffer, v reflect.Value) error {
+	type entry struct {
+		key []byte
+		value reflect.Value
+	}
+	var entries = make([]entry, 0, v.Len())
+	var iter = v.MapRange()
+	for iter.Next() {
+		var key bytes.Buffer
+		if err := cborEncode(&key, iter.Key()); err != nil {
+			return err
+		}
+		entries = append(entries, entry{ key.Bytes(), iter.Value() })
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].key, entries[j].key) < 0
+	})
+
+	cborHead(buf, cbor_MAP, uint64(len(entries)))
+	for i, e := range entries {
+		if i > 0 && bytes.Equal(e.key, entries[i-1].key) {
+			return fmt.Errorf("Duplicate map key in %s", v.Type())
+		}
+		buf.Write(e.key)
+		if err := cborEncode(buf, e.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Exported fields, those of embedded structs in place of the struct,
+// ordered as their encoded names are: shortest first, then bytewise
+func cborFields(typ reflect.Type) []cborField {
+	if cached, ok := cborFieldCache.Load(typ); ok {
+		return cached.([]cborField)
+	}
+
+	var fields = make([]cborField, 0, typ.NumField())
+	for i := 0; i < typ.NumField(); i++ {
+		var field = typ.Field(i)
+		var tag = field.Tag.Get("cbor")
+		if tag == "-" {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && tag == "" {
+			for _, inner := range cborFields(field.Type) {
+				fields = append(fields, cborField{ inner.name, append([]int{ i }, inner.index...) })
+			}
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		var name = field.Name
+		if tagName := strings.Split(tag, ",")[0]; tagName != "" {
+			name = tagName
+		}
+		fields = append(fields, cborField{ name, []int{ i } })
+	}
+	sort.SliceStable(fields, func(i, j int) bool {
+		if len(fields[i].name) != len(fields[j].name) {
+			return len(fields[i].name) < len(fields[j].name)
+		}
+		return fields[i].name < fields[j].name
+	})
+
+	cborFieldCache.Store(typ, fields)
+	return fields
+}
+
+
+// -----------------------------------------------
+// Decoding
+// -----------------------------------------------
+
+// Values as nil, bool, int64 (uint64 past that), float64, string,
+// []byte, []interface{}, and map[string]interface{} or, if any key isn't
+// a string, map[interface{}]interface{}. Tags are dropped.
+type cborDecoder struct {
+	data []byte
+	pos int
+}
+
+func (dec *cborDecoder) next(n uint64) ([]byte, error) {
+	if n > uint64(len(dec.data) - dec.pos) {
+		return nil, fmt.Errorf("Truncated at byte %d", dec.pos)
+	}
+	var chunk = dec.data[dec.pos:dec.pos + int(n)]
+	dec.pos += int(n)
+	return chunk, nil
+}
+
+func (dec *cborDecoder) head() (byte, byte, uint64, error) {
+	b, err := dec.next(1)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	var major, info = b[0] >> 5, b[0] & 0x1f
+	switch {
+	case info < 24:
+		return major, info, uint64(info), nil
+	case info <= 27:
+		arg, err := dec.next(1 << (info - 24))
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		var n uint64
+		for _, b := range arg {
+			n = n << 8 | uint64(b)
+		}
+		return major, info, n, nil
+	}
+	return 0, 0, 0, fmt.Errorf("Unsupported CBOR item 0x%02x at byte %d", b[0], dec.pos - 1)
+}
+
+func (dec *cborDecoder) value() (interface{}, error) {
+	major, info, n, err := dec.head()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case cbor_UINT:
+		if n > math.MaxInt64 {
+			return n, nil
+		}
+		return int64(n), nil
+	case cbor_NEGINT:
+		if n > math.MaxInt64 {
+			return nil, fmt.Errorf("Negative integer out of range")
+		}
+		return -1 - int64(n), nil
+	case cbor_BYTES:
+		data, err := dec.next(n)
+		return append([]byte(nil), data...), err
+	case cbor_TEXT:
+		text, err := dec.next(n)
+		return string(text), err
+	case cbor_ARRAY:
+		if n > uint64(len(dec.data) - dec.pos) {
+			return nil, fmt.Errorf("Truncated at byte %d", dec.pos)
+		}
+		var items = make([]interface{}, n)
+		for i := range items {
+			if items[i], err = dec.value(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	case cbor_MAP:
+		return dec.mapValue(n)
+	case cbor_TAG:
+		return dec.value()
+	}
+
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23:
+		return nil, nil
+	case 25:
+		return cborHalfFloat(uint16(n)), nil
+	case 26:
+		return float64(math.Float32frombits(uint32(n))), nil
+	case 27:
+		return math.Float64frombits(n), nil
+	}
+	return nil, fmt.Errorf("Unsupported CBOR simple value %d", n)
+}
+
+func (dec *cborDecoder) mapValue(n uint64) (interface{}, error) {
+	if n > uint64(len(dec.data) - dec.pos) {
+		return nil, fmt.Errorf("Truncated at byte %d", dec.pos)
+	}
+	var keys = make([]interface{}, n)
+	var values = make([]interface{}, n)
+	var allStrings = true
+	for i := range keys {
+		var err error
+		if keys[i], err = dec.value(); err != nil {
+			return nil, err
+		}
+		if values[i], err = dec.value(); err != nil {
+			return nil, err
+		}
+		if _, ok := keys[i].(string); !ok {
+			allStrings = false
+		}
+	}
+
+	if allStrings {
+		var m = make(map[string]interface{}, n)
+		for i, key := range keys {
+			m[key.(string)] = values[i]
+		}
+		return m, nil
+	}
+	var m = make(map[interface{}]interface{}, n)
+	for i, key := range keys {
+		if key != nil && !reflect.TypeOf(key).Comparable() {
+			return nil, fmt.Errorf("Unusable map key %T", key)
+		}
+		m[key] = values[i]
+	}
+	return m, nil
+}
+
+func cborHalfFloat(half uint16) float64 {
+	var exp = int(half >> 10) & 0x1f
+	var mant = float64(half & 0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 0x1f:
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant + 1024, exp - 25)
+	}
+	if half & 0x8000 != 0 {
+		return -f
+	}
+	return f
+}
+
+func cborAssign(dst reflect.Value, value interface{}) error {
+	if value == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+	if dst.Kind() == reflect.Ptr {
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return cborAssign(dst.Elem(), value)
+	}
+	if text, ok := value.(string); ok && reflect.PtrTo(dst.Type()).Implements(cborTextUnmarshaler) {
+		return dst.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(text))
+	}
+
+	var mismatch = fmt.Errorf("Can't decode %T into %s", value, dst.Type())
+
+	switch dst.Kind() {
+	case reflect.Interface:
+		if dst.NumMethod() > 0 {
+			return mismatch
+		}
+		dst.Set(reflect.ValueOf(value))
+	case reflect.Bool:
+		b, ok := value.(bool)
+		if !ok {
+			return mismatch
+		}
+		dst.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := value.(int64)
+		if !ok || dst.OverflowInt(i) {
+			return mismatch
+		}
+		dst.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var u uint64
+		switch n := value.(type) {
+		case int64:
+			if n < 0 {
+				return mismatch
+			}
+			u = uint64(n)
+		case uint64:
+			u = n
+		default:
+			return mismatch
+		}
+		if dst.OverflowUint(u) {
+			return mismatch
+		}
+		dst.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		switch n := value.(type) {
+		case float64:
+			dst.SetFloat(n)
+		case int64:
+			dst.SetFloat(float64(n))
+		default:
+			return mismatch
+		}
+	case reflect.String:
+		s, ok := value.(string)
+		if !ok {
+			return mismatch
+		}
+		dst.SetString(s)
+	case reflect.Slice, reflect.Array:
+		if data, ok := value.([]byte); ok && dst.Type().Elem().Kind() == reflect.Uint8 {
+			if dst.Kind() == reflect.Slice {
+				dst.Set(reflect.MakeSlice(dst.Type(), len(data), len(data)))
+			}
+			reflect.Copy(dst, reflect.ValueOf(data))
+			return nil
+		}
+		items, ok := value.([]interface{})
+		if !ok {
+			return mismatch
+		}
+		if dst.Kind() == reflect.Slice {
+			dst.Set(reflect.MakeSlice(dst.Type(), len(items), len(items)))
+		}
+		for i := 0; i < len(items) && i < dst.Len(); i++ {
+			if err := cborAssign(dst.Index(i), items[i]); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		var m = reflect.MakeMap(dst.Type())
+		var set = func(key interface{}, item interface{}) error {
+			var k = reflect.New(dst.Type().Key()).Elem()
+			var elem = reflect.New(dst.Type().Elem()).Elem()
+			if err := cborAssign(k, key); err != nil {
+				return err
+			}
+			if err := cborAssign(elem, item); err != nil {
+				return err
+			}
+			m.SetMapIndex(k, elem)
+			return nil
+		}
+		switch items := value.(type) {
+		case map[string]interface{}:
+			for key, item := range items {
+				if err := set(key, item); err != nil {
+					return err
+				}
+			}
+		case map[interface{}]interface{}:
+			for key, item := range items {
+				if err := set(key, item); err != nil {
+					return err
+				}
+			}
+		default:
+			return mismatch
+		}
+		dst.Set(m)
+	case reflect.Struct:
+		// Missing fields are left alone and unknown ones ignored
+		items, ok := value.(map[string]interface{})
+		if !ok {
+			return mismatch
+		}
+		for _, field := range cborFields(dst.Type()) {
+			if item, ok := items[field.name]; ok {
+				if err := cborAssign(dst.FieldByIndex(field.index), item); err != nil {
+					return err
+				}
+			}
+		}
+	default:
+		return mismatch
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package loge
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestCBORValues(test *testing.T) {
+	// From RFC 8949, Appendix A
+	var cases = []struct {
+		value interface{}
+		expected string
+	}{
+		{ 0, "00" },
+		{ 24, "1818" },
+		{ 1000000, "1a000f4240" },
+		{ uint64(18446744073709551615), "1bffffffffffffffff" },
+		{ -1000, "3903e7" },
+		{ 1.0, "f93c00" },
+		{ 1.1, "fb3ff199999999999a" },
+		{ -4.0, "f9c400" },
+		{ 65504.0, "f97bff" },
+		{ 100000.0, "fa47c35000" },
+		{ 5.960464477539063e-8, "f90001" },
+		{ math.Inf(-1), "f9fc00" },
+		{ math.NaN(), "f97e00" },
+		{ "IETF", "6449455446" },
+		{ []byte{ 1, 2, 3, 4 }, "4401020304" },
+		{ []int{ 1, 2, 3 }, "83010203" },
+		{ map[string]string{ "b": "B", "a": "A", "aa": "AA" }, "a36161614161626142626161624141" },
+		{ map[int]bool{ 10: true, -1: false }, "a20af520f4" },
+	}
+
+	for _, c := range cases {
+		blob, err := CBORCodec.Marshal(c.value)
+		if err != nil || hex.EncodeToString(blob) != c.expected {
+			test.Errorf("Wrong encoding of %v: %x (%v)", c.value, blob, err)
+			continue
+		}
+		if f, ok := c.value.(float64); ok && math.IsNaN(f) {
+			continue
+		}
+		var decoded = reflect.New(reflect.TypeOf(c.value))
+		if err := CBORCodec.Unmarshal(blob, decoded.Interface()); err != nil || !reflect.DeepEqual(decoded.Elem().Interface(), c.value) {
+			test.Errorf("Wrong decoding of %x: %v (%v)", blob, decoded.Elem(), err)
+		}
+	}
+}
+
+type cborObj struct {
+	Meta
+	Name string `cbor:"name"`
+	Counts map[string]int
+	Tags []string
+	Extra interface{}
+	Scratch string `cbor:"-"`
+}
+
+type cborReordered struct {
+	Tags []string
+	Extra interface{}
+	Counts map[string]int
+	Title string `cbor:"name"`
+}
+
+func TestCBORDeterministic(test *testing.T) {
+	var counts = make(map[string]int)
+	for i := 0; i < 50; i++ {
+		counts[string(rune('a' + i % 26)) + string(rune('A' + i))] = i
+	}
+	var obj = &cborObj{ Name: "One", Counts: counts, Tags: []string{ "x" }, Extra: 2.5 }
+	var first, _ = CBORCodec.Marshal(obj)
+	for i := 0; i < 20; i++ {
+		if blob, _ := CBORCodec.Marshal(obj); !bytes.Equal(blob, first) {
+			test.Fatalf("Encoding changed: %x, %x", first, blob)
+		}
+	}
+
+	var reordered, _ = CBORCodec.Marshal(&cborReordered{ []string{ "x" }, 2.5, counts, "One" })
+	if !bytes.Equal(reordered, first) {
+		test.Errorf("Field order changed encoding: %x, %x", first, reordered)
+	}
+}
+
+func TestCBORCodec(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	db.SetCodec(CBORCodec)
+	db.CreateType(NewTypeDef("test", 1, &cborObj{}))
+
+	var obj = &cborObj{ Name: "One", Counts: map[string]int{ "a": 1 }, Extra: []interface{}{ int64(-2), "two" }, Scratch: "Gone" }
+	db.SetOne("test", "one", obj)
+	db.SetOne("test", "two", &cborObj{ Name: "One", Counts: map[string]int{ "a": 1 }, Extra: []interface{}{ int64(-2), "two" } })
+	if !bytes.Equal(storedBlob(db, "test", "one"), storedBlob(db, "test", "two")) {
+		test.Errorf("Equal objects stored differently")
+	}
+
+	var read = db.ReadOne("test", "one").(*cborObj)
+	obj.Scratch = ""
+	read.Meta, obj.Meta = Meta{}, Meta{}
+	if !reflect.DeepEqual(read, obj) {
+		test.Errorf("Wrong object through codec: %+v", read)
+	}
+
+	db.TransactJSON(func (t *Transaction) {
+		if obj := t.Read("test", "one").(map[string]interface{}); obj["Name"] != "One" {
+			test.Errorf("Wrong JSON object: %v", obj)
+		}
+	}, 0)
+}
@@ -0,0 +1,34 @@
+package loge
+
+import (
+	"time"
+)
+
+// Where the DB gets the time: transaction timeouts, feed timestamps, and
+// anything else that waits. Tests swap in a virtual clock (see
+// logetest.VirtualClock) to make timing reproducible.
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+var RealClock Clock = realClock{}
+
+// Set before use
+func (db *LogeDB) SetClock(clock Clock) {
+	db.clock = clock
+}
+
+func (db *LogeDB) Clock() Clock {
+	return db.clock
+}
@@ -0,0 +1,149 @@
+package loge
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+)
+
+// How a type's objects become blobs for the store and back, in place of
+// loge's own versioned spack encoding:
+//
+//   db.SetCodec(myCodec)          // types created from now on
+//   def.Codec = otherCodec        // just this one
+//
+// Marshal gets objects of the type's exemplar type; Unmarshal gets a
+// fresh one (see TypeDef.Exemplar) to fill in. Blobs carry the type
+// version they were written at, and objects from older versions are
+// unmarshalled into the current exemplar and count as upgraded, so
+// they're written back at the new version. Upgraders only run under
+// spack.
+//
+// Stored blobs don't say which codec wrote them, so a type keeps the
+// codec it was first stored with; Migrate into a new store to change it.
+type Codec interface {
+	Name() string
+	Marshal(obj interface{}) ([]byte, error)
+	Unmarshal(blob []byte, obj interface{}) error
+}
+
+// Codecs which can copy an object more cheaply than marshalling and
+// unmarshalling it, which is what ReadCopy does otherwise
+type CodecCopier interface {
+	Copy(obj interface{}) interface{}
+}
+
+// For types created after, which don't set their own. Nil for spack.
+func (db *LogeDB) SetCodec(codec Codec) {
+	db.codec = codec
+}
+
+func (db *LogeDB) Codec() Codec {
+	return db.codec
+}
+
+// Type version, then whatever the codec made
+func (t *logeType) codecEncode(obj interface{}) []byte {
+	payload, err := t.Codec.Marshal(obj)
+	if err != nil {
+		panic(fmt.Sprintf("Encode error (%s): %v", t.Codec.Name(), err))
+	}
+	var enc = make([]byte, 2, 2 + len(payload))
+	binary.BigEndian.PutUint16(enc, t.Version)
+	return append(enc, payload...)
+}
+
+func (t *logeType) codecDecode(enc []byte, toJSON bool) (interface{}, bool) {
+	if len(enc) < 2 {
+		panic(storeError("Decode error (%s): %d byte blob", t.Codec.Name(), len(enc)))
+	}
+	var upgraded = storedVersion(enc) != t.Version
+	var obj interface{}
+	if upgraded && (len(t.Renames) > 0 || t.upgradesFrom(storedVersion(enc))) {
+		obj = t.codecEvolve(enc)
+	}
+	if obj == nil {
+		obj = t.NewValue()
+		if err := t.Codec.Unmarshal(enc[2:], obj); err != nil {
+			panic(storeError("Decode error (%s): %v", t.Codec.Name(), err))
+		}
+	}
+
+	if toJSON {
+		return jsonGeneric(obj), upgraded
+	}
+	return obj, upgraded
+}
+
+
+// -----------------------------------------------
+// JSON
+// -----------------------------------------------
+
+// Objects as encoding/json has them, json struct tags and all, so the
+// store can be read with ordinary tools: past the two version bytes a
+// blob is a JSON document. Numbers in interface{} fields come back as
+// float64, as they do from json.Unmarshal.
+var JSONCodec Codec = jsonCodec{}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+func (jsonCodec) Marshal(obj interface{}) ([]byte, error) {
+	return json.Marshal(obj)
+}
+
+func (jsonCodec) Unmarshal(blob []byte, obj interface{}) error {
+	return json.Unmarshal(blob, obj)
+}
+
+
+// -----------------------------------------------
+// Hooks
+// -----------------------------------------------
+
+// Types whose exemplar has both methods are stored by them rather than
+// the DB's codec, so objects with unexported fields, interfaces or
+// handles to things outside can say what of them to keep. A TypeDef
+// naming a codec still takes precedence. UnmarshalLoge is called on a
+// fresh object, and TransactJSON sees what encoding/json makes of it.
+type LogeMarshaler interface {
+	MarshalLoge() ([]byte, error)
+}
+
+type LogeUnmarshaler interface {
+	UnmarshalLoge(blob []byte) error
+}
+
+var hookCodec Codec = marshalerCodec{}
+
+type marshalerCodec struct{}
+
+func (marshalerCodec) Name() string {
+	return "hooks"
+}
+
+func (marshalerCodec) Marshal(obj interface{}) ([]byte, error) {
+	marshaler, ok := obj.(LogeMarshaler)
+	if !ok {
+		return nil, fmt.Errorf("%T has no MarshalLoge", obj)
+	}
+	return marshaler.MarshalLoge()
+}
+
+func (marshalerCodec) Unmarshal(blob []byte, obj interface{}) error {
+	unmarshaler, ok := obj.(LogeUnmarshaler)
+	if !ok {
+		return fmt.Errorf("%T has no UnmarshalLoge", obj)
+	}
+	return unmarshaler.UnmarshalLoge(blob)
+}
+
+func hasHooks(exemplar interface{}) bool {
+	_, marshals := exemplar.(LogeMarshaler)
+	_, unmarshals := exemplar.(LogeUnmarshaler)
+	return marshals && unmarshals
+}
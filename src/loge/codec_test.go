@@ -0,0 +1,182 @@
+package loge
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type gobCodec struct{}
+
+func (gobCodec) Name() string {
+	return "gob"
+}
+
+func (gobCodec) Marshal(obj interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(obj)
+	return buf.Bytes(), err
+}
+
+func (gobCodec) Unmarshal(blob []byte, obj interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(blob)).Decode(obj)
+}
+
+func storedBlob(db *LogeDB, typeName string, key LogeKey) []byte {
+	var _, context = db.currentContext(context.Background())
+	defer context.rollback()
+	return context.get(db.makeObjRef(typeName, key))
+}
+
+func TestCodecSelection(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	db.SetCodec(gobCodec{})
+	db.CreateType(NewTypeDef("gob", 1, &TestObj{}))
+
+	var def = NewTypeDef("spack", 1, &TestObj{})
+	db.SetCodec(nil)
+	db.CreateType(def)
+
+	db.SetOne("gob", "one", &TestObj{ "One" })
+	db.SetOne("spack", "one", &TestObj{ "One" })
+
+	var expected, _ = gobCodec{}.Marshal(&TestObj{ "One" })
+	if blob := storedBlob(db, "gob", "one"); !bytes.Equal(blob[2:], expected) {
+		test.Errorf("Wrong blob from codec: %x", blob)
+	}
+	if obj := db.ReadOne("gob", "one").(*TestObj); obj.Name != "One" {
+		test.Errorf("Wrong object through codec: %v", obj)
+	}
+
+	var spackBlob = db.lookupType("spack").Encode(&TestObj{ "One" })
+	if blob := storedBlob(db, "spack", "one"); !bytes.Equal(blob, spackBlob) {
+		test.Errorf("Default codec not used: %x", blob)
+	}
+}
+
+func TestCodecPerType(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "loge-codec")
+	defer os.RemoveAll(dir)
+	var path = filepath.Join(dir, "loge.log")
+
+	var db = NewLogeDB(NewLogStore(path, nil))
+	var def = NewTypeDef("test", 1, &TestObj{})
+	def.Codec = gobCodec{}
+	db.CreateType(def)
+	db.SetOne("test", "one", &TestObj{ "One" })
+	db.Close()
+
+	// Written at version 1, read at 2
+	db = NewLogeDB(NewLogStore(path, nil))
+	defer db.Close()
+	def = NewTypeDef("test", 2, &TestObj{})
+	def.Codec = gobCodec{}
+	db.CreateType(def)
+
+	db.Transact(func (t *Transaction) {
+		if obj := t.Read("test", "one").(*TestObj); obj.Name != "One" {
+			test.Errorf("Wrong object from old version: %v", obj)
+		}
+	}, 0)
+	if version := storedBlob(db, "test", "one")[1]; version != 2 {
+		test.Errorf("Upgraded object not written back: version %d", version)
+	}
+
+	db.TransactJSON(func (t *Transaction) {
+		var obj = t.Read("test", "one").(map[string]interface{})
+		if obj["Name"] != "One" {
+			test.Errorf("Wrong JSON object: %v", obj)
+		}
+	}, 0)
+}
+
+type taggedObj struct {
+	Meta
+	Name string `json:"name"`
+	Count int `json:"count,omitempty"`
+	Scratch string `json:"-"`
+}
+
+func TestJSONCodec(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "loge-codec")
+	defer os.RemoveAll(dir)
+	var path = filepath.Join(dir, "loge.log")
+
+	var open = func() *LogeDB {
+		var db = NewLogeDB(NewLogStore(path, nil))
+		db.SetCodec(JSONCodec)
+		db.CreateType(NewTypeDef("test", 1, &taggedObj{}))
+		return db
+	}
+
+	var db = open()
+	db.SetOne("test", "one", &taggedObj{ Name: "One", Count: 3, Scratch: "Gone" })
+	db.SetOne("test", "two", &taggedObj{ Name: "Two" })
+	if blob := storedBlob(db, "test", "one"); string(blob[2:]) != `{"name":"One","count":3}` {
+		test.Errorf("Wrong JSON: %q", blob)
+	}
+	if blob := storedBlob(db, "test", "two"); string(blob[2:]) != `{"name":"Two"}` {
+		test.Errorf("Wrong JSON: %q", blob)
+	}
+	db.Close()
+
+	db = open()
+	defer db.Close()
+	var obj = db.ReadOne("test", "one").(*taggedObj)
+	if obj.Name != "One" || obj.Count != 3 || obj.Scratch != "" || obj.Key() != "one" {
+		test.Errorf("Wrong object on reopen: %+v", obj)
+	}
+}
+
+// Nothing spack or JSON could store
+type hookObj struct {
+	name string
+	count int
+	out io.Writer
+}
+
+func (obj *hookObj) MarshalLoge() ([]byte, error) {
+	return []byte(fmt.Sprintf("%s/%d", obj.name, obj.count)), nil
+}
+
+func (obj *hookObj) UnmarshalLoge(blob []byte) error {
+	var parts = strings.SplitN(string(blob), "/", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("Bad hookObj: %q", blob)
+	}
+	obj.name = parts[0]
+	obj.count, _ = strconv.Atoi(parts[1])
+	obj.out = ioutil.Discard
+	return nil
+}
+
+func TestCodecHooks(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	db.SetCodec(JSONCodec)
+	var typ = db.CreateType(NewTypeDef("hooks", 1, &hookObj{}))
+	if typ.Codec != hookCodec {
+		test.Fatalf("Hooks not preferred: %v", typ.Codec)
+	}
+
+	var def = NewTypeDef("gob", 1, &TestObj{})
+	def.Codec = gobCodec{}
+	if typ = db.CreateType(def); typ.Codec != def.Codec {
+		test.Errorf("TypeDef codec not used: %v", typ.Codec)
+	}
+
+	db.SetOne("hooks", "one", &hookObj{ "One", 3, os.Stdout })
+	if blob := storedBlob(db, "hooks", "one"); string(blob[2:]) != "One/3" {
+		test.Errorf("Wrong blob from hooks: %q", blob)
+	}
+	if obj := db.ReadOne("hooks", "one").(*hookObj); obj.name != "One" || obj.count != 3 || obj.out != ioutil.Discard {
+		test.Errorf("Wrong object from hooks: %+v", obj)
+	}
+}
@@ -0,0 +1,280 @@
+package loge
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Somewhere to keep blobs which aren't worth keeping locally, such as
+// an S3 bucket (see S3Storage). Get returns ErrNoSuchObject for keys it
+// doesn't have.
+type ColdStorage interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Put(ctx context.Context, key string, blob []byte) error
+	Delete(ctx context.Context, key string) error
+}
+
+// A store wrapper which pages objects nobody has touched in a while out
+// to cold storage, leaving a marker in the local store:
+//
+//   var store = loge.NewColdStore(loge.NewLevelDBStore(path), loge.NewS3Storage(config))
+//   var db = loge.NewLogeDB(store)
+//   ...
+//   count, err := store.PageOut(ctx, 24 * time.Hour)
+//
+// Reading a paged out object fetches it and puts it back locally, so
+// transactions never see the difference beyond the wait. Links stay
+// local. Paging out lists types, so the local store has to support List.
+type ColdStore struct {
+	LogeStore
+	Cold ColdStorage
+	Clock Clock
+
+	// Paging and faulting take this, so neither overwrites a commit
+	writeLock sync.Mutex
+	lastSnapshotID uint64
+	types map[string]*logeType
+
+	accessLock sync.Mutex
+	accessed map[string]time.Time
+	opened time.Time
+}
+
+type coldContext struct {
+	transactionContext
+	cstore *ColdStore
+	ctx context.Context
+	written []objRef
+}
+
+// Prefixes local blobs standing in for paged out ones; the cold key
+// follows. Spack never starts an object with it.
+var coldMarker = []byte("\x00\xffloge-cold\x00")
+
+func NewColdStore(store LogeStore, cold ColdStorage) *ColdStore {
+	return &ColdStore{
+		LogeStore: store,
+		Cold: cold,
+		Clock: RealClock,
+		types: make(map[string]*logeType),
+		accessed: make(map[string]time.Time),
+		opened: RealClock.Now(),
+	}
+}
+
+func (store *ColdStore) describe() string {
+	return fmt.Sprintf("Cold storage over %s", store.LogeStore.describe())
+}
+
+func (store *ColdStore) registerType(typ *logeType) {
+	store.LogeStore.registerType(typ)
+	store.writeLock.Lock()
+	store.types[typ.Name] = typ
+	store.writeLock.Unlock()
+}
+
+// Pages out objects not read or written for idle, returning how many
+// went. Objects untouched since the store was opened count as idle
+// since then.
+func (store *ColdStore) PageOut(ctx context.Context, idle time.Duration) (count int, err error) {
+	defer recoverError(&err)
+
+	var cutoff = store.Clock.Now().Add(-idle)
+	store.writeLock.Lock()
+	var types = make([]*logeType, 0, len(store.types))
+	for _, typ := range store.types {
+		types = append(types, typ)
+	}
+	store.writeLock.Unlock()
+
+	for _, typ := range types {
+		var from LogeKey = ""
+		for {
+			var keys = store.listPage(ctx, typ, from)
+			for _, key := range keys {
+				var ref = makeObjRef(typ, key)
+				if store.lastAccess(ref).After(cutoff) {
+					continue
+				}
+				if store.pageOut(ctx, ref) {
+					count++
+				}
+			}
+			if len(keys) < store_PAGE_SIZE {
+				break
+			}
+			from = keys[len(keys)-1]
+		}
+	}
+	return count, nil
+}
+
+func (store *ColdStore) listPage(ctx context.Context, typ *logeType, from LogeKey) []LogeKey {
+	var context = store.LogeStore.newContext(ctx, store.latestSnapshotID())
+	defer context.rollback()
+	return context.listSlice(typePrefix(typ), "", from, store_PAGE_SIZE).All()
+}
+
+func (store *ColdStore) pageOut(ctx context.Context, ref objRef) bool {
+	var blob = store.localGet(ctx, ref)
+	if blob == nil || isColdMarker(blob) {
+		return false
+	}
+
+	var sum = sha256.Sum256(blob)
+	var coldKey = fmt.Sprintf("%s/%s/%s", ref.Type.Name, url.PathEscape(string(ref.Key)), hex.EncodeToString(sum[:16]))
+	if err := store.Cold.Put(ctx, coldKey, blob); err != nil {
+		panic(&StoreError{ err })
+	}
+
+	// Only if nobody committed to it while we uploaded
+	return store.replaceLocal(ctx, ref, blob, append(append([]byte{}, coldMarker...), coldKey...))
+}
+
+func (store *ColdStore) faultIn(ctx context.Context, ref objRef, marker []byte) []byte {
+	var coldKey = string(marker[len(coldMarker):])
+	blob, err := store.Cold.Get(ctx, coldKey)
+	if err != nil {
+		panic(&StoreError{ fmt.Errorf("Fetching %s from cold storage: %w", ref.Key, err) })
+	}
+	if store.replaceLocal(ctx, ref, marker, blob) {
+		store.dropCold(ctx, coldKey)
+	}
+	return blob
+}
+
+// Unless the local store keeps old versions which may still point at it
+func (store *ColdStore) dropCold(ctx context.Context, coldKey string) {
+	if store.LogeStore.retainsVersions() {
+		return
+	}
+	if err := store.Cold.Delete(ctx, coldKey); err != nil && !errors.Is(err, ErrNoSuchObject) {
+		fmt.Printf("Error deleting %s from cold storage: %v\n", coldKey, err)
+	}
+}
+
+// Swaps one blob for another standing for the same object, as a commit
+// of its own at the latest snapshot ID
+func (store *ColdStore) replaceLocal(ctx context.Context, ref objRef, from []byte, to []byte) bool {
+	store.writeLock.Lock()
+	defer store.writeLock.Unlock()
+
+	var sID = store.lastSnapshotID
+	var context = store.LogeStore.newContext(ctx, sID)
+	if !bytes.Equal(context.get(ref), from) {
+		context.rollback()
+		return false
+	}
+	context.store(ref, to)
+	if err := context.commit(sID); err != nil {
+		panic(&StoreError{ err })
+	}
+	return true
+}
+
+func (store *ColdStore) localGet(ctx context.Context, ref objRef) []byte {
+	var context = store.LogeStore.newContext(ctx, store.latestSnapshotID())
+	defer context.rollback()
+	return context.get(ref)
+}
+
+func (store *ColdStore) latestSnapshotID() uint64 {
+	store.writeLock.Lock()
+	defer store.writeLock.Unlock()
+	return store.lastSnapshotID
+}
+
+func (store *ColdStore) touch(ref objRef) {
+	store.accessLock.Lock()
+	store.accessed[ref.CacheKey] = store.Clock.Now()
+	store.accessLock.Unlock()
+}
+
+func (store *ColdStore) lastAccess(ref objRef) time.Time {
+	store.accessLock.Lock()
+	defer store.accessLock.Unlock()
+	if at, ok := store.accessed[ref.CacheKey]; ok {
+		return at
+	}
+	return store.opened
+}
+
+func isColdMarker(blob []byte) bool {
+	return bytes.HasPrefix(blob, coldMarker)
+}
+
+
+// -----------------------------------------------
+// Transaction Contexts
+// -----------------------------------------------
+
+func (store *ColdStore) newContext(ctx context.Context, sID uint64) transactionContext {
+	store.writeLock.Lock()
+	if sID > store.lastSnapshotID {
+		store.lastSnapshotID = sID
+	}
+	store.writeLock.Unlock()
+
+	return &coldContext{
+		transactionContext: store.LogeStore.newContext(ctx, sID),
+		cstore: store,
+		ctx: ctx,
+	}
+}
+
+func (context *coldContext) get(ref objRef) []byte {
+	var blob = context.transactionContext.get(ref)
+	if ref.IsLink() {
+		return blob
+	}
+	context.cstore.touch(ref)
+	if isColdMarker(blob) {
+		return context.cstore.faultIn(context.ctx, ref, blob)
+	}
+	return blob
+}
+
+func (context *coldContext) store(ref objRef, enc []byte) error {
+	if !ref.IsLink() {
+		context.cstore.touch(ref)
+		context.written = append(context.written, ref)
+	}
+	return context.transactionContext.store(ref, enc)
+}
+
+// Cold copies of objects this overwrites are dropped once it's in
+func (context *coldContext) commit(sID uint64) error {
+	var store = context.cstore
+	store.writeLock.Lock()
+
+	var superseded = make([]string, 0)
+	if len(context.written) > 0 && !store.LogeStore.retainsVersions() {
+		var current = store.LogeStore.newContext(context.ctx, store.lastSnapshotID)
+		for _, ref := range context.written {
+			if blob := current.get(ref); isColdMarker(blob) {
+				superseded = append(superseded, string(blob[len(coldMarker):]))
+			}
+		}
+		current.rollback()
+	}
+
+	var err = context.transactionContext.commit(sID)
+	if err == nil && sID > store.lastSnapshotID {
+		store.lastSnapshotID = sID
+	}
+	store.writeLock.Unlock()
+
+	if err == nil {
+		for _, coldKey := range superseded {
+			store.dropCold(context.ctx, coldKey)
+		}
+	}
+	return err
+}
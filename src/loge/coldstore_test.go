@@ -0,0 +1,140 @@
+package loge
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memColdStorage struct {
+	lock sync.Mutex
+	blobs map[string][]byte
+}
+
+func (cold *memColdStorage) Get(ctx context.Context, key string) ([]byte, error) {
+	cold.lock.Lock()
+	defer cold.lock.Unlock()
+	if blob, ok := cold.blobs[key]; ok {
+		return blob, nil
+	}
+	return nil, ErrNoSuchObject
+}
+
+func (cold *memColdStorage) Put(ctx context.Context, key string, blob []byte) error {
+	cold.lock.Lock()
+	defer cold.lock.Unlock()
+	cold.blobs[key] = blob
+	return nil
+}
+
+func (cold *memColdStorage) Delete(ctx context.Context, key string) error {
+	cold.lock.Lock()
+	defer cold.lock.Unlock()
+	delete(cold.blobs, key)
+	return nil
+}
+
+func TestColdStore(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "loge-cold")
+	defer os.RemoveAll(dir)
+
+	var cold = &memColdStorage{ blobs: make(map[string][]byte) }
+	var clock = &manualClock{ now: time.Unix(1000, 0) }
+	var store = NewColdStore(NewBoltStore(filepath.Join(dir, "loge.db")), cold)
+	store.Clock, store.opened = clock, clock.Now()
+
+	var db = NewLogeDB(store)
+	defer db.Close()
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+	db.SetOne("test", "one", &TestObj{ "One" })
+	db.SetOne("test", "two", &TestObj{ "Two" })
+
+	clock.Sleep(time.Hour)
+	db.ReadOne("test", "two")
+
+	var ctx = context.Background()
+	if count, err := store.PageOut(ctx, time.Minute); err != nil || count != 1 {
+		test.Fatalf("Wrong page out: %d %v", count, err)
+	}
+	var ref = makeObjRef(db.lookupType("test"), "one")
+	if !isColdMarker(store.localGet(ctx, ref)) || len(cold.blobs) != 1 {
+		test.Fatal("Object not paged out")
+	}
+
+	if obj := db.ReadOne("test", "one").(*TestObj); obj == nil || obj.Name != "One" {
+		test.Errorf("Wrong object faulted in: %v", obj)
+	}
+	if isColdMarker(store.localGet(ctx, ref)) || len(cold.blobs) != 0 {
+		test.Error("Object not put back locally")
+	}
+
+	// Overwriting a paged out object drops its cold copy
+	clock.Sleep(time.Hour)
+	if count, _ := store.PageOut(ctx, time.Minute); count != 2 {
+		test.Errorf("Wrong page out: %d", count)
+	}
+	db.SetOne("test", "two", &TestObj{ "Deux" })
+	if len(cold.blobs) != 1 {
+		test.Errorf("Superseded cold copy kept: %d", len(cold.blobs))
+	}
+	if obj := db.ReadOne("test", "two").(*TestObj); obj == nil || obj.Name != "Deux" {
+		test.Errorf("Wrong object: %v", obj)
+	}
+}
+
+func TestS3Storage(test *testing.T) {
+	var blobs = make(map[string][]byte)
+	var server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		var path = r.URL.EscapedPath()
+		switch r.Method {
+		case "PUT":
+			blobs[path], _ = io.ReadAll(r.Body)
+		case "GET":
+			if blob, ok := blobs[path]; ok {
+				w.Write(blob)
+			} else {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		case "DELETE":
+			delete(blobs, path)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	var s3 = NewS3Storage(S3Config{
+		Endpoint: server.URL,
+		Region: "us-east-1",
+		Bucket: "bucket",
+		Prefix: "loge/",
+		AccessKey: "key",
+		SecretKey: "secret",
+	})
+	var ctx = context.Background()
+	if err := s3.Put(ctx, "test/a%20b/00ff", []byte("blob")); err != nil {
+		test.Fatal(err)
+	}
+	if _, ok := blobs["/bucket/loge/test/a%2520b/00ff"]; !ok {
+		test.Errorf("Wrong path: %v", blobs)
+	}
+	if blob, err := s3.Get(ctx, "test/a%20b/00ff"); err != nil || string(blob) != "blob" {
+		test.Errorf("Wrong get: %q %v", blob, err)
+	}
+	s3.Delete(ctx, "test/a%20b/00ff")
+	if _, err := s3.Get(ctx, "test/a%20b/00ff"); !errors.Is(err, ErrNoSuchObject) {
+		test.Errorf("Wrong error for missing object: %v", err)
+	}
+}
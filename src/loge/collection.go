@@ -0,0 +1,107 @@
+package loge
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Typed access to one registered type, so application code doesn't
+// juggle type names and interface values:
+//
+//   var people = loge.Collection[Person](db, "person")
+//   var friends = people.Link("friends")
+//
+//   db.Transact(func (t *loge.Transaction) {
+//       var person = people.Write(t, "brendon")
+//       person.Age++
+//       friends.Add(t, "brendon", "alice")
+//   }, 0)
+//
+// The type's exemplar must be a *T. Handles don't work in TransactJSON
+// transactions, which give JSON instead of objects.
+type Objects[T any] struct {
+	TypeName string
+}
+
+type Links struct {
+	TypeName string
+	LinkName string
+}
+
+func Collection[T any](db *LogeDB, typeName string) *Objects[T] {
+	var typ = db.lookupType(typeName)
+	if reflect.TypeOf(typ.Exemplar) != reflect.TypeOf((*T)(nil)) {
+		panic(fmt.Sprintf("Type %s holds %T, not %T", typeName, typ.Exemplar, (*T)(nil)))
+	}
+	return &Objects[T]{ typeName }
+}
+
+func (c *Objects[T]) Exists(t *Transaction, key LogeKey) bool {
+	return t.Exists(c.TypeName, key)
+}
+
+// Nil if the object doesn't exist
+func (c *Objects[T]) Read(t *Transaction, key LogeKey) *T {
+	return t.Read(c.TypeName, key).(*T)
+}
+
+func (c *Objects[T]) ReadOK(t *Transaction, key LogeKey) (*T, bool) {
+	obj, ok := t.ReadOK(c.TypeName, key)
+	if !ok {
+		return nil, false
+	}
+	return obj.(*T), true
+}
+
+func (c *Objects[T]) Write(t *Transaction, key LogeKey) *T {
+	return t.Write(c.TypeName, key).(*T)
+}
+
+func (c *Objects[T]) Set(t *Transaction, key LogeKey, obj *T) {
+	t.Set(c.TypeName, key, obj)
+}
+
+func (c *Objects[T]) Delete(t *Transaction, key LogeKey) {
+	t.Delete(c.TypeName, key)
+}
+
+func (c *Objects[T]) List(t *Transaction, from LogeKey, limit int) ResultSet {
+	return t.ListSlice(c.TypeName, from, limit)
+}
+
+func (c *Objects[T]) Find(t *Transaction, linkName string, target LogeKey) ResultSet {
+	return t.Find(c.TypeName, linkName, target)
+}
+
+func (c *Objects[T]) Link(linkName string) *Links {
+	return &Links{ c.TypeName, linkName }
+}
+
+// -----------------------------------------------
+// Links
+// -----------------------------------------------
+
+func (l *Links) Read(t *Transaction, key LogeKey) []LogeKey {
+	return t.ReadLinks(l.TypeName, l.LinkName, key)
+}
+
+func (l *Links) Has(t *Transaction, key LogeKey, target LogeKey) bool {
+	return t.HasLink(l.TypeName, l.LinkName, key, target)
+}
+
+func (l *Links) Add(t *Transaction, key LogeKey, target LogeKey) {
+	t.AddLink(l.TypeName, l.LinkName, key, target)
+}
+
+func (l *Links) Remove(t *Transaction, key LogeKey, target LogeKey) {
+	t.RemoveLink(l.TypeName, l.LinkName, key, target)
+}
+
+func (l *Links) Set(t *Transaction, key LogeKey, targets []LogeKey) {
+	t.SetLinks(l.TypeName, l.LinkName, key, targets)
+}
+
+// Sources linking to target
+func (l *Links) Find(t *Transaction, target LogeKey) ResultSet {
+	return t.Find(l.TypeName, l.LinkName, target)
+}
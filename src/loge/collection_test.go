@@ -0,0 +1,48 @@
+package loge
+
+import (
+	"testing"
+	"reflect"
+)
+
+func TestCollection(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	var def = NewTypeDef("test", 1, &TestObj{})
+	def.Links = LinkSpec{ "other": "test" }
+	db.CreateType(def)
+
+	var objs = Collection[TestObj](db, "test")
+	var others = objs.Link("other")
+
+	db.Transact(func (t *Transaction) {
+		objs.Set(t, "one", &TestObj{ "One" })
+		objs.Set(t, "two", &TestObj{ "Two" })
+		others.Add(t, "one", "two")
+	}, 0)
+
+	db.Transact(func (t *Transaction) {
+		objs.Write(t, "one").Name = "Uno"
+		if objs.Read(t, "three") != nil || objs.Exists(t, "three") {
+			test.Error("Missing object exists")
+		}
+		if !others.Has(t, "one", "two") {
+			test.Error("Link missing")
+		}
+		if keys := others.Read(t, "one"); !reflect.DeepEqual(keys, []LogeKey{ "two" }) {
+			test.Errorf("Wrong links: %v", keys)
+		}
+	}, 0)
+
+	db.Transact(func (t *Transaction) {
+		if objs.Read(t, "one").Name != "Uno" {
+			test.Error("Typed write lost")
+		}
+	}, 0)
+
+	defer func() {
+		if recover() == nil {
+			test.Error("Mismatched collection didn't panic")
+		}
+	}()
+	Collection[string](db, "test")
+}
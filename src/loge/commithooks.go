@@ -0,0 +1,103 @@
+package loge
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Called after each successful commit, in the committing goroutine,
+// once the transaction has let go of its objects:
+//
+//   db.OnCommit(func (sID uint64, keys []loge.ChangedKey) {
+//       for _, key := range keys {
+//           cache.Invalidate(key.Type, key.Key)
+//       }
+//   })
+//
+// Keys are what the commit wrote, in key order: objects, and link sets
+// with their Link set. Commit returns once every callback has, so keep
+// them quick; Subscribe suits slower consumers. Panics are printed and
+// otherwise ignored, as the commit has already happened.
+type CommitCallback func(sID uint64, keys []ChangedKey)
+
+type ChangedKey struct {
+	Type string
+	Key LogeKey
+	Link string
+}
+
+type commitHooks struct {
+	lock spinLock
+	next int
+	callbacks []commitHook
+}
+
+type commitHook struct {
+	id int
+	callback CommitCallback
+}
+
+// Returns a function which unregisters the callback
+func (db *LogeDB) OnCommit(callback CommitCallback) func() {
+	var hooks = &db.commitHooks
+	hooks.lock.SpinLock()
+	defer hooks.lock.Unlock()
+	var id = hooks.next
+	hooks.next++
+	hooks.callbacks = append(hooks.callbacks, commitHook{ id, callback })
+
+	return func() {
+		hooks.lock.SpinLock()
+		defer hooks.lock.Unlock()
+		for i, hook := range hooks.callbacks {
+			if hook.id == id {
+				hooks.callbacks = append(hooks.callbacks[:i:i], hooks.callbacks[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+func (hooks *commitHooks) registered() []CommitCallback {
+	hooks.lock.SpinLock()
+	defer hooks.lock.Unlock()
+	var callbacks = make([]CommitCallback, len(hooks.callbacks))
+	for i, hook := range hooks.callbacks {
+		callbacks[i] = hook.callback
+	}
+	return callbacks
+}
+
+func (hooks *commitHooks) run(sID uint64, objs []*logeObject) {
+	var callbacks = hooks.registered()
+	if len(callbacks) == 0 || len(objs) == 0 {
+		return
+	}
+
+	var keys = make([]ChangedKey, len(objs))
+	for i, obj := range objs {
+		keys[i] = ChangedKey{ obj.Type.Name, obj.Key, obj.LinkName }
+	}
+	sort.Slice(keys, func (i, j int) bool {
+		var a, b = keys[i], keys[j]
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		if a.Key != b.Key {
+			return a.Key < b.Key
+		}
+		return a.Link < b.Link
+	})
+	for _, callback := range callbacks {
+		runCommitCallback(callback, sID, keys)
+	}
+}
+
+func runCommitCallback(callback CommitCallback, sID uint64, keys []ChangedKey) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Printf("Commit callback panicked: %v\n", r)
+		}
+	}()
+	callback(sID, keys)
+}
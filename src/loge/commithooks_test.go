@@ -0,0 +1,58 @@
+package loge
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCommitCallbacks(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	var def = NewTypeDef("test", 1, &TestObj{})
+	def.Links = LinkSpec{ "other": "test" }
+	db.CreateType(def)
+
+	var calls [][]ChangedKey
+	var lastID uint64
+	var unregister = db.OnCommit(func (sID uint64, keys []ChangedKey) {
+		lastID = sID
+		calls = append(calls, keys)
+	})
+	db.OnCommit(func (sID uint64, keys []ChangedKey) {
+		panic("Callback failure")
+	})
+
+	var ok = db.Transact(func (t *Transaction) {
+		t.Set("test", "two", &TestObj{ "Two" })
+		t.Set("test", "one", &TestObj{ "One" })
+		t.AddLink("test", "other", "one", "two")
+		t.Read("test", "three")
+	}, 0)
+	if !ok {
+		test.Fatal("Transaction with panicking callback failed")
+	}
+
+	var expected = []ChangedKey{
+		{ "test", "one", "" },
+		{ "test", "one", "other" },
+		{ "test", "two", "" },
+	}
+	if len(calls) != 1 || !reflect.DeepEqual(calls[0], expected) {
+		test.Errorf("Wrong commit callbacks: %v", calls)
+	}
+	if lastID != db.lastSnapshotID {
+		test.Errorf("Wrong commit snapshot ID: %d", lastID)
+	}
+
+	var t = db.CreateTransaction()
+	t.Write("test", "one")
+	db.SetOne("test", "one", &TestObj{ "Other" })
+	if t.Commit() || len(calls) != 2 {
+		test.Errorf("Conflicting commit called back: %v", calls)
+	}
+
+	unregister()
+	db.SetOne("test", "two", &TestObj{ "Again" })
+	if len(calls) != 2 {
+		test.Error("Unregistered callback called")
+	}
+}
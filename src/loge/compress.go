@@ -0,0 +1,154 @@
+package loge
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// A store wrapper compressing objects on their way in, for types whose
+// objects are mostly text:
+//
+//   var store = loge.NewCompressedStore(loge.NewLevelDBStore(path), loge.CompressZstd, 512)
+//
+// Blobs shorter than the minimum size, or which don't come out any
+// smaller, are stored as they are, as is everything already in the store,
+// so it can go over an existing one. Reads decompress whichever
+// algorithm wrote a blob, so the algorithm can be changed later too.
+// Links aren't compressed, since stores read them when rebuilding
+// indexes.
+type CompressedStore struct {
+	LogeStore
+	Algorithm Compression
+	MinSize int
+}
+
+type compressedContext struct {
+	transactionContext
+	cstore *CompressedStore
+}
+
+type Compression byte
+
+const (
+	CompressNone Compression = iota
+	CompressSnappy
+	CompressZstd
+)
+
+// Prefixes compressed blobs, followed by the algorithm. Spack never
+// starts an object with it.
+var compressedMarker = []byte("\x00\xfeloge-z")
+
+var zstdOnce sync.Once
+var zstdEncoder *zstd.Encoder
+var zstdDecoder *zstd.Decoder
+
+func NewCompressedStore(store LogeStore, algorithm Compression, minSize int) *CompressedStore {
+	return &CompressedStore{ store, algorithm, minSize }
+}
+
+func (c Compression) String() string {
+	switch c {
+	case CompressNone:
+		return "none"
+	case CompressSnappy:
+		return "snappy"
+	case CompressZstd:
+		return "zstd"
+	}
+	return fmt.Sprintf("Compression(%d)", byte(c))
+}
+
+// Both are safe to share once made
+func zstdCodecs() (*zstd.Encoder, *zstd.Decoder) {
+	zstdOnce.Do(func() {
+		var err error
+		if zstdEncoder, err = zstd.NewWriter(nil); err != nil {
+			panic(err)
+		}
+		if zstdDecoder, err = zstd.NewReader(nil); err != nil {
+			panic(err)
+		}
+	})
+	return zstdEncoder, zstdDecoder
+}
+
+func (store *CompressedStore) describe() string {
+	return fmt.Sprintf("Compressed (%v) over %s", store.Algorithm, store.LogeStore.describe())
+}
+
+func (store *CompressedStore) compress(enc []byte) []byte {
+	if len(enc) == 0 || len(enc) < store.MinSize || store.Algorithm == CompressNone {
+		return enc
+	}
+
+	var out = append(make([]byte, 0, len(enc)), compressedMarker...)
+	out = append(out, byte(store.Algorithm))
+	switch store.Algorithm {
+	case CompressSnappy:
+		out = append(out, snappy.Encode(nil, enc)...)
+	case CompressZstd:
+		var encoder, _ = zstdCodecs()
+		out = encoder.EncodeAll(enc, out)
+	default:
+		panic(fmt.Sprintf("Unknown compression %v", store.Algorithm))
+	}
+
+	if len(out) >= len(enc) {
+		return enc
+	}
+	return out
+}
+
+func decompress(blob []byte) []byte {
+	if !bytes.HasPrefix(blob, compressedMarker) || len(blob) == len(compressedMarker) {
+		return blob
+	}
+
+	var algorithm = Compression(blob[len(compressedMarker)])
+	var payload = blob[len(compressedMarker) + 1:]
+	var enc []byte
+	var err error
+	switch algorithm {
+	case CompressSnappy:
+		enc, err = snappy.Decode(nil, payload)
+	case CompressZstd:
+		var _, decoder = zstdCodecs()
+		enc, err = decoder.DecodeAll(payload, nil)
+	default:
+		err = fmt.Errorf("unknown algorithm %d", byte(algorithm))
+	}
+	if err != nil {
+		panic(storeError("Decompress error (%v): %v", algorithm, err))
+	}
+	return enc
+}
+
+
+// -----------------------------------------------
+// Transaction Contexts
+// -----------------------------------------------
+
+func (store *CompressedStore) newContext(ctx context.Context, sID uint64) transactionContext {
+	return &compressedContext{ store.LogeStore.newContext(ctx, sID), store }
+}
+
+func (context *compressedContext) get(ref objRef) []byte {
+	var blob = context.transactionContext.get(ref)
+	if ref.IsLink() {
+		return blob
+	}
+	return decompress(blob)
+}
+
+func (context *compressedContext) store(ref objRef, enc []byte) error {
+	if ref.IsLink() {
+		return context.transactionContext.store(ref, enc)
+	}
+	return context.transactionContext.store(ref, context.cstore.compress(enc))
+}
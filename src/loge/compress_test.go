@@ -0,0 +1,71 @@
+package loge
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func rawBlob(db *LogeDB, store LogeStore, typeName string, key LogeKey) []byte {
+	var sID, current = db.currentContext(context.Background())
+	current.rollback()
+	var context = store.newContext(context.Background(), sID)
+	defer context.rollback()
+	return context.get(db.makeObjRef(typeName, key))
+}
+
+func TestCompressedStore(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "loge-compress")
+	defer os.RemoveAll(dir)
+
+	var disk = NewBoltStore(filepath.Join(dir, "loge.db"))
+	var store = NewCompressedStore(disk, CompressSnappy, 64)
+	var db = NewLogeDB(store)
+	defer db.Close()
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+
+	var text = strings.Repeat("All work and no play. ", 100)
+	db.SetOne("test", "small", &TestObj{ "Small" })
+	db.SetOne("test", "snappy", &TestObj{ text })
+	store.Algorithm = CompressZstd
+	db.SetOne("test", "zstd", &TestObj{ text })
+
+	if raw := rawBlob(db, disk, "test", "small"); !bytes.Equal(raw, storedBlob(db, "test", "small")) {
+		test.Errorf("Small object compressed: %x", raw)
+	}
+	for _, key := range []LogeKey{ "snappy", "zstd" } {
+		var raw = rawBlob(db, disk, "test", key)
+		if !bytes.HasPrefix(raw, compressedMarker) || len(raw) * 5 > len(text) {
+			test.Errorf("Object %s not compressed: %d bytes", key, len(raw))
+		}
+		if obj := db.ReadOne("test", key).(*TestObj); obj == nil || obj.Name != text {
+			test.Errorf("Wrong object %s through compression", key)
+		}
+	}
+	if raw := rawBlob(db, disk, "test", "zstd"); Compression(raw[len(compressedMarker)]) != CompressZstd {
+		test.Errorf("Wrong algorithm: %v", Compression(raw[len(compressedMarker)]))
+	}
+}
+
+func TestCompressedStoreOverExisting(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "loge-compress")
+	defer os.RemoveAll(dir)
+	var path = filepath.Join(dir, "loge.log")
+
+	var text = strings.Repeat("All work and no play. ", 100)
+	var db = NewLogeDB(NewLogStore(path, nil))
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+	db.SetOne("test", "old", &TestObj{ text })
+	db.Close()
+
+	db = NewLogeDB(NewCompressedStore(NewLogStore(path, nil), CompressZstd, 0))
+	defer db.Close()
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+	if obj := db.ReadOne("test", "old").(*TestObj); obj == nil || obj.Name != text {
+		test.Errorf("Wrong uncompressed object: %v", obj)
+	}
+}
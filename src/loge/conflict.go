@@ -0,0 +1,54 @@
+package loge
+
+import (
+	"fmt"
+)
+
+// Which object aborted a commit, and how far it had moved on: the
+// transaction read it at SnapshotID and another commit wrote it at
+// CurrentID. Link is set when the conflict was on a link set, and
+// Label is the transaction's. Err returns it as the error, which is
+// also ErrConflict.
+type ConflictInfo struct {
+	Type string
+	Key LogeKey
+	Link string
+	SnapshotID uint64
+	CurrentID uint64
+	Label string
+}
+
+func (info *ConflictInfo) Error() string {
+	var name = info.Type
+	if info.Link != "" {
+		name = fmt.Sprintf("%s^%s", name, info.Link)
+	}
+	var msg = fmt.Sprintf("%v on %s/%s: read at %d, written at %d",
+		ErrConflict, name, info.Key, info.SnapshotID, info.CurrentID)
+	if info.Label != "" {
+		msg = fmt.Sprintf("%s (%s)", msg, info.Label)
+	}
+	return msg
+}
+
+func (info *ConflictInfo) Unwrap() error {
+	return ErrConflict
+}
+
+// Nil unless the commit was aborted by a conflict. Where Transact and
+// the rest retry, the error TryTransact returns is the last attempt's.
+func (t *Transaction) Conflict() *ConflictInfo {
+	return t.conflict
+}
+
+func newConflictInfo(t *Transaction, lv *liveVersion) *ConflictInfo {
+	var obj = lv.version.LogeObj
+	return &ConflictInfo{
+		Type: obj.Type.Name,
+		Key: obj.Key,
+		Link: obj.LinkName,
+		SnapshotID: lv.version.snapshotID,
+		CurrentID: obj.Current.snapshotID,
+		Label: t.label,
+	}
+}
@@ -0,0 +1,38 @@
+package loge
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestConflictInfo(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+	db.SetOne("test", "one", &TestObj{ "One" })
+
+	var t = db.CreateTransaction()
+	t.Write("test", "one")
+	t.Set("test", "two", &TestObj{ "Two" })
+	if t.Conflict() != nil {
+		test.Error("Conflict on active transaction")
+	}
+	db.SetOne("test", "one", &TestObj{ "Other" })
+	if t.Commit() {
+		test.Fatal("Conflicting transaction committed")
+	}
+
+	var expected = ConflictInfo{ "test", "one", "", t.snapshotID, db.lastSnapshotID, "" }
+	if t.Conflict() == nil || *t.Conflict() != expected {
+		test.Errorf("Wrong conflict: %v", t.Conflict())
+	}
+	var info *ConflictInfo
+	if err := t.Err(); !errors.Is(err, ErrConflict) || !errors.As(err, &info) || info.Key != "one" {
+		test.Errorf("Wrong conflict error: %v", err)
+	}
+
+	t = db.CreateTransaction()
+	t.Write("test", "one")
+	if !t.Commit() || t.Conflict() != nil {
+		test.Error("Conflict without conflicting commit")
+	}
+}
@@ -0,0 +1,88 @@
+package loge
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Commits lock their objects in key order, so they can't deadlock, but
+// transactions can keep conflicting with each other's retries. Once a
+// call to Transact or the rest has had RetryPolicy.ReportAfter
+// conflicting attempts, the reporter gets what each of them hit; with
+// no reporter set, that's printed. Keys turning up again and again are
+// the hotspots to restructure around.
+//
+// RetryPolicy.SerializeAfter breaks such livelocks: past that many
+// conflicts, further attempts run one at a time with those of other
+// calls which have got that far. Transact calls nested in an actor
+// which then get that far themselves would wait forever, so leave it
+// off if actors start transactions of their own.
+type ContentionReport struct {
+	Label string // The last attempt's
+	Attempts int
+	Conflicts []*ConflictInfo // One per attempt, oldest first
+	Hotspot *ConflictInfo // The last conflict on the most conflicted key
+}
+
+func (report *ContentionReport) String() string {
+	if report.Label != "" {
+		return fmt.Sprintf("Contention in %s after %d attempts, mostly %v",
+			report.Label, report.Attempts, report.Hotspot)
+	}
+	return fmt.Sprintf("Contention after %d attempts, mostly %v", report.Attempts, report.Hotspot)
+}
+
+type ContentionReporter func(*ContentionReport)
+
+type contention struct {
+	reporter ContentionReporter
+	serial sync.Mutex
+}
+
+// Set before use
+func (db *LogeDB) SetContentionReporter(reporter ContentionReporter) {
+	db.contention.reporter = reporter
+}
+
+func (db *LogeDB) runAttempt(ctx context.Context, t *Transaction, actor Transactor, serialized bool) bool {
+	if serialized {
+		db.contention.serial.Lock()
+		defer db.contention.serial.Unlock()
+	}
+	actor(t)
+	return t.CommitContext(ctx)
+}
+
+func (c *contention) check(policy RetryPolicy, label string, conflicts []*ConflictInfo) {
+	if policy.ReportAfter <= 0 || len(conflicts) != policy.ReportAfter {
+		return
+	}
+
+	var report = newContentionReport(conflicts)
+	report.Label = label
+	if c.reporter == nil {
+		fmt.Printf("%v\n", report)
+		return
+	}
+	c.reporter(report)
+}
+
+func newContentionReport(conflicts []*ConflictInfo) *ContentionReport {
+	var counts = make(map[ConflictInfo]int)
+	var hotspot *ConflictInfo
+	var most = 0
+	for _, info := range conflicts {
+		var key = ConflictInfo{ Type: info.Type, Key: info.Key, Link: info.Link }
+		counts[key]++
+		if counts[key] >= most {
+			most = counts[key]
+			hotspot = info
+		}
+	}
+	return &ContentionReport{
+		Attempts: len(conflicts),
+		Conflicts: conflicts,
+		Hotspot: hotspot,
+	}
+}
@@ -106,3 +106,55 @@ func Increment(trans *Transaction, key LogeKey) {
 	var counter = trans.Write("counters", key).(*TestCounter)
 	counter.Value += 1
 }
+
+func TestContentionReport(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+
+	var reports []*ContentionReport
+	db.SetContentionReporter(func (report *ContentionReport) {
+		reports = append(reports, report)
+	})
+
+	var policy = RetryPolicy{ MaxAttempts: 5, ReportAfter: 3 }
+	var attempts = 0
+	TransactResult(db, func (t *Transaction) (bool, error) {
+		attempts++
+		t.Write("test", "one")
+		if attempts == 2 {
+			t.Write("test", "two")
+			db.SetOne("test", "two", &TestObj{ "Other" })
+		} else {
+			db.SetOne("test", "one", &TestObj{ "Other" })
+		}
+		return true, nil
+	}, TransactOptions{ Retry: &policy })
+
+	if attempts != 5 || len(reports) != 1 {
+		test.Fatalf("Wrong reports: %d after %d attempts", len(reports), attempts)
+	}
+	var report = reports[0]
+	if report.Attempts != 3 || report.Conflicts[1].Key != "two" || report.Hotspot != report.Conflicts[2] {
+		test.Errorf("Wrong report: %v", report)
+	}
+}
+
+func TestSerializeAfter(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+	db.SetRetryPolicy(RetryPolicy{ MaxAttempts: 5, SerializeAfter: 2 })
+
+	var attempts = 0
+	db.Transact(func (t *Transaction) {
+		attempts++
+		t.Write("test", "one")
+		if !db.contention.serial.TryLock() {
+			return
+		}
+		db.contention.serial.Unlock()
+		db.SetOne("test", "one", &TestObj{ "Other" })
+	}, 0)
+	if attempts != 3 {
+		test.Errorf("Not serialized after 2 conflicts: %d attempts", attempts)
+	}
+}
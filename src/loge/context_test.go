@@ -0,0 +1,56 @@
+package loge
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestContextCancellation(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "loge-context")
+	defer os.RemoveAll(dir)
+
+	var db = NewLogeDB(NewLevelDBStore(dir))
+	defer db.Close()
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+	db.SetOne("test", "one", &TestObj{ "One" })
+	db.SetOne("test", "two", &TestObj{ "Two" })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var t = db.CreateTransactionContext(ctx)
+	var keys = t.ListSlice("test", "", -1)
+	t.Read("test", "one")
+	cancel()
+
+	if _, err := t.TryRead("test", "two"); !errors.Is(err, context.Canceled) {
+		test.Errorf("Read after cancel gave %v", err)
+	}
+	func() {
+		defer func() {
+			if err, _ := recover().(error); !errors.Is(err, context.Canceled) {
+				test.Errorf("Listing after cancel gave %v", err)
+			}
+		}()
+		keys.All()
+	}()
+
+	t.Write("test", "one").(*TestObj).Name = "Uno"
+	if ok, err := t.TryCommitContext(ctx); ok || !errors.Is(err, context.Canceled) {
+		test.Errorf("Commit after cancel gave %v, %v", ok, err)
+	}
+	if db.ReadOne("test", "one").(*TestObj).Name != "One" {
+		test.Error("Cancelled commit was applied")
+	}
+
+	ok, err := db.TryTransactContext(ctx, func (t *Transaction) {
+		t.Read("test", "two")
+	}, 0)
+	if ok || !errors.Is(err, context.Canceled) {
+		test.Errorf("TryTransactContext gave %v, %v", ok, err)
+	}
+	if db.Stats().CachedObjects != 0 {
+		test.Error("Cancelled transactions left objects cached")
+	}
+}
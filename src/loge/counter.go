@@ -0,0 +1,86 @@
+package loge
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// A counter spread over several objects, so concurrent increments
+// rarely touch the same one and don't abort each other:
+//
+//   var hits = loge.Counter(db, "hits", 16)
+//   hits.AddOne(1)
+//
+//   db.Transact(func (t *loge.Transaction) {
+//       hits.Add(t, 1)
+//       var total = hits.Value(t)
+//   }, 0)
+//
+// Each Add goes to a random shard and Value sums them all, so reads cost
+// a load per shard. Keep the shard count for a name fixed: shards past
+// a smaller count are no longer read. Counters live in their own type,
+// created by the first Counter call on a DB: make them at startup, as
+// with CreateType.
+type ShardedCounter struct {
+	db *LogeDB
+	name string
+	shards int
+}
+
+type counterShard struct {
+	Value int64
+}
+
+const counterTypeName = "_counter"
+
+func Counter(db *LogeDB, name string, shards int) *ShardedCounter {
+	if shards < 1 {
+		panic(fmt.Sprintf("Counter %s needs at least one shard", name))
+	}
+	if db.Type(counterTypeName) == nil {
+		db.CreateType(NewTypeDef(counterTypeName, 1, &counterShard{}))
+	}
+	return &ShardedCounter{ db, name, shards }
+}
+
+func (c *ShardedCounter) Add(t *Transaction, delta int64) {
+	var key = c.shardKey(rand.Intn(c.shards))
+	var shard = t.Write(counterTypeName, key).(*counterShard)
+	if shard == nil {
+		t.Set(counterTypeName, key, &counterShard{ delta })
+	} else {
+		shard.Value += delta
+	}
+}
+
+func (c *ShardedCounter) Value(t *Transaction) int64 {
+	var keys = make([]LogeKey, c.shards)
+	for i := range keys {
+		keys[i] = c.shardKey(i)
+	}
+
+	var total int64
+	for _, obj := range t.ReadMany(counterTypeName, keys) {
+		if shard := obj.(*counterShard); shard != nil {
+			total += shard.Value
+		}
+	}
+	return total
+}
+
+func (c *ShardedCounter) AddOne(delta int64) {
+	c.db.Transact(func (t *Transaction) {
+		c.Add(t, delta)
+	}, 0)
+}
+
+func (c *ShardedCounter) ValueOne() (value int64) {
+	c.db.Transact(func (t *Transaction) {
+		value = c.Value(t)
+	}, 0)
+	return
+}
+
+func (c *ShardedCounter) shardKey(i int) LogeKey {
+	return Key(c.name, fmt.Sprintf("%04d", i))
+}
@@ -0,0 +1,64 @@
+package loge
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func TestShardedCounter(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	defer db.Close()
+	var counter = Counter(db, "hits", 4)
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				counter.AddOne(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if value := counter.ValueOne(); value != 1600 {
+		test.Errorf("Wrong total: %d", value)
+	}
+
+	db.Transact(func (t *Transaction) {
+		counter.Add(t, -600)
+		if value := counter.Value(t); value != 1000 {
+			test.Errorf("Transaction didn't see its own add: %d", value)
+		}
+	}, 0)
+
+	if Counter(db, "other", 2).ValueOne() != 0 {
+		test.Error("Counters share shards")
+	}
+}
+
+func BenchmarkShardedContention(b *testing.B) {
+	var procs = runtime.NumCPU()
+	var db = NewLogeDB(NewMemStore())
+	var counter = Counter(db, "contended", procs * 4)
+
+	b.ResetTimer()
+	var group sync.WaitGroup
+	for i := 0; i < procs; i++ {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			for n := 0; n < b.N; n++ {
+				counter.AddOne(1)
+			}
+		}()
+	}
+	group.Wait()
+	b.StopTimer()
+
+	if counter.ValueOne() != int64(procs * b.N) {
+		b.Errorf("Wrong count: %d / %d", counter.ValueOne(), procs * b.N)
+	}
+}
@@ -1,10 +1,13 @@
 package loge
 
 import (
+	"context"
 	"fmt"
 	"time"
+	"sync"
 	"sync/atomic"
 	"reflect"
+	"sort"
 
 	"github.com/brendonh/spack"
 )
@@ -15,8 +18,27 @@ type LogeDB struct {
 	store LogeStore
 	cache objCache
 	lastSnapshotID uint64
+	snapshotLock sync.RWMutex
 	lock spinLock
+	evictions evictionMemory
 	linkTypeSpec *spack.TypeSpec
+	admission *admission
+	feed changeFeed
+	triggers triggerSet
+	counters dbCounters
+	readSafety ReadSafety
+	readOnly bool
+	codec Codec
+	clock Clock
+	retry RetryPolicy
+	commitHooks commitHooks
+	contention contention
+	pins snapshotPins
+	async asyncWriter
+	commits commitSequence
+	limits TransactionLimits
+	opTimeout time.Duration
+	quiescence quiescence
 }
 
 func NewLogeDB(store LogeStore) *LogeDB {
@@ -26,6 +48,7 @@ func NewLogeDB(store LogeStore) *LogeDB {
 		cache: make(objCache),
 		lastSnapshotID: 1,
 		linkTypeSpec: spack.MakeTypeSpec([]string{}),
+		clock: RealClock,
 	}
 }
 
@@ -38,9 +61,21 @@ type Transactor func(*Transaction)
 
 
 func (db *LogeDB) Close() {
+	db.async.drain()
+	db.triggers.stop()
 	db.store.close()
 }
 
+func (db *LogeDB) Compact() {
+	db.store.compact()
+}
+
+// Limits how many transactions may commit concurrently; the rest queue
+// for a slot. Zero or less means no limit. Set before use.
+func (db *LogeDB) SetCommitLimit(limit int) {
+	db.admission = newAdmission(limit)
+}
+
 func (db *LogeDB) CreateType(def *TypeDef) *logeType {
 	var vt = db.store.getSpackType(def.Name)
 
@@ -53,14 +88,63 @@ func (db *LogeDB) CreateType(def *TypeDef) *logeType {
 
 	vt.AddVersion(def.Version, spackExemplar, def.Upgrader)
 	var typ = newType(def.Name, def.Version, def.Exemplar, def.Links, vt)
+	typ.Merger = def.Merger
+	typ.Renames = def.Renames
+	typ.Upgraders = def.Upgraders
+	typ.Validate = def.Validate
+	typ.Evolve = def.Upgrader == nil
+	typ.Codec = def.Codec
+	if typ.Codec == nil && hasHooks(def.Exemplar) {
+		typ.Codec = hookCodec
+	} else if typ.Codec == nil && isProtoMessage(def.Exemplar) {
+		typ.Codec = ProtobufCodec
+	} else if typ.Codec == nil {
+		typ.Codec = db.codec
+	}
 	db.types[typ.Name] = typ
 	db.store.registerType(typ)
 	return typ
 }
 
+func (db *LogeDB) Type(typeName string) *logeType {
+	return db.types[typeName]
+}
+
+func (db *LogeDB) Types() []*logeType {
+	var names = make([]string, 0, len(db.types))
+	for name := range db.types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var types = make([]*logeType, 0, len(names))
+	for _, name := range names {
+		types = append(types, db.types[name])
+	}
+	return types
+}
+
 func (db *LogeDB) CreateTransaction() *Transaction {
-	var tID = db.lastSnapshotID
-	return NewTransaction(db, tID)
+	return db.CreateTransactionContext(context.Background())
+}
+
+// Store reads in the transaction fail with ctx's error once it's done
+func (db *LogeDB) CreateTransactionContext(ctx context.Context) *Transaction {
+	var opCtx = newOpContext(ctx, db.opTimeout)
+	var sID, context = db.currentContext(opCtx)
+	var t = newTransaction(db, ctx, context, sID)
+	t.opCtx = opCtx
+	return t
+}
+
+// The store context has to see exactly the commits up to its snapshot
+// ID, so it opens below any commit the store doesn't have yet. See
+// commitSequence.
+func (db *LogeDB) currentContext(ctx context.Context) (uint64, transactionContext) {
+	db.snapshotLock.RLock()
+	defer db.snapshotLock.RUnlock()
+	var sID = db.visibleSnapshotID()
+	return sID, db.store.newContext(ctx, sID)
 }
 
 func (db *LogeDB) newSnapshotID() uint64 {
@@ -68,32 +152,42 @@ func (db *LogeDB) newSnapshotID() uint64 {
 }
 
 func (db *LogeDB) Transact(actor Transactor, timeout time.Duration) bool {
-	var t = db.CreateTransaction()
-	return db.doTransact(t, actor, timeout)
+	return db.doTransact(context.Background(), actor, timeout, false, db.retry)
+}
+
+func (db *LogeDB) TransactContext(ctx context.Context, actor Transactor, timeout time.Duration) bool {
+	return db.doTransact(ctx, actor, timeout, false, db.retry)
 }
 
 func (db *LogeDB) TransactJSON(actor Transactor, timeout time.Duration) bool {
-	var t = db.CreateTransaction()
-	t.giveJSON = true
-	return db.doTransact(t, actor, timeout)
+	return db.doTransact(context.Background(), actor, timeout, true, db.retry)
 }
 
-func (db *LogeDB) doTransact(t *Transaction, actor Transactor, timeout time.Duration) bool {
-	var start = time.Now()
-	for {
-		actor(t)
-		if t.cancelled {
-			return false
-		}
-		if t.Commit() {
+// Conflicting commits are retried as policy says, until timeout
+func (db *LogeDB) doTransact(ctx context.Context, actor Transactor, timeout time.Duration, giveJSON bool, policy RetryPolicy) bool {
+	var start = db.clock.Now()
+	var conflicts []*ConflictInfo
+	for attempt := 1; ; attempt++ {
+		var t = db.CreateTransactionContext(ctx)
+		t.giveJSON = giveJSON
+		if db.runAttempt(ctx, t, actor, policy.serialized(attempt)) {
 			return true
 		}
-		if t.state != ABORTED {
+		if t.state != ABORTED || t.cancelled {
+			break
+		}
+		conflicts = append(conflicts, t.conflict)
+		db.contention.check(policy, t.label, conflicts)
+		if policy.exhausted(attempt) {
 			break
 		}
-		if timeout > 0 && time.Since(start) > timeout {
+		var delay = policy.delay(attempt)
+		if timeout > 0 && db.clock.Now().Add(delay).Sub(start) > timeout {
 			break
 		}
+		if delay > 0 {
+			db.clock.Sleep(delay)
+		}
 	}
 	return false
 }
@@ -116,7 +210,7 @@ func (db *LogeDB) ReadOne(typeName string, key LogeKey) (obj interface{}) {
 	return
 }
 
-func (db *LogeDB) ReadLinksOne(typeName string, linkName string, key LogeKey) (links []string) {
+func (db *LogeDB) ReadLinksOne(typeName string, linkName string, key LogeKey) (links []LogeKey) {
 	db.Transact(func (t *Transaction) {
 		links = t.ReadLinks(typeName, linkName, key)
 	}, 0)
@@ -156,63 +250,109 @@ func (db *LogeDB) ListSlice(typeName string, from LogeKey, limit int) (results [
 	return
 }
 
+func (db *LogeDB) FindPrefix(typeName string, linkName string, target LogeKey, prefix LogeKey, from LogeKey, limit int) (results []LogeKey) {
+	db.Transact(func (t *Transaction) {
+		results = t.FindPrefix(typeName, linkName, target, prefix, from, limit).All()
+	}, 0)
+	return
+}
+
+func (db *LogeDB) ListPrefix(typeName string, prefix LogeKey, from LogeKey, limit int) (results []LogeKey) {
+	db.Transact(func (t *Transaction) {
+		results = t.ListPrefix(typeName, prefix, from, limit).All()
+	}, 0)
+	return
+}
+
 // -----------------------------------------------
 // Internals
 // -----------------------------------------------
 
-func (db *LogeDB) makeObjRef(typeName string, key LogeKey) objRef {
+func (db *LogeDB) lookupType(typeName string) *logeType {
 	typ, ok := db.types[typeName]
 	if !ok {
-		panic(fmt.Sprintf("Type not registered: %s", typeName))
+		panic(fmt.Errorf("%w: %s", ErrNoSuchType, typeName))
 	}
-	return makeObjRef(typ, key)
+	return typ
+}
+
+func (db *LogeDB) makeObjRef(typeName string, key LogeKey) objRef {
+	return makeObjRef(db.lookupType(typeName), key)
 }
 
 func (db *LogeDB) makeLinkRef(typeName string, linkName string, key LogeKey) objRef {
-	typ, ok := db.types[typeName]
-	if !ok {
-		panic(fmt.Sprintf("Type not registered: %s", typeName))
+	var typ = db.lookupType(typeName)
+	if _, ok := typ.Links[linkName]; !ok {
+		panic(fmt.Errorf("%w: %s.%s", ErrNoSuchLink, typeName, linkName))
 	}
 	return makeLinkRef(typ, linkName, key)
 }
 
 
-func (db *LogeDB) acquireVersion(ref objRef, context transactionContext, load bool) *objectVersion {
-	var typeName = ref.Type.Name
-	var key = ref.Key
-
-	var objKey = ref.String()
-	var typ = db.types[typeName]
+func (db *LogeDB) acquireVersion(ref objRef, context transactionContext, load bool) (version *objectVersion) {
+	// A failed load (store error, cancelled context) gives the object back
+	var acquired = false
+	defer func() {
+		if !acquired && version != nil {
+			db.releaseVersions([]*liveVersion{ { version: version } })
+		}
+	}()
 
 	db.lock.SpinLock()
-	var obj, ok = db.cache[objKey]
-
-	if !ok {
-		obj = initializeObject(db, typ, key)
-		if ref.IsLink() { 
-			obj.LinkName = ref.LinkName
-		}
-	}
+	var obj = db.cachedObject(ref)
 
 	obj.Lock.SpinLock()
 	defer obj.Lock.Unlock()
-
-	db.cache[objKey] = obj	
 	db.lock.Unlock()
 
-	obj.RefCount++
-
-	var version = obj.ensureVersion(context.getSnapshotID())
+	version = obj.ensureVersion(context.getSnapshotID())
 
 	if load && !version.loaded {
 		version.Blob = context.get(ref)
 		version.loaded = true
 	}
 
+	acquired = true
 	return version
 }
 
 
+// Unloaded versions of many objects, taking the DB lock once
+func (db *LogeDB) acquireVersions(refs []objRef, context transactionContext) []*objectVersion {
+	var sID = context.getSnapshotID()
+	var versions = make([]*objectVersion, len(refs))
+
+	db.lock.SpinLock()
+	defer db.lock.Unlock()
+
+	for i, ref := range refs {
+		var obj = db.cachedObject(ref)
+		obj.Lock.SpinLock()
+		versions[i] = obj.ensureVersion(sID)
+		obj.Lock.Unlock()
+	}
+	return versions
+}
+
+// Counted under the DB lock, so a concurrent release can't evict the
+// object before the caller has its version
+func (db *LogeDB) cachedObject(ref objRef) *logeObject {
+	var objKey = ref.String()
+	var obj, ok = db.cache[objKey]
+
+	if !ok {
+		obj = initializeObject(db, db.types[ref.Type.Name], ref.Key)
+		if ref.IsLink() { 
+			obj.LinkName = ref.LinkName
+		}
+		obj.restoreCommit(db.evictions.recall(objKey))
+		db.cache[objKey] = obj
+	}
+
+	obj.RefCount++
+	return obj
+}
+
 func (db *LogeDB) releaseVersions(versions []*liveVersion) {
 	db.lock.SpinLock()
 	defer db.lock.Unlock()
@@ -221,7 +361,9 @@ func (db *LogeDB) releaseVersions(versions []*liveVersion) {
 		var obj = lv.version.LogeObj
 		obj.RefCount--
 		if obj.RefCount == 0 {
-			delete(db.cache, obj.makeObjRef().CacheKey)
+			var objKey = obj.makeObjRef().CacheKey
+			delete(db.cache, objKey)
+			db.evictions.remember(objKey, obj.committedID)
 		}
 	}
 }
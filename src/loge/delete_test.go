@@ -1,6 +1,12 @@
 package loge
 
-import "testing"
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
 
 
 func TestSimpleDelete(test *testing.T) {
@@ -66,4 +72,74 @@ func TestDeleteScoping(test *testing.T) {
 		test.Error("Commit succeeded with read of deleted object")
 	}
 
-}
\ No newline at end of file
+}
+
+func TestDeleteAllAndTruncate(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "loge-delete")
+	defer os.RemoveAll(dir)
+
+	var db = NewLogeDB(NewLevelDBStore(dir))
+	defer db.Close()
+
+	var def = NewTypeDef("test", 1, &TestObj{})
+	def.Links = LinkSpec{ "other": "test" }
+	db.CreateType(def)
+	db.CreateType(NewTypeDef("kept", 1, &TestObj{}))
+
+	db.Transact(func (t *Transaction) {
+		for _, key := range []LogeKey{ "a1", "a2", "a3", "b1" } {
+			t.Set("test", key, &TestObj{ string(key) })
+			t.AddLink("test", "other", key, "target")
+		}
+		t.Set("kept", "a1", &TestObj{ "kept" })
+	}, 0)
+
+	var deleted int
+	db.Transact(func (t *Transaction) {
+		deleted = t.DeleteAll("test", "a")
+	}, 0)
+	if deleted != 3 {
+		test.Errorf("DeleteAll deleted %d", deleted)
+	}
+	if keys := db.ListSlice("test", "", -1); !reflect.DeepEqual(keys, []LogeKey{ "b1" }) {
+		test.Errorf("Wrong keys after DeleteAll: %v", keys)
+	}
+	if keys := db.Find("test", "other", "target"); !reflect.DeepEqual(keys, []LogeKey{ "b1" }) {
+		test.Errorf("Wrong links after DeleteAll: %v", keys)
+	}
+	if _, err := db.CreateTransaction().TryDeleteAll("nope", "a"); !errors.Is(err, ErrNoSuchType) {
+		test.Errorf("Wrong error for TryDeleteAll: %v", err)
+	}
+
+	if count := db.Truncate("test"); count != 1 {
+		test.Errorf("Truncate removed %d", count)
+	}
+	if keys := db.ListSlice("test", "", -1); len(keys) != 0 {
+		test.Errorf("Keys left after Truncate: %v", keys)
+	}
+	if keys := db.Find("test", "other", "target"); len(keys) != 0 {
+		test.Errorf("Index left after Truncate: %v", keys)
+	}
+	if db.ReadOne("kept", "a1").(*TestObj).Name != "kept" {
+		test.Error("Truncate touched another type")
+	}
+}
+
+func TestTruncateMemStore(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	var def = NewTypeDef("test", 1, &TestObj{})
+	def.Links = LinkSpec{ "other": "test" }
+	db.CreateType(def)
+
+	db.SetOne("test", "one", &TestObj{ "One" })
+	db.Transact(func (t *Transaction) {
+		t.AddLink("test", "other", "one", "two")
+	}, 0)
+
+	if count := db.Truncate("test"); count != 1 {
+		test.Errorf("Truncate removed %d", count)
+	}
+	if db.ExistsOne("test", "one") || len(db.ReadLinksOne("test", "other", "one")) != 0 {
+		test.Error("Object or links left after Truncate")
+	}
+}
@@ -0,0 +1,88 @@
+package loge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Failures callers can reasonably expect at runtime, along with context
+// cancellation and deadlines. The panicking API raises these as panic
+// values; the Try* twins return them instead.
+// Anything else that panics inside loge is a bug in loge or its caller.
+var (
+	ErrNoSuchType = errors.New("Type not registered")
+	ErrNoSuchLink = errors.New("Link not registered")
+	ErrInactive = errors.New("Transaction not active")
+	ErrNotSupported = errors.New("Not supported by this store")
+	ErrNoSuchObject = errors.New("No such object")
+	ErrNotCommitted = errors.New("Transaction not committed")
+	ErrReadOnly = errors.New("Transaction is read-only")
+	ErrNoSuchSnapshot = errors.New("No such snapshot")
+	ErrIncompatibleFormat = errors.New("Incompatible store format")
+
+	// Why a transaction wasn't committed, along with a *StoreError or
+	// the context's error; both are also ErrNotCommitted
+	ErrConflict = fmt.Errorf("%w: conflicting commit", ErrNotCommitted)
+	ErrAborted = fmt.Errorf("%w: cancelled", ErrNotCommitted)
+)
+
+// The store failed underneath us: I/O, or data that won't decode
+type StoreError struct {
+	Err error
+}
+
+func (err *StoreError) Error() string {
+	return fmt.Sprintf("Store error: %v", err.Err)
+}
+
+func (err *StoreError) Unwrap() error {
+	return err.Err
+}
+
+func storeError(format string, args ...interface{}) *StoreError {
+	return &StoreError{ fmt.Errorf(format, args...) }
+}
+
+func isLogeError(err error) bool {
+	var serr *StoreError
+	var verr *ValidationError
+	return errors.Is(err, ErrNoSuchType) ||
+		errors.Is(err, ErrNoSuchLink) ||
+		errors.Is(err, ErrInactive) ||
+		errors.Is(err, ErrNotSupported) ||
+		errors.Is(err, ErrNoSuchObject) ||
+		errors.Is(err, ErrNotCommitted) ||
+		errors.Is(err, ErrReadMutated) ||
+		errors.Is(err, ErrTooLarge) ||
+		errors.Is(err, ErrReadOnly) ||
+		errors.Is(err, ErrNoSuchSnapshot) ||
+		errors.Is(err, ErrIncompatibleFormat) ||
+		errors.Is(err, ErrInvalidKey) ||
+		errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.As(err, &serr) ||
+		errors.As(err, &verr)
+}
+
+// Store reads give up once the transaction's context is done, raising
+// its error
+func checkContext(ctx context.Context) {
+	if err := ctx.Err(); err != nil {
+		panic(err)
+	}
+}
+
+// Deferred by the Try* twins. Other panics carry on up.
+func recoverError(err *error) {
+	if r := recover(); r != nil {
+		*err = logeError(r)
+	}
+}
+
+func logeError(r interface{}) error {
+	if rerr, ok := r.(error); ok && isLogeError(rerr) {
+		return rerr
+	}
+	panic(r)
+}
@@ -0,0 +1,44 @@
+package loge
+
+// Last commits of objects dropped from the cache, so transactions which
+// predate them still see the conflict. Past evictionLimit entries the
+// memory is folded into a floor: objects it has forgotten count as
+// committed at the newest snapshot it forgot, which can only cause
+// spurious conflicts, never missed ones. Guarded by the DB lock.
+type evictionMemory struct {
+	commits map[string]uint64
+	floor uint64
+}
+
+var evictionLimit = 10000
+
+func (mem *evictionMemory) remember(cacheKey string, sID uint64) {
+	if sID <= mem.floor {
+		return
+	}
+	if mem.commits == nil {
+		mem.commits = make(map[string]uint64)
+	}
+	if len(mem.commits) >= evictionLimit {
+		for _, forgotten := range mem.commits {
+			if forgotten > mem.floor {
+				mem.floor = forgotten
+			}
+		}
+		mem.commits = make(map[string]uint64)
+	}
+	mem.commits[cacheKey] = sID
+}
+
+// Back in the cache, the object's versions carry it
+func (mem *evictionMemory) recall(cacheKey string) uint64 {
+	var sID, ok = mem.commits[cacheKey]
+	if !ok {
+		return mem.floor
+	}
+	delete(mem.commits, cacheKey)
+	if sID < mem.floor {
+		return mem.floor
+	}
+	return sID
+}
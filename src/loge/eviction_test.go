@@ -0,0 +1,29 @@
+package loge
+
+import (
+	"testing"
+)
+
+func TestEvictionMemory(test *testing.T) {
+	var mem evictionMemory
+	var limit = evictionLimit
+	evictionLimit = 2
+	defer func() { evictionLimit = limit }()
+
+	mem.remember("a", 5)
+	mem.remember("b", 7)
+	if mem.recall("a") != 5 || mem.recall("a") != 0 {
+		test.Error("Recall didn't forget")
+	}
+
+	mem.remember("a", 5)
+	mem.remember("c", 3)
+	if mem.recall("c") != 7 || mem.recall("a") != 7 || mem.recall("d") != 7 {
+		test.Errorf("Wrong floor: %v", mem)
+	}
+
+	mem.remember("e", 6)
+	if len(mem.commits) != 0 {
+		test.Error("Remembered a commit below the floor")
+	}
+}
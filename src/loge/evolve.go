@@ -0,0 +1,109 @@
+package loge
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+)
+
+func storedVersion(enc []byte) uint16 {
+	return binary.BigEndian.Uint16(enc)
+}
+
+func (t *logeType) evolves(enc []byte) bool {
+	return t.Evolve && len(enc) >= 2 && storedVersion(enc) != t.Version
+}
+
+func (t *logeType) upgradesFrom(version uint16) bool {
+	for v := version; v < t.Version; v++ {
+		if t.Upgraders[v] != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// From a record of an earlier version, decoded as a map, to an object of
+// the current one: upgraders from its version on run in turn, renames
+// apply to what they leave, and the result fills a fresh exemplar the
+// way encoding/json would. Fields the exemplar has and the record
+// doesn't are left zero, and fields the record has and the exemplar
+// doesn't are dropped when it's next written.
+func (t *logeType) evolve(generic interface{}, version uint16) (interface{}, error) {
+	if record, ok := generic.(map[string]interface{}); ok {
+		for v := version; v < t.Version; v++ {
+			var upgrader = t.Upgraders[v]
+			if upgrader == nil {
+				continue
+			}
+			var err error
+			if record, err = upgrader(record); err != nil {
+				return nil, fmt.Errorf("Upgrade from version %d: %w", v, err)
+			}
+		}
+		for from, to := range t.Renames {
+			if value, ok := record[from]; ok {
+				if _, taken := record[to]; !taken {
+					record[to] = value
+				}
+				delete(record, from)
+			}
+		}
+		generic = record
+	}
+
+	var obj = t.NewValue()
+	data, err := json.Marshal(generic)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+func (t *logeType) spackEvolve(enc []byte, toJSON bool) interface{} {
+	generic, _, err := t.SpackType.DecodeObj(enc, true)
+	if err != nil {
+		panic(storeError("Decode error: %v", err))
+	}
+	obj, err := t.evolve(generic, storedVersion(enc))
+	if err != nil {
+		panic(storeError("Decode error (version %d): %v", storedVersion(enc), err))
+	}
+	if toJSON {
+		return jsonGeneric(obj)
+	}
+	return obj
+}
+
+// Nil if the codec can't decode to a map and there are no upgraders to
+// run, which need one
+func (t *logeType) codecEvolve(enc []byte) interface{} {
+	var version = storedVersion(enc)
+	var generic interface{}
+	var err = t.Codec.Unmarshal(enc[2:], &generic)
+	if _, ok := generic.(map[string]interface{}); err != nil || !ok {
+		if t.upgradesFrom(version) {
+			panic(storeError("Decode error (%s, version %d): can't upgrade without decoding to a map", t.Codec.Name(), version))
+		}
+		return nil
+	}
+	obj, err := t.evolve(generic, version)
+	if err != nil {
+		panic(storeError("Decode error (%s, version %d): %v", t.Codec.Name(), storedVersion(enc), err))
+	}
+	return obj
+}
+
+// An object as TransactJSON sees it
+func jsonGeneric(obj interface{}) interface{} {
+	var generic interface{}
+	if data, err := json.Marshal(obj); err != nil {
+		panic(storeError("Decode error: %v", err))
+	} else if err := json.Unmarshal(data, &generic); err != nil {
+		panic(storeError("Decode error: %v", err))
+	}
+	return generic
+}
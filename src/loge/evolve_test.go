@@ -0,0 +1,112 @@
+package loge
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type personV1 struct {
+	Name string
+	Surname string
+	Age int
+}
+
+type personV2 struct {
+	Name string
+	FamilyName string
+	Email string
+}
+
+func TestEvolve(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "loge-evolve")
+	defer os.RemoveAll(dir)
+
+	for _, codec := range []Codec{ nil, JSONCodec } {
+		var path = filepath.Join(dir, "loge.log")
+		os.Remove(path)
+
+		var db = NewLogeDB(NewLogStore(path, nil))
+		db.SetCodec(codec)
+		db.CreateType(NewTypeDef("person", 1, &personV1{}))
+		db.SetOne("person", "one", &personV1{ "One", "Smith", 40 })
+		db.Close()
+
+		db = NewLogeDB(NewLogStore(path, nil))
+		db.SetCodec(codec)
+		var def = NewTypeDef("person", 2, &personV2{})
+		def.Renames = map[string]string{ "Surname": "FamilyName" }
+		db.CreateType(def)
+
+		db.TransactJSON(func (t *Transaction) {
+			var obj = t.Read("person", "one").(map[string]interface{})
+			if obj["FamilyName"] != "Smith" || obj["Age"] != nil {
+				test.Errorf("Wrong JSON object from old version (%v): %v", codec, obj)
+			}
+		}, 0)
+
+		db.Transact(func (t *Transaction) {
+			var obj = t.Read("person", "one").(*personV2)
+			if *obj != (personV2{ "One", "Smith", "" }) {
+				test.Errorf("Wrong object from old version (%v): %+v", codec, obj)
+			}
+		}, 0)
+		if version := storedBlob(db, "person", "one")[1]; version != 2 {
+			test.Errorf("Evolved object not written back (%v): version %d", codec, version)
+		}
+		db.Close()
+	}
+}
+
+type personV3 struct {
+	First string
+	Last string
+	Contact string
+}
+
+func TestUpgraders(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "loge-evolve")
+	defer os.RemoveAll(dir)
+	var path = filepath.Join(dir, "loge.log")
+
+	var db = NewLogeDB(NewLogStore(path, nil))
+	db.CreateType(NewTypeDef("person", 1, &personV1{}))
+	db.SetOne("person", "one", &personV1{ "One Smith", "", 40 })
+	db.Close()
+
+	db = NewLogeDB(NewLogStore(path, nil))
+	db.CreateType(NewTypeDef("person", 2, &personV2{}))
+	db.SetOne("person", "two", &personV2{ "Two Jones", "", "two@example.com" })
+	db.Close()
+
+	var calls = make([]uint16, 0)
+	db = NewLogeDB(NewLogStore(path, nil))
+	defer db.Close()
+	var def = NewTypeDef("person", 3, &personV3{})
+	def.Upgraders = map[uint16]RecordUpgrader{
+		1: func(record map[string]interface{}) (map[string]interface{}, error) {
+			calls = append(calls, 1)
+			record["Email"] = "unknown"
+			return record, nil
+		},
+		2: func(record map[string]interface{}) (map[string]interface{}, error) {
+			calls = append(calls, 2)
+			var name = strings.SplitN(record["Name"].(string), " ", 2)
+			return map[string]interface{}{ "First": name[0], "Last": name[1], "Email": record["Email"] }, nil
+		},
+	}
+	def.Renames = map[string]string{ "Email": "Contact" }
+	db.CreateType(def)
+
+	if obj := db.ReadOne("person", "one").(*personV3); *obj != (personV3{ "One", "Smith", "unknown" }) {
+		test.Errorf("Wrong object from version 1: %+v", obj)
+	}
+	if obj := db.ReadOne("person", "two").(*personV3); *obj != (personV3{ "Two", "Jones", "two@example.com" }) {
+		test.Errorf("Wrong object from version 2: %+v", obj)
+	}
+	if len(calls) != 3 || calls[0] != 1 || calls[1] != 2 || calls[2] != 2 {
+		test.Errorf("Wrong upgrader calls: %v", calls)
+	}
+}
@@ -0,0 +1,116 @@
+package loge
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// A store wrapper for tests, whose reads and commits can be scripted to
+// stall or fail:
+//
+//   var store = loge.NewFaultStore(loge.NewMemStore())
+//   store.Script(loge.FaultCommit, loge.Fault{ Err: io.ErrUnexpectedEOF })
+//
+// Each scripted Fault is used up by one call, in order; its Delay sleeps
+// on Clock. Calls with nothing scripted go straight through to the
+// wrapped store. A failed read raises a *StoreError wrapping the Fault's
+// Err; a failed commit leaves its transaction in the ERROR state with
+// the same.
+type FaultStore struct {
+	LogeStore
+	Clock Clock
+	lock sync.Mutex
+	scripts map[FaultOp][]Fault
+}
+
+type FaultOp int
+
+const (
+	FaultGet FaultOp = iota
+	FaultCommit
+)
+
+type Fault struct {
+	Delay time.Duration
+	Err error
+}
+
+type faultContext struct {
+	transactionContext
+	fstore *FaultStore
+}
+
+func NewFaultStore(store LogeStore) *FaultStore {
+	return &FaultStore{
+		LogeStore: store,
+		Clock: RealClock,
+		scripts: make(map[FaultOp][]Fault),
+	}
+}
+
+func (store *FaultStore) Script(op FaultOp, faults ...Fault) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	store.scripts[op] = append(store.scripts[op], faults...)
+}
+
+// Drops anything scripted and not yet used
+func (store *FaultStore) Clear() {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	store.scripts = make(map[FaultOp][]Fault)
+}
+
+func (store *FaultStore) Pending(op FaultOp) int {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	return len(store.scripts[op])
+}
+
+func (store *FaultStore) next(op FaultOp) Fault {
+	store.lock.Lock()
+	var faults = store.scripts[op]
+	if len(faults) == 0 {
+		store.lock.Unlock()
+		return Fault{}
+	}
+	var fault = faults[0]
+	store.scripts[op] = faults[1:]
+	store.lock.Unlock()
+
+	if fault.Delay > 0 {
+		store.Clock.Sleep(fault.Delay)
+	}
+	return fault
+}
+
+func (store *FaultStore) describe() string {
+	return fmt.Sprintf("Faults over %s", store.LogeStore.describe())
+}
+
+func (store *FaultStore) newContext(ctx context.Context, sID uint64) transactionContext {
+	return &faultContext{
+		transactionContext: store.LogeStore.newContext(ctx, sID),
+		fstore: store,
+	}
+}
+
+func (context *faultContext) get(ref objRef) []byte {
+	var fault = context.fstore.next(FaultGet)
+	if fault.Err != nil {
+		panic(&StoreError{ fault.Err })
+	}
+	return context.transactionContext.get(ref)
+}
+
+func (context *faultContext) commit(sID uint64) error {
+	var fault = context.fstore.next(FaultCommit)
+	if fault.Err != nil {
+		// Stores clean up after a failed commit themselves
+		context.transactionContext.rollback()
+		return fault.Err
+	}
+	return context.transactionContext.commit(sID)
+}
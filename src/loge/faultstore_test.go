@@ -0,0 +1,51 @@
+package loge
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFaultStore(test *testing.T) {
+	var store = NewFaultStore(NewMemStore())
+	var db = NewLogeDB(store)
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+	db.SetOne("test", "one", &TestObj{ "One" })
+
+	var broken = errors.New("broken")
+	store.Script(FaultGet, Fault{ Delay: 10 * time.Millisecond }, Fault{ Err: broken })
+
+	var start = time.Now()
+	if db.ReadOne("test", "one").(*TestObj).Name != "One" {
+		test.Error("Delayed read failed")
+	}
+	if time.Since(start) < 10 * time.Millisecond {
+		test.Error("Read wasn't delayed")
+	}
+
+	var _, err = db.TryReadOne("test", "one")
+	var serr *StoreError
+	if !errors.As(err, &serr) || !errors.Is(err, broken) {
+		test.Errorf("Wrong read error: %v", err)
+	}
+	if store.Pending(FaultGet) != 0 {
+		test.Error("Faults not used up")
+	}
+
+	store.Script(FaultCommit, Fault{ Err: broken })
+	var t = db.CreateTransaction()
+	t.Set("test", "two", &TestObj{ "Two" })
+	if ok, err := t.TryCommit(); ok || !errors.Is(err, broken) {
+		test.Errorf("Wrong commit result: %v %v", ok, err)
+	}
+	if db.ExistsOne("test", "two") {
+		test.Error("Failed commit reached the store")
+	}
+
+	store.Script(FaultCommit, Fault{ Err: broken })
+	store.Clear()
+	db.SetOne("test", "two", &TestObj{ "Two" })
+	if !db.ExistsOne("test", "two") {
+		test.Error("Cleared fault still fired")
+	}
+}
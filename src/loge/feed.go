@@ -0,0 +1,111 @@
+package loge
+
+import (
+	"time"
+)
+
+// Committed changes, in commit order. Link changes carry the link name
+// and the new target list instead of an object.
+type Change struct {
+	Type string
+	Key LogeKey
+	Link string
+	SnapshotID uint64
+	Time time.Time
+	Object interface{}
+	Links []LogeKey
+	Deleted bool
+}
+
+// Subscribers never block commits: if C fills up, the subscription is
+// dropped and C closed, with Overflowed() reporting why.
+type Subscription struct {
+	C <-chan Change
+	ch chan Change
+	db *LogeDB
+	overflowed bool
+}
+
+type changeFeed struct {
+	lock spinLock
+	subs map[*Subscription]bool
+}
+
+func (db *LogeDB) Subscribe(buffer int) *Subscription {
+	var ch = make(chan Change, buffer)
+	var sub = &Subscription{
+		C: ch,
+		ch: ch,
+		db: db,
+	}
+
+	db.feed.lock.SpinLock()
+	defer db.feed.lock.Unlock()
+	if db.feed.subs == nil {
+		db.feed.subs = make(map[*Subscription]bool)
+	}
+	db.feed.subs[sub] = true
+	return sub
+}
+
+func (sub *Subscription) Close() {
+	var feed = &sub.db.feed
+	feed.lock.SpinLock()
+	defer feed.lock.Unlock()
+	if feed.subs[sub] {
+		delete(feed.subs, sub)
+		close(sub.ch)
+	}
+}
+
+func (sub *Subscription) Overflowed() bool {
+	var feed = &sub.db.feed
+	feed.lock.SpinLock()
+	defer feed.lock.Unlock()
+	return sub.overflowed
+}
+
+func (feed *changeFeed) active() bool {
+	feed.lock.SpinLock()
+	defer feed.lock.Unlock()
+	return len(feed.subs) > 0
+}
+
+func (feed *changeFeed) publish(changes []Change) {
+	feed.lock.SpinLock()
+	defer feed.lock.Unlock()
+
+	for sub := range feed.subs {
+		for _, change := range changes {
+			select {
+			case sub.ch <- change:
+				continue
+			default:
+			}
+			sub.overflowed = true
+			delete(feed.subs, sub)
+			close(sub.ch)
+			break
+		}
+	}
+}
+
+func (obj *logeObject) change(sID uint64, now time.Time) Change {
+	var change = Change{
+		Type: obj.Type.Name,
+		Key: obj.Key,
+		Link: obj.LinkName,
+		SnapshotID: sID,
+		Time: now,
+	}
+
+	var object, _ = obj.Current.getObject(false)
+	if obj.LinkName != "" {
+		change.Links = object.(*linkSet).ReadKeys()
+	} else if obj.hasValue(object) {
+		change.Object = object
+	} else {
+		change.Deleted = true
+	}
+	return change
+}
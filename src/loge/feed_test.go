@@ -0,0 +1,66 @@
+package loge
+
+import (
+	"testing"
+	"reflect"
+)
+
+func TestChangeFeed(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	var def = NewTypeDef("test", 1, &TestObj{})
+	def.Links = LinkSpec{ "other": "test" }
+	db.CreateType(def)
+
+	var sub = db.Subscribe(10)
+
+	db.Transact(func (t *Transaction) {
+		t.Set("test", "one", &TestObj{ Name: "One" })
+		t.AddLink("test", "other", "one", "two")
+	}, 0)
+
+	db.ReadOne("test", "one")
+	db.DeleteOne("test", "one")
+
+	var changes []Change
+	for len(sub.C) > 0 {
+		changes = append(changes, <-sub.C)
+	}
+
+	if len(changes) != 3 {
+		test.Fatalf("Wrong number of changes: %#v", changes)
+	}
+
+	var byLink = map[string]Change{ changes[0].Link: changes[0], changes[1].Link: changes[1] }
+	if byLink[""].Key != "one" || byLink[""].Object.(*TestObj).Name != "One" {
+		test.Errorf("Wrong object change: %#v", byLink[""])
+	}
+
+	if !reflect.DeepEqual(byLink["other"].Links, []LogeKey{"two"}) {
+		test.Errorf("Wrong link change: %#v", byLink["other"])
+	}
+
+	if !changes[2].Deleted || changes[2].SnapshotID <= changes[0].SnapshotID {
+		test.Errorf("Wrong delete change: %#v", changes[2])
+	}
+
+	sub.Close()
+	if _, ok := <-sub.C; ok {
+		test.Error("Channel open after close")
+	}
+}
+
+func TestChangeFeedOverflow(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+
+	var sub = db.Subscribe(1)
+	db.SetOne("test", "one", &TestObj{ Name: "One" })
+	db.SetOne("test", "two", &TestObj{ Name: "Two" })
+
+	<-sub.C
+	if _, ok := <-sub.C; ok || !sub.Overflowed() {
+		test.Error("Full subscription not dropped")
+	}
+
+	sub.Close()
+}
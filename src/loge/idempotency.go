@@ -0,0 +1,62 @@
+package loge
+
+import (
+	"context"
+	"time"
+)
+
+// Transactions run with an idempotency key commit at most once per key,
+// here or through TransactOptions.IdempotencyKey:
+//
+//   db.EnableIdempotency()   // At startup, as with CreateType
+//   ...
+//   db.TransactOnce(msg.ID, func (t *loge.Transaction) {
+//       ...   // Apply the message
+//   }, 0)
+//
+// The key is recorded in the same commit as the actor's writes, so a
+// redelivered message finds it and is skipped, reported as success
+// without running the actor. Duplicates racing each other conflict on
+// the record, and whichever retries then skips. Keys are kept until
+// ForgetIdempotencyKey.
+type idempotencyRecord struct {
+	Committed int64 // UnixNano
+}
+
+const idempotencyTypeName = "_idempotency"
+
+func (db *LogeDB) EnableIdempotency() {
+	if db.Type(idempotencyTypeName) == nil {
+		db.CreateType(NewTypeDef(idempotencyTypeName, 1, &idempotencyRecord{}))
+	}
+}
+
+func (db *LogeDB) TransactOnce(key string, actor Transactor, timeout time.Duration) bool {
+	return db.doTransact(context.Background(), db.onceActor(key, actor), timeout, false, db.retry)
+}
+
+func (db *LogeDB) TryTransactOnce(key string, actor Transactor, timeout time.Duration) (bool, error) {
+	return db.tryTransact(context.Background(), db.onceActor(key, actor), timeout, false, db.retry)
+}
+
+// Whether a transaction with key has committed
+func (db *LogeDB) IdempotencyKeyCommitted(key string) bool {
+	return db.ExistsOne(idempotencyTypeName, LogeKey(key))
+}
+
+// Lets key commit again
+func (db *LogeDB) ForgetIdempotencyKey(key string) {
+	db.DeleteOne(idempotencyTypeName, LogeKey(key))
+}
+
+func (db *LogeDB) onceActor(key string, actor Transactor) Transactor {
+	return func (t *Transaction) {
+		if t.Read(idempotencyTypeName, LogeKey(key)).(*idempotencyRecord) != nil {
+			return
+		}
+		actor(t)
+		if t.state == ACTIVE {
+			t.Set(idempotencyTypeName, LogeKey(key), &idempotencyRecord{ db.clock.Now().UnixNano() })
+		}
+	}
+}
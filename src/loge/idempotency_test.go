@@ -0,0 +1,59 @@
+package loge
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestIdempotency(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	db.CreateType(NewTypeDef("test", 1, &TestCounter{}))
+
+	if _, err := db.TryTransactOnce("msg-1", func (t *Transaction) {}, 0); !errors.Is(err, ErrNoSuchType) {
+		test.Errorf("Idempotency used before enabling: %v", err)
+	}
+	db.EnableIdempotency()
+	db.SetOne("test", "count", &TestCounter{ 0 })
+
+	var runs = 0
+	var apply = func (t *Transaction) {
+		runs++
+		t.Write("test", "count").(*TestCounter).Value++
+	}
+	if !db.TransactOnce("msg-1", apply, 0) || !db.TransactOnce("msg-1", apply, 0) {
+		test.Fatal("Idempotent transaction failed")
+	}
+	if runs != 1 || db.ReadOne("test", "count").(*TestCounter).Value != 1 {
+		test.Errorf("Duplicate applied: %d runs", runs)
+	}
+	if !db.IdempotencyKeyCommitted("msg-1") || db.IdempotencyKeyCommitted("msg-2") {
+		test.Error("Wrong committed keys")
+	}
+
+	// A duplicate committing first makes the retry skip
+	runs = 0
+	var result, err = TransactResult(db, func (t *Transaction) (int, error) {
+		apply(t)
+		if runs == 1 {
+			db.TransactOnce("msg-2", apply, 0)
+		}
+		return runs, nil
+	}, TransactOptions{ IdempotencyKey: "msg-2" })
+	if err != nil || result != 0 || runs != 2 || db.ReadOne("test", "count").(*TestCounter).Value != 2 {
+		test.Errorf("Racing duplicate applied: %d runs, result %d, %v", runs, result, err)
+	}
+
+	// Failed transactions don't record their key
+	TransactResult(db, func (t *Transaction) (int, error) {
+		return 0, errors.New("Failed")
+	}, TransactOptions{ IdempotencyKey: "msg-3" })
+	if db.IdempotencyKeyCommitted("msg-3") {
+		test.Error("Key recorded for failed transaction")
+	}
+
+	db.ForgetIdempotencyKey("msg-1")
+	db.TransactOnce("msg-1", apply, 0)
+	if db.ReadOne("test", "count").(*TestCounter).Value != 3 {
+		test.Error("Forgotten key still skipped")
+	}
+}
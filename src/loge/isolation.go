@@ -0,0 +1,88 @@
+package loge
+
+import (
+	"context"
+)
+
+// How much of what other transactions commit a transaction may see or
+// miss. Set before use:
+//
+//   SnapshotIsolation, the default: everything is read at the snapshot
+//   the transaction started at, and it aborts if anything it read or
+//   wrote was committed since.
+//
+//   ReadCommitted: each read of an object or query not already in the
+//   transaction sees the latest commit, and only the objects it writes
+//   are checked at commit, against when it first read them. Cheaper for
+//   long jobs, which stop conflicting over what they only read, but
+//   reads can disagree with each other.
+//
+//   Serializable: as SnapshotIsolation, also aborting if a Find or List
+//   query would now give different keys. See SetSerializable.
+type IsolationLevel int
+
+const (
+	SnapshotIsolation IsolationLevel = iota
+	ReadCommitted
+	Serializable
+)
+
+func (level IsolationLevel) String() string {
+	switch level {
+	case SnapshotIsolation:
+		return "SnapshotIsolation"
+	case ReadCommitted:
+		return "ReadCommitted"
+	case Serializable:
+		return "Serializable"
+	}
+	return "UNKNOWN ISOLATION"
+}
+
+func (t *Transaction) SetIsolation(level IsolationLevel) {
+	t.isolation = level
+}
+
+func (t *Transaction) Isolation() IsolationLevel {
+	return t.isolation
+}
+
+// Moves a ReadCommitted transaction's store context up to the latest
+// snapshot, before a store operation
+func (t *Transaction) readLatest() {
+	if t.isolation != ReadCommitted || t.view || t.state != ACTIVE {
+		return
+	}
+	if t.db.visibleSnapshotID() == t.snapshotID {
+		return
+	}
+
+	// Merges need the object as written over, which only this context
+	// has for versions not loaded yet
+	for _, lv := range t.versions {
+		var obj = lv.version.LogeObj
+		if lv.version.loaded || obj.Type.Merger == nil || obj.LinkName != "" {
+			continue
+		}
+		obj.Lock.SpinLock()
+		if !lv.version.loaded {
+			lv.version.Blob = t.context.get(obj.makeObjRef())
+			lv.version.loaded = true
+		}
+		obj.Lock.Unlock()
+	}
+
+	var ctx context.Context = t.ctx
+	if t.opCtx != nil {
+		ctx = t.opCtx
+	}
+	var sID, latest = t.db.currentContext(ctx)
+	t.context.rollback()
+	t.context = latest
+	t.snapshotID = sID
+}
+
+// Whether commit checks lv for conflicts
+func (t *Transaction) checksVersion(lv *liveVersion) bool {
+	return lv.dirty || t.isolation != ReadCommitted
+}
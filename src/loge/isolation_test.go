@@ -0,0 +1,74 @@
+package loge
+
+import (
+	"testing"
+)
+
+func TestReadCommitted(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+	db.SetOne("test", "one", &TestObj{ "One" })
+	db.SetOne("test", "two", &TestObj{ "Two" })
+
+	var snapshot, committed = db.CreateTransaction(), db.CreateTransaction()
+	committed.SetIsolation(ReadCommitted)
+	for _, t := range []*Transaction{ snapshot, committed } {
+		t.Read("test", "one")
+	}
+	db.SetOne("test", "one", &TestObj{ "One again" })
+	db.SetOne("test", "two", &TestObj{ "Two again" })
+
+	if snapshot.Read("test", "two").(*TestObj).Name != "Two" {
+		test.Error("Snapshot read the latest commit")
+	}
+	if committed.Read("test", "two").(*TestObj).Name != "Two again" {
+		test.Error("Read committed missed the latest commit")
+	}
+	if committed.Read("test", "one").(*TestObj).Name != "One" {
+		test.Error("Object in the transaction read again")
+	}
+
+	for _, t := range []*Transaction{ snapshot, committed } {
+		t.Set("test", "three", &TestObj{ t.Isolation().String() })
+	}
+	if snapshot.Commit() || !committed.Commit() {
+		test.Error("Wrong commits for stale reads")
+	}
+
+	// Writes still conflict, from when they were read
+	var t = db.CreateTransaction()
+	t.SetIsolation(ReadCommitted)
+	t.Read("test", "three")
+	db.SetOne("test", "one", &TestObj{ "Again" })
+	t.Write("test", "one").(*TestObj).Name = "Written"
+	db.SetOne("test", "three", &TestObj{ "Again" })
+	t.Write("test", "two").(*TestObj).Name = "Written"
+	db.SetOne("test", "two", &TestObj{ "Again" })
+	if t.Commit() || t.Conflict().Key != "two" || t.Conflict().SnapshotID != t.Conflict().CurrentID - 1 {
+		test.Errorf("Wrong conflict: %v", t.Conflict())
+	}
+
+	TransactResult(db, func (t *Transaction) (bool, error) {
+		if t.Isolation() != ReadCommitted {
+			test.Errorf("Wrong isolation: %v", t.Isolation())
+		}
+		return true, nil
+	}, TransactOptions{ Isolation: ReadCommitted })
+}
+
+func TestReadCommittedMerge(test *testing.T) {
+	var db = mergeDB()
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+	db.SetOne("counters", "merged", &TestCounter{ 1 })
+
+	var t = db.CreateTransaction()
+	t.SetIsolation(ReadCommitted)
+	t.Set("counters", "merged", &TestCounter{ 5 })
+	db.SetOne("counters", "merged", &TestCounter{ 10 })
+	t.Read("test", "other")
+
+	// Merged over the object as it was when it was set
+	if !t.Commit() || db.ReadOne("counters", "merged").(*TestCounter).Value != 14 {
+		test.Errorf("Wrong merge: %v", db.ReadOne("counters", "merged"))
+	}
+}
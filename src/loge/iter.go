@@ -0,0 +1,134 @@
+package loge
+
+import (
+	"sort"
+)
+
+// Walks a type's keys in order as the transaction sees them: the store
+// at its snapshot, plus objects it has created, minus ones it has
+// deleted. Objects are loaded only when Value is called.
+//
+//   var it = t.Iter("person")
+//   defer it.Close()
+//   for it.Seek("m"); it.Valid(); it.Next() {
+//       var person = it.Value().(*Person)
+//   }
+type Iterator struct {
+	t *Transaction
+	typeName string
+	store ResultSet
+	storeKey LogeKey
+	storeValid bool
+	staged []LogeKey
+	key LogeKey
+	valid bool
+}
+
+func (t *Transaction) Iter(typeName string) *Iterator {
+	t.db.lookupType(typeName)
+	return &Iterator{
+		t: t,
+		typeName: typeName,
+	}
+}
+
+// Positions at the first key at or after key
+func (it *Iterator) Seek(key LogeKey) {
+	it.Close()
+	it.store = it.t.ListSlice(it.typeName, key, -1)
+	it.nextStored()
+
+	var typ = it.t.db.lookupType(it.typeName)
+	it.staged = it.staged[:0]
+	for _, lv := range it.t.versions {
+		var obj = lv.version.LogeObj
+		if lv.dirty && obj.Type == typ && obj.LinkName == "" && obj.Key >= key {
+			it.staged = append(it.staged, obj.Key)
+		}
+	}
+	// ListSlice starts after key, so it's checked here
+	if key != "" && it.t.Exists(it.typeName, key) {
+		it.staged = append(it.staged, key)
+	}
+	sort.Slice(it.staged, func(i, j int) bool { return it.staged[i] < it.staged[j] })
+
+	it.advance()
+}
+
+func (it *Iterator) Valid() bool {
+	return it.valid
+}
+
+func (it *Iterator) Next() {
+	if it.valid {
+		it.advance()
+	}
+}
+
+func (it *Iterator) Key() LogeKey {
+	return it.key
+}
+
+func (it *Iterator) Value() interface{} {
+	return it.t.Read(it.typeName, it.key)
+}
+
+func (it *Iterator) Close() {
+	if it.store != nil {
+		it.store.Close()
+		it.store = nil
+	}
+	it.storeValid = false
+	it.valid = false
+}
+
+func (it *Iterator) nextStored() {
+	it.storeValid = it.store.Valid()
+	if it.storeValid {
+		it.storeKey = it.store.Next()
+	}
+}
+
+func (it *Iterator) advance() {
+	for {
+		var haveStaged = len(it.staged) > 0
+		if !it.storeValid && !haveStaged {
+			it.valid = false
+			return
+		}
+
+		var key LogeKey
+		switch {
+		case !haveStaged:
+			key = it.storeKey
+		case !it.storeValid:
+			key = it.staged[0]
+		case it.storeKey < it.staged[0]:
+			key = it.storeKey
+		default:
+			key = it.staged[0]
+		}
+
+		for len(it.staged) > 0 && it.staged[0] == key {
+			it.staged = it.staged[1:]
+		}
+		if it.storeValid && it.storeKey == key {
+			it.nextStored()
+		}
+
+		if it.visible(key) {
+			it.key = key
+			it.valid = true
+			return
+		}
+	}
+}
+
+// Stored keys exist unless the transaction deleted them
+func (it *Iterator) visible(key LogeKey) bool {
+	lv, ok := it.t.versions[it.t.db.makeObjRef(it.typeName, key).CacheKey]
+	if !ok {
+		return true
+	}
+	return lv.exists()
+}
@@ -0,0 +1,86 @@
+package loge
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestIterator(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "loge-iter")
+	defer os.RemoveAll(dir)
+
+	var db = NewLogeDB(NewLevelDBStore(dir))
+	defer db.Close()
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+	db.CreateType(NewTypeDef("other", 1, &TestObj{}))
+
+	db.Transact(func (t *Transaction) {
+		for _, key := range []LogeKey{ "b", "d", "f", "h" } {
+			t.Set("test", key, &TestObj{ string(key) })
+		}
+		t.Set("other", "c", &TestObj{ "c" })
+	}, 0)
+
+	var collect = func(it *Iterator, from LogeKey) []LogeKey {
+		var keys = []LogeKey{}
+		for it.Seek(from); it.Valid(); it.Next() {
+			if it.Value().(*TestObj).Name != string(it.Key()) {
+				test.Errorf("Wrong value for %s", it.Key())
+			}
+			keys = append(keys, it.Key())
+		}
+		return keys
+	}
+
+	db.Transact(func (t *Transaction) {
+		t.Set("test", "a", &TestObj{ "a" })
+		t.Set("test", "e", &TestObj{ "e" })
+		t.Delete("test", "f")
+		t.Write("test", "h")
+
+		var it = t.Iter("test")
+		defer it.Close()
+
+		if keys := collect(it, ""); !reflect.DeepEqual(keys, []LogeKey{ "a", "b", "d", "e", "h" }) {
+			test.Errorf("Wrong keys: %v", keys)
+		}
+		if keys := collect(it, "d"); !reflect.DeepEqual(keys, []LogeKey{ "d", "e", "h" }) {
+			test.Errorf("Wrong keys from d: %v", keys)
+		}
+		if keys := collect(it, "dd"); !reflect.DeepEqual(keys, []LogeKey{ "e", "h" }) {
+			test.Errorf("Wrong keys from dd: %v", keys)
+		}
+		if keys := collect(it, "i"); len(keys) != 0 {
+			test.Errorf("Keys past the end: %v", keys)
+		}
+	}, 0)
+}
+
+
+func TestExistsProbe(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "loge-exists")
+	defer os.RemoveAll(dir)
+
+	var db = NewLogeDB(NewLevelDBStore(dir))
+	defer db.Close()
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+	db.SetOne("test", "one", &TestObj{ "One" })
+
+	db.Transact(func (t *Transaction) {
+		var exists = t.ExistsMany("test", []LogeKey{ "one", "two" })
+		if !exists["one"] || exists["two"] || !t.Exists("test", "one") {
+			test.Errorf("Wrong existence: %v", exists)
+		}
+		if db.Stats().CachedObjects != 0 {
+			test.Error("Probes loaded objects")
+		}
+
+		t.Delete("test", "one")
+		t.Set("test", "two", &TestObj{ "Two" })
+		if t.Exists("test", "one") || !t.Exists("test", "two") {
+			test.Error("Probe ignored the transaction's writes")
+		}
+	}, 0)
+}
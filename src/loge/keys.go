@@ -0,0 +1,158 @@
+package loge
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Composite keys. Each part is escaped (0x00 -> 0x00 0xFF) and terminated
+// (0x00 0x01), so no part can be mistaken for a separator, and encoded
+// keys sort part by part:
+//
+//   Key("user", "2024", "03") < Key("user", "2024", "10") < Key("user", "2025")
+//
+// and every key starting with some parts starts with KeyPrefix of them.
+
+const (
+	keyEscape = 0x00
+	keyEscaped = 0xFF
+	keyTerminator = 0x01
+)
+
+var ErrNotComposite = errors.New("Not a composite key")
+var ErrInvalidKey = errors.New("Invalid key")
+
+func Key(parts ...string) LogeKey {
+	return LogeKey(appendKeyParts(nil, parts))
+}
+
+// Everything in a scan starting from this is a key with these leading
+// parts, until the first key that doesn't have the prefix
+func KeyPrefix(parts ...string) LogeKey {
+	return Key(parts...)
+}
+
+func appendKeyParts(buf []byte, parts []string) []byte {
+	for _, part := range parts {
+		for i := 0; i < len(part); i++ {
+			buf = append(buf, part[i])
+			if part[i] == keyEscape {
+				buf = append(buf, keyEscaped)
+			}
+		}
+		buf = append(buf, keyEscape, keyTerminator)
+	}
+	return buf
+}
+
+func (key LogeKey) Parts() ([]string, error) {
+	var parts []string
+	var part []byte
+	var enc = []byte(key)
+	if len(enc) == 0 {
+		return nil, ErrNotComposite
+	}
+
+	for i := 0; i < len(enc); i++ {
+		if enc[i] != keyEscape {
+			part = append(part, enc[i])
+			continue
+		}
+		if i + 1 == len(enc) {
+			return nil, ErrNotComposite
+		}
+		i++
+		switch enc[i] {
+		case keyEscaped:
+			part = append(part, keyEscape)
+		case keyTerminator:
+			parts = append(parts, string(part))
+			part = nil
+		default:
+			return nil, ErrNotComposite
+		}
+	}
+
+	if part != nil {
+		return nil, ErrNotComposite
+	}
+	return parts, nil
+}
+
+func (key LogeKey) HasPrefix(prefix LogeKey) bool {
+	return bytes.HasPrefix([]byte(key), []byte(prefix))
+}
+
+// Empty keys are rejected, and so is anything containing the escape byte
+// which isn't a well-formed composite key, since it would sort among (and
+// could be mistaken for) composite ones
+func ValidateKey(key LogeKey) error {
+	if len(key) == 0 {
+		return ErrInvalidKey
+	}
+	if strings.IndexByte(string(key), keyEscape) == -1 {
+		return nil
+	}
+	if _, err := key.Parts(); err != nil {
+		return ErrInvalidKey
+	}
+	return nil
+}
+
+// Every write checks its keys, so stores never hold one that scans
+// and prefixes would misorder
+func checkKey(key LogeKey) {
+	if ValidateKey(key) != nil {
+		panic(fmt.Errorf("%w: %q", ErrInvalidKey, key))
+	}
+}
+
+// The first n parts
+func (key LogeKey) Prefix(n int) (LogeKey, error) {
+	parts, err := key.Parts()
+	if err != nil {
+		return "", err
+	}
+	if n < 0 || n > len(parts) {
+		return "", ErrInvalidKey
+	}
+	return Key(parts[:n]...), nil
+}
+
+// All but the last part
+func (key LogeKey) Parent() (LogeKey, error) {
+	parts, err := key.Parts()
+	if err != nil {
+		return "", err
+	}
+	return Key(parts[:len(parts) - 1]...), nil
+}
+
+// Readable form for URLs, logs and command lines: parts are path-escaped
+// and joined with "/", so "user/2024/03" is Key("user", "2024", "03").
+// Plain keys are returned as they are.
+func (key LogeKey) Path() string {
+	parts, err := key.Parts()
+	if err != nil {
+		return string(key)
+	}
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/")
+}
+
+func ParseKeyPath(path string) (LogeKey, error) {
+	var parts = strings.Split(path, "/")
+	for i, part := range parts {
+		unescaped, err := url.PathUnescape(part)
+		if err != nil {
+			return "", ErrInvalidKey
+		}
+		parts[i] = unescaped
+	}
+	return Key(parts...), nil
+}
@@ -0,0 +1,201 @@
+package loge
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"reflect"
+	"sort"
+)
+
+func TestCompositeKeys(test *testing.T) {
+	var cases = [][]string{
+		{ "user", "2024", "03" },
+		{ "" },
+		{ "a\x00b", "\x00", "\xff" },
+		{ "a:b", "c" },
+	}
+
+	for _, parts := range cases {
+		var decoded, err = Key(parts...).Parts()
+		if err != nil || !reflect.DeepEqual(decoded, parts) {
+			test.Errorf("Round trip of %q gave %q (%v)", parts, decoded, err)
+		}
+	}
+
+	if Key("a:b", "c") == Key("a", "b:c") || Key("a\x00", "b") == Key("a", "\x00b") {
+		test.Error("Composite keys collide")
+	}
+
+	for _, key := range []LogeKey{ "", "plain", "bad\x00", "bad\x00\x02" } {
+		if _, err := key.Parts(); err != ErrNotComposite {
+			test.Errorf("Parsed non-composite key %q", key)
+		}
+	}
+}
+
+func TestCompositeKeyOrder(test *testing.T) {
+	var ordered = [][]string{
+		{ "user" },
+		{ "user", "" },
+		{ "user", "2024" },
+		{ "user", "2024", "03" },
+		{ "user", "2024", "10" },
+		{ "user", "2024\x00" },
+		{ "user", "2024\x01" },
+		{ "user", "2025" },
+		{ "user\x00" },
+		{ "users" },
+	}
+
+	var keys = make([]string, 0, len(ordered))
+	for _, parts := range ordered {
+		keys = append(keys, string(Key(parts...)))
+	}
+	if !sort.StringsAreSorted(keys) {
+		test.Errorf("Encoded keys out of order: %q", keys)
+	}
+
+	var prefix = KeyPrefix("user", "2024")
+	for i, parts := range ordered {
+		var want = i >= 2 && i <= 4
+		if LogeKey(keys[i]).HasPrefix(prefix) != want {
+			test.Errorf("Wrong prefix match for %q", parts)
+		}
+	}
+}
+
+func TestKeyHelpers(test *testing.T) {
+	var key = Key("user", "a/b", "03")
+
+	if ValidateKey(key) != nil || ValidateKey("plain") != nil {
+		test.Error("Valid keys rejected")
+	}
+	if ValidateKey("") == nil || ValidateKey("bad\x00") == nil {
+		test.Error("Invalid keys accepted")
+	}
+
+	if prefix, err := key.Prefix(2); err != nil || prefix != KeyPrefix("user", "a/b") {
+		test.Errorf("Wrong prefix: %q (%v)", prefix, err)
+	}
+	if _, err := key.Prefix(4); err != ErrInvalidKey {
+		test.Errorf("Prefix past the end gave %v", err)
+	}
+	if parent, _ := key.Parent(); parent != Key("user", "a/b") {
+		test.Errorf("Wrong parent: %q", parent)
+	}
+
+	if key.Path() != "user/a%2Fb/03" {
+		test.Errorf("Wrong path: %s", key.Path())
+	}
+	if parsed, err := ParseKeyPath(key.Path()); err != nil || parsed != key {
+		test.Errorf("Path round trip gave %q (%v)", parsed, err)
+	}
+	if LogeKey("plain").Path() != "plain" {
+		test.Error("Plain key path changed")
+	}
+}
+
+func TestPrefixScans(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "loge-keys")
+	defer os.RemoveAll(dir)
+
+	var db = NewLogeDB(NewLevelDBStore(dir))
+	defer db.Close()
+
+	var def = NewTypeDef("test", 1, &TestObj{})
+	def.Links = LinkSpec{ "other": "test" }
+	db.CreateType(def)
+
+	var keys = []LogeKey{
+		Key("user", "2023", "12"),
+		Key("user", "2024", "01"),
+		Key("user", "2024", "02"),
+		Key("user", "2024", "03"),
+		Key("user", "2025", "01"),
+	}
+	db.Transact(func (t *Transaction) {
+		for _, key := range keys {
+			t.Set("test", key, &TestObj{ string(key) })
+			t.AddLink("test", "other", key, "target")
+		}
+	}, 0)
+
+	var prefix = KeyPrefix("user", "2024")
+	var cases = []struct {
+		from LogeKey
+		limit int
+		want []LogeKey
+	}{
+		{ "", -1, keys[1:4] },
+		{ "", 2, keys[1:3] },
+		{ keys[1], -1, keys[2:4] },
+		{ Key("user", "2024", "015"), -1, keys[2:4] },
+		{ keys[0], -1, keys[1:4] },
+		{ keys[4], -1, []LogeKey{} },
+	}
+
+	for _, c := range cases {
+		var listed = db.ListPrefix("test", prefix, c.from, c.limit)
+		if !reflect.DeepEqual(listed, c.want) {
+			test.Errorf("ListPrefix from %q: %q", c.from, listed)
+		}
+		var found = db.FindPrefix("test", "other", "target", prefix, c.from, c.limit)
+		if !reflect.DeepEqual(found, c.want) {
+			test.Errorf("FindPrefix from %q: %q", c.from, found)
+		}
+	}
+
+	// A from key which isn't stored doesn't swallow the next one
+	if listed := db.ListSlice("test", Key("user", "2024"), 1); !reflect.DeepEqual(listed, keys[1:2]) {
+		test.Errorf("ListSlice from a missing key: %q", listed)
+	}
+
+	if _, err := db.TryListPrefix("nope", prefix, "", -1); !errors.Is(err, ErrNoSuchType) {
+		test.Errorf("Wrong error for TryListPrefix: %v", err)
+	}
+	if _, err := db.TryFindPrefix("test", "nope", "target", prefix, "", -1); !errors.Is(err, ErrNoSuchLink) {
+		test.Errorf("Wrong error for TryFindPrefix: %v", err)
+	}
+}
+
+func TestWriteKeyValidation(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	var def = NewTypeDef("test", 1, &TestObj{})
+	def.Links = LinkSpec{ "other": "test" }
+	db.CreateType(def)
+
+	var invalid = []LogeKey{ "", "a\x00b", Key("a") + "b" }
+	db.Transact(func (t *Transaction) {
+		for _, key := range invalid {
+			if err := t.TrySet("test", key, &TestObj{ "Bad" }); !errors.Is(err, ErrInvalidKey) {
+				test.Errorf("Wrong error setting %q: %v", key, err)
+			}
+			if err := t.TryAddLink("test", "other", "one", key); !errors.Is(err, ErrInvalidKey) {
+				test.Errorf("Wrong error linking to %q: %v", key, err)
+			}
+		}
+
+		var batch = NewBatch()
+		batch.Set("test", "one", &TestObj{ "One" })
+		batch.Set("test", invalid[1], &TestObj{ "Bad" })
+		var err = func() (err error) {
+			defer recoverError(&err)
+			t.Apply(batch)
+			return nil
+		}()
+		if !errors.Is(err, ErrInvalidKey) {
+			test.Errorf("Wrong error applying batch: %v", err)
+		}
+		if _, ok := t.ReadOK("test", "one"); ok {
+			test.Error("Batch with an invalid key partly applied")
+		}
+
+		t.Set("test", Key("user", "a\x00b"), &TestObj{ "Composite" })
+	}, 0)
+
+	if !db.ExistsOne("test", Key("user", "a\x00b")) {
+		test.Error("Valid composite key rejected")
+	}
+}
@@ -0,0 +1,48 @@
+package loge
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestTransactionLabel(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+	db.SetOne("test", "one", &TestObj{ "One" })
+
+	var t = db.CreateTransaction()
+	t.SetLabel("checkout-1234")
+	if t.Label() != "checkout-1234" || t.String() != "Transaction<checkout-1234: ACTIVE>" {
+		test.Errorf("Wrong label: %s", t)
+	}
+
+	t.Write("test", "one")
+	db.SetOne("test", "one", &TestObj{ "Other" })
+	if t.Commit() || t.Conflict() == nil || t.Conflict().Label != "checkout-1234" {
+		test.Fatalf("Conflict not labelled: %v", t.Conflict())
+	}
+	if !strings.Contains(t.Err().Error(), "checkout-1234") {
+		test.Errorf("Label missing from error: %v", t.Err())
+	}
+
+	var err = t.TrySet("test", "two", &TestObj{ "Two" })
+	if !errors.Is(err, ErrInactive) || !strings.Contains(err.Error(), "checkout-1234") {
+		test.Errorf("Label missing from panic: %v", err)
+	}
+
+	var reports []*ContentionReport
+	db.SetContentionReporter(func (report *ContentionReport) {
+		reports = append(reports, report)
+	})
+	var policy = RetryPolicy{ MaxAttempts: 2, ReportAfter: 2 }
+	TransactResult(db, func (t *Transaction) (bool, error) {
+		t.SetLabel("retried")
+		t.Write("test", "one")
+		db.SetOne("test", "one", &TestObj{ "Other" })
+		return true, nil
+	}, TransactOptions{ Retry: &policy })
+	if len(reports) != 1 || reports[0].Label != "retried" || reports[0].Hotspot.Label != "retried" {
+		test.Errorf("Report not labelled: %v", reports)
+	}
+}
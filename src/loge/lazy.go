@@ -0,0 +1,87 @@
+package loge
+
+import (
+	"fmt"
+)
+
+// An object read without decoding it, for code which only passes it on:
+//
+//   var obj = t.ReadLazy("person", key)
+//   w.Write(obj.Payload())     // a JSON document under JSONCodec
+//
+// It joins the transaction as Read would, at the same snapshot and with
+// the same conflicts on commit, but isn't decoded until Object is called
+// or the transaction reads or writes it some other way.
+type LazyObject struct {
+	t *Transaction
+	ref objRef
+	lv *liveVersion
+}
+
+func (t *Transaction) ReadLazy(typeName string, key LogeKey) *LazyObject {
+	if t.state != ACTIVE {
+		panic(fmt.Errorf("%w: %s", ErrInactive, t))
+	}
+
+	var ref = t.db.makeObjRef(typeName, key)
+	lv, ok := t.versions[ref.CacheKey]
+	if !ok {
+		defer t.operation()()
+		lv = &liveVersion{
+			version: t.acquire(ref, true),
+			lazy: true,
+		}
+		t.versions[ref.CacheKey] = lv
+		t.countVersion(ref.CacheKey, lv.version)
+	}
+	return &LazyObject{ t, ref, lv }
+}
+
+// For getVersion, once something needs the object itself
+func (t *Transaction) decodeLazy(lv *liveVersion) {
+	object, upgraded := lv.version.getObject(t.giveJSON)
+	lv.version.LogeObj.populateMeta(object, t.snapshotID)
+	lv.object = object
+	lv.lazy = false
+	if upgraded {
+		lv.dirty = true
+	}
+}
+
+func (obj *LazyObject) Exists() bool {
+	return obj.lv.exists()
+}
+
+// The blob as the store has it: the type version, then the object as
+// spack or the type's codec encoded it. Nil if there's no object. If
+// the transaction has changed it, what it would be written as. Don't
+// modify it.
+func (obj *LazyObject) Bytes() []byte {
+	if obj.lv.dirty {
+		return obj.lv.version.LogeObj.encode(obj.lv.object)
+	}
+	return obj.lv.version.Blob
+}
+
+// The type version the object was stored at
+func (obj *LazyObject) Version() uint16 {
+	var blob = obj.Bytes()
+	if len(blob) < 2 {
+		return 0
+	}
+	return storedVersion(blob)
+}
+
+// Bytes without the version: what the codec made of the object
+func (obj *LazyObject) Payload() []byte {
+	var blob = obj.Bytes()
+	if len(blob) < 2 {
+		return nil
+	}
+	return blob[2:]
+}
+
+// Decoded, as Read would return it
+func (obj *LazyObject) Object() interface{} {
+	return obj.t.readObject(obj.t.getVersion(obj.ref, false, true))
+}
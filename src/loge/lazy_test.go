@@ -0,0 +1,60 @@
+package loge
+
+import (
+	"errors"
+	"testing"
+)
+
+type countingCodec struct {
+	Codec
+	decodes int
+}
+
+func (codec *countingCodec) Unmarshal(blob []byte, obj interface{}) error {
+	codec.decodes++
+	return codec.Codec.Unmarshal(blob, obj)
+}
+
+func TestReadLazy(test *testing.T) {
+	var codec = &countingCodec{ Codec: JSONCodec }
+	var db = NewLogeDB(NewMemStore())
+	db.SetCodec(codec)
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+	db.SetOne("test", "one", &TestObj{ "One" })
+	codec.decodes = 0
+
+	db.Transact(func (t *Transaction) {
+		var obj = t.ReadLazy("test", "one")
+		if !obj.Exists() || string(obj.Payload()) != `{"Name":"One"}` || obj.Version() != 1 {
+			test.Errorf("Wrong lazy object: %q", obj.Bytes())
+		}
+		if !t.Exists("test", "one") || codec.decodes != 0 {
+			test.Errorf("Lazy object decoded %d times", codec.decodes)
+		}
+
+		if obj.Object().(*TestObj).Name != "One" || t.Read("test", "one").(*TestObj).Name != "One" {
+			test.Error("Wrong decoded object")
+		}
+		if codec.decodes != 1 {
+			test.Errorf("Lazy object decoded %d times", codec.decodes)
+		}
+
+		t.Write("test", "one").(*TestObj).Name = "Changed"
+		if string(obj.Payload()) != `{"Name":"Changed"}` {
+			test.Errorf("Bytes missing write: %q", obj.Payload())
+		}
+
+		var missing = t.ReadLazy("test", "two")
+		if missing.Exists() || missing.Bytes() != nil || missing.Object().(*TestObj) != nil {
+			test.Error("Missing object exists")
+		}
+	}, 0)
+
+	if obj := db.ReadOne("test", "one").(*TestObj); obj.Name != "Changed" {
+		test.Errorf("Write after ReadLazy lost: %v", obj)
+	}
+
+	if _, err := db.CreateTransaction().TryReadLazy("nope", "one"); !errors.Is(err, ErrNoSuchType) {
+		test.Errorf("Wrong error for TryReadLazy: %v", err)
+	}
+}
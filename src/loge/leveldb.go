@@ -1,6 +1,7 @@
 package loge
 
 import (
+	"context"
 	"fmt"
 	"bytes"
 	"encoding/binary"
@@ -13,8 +14,14 @@ import (
 const ldb_LINK_TAG uint16 = 2
 const ldb_LINK_INFO_TAG uint16 = 3
 const ldb_INDEX_TAG uint16 = 4
+const ldb_FORMAT_TAG uint16 = 5
 const ldb_START_TAG uint16 = 8
 
+const ldb_BATCH_SIZE = 1000
+
+// Bump along with an entry in ldbUpgrades whenever the layout changes
+const ldb_FORMAT_VERSION uint32 = 2
+
 
 type levelDBStore struct {
 	basePath string
@@ -22,10 +29,11 @@ type levelDBStore struct {
 	types *spack.TypeSet
 
 	writeQueue chan *levelDBContext
-	flushed bool
+	flushed chan bool
 }
 
 type levelDBResultSet struct {
+	ctx context.Context
 	it *prefixIterator
 	prefixLen int
 	next string
@@ -36,6 +44,7 @@ type levelDBResultSet struct {
 
 type levelDBContext struct {
 	ldbStore *levelDBStore
+	ctx context.Context
 	snapshot *levigo.Snapshot
 	snapshotID uint64
 	readOptions *levigo.ReadOptions
@@ -53,39 +62,182 @@ var defaultWriteOptions = levigo.NewWriteOptions()
 var defaultReadOptions = levigo.NewReadOptions()
 
 func NewLevelDBStore(basePath string) LogeStore {
+	store, err := OpenLevelDBStore(basePath)
+	if err != nil {
+		panic(err)
+	}
+	return store
+}
+
+func OpenLevelDBStore(basePath string) (store LogeStore, err error) {
+	defer recoverError(&err)
 
 	var opts = levigo.NewOptions()
 	opts.SetCreateIfMissing(true)
 	db, err := levigo.Open(basePath, opts)
 
 	if err != nil {
-		panic(fmt.Sprintf("Can't open DB at %s: %v", basePath, err))
+		return nil, storeError("Can't open DB at %s: %v", basePath, err)
 	}
 
-	var store = &levelDBStore {
+	var ldbStore = &levelDBStore {
 		basePath: basePath,
 		db: db,
 		types: spack.NewTypeSet(),
 		
 		writeQueue: make(chan *levelDBContext),
-		flushed: false,
+		flushed: make(chan bool),
 	}
 
-	store.types.LastTag = ldb_START_TAG
-	store.loadTypeMetadata()
-	go store.writer()
+	if err := ldbStore.checkFormat(); err != nil {
+		db.Close()
+		return nil, err
+	}
 
-	return store
+	ldbStore.types.LastTag = ldb_START_TAG
+	ldbStore.loadTypeMetadata()
+	go ldbStore.writer()
+
+	return ldbStore, nil
 }
 
 func (store *levelDBStore) close() {
 	store.writeQueue <- nil
-	for !store.flushed {
-		runtime.Gosched()
-	}
+	<-store.flushed
 	store.db.Close()
 }
 
+func (store *levelDBStore) compact() {
+	store.db.CompactRange(levigo.Range{})
+}
+
+// Commits overwrite, so only live snapshots can see the past
+func (store *levelDBStore) retainsVersions() bool {
+	return false
+}
+
+func (store *levelDBStore) backup(path string) error {
+	var opts = levigo.NewOptions()
+	opts.SetCreateIfMissing(true)
+	opts.SetErrorIfExists(true)
+	defer opts.Close()
+
+	target, err := levigo.Open(path, opts)
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+
+	var snapshot = store.db.NewSnapshot()
+	defer store.db.ReleaseSnapshot(snapshot)
+	var readOptions = levigo.NewReadOptions()
+	readOptions.SetSnapshot(snapshot)
+	readOptions.SetFillCache(false)
+	defer readOptions.Close()
+
+	var it = store.db.NewIterator(readOptions)
+	defer it.Close()
+
+	var wb = levigo.NewWriteBatch()
+	defer wb.Close()
+	var count = 0
+
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		wb.Put(it.Key(), it.Value())
+		count++
+		if count % ldb_BATCH_SIZE == 0 {
+			if err := target.Write(defaultWriteOptions, wb); err != nil {
+				return err
+			}
+			wb.Clear()
+		}
+	}
+
+	if err := it.GetError(); err != nil {
+		return err
+	}
+	return target.Write(defaultWriteOptions, wb)
+}
+
+func (store *levelDBStore) describe() string {
+	return fmt.Sprintf("LevelDB: %s", store.basePath)
+}
+
+func (store *levelDBStore) rebuildIndexes(db *LogeDB) int {
+	var wb = levigo.NewWriteBatch()
+	defer wb.Close()
+
+	var indexPrefix = encodeTaggedKey([]uint16{ldb_INDEX_TAG}, "")
+	var it = store.iteratePrefix(indexPrefix, []byte{}, defaultReadOptions)
+	for ; it.Valid(); it.Next() {
+		wb.Delete(it.Key())
+	}
+	it.Close()
+
+	var count = 0
+	for _, typ := range db.types {
+		for linkName := range typ.Links {
+			var prefix = []byte(makeLinkRef(typ, linkName, "").CacheKey)
+			var it = store.iteratePrefix(prefix, []byte{}, defaultReadOptions)
+			for ; it.Valid(); it.Next() {
+				var source = LogeKey(it.Key()[len(prefix):])
+				var links []string
+				spack.DecodeFromBytes(&links, db.linkTypeSpec, it.Value())
+				for _, target := range links {
+					wb.Put(encodeIndexKey(makeLinkRef(typ, linkName, LogeKey(target)), source), []byte{})
+					count++
+				}
+			}
+			it.Close()
+		}
+	}
+
+	var err = store.db.Write(defaultWriteOptions, wb)
+	if err != nil {
+		panic(storeError("Write error: %v", err))
+	}
+	return count
+}
+
+func (store *levelDBStore) truncate(typ *logeType) int {
+	var prefixes = [][]byte{ typePrefix(typ)[:2] }
+	for linkName := range typ.Links {
+		prefixes = append(prefixes,
+			encodeLDBKey(ldb_INDEX_TAG, makeLinkRef(typ, linkName, "")))
+	}
+
+	var objPrefix = typePrefix(typ)
+	var count = 0
+	for _, prefix := range prefixes {
+		var wb = levigo.NewWriteBatch()
+		var batched = 0
+		var flush = func() {
+			var err = store.db.Write(defaultWriteOptions, wb)
+			if err != nil {
+				panic(storeError("Write error: %v", err))
+			}
+			wb.Clear()
+			batched = 0
+		}
+
+		var it = store.iteratePrefix(prefix, []byte{}, defaultReadOptions)
+		for ; it.Valid(); it.Next() {
+			if bytes.HasPrefix(it.Key(), objPrefix) {
+				count++
+			}
+			wb.Delete(it.Key())
+			batched++
+			if batched == ldb_BATCH_SIZE {
+				flush()
+			}
+		}
+		it.Close()
+		flush()
+		wb.Close()
+	}
+	return count
+}
+
 func (store *levelDBStore) registerType(typ *logeType) {
 	store.tagVersions(typ)
 
@@ -108,7 +260,7 @@ func (store *levelDBStore) registerType(typ *logeType) {
 	err = store.db.Put(defaultWriteOptions, keyVal, typeVal)
 	
 	if err != nil {
-		panic(fmt.Sprintf("Couldn't write type metadata: %v\n", err))
+		panic(storeError("Couldn't write type metadata: %v", err))
 	}
 
 	vt.Dirty = false
@@ -131,6 +283,10 @@ func (rs *levelDBResultSet) Next() LogeKey {
 	if rs.closed {
 		return ""
 	}
+	if rs.ctx.Err() != nil {
+		rs.Close()
+		checkContext(rs.ctx)
+	}
 	var next = rs.next
 	rs.it.Next()
 	rs.count++
@@ -156,6 +312,9 @@ func (rs *levelDBResultSet) All() []LogeKey {
 }
 
 func (rs *levelDBResultSet) Close() {
+	if rs.closed {
+		return
+	}
 	rs.it.Close()
 	rs.closed = true
 }
@@ -165,12 +324,13 @@ func (rs *levelDBResultSet) Close() {
 // Transaction Contexts
 // -----------------------------------------------
 
-func (store *levelDBStore) newContext(sID uint64) transactionContext {
+func (store *levelDBStore) newContext(ctx context.Context, sID uint64) transactionContext {
 	var snapshot = store.db.NewSnapshot()
 	var options = levigo.NewReadOptions()
 	options.SetSnapshot(snapshot)
 	return &levelDBContext{
 		ldbStore: store,
+		ctx: ctx,
 		readOptions: options,
 		snapshot: snapshot,
 		snapshotID: sID,
@@ -188,7 +348,7 @@ func (store *levelDBStore) writer() {
 		}
 		context.result<- context.Write()
 	}
-	store.flushed = true
+	close(store.flushed)
 }
 
 
@@ -232,15 +392,29 @@ func (context *levelDBContext) Write() error {
 // -----------------------------------------------
 
 func (context *levelDBContext) get(ref objRef) []byte {
+	checkContext(context.ctx)
 	val, err := context.ldbStore.db.Get(context.readOptions, []byte(ref.CacheKey))
 
 	if err != nil {
-		panic(fmt.Sprintf("Read error: %v\n", err))
+		panic(storeError("Read error: %v", err))
 	}
 
 	return val
 }
 
+// Seeks rather than Gets, so the value isn't read
+func (context *levelDBContext) contains(ref objRef) bool {
+	checkContext(context.ctx)
+	var key = []byte(ref.CacheKey)
+	var it = context.ldbStore.db.NewIterator(context.readOptions)
+	defer it.Close()
+	it.Seek(key)
+	if err := it.GetError(); err != nil {
+		panic(storeError("Read error: %v", err))
+	}
+	return it.Valid() && bytes.Equal(it.Key(), key)
+}
+
 func (context *levelDBContext) store(ref objRef, enc []byte) error {
 	var key = []byte(ref.CacheKey)
 
@@ -265,50 +439,43 @@ func (context *levelDBContext) remIndex(ref objRef, source LogeKey) {
 }
 
 func (context *levelDBContext) find(ref objRef) ResultSet {
-	return context.findSlice(ref, "", -1)
+	return context.findSlice(ref, "", "", -1)
 }
 
-func (context *levelDBContext) findSlice(ref objRef, from LogeKey, limit int) ResultSet {
-	if limit == 0 {
-		return &levelDBResultSet {
-			closed: true,
-		}
-	}
-
+func (context *levelDBContext) findSlice(ref objRef, keyPrefix LogeKey, from LogeKey, limit int) ResultSet {
 	var prefix = append(
 		encodeLDBKey(ldb_INDEX_TAG, ref),
 		0)
-
-	var it = context.ldbStore.iteratePrefix(prefix, []byte(from), context.readOptions)
-	if !it.Valid() {
-		it.Close()
-		return &levelDBResultSet {
-			closed: true,
-		}
-	}
-
-	var prefixLen = len(prefix)
-	var next = string(it.Key()[prefixLen:])
-
-	return &levelDBResultSet{
-		it: it,
-		prefixLen: prefixLen,
-		next: next,
-		closed: false,
-		limit: limit,
-		count: 0,
-	}
+	return context.ldbStore.slice(context.ctx, prefix, keyPrefix, from, limit, context.readOptions)
 }
 
+func (context *levelDBContext) listSlice(typePrefix []byte, keyPrefix LogeKey, from LogeKey, limit int) ResultSet {
+	return context.ldbStore.slice(context.ctx, typePrefix, keyPrefix, from, limit, context.readOptions)
+}
 
-func (context *levelDBContext) listSlice(prefix []byte, from LogeKey, limit int) ResultSet {
+// Keys under prefix which start with keyPrefix, after from
+func (store *levelDBStore) slice(ctx context.Context, prefix []byte, keyPrefix LogeKey, from LogeKey, limit int, readOptions *levigo.ReadOptions) ResultSet {
+	checkContext(ctx)
 	if limit == 0 {
 		return &levelDBResultSet {
 			closed: true,
 		}
 	}
 
-	var it = context.ldbStore.iteratePrefix(prefix, []byte(from), context.readOptions)
+	if from != "" && !from.HasPrefix(keyPrefix) {
+		if from > keyPrefix {
+			return &levelDBResultSet {
+				closed: true,
+			}
+		}
+		from = ""
+	}
+	if from != "" {
+		from = from[len(keyPrefix):]
+	}
+
+	var fullPrefix = append(append([]byte{}, prefix...), keyPrefix...)
+	var it = store.iteratePrefix(fullPrefix, []byte(from), readOptions)
 	if !it.Valid() {
 		it.Close()
 		return &levelDBResultSet {
@@ -320,6 +487,7 @@ func (context *levelDBContext) listSlice(prefix []byte, from LogeKey, limit int)
 	var next = string(it.Key()[prefixLen:])
 
 	return &levelDBResultSet{
+		ctx: ctx,
 		it: it,
 		prefixLen: prefixLen,
 		next: next,
@@ -357,7 +525,7 @@ func (store *levelDBStore) loadTypeMetadata() {
 		var typeInfo, _, err = typeType.DecodeObj(it.Value(), false)
 
 		if err != nil {
-			panic(fmt.Sprintf("Error loading type info: %v", err))
+			panic(storeError("Error loading type info: %v", err))
 		}
 
 		store.types.LoadType(typeInfo.(*spack.VersionedType))
@@ -370,36 +538,117 @@ func (store *levelDBStore) tagVersions(typ *logeType) {
 	var it = store.iteratePrefix(prefix, []byte{}, defaultReadOptions)
 	defer it.Close()
 
+	var stored = 0
 	for it = it; it.Valid(); it.Next() {
 		var info = &linkInfo{}
 		spack.DecodeFromBytes(info, linkInfoSpec, it.Value())
 		typ.Links[info.Name] = info
+		stored++
 	}
 
-	var maxTag uint16 = 0;
-	var missing = make([]*linkInfo, 0)
-
-	for _, info := range typ.Links {
-		if info.Tag > maxTag {
-			maxTag = info.Tag
-		}
-		if info.Tag == 0 {
-			missing = append(missing, info)
-		}
+	if stored == 0 && len(typ.Links) > 1 && store.hasSharedLinks(typ) {
+		panic(fmt.Errorf("%w: %s's links in %s share one key, from before format 2",
+			ErrIncompatibleFormat, typ.Name, store.basePath))
 	}
 
-	for _, info := range missing {
-		maxTag++
-		info.Tag = maxTag
+	for _, info := range tagLinks(typ) {
 		var key = encodeTaggedKey([]uint16{ldb_LINK_INFO_TAG, vt.Tag}, info.Name)
 		enc, _ := spack.EncodeToBytes(info, linkInfoSpec)
 		fmt.Printf("Updating link: %s::%s (%d)\n", typ.Name, info.Name, info.Tag)
 		var err = store.db.Put(defaultWriteOptions, key, enc)
 		if err != nil {
-			panic(fmt.Sprintf("Write error: %v\n", err))
+			panic(storeError("Write error: %v", err))
+		}
+	}
+
+}
+
+// -----------------------------------------------
+// Format versioning
+// -----------------------------------------------
+
+// Upgrades from each older format to the next. Databases from before
+// the format was stamped are version 0, and laid out like version 1.
+//
+// Version 1 tagged all of a type's links 1, so a type's link sets
+// shared one key, and stored no link infos. Version 2 tags each link.
+// Types with one link read the same either way; tagVersions refuses
+// types with more whose links were written under the shared tag.
+var ldbUpgrades = map[uint32]func(*levelDBStore) error{
+	0: func(store *levelDBStore) error { return nil },
+	1: func(store *levelDBStore) error { return nil },
+}
+
+var ldbFormatKey = encodeTaggedKey([]uint16{ldb_FORMAT_TAG}, "")
+
+// Stamps new databases, upgrades old ones, and refuses ones written by
+// a newer loge rather than misreading them
+func (store *levelDBStore) checkFormat() error {
+	var version, err = store.formatVersion()
+	if err != nil {
+		return err
+	}
+
+	if version > ldb_FORMAT_VERSION {
+		return fmt.Errorf("%w: %s is format %d, this loge reads up to %d",
+			ErrIncompatibleFormat, store.basePath, version, ldb_FORMAT_VERSION)
+	}
+
+	for version < ldb_FORMAT_VERSION {
+		fmt.Printf("Upgrading store format: %d -> %d\n", version, version + 1)
+		if err := ldbUpgrades[version](store); err != nil {
+			return storeError("Upgrade from format %d failed: %v", version, err)
+		}
+		version++
+		if err := store.setFormatVersion(version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (store *levelDBStore) formatVersion() (uint32, error) {
+	val, err := store.db.Get(defaultReadOptions, ldbFormatKey)
+	if err != nil {
+		return 0, storeError("Read error: %v", err)
+	}
+
+	if val == nil {
+		if store.isEmpty() {
+			return ldb_FORMAT_VERSION, store.setFormatVersion(ldb_FORMAT_VERSION)
 		}
+		return 0, nil
 	}
 
+	if len(val) != 4 {
+		return 0, fmt.Errorf("%w: unreadable format stamp %x", ErrIncompatibleFormat, val)
+	}
+	return binary.BigEndian.Uint32(val), nil
+}
+
+func (store *levelDBStore) setFormatVersion(version uint32) error {
+	var val = make([]byte, 4)
+	binary.BigEndian.PutUint32(val, version)
+	if err := store.db.Put(defaultWriteOptions, ldbFormatKey, val); err != nil {
+		return storeError("Write error: %v", err)
+	}
+	return nil
+}
+
+// Whether a type has links stored under tag 1 without link infos,
+// which only format 1 writes
+func (store *levelDBStore) hasSharedLinks(typ *logeType) bool {
+	var prefix = []byte(encodeKey(encodeTypeTag(typ) | 1, ""))
+	var it = store.iteratePrefix(prefix, []byte{}, defaultReadOptions)
+	defer it.Close()
+	return it.Valid()
+}
+
+func (store *levelDBStore) isEmpty() bool {
+	var it = store.db.NewIterator(defaultReadOptions)
+	defer it.Close()
+	it.SeekToFirst()
+	return !it.Valid()
 }
 
 // -----------------------------------------------
@@ -448,10 +697,10 @@ type prefixIterator struct {
 
 func (store *levelDBStore) iteratePrefix(prefix []byte, from []byte, readOptions *levigo.ReadOptions) *prefixIterator {
 	var it = store.db.NewIterator(readOptions)
-	var seekPrefix = append(prefix, from...)
+	var seekPrefix = append(append([]byte{}, prefix...), from...)
 	it.Seek(seekPrefix)
 
-	if len(from) > 0 && it.Valid() {
+	if len(from) > 0 && it.Valid() && bytes.Equal(it.Key(), seekPrefix) {
 		it.Next()
 	}
 
@@ -0,0 +1,93 @@
+package loge
+
+import (
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestFormatVersion(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "loge-format")
+	defer os.RemoveAll(dir)
+
+	var store = NewLevelDBStore(dir).(*levelDBStore)
+	if version, _ := store.formatVersion(); version != ldb_FORMAT_VERSION {
+		test.Errorf("New store not stamped: %d", version)
+	}
+	var db = NewLogeDB(store)
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+	db.SetOne("test", "one", &TestObj{ "One" })
+
+	// Unstamped, as written before versioning
+	store.db.Delete(defaultWriteOptions, ldbFormatKey)
+	db.Close()
+
+	store = NewLevelDBStore(dir).(*levelDBStore)
+	if version, _ := store.formatVersion(); version != ldb_FORMAT_VERSION {
+		test.Errorf("Old store not upgraded: %d", version)
+	}
+	db = NewLogeDB(store)
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+	if db.ReadOne("test", "one").(*TestObj).Name != "One" {
+		test.Error("Data lost in upgrade")
+	}
+
+	var newer = make([]byte, 4)
+	binary.BigEndian.PutUint32(newer, ldb_FORMAT_VERSION + 1)
+	store.db.Put(defaultWriteOptions, ldbFormatKey, newer)
+	db.Close()
+
+	var _, err = OpenLevelDBStore(dir)
+	if !errors.Is(err, ErrIncompatibleFormat) {
+		test.Errorf("Opened newer format: %v", err)
+	}
+}
+
+// Format 1 stored every link of a type under tag 1, without link infos
+func TestSharedLinkFormat(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "loge-format")
+	defer os.RemoveAll(dir)
+
+	var store = NewLevelDBStore(dir).(*levelDBStore)
+	var db = NewLogeDB(store)
+	var def = NewTypeDef("test", 1, &TestObj{})
+	def.Links = LinkSpec{ "friends": "test" }
+	db.CreateType(def)
+	db.Transact(func (t *Transaction) {
+		t.AddLink("test", "friends", "one", "two")
+	}, 0)
+
+	var version = make([]byte, 4)
+	binary.BigEndian.PutUint32(version, 1)
+	store.db.Put(defaultWriteOptions, ldbFormatKey, version)
+	var infos = store.iteratePrefix(encodeTaggedKey([]uint16{ ldb_LINK_INFO_TAG }, ""), []byte{}, defaultReadOptions)
+	for ; infos.Valid(); infos.Next() {
+		store.db.Delete(defaultWriteOptions, infos.Key())
+	}
+	infos.Close()
+	db.Close()
+
+	// One link reads as it did
+	store = NewLevelDBStore(dir).(*levelDBStore)
+	if version, _ := store.formatVersion(); version != ldb_FORMAT_VERSION {
+		test.Errorf("Store not upgraded: %d", version)
+	}
+	db = NewLogeDB(store)
+	var typ = db.CreateType(def)
+	if links := db.ReadLinksOne("test", "friends", "one"); len(links) != 1 || links[0] != "two" {
+		test.Errorf("Wrong links after upgrade: %v", links)
+	}
+	store.db.Delete(defaultWriteOptions, encodeTaggedKey([]uint16{ ldb_LINK_INFO_TAG, typ.SpackType.Tag }, "friends"))
+	db.Close()
+
+	// More share one key, and can't be told apart
+	def = NewTypeDef("test", 1, &TestObj{})
+	def.Links = LinkSpec{ "friends": "test", "enemies": "test" }
+	db = NewLogeDB(NewLevelDBStore(dir))
+	defer db.Close()
+	if _, err := db.TryCreateType(def); !errors.Is(err, ErrIncompatibleFormat) {
+		test.Errorf("Registered shared links: %v", err)
+	}
+}
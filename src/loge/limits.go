@@ -0,0 +1,70 @@
+package loge
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrTooLarge = errors.New("Transaction too large")
+
+// Caps on what one transaction holds, zero for none, so a runaway one
+// fails rather than taking memory without bound. Once it holds
+// MaxObjects objects and link sets, read or written, or MaxBytes of
+// them, writes which would add another panic with ErrTooLarge; those to
+// objects it already holds go ahead.
+type TransactionLimits struct {
+	MaxObjects int
+	MaxBytes int
+}
+
+// Bytes is an estimate: keys, and objects' stored forms where they were
+// loaded. Objects only Set aren't encoded until commit, so count just
+// their keys.
+type TransactionSize struct {
+	Objects int
+	Dirty int
+	Bytes int
+}
+
+// For transactions created from now on
+func (db *LogeDB) SetTransactionLimits(limits TransactionLimits) {
+	db.limits = limits
+}
+
+func (db *LogeDB) TransactionLimits() TransactionLimits {
+	return db.limits
+}
+
+// Overrides the DB's limits for this transaction
+func (t *Transaction) SetLimits(limits TransactionLimits) {
+	t.limits = limits
+}
+
+func (t *Transaction) Size() TransactionSize {
+	var dirty = 0
+	for _, lv := range t.versions {
+		if lv.dirty {
+			dirty++
+		}
+	}
+	return TransactionSize{
+		Objects: len(t.versions),
+		Dirty: dirty,
+		Bytes: t.bytes,
+	}
+}
+
+func (t *Transaction) countVersion(objKey string, version *objectVersion) {
+	t.bytes += len(objKey) + len(version.Blob)
+}
+
+// Before writes adding objects
+func (t *Transaction) checkLimits(adding int) {
+	var limits = t.limits
+	if limits.MaxObjects > 0 && len(t.versions) + adding > limits.MaxObjects {
+		panic(fmt.Errorf("%w: %s over %d objects", ErrTooLarge, t, limits.MaxObjects))
+	}
+	if limits.MaxBytes > 0 && t.bytes >= limits.MaxBytes {
+		panic(fmt.Errorf("%w: %s over %d bytes", ErrTooLarge, t, limits.MaxBytes))
+	}
+}
@@ -0,0 +1,51 @@
+package loge
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestTransactionLimits(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+	db.SetOne("test", "one", &TestObj{ "One" })
+	db.SetTransactionLimits(TransactionLimits{ MaxObjects: 3 })
+
+	var t = db.CreateTransaction()
+	t.Read("test", "one")
+	t.Set("test", "two", &TestObj{ "Two" })
+	t.Set("test", "three", &TestObj{ "Three" })
+	if err := t.TrySet("test", "four", &TestObj{ "Four" }); !errors.Is(err, ErrTooLarge) {
+		test.Errorf("Write over limit allowed: %v", err)
+	}
+	if _, err := t.TryWrite("test", "one"); err != nil {
+		test.Errorf("Write to held object refused: %v", err)
+	}
+
+	var size = t.Size()
+	if size.Objects != 3 || size.Dirty != 3 || size.Bytes <= len("one") {
+		test.Errorf("Wrong size: %+v", size)
+	}
+	if !t.Commit() {
+		test.Error("Transaction at limit not committed")
+	}
+
+	var batch = NewBatch()
+	for i := 0; i < 4; i++ {
+		batch.Set("test", LogeKey(fmt.Sprintf("batch-%d", i)), &TestObj{ "Batch" })
+	}
+	if _, err := db.TryTransact(func (t *Transaction) {
+		t.Apply(batch)
+	}, 0); !errors.Is(err, ErrTooLarge) {
+		test.Errorf("Batch over limit applied: %v", err)
+	}
+
+	t = db.CreateTransaction()
+	t.SetLimits(TransactionLimits{ MaxBytes: 1 })
+	t.Read("test", "one")
+	if err := t.TrySet("test", "five", &TestObj{ "Five" }); !errors.Is(err, ErrTooLarge) {
+		test.Errorf("Write over byte limit allowed: %v", err)
+	}
+	t.Abort()
+}
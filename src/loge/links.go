@@ -2,9 +2,11 @@ package loge
 
 import (
 	"sort"
+
+	"logelinks"
 )
 
-type linkList []string
+type linkList []LogeKey
 type LinkSpec map[string]string
 
 type linkInfo struct {
@@ -13,104 +15,54 @@ type linkInfo struct {
 	Tag uint16
 }
 
-func (links linkList) Has(key string) bool {
-	var i = sort.SearchStrings(links, key)
-	return i < len(links) && links[i] == key
-}
-
-func (links linkList) Add(key string) linkList {
-	if links.Has(key) {
-		return links
+// Gives links without a tag the next free ones, in name order, and
+// returns them. Tags tell a type's links apart in the store.
+func tagLinks(typ *logeType) []*linkInfo {
+	var maxTag uint16 = 0
+	var missing = make([]*linkInfo, 0)
+	for _, info := range typ.Links {
+		if info.Tag > maxTag {
+			maxTag = info.Tag
+		}
+		if info.Tag == 0 {
+			missing = append(missing, info)
+		}
 	}
 
-	var newLinks = append(links, key)
-	sort.Strings(newLinks)
-	return newLinks
-}
-
-func (links linkList) Remove(key string) linkList {
-	var i = sort.SearchStrings(links, key)
-	if i >= len(links) || links[i] != key {
-		return links
+	sort.Slice(missing, func(i, j int) bool { return missing[i].Name < missing[j].Name })
+	for _, info := range missing {
+		maxTag++
+		info.Tag = maxTag
 	}
-	return append(links[:i], links[i+1:]...)
-}
-
-
-
-type linkSet struct {
-	Original linkList `loge:"keep"`
-	Added linkList
-	Removed linkList
+	return missing
 }
 
+func (links linkList) Len() int { return len(links) }
+func (links linkList) Less(i, j int) bool { return links[i] < links[j] }
+func (links linkList) Swap(i, j int) { links[i], links[j] = links[j], links[i] }
 
-func newLinkSet() *linkSet {
-	return &linkSet{
+// Stored as plain strings
+func (links linkList) strings() []string {
+	var strs = make([]string, len(links))
+	for i, key := range links {
+		strs[i] = string(key)
 	}
+	return strs
 }
 
-
-func (ls *linkSet) NewVersion() *linkSet {
-	return &linkSet{
-		Original: ls.Original,
+func storedLinks(strs []string) linkList {
+	var links = make(linkList, len(strs))
+	for i, str := range strs {
+		links[i] = LogeKey(str)
 	}
+	return links
 }
 
 
-func (ls *linkSet) Freeze() {
-	ls.Original = ls.ReadKeys()
-	ls.Added = nil
-	ls.Removed = nil
-}
-
-
-
-func (ls *linkSet) Set(keys []string) {
-	// XXX BGH TODO: Delta this
-	sort.Strings(keys)	
-	ls.Removed = ls.Original
-	ls.Added = keys
-}
 
+// Links from one object, with the transaction's changes to them
+type linkSet = logelinks.Set[LogeKey]
 
-func (ls *linkSet) Add(key string) {
-	ls.Removed = ls.Removed.Remove(key)
-	if !ls.Original.Has(key) {
-		ls.Added = ls.Added.Add(key)
-	}
-}
-
-func (ls *linkSet) Remove(key string) {
-	// XXX BGH Hrgh
-	if (!ls.Original.Has(key) && !ls.Added.Has(key)) || ls.Removed.Has(key) {
-		return
-	}
-
-	ls.Added = ls.Added.Remove(key)
-	ls.Removed = ls.Removed.Add(key)
-}
-
-func (ls *linkSet) ReadKeys() []string {
-	var keys []string
-
-	for _, key := range ls.Original {
-		if !ls.Removed.Has(key) {
-			keys = append(keys, key)
-		}
-	}
-
-	keys = append(keys, ls.Added...)
-
-	sort.Strings(keys)
-	return keys
-}
-
-func (ls *linkSet) Has(key string) bool {
-	if ls.Removed.Has(key) {
-		return false;
-	}
-	
-	return ls.Added.Has(key) || ls.Original.Has(key)
+func newLinkSet() *linkSet {
+	return &linkSet{}
 }
-
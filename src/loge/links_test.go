@@ -3,6 +3,7 @@ package loge
 import (
 	"testing"
 	"sort"
+	"reflect"
 )
 
 func TestLinks(t *testing.T) {
@@ -12,21 +13,21 @@ func TestLinks(t *testing.T) {
 	children.Add("one")
 	children.Add("two")
 
-	if !compareSets(children.ReadKeys(), []string{"one", "two"}) {
+	if !compareSets(children.ReadKeys(), []LogeKey{"one", "two"}) {
 		t.Errorf("Wrong keys after adds: %v",
 			children.ReadKeys())
 	}
 
-	children.Set([]string{"three", "four"})
+	children.Set([]LogeKey{"three", "four"})
 
-	if !compareSets(children.ReadKeys(), []string{"three", "four"}) {
+	if !compareSets(children.ReadKeys(), []LogeKey{"three", "four"}) {
 		t.Errorf("Wrong keys after set: %v",
 			children.ReadKeys())
 	}
 
 	children.Add("five")
 
-	if !compareSets(children.ReadKeys(), []string{"three", "four", "five"}) {
+	if !compareSets(children.ReadKeys(), []LogeKey{"three", "four", "five"}) {
 		t.Errorf("Wrong keys after set+add: %v",
 			children.ReadKeys())
 	}
@@ -110,15 +111,47 @@ func TestLinkScoping(test *testing.T) {
 	}, 0)
 }
 
-func compareSets(a []string, b[]string) bool {
-	var sa = make([]string, len(a))
+func TestReadKeysMerge(t *testing.T) {
+	var links = &linkSet{ Original: linkList{"b", "d", "f"} }
+
+	if testing.AllocsPerRun(10, func() { links.ReadKeys() }) != 0 {
+		t.Error("ReadKeys allocated with no changes")
+	}
+
+	links.Add("a")
+	links.Add("e")
+	links.Add("g")
+	links.Remove("d")
+
+	var keys = links.ReadKeys()
+	if !reflect.DeepEqual(keys, []LogeKey{"a", "b", "e", "f", "g"}) {
+		t.Errorf("Wrong merged keys: %v", keys)
+	}
+
+	if testing.AllocsPerRun(10, func() { links.ReadKeys() }) != 0 {
+		t.Error("ReadKeys allocated with cached merge")
+	}
+
+	links.Remove("a")
+	if links.Has("a") || !reflect.DeepEqual(links.ReadKeys(), []LogeKey{"b", "e", "f", "g"}) {
+		t.Errorf("Stale keys after removal: %v", links.ReadKeys())
+	}
+
+	links.Set([]LogeKey{"f", "z"})
+	if !reflect.DeepEqual(links.ReadKeys(), []LogeKey{"f", "z"}) {
+		t.Errorf("Wrong keys after set: %v", links.ReadKeys())
+	}
+}
+
+func compareSets(a []LogeKey, b []LogeKey) bool {
+	var sa = make([]LogeKey, len(a))
 	copy(sa, a)
 
-	var sb = make([]string, len(b))
+	var sb = make([]LogeKey, len(b))
 	copy(sb, b)
 
-	sort.Strings(sa)
-	sort.Strings(sb)
+	sort.Sort(linkList(sa))
+	sort.Sort(linkList(sb))
 
 	if len(sa) != len(sb) {
 		return false
@@ -148,4 +181,100 @@ func dumplinkSet(t *testing.T, ls *linkSet) {
 	for k, v := range ls.Removed {
 		t.Logf("%s => %v\n", k, v)
 	}
-}
\ No newline at end of file
+}
+func TestReadLinksPage(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+
+	var def = NewTypeDef("test", 1, &TestObj{})
+	def.Links = LinkSpec{ "sibling": "test" }
+	db.CreateType(def)
+
+	db.Transact(func (t *Transaction) {
+		t.SetLinks("test", "sibling", "one", []LogeKey{ "a", "c", "e", "g" })
+	}, 0)
+
+	db.Transact(func (t *Transaction) {
+		t.AddLink("test", "sibling", "one", "d")
+		t.RemoveLink("test", "sibling", "one", "e")
+
+		var pages [][]LogeKey
+		var page = t.ReadLinksPage("test", "sibling", "one", "", 2)
+		for ; len(page) > 0; page = t.ReadLinksPage("test", "sibling", "one", page[len(page) - 1], 2) {
+			pages = append(pages, page)
+		}
+		var expected = [][]LogeKey{ { "a", "c" }, { "d", "g" } }
+		if !reflect.DeepEqual(pages, expected) {
+			test.Errorf("Wrong pages: %v", pages)
+		}
+
+		if rest := t.ReadLinksPage("test", "sibling", "one", "b", -1); !reflect.DeepEqual(rest, []LogeKey{ "c", "d", "g" }) {
+			test.Errorf("Wrong unlimited page: %v", rest)
+		}
+	}, 0)
+}
+
+func TestLinkPagesShareDecodedLinks(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+
+	var def = NewTypeDef("test", 1, &TestObj{})
+	def.Links = LinkSpec{ "sibling": "test" }
+	db.CreateType(def)
+
+	db.Transact(func (t *Transaction) {
+		t.SetLinks("test", "sibling", "one", []LogeKey{ "a", "b", "c" })
+	}, 0)
+
+	var first = db.CreateTransaction()
+	defer first.Abort()
+	var second = db.CreateTransaction()
+	defer second.Abort()
+
+	var page = first.ReadLinksPage("test", "sibling", "one", "", 2)
+	var again = second.ReadLinksPage("test", "sibling", "one", "", 2)
+	if !reflect.DeepEqual(page, again) || &page[0] != &again[0] {
+		test.Errorf("Links decoded again: %v, %v", page, again)
+	}
+}
+
+func TestLinkCount(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+
+	var def = NewTypeDef("test", 1, &TestObj{})
+	def.Links = LinkSpec{ "sibling": "test" }
+	db.CreateType(def)
+
+	db.Transact(func (t *Transaction) {
+		if count := t.LinkCount("test", "sibling", "one"); count != 0 {
+			test.Errorf("Wrong count with no links: %d", count)
+		}
+		t.SetLinks("test", "sibling", "one", []LogeKey{ "a", "b", "c" })
+	}, 0)
+
+	db.Transact(func (t *Transaction) {
+		if count := t.LinkCount("test", "sibling", "one"); count != 3 {
+			test.Errorf("Wrong stored count: %d", count)
+		}
+		t.AddLink("test", "sibling", "one", "d")
+		t.AddLink("test", "sibling", "one", "a")
+		t.RemoveLink("test", "sibling", "one", "b")
+		if count := t.LinkCount("test", "sibling", "one"); count != 3 {
+			test.Errorf("Wrong count with changes: %d", count)
+		}
+	}, 0)
+
+	// Counted from the committed set, not by decoding it again
+	var holder = db.CreateTransaction()
+	defer holder.Abort()
+	holder.LinkCount("test", "sibling", "one")
+	db.Transact(func (t *Transaction) {
+		t.AddLink("test", "sibling", "one", "e")
+	}, 0)
+	var ref = db.makeLinkRef("test", "sibling", "one")
+	if keys := db.cache[ref.String()].Current.links.Load(); keys == nil || len(*keys) != 4 {
+		test.Errorf("Committed links not kept: %v", keys)
+	}
+
+	if _, err := db.CreateTransaction().TryLinkCount("test", "nothing", "one"); err == nil {
+		test.Error("Count of unknown link")
+	}
+}
@@ -5,33 +5,29 @@ import (
 	"runtime"
 )
 
-const (
-	lock_UNLOCKED = 0
-	lock_LOCKED = 1
-)
-
 type lockToken struct{}
 
 var _lock_token struct{}
 
+// Ticket lock: waiters are served in the order they arrived, so a
+// transaction queued on a hot object can't be starved by newcomers.
 type spinLock struct {
-	lock int32
+	next uint32
+	serving uint32
 }
 
 func (lock *spinLock) TryLock() bool {
-	return atomic.CompareAndSwapInt32(
-		&lock.lock, lock_UNLOCKED, lock_LOCKED)
+	var serving = atomic.LoadUint32(&lock.serving)
+	return atomic.CompareAndSwapUint32(&lock.next, serving, serving + 1)
 }
 
 func (lock *spinLock) SpinLock() {
-	for {
-		if lock.TryLock() {
-			return
-		}
+	var ticket = atomic.AddUint32(&lock.next, 1) - 1
+	for atomic.LoadUint32(&lock.serving) != ticket {
 		runtime.Gosched()
 	}
 }
 
 func (lock *spinLock) Unlock() {
-	lock.lock = lock_UNLOCKED
+	atomic.AddUint32(&lock.serving, 1)
 }
@@ -0,0 +1,46 @@
+package loge
+
+import (
+	"testing"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+func TestLockFairness(test *testing.T) {
+	var lock spinLock
+	lock.SpinLock()
+
+	var order = make(chan int, 3)
+	var group sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		group.Add(1)
+		go func(i int) {
+			lock.SpinLock()
+			order <- i
+			lock.Unlock()
+			group.Done()
+		}(i)
+
+		// Wait for the goroutine to take its ticket
+		for atomic.LoadUint32(&lock.next) != uint32(i + 2) {
+			runtime.Gosched()
+		}
+	}
+
+	if lock.TryLock() {
+		test.Error("TryLock jumped the queue")
+	}
+
+	lock.Unlock()
+	group.Wait()
+	close(order)
+
+	var expected = 0
+	for i := range order {
+		if i != expected {
+			test.Errorf("Lock served out of order: %d (expected %d)", i, expected)
+		}
+		expected++
+	}
+}
@@ -0,0 +1,744 @@
+package loge
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/brendonh/spack"
+)
+
+// A single file of records, each appended whole:
+//
+//   header   "LOGE" uint32 format
+//   record   uint32 length, uint32 crc32, payload
+//
+// Payloads start with a kind byte. Commits carry cache key / value
+// pairs, an empty value for a delete; type records carry spack type
+// info; truncates carry the half of the tag shared by a type's objects
+// and links. Memory only holds where each value is, so reads go to the
+// file.
+const log_COMMIT = 'C'
+const log_TYPE = 'T'
+const log_TRUNCATE = 'X'
+
+const log_FORMAT_VERSION uint32 = 1
+
+const log_HEADER_SIZE = 8
+
+// Compaction writes commits of about this size
+const log_BATCH_SIZE = 1 << 20
+
+var logMagic = []byte("LOGE")
+
+type LogStoreOptions struct {
+	// Sync the file after each commit
+	SyncWrites bool
+	// Compact once this fraction of the file is superseded versions...
+	CompactRatio float64
+	// ...and the file is at least this big
+	CompactMinBytes int64
+}
+
+var DefaultLogStoreOptions = LogStoreOptions{
+	SyncWrites: true,
+	CompactRatio: 0.5,
+	CompactMinBytes: 16 << 20,
+}
+
+
+type logVersion struct {
+	snapshotID uint64
+	offset int64
+	size int
+}
+
+type logVersionHistory []logVersion
+
+type logStore struct {
+	path string
+	opts LogStoreOptions
+	types *spack.TypeSet
+
+	lock sync.RWMutex
+	file *os.File
+	size int64
+	liveBytes int64
+	objects map[string]logVersionHistory
+	typeRecords map[string][]byte
+
+	// Snapshot IDs of open contexts, which compaction has to keep
+	// versions for
+	contexts map[uint64]int
+
+	// Held for a whole compaction, and by anything which can't have the
+	// file swapped under it
+	compactLock sync.Mutex
+	wake chan bool
+	stop chan bool
+	done chan bool
+}
+
+type logContext struct {
+	lstore *logStore
+	ctx context.Context
+	snapshotID uint64
+	writes []memWriteEntry
+	finished bool
+}
+
+// Writes are appends and reads are one seek, at the cost of keeping
+// every key in memory. A background compactor rewrites the file without
+// superseded versions once enough of it is garbage.
+//
+// Find and List aren't supported.
+func NewLogStore(path string, opts *LogStoreOptions) LogeStore {
+	store, err := OpenLogStore(path, opts)
+	if err != nil {
+		panic(err)
+	}
+	return store
+}
+
+func OpenLogStore(path string, opts *LogStoreOptions) (store LogeStore, err error) {
+	defer recoverError(&err)
+
+	if opts == nil {
+		opts = &DefaultLogStoreOptions
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR | os.O_CREATE, 0644)
+	if err != nil {
+		return nil, storeError("Can't open log at %s: %v", path, err)
+	}
+
+	var logStore = &logStore{
+		path: path,
+		opts: *opts,
+		types: spack.NewTypeSet(),
+		file: file,
+		objects: make(map[string]logVersionHistory),
+		typeRecords: make(map[string][]byte),
+		contexts: make(map[uint64]int),
+		wake: make(chan bool, 1),
+		stop: make(chan bool),
+		done: make(chan bool),
+	}
+
+	if err := logStore.replay(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	go logStore.compactor()
+	return logStore, nil
+}
+
+func (store *logStore) close() {
+	close(store.stop)
+	<-store.done
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	store.file.Sync()
+	store.file.Close()
+}
+
+func (store *logStore) compact() {
+	if err := store.rewrite(); err != nil {
+		panic(storeError("Compaction error: %v", err))
+	}
+}
+
+// Compaction drops superseded versions no open context needs
+func (store *logStore) retainsVersions() bool {
+	return false
+}
+
+// The log up to the last commit, so a valid log itself
+func (store *logStore) backup(path string) error {
+	store.compactLock.Lock()
+	defer store.compactLock.Unlock()
+
+	store.lock.RLock()
+	var size = store.size
+	store.lock.RUnlock()
+
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, io.NewSectionReader(store.file, 0, size)); err != nil {
+		return err
+	}
+	return out.Sync()
+}
+
+func (store *logStore) describe() string {
+	return fmt.Sprintf("Log: %s", store.path)
+}
+
+// No indexes to rebuild
+func (store *logStore) rebuildIndexes(db *LogeDB) int {
+	return 0
+}
+
+func (store *logStore) truncate(typ *logeType) int {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	var prefix = string(typePrefix(typ))
+	var payload = append([]byte{ log_TRUNCATE }, prefix[:2]...)
+	if err := store.append(payload); err != nil {
+		panic(storeError("Write error: %v", err))
+	}
+
+	var count = 0
+	for cacheKey, mvh := range store.objects {
+		// Objects and links of a type share the top half of the tag
+		if cacheKey[:2] != prefix[:2] {
+			continue
+		}
+		if cacheKey[:4] == prefix {
+			count++
+		}
+		store.liveBytes -= mvh.latest().bytes(cacheKey)
+		delete(store.objects, cacheKey)
+	}
+	return count
+}
+
+func (store *logStore) registerType(typ *logeType) {
+	registerTypeInfo(store.types, typ, func(name string, info []byte) error {
+		var payload = append([]byte{ log_TYPE }, info...)
+		store.lock.Lock()
+		defer store.lock.Unlock()
+		if err := store.append(payload); err != nil {
+			return err
+		}
+		store.typeRecords[name] = payload
+		return nil
+	})
+}
+
+func (store *logStore) getSpackType(name string) *spack.VersionedType {
+	return store.types.RegisterType(name)
+}
+
+
+// -----------------------------------------------
+// Transaction Contexts
+// -----------------------------------------------
+
+func (store *logStore) newContext(ctx context.Context, sID uint64) transactionContext {
+	store.lock.Lock()
+	store.contexts[sID]++
+	store.lock.Unlock()
+
+	return &logContext{
+		lstore: store,
+		ctx: ctx,
+		snapshotID: sID,
+	}
+}
+
+func (context *logContext) getSnapshotID() uint64 {
+	return context.snapshotID
+}
+
+func (context *logContext) commit(sID uint64) error {
+	var store = context.lstore
+	defer context.finish()
+	if len(context.writes) == 0 {
+		return nil
+	}
+
+	var payload = []byte{ log_COMMIT }
+	var positions = make([]int, len(context.writes))
+	for i, entry := range context.writes {
+		payload = binary.AppendUvarint(payload, uint64(len(entry.CacheKey)))
+		payload = append(payload, entry.CacheKey...)
+		payload = binary.AppendUvarint(payload, uint64(len(entry.Value)))
+		positions[i] = len(payload)
+		payload = append(payload, entry.Value...)
+	}
+
+	store.lock.Lock()
+	var start = store.size + log_HEADER_SIZE
+	if err := store.append(payload); err != nil {
+		store.lock.Unlock()
+		return err
+	}
+	for i, entry := range context.writes {
+		store.addVersion(entry.CacheKey, logVersion{ sID, start + int64(positions[i]), len(entry.Value) })
+	}
+	var wake = store.needsCompaction()
+	store.lock.Unlock()
+
+	if wake {
+		select {
+		case store.wake <- true:
+		default:
+		}
+	}
+	return nil
+}
+
+func (context *logContext) rollback() {
+	context.finish()
+}
+
+func (context *logContext) finish() {
+	if context.finished {
+		return
+	}
+	context.finished = true
+
+	var store = context.lstore
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	if store.contexts[context.snapshotID]--; store.contexts[context.snapshotID] == 0 {
+		delete(store.contexts, context.snapshotID)
+	}
+}
+
+
+// -----------------------------------------------
+// transactionContext API
+// -----------------------------------------------
+
+func (context *logContext) get(ref objRef) []byte {
+	checkContext(context.ctx)
+	var store = context.lstore
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+
+	var version, ok = store.objects[ref.CacheKey].findPrevious(context.snapshotID)
+	if !ok || version.size == 0 {
+		return nil
+	}
+
+	var blob = make([]byte, version.size)
+	if _, err := store.file.ReadAt(blob, version.offset); err != nil {
+		panic(storeError("Read error: %v", err))
+	}
+	return blob
+}
+
+func (context *logContext) contains(ref objRef) bool {
+	return context.get(ref) != nil
+}
+
+func (context *logContext) store(ref objRef, enc []byte) error {
+	context.writes = append(context.writes, memWriteEntry{ ref.CacheKey, enc })
+	return nil
+}
+
+func (context *logContext) addIndex(ref objRef, key LogeKey) {
+}
+
+func (context *logContext) remIndex(ref objRef, key LogeKey) {
+}
+
+func (context *logContext) find(ref objRef) ResultSet {
+	panic(fmt.Errorf("%w: Find on log store", ErrNotSupported))
+}
+
+func (context *logContext) findSlice(ref objRef, keyPrefix LogeKey, from LogeKey, limit int) ResultSet {
+	panic(fmt.Errorf("%w: Find on log store", ErrNotSupported))
+}
+
+func (context *logContext) listSlice(typePrefix []byte, keyPrefix LogeKey, from LogeKey, limit int) ResultSet {
+	panic(fmt.Errorf("%w: List on log store", ErrNotSupported))
+}
+
+
+// -----------------------------------------------
+// Compaction
+// -----------------------------------------------
+
+func (store *logStore) compactor() {
+	defer close(store.done)
+	for {
+		select {
+		case <-store.stop:
+			return
+		case <-store.wake:
+			if err := store.rewrite(); err != nil {
+				fmt.Printf("Log compaction error: %v\n", err)
+			}
+		}
+	}
+}
+
+func (store *logStore) needsCompaction() bool {
+	if store.size < store.opts.CompactMinBytes {
+		return false
+	}
+	return float64(store.size - store.liveBytes) / float64(store.size) >= store.opts.CompactRatio
+}
+
+// Copies what open contexts can still see into a new file, without the
+// lock so commits carry on, then takes the lock to copy whatever they
+// appended meanwhile and swap the new file in.
+func (store *logStore) rewrite() error {
+	store.compactLock.Lock()
+	defer store.compactLock.Unlock()
+
+	store.lock.RLock()
+	var end = store.size
+	var oldest = store.oldestContext()
+	var keep = make(map[string]logVersionHistory, len(store.objects))
+	for cacheKey, mvh := range store.objects {
+		if kept := mvh.since(oldest); len(kept) > 0 {
+			keep[cacheKey] = kept
+		}
+	}
+	var typeRecords = make([][]byte, 0, len(store.typeRecords))
+	for _, payload := range store.typeRecords {
+		typeRecords = append(typeRecords, payload)
+	}
+	store.lock.RUnlock()
+
+	var tmpPath = store.path + ".compact"
+	out, err := os.OpenFile(tmpPath, os.O_RDWR | os.O_CREATE | os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	var done = false
+	defer func() {
+		if !done {
+			out.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	var writer = &logWriter{ file: out }
+	writer.header()
+	for _, payload := range typeRecords {
+		writer.record(payload)
+	}
+
+	// Keys in order, so the new file reads back in a stable order
+	var keys = make([]string, 0, len(keep))
+	for cacheKey := range keep {
+		keys = append(keys, cacheKey)
+	}
+	sort.Strings(keys)
+
+	var moved = make(map[int64]int64)
+	var payload = []byte{ log_COMMIT }
+	var pending = make([]int64, 0)
+	var positions = make([]int, 0)
+	var flush = func() {
+		var start = writer.size + log_HEADER_SIZE
+		writer.record(payload)
+		for i, old := range pending {
+			moved[old] = start + int64(positions[i])
+		}
+		payload, pending, positions = payload[:1], pending[:0], positions[:0]
+	}
+
+	for _, cacheKey := range keys {
+		for _, version := range keep[cacheKey] {
+			var blob = make([]byte, version.size)
+			if _, err := store.file.ReadAt(blob, version.offset); err != nil {
+				return err
+			}
+			payload = binary.AppendUvarint(payload, uint64(len(cacheKey)))
+			payload = append(payload, cacheKey...)
+			payload = binary.AppendUvarint(payload, uint64(len(blob)))
+			pending = append(pending, version.offset)
+			positions = append(positions, len(payload))
+			payload = append(payload, blob...)
+		}
+		if len(payload) >= log_BATCH_SIZE {
+			flush()
+		}
+	}
+	if len(pending) > 0 {
+		flush()
+	}
+	if writer.err != nil {
+		return writer.err
+	}
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	// Everything appended since is copied as it stands, so only moves
+	var delta = writer.size - end
+	if _, err := io.Copy(writer, io.NewSectionReader(store.file, end, store.size - end)); err != nil {
+		return err
+	}
+	if writer.err != nil {
+		return writer.err
+	}
+	if err := out.Sync(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, store.path); err != nil {
+		return err
+	}
+	done = true
+
+	store.liveBytes = 0
+	for cacheKey, mvh := range store.objects {
+		var remapped = make(logVersionHistory, 0, len(mvh))
+		for _, version := range mvh {
+			if version.offset >= end {
+				version.offset += delta
+			} else if offset, ok := moved[version.offset]; ok {
+				version.offset = offset
+			} else {
+				continue
+			}
+			remapped = append(remapped, version)
+		}
+		if len(remapped) == 0 {
+			delete(store.objects, cacheKey)
+			continue
+		}
+		store.objects[cacheKey] = remapped
+		store.liveBytes += remapped.latest().bytes(cacheKey)
+	}
+
+	store.file.Close()
+	store.file = out
+	store.size = writer.size
+	return nil
+}
+
+func (store *logStore) oldestContext() uint64 {
+	var oldest uint64 = math.MaxUint64
+	for sID := range store.contexts {
+		if sID < oldest {
+			oldest = sID
+		}
+	}
+	return oldest
+}
+
+
+// -----------------------------------------------
+// Internals
+// -----------------------------------------------
+
+func (mvh logVersionHistory) findPrevious(sID uint64) (logVersion, bool) {
+	for i := len(mvh)-1; i >= 0; i-- {
+		if mvh[i].snapshotID <= sID {
+			return mvh[i], true
+		}
+	}
+	return logVersion{}, false
+}
+
+func (mvh logVersionHistory) latest() logVersion {
+	if len(mvh) == 0 {
+		return logVersion{}
+	}
+	return mvh[len(mvh)-1]
+}
+
+// The versions a context at sID or later can see. A delete nothing
+// older hides can go.
+func (mvh logVersionHistory) since(sID uint64) logVersionHistory {
+	var first = 0
+	for i := len(mvh)-1; i >= 0; i-- {
+		if mvh[i].snapshotID <= sID {
+			first = i
+			break
+		}
+	}
+	if mvh[first].size == 0 {
+		first++
+	}
+	return mvh[first:]
+}
+
+// Roughly what a version takes up in the file
+func (version logVersion) bytes(cacheKey string) int64 {
+	if version.size == 0 {
+		return 0
+	}
+	return int64(len(cacheKey) + version.size + 4)
+}
+
+func (store *logStore) addVersion(cacheKey string, version logVersion) {
+	var mvh = store.objects[cacheKey]
+	store.liveBytes += version.bytes(cacheKey) - mvh.latest().bytes(cacheKey)
+	store.objects[cacheKey] = append(mvh, version)
+}
+
+// Writes a record at the end of the file, under the lock. A failed
+// write is cut off again so the next one doesn't land after garbage.
+func (store *logStore) append(payload []byte) error {
+	var writer = &logWriter{ file: store.file, size: store.size }
+	writer.record(payload)
+	if writer.err == nil && store.opts.SyncWrites {
+		writer.err = store.file.Sync()
+	}
+	if writer.err != nil {
+		store.file.Truncate(store.size)
+		return writer.err
+	}
+	store.size = writer.size
+	return nil
+}
+
+type logWriter struct {
+	file *os.File
+	size int64
+	err error
+}
+
+func (writer *logWriter) Write(buf []byte) (int, error) {
+	if writer.err != nil {
+		return 0, writer.err
+	}
+	n, err := writer.file.WriteAt(buf, writer.size)
+	writer.size += int64(n)
+	writer.err = err
+	return n, err
+}
+
+func (writer *logWriter) header() {
+	var header = make([]byte, log_HEADER_SIZE)
+	copy(header, logMagic)
+	binary.BigEndian.PutUint32(header[4:], log_FORMAT_VERSION)
+	writer.Write(header)
+}
+
+func (writer *logWriter) record(payload []byte) {
+	var header = make([]byte, log_HEADER_SIZE)
+	binary.BigEndian.PutUint32(header, uint32(len(payload)))
+	binary.BigEndian.PutUint32(header[4:], crc32.ChecksumIEEE(payload))
+	writer.Write(append(header, payload...))
+}
+
+// Reads the file back into memory. Replayed versions all get snapshot
+// ID 0, since the IDs they were written under belong to a past LogeDB.
+// A torn record at the end, from dying mid-append, is cut off.
+func (store *logStore) replay() error {
+	info, err := store.file.Stat()
+	if err != nil {
+		return storeError("Read error: %v", err)
+	}
+
+	if info.Size() == 0 {
+		var writer = &logWriter{ file: store.file }
+		writer.header()
+		if writer.err == nil {
+			writer.err = store.file.Sync()
+		}
+		if writer.err != nil {
+			return storeError("Write error: %v", writer.err)
+		}
+		store.size = writer.size
+		return nil
+	}
+
+	var reader = bufio.NewReader(io.NewSectionReader(store.file, 0, info.Size()))
+	var header = make([]byte, log_HEADER_SIZE)
+	if _, err := io.ReadFull(reader, header); err != nil || !bytes.Equal(header[:4], logMagic) {
+		return fmt.Errorf("%w: %s isn't a loge log", ErrIncompatibleFormat, store.path)
+	}
+	if err := checkFormatStamp(store.path, header[4:], log_FORMAT_VERSION, false, nil); err != nil {
+		return err
+	}
+
+	var pos int64 = log_HEADER_SIZE
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			break
+		}
+		var length = int64(binary.BigEndian.Uint32(header))
+		if pos + log_HEADER_SIZE + length > info.Size() {
+			break
+		}
+		var payload = make([]byte, length)
+		if _, err := io.ReadFull(reader, payload); err != nil ||
+			crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:]) {
+			break
+		}
+		store.apply(payload, pos + log_HEADER_SIZE)
+		pos += log_HEADER_SIZE + length
+	}
+
+	if pos < info.Size() {
+		fmt.Printf("Cutting torn record from %s at %d\n", store.path, pos)
+		if err := store.file.Truncate(pos); err != nil {
+			return storeError("Write error: %v", err)
+		}
+	}
+	store.size = pos
+	return nil
+}
+
+func (store *logStore) apply(payload []byte, start int64) {
+	if len(payload) == 0 {
+		panic(storeError("Empty record at %d", start))
+	}
+
+	switch payload[0] {
+	case log_COMMIT:
+		var pos = 1
+		var next = func() int {
+			var n, size = binary.Uvarint(payload[pos:])
+			if size <= 0 || pos + size + int(n) > len(payload) {
+				panic(storeError("Bad commit record at %d", start))
+			}
+			pos += size
+			return int(n)
+		}
+		for pos < len(payload) {
+			var keyLen = next()
+			var cacheKey = string(payload[pos:pos + keyLen])
+			pos += keyLen
+			var valLen = next()
+			if old, ok := store.objects[cacheKey]; ok {
+				store.liveBytes -= old.latest().bytes(cacheKey)
+			}
+			if valLen == 0 {
+				delete(store.objects, cacheKey)
+			} else {
+				var version = logVersion{ 0, start + int64(pos), valLen }
+				store.objects[cacheKey] = logVersionHistory{ version }
+				store.liveBytes += version.bytes(cacheKey)
+			}
+			pos += valLen
+		}
+
+	case log_TYPE:
+		var typeInfo, _, err = store.types.Type("_type").DecodeObj(payload[1:], false)
+		if err != nil {
+			panic(storeError("Error loading type info: %v", err))
+		}
+		var vt = typeInfo.(*spack.VersionedType)
+		store.types.LoadType(vt)
+		store.typeRecords[vt.Name] = payload
+
+	case log_TRUNCATE:
+		var prefix = string(payload[1:])
+		for cacheKey, mvh := range store.objects {
+			if strings.HasPrefix(cacheKey, prefix) {
+				store.liveBytes -= mvh.latest().bytes(cacheKey)
+				delete(store.objects, cacheKey)
+			}
+		}
+
+	default:
+		panic(storeError("Unknown record kind %q at %d", payload[0], start))
+	}
+}
@@ -0,0 +1,124 @@
+package loge
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLogStoreReopen(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "loge-log")
+	defer os.RemoveAll(dir)
+	var path = filepath.Join(dir, "loge.log")
+
+	var open = func() *LogeDB {
+		var db = NewLogeDB(NewLogStore(path, nil))
+		var def = NewTypeDef("test", 1, &TestObj{})
+		def.Links = LinkSpec{ "other": "test" }
+		db.CreateType(def)
+		db.CreateType(NewTypeDef("kept", 1, &TestObj{}))
+		return db
+	}
+
+	var db = open()
+	db.Transact(func (t *Transaction) {
+		t.Set("test", "one", &TestObj{ "One" })
+		t.Set("test", "two", &TestObj{ "Two" })
+		t.Set("kept", "one", &TestObj{ "Kept" })
+		t.AddLink("test", "other", "one", "two")
+	}, 0)
+	db.Transact(func (t *Transaction) {
+		t.Set("test", "one", &TestObj{ "Uno" })
+		t.Delete("test", "two")
+	}, 0)
+	db.Close()
+
+	// Half a record, as if we died mid-append
+	var file, _ = os.OpenFile(path, os.O_WRONLY | os.O_APPEND, 0644)
+	file.Write([]byte{ 0, 0, 1, 0, 1, 2, 3 })
+	file.Close()
+
+	db = open()
+	if obj := db.ReadOne("test", "one").(*TestObj); obj == nil || obj.Name != "Uno" {
+		test.Errorf("Wrong object on reopen: %v", obj)
+	}
+	if db.ExistsOne("test", "two") {
+		test.Error("Delete lost on reopen")
+	}
+	db.Transact(func (t *Transaction) {
+		if links := t.ReadLinks("test", "other", "one"); len(links) != 1 || links[0] != "two" {
+			test.Errorf("Wrong links: %v", links)
+		}
+	}, 0)
+
+	if count := db.Truncate("test"); count != 1 {
+		test.Errorf("Wrong truncate count: %d", count)
+	}
+	db.Close()
+
+	db = open()
+	defer db.Close()
+	if db.ExistsOne("test", "one") {
+		test.Error("Truncate lost on reopen")
+	}
+	if obj := db.ReadOne("kept", "one").(*TestObj); obj == nil || obj.Name != "Kept" {
+		test.Errorf("Truncate went past its type: %v", obj)
+	}
+}
+
+func TestLogStoreCompaction(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "loge-log")
+	defer os.RemoveAll(dir)
+	var path = filepath.Join(dir, "loge.log")
+
+	var store = NewLogStore(path, &LogStoreOptions{ CompactRatio: 2 }).(*logStore)
+	var db = NewLogeDB(store)
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+
+	for i := 0; i < 100; i++ {
+		db.SetOne("test", "hot", &TestObj{ fmt.Sprintf("Hot %d", i) })
+	}
+	db.SetOne("test", "gone", &TestObj{ "Gone" })
+	db.DeleteOne("test", "gone")
+
+	// An open context keeps the versions it can see
+	var typ = db.lookupType("test")
+	var ref = makeObjRef(typ, "hot")
+	var _, context = db.currentContext(context.Background())
+	var seen = context.get(ref)
+	db.SetOne("test", "hot", &TestObj{ "Hot" })
+
+	var before = store.size
+	db.Compact()
+	if store.size >= before {
+		test.Errorf("Compaction didn't shrink the log: %d -> %d", before, store.size)
+	}
+	if len(store.objects[ref.CacheKey]) != 2 {
+		test.Errorf("Wrong versions kept: %v", store.objects[ref.CacheKey])
+	}
+	if _, ok := store.objects[makeObjRef(typ, "gone").CacheKey]; ok {
+		test.Error("Deleted object survived compaction")
+	}
+
+	if blob := context.get(ref); !bytes.Equal(blob, seen) {
+		test.Errorf("Snapshot version moved: %x", blob)
+	}
+	context.rollback()
+
+	db.Compact()
+	if len(store.objects[ref.CacheKey]) != 1 {
+		test.Error("Released versions kept")
+	}
+	db.Close()
+
+	db = NewLogeDB(NewLogStore(path, nil))
+	defer db.Close()
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+	if obj := db.ReadOne("test", "hot").(*TestObj); obj == nil || obj.Name != "Hot" {
+		test.Errorf("Wrong object after compaction: %v", obj)
+	}
+}
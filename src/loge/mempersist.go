@@ -0,0 +1,198 @@
+package loge
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"time"
+
+	"github.com/brendonh/spack"
+)
+
+// Snapshot files hold the newest version of everything:
+//
+//   "LOGM" uint32 format
+//   uvarint count, then each type's spack info as uvarint length, bytes
+//   uvarint count, then each cache key and blob as uvarint length, bytes
+//   uint32 crc32 of all the above
+//
+// They're written whole to a temporary file and renamed over the last,
+// so a crash leaves one or the other.
+const memsnap_FORMAT_VERSION uint32 = 1
+
+var memsnapMagic = []byte("LOGM")
+
+// A memstore which loads path on open, if it's there, and writes the
+// whole dataset back to it on Close and every interval (never, if zero).
+// Commits since the last write are lost in a crash.
+func NewPersistentMemStore(path string, interval time.Duration) LogeStore {
+	store, err := OpenPersistentMemStore(path, interval)
+	if err != nil {
+		panic(err)
+	}
+	return store
+}
+
+func OpenPersistentMemStore(path string, interval time.Duration) (store LogeStore, err error) {
+	defer recoverError(&err)
+
+	var memStore = NewMemStore().(*memStore)
+	memStore.path = path
+
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := memStore.load(data); err != nil {
+			return nil, err
+		}
+	case errors.Is(err, os.ErrNotExist):
+		// Fails now rather than at the first save
+		if err := memStore.save(); err != nil {
+			return nil, storeError("Can't write %s: %v", path, err)
+		}
+	default:
+		return nil, storeError("Can't read %s: %v", path, err)
+	}
+
+	if interval > 0 {
+		memStore.stop = make(chan bool)
+		memStore.done = make(chan bool)
+		go memStore.saver(interval)
+	}
+	return memStore, nil
+}
+
+func (store *memStore) saver(interval time.Duration) {
+	defer close(store.done)
+	var ticker = time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-store.stop:
+			return
+		case <-ticker.C:
+			if err := store.save(); err != nil {
+				fmt.Printf("Error writing %s: %v\n", store.path, err)
+			}
+		}
+	}
+}
+
+// Writes to the store's own path, if anything changed since last time
+func (store *memStore) save() error {
+	store.saveLock.Lock()
+	defer store.saveLock.Unlock()
+
+	store.lock.SpinLock()
+	var changes = store.changes
+	store.lock.Unlock()
+
+	if changes == store.saved {
+		if _, err := os.Stat(store.path); err == nil {
+			return nil
+		}
+	}
+	if err := store.writeSnapshot(store.path); err != nil {
+		return err
+	}
+	store.saved = changes
+	return nil
+}
+
+// Under saveLock
+func (store *memStore) writeSnapshot(path string) error {
+	var buf = bytes.NewBuffer(nil)
+	var header = make([]byte, 8)
+	copy(header, memsnapMagic)
+	binary.BigEndian.PutUint32(header[4:], memsnap_FORMAT_VERSION)
+	buf.Write(header)
+
+	var putBytes = func(data []byte) {
+		buf.Write(binary.AppendUvarint(nil, uint64(len(data))))
+		buf.Write(data)
+	}
+
+	// Blobs are never changed once committed, so only the maps need
+	// the lock
+	store.lock.SpinLock()
+	var types = make([][]byte, 0, len(store.typeInfo))
+	for _, typeVal := range store.typeInfo {
+		types = append(types, typeVal)
+	}
+	var keys = make([]string, 0, len(store.objects))
+	var blobs = make([][]byte, 0, len(store.objects))
+	for cacheKey, mvh := range store.objects {
+		if blob := mvh[len(mvh)-1].blob; len(blob) > 0 {
+			keys = append(keys, cacheKey)
+			blobs = append(blobs, blob)
+		}
+	}
+	store.lock.Unlock()
+
+	buf.Write(binary.AppendUvarint(nil, uint64(len(types))))
+	for _, typeVal := range types {
+		putBytes(typeVal)
+	}
+	buf.Write(binary.AppendUvarint(nil, uint64(len(keys))))
+	for i, cacheKey := range keys {
+		putBytes([]byte(cacheKey))
+		putBytes(blobs[i])
+	}
+	buf.Write(binary.BigEndian.AppendUint32(nil, crc32.ChecksumIEEE(buf.Bytes())))
+	return writeFileSync(path, buf.Bytes())
+}
+
+// Loaded versions get snapshot ID 0, since the IDs they were written
+// under belong to a past LogeDB
+func (store *memStore) load(data []byte) error {
+	if len(data) < 12 || !bytes.Equal(data[:4], memsnapMagic) {
+		return fmt.Errorf("%w: %s isn't a loge snapshot", ErrIncompatibleFormat, store.path)
+	}
+	if version := binary.BigEndian.Uint32(data[4:8]); version > memsnap_FORMAT_VERSION {
+		return fmt.Errorf("%w: %s is format %d, this loge reads up to %d",
+			ErrIncompatibleFormat, store.path, version, memsnap_FORMAT_VERSION)
+	}
+	var body = data[:len(data)-4]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(data[len(data)-4:]) {
+		return storeError("Checksum mismatch in %s", store.path)
+	}
+
+	var pos = 8
+	var next = func() int {
+		var n, size = binary.Uvarint(body[pos:])
+		if size <= 0 {
+			panic(storeError("Bad snapshot %s at %d", store.path, pos))
+		}
+		pos += size
+		return int(n)
+	}
+	var nextBytes = func() []byte {
+		var n = next()
+		if pos + n > len(body) {
+			panic(storeError("Bad snapshot %s at %d", store.path, pos))
+		}
+		pos += n
+		return body[pos - n:pos]
+	}
+
+	var typeType = store.spackTypes.Type("_type")
+	for count := next(); count > 0; count-- {
+		var typeVal = nextBytes()
+		var typeInfo, _, err = typeType.DecodeObj(typeVal, false)
+		if err != nil {
+			return storeError("Error loading type info: %v", err)
+		}
+		var vt = typeInfo.(*spack.VersionedType)
+		store.spackTypes.LoadType(vt)
+		store.typeInfo[vt.Name] = typeVal
+	}
+
+	for count := next(); count > 0; count-- {
+		var cacheKey = string(nextBytes())
+		store.objects[cacheKey] = memVersionHistory{ memVersion{ 0, nextBytes() } }
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package loge
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPersistentMemStore(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "loge-memsnap")
+	defer os.RemoveAll(dir)
+	var path = filepath.Join(dir, "loge.snap")
+
+	var open = func(interval time.Duration) *LogeDB {
+		var db = NewLogeDB(NewPersistentMemStore(path, interval))
+		var def = NewTypeDef("test", 1, &TestObj{})
+		def.Links = LinkSpec{ "other": "test" }
+		db.CreateType(def)
+		return db
+	}
+
+	var db = open(0)
+	db.Transact(func (t *Transaction) {
+		t.Set("test", "one", &TestObj{ "One" })
+		t.Set("test", "two", &TestObj{ "Two" })
+		t.AddLink("test", "other", "one", "two")
+	}, 0)
+	db.DeleteOne("test", "two")
+	db.Close()
+
+	db = open(10 * time.Millisecond)
+	if obj := db.ReadOne("test", "one").(*TestObj); obj == nil || obj.Name != "One" {
+		test.Errorf("Object lost on reopen: %v", obj)
+	}
+	if db.ExistsOne("test", "two") {
+		test.Error("Delete lost on reopen")
+	}
+	db.Transact(func (t *Transaction) {
+		if links := t.ReadLinks("test", "other", "one"); len(links) != 1 || links[0] != "two" {
+			test.Errorf("Wrong links: %v", links)
+		}
+	}, 0)
+
+	// Saved on the interval, without a close
+	db.SetOne("test", "three", &TestObj{ "Three" })
+	time.Sleep(50 * time.Millisecond)
+	var backup = filepath.Join(dir, "backup.snap")
+	data, _ := os.ReadFile(path)
+	os.WriteFile(backup, data, 0644)
+	db.Close()
+
+	var restored = NewLogeDB(NewPersistentMemStore(backup, 0))
+	defer restored.Close()
+	restored.CreateType(NewTypeDef("test", 1, &TestObj{}))
+	if obj := restored.ReadOne("test", "three").(*TestObj); obj == nil || obj.Name != "Three" {
+		test.Errorf("Interval save missed a commit: %v", obj)
+	}
+
+	os.WriteFile(path, []byte("not a snapshot"), 0644)
+	if _, err := OpenPersistentMemStore(path, 0); !errors.Is(err, ErrIncompatibleFormat) {
+		test.Errorf("Wrong error for bad file: %v", err)
+	}
+}
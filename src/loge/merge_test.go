@@ -0,0 +1,84 @@
+package loge
+
+import (
+	"testing"
+	"runtime"
+	"sync"
+)
+
+func counterMerger(base interface{}, ours interface{}, current interface{}) interface{} {
+	var baseValue uint32
+	if base.(*TestCounter) != nil {
+		baseValue = base.(*TestCounter).Value
+	}
+	var merged = *current.(*TestCounter)
+	merged.Value += ours.(*TestCounter).Value - baseValue
+	return &merged
+}
+
+func mergeDB() *LogeDB {
+	var db = NewLogeDB(NewMemStore())
+	var def = NewTypeDef("counters", 1, &TestCounter{})
+	def.Merger = counterMerger
+	db.CreateType(def)
+
+	db.SetOne("counters", "merged", &TestCounter{Value: 0})
+	return db
+}
+
+func TestMergeConflict(test *testing.T) {
+	var db = mergeDB()
+
+	var trans1 = db.CreateTransaction()
+	var trans2 = db.CreateTransaction()
+
+	Increment(trans1, "merged")
+	Increment(trans2, "merged")
+	Increment(trans2, "merged")
+
+	if !trans1.Commit() {
+		test.Error("Commit 1 failed")
+	}
+
+	if !trans2.Commit() {
+		test.Error("Merged commit 2 failed")
+	}
+
+	var counter = db.ReadOne("counters", "merged").(*TestCounter)
+	if counter.Value != 3 {
+		test.Errorf("Wrong merged value: %d", counter.Value)
+	}
+}
+
+func TestMergeReadOnlyConflict(test *testing.T) {
+	var db = mergeDB()
+
+	var trans1 = db.CreateTransaction()
+	var trans2 = db.CreateTransaction()
+
+	Increment(trans1, "merged")
+	trans2.Read("counters", "merged")
+
+	trans1.Commit()
+
+	if trans2.Commit() {
+		test.Error("Read of changed mergeable object committed")
+	}
+}
+
+func TestConcurrentMerge(test *testing.T) {
+	var db = mergeDB()
+
+	var procs = runtime.NumCPU()
+	var group sync.WaitGroup
+	for i := 0; i < procs; i++ {
+		group.Add(1)
+		go LoopIncrement(db, "merged", &group, 100)
+	}
+	group.Wait()
+
+	var counter = db.ReadOne("counters", "merged").(*TestCounter)
+	if counter.Value != uint32(procs * 100) {
+		test.Errorf("Wrong merged count: %d / %d", counter.Value, procs * 100)
+	}
+}
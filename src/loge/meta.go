@@ -0,0 +1,59 @@
+package loge
+
+// Embed in an exemplar struct to have loaded objects know where they
+// came from:
+//
+//   type Person struct {
+//       loge.Meta
+//       Name string
+//   }
+//
+//   var person = t.Read("person", key).(*Person)
+//   person.Key() == key
+//
+// Meta has no exported fields, so it isn't stored with the object.
+type Meta struct {
+	typeName string
+	key LogeKey
+	version uint16
+	snapshotID uint64
+}
+
+type metaHolder interface {
+	setMeta(Meta)
+}
+
+func (m *Meta) TypeName() string {
+	return m.typeName
+}
+
+func (m *Meta) Key() LogeKey {
+	return m.key
+}
+
+// The type version the object was loaded as
+func (m *Meta) Version() uint16 {
+	return m.version
+}
+
+// The snapshot the object was read (or created) in
+func (m *Meta) SnapshotID() uint64 {
+	return m.snapshotID
+}
+
+func (m *Meta) setMeta(meta Meta) {
+	*m = meta
+}
+
+func (obj *logeObject) populateMeta(object interface{}, sID uint64) {
+	holder, ok := object.(metaHolder)
+	if !ok || obj.LinkName != "" || !obj.hasValue(object) {
+		return
+	}
+	holder.setMeta(Meta{
+		typeName: obj.Type.Name,
+		key: obj.Key,
+		version: obj.Type.Version,
+		snapshotID: sID,
+	})
+}
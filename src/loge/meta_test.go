@@ -0,0 +1,41 @@
+package loge
+
+import (
+	"testing"
+)
+
+type MetaObj struct {
+	Meta
+	Name string
+}
+
+func TestMeta(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	db.CreateType(NewTypeDef("meta", 3, &MetaObj{}))
+
+	db.Transact(func (t *Transaction) {
+		var obj = &MetaObj{ Name: "one" }
+		t.Set("meta", "one", obj)
+		if obj.Key() != "one" || obj.TypeName() != "meta" {
+			test.Errorf("Set didn't populate meta: %q %q", obj.TypeName(), obj.Key())
+		}
+	}, 0)
+
+	var sID = db.lastSnapshotID
+	db.Transact(func (t *Transaction) {
+		var obj = t.Read("meta", "one").(*MetaObj)
+		if obj.Key() != "one" || obj.TypeName() != "meta" || obj.Version() != 3 {
+			test.Errorf("Wrong meta on read: %q %q %d", obj.TypeName(), obj.Key(), obj.Version())
+		}
+		if obj.SnapshotID() != sID {
+			test.Errorf("Wrong snapshot: %d != %d", obj.SnapshotID(), sID)
+		}
+		if t.Write("meta", "one").(*MetaObj).Key() != "one" {
+			test.Error("Wrong meta on write")
+		}
+	}, 0)
+
+	if db.ReadOne("meta", "missing").(*MetaObj) != nil {
+		test.Error("Missing object isn't nil")
+	}
+}
@@ -0,0 +1,120 @@
+package loge
+
+import (
+	"sort"
+)
+
+// Where a migration got to: every object of Type up to and including
+// After is done, as are all types sorting before it.
+type MigrateCheckpoint struct {
+	Type string
+	After LogeKey
+	Count int
+}
+
+type MigrateOptions struct {
+	Types []string // Every registered type if empty
+	BatchSize int
+	Resume MigrateCheckpoint
+
+	// Called after each batch commits. An error stops the migration,
+	// which returns it with the checkpoint to resume from.
+	Progress func(MigrateCheckpoint) error
+}
+
+var defaultMigrateBatch = 500
+
+// Rewrites every object, with its links, in batches of one transaction
+// each. Objects are decoded as their type reads them (running any
+// upgraders) and encoded as it now writes them, so after changing a
+// type's version or encoding this brings stored data up to date.
+//
+// With to nil or the same DB the rewrite is in place; otherwise objects
+// are copied into to, which needs the same types registered. The store
+// has to support List.
+func (db *LogeDB) Migrate(to *LogeDB, opts MigrateOptions) (checkpoint MigrateCheckpoint, err error) {
+	defer recoverError(&err)
+
+	if to == nil {
+		to = db
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultMigrateBatch
+	}
+
+	var typeNames = opts.Types
+	if len(typeNames) == 0 {
+		for name := range db.types {
+			typeNames = append(typeNames, name)
+		}
+	}
+	typeNames = append([]string{}, typeNames...)
+	sort.Strings(typeNames)
+
+	checkpoint = opts.Resume
+	for _, typeName := range typeNames {
+		if typeName < checkpoint.Type {
+			continue
+		}
+		db.lookupType(typeName)
+		to.lookupType(typeName)
+		if typeName > checkpoint.Type {
+			checkpoint.Type = typeName
+			checkpoint.After = ""
+		}
+
+		for {
+			var count = db.migrateBatch(to, typeName, &checkpoint, opts.BatchSize)
+			if count == 0 {
+				break
+			}
+			if opts.Progress != nil {
+				if err := opts.Progress(checkpoint); err != nil {
+					return checkpoint, err
+				}
+			}
+			if count < opts.BatchSize {
+				break
+			}
+		}
+	}
+	return checkpoint, nil
+}
+
+func (db *LogeDB) migrateBatch(to *LogeDB, typeName string, checkpoint *MigrateCheckpoint, size int) int {
+	var typ = db.types[typeName]
+	var keys = db.ListSlice(typeName, checkpoint.After, size)
+	if len(keys) == 0 {
+		return 0
+	}
+
+	var rewrite = func(src *Transaction, dst *Transaction) {
+		for _, key := range keys {
+			if !src.Exists(typeName, key) {
+				continue
+			}
+			dst.Set(typeName, key, src.Read(typeName, key))
+			for linkName := range typ.Links {
+				if targets := src.ReadLinks(typeName, linkName, key); len(targets) > 0 {
+					dst.SetLinks(typeName, linkName, key, targets)
+				}
+			}
+		}
+	}
+
+	if to == db {
+		db.Transact(func (t *Transaction) {
+			rewrite(t, t)
+		}, 0)
+	} else {
+		db.Transact(func (src *Transaction) {
+			to.Transact(func (dst *Transaction) {
+				rewrite(src, dst)
+			}, 0)
+		}, 0)
+	}
+
+	checkpoint.After = keys[len(keys) - 1]
+	checkpoint.Count += len(keys)
+	return len(keys)
+}
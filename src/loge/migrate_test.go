@@ -0,0 +1,71 @@
+package loge
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestMigrate(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "loge-migrate")
+	defer os.RemoveAll(dir)
+
+	var open = func(name string) *LogeDB {
+		var db = NewLogeDB(NewLevelDBStore(dir + "/" + name))
+		var def = NewTypeDef("test", 1, &TestObj{})
+		def.Links = LinkSpec{ "other": "test" }
+		db.CreateType(def)
+		return db
+	}
+
+	var source = open("source")
+	defer source.Close()
+	source.Transact(func (t *Transaction) {
+		for _, key := range []LogeKey{ "a", "b", "c", "d", "e" } {
+			t.Set("test", key, &TestObj{ string(key) })
+		}
+		t.AddLink("test", "other", "c", "a")
+	}, 0)
+
+	var target = open("target")
+	defer target.Close()
+
+	var stop = errors.New("stop")
+	var opts = MigrateOptions{
+		BatchSize: 2,
+		Progress: func(MigrateCheckpoint) error { return stop },
+	}
+	checkpoint, err := source.Migrate(target, opts)
+	if err != stop || checkpoint.After != "b" || checkpoint.Count != 2 {
+		test.Fatalf("Wrong stop: %v %+v", err, checkpoint)
+	}
+	if target.ExistsOne("test", "c") {
+		test.Error("Migrated past the checkpoint")
+	}
+
+	opts.Progress = nil
+	opts.Resume = checkpoint
+	checkpoint, err = source.Migrate(target, opts)
+	if err != nil || checkpoint.Count != 5 {
+		test.Fatalf("Wrong resume: %v %+v", err, checkpoint)
+	}
+
+	if keys := target.ListSlice("test", "", -1); !reflect.DeepEqual(keys, []LogeKey{ "a", "b", "c", "d", "e" }) {
+		test.Errorf("Wrong keys copied: %v", keys)
+	}
+	if links := target.ReadLinksOne("test", "other", "c"); !reflect.DeepEqual(links, []LogeKey{ "a" }) {
+		test.Errorf("Wrong links copied: %v", links)
+	}
+
+	// In place
+	checkpoint, err = source.Migrate(nil, MigrateOptions{})
+	if err != nil || checkpoint.Count != 5 || source.ReadOne("test", "e").(*TestObj).Name != "e" {
+		test.Errorf("Wrong in-place rewrite: %v %+v", err, checkpoint)
+	}
+
+	if _, err := NewLogeDB(NewMemStore()).Migrate(nil, MigrateOptions{}); err != nil {
+		test.Errorf("Migrating no types failed: %v", err)
+	}
+}
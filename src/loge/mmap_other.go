@@ -0,0 +1,16 @@
+//go:build !unix
+
+package loge
+
+import (
+	"fmt"
+	"os"
+)
+
+func mmapFile(file *os.File, size int, writable bool) ([]byte, error) {
+	return nil, fmt.Errorf("%w: mmap on this platform", ErrNotSupported)
+}
+
+func munmapFile(data []byte) error {
+	return nil
+}
@@ -0,0 +1,892 @@
+package loge
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/brendonh/spack"
+)
+
+// A directory of three files:
+//
+//   data    "LOGD" uint32 format, padding, then a block per commit
+//   index   header, then an open-addressed hash table of slots
+//   types   spack type info, rewritten whole
+//
+// A block is uint32 length, uint32 crc32, then entries of uvarint
+// length-prefixed cache key and value, an empty value for a delete.
+// Each slot is the key's hash and the data offset of its newest entry;
+// an offset of 0 marks a deleted slot. Data and index are both mapped,
+// so only the pages in use need to be in RAM.
+//
+// The index is only trusted after a clean close. Otherwise it's rebuilt
+// from data, cutting off a torn block at the end.
+const mmap_FORMAT_VERSION uint32 = 1
+
+const mmap_DATA_HEADER = 16
+const mmap_MIN_CAPACITY = 1 << 20
+
+// magic, format, slots, data end, used, dead, clean
+const mmap_INDEX_HEADER = 48
+const mmap_SLOT_SIZE = 16
+const mmap_MIN_SLOTS = 1024
+
+var mmapDataMagic = []byte("LOGD")
+var mmapIndexMagic = []byte("LOGI")
+
+
+type mmapStore struct {
+	basePath string
+	types *spack.TypeSet
+	typeInfo map[string][]byte
+
+	// Held by anything appending to data
+	writeLock sync.Mutex
+
+	lock sync.RWMutex
+	data *os.File
+	dataMap []byte
+	dataEnd int64
+	index *os.File
+	indexMap []byte
+	slots uint64
+	used uint64
+	dead uint64
+
+	// Snapshot IDs of open contexts, and what commits since the oldest
+	// of them overwrote
+	contexts map[uint64]int
+	overlay map[string][]mmapOverlay
+}
+
+// The blob a key had before the commit at committedAt
+type mmapOverlay struct {
+	committedAt uint64
+	blob []byte
+}
+
+type mmapContext struct {
+	mstore *mmapStore
+	ctx context.Context
+	snapshotID uint64
+	writes []memWriteEntry
+	finished bool
+}
+
+// For datasets bigger than RAM which only need reads by key: Find and
+// List aren't supported. Commits overwrite in place as far as readers
+// are concerned; what open transactions still need is kept in memory
+// until they finish.
+func NewMmapStore(basePath string) LogeStore {
+	store, err := OpenMmapStore(basePath)
+	if err != nil {
+		panic(err)
+	}
+	return store
+}
+
+func OpenMmapStore(basePath string) (store LogeStore, err error) {
+	defer recoverError(&err)
+
+	if err := os.MkdirAll(basePath, 0755); err != nil {
+		return nil, storeError("Can't create %s: %v", basePath, err)
+	}
+
+	var mmapStore = &mmapStore{
+		basePath: basePath,
+		types: spack.NewTypeSet(),
+		typeInfo: make(map[string][]byte),
+		contexts: make(map[uint64]int),
+		overlay: make(map[string][]mmapOverlay),
+	}
+	if err := mmapStore.open(); err != nil {
+		mmapStore.closeFiles()
+		return nil, err
+	}
+	return mmapStore, nil
+}
+
+func (store *mmapStore) close() {
+	store.writeLock.Lock()
+	defer store.writeLock.Unlock()
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	store.data.Sync()
+	store.markIndex(true)
+	store.closeFiles()
+}
+
+// Rewrites data with only the newest entry of each key
+func (store *mmapStore) compact() {
+	store.writeLock.Lock()
+	defer store.writeLock.Unlock()
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if err := store.rewrite(); err != nil {
+		panic(storeError("Compaction error: %v", err))
+	}
+}
+
+// Commits overwrite, so only open transactions can see the past
+func (store *mmapStore) retainsVersions() bool {
+	return false
+}
+
+// Data and types, into a new directory. Opening it builds an index.
+func (store *mmapStore) backup(path string) error {
+	store.writeLock.Lock()
+	defer store.writeLock.Unlock()
+
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return err
+	}
+	var data = append(store.dataMap[:store.dataEnd:store.dataEnd], make([]byte, 8)...)
+	if err := writeFileSync(filepath.Join(path, "data"), data); err != nil {
+		return err
+	}
+	return writeFileSync(filepath.Join(path, "types"), store.encodeTypes())
+}
+
+func (store *mmapStore) describe() string {
+	return fmt.Sprintf("Mmap: %s", store.basePath)
+}
+
+// No indexes to rebuild
+func (store *mmapStore) rebuildIndexes(db *LogeDB) int {
+	return 0
+}
+
+func (store *mmapStore) truncate(typ *logeType) int {
+	store.writeLock.Lock()
+	defer store.writeLock.Unlock()
+
+	var prefix = string(typePrefix(typ))
+	var count = 0
+	var deletes = make([]memWriteEntry, 0)
+
+	store.lock.RLock()
+	for i := uint64(0); i < store.slots; i++ {
+		var hash, offset = store.slot(i)
+		if hash == 0 || offset == 0 {
+			continue
+		}
+		var key, _ = store.entry(offset)
+		// Objects and links of a type share the top half of the tag
+		if string(key[:2]) != prefix[:2] {
+			continue
+		}
+		if string(key[:4]) == prefix {
+			count++
+		}
+		deletes = append(deletes, memWriteEntry{ string(key), nil })
+	}
+	store.lock.RUnlock()
+
+	if len(deletes) > 0 {
+		if err := store.write(deletes, 0); err != nil {
+			panic(storeError("Write error: %v", err))
+		}
+	}
+	return count
+}
+
+func (store *mmapStore) registerType(typ *logeType) {
+	registerTypeInfo(store.types, typ, func(name string, info []byte) error {
+		store.writeLock.Lock()
+		defer store.writeLock.Unlock()
+		store.typeInfo[name] = info
+		return writeFileSync(filepath.Join(store.basePath, "types"), store.encodeTypes())
+	})
+}
+
+func (store *mmapStore) getSpackType(name string) *spack.VersionedType {
+	return store.types.RegisterType(name)
+}
+
+
+// -----------------------------------------------
+// Transaction Contexts
+// -----------------------------------------------
+
+func (store *mmapStore) newContext(ctx context.Context, sID uint64) transactionContext {
+	store.lock.Lock()
+	store.contexts[sID]++
+	store.lock.Unlock()
+
+	return &mmapContext{
+		mstore: store,
+		ctx: ctx,
+		snapshotID: sID,
+	}
+}
+
+func (context *mmapContext) getSnapshotID() uint64 {
+	return context.snapshotID
+}
+
+func (context *mmapContext) commit(sID uint64) error {
+	// Nothing reads through this context again, so what the commit
+	// overwrites needn't be kept for it
+	context.finish()
+	if len(context.writes) == 0 {
+		return nil
+	}
+
+	var store = context.mstore
+	store.writeLock.Lock()
+	defer store.writeLock.Unlock()
+	return store.write(context.writes, sID)
+}
+
+func (context *mmapContext) rollback() {
+	context.finish()
+}
+
+func (context *mmapContext) finish() {
+	if context.finished {
+		return
+	}
+	context.finished = true
+
+	var store = context.mstore
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	if store.contexts[context.snapshotID]--; store.contexts[context.snapshotID] == 0 {
+		delete(store.contexts, context.snapshotID)
+	}
+
+	if len(store.overlay) == 0 {
+		return
+	}
+	var oldest = store.oldestContext()
+	for cacheKey, history := range store.overlay {
+		var first = 0
+		for first < len(history) && history[first].committedAt <= oldest {
+			first++
+		}
+		if first == len(history) {
+			delete(store.overlay, cacheKey)
+		} else {
+			store.overlay[cacheKey] = history[first:]
+		}
+	}
+}
+
+
+// -----------------------------------------------
+// transactionContext API
+// -----------------------------------------------
+
+func (context *mmapContext) get(ref objRef) []byte {
+	checkContext(context.ctx)
+	var store = context.mstore
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+
+	for _, overwritten := range store.overlay[ref.CacheKey] {
+		if overwritten.committedAt > context.snapshotID {
+			return overwritten.blob
+		}
+	}
+	return store.current(ref.CacheKey)
+}
+
+func (context *mmapContext) contains(ref objRef) bool {
+	return context.get(ref) != nil
+}
+
+func (context *mmapContext) store(ref objRef, enc []byte) error {
+	context.writes = append(context.writes, memWriteEntry{ ref.CacheKey, enc })
+	return nil
+}
+
+func (context *mmapContext) addIndex(ref objRef, key LogeKey) {
+}
+
+func (context *mmapContext) remIndex(ref objRef, key LogeKey) {
+}
+
+func (context *mmapContext) find(ref objRef) ResultSet {
+	panic(fmt.Errorf("%w: Find on mmap store", ErrNotSupported))
+}
+
+func (context *mmapContext) findSlice(ref objRef, keyPrefix LogeKey, from LogeKey, limit int) ResultSet {
+	panic(fmt.Errorf("%w: Find on mmap store", ErrNotSupported))
+}
+
+func (context *mmapContext) listSlice(typePrefix []byte, keyPrefix LogeKey, from LogeKey, limit int) ResultSet {
+	panic(fmt.Errorf("%w: List on mmap store", ErrNotSupported))
+}
+
+
+// -----------------------------------------------
+// Data
+// -----------------------------------------------
+
+// Appends a block and indexes it, under writeLock. A snapshot ID of 0
+// keeps nothing for open contexts.
+func (store *mmapStore) write(writes []memWriteEntry, sID uint64) error {
+	var block = make([]byte, 8)
+	var positions = make([]int, len(writes))
+	for i, entry := range writes {
+		positions[i] = len(block)
+		block = binary.AppendUvarint(block, uint64(len(entry.CacheKey)))
+		block = append(block, entry.CacheKey...)
+		block = binary.AppendUvarint(block, uint64(len(entry.Value)))
+		block = append(block, entry.Value...)
+	}
+	binary.BigEndian.PutUint32(block, uint32(len(block) - 8))
+	binary.BigEndian.PutUint32(block[4:], crc32.ChecksumIEEE(block[8:]))
+
+	// Zeroes after the block stop a rebuild reading on into whatever was
+	// there before
+	var start = store.dataEnd
+	var end = start + int64(len(block))
+	if end + 8 > int64(len(store.dataMap)) {
+		store.lock.Lock()
+		var err = store.growData(end + 8)
+		store.lock.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := store.data.WriteAt(append(block, make([]byte, 8)...), start); err != nil {
+		return err
+	}
+	if err := store.data.Sync(); err != nil {
+		return err
+	}
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	var keep = sID > 0 && store.oldestContext() < sID
+	for i, entry := range writes {
+		if keep {
+			store.overlay[entry.CacheKey] = append(store.overlay[entry.CacheKey], mmapOverlay{ sID, store.current(entry.CacheKey) })
+		}
+		if len(entry.Value) == 0 {
+			store.remove(entry.CacheKey)
+		} else if err := store.put(entry.CacheKey, start + int64(positions[i])); err != nil {
+			return err
+		}
+	}
+	store.dataEnd = end
+	return nil
+}
+
+// A copy of the newest blob for the key, under the lock
+func (store *mmapStore) current(cacheKey string) []byte {
+	var _, offset, ok = store.find(cacheKey)
+	if !ok {
+		return nil
+	}
+	var _, val = store.entry(offset)
+	return append([]byte(nil), val...)
+}
+
+func (store *mmapStore) entry(offset int64) (key []byte, val []byte) {
+	key, val, _ = store.nextEntry(offset)
+	return key, val
+}
+
+func (store *mmapStore) nextEntry(offset int64) (key []byte, val []byte, next int64) {
+	var keyLen, n = binary.Uvarint(store.dataMap[offset:])
+	offset += int64(n)
+	key = store.dataMap[offset:offset + int64(keyLen)]
+	offset += int64(keyLen)
+	valLen, n := binary.Uvarint(store.dataMap[offset:])
+	offset += int64(n)
+	return key, store.dataMap[offset:offset + int64(valLen)], offset + int64(valLen)
+}
+
+// Under the lock
+func (store *mmapStore) growData(need int64) error {
+	var capacity = int64(len(store.dataMap))
+	if capacity < mmap_MIN_CAPACITY {
+		capacity = mmap_MIN_CAPACITY
+	}
+	for capacity < need {
+		capacity *= 2
+	}
+	if err := store.data.Truncate(capacity); err != nil {
+		return err
+	}
+	return store.mapData()
+}
+
+func (store *mmapStore) mapData() error {
+	info, err := store.data.Stat()
+	if err != nil {
+		return err
+	}
+	if err := munmapFile(store.dataMap); err != nil {
+		return err
+	}
+	store.dataMap = nil
+	store.dataMap, err = mmapFile(store.data, int(info.Size()), false)
+	return err
+}
+
+func (store *mmapStore) oldestContext() uint64 {
+	var oldest uint64 = math.MaxUint64
+	for sID := range store.contexts {
+		if sID < oldest {
+			oldest = sID
+		}
+	}
+	return oldest
+}
+
+// Under writeLock and the lock
+func (store *mmapStore) rewrite() error {
+	var tmpPath = filepath.Join(store.basePath, "data.compact")
+	file, err := os.OpenFile(tmpPath, os.O_RDWR | os.O_CREATE | os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	var out = bytes.NewBuffer(make([]byte, 0, mmap_MIN_CAPACITY))
+	out.Write(mmapDataHeader())
+	var block = make([]byte, 8)
+	var flush = func() {
+		binary.BigEndian.PutUint32(block, uint32(len(block) - 8))
+		binary.BigEndian.PutUint32(block[4:], crc32.ChecksumIEEE(block[8:]))
+		out.Write(block)
+		block = block[:8]
+	}
+	for i := uint64(0); i < store.slots; i++ {
+		var hash, offset = store.slot(i)
+		if hash == 0 || offset == 0 {
+			continue
+		}
+		var key, val = store.entry(offset)
+		block = binary.AppendUvarint(block, uint64(len(key)))
+		block = append(block, key...)
+		block = binary.AppendUvarint(block, uint64(len(val)))
+		block = append(block, val...)
+		if len(block) >= mmap_MIN_CAPACITY {
+			flush()
+		}
+	}
+	if len(block) > 8 {
+		flush()
+	}
+	var end = int64(out.Len())
+	out.Write(make([]byte, 8))
+
+	var capacity = int64(mmap_MIN_CAPACITY)
+	for capacity < end + 8 {
+		capacity *= 2
+	}
+	if _, err = file.Write(out.Bytes()); err == nil {
+		if err = file.Truncate(capacity); err == nil {
+			err = file.Sync()
+		}
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, filepath.Join(store.basePath, "data"))
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	munmapFile(store.dataMap)
+	store.dataMap = nil
+	store.data.Close()
+	store.data = file
+	if err := store.mapData(); err != nil {
+		return err
+	}
+	return store.rebuildIndex(store.used * 4)
+}
+
+func mmapDataHeader() []byte {
+	var header = make([]byte, mmap_DATA_HEADER)
+	copy(header, mmapDataMagic)
+	binary.BigEndian.PutUint32(header[4:], mmap_FORMAT_VERSION)
+	return header
+}
+
+
+// -----------------------------------------------
+// Index
+// -----------------------------------------------
+
+func (store *mmapStore) slot(i uint64) (hash uint64, offset int64) {
+	var at = mmap_INDEX_HEADER + i * mmap_SLOT_SIZE
+	return binary.BigEndian.Uint64(store.indexMap[at:]), int64(binary.BigEndian.Uint64(store.indexMap[at + 8:]))
+}
+
+func setSlot(indexMap []byte, i uint64, hash uint64, offset int64) {
+	var at = mmap_INDEX_HEADER + i * mmap_SLOT_SIZE
+	binary.BigEndian.PutUint64(indexMap[at:], hash)
+	binary.BigEndian.PutUint64(indexMap[at + 8:], uint64(offset))
+}
+
+// Never 0, which marks an empty slot
+func mmapHash(cacheKey string) uint64 {
+	var hasher = fnv.New64a()
+	hasher.Write([]byte(cacheKey))
+	if hash := hasher.Sum64(); hash != 0 {
+		return hash
+	}
+	return 1
+}
+
+func (store *mmapStore) find(cacheKey string) (slot uint64, offset int64, ok bool) {
+	var hash = mmapHash(cacheKey)
+	var mask = store.slots - 1
+	for i := hash & mask; ; i = (i + 1) & mask {
+		var slotHash, slotOffset = store.slot(i)
+		if slotHash == 0 {
+			return i, 0, false
+		}
+		if slotHash == hash && slotOffset != 0 {
+			if key, _ := store.entry(slotOffset); string(key) == cacheKey {
+				return i, slotOffset, true
+			}
+		}
+	}
+}
+
+func (store *mmapStore) put(cacheKey string, offset int64) error {
+	if (store.used + store.dead + 1) * 2 > store.slots {
+		var slots = store.slots
+		if store.used * 4 > slots {
+			slots *= 2
+		}
+		if err := store.growIndex(slots); err != nil {
+			return err
+		}
+	}
+
+	var hash = mmapHash(cacheKey)
+	var mask = store.slots - 1
+	var free, found = uint64(0), false
+	for i := hash & mask; ; i = (i + 1) & mask {
+		var slotHash, slotOffset = store.slot(i)
+		if slotHash == 0 {
+			if !found {
+				free = i
+			} else {
+				store.dead--
+			}
+			store.used++
+			setSlot(store.indexMap, free, hash, offset)
+			return nil
+		}
+		if slotOffset == 0 && !found {
+			free, found = i, true
+			continue
+		}
+		if slotHash == hash && slotOffset != 0 {
+			if key, _ := store.entry(slotOffset); string(key) == cacheKey {
+				setSlot(store.indexMap, i, hash, offset)
+				return nil
+			}
+		}
+	}
+}
+
+func (store *mmapStore) remove(cacheKey string) {
+	if slot, _, ok := store.find(cacheKey); ok {
+		var hash, _ = store.slot(slot)
+		setSlot(store.indexMap, slot, hash, 0)
+		store.used--
+		store.dead++
+	}
+}
+
+// Into a new index of the given size, dropping deleted slots
+func (store *mmapStore) growIndex(slots uint64) error {
+	var old, oldSlots = store.indexMap, store.slots
+	file, indexMap, err := store.createIndex(slots)
+	if err != nil {
+		return err
+	}
+	var mask = slots - 1
+	for i := uint64(0); i < oldSlots; i++ {
+		var at = mmap_INDEX_HEADER + i * mmap_SLOT_SIZE
+		var hash, offset = binary.BigEndian.Uint64(old[at:]), int64(binary.BigEndian.Uint64(old[at + 8:]))
+		if hash == 0 || offset == 0 {
+			continue
+		}
+		var j = hash & mask
+		for binary.BigEndian.Uint64(indexMap[mmap_INDEX_HEADER + j * mmap_SLOT_SIZE:]) != 0 {
+			j = (j + 1) & mask
+		}
+		setSlot(indexMap, j, hash, offset)
+	}
+	store.dead = 0
+	return store.swapIndex(file, indexMap, slots)
+}
+
+// Empty, unclean, under a temporary name until swapIndex
+func (store *mmapStore) createIndex(slots uint64) (*os.File, []byte, error) {
+	file, err := os.OpenFile(filepath.Join(store.basePath, "index.tmp"), os.O_RDWR | os.O_CREATE | os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+	var size = mmap_INDEX_HEADER + int64(slots) * mmap_SLOT_SIZE
+	if err := file.Truncate(size); err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	indexMap, err := mmapFile(file, int(size), true)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	copy(indexMap, mmapIndexMagic)
+	binary.BigEndian.PutUint32(indexMap[4:], mmap_FORMAT_VERSION)
+	binary.BigEndian.PutUint64(indexMap[8:], slots)
+	return file, indexMap, nil
+}
+
+func (store *mmapStore) swapIndex(file *os.File, indexMap []byte, slots uint64) error {
+	if err := os.Rename(filepath.Join(store.basePath, "index.tmp"), filepath.Join(store.basePath, "index")); err != nil {
+		munmapFile(indexMap)
+		file.Close()
+		return err
+	}
+	munmapFile(store.indexMap)
+	if store.index != nil {
+		store.index.Close()
+	}
+	store.index, store.indexMap, store.slots = file, indexMap, slots
+	return nil
+}
+
+// Indexes data from scratch, for at least hint keys
+func (store *mmapStore) rebuildIndex(hint uint64) error {
+	var slots = uint64(mmap_MIN_SLOTS)
+	for slots < hint {
+		slots *= 2
+	}
+	file, indexMap, err := store.createIndex(slots)
+	if err != nil {
+		return err
+	}
+	if err := store.swapIndex(file, indexMap, slots); err != nil {
+		return err
+	}
+	store.used, store.dead = 0, 0
+
+	var pos = int64(mmap_DATA_HEADER)
+	for pos + 8 <= int64(len(store.dataMap)) {
+		var length = int64(binary.BigEndian.Uint32(store.dataMap[pos:]))
+		var end = pos + 8 + length
+		if length == 0 || end > int64(len(store.dataMap)) ||
+			crc32.ChecksumIEEE(store.dataMap[pos + 8:end]) != binary.BigEndian.Uint32(store.dataMap[pos + 4:]) {
+			break
+		}
+
+		for offset := pos + 8; offset < end; {
+			var key, val, next = store.nextEntry(offset)
+			if len(val) == 0 {
+				store.remove(string(key))
+			} else if err := store.put(string(key), offset); err != nil {
+				return err
+			}
+			offset = next
+		}
+		pos = end
+	}
+	store.dataEnd = pos
+	return nil
+}
+
+
+// -----------------------------------------------
+// Files
+// -----------------------------------------------
+
+func (store *mmapStore) open() error {
+	var dataPath = filepath.Join(store.basePath, "data")
+	data, err := os.OpenFile(dataPath, os.O_RDWR | os.O_CREATE, 0644)
+	if err != nil {
+		return storeError("Can't open %s: %v", dataPath, err)
+	}
+	store.data = data
+
+	info, err := data.Stat()
+	if err != nil {
+		return storeError("Can't stat %s: %v", dataPath, err)
+	}
+	if info.Size() == 0 {
+		if _, err := data.Write(mmapDataHeader()); err != nil {
+			return storeError("Can't write %s: %v", dataPath, err)
+		}
+		if err := data.Truncate(mmap_MIN_CAPACITY); err != nil {
+			return storeError("Can't write %s: %v", dataPath, err)
+		}
+	} else {
+		var header = make([]byte, 8)
+		if _, err := data.ReadAt(header, 0); err != nil || !bytes.Equal(header[:4], mmapDataMagic) {
+			return fmt.Errorf("%w: %s isn't a loge mmap store", ErrIncompatibleFormat, dataPath)
+		}
+		if version := binary.BigEndian.Uint32(header[4:]); version > mmap_FORMAT_VERSION {
+			return fmt.Errorf("%w: %s is format %d, this loge reads up to %d",
+				ErrIncompatibleFormat, dataPath, version, mmap_FORMAT_VERSION)
+		}
+	}
+	if err := store.mapData(); err != nil {
+		return storeError("Can't map %s: %v", dataPath, err)
+	}
+
+	if err := store.loadTypes(); err != nil {
+		return err
+	}
+
+	if !store.openIndex() {
+		fmt.Printf("Rebuilding index for %s\n", store.basePath)
+		if err := store.rebuildIndex(0); err != nil {
+			return storeError("Can't rebuild index for %s: %v", store.basePath, err)
+		}
+	}
+	// Until close says otherwise
+	if err := store.markIndex(false); err != nil {
+		return storeError("Can't write index for %s: %v", store.basePath, err)
+	}
+	return nil
+}
+
+// Whether there's an index left by a clean close, matching data
+func (store *mmapStore) openIndex() bool {
+	file, err := os.OpenFile(filepath.Join(store.basePath, "index"), os.O_RDWR, 0644)
+	if err != nil {
+		return false
+	}
+	var header = make([]byte, mmap_INDEX_HEADER)
+	info, err := file.Stat()
+	if err != nil || info.Size() < mmap_INDEX_HEADER {
+		file.Close()
+		return false
+	}
+	if _, err := file.ReadAt(header, 0); err != nil {
+		file.Close()
+		return false
+	}
+
+	var slots = binary.BigEndian.Uint64(header[8:])
+	var dataEnd = int64(binary.BigEndian.Uint64(header[16:]))
+	if !bytes.Equal(header[:4], mmapIndexMagic) ||
+		binary.BigEndian.Uint32(header[4:]) != mmap_FORMAT_VERSION ||
+		binary.BigEndian.Uint32(header[40:]) != 1 ||
+		slots == 0 || slots & (slots - 1) != 0 ||
+		info.Size() != mmap_INDEX_HEADER + int64(slots) * mmap_SLOT_SIZE ||
+		dataEnd < mmap_DATA_HEADER || dataEnd + 8 > int64(len(store.dataMap)) {
+		file.Close()
+		return false
+	}
+
+	indexMap, err := mmapFile(file, int(info.Size()), true)
+	if err != nil {
+		file.Close()
+		return false
+	}
+	store.index, store.indexMap, store.slots = file, indexMap, slots
+	store.dataEnd = dataEnd
+	store.used = binary.BigEndian.Uint64(header[24:])
+	store.dead = binary.BigEndian.Uint64(header[32:])
+	return true
+}
+
+func (store *mmapStore) markIndex(clean bool) error {
+	binary.BigEndian.PutUint64(store.indexMap[16:], uint64(store.dataEnd))
+	binary.BigEndian.PutUint64(store.indexMap[24:], store.used)
+	binary.BigEndian.PutUint64(store.indexMap[32:], store.dead)
+	var flag uint32 = 0
+	if clean {
+		flag = 1
+	}
+	binary.BigEndian.PutUint32(store.indexMap[40:], flag)
+	return store.index.Sync()
+}
+
+func (store *mmapStore) closeFiles() {
+	munmapFile(store.dataMap)
+	munmapFile(store.indexMap)
+	store.dataMap, store.indexMap = nil, nil
+	if store.data != nil {
+		store.data.Close()
+	}
+	if store.index != nil {
+		store.index.Close()
+	}
+}
+
+// uvarint count, then each type's spack info as uvarint length, bytes
+func (store *mmapStore) encodeTypes() []byte {
+	var buf = binary.AppendUvarint(nil, uint64(len(store.typeInfo)))
+	for _, typeVal := range store.typeInfo {
+		buf = binary.AppendUvarint(buf, uint64(len(typeVal)))
+		buf = append(buf, typeVal...)
+	}
+	return buf
+}
+
+func (store *mmapStore) loadTypes() error {
+	var path = filepath.Join(store.basePath, "types")
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return storeError("Can't read %s: %v", path, err)
+	}
+
+	var count, n = binary.Uvarint(data)
+	var typeType = store.types.Type("_type")
+	for ; count > 0; count-- {
+		data = data[n:]
+		var size uint64
+		size, n = binary.Uvarint(data)
+		if n <= 0 || uint64(len(data) - n) < size {
+			return storeError("Bad type info in %s", path)
+		}
+		var typeVal = data[n:n + int(size)]
+		n += int(size)
+
+		typeInfo, _, err := typeType.DecodeObj(typeVal, false)
+		if err != nil {
+			return storeError("Error loading type info: %v", err)
+		}
+		var vt = typeInfo.(*spack.VersionedType)
+		store.types.LoadType(vt)
+		store.typeInfo[vt.Name] = typeVal
+	}
+	return nil
+}
+
+// Via a temporary file, so a crash leaves the old or the new
+func writeFileSync(path string, data []byte) error {
+	var tmpPath = path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(data); err == nil {
+		err = file.Sync()
+	}
+	file.Close()
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
@@ -0,0 +1,154 @@
+package loge
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMmapStoreReopen(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "loge-mmap")
+	defer os.RemoveAll(dir)
+
+	var open = func() *LogeDB {
+		var db = NewLogeDB(NewMmapStore(dir))
+		var def = NewTypeDef("test", 1, &TestObj{})
+		def.Links = LinkSpec{ "other": "test" }
+		db.CreateType(def)
+		db.CreateType(NewTypeDef("kept", 1, &TestObj{}))
+		return db
+	}
+
+	var db = open()
+	db.Transact(func (t *Transaction) {
+		t.Set("test", "one", &TestObj{ "One" })
+		t.Set("test", "two", &TestObj{ "Two" })
+		t.Set("kept", "one", &TestObj{ "Kept" })
+		t.AddLink("test", "other", "one", "two")
+	}, 0)
+	db.Transact(func (t *Transaction) {
+		t.Set("test", "one", &TestObj{ "Uno" })
+		t.Delete("test", "two")
+	}, 0)
+	db.Close()
+
+	db = open()
+	if obj := db.ReadOne("test", "one").(*TestObj); obj == nil || obj.Name != "Uno" {
+		test.Errorf("Wrong object on reopen: %v", obj)
+	}
+	if db.ExistsOne("test", "two") {
+		test.Error("Delete lost on reopen")
+	}
+	db.Transact(func (t *Transaction) {
+		if links := t.ReadLinks("test", "other", "one"); len(links) != 1 || links[0] != "two" {
+			test.Errorf("Wrong links: %v", links)
+		}
+	}, 0)
+
+	if count := db.Truncate("test"); count != 1 {
+		test.Errorf("Wrong truncate count: %d", count)
+	}
+
+	// Dropped without close, so the index has to be rebuilt, and with
+	// half a block on the end as if we died mid-append
+	var store = db.store.(*mmapStore)
+	store.data.WriteAt([]byte{ 0, 0, 1, 0, 1, 2, 3 }, store.dataEnd)
+	store.closeFiles()
+
+	db = open()
+	defer db.Close()
+	if db.ExistsOne("test", "one") {
+		test.Error("Truncate lost on rebuild")
+	}
+	if obj := db.ReadOne("kept", "one").(*TestObj); obj == nil || obj.Name != "Kept" {
+		test.Errorf("Truncate went past its type: %v", obj)
+	}
+	db.SetOne("test", "three", &TestObj{ "Three" })
+	if obj := db.ReadOne("test", "three").(*TestObj); obj == nil || obj.Name != "Three" {
+		test.Errorf("Wrong object after rebuild: %v", obj)
+	}
+}
+
+func TestMmapStoreGrowth(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "loge-mmap")
+	defer os.RemoveAll(dir)
+
+	var store = NewMmapStore(dir).(*mmapStore)
+	var db = NewLogeDB(store)
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+
+	// Past the first index size and data capacity
+	var name = string(bytes.Repeat([]byte("x"), 1000))
+	for i := 0; i < 2000; i++ {
+		db.SetOne("test", LogeKey(fmt.Sprintf("key%d", i)), &TestObj{ name })
+	}
+	if store.slots <= mmap_MIN_SLOTS || len(store.dataMap) <= mmap_MIN_CAPACITY {
+		test.Errorf("Didn't grow: %d slots, %d bytes", store.slots, len(store.dataMap))
+	}
+	for i := 0; i < 2000; i += 100 {
+		if !db.ExistsOne("test", LogeKey(fmt.Sprintf("key%d", i))) {
+			test.Errorf("Lost key%d", i)
+		}
+	}
+	db.Close()
+}
+
+func TestMmapStoreCompaction(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "loge-mmap")
+	defer os.RemoveAll(dir)
+
+	var store = NewMmapStore(dir).(*mmapStore)
+	var db = NewLogeDB(store)
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+
+	for i := 0; i < 100; i++ {
+		db.SetOne("test", "hot", &TestObj{ fmt.Sprintf("Hot %d", i) })
+	}
+	db.SetOne("test", "gone", &TestObj{ "Gone" })
+	db.DeleteOne("test", "gone")
+
+	// An open context keeps seeing what it saw
+	var typ = db.lookupType("test")
+	var ref = makeObjRef(typ, "hot")
+	var _, context = db.currentContext(context.Background())
+	var seen = context.get(ref)
+	db.SetOne("test", "hot", &TestObj{ "Hot" })
+
+	var before = store.dataEnd
+	db.Compact()
+	if store.dataEnd >= before {
+		test.Errorf("Compaction didn't shrink the data: %d -> %d", before, store.dataEnd)
+	}
+	if store.used != 1 || store.dead != 0 {
+		test.Errorf("Wrong index after compaction: %d used, %d dead", store.used, store.dead)
+	}
+
+	if blob := context.get(ref); !bytes.Equal(blob, seen) {
+		test.Errorf("Snapshot version moved: %x", blob)
+	}
+	context.rollback()
+	if len(store.overlay) != 0 {
+		test.Errorf("Released versions kept: %v", store.overlay)
+	}
+
+	if err := db.Backup(filepath.Join(dir, "backup")); err != nil {
+		test.Fatal(err)
+	}
+	db.Close()
+
+	for _, path := range []string{ dir, filepath.Join(dir, "backup") } {
+		db = NewLogeDB(NewMmapStore(path))
+		db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+		if obj := db.ReadOne("test", "hot").(*TestObj); obj == nil || obj.Name != "Hot" {
+			test.Errorf("Wrong object in %s: %v", path, obj)
+		}
+		if db.ExistsOne("test", "gone") {
+			test.Errorf("Deleted object back in %s", path)
+		}
+		db.Close()
+	}
+}
@@ -0,0 +1,138 @@
+package loge
+
+import (
+	"fmt"
+)
+
+// Store contexts which can fetch many objects in one call. Blobs come
+// back in the order of refs, nil for those not found.
+type multiGetter interface {
+	getMany(refs []objRef) [][]byte
+}
+
+// Like Write for each key, with the objects loaded together as by
+// ReadMany
+func (t *Transaction) WriteMany(typeName string, keys []LogeKey) []interface{} {
+	if t.ReadOnly() {
+		panic(fmt.Errorf("%w: %s", ErrReadOnly, t))
+	}
+
+	var refs = t.objRefs(typeName, keys)
+	t.checkLimits(len(t.missingRefs(refs)))
+	t.loadMany(refs)
+
+	var objects = make([]interface{}, len(refs))
+	for i, ref := range refs {
+		objects[i] = t.getVersion(ref, true, true).object
+	}
+	return objects
+}
+
+// Takes every ref from the cache in one pass, then loads the versions it
+// doesn't have yet in one store call
+func (t *Transaction) loadBatched(getter multiGetter, refs []objRef) {
+	var versions []*objectVersion
+	if t.readOnly {
+		versions = make([]*objectVersion, len(refs))
+		for i, ref := range refs {
+			versions[i] = t.acquire(ref, false)
+		}
+	} else {
+		versions = t.db.acquireVersions(refs, t.context)
+	}
+
+	// A failed load (store error, cancelled context) gives them back
+	var loaded = false
+	defer func() {
+		if loaded || t.readOnly {
+			return
+		}
+		var lvs = make([]*liveVersion, len(versions))
+		for i, version := range versions {
+			lvs[i] = &liveVersion{ version: version }
+		}
+		t.db.releaseVersions(lvs)
+	}()
+
+	var unloaded = make([]objRef, 0, len(refs))
+	var targets = make([]*objectVersion, 0, len(refs))
+	for i, version := range versions {
+		if !version.loaded {
+			unloaded = append(unloaded, refs[i])
+			targets = append(targets, version)
+		}
+	}
+
+	if len(unloaded) > 0 {
+		var blobs = getter.getMany(unloaded)
+		for i, version := range targets {
+			var obj = version.LogeObj
+			obj.Lock.SpinLock()
+			if !version.loaded {
+				version.Blob = blobs[i]
+				version.loaded = true
+			}
+			obj.Lock.Unlock()
+		}
+	}
+	loaded = true
+
+	for i, version := range versions {
+		t.addVersion(refs[i].CacheKey, version, false)
+	}
+}
+
+// -----------------------------------------------
+// Stores
+// -----------------------------------------------
+
+func (context *memContext) getMany(refs []objRef) [][]byte {
+	checkContext(context.ctx)
+	context.mstore.lock.SpinLock()
+	defer context.mstore.lock.Unlock()
+
+	var blobs = make([][]byte, len(refs))
+	for i, ref := range refs {
+		if mvh, ok := context.mstore.objects[ref.CacheKey]; ok {
+			blobs[i] = mvh.findPrevious(context.snapshotID)
+		}
+	}
+	return blobs
+}
+
+// Objects with an HMGET per type; link sets are read one at a time
+func (context *redisContext) getMany(refs []objRef) [][]byte {
+	checkContext(context.ctx)
+	var store = context.rstore
+	var blobs = make([][]byte, len(refs))
+
+	var byType = make(map[string][]int)
+	var types = make([]string, 0)
+	for i, ref := range refs {
+		if ref.IsLink() {
+			blobs[i] = context.get(ref)
+			continue
+		}
+		var name = ref.Type.Name
+		if _, ok := byType[name]; !ok {
+			types = append(types, name)
+		}
+		byType[name] = append(byType[name], i)
+	}
+
+	for _, name := range types {
+		var indexes = byType[name]
+		var args = make([]interface{}, 0, len(indexes) + 2)
+		args = append(args, "HMGET", store.key("obj:", name))
+		for _, i := range indexes {
+			args = append(args, string(refs[i].Key))
+		}
+		var vals = store.do(args...).([]interface{})
+		for j, i := range indexes {
+			if vals[j] != nil {
+				blobs[i] = vals[j].([]byte)
+			}
+		}
+	}
+	return blobs
+}
@@ -0,0 +1,55 @@
+package loge
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestReadWriteMany(test *testing.T) {
+	for _, wrapped := range []bool{ false, true } {
+		var store LogeStore = NewMemStore()
+		if wrapped {
+			// Loads concurrently instead
+			store = NewFaultStore(store)
+		}
+		var db = NewLogeDB(store)
+		db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+
+		var keys = make([]LogeKey, 0)
+		db.Transact(func (t *Transaction) {
+			for i := 0; i < 20; i++ {
+				var key = LogeKey(fmt.Sprintf("%02d", i))
+				keys = append(keys, key)
+				t.Set("test", key, &TestObj{ string(key) })
+			}
+		}, 0)
+		keys = append(keys, "missing", "00")
+
+		db.Transact(func (t *Transaction) {
+			var objs = t.WriteMany("test", keys)
+			if objs[20].(*TestObj) != nil {
+				test.Errorf("Missing object written: %v", objs[20])
+			}
+			for i, obj := range objs[:20] {
+				if obj.(*TestObj).Name != string(keys[i]) {
+					test.Errorf("Wrong object for %s: %v", keys[i], obj)
+				}
+				obj.(*TestObj).Name += "!"
+			}
+		}, 0)
+
+		db.ReadTransact(func (t *Transaction) {
+			var objs = t.ReadMany("test", keys)
+			if objs[5].(*TestObj).Name != "05!" || objs[21].(*TestObj).Name != "00!" {
+				test.Errorf("Wrong written objects: %v, %v", objs[5], objs[21])
+			}
+			if _, err := t.TryWriteMany("test", keys); !errors.Is(err, ErrReadOnly) {
+				test.Errorf("Wrong error writing read-only: %v", err)
+			}
+		})
+		if len(db.cache) != 0 {
+			test.Errorf("Objects still held: %d", len(db.cache))
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package loge
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Stricter variants for scripts and tests: where the plain API reports
+// failure with false or a nil object, these panic with a loge error
+// (ErrNoSuchObject, ErrNotCommitted, or whatever TryCommit returns), so
+// a Try* caller or recover() can still tell what went wrong.
+
+func (t *Transaction) MustRead(typeName string, key LogeKey) interface{} {
+	var lv = t.getVersion(t.db.makeObjRef(typeName, key), false, true)
+	if !lv.version.LogeObj.hasValue(lv.object) {
+		panic(fmt.Errorf("%w: %s/%s", ErrNoSuchObject, typeName, key))
+	}
+	return t.readObject(lv)
+}
+
+func (t *Transaction) MustWrite(typeName string, key LogeKey) interface{} {
+	t.MustRead(typeName, key)
+	return t.Write(typeName, key)
+}
+
+func (t *Transaction) MustCommit() {
+	t.MustCommitContext(context.Background())
+}
+
+func (t *Transaction) MustCommitContext(ctx context.Context) {
+	ok, err := t.TryCommitContext(ctx)
+	if err != nil {
+		panic(err)
+	}
+	if !ok {
+		panic(fmt.Errorf("%w: %s", ErrNotCommitted, t))
+	}
+}
+
+func (db *LogeDB) MustTransact(actor Transactor, timeout time.Duration) {
+	db.MustTransactContext(context.Background(), actor, timeout)
+}
+
+func (db *LogeDB) MustTransactContext(ctx context.Context, actor Transactor, timeout time.Duration) {
+	if !db.TransactContext(ctx, actor, timeout) {
+		panic(ErrNotCommitted)
+	}
+}
+
+func (db *LogeDB) MustReadOne(typeName string, key LogeKey) (obj interface{}) {
+	db.Transact(func (t *Transaction) {
+		obj = t.MustRead(typeName, key)
+	}, 0)
+	return
+}
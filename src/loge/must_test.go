@@ -0,0 +1,48 @@
+package loge
+
+import (
+	"testing"
+	"errors"
+)
+
+func mustPanic(test *testing.T, target error, f func()) {
+	defer func() {
+		var r = recover()
+		if err, ok := r.(error); !ok || !errors.Is(err, target) {
+			test.Errorf("Expected %v panic, got %v", target, r)
+		}
+	}()
+	f()
+}
+
+func TestMust(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+
+	db.MustTransact(func (t *Transaction) {
+		t.Set("test", "one", &TestObj{ "One" })
+	}, 0)
+
+	if db.MustReadOne("test", "one").(*TestObj).Name != "One" {
+		test.Error("Wrong MustReadOne")
+	}
+	mustPanic(test, ErrNoSuchObject, func() { db.MustReadOne("test", "two") })
+
+	if _, err := db.TryTransact(func (t *Transaction) {
+		t.MustWrite("test", "two")
+	}, 0); !errors.Is(err, ErrNoSuchObject) {
+		test.Errorf("Wrong error from MustWrite: %v", err)
+	}
+
+	var t1 = db.CreateTransaction()
+	var t2 = db.CreateTransaction()
+	t1.MustWrite("test", "one").(*TestObj).Name = "t1"
+	t2.MustWrite("test", "one").(*TestObj).Name = "t2"
+	t1.MustCommit()
+	mustPanic(test, ErrNotCommitted, t2.MustCommit)
+	mustPanic(test, ErrInactive, t2.MustCommit)
+
+	if db.ReadOne("test", "one").(*TestObj).Name != "t1" {
+		test.Error("Wrong object after MustCommit")
+	}
+}
@@ -0,0 +1,145 @@
+package loge
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// An advisory lock kept in the database, for coordinating work between
+// everything sharing it:
+//
+//   var lock = loge.Mutex(db, "nightly-report")
+//   if token, ok := lock.TryLock(); ok {
+//       defer lock.Unlock()
+//       ...   // Pass token along to anything which can check it
+//   }
+//
+// A holder which stops refreshing loses the lock after TTL, measured on
+// the DB's clock. Each acquisition gets a fencing token one higher than
+// the last, so work done under a lock that has since expired and been
+// taken again can be told apart and rejected; Held checks from inside a
+// transaction, which then conflicts if the lock changes hands before it
+// commits.
+//
+// Locks live in their own type, created by the first Mutex call on a
+// DB: make handles at startup, as with CreateType.
+type AdvisoryMutex struct {
+	TTL time.Duration
+	RetryDelay time.Duration
+
+	db *LogeDB
+	name LogeKey
+	holder string
+	token uint64
+}
+
+type lockRecord struct {
+	Holder string
+	Token uint64
+	Expires int64 // UnixNano
+}
+
+const lockTypeName = "_lock"
+
+var defaultLockTTL = 30 * time.Second
+
+func Mutex(db *LogeDB, name string) *AdvisoryMutex {
+	if db.Type(lockTypeName) == nil {
+		db.CreateType(NewTypeDef(lockTypeName, 1, &lockRecord{}))
+	}
+
+	var id = make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		panic(fmt.Sprintf("Lock holder ID: %v", err))
+	}
+	return &AdvisoryMutex{
+		TTL: defaultLockTTL,
+		RetryDelay: 100 * time.Millisecond,
+		db: db,
+		name: LogeKey(name),
+		holder: hex.EncodeToString(id),
+	}
+}
+
+// Takes the lock if it's free, expired or already ours, giving its
+// fencing token. Taking it again while held extends it.
+func (m *AdvisoryMutex) TryLock() (token uint64, ok bool) {
+	m.db.Transact(func (t *Transaction) {
+		var now = m.db.clock.Now()
+		var rec = t.Read(lockTypeName, m.name).(*lockRecord)
+		var next = &lockRecord{ Holder: m.holder, Expires: now.Add(m.TTL).UnixNano() }
+
+		switch {
+		case rec == nil:
+			next.Token = 1
+		case rec.Holder == m.holder && rec.Expires > now.UnixNano():
+			next.Token = rec.Token
+		case rec.Holder == "" || rec.Expires <= now.UnixNano():
+			next.Token = rec.Token + 1
+		default:
+			ok = false
+			return
+		}
+		t.Set(lockTypeName, m.name, next)
+		token, ok = next.Token, true
+	}, 0)
+
+	if ok {
+		m.token = token
+	}
+	return
+}
+
+// Waits for the lock, trying every RetryDelay, until ctx ends
+func (m *AdvisoryMutex) Lock(ctx context.Context) (uint64, error) {
+	for {
+		if token, ok := m.TryLock(); ok {
+			return token, nil
+		}
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		m.db.clock.Sleep(m.RetryDelay)
+	}
+}
+
+// Extends a held lock by TTL from now. False if it has been lost.
+func (m *AdvisoryMutex) Refresh() (ok bool) {
+	m.db.Transact(func (t *Transaction) {
+		ok = m.holds(t)
+		if ok {
+			var rec = t.Write(lockTypeName, m.name).(*lockRecord)
+			rec.Expires = m.db.clock.Now().Add(m.TTL).UnixNano()
+		}
+	}, 0)
+	return
+}
+
+// False if the lock had already been lost
+func (m *AdvisoryMutex) Unlock() (ok bool) {
+	m.db.Transact(func (t *Transaction) {
+		ok = m.holds(t)
+		if ok {
+			var rec = t.Write(lockTypeName, m.name).(*lockRecord)
+			rec.Holder = ""
+			rec.Expires = 0
+		}
+	}, 0)
+	return
+}
+
+// Whether token is the current, unexpired holder's, as t sees it
+func (m *AdvisoryMutex) Held(t *Transaction, token uint64) bool {
+	var rec = t.Read(lockTypeName, m.name).(*lockRecord)
+	return rec != nil && rec.Holder != "" && rec.Token == token &&
+		rec.Expires > m.db.clock.Now().UnixNano()
+}
+
+func (m *AdvisoryMutex) holds(t *Transaction) bool {
+	var rec = t.Read(lockTypeName, m.name).(*lockRecord)
+	return m.token != 0 && rec != nil && rec.Holder == m.holder && rec.Token == m.token &&
+		rec.Expires > m.db.clock.Now().UnixNano()
+}
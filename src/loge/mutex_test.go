@@ -0,0 +1,81 @@
+package loge
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Moves only when slept on or told to
+type manualClock struct {
+	lock sync.Mutex
+	now time.Time
+}
+
+func (c *manualClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *manualClock) Sleep(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestMutex(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	defer db.Close()
+	var clock = &manualClock{ now: time.Unix(1000, 0) }
+	db.SetClock(clock)
+
+	var a, b = Mutex(db, "job"), Mutex(db, "job")
+	a.TTL, b.TTL = time.Minute, time.Minute
+
+	token, ok := a.TryLock()
+	if !ok || token != 1 {
+		test.Fatalf("First lock failed: %d %v", token, ok)
+	}
+	if _, ok := b.TryLock(); ok {
+		test.Fatal("Held lock taken")
+	}
+	if again, ok := a.TryLock(); !ok || again != token {
+		test.Error("Holder couldn't take its lock again")
+	}
+
+	clock.Sleep(50 * time.Second)
+	if !a.Refresh() {
+		test.Error("Refresh failed")
+	}
+	clock.Sleep(50 * time.Second)
+	if _, ok := b.TryLock(); ok {
+		test.Error("Refreshed lock expired")
+	}
+
+	// a stalls past its TTL; b takes over with a new token
+	clock.Sleep(time.Minute)
+	var ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	newToken, err := b.Lock(ctx)
+	if err != nil || newToken != 2 {
+		test.Fatalf("Expired lock not taken: %d %v", newToken, err)
+	}
+
+	db.Transact(func (t *Transaction) {
+		if a.Held(t, token) || !b.Held(t, newToken) {
+			test.Error("Wrong fencing check")
+		}
+	}, 0)
+	if a.Refresh() || a.Unlock() {
+		test.Error("Lost lock still usable")
+	}
+
+	if !b.Unlock() {
+		test.Error("Unlock failed")
+	}
+	if token, ok := a.TryLock(); !ok || token != 3 {
+		test.Errorf("Released lock not taken: %d %v", token, ok)
+	}
+}
@@ -3,6 +3,7 @@ package loge
 import (
 	"fmt"
 	"reflect"
+	"sync/atomic"
 
 	"github.com/brendonh/spack"
 )
@@ -15,6 +16,8 @@ type logeObject struct {
 	RefCount uint32
 	LinkName string
 	Lock spinLock
+	committedID uint64
+	writeLock *writeLock
 }
 
 type objectVersion struct {
@@ -23,6 +26,9 @@ type objectVersion struct {
 	snapshotID uint64
 	Previous *objectVersion
 	loaded bool
+	// A link set's keys, decoded once for every transaction reading
+	// the version. See linkKeys.
+	links atomic.Pointer[linkList]
 }
 
 
@@ -36,6 +42,21 @@ func initializeObject(db *LogeDB, t *logeType, key LogeKey) *logeObject {
 	}
 }
 
+// An object coming back into the cache may have been committed after
+// snapshots which are still open. An unloaded version at its last
+// commit makes their writes to it conflict, as they would have if it
+// had stayed cached.
+func (obj *logeObject) restoreCommit(sID uint64) {
+	if sID == 0 {
+		return
+	}
+	obj.committedID = sID
+	obj.Current = &objectVersion{
+		LogeObj: obj,
+		snapshotID: sID,
+	}
+}
+
 func (obj *logeObject) makeObjRef() objRef {
 	if obj.LinkName != "" {
 		return makeLinkRef(obj.Type, obj.LinkName, obj.Key)
@@ -71,14 +92,47 @@ func (obj *logeObject) ensureVersion(sID uint64) *objectVersion {
 	}
 
 	newVersion.Previous = current
-	next.Previous = newVersion
+	if next == current {
+		// Newer than anything committed so far
+		obj.Current = newVersion
+	} else {
+		next.Previous = newVersion
+	}
 	
 	return newVersion
 }
 
+// Drops superseded versions other than the newest each of the pinned
+// snapshot IDs, in ascending order, can see. Under obj.Lock.
+func (obj *logeObject) dropVersions(pinned []uint64) int {
+	if obj.Current == nil {
+		return 0
+	}
+
+	var dropped = 0
+	var kept, newer = obj.Current, obj.Current
+	var next = len(pinned) - 1
+	for version := obj.Current.Previous; version != nil; version = version.Previous {
+		// Pins seeing newer versions are done with
+		for next >= 0 && pinned[next] >= newer.snapshotID {
+			next--
+		}
+		if next >= 0 && pinned[next] >= version.snapshotID {
+			kept.Previous = version
+			kept = version
+		} else {
+			dropped++
+		}
+		newer = version
+	}
+	kept.Previous = nil
+	return dropped
+}
+
 func (obj *logeObject) applyVersion(object interface{}, context transactionContext, sID uint64) {
 	var blob = obj.encode(object)
 
+	obj.committedID = sID
 	obj.Current = &objectVersion{
 		LogeObj: obj,
 		Blob: blob,
@@ -92,12 +146,16 @@ func (obj *logeObject) applyVersion(object interface{}, context transactionConte
 
 	if obj.LinkName != "" {
 		var links = object.(*linkSet)
-		
+
+		// Kept from the set, so neither reads nor counts decode it
+		var keys = linkList(links.ReadKeys())
+		obj.Current.links.Store(&keys)
+
 		for _, target := range links.Removed {
-			context.remIndex(makeLinkRef(obj.Type, obj.LinkName, LogeKey(target)), obj.Key)
+			context.remIndex(makeLinkRef(obj.Type, obj.LinkName, target), obj.Key)
 		}
 		for _, target := range links.Added {
-			context.addIndex(makeLinkRef(obj.Type, obj.LinkName, LogeKey(target)), obj.Key)
+			context.addIndex(makeLinkRef(obj.Type, obj.LinkName, target), obj.Key)
 		}
 	}
 }
@@ -106,14 +164,18 @@ func (obj *logeObject) decode(blob []byte, toJSON bool) (object interface{}, upg
 	if obj.LinkName == "" {
 		object, upgraded = obj.Type.Decode(blob, toJSON)
 	} else {
-		var links linkList
-		spack.DecodeFromBytes(&links, obj.DB.linkTypeSpec, blob)
-		object = &linkSet{ Original: links }
+		object = &linkSet{ Original: obj.decodeLinks(blob) }
 		upgraded = false
 	}
 	return
 }
 
+func (obj *logeObject) decodeLinks(blob []byte) linkList {
+	var links []string
+	spack.DecodeFromBytes(&links, obj.DB.linkTypeSpec, blob)
+	return storedLinks(links)
+}
+
 func (obj *logeObject) encode(object interface{}) []byte {
 	if !obj.hasValue(object) {
 		return nil
@@ -124,7 +186,7 @@ func (obj *logeObject) encode(object interface{}) []byte {
 	}
 
 	var set = object.(*linkSet)
-	enc, err := spack.EncodeToBytes(set.ReadKeys(), obj.DB.linkTypeSpec)
+	enc, err := spack.EncodeToBytes(linkList(set.ReadKeys()).strings(), obj.DB.linkTypeSpec)
 	if err != nil {
 		panic(fmt.Sprintf("Link encode error: %v\n", err))
 	}
@@ -137,5 +199,19 @@ func (obj *logeObject) hasValue(object interface{}) bool {
 
 
 func (version *objectVersion) getObject(toJSON bool) (interface{}, bool) {
+	if version.LogeObj.LinkName != "" && version.loaded {
+		return &linkSet{ Original: version.linkKeys() }, false
+	}
 	return version.LogeObj.decode(version.Blob, toJSON)
+}
+
+// Sets never modify Original in place, so the keys can be shared.
+// Racing readers may both decode them, which is harmless.
+func (version *objectVersion) linkKeys() linkList {
+	if keys := version.links.Load(); keys != nil {
+		return *keys
+	}
+	var keys = version.LogeObj.decodeLinks(version.Blob)
+	version.links.Store(&keys)
+	return keys
 }
\ No newline at end of file
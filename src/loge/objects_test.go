@@ -0,0 +1,103 @@
+package loge
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestVersionAboveCachedHead(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+	db.SetOne("test", "one", &TestObj{ "One" })
+
+	// Keeps "one" cached at an older snapshot
+	var old = db.CreateTransaction()
+	old.Read("test", "one")
+
+	db.SetOne("test", "two", &TestObj{ "Two" })
+	db.Transact(func (t *Transaction) {
+		t.Write("test", "one").(*TestObj).Name = "Uno"
+	}, 0)
+
+	var obj = db.cache[makeObjRef(db.types["test"], "one").String()]
+	var count = 0
+	for version := obj.Current; version != nil; version = version.Previous {
+		if count++; count > 10 {
+			test.Fatal("Version chain loops")
+		}
+		if version.Previous != nil && version.Previous.snapshotID >= version.snapshotID {
+			test.Fatalf("Version %d before %d", version.Previous.snapshotID, version.snapshotID)
+		}
+	}
+
+	if db.ReadOne("test", "one").(*TestObj).Name != "Uno" {
+		test.Error("Write over the cached head was lost")
+	}
+}
+
+// Fails every store read
+type failingStore struct {
+	LogeStore
+}
+
+type failingContext struct {
+	transactionContext
+}
+
+func (store *failingStore) newContext(ctx context.Context, sID uint64) transactionContext {
+	return &failingContext{ store.LogeStore.newContext(ctx, sID) }
+}
+
+func (context *failingContext) get(ref objRef) []byte {
+	panic(storeError("Read failed"))
+}
+
+func TestFailedLoadReleasesObject(test *testing.T) {
+	var db = NewLogeDB(&failingStore{ NewMemStore() })
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+
+	if _, err := db.TryReadOne("test", "one"); err == nil {
+		test.Fatal("Read didn't fail")
+	}
+	if db.Stats().CachedObjects != 0 {
+		test.Error("Failed read left the object cached")
+	}
+}
+
+// Most useful under -race
+func TestConcurrentTransactions(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "loge-objects")
+	defer os.RemoveAll(dir)
+
+	for _, store := range []LogeStore{ NewMemStore(), NewLevelDBStore(dir) } {
+		var db = NewLogeDB(store)
+		db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(writer bool) {
+				defer wg.Done()
+				for j := 0; j < 200; j++ {
+					var key = LogeKey(fmt.Sprintf("obj%d", j % 5))
+					if writer {
+						db.SetOne("test", key, &TestObj{ string(key) })
+					} else {
+						db.ReadOne("test", key)
+					}
+				}
+			}(i % 2 == 0)
+		}
+		wg.Wait()
+
+		var stats = db.Stats()
+		if stats.CachedObjects != 0 {
+			test.Errorf("%s: %d objects left cached", stats.Store, stats.CachedObjects)
+		}
+		db.Close()
+	}
+}
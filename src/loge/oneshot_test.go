@@ -46,12 +46,12 @@ func TestOneshotOps(test *testing.T) {
 	}
 
 	var fooLinks = db.ReadLinksOne("test", "other", "foo")
-	if !reflect.DeepEqual(fooLinks, []string{ "bar" }) {
+	if !reflect.DeepEqual(fooLinks, []LogeKey{ "bar" }) {
 		test.Errorf("Wrong one-shot links: %v", fooLinks)
 	}
 
 	var barLinks = db.ReadLinksOne("test", "other", "bar")
-	if !reflect.DeepEqual(barLinks, []string{ "foo" }) {
+	if !reflect.DeepEqual(barLinks, []LogeKey{ "foo" }) {
 		test.Errorf("Wrong one-shot links: %v", barLinks)
 	}
 
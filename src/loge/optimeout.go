@@ -0,0 +1,141 @@
+package loge
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Raised by an operation whose store calls took longer than the
+// transaction's operation timeout. It's also context.DeadlineExceeded.
+var ErrOpTimeout = fmt.Errorf("Store operation timed out: %w", context.DeadlineExceeded)
+
+// Caps how long each of a transaction's operations (a Read, Write,
+// Exists, ReadMany, Find and so on) may spend in the store, so a slow
+// store fails the request rather than hanging it. The operation panics
+// with ErrOpTimeout, as the Try* twins return it. Stores whose calls
+// watch the transaction's context give up when the time's up; others
+// are only interrupted between calls, and the operation fails once the
+// call returns. Zero for no limit, the default.
+func (db *LogeDB) SetOperationTimeout(timeout time.Duration) {
+	db.opTimeout = timeout
+}
+
+// Overrides the DB's for this transaction
+func (t *Transaction) SetOperationTimeout(timeout time.Duration) {
+	if t.opCtx != nil {
+		t.opCtx.setTimeout(timeout)
+	}
+}
+
+// Starts a store operation, arming the operation timeout until the
+// returned func is called, which panics if it ran out
+func (t *Transaction) operation() func() {
+	t.readLatest()
+	var ctx = t.opCtx
+	if ctx == nil || !ctx.begin() {
+		return func() {}
+	}
+	return func() {
+		if ctx.end() {
+			panic(fmt.Errorf("%w: %s", ErrOpTimeout, t))
+		}
+	}
+}
+
+// The context store contexts get, whose Done and Err follow the current
+// operation's deadline as well as the parent's
+type opContext struct {
+	context.Context
+	lock sync.Mutex
+	timeout time.Duration
+	depth int
+	done chan struct{}
+	expired bool
+	timer *time.Timer
+	stopParent func() bool
+}
+
+func newOpContext(parent context.Context, timeout time.Duration) *opContext {
+	return &opContext{ Context: parent, timeout: timeout }
+}
+
+func (ctx *opContext) setTimeout(timeout time.Duration) {
+	ctx.lock.Lock()
+	defer ctx.lock.Unlock()
+	ctx.timeout = timeout
+}
+
+func (ctx *opContext) Done() <-chan struct{} {
+	ctx.lock.Lock()
+	defer ctx.lock.Unlock()
+	if ctx.done == nil {
+		return ctx.Context.Done()
+	}
+	return ctx.done
+}
+
+func (ctx *opContext) Err() error {
+	if err := ctx.Context.Err(); err != nil {
+		return err
+	}
+	ctx.lock.Lock()
+	defer ctx.lock.Unlock()
+	if ctx.expired {
+		return ErrOpTimeout
+	}
+	return nil
+}
+
+// Whether it armed a deadline; nested operations share the outer one's
+func (ctx *opContext) begin() bool {
+	ctx.lock.Lock()
+	defer ctx.lock.Unlock()
+	if ctx.depth > 0 {
+		ctx.depth++
+		return true
+	}
+	if ctx.timeout <= 0 {
+		return false
+	}
+
+	ctx.depth = 1
+	var done = make(chan struct{})
+	ctx.done = done
+	ctx.expired = false
+	ctx.timer = time.AfterFunc(ctx.timeout, func () {
+		ctx.expire(done, true)
+	})
+	ctx.stopParent = context.AfterFunc(ctx.Context, func () {
+		ctx.expire(done, false)
+	})
+	return true
+}
+
+func (ctx *opContext) expire(done chan struct{}, timedOut bool) {
+	ctx.lock.Lock()
+	defer ctx.lock.Unlock()
+	if ctx.done != done || ctx.expired {
+		return
+	}
+	ctx.expired = timedOut
+	close(done)
+}
+
+// Whether the operation timed out
+func (ctx *opContext) end() bool {
+	ctx.lock.Lock()
+	defer ctx.lock.Unlock()
+	ctx.depth--
+	if ctx.depth > 0 {
+		return false
+	}
+
+	ctx.timer.Stop()
+	ctx.stopParent()
+	var expired = ctx.expired
+	ctx.done = nil
+	ctx.expired = false
+	return expired
+}
@@ -0,0 +1,38 @@
+package loge
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestOperationTimeout(test *testing.T) {
+	var store = NewFaultStore(NewMemStore())
+	var db = NewLogeDB(store)
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+	db.SetOne("test", "one", &TestObj{ "One" })
+	db.SetOperationTimeout(10 * time.Millisecond)
+
+	store.Script(FaultGet, Fault{ Delay: 50 * time.Millisecond })
+	var t = db.CreateTransaction()
+	if _, err := t.TryRead("test", "one"); !errors.Is(err, ErrOpTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		test.Errorf("Slow read didn't time out: %v", err)
+	}
+
+	// Later operations get their own time
+	if obj, err := t.TryRead("test", "one"); err != nil || obj.(*TestObj).Name != "One" {
+		test.Errorf("Read after timeout failed: %v", err)
+	}
+	if !t.Commit() {
+		test.Error("Commit after timeout failed")
+	}
+
+	store.Script(FaultGet, Fault{ Delay: 50 * time.Millisecond })
+	t = db.CreateTransaction()
+	t.SetOperationTimeout(0)
+	if _, err := t.TryRead("test", "one"); err != nil {
+		test.Errorf("Read without timeout failed: %v", err)
+	}
+	t.Abort()
+}
@@ -0,0 +1,558 @@
+package loge
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Writes every object of a type to w as a Parquet file, one row per
+// object, for loading into DuckDB, Spark and the like. Returns how many
+// rows were written.
+//
+// The first column is the object's key. Struct fields become columns,
+// nested structs flattened with their names joined by "_" (Address_City).
+// Numbers, bools, strings, []byte and time.Time (as a microsecond
+// timestamp) map onto Parquet types; pointers to them are nullable.
+// Anything else, such as slices and maps, is written as a nullable JSON
+// column. Links aren't exported.
+//
+// Objects are read from one snapshot, in row groups of ParquetRowGroup
+// objects, uncompressed. The store has to support List.
+func (db *LogeDB) ExportParquet(typeName string, w io.Writer) (rows int, err error) {
+	defer recoverError(&err)
+
+	var typ = db.lookupType(typeName)
+	var pw = newParquetWriter(w, parquetColumns(reflect.TypeOf(typ.Exemplar)))
+
+	var snap = db.Snapshot()
+	defer snap.Release()
+
+	var after LogeKey
+	var done = false
+	for !done && pw.out.err == nil {
+		done = true
+		snap.View(func (t *Transaction) {
+			var it = t.Iter(typeName)
+			defer it.Close()
+			var count = 0
+			for it.Seek(after); it.Valid(); it.Next() {
+				if it.Key() == after && after != "" {
+					continue
+				}
+				if count == ParquetRowGroup {
+					done = false
+					return
+				}
+				pw.add(it.Key(), it.Value())
+				after = it.Key()
+				count++
+			}
+		})
+		pw.flushRowGroup()
+	}
+
+	pw.close()
+	return int(pw.rows), pw.out.err
+}
+
+var ParquetRowGroup = 10000
+
+// -----------------------------------------------
+// Columns
+// -----------------------------------------------
+
+// Parquet's physical types
+const (
+	pqBoolean int32 = 0
+	pqInt32 = 1
+	pqInt64 = 2
+	pqFloat = 4
+	pqDouble = 5
+	pqByteArray = 6
+)
+
+// Converted (logical) types
+const (
+	pqNone int32 = -1
+	pqUTF8 = 0
+	pqTimestampMicros = 10
+	pqUint8 = 11
+	pqUint16 = 12
+	pqUint32 = 13
+	pqUint64 = 14
+	pqInt8 = 15
+	pqInt16 = 16
+	pqJSON = 19
+)
+
+const (
+	pqPlain int32 = 0
+	pqRLE = 3
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+type parquetColumn struct {
+	name string
+	index []int // nil for the key
+	physical int32
+	converted int32
+	optional bool
+	json bool
+
+	values bytes.Buffer
+	bools []bool
+	defined []bool
+}
+
+type parquetChunk struct {
+	offset int64
+	size int64
+	values int64
+}
+
+func parquetColumns(objType reflect.Type) []*parquetColumn {
+	var columns []*parquetColumn
+	if objType.Kind() == reflect.Ptr && objType.Elem().Kind() == reflect.Struct {
+		columns = flattenColumns(objType.Elem(), nil, "")
+	} else {
+		columns = []*parquetColumn{ { name: "value", index: []int{}, physical: pqByteArray, converted: pqJSON, optional: true, json: true } }
+	}
+
+	var keyName = "key"
+	for _, column := range columns {
+		if strings.EqualFold(column.name, keyName) {
+			keyName = "_key"
+		}
+	}
+	var key = &parquetColumn{ name: keyName, physical: pqByteArray, converted: pqUTF8 }
+	return append([]*parquetColumn{ key }, columns...)
+}
+
+func flattenColumns(structType reflect.Type, index []int, prefix string) []*parquetColumn {
+	var columns []*parquetColumn
+	for i := 0; i < structType.NumField(); i++ {
+		var field = structType.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		var fieldIndex = append(append([]int{}, index...), i)
+		var name = prefix + field.Name
+
+		if field.Type.Kind() == reflect.Struct && field.Type != timeType {
+			columns = append(columns, flattenColumns(field.Type, fieldIndex, name + "_")...)
+			continue
+		}
+
+		var column = &parquetColumn{ name: name, index: fieldIndex }
+		var fieldType = field.Type
+		if fieldType.Kind() == reflect.Ptr && (fieldType.Elem().Kind() != reflect.Struct || fieldType.Elem() == timeType) {
+			column.optional = true
+			fieldType = fieldType.Elem()
+		}
+		if !column.setType(fieldType) {
+			continue
+		}
+		columns = append(columns, column)
+	}
+	return columns
+}
+
+// False for fields which can't be exported at all
+func (column *parquetColumn) setType(fieldType reflect.Type) bool {
+	column.converted = pqNone
+	switch fieldType.Kind() {
+	case reflect.Bool:
+		column.physical = pqBoolean
+	case reflect.Int8:
+		column.physical, column.converted = pqInt32, pqInt8
+	case reflect.Int16:
+		column.physical, column.converted = pqInt32, pqInt16
+	case reflect.Int32:
+		column.physical = pqInt32
+	case reflect.Int, reflect.Int64:
+		column.physical = pqInt64
+	case reflect.Uint8:
+		column.physical, column.converted = pqInt32, pqUint8
+	case reflect.Uint16:
+		column.physical, column.converted = pqInt32, pqUint16
+	case reflect.Uint32:
+		column.physical, column.converted = pqInt32, pqUint32
+	case reflect.Uint, reflect.Uint64:
+		column.physical, column.converted = pqInt64, pqUint64
+	case reflect.Float32:
+		column.physical = pqFloat
+	case reflect.Float64:
+		column.physical = pqDouble
+	case reflect.String:
+		column.physical, column.converted = pqByteArray, pqUTF8
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer, reflect.Complex64, reflect.Complex128:
+		return false
+	default:
+		if fieldType == timeType {
+			column.physical, column.converted = pqInt64, pqTimestampMicros
+		} else if fieldType.Kind() == reflect.Slice && fieldType.Elem().Kind() == reflect.Uint8 {
+			column.physical = pqByteArray
+			column.optional = true
+		} else {
+			column.physical, column.converted = pqByteArray, pqJSON
+			column.optional = true
+			column.json = true
+		}
+	}
+	return true
+}
+
+func (column *parquetColumn) add(key LogeKey, obj reflect.Value) {
+	if column.index == nil {
+		column.writeBytes([]byte(key))
+		return
+	}
+
+	var value = obj
+	if len(column.index) > 0 {
+		value = obj.Elem().FieldByIndex(column.index)
+	}
+
+	if column.json {
+		if value.Kind() != reflect.Array && value.IsNil() {
+			column.defined = append(column.defined, false)
+			return
+		}
+		enc, err := json.Marshal(value.Interface())
+		if err != nil {
+			panic(storeError("Encoding %s: %v", column.name, err))
+		}
+		column.defined = append(column.defined, true)
+		column.writeBytes(enc)
+		return
+	}
+
+	if column.optional {
+		var null = value.IsNil()
+		column.defined = append(column.defined, !null)
+		if null {
+			return
+		}
+		if value.Kind() == reflect.Ptr {
+			value = value.Elem()
+		}
+	}
+
+	switch column.physical {
+	case pqBoolean:
+		column.bools = append(column.bools, value.Bool())
+	case pqInt32:
+		var n int32
+		if value.CanInt() {
+			n = int32(value.Int())
+		} else {
+			n = int32(value.Uint())
+		}
+		binary.Write(&column.values, binary.LittleEndian, n)
+	case pqInt64:
+		var n int64
+		switch {
+		case value.Type() == timeType:
+			n = value.Interface().(time.Time).UnixMicro()
+		case value.CanInt():
+			n = value.Int()
+		default:
+			n = int64(value.Uint())
+		}
+		binary.Write(&column.values, binary.LittleEndian, n)
+	case pqFloat:
+		binary.Write(&column.values, binary.LittleEndian, math.Float32bits(float32(value.Float())))
+	case pqDouble:
+		binary.Write(&column.values, binary.LittleEndian, math.Float64bits(value.Float()))
+	case pqByteArray:
+		if value.Kind() == reflect.String {
+			column.writeBytes([]byte(value.String()))
+		} else {
+			column.writeBytes(value.Bytes())
+		}
+	}
+}
+
+func (column *parquetColumn) writeBytes(b []byte) {
+	binary.Write(&column.values, binary.LittleEndian, uint32(len(b)))
+	column.values.Write(b)
+}
+
+// One PLAIN data page holding the buffered values, with definition
+// levels first if the column is nullable
+func (column *parquetColumn) page(rows int) []byte {
+	var data bytes.Buffer
+	if column.optional {
+		var levels = bitPack(column.defined)
+		var header = binaryUvarint(uint64(len(levels)) << 1 | 1)
+		binary.Write(&data, binary.LittleEndian, uint32(len(header) + len(levels)))
+		data.Write(header)
+		data.Write(levels)
+	}
+	if column.physical == pqBoolean {
+		data.Write(bitPack(column.bools))
+	} else {
+		data.Write(column.values.Bytes())
+	}
+
+	var header thriftWriter
+	header.i32(1, 0) // DATA_PAGE
+	header.i32(2, int32(data.Len()))
+	header.i32(3, int32(data.Len()))
+	header.beginStruct(5)
+	header.i32(1, int32(rows))
+	header.i32(2, pqPlain)
+	header.i32(3, pqRLE)
+	header.i32(4, pqRLE)
+	header.endStruct()
+	header.end()
+
+	column.values.Reset()
+	column.bools = column.bools[:0]
+	column.defined = column.defined[:0]
+	return append(header.buf.Bytes(), data.Bytes()...)
+}
+
+func bitPack(bits []bool) []byte {
+	var packed = make([]byte, (len(bits) + 7) / 8)
+	for i, bit := range bits {
+		if bit {
+			packed[i / 8] |= 1 << uint(i % 8)
+		}
+	}
+	return packed
+}
+
+func binaryUvarint(n uint64) []byte {
+	var buf = make([]byte, binary.MaxVarintLen64)
+	return buf[:binary.PutUvarint(buf, n)]
+}
+
+// -----------------------------------------------
+// File
+// -----------------------------------------------
+
+var parquetMagic = []byte("PAR1")
+
+type parquetWriter struct {
+	out *countingWriter
+	columns []*parquetColumn
+	groupRows int
+	rows int64
+	groups [][]parquetChunk
+	groupSizes []int64
+}
+
+type countingWriter struct {
+	w io.Writer
+	offset int64
+	err error
+}
+
+func (cw *countingWriter) Write(b []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	n, err := cw.w.Write(b)
+	cw.offset += int64(n)
+	cw.err = err
+	return n, err
+}
+
+func newParquetWriter(w io.Writer, columns []*parquetColumn) *parquetWriter {
+	var pw = &parquetWriter{
+		out: &countingWriter{ w: w },
+		columns: columns,
+	}
+	pw.out.Write(parquetMagic)
+	return pw
+}
+
+func (pw *parquetWriter) add(key LogeKey, obj interface{}) {
+	var value = reflect.ValueOf(obj)
+	if value.Kind() == reflect.Ptr && value.IsNil() {
+		return
+	}
+	for _, column := range pw.columns {
+		column.add(key, value)
+	}
+	pw.groupRows++
+}
+
+func (pw *parquetWriter) flushRowGroup() {
+	if pw.groupRows == 0 {
+		return
+	}
+
+	var chunks = make([]parquetChunk, len(pw.columns))
+	var size int64
+	for i, column := range pw.columns {
+		var page = column.page(pw.groupRows)
+		chunks[i] = parquetChunk{ pw.out.offset, int64(len(page)), int64(pw.groupRows) }
+		pw.out.Write(page)
+		size += int64(len(page))
+	}
+
+	pw.groups = append(pw.groups, chunks)
+	pw.groupSizes = append(pw.groupSizes, size)
+	pw.rows += int64(pw.groupRows)
+	pw.groupRows = 0
+}
+
+func (pw *parquetWriter) close() {
+	var meta thriftWriter
+	meta.i32(1, 1)
+
+	meta.beginList(2, thriftStruct, len(pw.columns) + 1)
+	meta.begin()
+	meta.binary(4, []byte("schema"))
+	meta.i32(5, int32(len(pw.columns)))
+	meta.end()
+	for _, column := range pw.columns {
+		meta.begin()
+		meta.i32(1, column.physical)
+		if column.optional {
+			meta.i32(3, 1)
+		} else {
+			meta.i32(3, 0)
+		}
+		meta.binary(4, []byte(column.name))
+		if column.converted != pqNone {
+			meta.i32(6, column.converted)
+		}
+		meta.end()
+	}
+
+	meta.i64(3, pw.rows)
+
+	meta.beginList(4, thriftStruct, len(pw.groups))
+	for g, chunks := range pw.groups {
+		meta.begin()
+		meta.beginList(1, thriftStruct, len(chunks))
+		for i, chunk := range chunks {
+			var column = pw.columns[i]
+			meta.begin()
+			meta.i64(2, chunk.offset)
+			meta.beginStruct(3)
+			meta.i32(1, column.physical)
+			meta.beginList(2, thriftI32, 2)
+			meta.listI32(pqPlain)
+			meta.listI32(pqRLE)
+			meta.beginList(3, thriftBinary, 1)
+			meta.listBinary([]byte(column.name))
+			meta.i32(4, 0) // UNCOMPRESSED
+			meta.i64(5, chunk.values)
+			meta.i64(6, chunk.size)
+			meta.i64(7, chunk.size)
+			meta.i64(9, chunk.offset)
+			meta.endStruct()
+			meta.end()
+		}
+		meta.i64(2, pw.groupSizes[g])
+		meta.i64(3, chunks[0].values)
+		meta.end()
+	}
+
+	meta.binary(6, []byte("loge"))
+	meta.end()
+
+	pw.out.Write(meta.buf.Bytes())
+	binary.Write(pw.out, binary.LittleEndian, uint32(meta.buf.Len()))
+	pw.out.Write(parquetMagic)
+}
+
+// -----------------------------------------------
+// Thrift compact protocol, as much as Parquet's metadata needs
+// -----------------------------------------------
+
+const (
+	thriftI32 byte = 5
+	thriftI64 = 6
+	thriftBinary = 8
+	thriftList = 9
+	thriftStruct = 12
+)
+
+type thriftWriter struct {
+	buf bytes.Buffer
+	field int16
+	stack []int16
+}
+
+func (t *thriftWriter) header(id int16, typ byte) {
+	if delta := id - t.field; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta) << 4 | typ)
+	} else {
+		t.buf.WriteByte(typ)
+		t.varint(int64(id))
+	}
+	t.field = id
+}
+
+func (t *thriftWriter) varint(n int64) {
+	t.buf.Write(binaryUvarint(uint64(n << 1 ^ n >> 63)))
+}
+
+func (t *thriftWriter) i32(id int16, n int32) {
+	t.header(id, thriftI32)
+	t.varint(int64(n))
+}
+
+func (t *thriftWriter) i64(id int16, n int64) {
+	t.header(id, thriftI64)
+	t.varint(n)
+}
+
+func (t *thriftWriter) binary(id int16, b []byte) {
+	t.header(id, thriftBinary)
+	t.listBinary(b)
+}
+
+func (t *thriftWriter) beginList(id int16, elem byte, size int) {
+	t.header(id, thriftList)
+	if size < 15 {
+		t.buf.WriteByte(byte(size) << 4 | elem)
+	} else {
+		t.buf.WriteByte(0xF0 | elem)
+		t.buf.Write(binaryUvarint(uint64(size)))
+	}
+}
+
+func (t *thriftWriter) listI32(n int32) {
+	t.varint(int64(n))
+}
+
+func (t *thriftWriter) listBinary(b []byte) {
+	t.buf.Write(binaryUvarint(uint64(len(b))))
+	t.buf.Write(b)
+}
+
+func (t *thriftWriter) beginStruct(id int16) {
+	t.header(id, thriftStruct)
+	t.begin()
+}
+
+func (t *thriftWriter) endStruct() {
+	t.end()
+}
+
+// Starts a struct which isn't a field, i.e. a list element
+func (t *thriftWriter) begin() {
+	t.stack = append(t.stack, t.field)
+	t.field = 0
+}
+
+func (t *thriftWriter) end() {
+	t.buf.WriteByte(0)
+	if n := len(t.stack); n > 0 {
+		t.field = t.stack[n - 1]
+		t.stack = t.stack[:n - 1]
+	}
+}
@@ -0,0 +1,221 @@
+package loge
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"os"
+	"testing"
+)
+
+type parquetAddress struct {
+	City string
+}
+
+type parquetObj struct {
+	Name string
+	Age int
+	Score float64
+	Active bool
+	Nick *string
+	Tags []string
+	Address parquetAddress
+}
+
+func TestExportParquet(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "loge-parquet")
+	defer os.RemoveAll(dir)
+
+	var db = NewLogeDB(NewLevelDBStore(dir))
+	defer db.Close()
+	db.CreateType(NewTypeDef("test", 1, &parquetObj{}))
+
+	var nick = "bb"
+	db.Transact(func (t *Transaction) {
+		t.Set("test", "a", &parquetObj{ Name: "Alice", Age: 30, Score: 1.5, Active: true, Tags: []string{ "x" } })
+		t.Set("test", "b", &parquetObj{ Name: "Bob", Age: 40, Nick: &nick, Address: parquetAddress{ "Leeds" } })
+		t.Set("test", "c", &parquetObj{ Name: "Carol", Age: 50, Active: true })
+	}, 0)
+
+	var defaultGroup = ParquetRowGroup
+	ParquetRowGroup = 2
+	defer func() { ParquetRowGroup = defaultGroup }()
+
+	var buf bytes.Buffer
+	rows, err := db.ExportParquet("test", &buf)
+	if err != nil || rows != 3 {
+		test.Fatalf("Export failed: %d, %v", rows, err)
+	}
+
+	var file = buf.Bytes()
+	if !bytes.HasPrefix(file, parquetMagic) || !bytes.HasSuffix(file, parquetMagic) {
+		test.Fatal("Missing magic")
+	}
+	var metaLen = int(binary.LittleEndian.Uint32(file[len(file) - 8:]))
+	var meta = (&thriftReader{ b: file[len(file) - 8 - metaLen:len(file) - 8] }).readStruct()
+
+	if meta[3].(int64) != 3 {
+		test.Errorf("Wrong row count: %v", meta[3])
+	}
+
+	var names []string
+	for _, elem := range meta[2].([]interface{})[1:] {
+		names = append(names, string(elem.(map[int16]interface{})[4].([]byte)))
+	}
+	var want = []string{ "key", "Name", "Age", "Score", "Active", "Nick", "Tags", "Address_City" }
+	if len(names) != len(want) {
+		test.Fatalf("Wrong columns: %v", names)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			test.Fatalf("Wrong columns: %v", names)
+		}
+	}
+
+	var groups = meta[4].([]interface{})
+	if len(groups) != 2 {
+		test.Fatalf("Wrong row groups: %d", len(groups))
+	}
+
+	var column = func(i int) (values [][]byte, defined []bool) {
+		for _, group := range groups {
+			var chunk = group.(map[int16]interface{})[1].([]interface{})[i].(map[int16]interface{})
+			var chunkMeta = chunk[3].(map[int16]interface{})
+			var r = &thriftReader{ b: file, pos: int(chunkMeta[9].(int64)) }
+			var header = r.readStruct()
+			var count = int(header[5].(map[int16]interface{})[1].(int64))
+			var data = file[r.pos:r.pos + int(header[3].(int64))]
+			v, d := readPlainPage(data, count, int(chunkMeta[1].(int64)), names[i] == "Nick" || names[i] == "Tags")
+			values = append(values, v...)
+			defined = append(defined, d...)
+		}
+		return
+	}
+
+	keys, _ := column(0)
+	if string(keys[0]) != "a" || string(keys[2]) != "c" {
+		test.Errorf("Wrong keys: %q", keys)
+	}
+	ages, _ := column(2)
+	if int64(binary.LittleEndian.Uint64(ages[1])) != 40 {
+		test.Errorf("Wrong ages: %v", ages)
+	}
+	scores, _ := column(3)
+	if math.Float64frombits(binary.LittleEndian.Uint64(scores[0])) != 1.5 {
+		test.Errorf("Wrong scores: %v", scores)
+	}
+	active, _ := column(4)
+	if active[0][0] != 1 || active[1][0] != 0 || active[2][0] != 1 {
+		test.Errorf("Wrong bools: %v", active)
+	}
+	nicks, defined := column(5)
+	if len(nicks) != 1 || string(nicks[0]) != "bb" || defined[0] || !defined[1] || defined[2] {
+		test.Errorf("Wrong nullable column: %q %v", nicks, defined)
+	}
+	tags, _ := column(6)
+	if len(tags) != 1 || string(tags[0]) != `["x"]` {
+		test.Errorf("Wrong JSON column: %q", tags)
+	}
+	cities, _ := column(7)
+	if string(cities[1]) != "Leeds" {
+		test.Errorf("Wrong nested column: %q", cities)
+	}
+}
+
+// Splits a PLAIN page into its values, one byte for bools, with the
+// definition levels of a nullable column
+func readPlainPage(data []byte, count int, physical int, optional bool) (values [][]byte, defined []bool) {
+	var present = count
+	if optional {
+		var levelsLen = int(binary.LittleEndian.Uint32(data))
+		var levels = data[4:4 + levelsLen]
+		_, n := binary.Uvarint(levels)
+		present = 0
+		for i := 0; i < count; i++ {
+			var bit = levels[n + i / 8] & (1 << uint(i % 8)) != 0
+			defined = append(defined, bit)
+			if bit {
+				present++
+			}
+		}
+		data = data[4 + levelsLen:]
+	}
+
+	for i := 0; i < present; i++ {
+		switch int32(physical) {
+		case pqBoolean:
+			values = append(values, []byte{ (data[i / 8] >> uint(i % 8)) & 1 })
+		case pqInt64, pqDouble:
+			values = append(values, data[:8])
+			data = data[8:]
+		case pqByteArray:
+			var n = int(binary.LittleEndian.Uint32(data))
+			values = append(values, data[4:4 + n])
+			data = data[4 + n:]
+		}
+	}
+	return
+}
+
+type thriftReader struct {
+	b []byte
+	pos int
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	n, size := binary.Uvarint(r.b[r.pos:])
+	r.pos += size
+	return n
+}
+
+func (r *thriftReader) zigzag() int64 {
+	var n = r.uvarint()
+	return int64(n >> 1) ^ -int64(n & 1)
+}
+
+func (r *thriftReader) readStruct() map[int16]interface{} {
+	var fields = make(map[int16]interface{})
+	var last int16
+	for {
+		var b = r.b[r.pos]
+		r.pos++
+		if b == 0 {
+			return fields
+		}
+		var id = last + int16(b >> 4)
+		if b >> 4 == 0 {
+			id = int16(r.zigzag())
+		}
+		last = id
+		fields[id] = r.value(b & 0x0F)
+	}
+}
+
+func (r *thriftReader) value(typ byte) interface{} {
+	switch typ {
+	case 1, 2:
+		return typ == 1
+	case thriftI32, thriftI64:
+		return r.zigzag()
+	case thriftBinary:
+		var n = int(r.uvarint())
+		r.pos += n
+		return r.b[r.pos - n:r.pos]
+	case thriftList:
+		var header = r.b[r.pos]
+		r.pos++
+		var size = int(header >> 4)
+		if size == 15 {
+			size = int(r.uvarint())
+		}
+		var list = make([]interface{}, size)
+		for i := range list {
+			list[i] = r.value(header & 0x0F)
+		}
+		return list
+	case thriftStruct:
+		return r.readStruct()
+	}
+	panic("Unexpected thrift type")
+}
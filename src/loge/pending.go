@@ -0,0 +1,87 @@
+package loge
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// A write staged in a transaction, for tests and debugging. Before is
+// the version the transaction started from (nil if the object didn't
+// exist), After what it will commit (nil to delete). For links both are
+// key lists.
+type PendingChange struct {
+	Type string
+	Key LogeKey
+	Link string
+	Before interface{}
+	After interface{}
+}
+
+func (pc PendingChange) String() string {
+	var name = fmt.Sprintf("%s/%s", pc.Type, pc.Key)
+	if pc.Link != "" {
+		name = fmt.Sprintf("%s.%s", name, pc.Link)
+	}
+	switch {
+	case pc.Before == nil:
+		return fmt.Sprintf("create %s: %+v", name, pc.After)
+	case pc.After == nil:
+		return fmt.Sprintf("delete %s: %+v", name, pc.Before)
+	}
+	return fmt.Sprintf("update %s: %+v -> %+v", name, pc.Before, pc.After)
+}
+
+// In key order, i.e. the order commit locks them in
+func (t *Transaction) Pending() []PendingChange {
+	var pending = make([]PendingChange, 0)
+	for _, lv := range t.liveVersions() {
+		if !lv.dirty {
+			continue
+		}
+		var obj = lv.version.LogeObj
+
+		var blob = lv.version.Blob
+		if !lv.version.loaded {
+			blob = t.context.get(obj.makeObjRef())
+		}
+		before, _ := obj.decode(blob, t.giveJSON)
+
+		var change = PendingChange{
+			Type: obj.Type.Name,
+			Key: obj.Key,
+			Link: obj.LinkName,
+		}
+
+		if obj.LinkName != "" {
+			if keys := before.(*linkSet).ReadKeys(); len(keys) > 0 {
+				change.Before = keys
+			}
+			if keys := lv.object.(*linkSet).ReadKeys(); len(keys) > 0 {
+				change.After = keys
+			}
+		} else {
+			// JSON transactions decode missing objects to plain nil
+			if before != nil && obj.hasValue(before) {
+				change.Before = before
+			}
+			if lv.object != nil && obj.hasValue(lv.object) {
+				change.After = lv.object
+			}
+		}
+
+		if change.Before != nil || change.After != nil {
+			pending = append(pending, change)
+		}
+	}
+	return pending
+}
+
+// Multi-line description of the transaction and its pending changes
+func (t *Transaction) Dump() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s at snapshot %d\n", t, t.snapshotID)
+	for _, change := range t.Pending() {
+		fmt.Fprintf(&buf, "  %s\n", change)
+	}
+	return buf.String()
+}
@@ -0,0 +1,50 @@
+package loge
+
+import (
+	"testing"
+	"reflect"
+	"strings"
+)
+
+func TestPending(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	var def = NewTypeDef("test", 1, &TestObj{})
+	def.Links = LinkSpec{ "other": "test" }
+	db.CreateType(def)
+	db.SetOne("test", "one", &TestObj{ "One" })
+	db.SetOne("test", "two", &TestObj{ "Two" })
+
+	var t = db.CreateTransaction()
+	t.Read("test", "two")
+	t.Write("test", "one").(*TestObj).Name = "Uno"
+	t.Delete("test", "two")
+	t.Set("test", "three", &TestObj{ "Three" })
+	t.AddLink("test", "other", "one", "three")
+
+	var pending = t.Pending()
+	if len(pending) != 4 {
+		test.Fatalf("Wrong pending count: %v", pending)
+	}
+
+	var byName = make(map[string]PendingChange)
+	for _, change := range pending {
+		byName[string(change.Key) + change.Link] = change
+	}
+	if byName["one"].Before.(*TestObj).Name != "One" || byName["one"].After.(*TestObj).Name != "Uno" {
+		test.Errorf("Wrong update: %v", byName["one"])
+	}
+	if byName["two"].After != nil || byName["three"].Before != nil {
+		test.Errorf("Wrong delete or create: %v %v", byName["two"], byName["three"])
+	}
+	if !reflect.DeepEqual(byName["oneother"].After, []LogeKey{ "three" }) {
+		test.Errorf("Wrong link change: %v", byName["oneother"])
+	}
+
+	var dump = t.Dump()
+	for _, want := range []string{ "update test/one", "delete test/two", "create test/three", "create test/one.other" } {
+		if !strings.Contains(dump, want) {
+			test.Errorf("Dump missing %q:\n%s", want, dump)
+		}
+	}
+	t.Commit()
+}
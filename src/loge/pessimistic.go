@@ -0,0 +1,114 @@
+package loge
+
+// Write, holding the object exclusively until the transaction commits
+// or is cancelled, for objects so contended that retrying conflicts
+// costs more than waiting:
+//
+//   db.Transact(func (t *loge.Transaction) {
+//       t.WriteLocked("counter", "hits").(*Counter).Value++
+//   }, 0)
+//
+// Waits while another transaction holds the lock, then gives the latest
+// committed object rather than the one at the transaction's snapshot,
+// so no commit can conflict with it: other transactions' commits which
+// write it while it's locked are aborted instead. Unless the object was
+// already written in this transaction, in which case a commit made since
+// still aborts this one.
+//
+// Transactions locking several objects should lock them in the same
+// order, or use a context with a deadline: the wait ends with the
+// context's error.
+func (t *Transaction) WriteLocked(typeName string, key LogeKey) interface{} {
+	var ref = t.db.makeObjRef(typeName, key)
+	var prior, had = t.versions[ref.CacheKey]
+	var written = had && prior.dirty
+
+	var lv = t.getVersion(ref, true, true)
+	if lv.locked {
+		return lv.object
+	}
+
+	if err := lv.version.LogeObj.lockWrites(t); err != nil {
+		panic(err)
+	}
+	lv.locked = true
+	lv.current = t.refresh(lv, written)
+	return lv.object
+}
+
+type writeLock struct {
+	holder *Transaction
+	released chan struct{}
+}
+
+func (obj *logeObject) lockWrites(t *Transaction) error {
+	for {
+		obj.Lock.SpinLock()
+		var lock = obj.writeLock
+		if lock == nil {
+			obj.writeLock = &writeLock{ t, make(chan struct{}) }
+			obj.Lock.Unlock()
+			return nil
+		}
+		obj.Lock.Unlock()
+
+		select {
+		case <-lock.released:
+		case <-t.ctx.Done():
+			return t.ctx.Err()
+		}
+	}
+}
+
+// Whether another transaction holds the object. Under obj.Lock.
+func (obj *logeObject) lockedAgainst(t *Transaction) bool {
+	return obj.writeLock != nil && obj.writeLock.holder != t
+}
+
+// Replaces the snapshot's object with the latest committed one, unless
+// the transaction has already written it, in which case a commit since
+// the snapshot still conflicts. Whether it's safe from conflicts.
+func (t *Transaction) refresh(lv *liveVersion, written bool) bool {
+	var obj = lv.version.LogeObj
+
+	obj.Lock.SpinLock()
+	var stale = obj.committedID > lv.version.snapshotID
+	obj.Lock.Unlock()
+
+	if !stale {
+		return true
+	}
+	if written {
+		return false
+	}
+
+	var _, context = t.db.currentContext(t.ctx)
+	var blob = context.get(obj.makeObjRef())
+	context.rollback()
+
+	var object interface{} = obj.Type.NilValue()
+	if len(blob) > 0 {
+		object, _ = obj.decode(blob, t.giveJSON)
+	}
+	obj.populateMeta(object, t.snapshotID)
+	lv.object = object
+	return true
+}
+
+// Once the transaction is done, whether committed or not
+func (t *Transaction) unlockWrites() {
+	for _, lv := range t.versions {
+		if !lv.locked {
+			continue
+		}
+		var obj = lv.version.LogeObj
+		obj.Lock.SpinLock()
+		if obj.writeLock != nil && obj.writeLock.holder == t {
+			close(obj.writeLock.released)
+			obj.writeLock = nil
+		}
+		obj.Lock.Unlock()
+		lv.locked = false
+		lv.current = false
+	}
+}
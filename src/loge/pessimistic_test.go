@@ -0,0 +1,83 @@
+package loge
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWriteLocked(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	db.CreateType(NewTypeDef("counters", 1, &TestCounter{}))
+	db.SetOne("counters", "one", &TestCounter{ 0 })
+	db.SetRetryPolicy(RetryPolicy{ MaxAttempts: 1 })
+
+	var group sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			for j := 0; j < 50; j++ {
+				if !db.Transact(func (t *Transaction) {
+					t.WriteLocked("counters", "one").(*TestCounter).Value++
+				}, 0) {
+					test.Error("Locked increment conflicted")
+				}
+			}
+		}()
+	}
+	group.Wait()
+
+	if count := db.ReadOne("counters", "one").(*TestCounter).Value; count != 400 {
+		test.Errorf("Wrong count: %d", count)
+	}
+}
+
+func TestWriteLockedConflicts(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+	db.SetOne("test", "one", &TestObj{ "One" })
+
+	// Committed since the snapshot, so refreshed
+	var locker = db.CreateTransaction()
+	locker.Read("test", "two")
+	db.SetOne("test", "one", &TestObj{ "Two" })
+	var obj = locker.WriteLocked("test", "one").(*TestObj)
+	if obj.Name != "Two" {
+		test.Errorf("Stale locked object: %v", obj.Name)
+	}
+
+	var other = db.CreateTransaction()
+	other.Write("test", "one").(*TestObj).Name = "Other"
+	if other.Commit() || !errors.Is(other.Err(), ErrConflict) {
+		test.Error("Commit over locked object")
+	}
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 10 * time.Millisecond)
+	defer cancel()
+	var waiter = db.CreateTransactionContext(ctx)
+	if _, err := waiter.TryWriteLocked("test", "one"); !errors.Is(err, context.DeadlineExceeded) {
+		test.Errorf("Wrong error waiting for lock: %v", err)
+	}
+	waiter.Abort()
+
+	obj.Name = "Three"
+	if !locker.Commit() {
+		test.Fatal("Locked commit failed")
+	}
+	if db.ReadOne("test", "one").(*TestObj).Name != "Three" {
+		test.Error("Locked write not committed")
+	}
+
+	// Released on abort too
+	locker = db.CreateTransaction()
+	locker.WriteLocked("test", "one")
+	locker.Abort()
+	other = db.CreateTransaction()
+	other.WriteLocked("test", "one").(*TestObj).Name = "Four"
+	if !other.Commit() {
+		test.Error("Lock not released by abort")
+	}
+}
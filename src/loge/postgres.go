@@ -0,0 +1,83 @@
+package loge
+
+import (
+	"database/sql"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+var postgresDialect = &sqlDialect{
+	Name: "PostgreSQL",
+	KeyType: "BYTEA",
+	BlobType: "BYTEA",
+	Placeholder: func(n int) string { return "$" + strconv.Itoa(n) },
+	ReadOptions: &sql.TxOptions{ Isolation: sql.LevelRepeatableRead },
+	BinaryKeys: true,
+	WriteInSnapshot: true,
+}
+
+// Connection pool limits. Every open transaction and snapshot holds a
+// connection, so MaxOpenConns also bounds how many run at once: further
+// ones wait for a connection.
+type PostgresOptions struct {
+	MaxOpenConns int
+	MaxIdleConns int
+	ConnMaxLifetime time.Duration
+}
+
+var DefaultPostgresOptions = PostgresOptions{
+	MaxOpenConns: 32,
+	MaxIdleConns: 8,
+	ConnMaxLifetime: 30 * time.Minute,
+}
+
+// A store in a PostgreSQL database, with the tables described at
+// sqlStore; keys are BYTEA, as composite keys hold zero bytes.
+//
+// Each commit is one SQL transaction, at REPEATABLE READ and sharing the
+// snapshot the loge transaction read from. Several instances can share
+// a database: when one writes a row another has changed since its
+// snapshot, Postgres refuses it and the commit fails with a StoreError
+// rather than overwriting. Each instance still serves reads from its
+// own cache, so an instance that loses such a race should FlushCache.
+func NewPostgresStore(dsn string, opts *PostgresOptions) LogeStore {
+	store, err := OpenPostgresStore(dsn, opts)
+	if err != nil {
+		panic(err)
+	}
+	return store
+}
+
+func OpenPostgresStore(dsn string, opts *PostgresOptions) (store LogeStore, err error) {
+	defer recoverError(&err)
+
+	if opts == nil {
+		opts = &DefaultPostgresOptions
+	}
+
+	sqlStore, err := openSQLStore(postgresDialect, "postgres", dsn, redactDSN(dsn))
+	if err != nil {
+		return nil, err
+	}
+	sqlStore.db.SetMaxOpenConns(opts.MaxOpenConns)
+	sqlStore.db.SetMaxIdleConns(opts.MaxIdleConns)
+	sqlStore.db.SetConnMaxLifetime(opts.ConnMaxLifetime)
+	return sqlStore, nil
+}
+
+var dsnPassword = regexp.MustCompile(`password=('(\\.|[^'])*'|\S*)`)
+
+// Both URL and key=value connection strings
+func redactDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), "xxx")
+		}
+		return u.String()
+	}
+	return dsnPassword.ReplaceAllString(dsn, "password=xxx")
+}
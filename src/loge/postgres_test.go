@@ -0,0 +1,27 @@
+package loge
+
+import (
+	"testing"
+)
+
+func TestRedactDSN(test *testing.T) {
+	var cases = map[string]string{
+		"postgres://loge:secret@db:5432/loge?sslmode=disable": "postgres://loge:xxx@db:5432/loge?sslmode=disable",
+		"postgres://db/loge": "postgres://db/loge",
+		"host=db password=secret dbname=loge": "host=db password=xxx dbname=loge",
+		"host=db password='sec ret' dbname=loge": "host=db password=xxx dbname=loge",
+	}
+	for dsn, want := range cases {
+		if got := redactDSN(dsn); got != want {
+			test.Errorf("Redacted %q to %q", dsn, got)
+		}
+	}
+}
+
+func TestPostgresPlaceholders(test *testing.T) {
+	var store = &sqlStore{ dialect: postgresDialect }
+	var query = store.query("SELECT key FROM t WHERE key >= ? AND key > ? LIMIT 10")
+	if query != "SELECT key FROM t WHERE key >= $1 AND key > $2 LIMIT 10" {
+		test.Errorf("Wrong query: %s", query)
+	}
+}
@@ -0,0 +1,164 @@
+package loge
+
+import (
+	"context"
+	"fmt"
+)
+
+// Two-phase commit, for committing along with other resources under a
+// coordinator:
+//
+//   var t = db.CreateTransaction()
+//   defer t.Rollback()
+//   ...
+//   if err := t.Prepare(); err != nil {
+//       return err   // Nothing was written
+//   }
+//   if err := producer.Send(msg); err != nil {
+//       return err   // Rollback gives back the locks
+//   }
+//   return t.CommitPrepared()
+//
+// Prepare does everything that could stop the commit: it checks the
+// transaction's objects for conflicts, validates them and locks them,
+// as WriteLocked does, so that until it's committed or rolled back
+// other commits writing them abort. Objects another transaction has
+// locked are conflicts rather than waited for. CommitPrepared then only
+// writes, and fails only if the store does.
+//
+// Serializable queries are checked at Prepare, not again. Transactions
+// with nothing to write are committed by Prepare, so they don't hold
+// their reads' locks; CommitPrepared then has nothing to do. Not for
+// use within Transact, which commits for itself.
+func (t *Transaction) Prepare() error {
+	if t.state == CANCELLED || t.cancelled {
+		return t.Err()
+	}
+
+	if t.state != ACTIVE {
+		panic(fmt.Sprintf("Prepare on transaction %s\n", t))
+	}
+
+	if t.view {
+		panic(fmt.Errorf("%w: Prepare on snapshot view %s", ErrReadOnly, t))
+	}
+
+	if t.readOnly || t.db.readOnly || !t.writes() {
+		return t.CommitErrContext(t.ctx)
+	}
+
+	t.checkReads()
+
+	t.state = COMMITTING
+
+	var versions = t.liveVersions()
+
+	if t.conflict = t.lockVersions(versions); t.conflict != nil {
+		t.state = ABORTED
+		t.context.rollback()
+		t.finishCommit(versions)
+		return t.conflict
+	}
+
+	if err := t.validate(versions); err != nil {
+		t.state = CANCELLED
+		t.err = err
+		t.context.rollback()
+		t.finishCommit(versions)
+		return err
+	}
+
+	t.conflict = func() *ConflictInfo {
+		t.db.snapshotLock.Lock()
+		defer t.db.snapshotLock.Unlock()
+		if len(t.queries) > 0 {
+			t.db.commits.drain()
+		}
+		return t.checkQueries()
+	}()
+	if t.conflict != nil {
+		t.state = ABORTED
+		t.context.rollback()
+		t.finishCommit(versions)
+		return t.conflict
+	}
+	t.queries = nil
+
+	t.state = PREPARED
+	return nil
+}
+
+// Writes a prepared transaction, waiting for admission and Quiesce with
+// the context it was created with. Nil, a *StoreError, or the context's
+// error, in which case it stays prepared to be retried or rolled back.
+func (t *Transaction) CommitPrepared() error {
+	return t.CommitPreparedContext(t.ctx)
+}
+
+func (t *Transaction) CommitPreparedContext(ctx context.Context) error {
+	if t.state == FINISHED {
+		return nil
+	}
+
+	if t.state != PREPARED {
+		panic(fmt.Sprintf("CommitPrepared on transaction %s\n", t))
+	}
+
+	var admission = t.db.admission
+	if err := admission.acquire(ctx); err != nil {
+		return err
+	}
+	defer admission.release()
+	if err := t.db.quiescence.enter(ctx); err != nil {
+		return err
+	}
+
+	t.state = COMMITTING
+
+	var versions = t.liveVersions()
+
+	func() {
+		defer t.db.quiescence.exit()
+		for _, lv := range versions {
+			var obj = lv.version.LogeObj
+			obj.Lock.SpinLock()
+			defer obj.Lock.Unlock()
+		}
+		t.apply(versions)
+	}()
+
+	t.finishCommit(versions)
+	return t.Err()
+}
+
+// Takes the write lock on every version, merging or giving the first
+// conflict as tryCommit would. Locks taken stay with the transaction.
+func (t *Transaction) lockVersions(versions []*liveVersion) *ConflictInfo {
+	for _, lv := range versions {
+		var obj = lv.version.LogeObj
+		if !t.checksVersion(lv) {
+			continue
+		}
+
+		obj.Lock.SpinLock()
+		var conflict = obj.lockedAgainst(t)
+		if !conflict && obj.Current.snapshotID > lv.version.snapshotID && !lv.current {
+			if conflict = !t.canMerge(lv); !conflict {
+				t.merge(lv)
+			}
+		}
+		if conflict {
+			var info = newConflictInfo(t, lv)
+			obj.Lock.Unlock()
+			return info
+		}
+
+		if obj.writeLock == nil {
+			obj.writeLock = &writeLock{ t, make(chan struct{}) }
+		}
+		lv.locked = true
+		lv.current = true
+		obj.Lock.Unlock()
+	}
+	return nil
+}
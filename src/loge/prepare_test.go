@@ -0,0 +1,130 @@
+package loge
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestPrepare(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+	db.SetOne("test", "one", &TestObj{ "One" })
+	db.SetOne("test", "two", &TestObj{ "Two" })
+
+	var t = db.CreateTransaction()
+	t.SetLabel("prepared")
+	t.Read("test", "one")
+	t.Set("test", "two", &TestObj{ "Prepared" })
+	if err := t.Prepare(); err != nil || t.GetState() != PREPARED {
+		test.Fatalf("Prepare failed: %v", err)
+	}
+
+	// Read and written objects are both held
+	for _, key := range []LogeKey{ "one", "two" } {
+		var other = db.CreateTransaction()
+		other.Set("test", key, &TestObj{ "Other" })
+		if other.Commit() || other.Conflict() == nil || other.Conflict().Key != key {
+			test.Errorf("Commit to prepared %s not aborted: %v", key, other.Err())
+		}
+	}
+	if db.ReadOne("test", "two").(*TestObj).Name != "Two" {
+		test.Error("Prepared transaction visible")
+	}
+
+	if err := t.CommitPrepared(); err != nil || t.GetState() != FINISHED {
+		test.Fatalf("CommitPrepared failed: %v", err)
+	}
+	if db.ReadOne("test", "two").(*TestObj).Name != "Prepared" {
+		test.Error("Prepared transaction not committed")
+	}
+	t.Rollback()
+	if t.GetState() != FINISHED {
+		test.Error("Rollback undid a commit")
+	}
+
+	t = db.CreateTransaction()
+	t.Set("test", "one", &TestObj{ "Rolled back" })
+	t.Prepare()
+	t.Rollback()
+	if !errors.Is(t.Err(), ErrAborted) {
+		test.Errorf("Wrong rollback error: %v", t.Err())
+	}
+	if !db.Transact(func (t *Transaction) {
+		t.Set("test", "one", &TestObj{ "After" })
+	}, 0) || db.ReadOne("test", "one").(*TestObj).Name != "After" {
+		test.Error("Rolled back transaction kept its locks")
+	}
+
+	t = db.CreateTransaction()
+	t.Write("test", "one")
+	db.SetOne("test", "one", &TestObj{ "Other" })
+	var info *ConflictInfo
+	if err := t.Prepare(); !errors.As(err, &info) || info.Key != "one" || t.GetState() != ABORTED {
+		test.Errorf("Conflict not found at Prepare: %v", err)
+	}
+	if !db.Transact(func (t *Transaction) {
+		t.Set("test", "one", &TestObj{ "Unlocked" })
+	}, 0) {
+		test.Error("Failed Prepare kept its locks")
+	}
+
+	// Preparers conflict rather than wait for each other
+	var first, second = db.CreateTransaction(), db.CreateTransaction()
+	first.Write("test", "one")
+	second.Write("test", "one")
+	if first.Prepare() != nil || !errors.Is(second.Prepare(), ErrConflict) {
+		test.Error("Both prepared")
+	}
+	first.CommitPrepared()
+}
+
+func TestPrepareWithoutWrites(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+	db.SetOne("test", "one", &TestObj{ "One" })
+
+	var t = db.CreateTransaction()
+	t.Read("test", "one")
+	if err := t.Prepare(); err != nil || t.GetState() != FINISHED {
+		test.Fatalf("Reads not committed at Prepare: %v", err)
+	}
+	if !db.Transact(func (t *Transaction) {
+		t.Set("test", "one", &TestObj{ "Other" })
+	}, 0) {
+		test.Error("Prepare kept read locks")
+	}
+	if err := t.CommitPrepared(); err != nil {
+		test.Errorf("CommitPrepared after Prepare finished: %v", err)
+	}
+
+	t = db.CreateTransaction()
+	t.Read("test", "one")
+	db.SetOne("test", "one", &TestObj{ "Another" })
+	if err := t.Prepare(); !errors.Is(err, ErrConflict) {
+		test.Errorf("Stale read prepared: %v", err)
+	}
+}
+
+func TestCommitPreparedContext(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+
+	var t = db.CreateTransaction()
+	t.Set("test", "one", &TestObj{ "Prepared" })
+	if err := t.Prepare(); err != nil {
+		test.Fatalf("Prepare failed: %v", err)
+	}
+
+	release, _ := db.Quiesce(context.Background())
+	var ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if err := t.CommitPreparedContext(ctx); !errors.Is(err, context.Canceled) || t.GetState() != PREPARED {
+		test.Errorf("Wrong CommitPrepared while quiesced: %v, %v", err, t.GetState())
+	}
+
+	release()
+	if err := t.CommitPrepared(); err != nil || db.ReadOne("test", "one").(*TestObj).Name != "Prepared" {
+		test.Errorf("Retried CommitPrepared failed: %v", err)
+	}
+}
@@ -0,0 +1,43 @@
+package loge
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Types whose exemplar is a proto.Message get this unless their TypeDef
+// says otherwise, taking precedence over the DB's codec. ReadCopy copies
+// them with proto.Clone.
+var ProtobufCodec Codec = protobufCodec{}
+
+type protobufCodec struct{}
+
+func (protobufCodec) Name() string {
+	return "protobuf"
+}
+
+func (protobufCodec) Marshal(obj interface{}) ([]byte, error) {
+	msg, ok := obj.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("%T isn't a proto.Message", obj)
+	}
+	return proto.Marshal(msg)
+}
+
+func (protobufCodec) Unmarshal(blob []byte, obj interface{}) error {
+	msg, ok := obj.(proto.Message)
+	if !ok {
+		return fmt.Errorf("%T isn't a proto.Message", obj)
+	}
+	return proto.Unmarshal(blob, msg)
+}
+
+func (protobufCodec) Copy(obj interface{}) interface{} {
+	return proto.Clone(obj.(proto.Message))
+}
+
+func isProtoMessage(exemplar interface{}) bool {
+	_, ok := exemplar.(proto.Message)
+	return ok
+}
@@ -0,0 +1,36 @@
+package loge
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestProtobufCodec(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	db.SetCodec(JSONCodec)
+	db.SetReadSafety(ReadCopy)
+	var typ = db.CreateType(NewTypeDef("proto", 1, &wrapperspb.StringValue{}))
+	if typ.Codec != ProtobufCodec {
+		test.Fatalf("Proto type got %v", typ.Codec)
+	}
+
+	var msg = wrapperspb.String("One")
+	db.SetOne("proto", "one", msg)
+	var expected, _ = proto.Marshal(msg)
+	if blob := storedBlob(db, "proto", "one"); string(blob[2:]) != string(expected) {
+		test.Errorf("Wrong blob: %x", blob)
+	}
+
+	db.Transact(func (t *Transaction) {
+		var first = t.Read("proto", "one").(*wrapperspb.StringValue)
+		var second = t.Read("proto", "one").(*wrapperspb.StringValue)
+		if first == second || first.GetValue() != "One" || !proto.Equal(first, second) {
+			test.Errorf("Bad copies: %v, %v", first, second)
+		}
+		if t.Read("proto", "two").(*wrapperspb.StringValue) != nil {
+			test.Error("Missing object not nil")
+		}
+	}, 0)
+}
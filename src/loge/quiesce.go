@@ -0,0 +1,126 @@
+package loge
+
+import (
+	"context"
+	"sync"
+)
+
+// Holds back new commits and waits for those under way, and any queued
+// by CommitAsync, to be written, so the store stays as it is until
+// release is called:
+//
+//   release, err := db.Quiesce(ctx)
+//   if err != nil {
+//       return err
+//   }
+//   defer release()
+//   ...   // Copy the store's files
+//
+// Commits which write made meanwhile wait, with their contexts, for
+// release. If ctx is done first, commits go on and the context's error
+// is returned. Transactions keep running and reading, and prepared ones
+// keep their locks. One Quiesce at a time: others wait for release.
+func (db *LogeDB) Quiesce(ctx context.Context) (release func(), err error) {
+	if err := db.quiescence.raise(ctx); err != nil {
+		return nil, err
+	}
+	db.async.drain()
+
+	var once sync.Once
+	return func() {
+		once.Do(db.quiescence.lower)
+	}, nil
+}
+
+// Whether committing would change the store
+func (t *Transaction) writes() bool {
+	for _, lv := range t.versions {
+		if lv.dirty {
+			return true
+		}
+	}
+	return false
+}
+
+type quiescence struct {
+	lock sync.Mutex
+	committing int
+	barrier chan struct{} // Closed on release
+	idle chan struct{} // Closed once nothing is committing
+}
+
+// Waits while quiesced, then counts a commit in
+func (q *quiescence) enter(ctx context.Context) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if err := q.await(ctx); err != nil {
+		return err
+	}
+	q.committing++
+	return nil
+}
+
+func (q *quiescence) exit() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.committing--
+	if q.committing == 0 && q.idle != nil {
+		close(q.idle)
+		q.idle = nil
+	}
+}
+
+func (q *quiescence) raise(ctx context.Context) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if err := q.await(ctx); err != nil {
+		return err
+	}
+
+	q.barrier = make(chan struct{})
+	if q.committing == 0 {
+		return nil
+	}
+
+	var idle = make(chan struct{})
+	q.idle = idle
+	q.lock.Unlock()
+	select {
+	case <-idle:
+		q.lock.Lock()
+		return nil
+	case <-ctx.Done():
+		q.lock.Lock()
+		q.idle = nil
+		q.open()
+		return ctx.Err()
+	}
+}
+
+func (q *quiescence) lower() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.open()
+}
+
+// Under q.lock
+func (q *quiescence) open() {
+	close(q.barrier)
+	q.barrier = nil
+}
+
+// Until there's no barrier. Under q.lock, which it gives up to wait.
+func (q *quiescence) await(ctx context.Context) error {
+	for q.barrier != nil {
+		var barrier = q.barrier
+		q.lock.Unlock()
+		select {
+		case <-barrier:
+			q.lock.Lock()
+		case <-ctx.Done():
+			q.lock.Lock()
+			return ctx.Err()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package loge
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestQuiesce(test *testing.T) {
+	var store = NewFaultStore(NewMemStore())
+	var clock = &gateClock{ make(chan bool) }
+	store.Clock = clock
+	var db = NewLogeDB(store)
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+
+	// Waits for a commit stuck in the store
+	store.Script(FaultCommit, Fault{ Delay: time.Second })
+	var committed = make(chan bool, 2)
+	go func() {
+		committed <- db.TrySetOne("test", "one", &TestObj{ "One" }) == nil
+	}()
+	for store.Pending(FaultCommit) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	var quiesced = make(chan func(), 1)
+	go func() {
+		var release, err = db.Quiesce(context.Background())
+		if err != nil {
+			test.Errorf("Quiesce failed: %v", err)
+		}
+		quiesced <- release
+	}()
+	select {
+	case <-quiesced:
+		test.Fatal("Quiesced with a commit under way")
+	case <-time.After(20 * time.Millisecond):
+	}
+	clock.release <- true
+	<-committed
+	var release = <-quiesced
+
+	// Holds back new commits until released
+	go func() {
+		committed <- db.Transact(func (t *Transaction) {
+			t.Set("test", "two", &TestObj{ "Two" })
+		}, 0)
+	}()
+	var ctx, cancel = context.WithTimeout(context.Background(), 20 * time.Millisecond)
+	defer cancel()
+	var t = db.CreateTransaction()
+	t.Set("test", "three", &TestObj{ "Three" })
+	if t.CommitContext(ctx) || !errors.Is(t.Err(), context.DeadlineExceeded) {
+		test.Errorf("Commit while quiesced: %v", t.Err())
+	}
+	if db.ExistsOne("test", "two") {
+		test.Error("Commit went through while quiesced")
+	}
+	release()
+	release()
+	if !<-committed || !db.ExistsOne("test", "two") {
+		test.Error("Held commit failed after release")
+	}
+
+	// Gives up with its context, letting commits go on
+	store.Script(FaultCommit, Fault{ Delay: time.Second })
+	go func() {
+		committed <- db.TrySetOne("test", "four", &TestObj{ "Four" }) == nil
+	}()
+	for store.Pending(FaultCommit) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 20 * time.Millisecond)
+	defer cancel()
+	if _, err := db.Quiesce(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		test.Errorf("Quiesce didn't time out: %v", err)
+	}
+	clock.release <- true
+	<-committed
+	if !db.Transact(func (t *Transaction) {
+		t.Set("test", "five", &TestObj{ "Five" })
+	}, 0) {
+		test.Error("Commit failed after timed out Quiesce")
+	}
+}
@@ -0,0 +1,91 @@
+package loge
+
+import (
+	"context"
+	"fmt"
+)
+
+// A store wrapper which passes reads through and never writes, e.g. for
+// analytics jobs pointed at production data files:
+//
+//   var db = loge.NewReadOnlyLogeDB(loge.NewLevelDBStore(path))
+//
+// Type info from CreateType is kept in memory rather than written back.
+// Commits release the store context without touching the store, and
+// Truncate, RebuildIndexes and Compact raise ErrReadOnly. Backup still
+// works. Most stores stamp a fresh file with their format as they open,
+// so open existing ones.
+type ReadOnlyStore struct {
+	LogeStore
+}
+
+type readOnlyContext struct {
+	transactionContext
+}
+
+func NewReadOnlyStore(store LogeStore) *ReadOnlyStore {
+	return &ReadOnlyStore{ store }
+}
+
+// Transactions on it panic with ErrReadOnly on Write, Set, Delete and
+// link changes. Commit just ends them.
+func NewReadOnlyLogeDB(store LogeStore) *LogeDB {
+	if _, ok := store.(*ReadOnlyStore); !ok {
+		store = NewReadOnlyStore(store)
+	}
+	var db = NewLogeDB(store)
+	db.readOnly = true
+	return db
+}
+
+func (db *LogeDB) ReadOnly() bool {
+	return db.readOnly
+}
+
+func (store *ReadOnlyStore) describe() string {
+	return fmt.Sprintf("Read-only %s", store.LogeStore.describe())
+}
+
+func (store *ReadOnlyStore) compact() {
+	panic(fmt.Errorf("%w: Compact on read-only store", ErrReadOnly))
+}
+
+func (store *ReadOnlyStore) truncate(typ *logeType) int {
+	panic(fmt.Errorf("%w: Truncate on read-only store", ErrReadOnly))
+}
+
+func (store *ReadOnlyStore) rebuildIndexes(db *LogeDB) int {
+	panic(fmt.Errorf("%w: RebuildIndexes on read-only store", ErrReadOnly))
+}
+
+// Stores only write type info they think is new
+func (store *ReadOnlyStore) registerType(typ *logeType) {
+	typ.SpackType.Dirty = false
+	store.LogeStore.registerType(typ)
+}
+
+
+// -----------------------------------------------
+// Transaction Contexts
+// -----------------------------------------------
+
+func (store *ReadOnlyStore) newContext(ctx context.Context, sID uint64) transactionContext {
+	return &readOnlyContext{ store.LogeStore.newContext(ctx, sID) }
+}
+
+func (context *readOnlyContext) store(ref objRef, enc []byte) error {
+	panic(fmt.Errorf("%w: write to %s on read-only store", ErrReadOnly, ref.Key))
+}
+
+func (context *readOnlyContext) addIndex(ref objRef, key LogeKey) {
+	panic(fmt.Errorf("%w: index write on read-only store", ErrReadOnly))
+}
+
+func (context *readOnlyContext) remIndex(ref objRef, key LogeKey) {
+	panic(fmt.Errorf("%w: index write on read-only store", ErrReadOnly))
+}
+
+func (context *readOnlyContext) commit(sID uint64) error {
+	context.transactionContext.rollback()
+	return nil
+}
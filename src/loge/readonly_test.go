@@ -0,0 +1,71 @@
+package loge
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadOnlyDB(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "loge-readonly")
+	defer os.RemoveAll(dir)
+	var path = filepath.Join(dir, "loge.log")
+
+	var def = NewTypeDef("test", 1, &TestObj{})
+	def.Links = LinkSpec{ "other": "test" }
+
+	var db = NewLogeDB(NewLogStore(path, nil))
+	db.CreateType(def)
+	db.Transact(func (t *Transaction) {
+		t.Set("test", "one", &TestObj{ "One" })
+		t.AddLink("test", "other", "one", "two")
+	}, 0)
+	db.Close()
+	var before, _ = ioutil.ReadFile(path)
+
+	db = NewReadOnlyLogeDB(NewLogStore(path, nil))
+	db.CreateType(def)
+	if !db.ReadOnly() {
+		test.Error("DB not read-only")
+	}
+	if obj := db.ReadOne("test", "one").(*TestObj); obj == nil || obj.Name != "One" {
+		test.Errorf("Wrong object: %v", obj)
+	}
+	if links := db.ReadLinksOne("test", "other", "one"); len(links) != 1 || links[0] != "two" {
+		test.Errorf("Wrong links: %v", links)
+	}
+
+	if err := db.TrySetOne("test", "one", &TestObj{ "Uno" }); !errors.Is(err, ErrReadOnly) {
+		test.Errorf("Wrong error from set: %v", err)
+	}
+	if err := db.TryDeleteOne("test", "one"); !errors.Is(err, ErrReadOnly) {
+		test.Errorf("Wrong error from delete: %v", err)
+	}
+	_, err := db.TryTransact(func (t *Transaction) {
+		t.AddLink("test", "other", "one", "three")
+	}, 0)
+	if !errors.Is(err, ErrReadOnly) {
+		test.Errorf("Wrong error from link: %v", err)
+	}
+
+	var truncated = func() (err error) {
+		defer recoverError(&err)
+		db.Truncate("test")
+		return nil
+	}()
+	if !errors.Is(truncated, ErrReadOnly) {
+		test.Errorf("Wrong error from truncate: %v", truncated)
+	}
+
+	if obj := db.ReadOne("test", "one").(*TestObj); obj == nil || obj.Name != "One" {
+		test.Errorf("Object changed: %v", obj)
+	}
+	db.Close()
+
+	if after, _ := ioutil.ReadFile(path); !bytes.Equal(before, after) {
+		test.Errorf("Store written: %d bytes -> %d", len(before), len(after))
+	}
+}
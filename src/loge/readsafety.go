@@ -0,0 +1,72 @@
+package loge
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// Read hands out the transaction's own object, the same one Write
+// returns. Changing it without calling Write changes what the rest of
+// the transaction sees, but isn't committed. These modes catch that:
+//
+//   ReadShared  the default, no checking
+//   ReadCopy    Read returns a fresh copy each time, so it can't happen
+//   ReadCheck   Commit panics with ErrReadMutated if it did
+type ReadSafety int
+
+const (
+	ReadShared ReadSafety = iota
+	ReadCopy
+	ReadCheck
+)
+
+var ErrReadMutated = errors.New("Object changed without Write")
+
+// Set before use
+func (db *LogeDB) SetReadSafety(mode ReadSafety) {
+	db.readSafety = mode
+}
+
+func (t *Transaction) readObject(lv *liveVersion) interface{} {
+	if t.db.readSafety != ReadCopy || t.giveJSON {
+		return lv.object
+	}
+
+	var obj = lv.version.LogeObj
+	if copier, ok := obj.Type.Codec.(CodecCopier); ok {
+		if !obj.hasValue(lv.object) {
+			return lv.object
+		}
+		var copied = copier.Copy(lv.object)
+		obj.populateMeta(copied, t.snapshotID)
+		return copied
+	}
+
+	var blob = lv.version.Blob
+	if lv.dirty {
+		blob = obj.encode(lv.object)
+	}
+	copied, _ := obj.decode(blob, false)
+	obj.populateMeta(copied, t.snapshotID)
+	return copied
+}
+
+func (t *Transaction) checkReads() {
+	if t.db.readSafety != ReadCheck || t.giveJSON || t.state != ACTIVE {
+		return
+	}
+
+	for _, lv := range t.liveVersions() {
+		var obj = lv.version.LogeObj
+		if lv.dirty || lv.lazy || obj.LinkName != "" || !lv.version.loaded {
+			continue
+		}
+		committed, _ := obj.decode(lv.version.Blob, false)
+		obj.populateMeta(committed, t.snapshotID)
+		if !reflect.DeepEqual(committed, lv.object) {
+			t.abandon()
+			panic(fmt.Errorf("%w: %s/%s", ErrReadMutated, obj.Type.Name, obj.Key))
+		}
+	}
+}
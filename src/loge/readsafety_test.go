@@ -0,0 +1,53 @@
+package loge
+
+import (
+	"testing"
+	"errors"
+)
+
+func TestReadCopy(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	db.SetReadSafety(ReadCopy)
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+	db.SetOne("test", "one", &TestObj{ "One" })
+
+	db.Transact(func (t *Transaction) {
+		t.Read("test", "one").(*TestObj).Name = "Changed"
+		if t.Read("test", "one").(*TestObj).Name != "One" {
+			test.Error("Read returned a shared object")
+		}
+		t.Write("test", "one").(*TestObj).Name = "Written"
+		if t.Read("test", "one").(*TestObj).Name != "Written" {
+			test.Error("Read copy missed the transaction's write")
+		}
+	}, 0)
+
+	if db.ReadOne("test", "one").(*TestObj).Name != "Written" {
+		test.Error("Write lost")
+	}
+}
+
+func TestReadCheck(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	db.SetReadSafety(ReadCheck)
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+	db.SetOne("test", "one", &TestObj{ "One" })
+
+	_, err := db.TryTransact(func (t *Transaction) {
+		t.Read("test", "one").(*TestObj).Name = "Changed"
+	}, 0)
+	if !errors.Is(err, ErrReadMutated) {
+		test.Errorf("Mutated read gave %v", err)
+	}
+
+	ok, err := db.TryTransact(func (t *Transaction) {
+		t.Read("test", "one")
+		t.Write("test", "one").(*TestObj).Name = "Written"
+	}, 0)
+	if !ok || err != nil {
+		test.Errorf("Proper write failed: %v", err)
+	}
+	if db.Stats().CachedObjects != 0 {
+		test.Error("Objects left in cache")
+	}
+}
@@ -0,0 +1,64 @@
+package loge
+
+import (
+	"context"
+)
+
+// Transactions which only read, and so need nothing commit does:
+//
+//   db.ReadTransact(func (t *loge.Transaction) {
+//       var person = t.Read("person", key).(*Person)
+//       ...
+//   })
+//
+// Objects are read from the store context at the transaction's snapshot
+// without going through the DB's object cache, so reads take no object
+// locks and leave reference counts alone, and nothing committed since
+// can abort it. Write, Set, Delete and link changes panic with
+// ErrReadOnly. Commit just ends it.
+func (db *LogeDB) ReadTransact(actor Transactor) bool {
+	return db.ReadTransactContext(context.Background(), actor)
+}
+
+func (db *LogeDB) ReadTransactContext(ctx context.Context, actor Transactor) bool {
+	var t = db.CreateTransactionContext(ctx)
+	t.readOnly = true
+	actor(t)
+	if t.cancelled {
+		return false
+	}
+	return t.CommitContext(ctx)
+}
+
+func (t *Transaction) ReadOnly() bool {
+	return t.readOnly || t.view || t.db.readOnly
+}
+
+// Cache objects for transactions which may write, or one of the
+// transaction's own for read-only ones, which nothing else sees
+func (t *Transaction) acquire(ref objRef, load bool) *objectVersion {
+	if !t.readOnly {
+		return t.db.acquireVersion(ref, t.context, load)
+	}
+
+	var obj = initializeObject(t.db, ref.Type, ref.Key)
+	if ref.IsLink() {
+		obj.LinkName = ref.LinkName
+	}
+	var version = &objectVersion{
+		LogeObj: obj,
+		snapshotID: t.snapshotID,
+	}
+	if load {
+		version.Blob = t.context.get(ref)
+		version.loaded = true
+	}
+	return version
+}
+
+// What acquire gave out
+func (t *Transaction) release() {
+	if !t.readOnly {
+		t.db.releaseVersions(t.liveVersions())
+	}
+}
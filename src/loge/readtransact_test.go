@@ -0,0 +1,51 @@
+package loge
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestReadTransact(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	var def = NewTypeDef("test", 1, &TestObj{})
+	def.Links = LinkSpec{ "other": "test" }
+	db.CreateType(def)
+	db.Transact(func (t *Transaction) {
+		t.Set("test", "one", &TestObj{ "One" })
+		t.AddLink("test", "other", "one", "two")
+	}, 0)
+
+	var ok = db.ReadTransact(func (t *Transaction) {
+		if !t.ReadOnly() {
+			test.Error("Transaction not read-only")
+		}
+		if obj := t.Read("test", "one").(*TestObj); obj.Name != "One" {
+			test.Errorf("Wrong object: %v", obj)
+		}
+		if links := t.ReadLinks("test", "other", "one"); len(links) != 1 || links[0] != "two" {
+			test.Errorf("Wrong links: %v", links)
+		}
+		if len(db.cache) != 0 {
+			test.Errorf("Read went through the cache: %d objects", len(db.cache))
+		}
+
+		// Committed after the snapshot, so unseen, and no conflict
+		db.SetOne("test", "one", &TestObj{ "Changed" })
+		if obj := t.ReadLazy("test", "one").Object().(*TestObj); obj.Name != "One" {
+			test.Errorf("Read past snapshot: %v", obj)
+		}
+
+		defer func() {
+			if err, _ := recover().(error); !errors.Is(err, ErrReadOnly) {
+				test.Errorf("Wrong write error: %v", err)
+			}
+		}()
+		t.Write("test", "one")
+	})
+	if !ok {
+		test.Error("Read-only transaction failed")
+	}
+	if obj := db.ReadOne("test", "one").(*TestObj); obj.Name != "Changed" {
+		test.Errorf("Wrong object after: %v", obj)
+	}
+}
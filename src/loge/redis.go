@@ -0,0 +1,574 @@
+package loge
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brendonh/spack"
+)
+
+// Keys, under Prefix:
+//
+//   obj:<type>                       hash of key -> object
+//   keys:<type>                      sorted set of keys, for listing
+//   link:<type>:<link>:<source>      sorted set of targets
+//   index:<type>:<link>:<target>     sorted set of sources
+//   meta                             hash of format stamp and type info
+//
+// Sorted set members all score 0, so they're in key order and ranges of
+// them can be read with ZRANGEBYLEX.
+type RedisOptions struct {
+	Prefix string
+	Password string
+	DB int
+	PoolSize int
+	Timeout time.Duration
+}
+
+var DefaultRedisOptions = RedisOptions{
+	Prefix: "loge:",
+	PoolSize: 16,
+	Timeout: 5 * time.Second,
+}
+
+const redis_FORMAT_VERSION uint32 = 1
+
+
+type redisStore struct {
+	addr string
+	opts RedisOptions
+	pool chan *redisConn
+	types *spack.TypeSet
+	typeNames map[uint16]string
+}
+
+type redisContext struct {
+	rstore *redisStore
+	ctx context.Context
+	snapshotID uint64
+	batch [][]interface{}
+}
+
+// A store over a Redis server, for using loge as a transactional layer
+// on an existing deployment. Each commit is one MULTI/EXEC, so lands
+// whole or not at all.
+//
+// Redis has no snapshots: a transaction reading an object which isn't
+// cached sees its latest commit, even one made after the transaction
+// began. Conflicting writes are still caught as usual. Nothing else
+// should write under Prefix.
+func NewRedisStore(addr string, opts *RedisOptions) LogeStore {
+	store, err := OpenRedisStore(addr, opts)
+	if err != nil {
+		panic(err)
+	}
+	return store
+}
+
+func OpenRedisStore(addr string, opts *RedisOptions) (store LogeStore, err error) {
+	defer recoverError(&err)
+
+	if opts == nil {
+		opts = &DefaultRedisOptions
+	}
+
+	var redisStore = &redisStore{
+		addr: addr,
+		opts: *opts,
+		pool: make(chan *redisConn, opts.PoolSize),
+		types: spack.NewTypeSet(),
+		typeNames: make(map[uint16]string),
+	}
+
+	if err := redisStore.checkFormat(); err != nil {
+		redisStore.close()
+		return nil, err
+	}
+
+	redisStore.loadTypeMetadata()
+	return redisStore, nil
+}
+
+func (store *redisStore) close() {
+	for {
+		select {
+		case conn := <-store.pool:
+			conn.Close()
+		default:
+			return
+		}
+	}
+}
+
+// Left to Redis
+func (store *redisStore) compact() {
+}
+
+func (store *redisStore) backup(path string) error {
+	return fmt.Errorf("%w: Backup on Redis store, use BGSAVE", ErrNotSupported)
+}
+
+func (store *redisStore) describe() string {
+	return fmt.Sprintf("Redis: %s", store.addr)
+}
+
+// Commits overwrite, and there are no snapshots
+func (store *redisStore) retainsVersions() bool {
+	return false
+}
+
+// Link sets and their index are written in the same MULTI
+func (store *redisStore) rebuildIndexes(db *LogeDB) int {
+	return 0
+}
+
+func (store *redisStore) truncate(typ *logeType) int {
+	var count = store.do("ZCARD", store.key("keys:", typ.Name))
+	var doomed = []interface{}{ store.key("obj:", typ.Name), store.key("keys:", typ.Name) }
+	for _, kind := range []string{ "link:", "index:" } {
+		for _, key := range store.scan(store.key(kind, globEscape(typ.Name) + ":*")) {
+			doomed = append(doomed, key)
+		}
+	}
+	store.do(append([]interface{}{ "DEL" }, doomed...)...)
+	return int(count.(int64))
+}
+
+func (store *redisStore) registerType(typ *logeType) {
+	store.typeNames[typ.SpackType.Tag] = typ.Name
+	registerTypeInfo(store.types, typ, func(name string, info []byte) error {
+		store.do("HSET", store.key("meta"), "type:" + name, info)
+		return nil
+	})
+}
+
+func (store *redisStore) getSpackType(name string) *spack.VersionedType {
+	return store.types.RegisterType(name)
+}
+
+
+// -----------------------------------------------
+// Transaction Contexts
+// -----------------------------------------------
+
+func (store *redisStore) newContext(ctx context.Context, sID uint64) transactionContext {
+	return &redisContext{
+		rstore: store,
+		ctx: ctx,
+		snapshotID: sID,
+		batch: make([][]interface{}, 0),
+	}
+}
+
+func (context *redisContext) getSnapshotID() uint64 {
+	return context.snapshotID
+}
+
+func (context *redisContext) commit(sID uint64) error {
+	if len(context.batch) == 0 {
+		return nil
+	}
+	return context.rstore.exec(context.batch)
+}
+
+func (context *redisContext) rollback() {
+}
+
+
+// -----------------------------------------------
+// transactionContext API
+// -----------------------------------------------
+
+func (context *redisContext) get(ref objRef) []byte {
+	checkContext(context.ctx)
+	var store = context.rstore
+
+	if ref.IsLink() {
+		var targets = store.keys(store.do("ZRANGE", store.linkKey("link:", ref, ref.Key), 0, -1))
+		if len(targets) == 0 {
+			return nil
+		}
+		enc, _ := spack.EncodeToBytes(linkList(targets).strings(), linkSetSpec)
+		return enc
+	}
+
+	var val = store.do("HGET", store.key("obj:", ref.Type.Name), string(ref.Key))
+	if val == nil {
+		return nil
+	}
+	return val.([]byte)
+}
+
+func (context *redisContext) contains(ref objRef) bool {
+	return context.get(ref) != nil
+}
+
+// Link sets are written a member at a time, by addIndex and remIndex
+func (context *redisContext) store(ref objRef, enc []byte) error {
+	if ref.IsLink() {
+		return nil
+	}
+
+	var store = context.rstore
+	var objKey, keysKey = store.key("obj:", ref.Type.Name), store.key("keys:", ref.Type.Name)
+
+	if len(enc) == 0 {
+		context.write("HDEL", objKey, string(ref.Key))
+		context.write("ZREM", keysKey, string(ref.Key))
+		return nil
+	}
+
+	context.write("HSET", objKey, string(ref.Key), enc)
+	context.write("ZADD", keysKey, 0, string(ref.Key))
+	return nil
+}
+
+func (context *redisContext) addIndex(ref objRef, source LogeKey) {
+	var store = context.rstore
+	context.write("ZADD", store.linkKey("link:", ref, source), 0, string(ref.Key))
+	context.write("ZADD", store.linkKey("index:", ref, ref.Key), 0, string(source))
+}
+
+func (context *redisContext) remIndex(ref objRef, source LogeKey) {
+	var store = context.rstore
+	context.write("ZREM", store.linkKey("link:", ref, source), string(ref.Key))
+	context.write("ZREM", store.linkKey("index:", ref, ref.Key), string(source))
+}
+
+func (context *redisContext) find(ref objRef) ResultSet {
+	return context.findSlice(ref, "", "", -1)
+}
+
+func (context *redisContext) findSlice(ref objRef, keyPrefix LogeKey, from LogeKey, limit int) ResultSet {
+	return context.slice(context.rstore.linkKey("index:", ref, ref.Key), keyPrefix, from, limit)
+}
+
+func (context *redisContext) listSlice(typePrefix []byte, keyPrefix LogeKey, from LogeKey, limit int) ResultSet {
+	var tag = uint16(binary.BigEndian.Uint32(typePrefix) >> 16)
+	var name, ok = context.rstore.typeNames[tag]
+	if !ok {
+		panic(storeError("No type with tag %d", tag))
+	}
+	return context.slice(context.rstore.key("keys:", name), keyPrefix, from, limit)
+}
+
+// Members of the sorted set which start with keyPrefix, after from, a
+// page per ZRANGEBYLEX
+func (context *redisContext) slice(set string, keyPrefix LogeKey, from LogeKey, limit int) ResultSet {
+	checkContext(context.ctx)
+	if limit == 0 {
+		return &pagedResultSet{ closed: true }
+	}
+
+	var store = context.rstore
+	var max = "+"
+	if end, ok := prefixEnd(keyPrefix); ok {
+		max = "(" + string(end)
+	}
+
+	var fetch = func(after LogeKey) []LogeKey {
+		checkContext(context.ctx)
+		var min = "-"
+		switch {
+		case after != "" && after >= keyPrefix:
+			min = "(" + string(after)
+		case keyPrefix != "":
+			min = "[" + string(keyPrefix)
+		}
+		return store.keys(store.do("ZRANGEBYLEX", set, min, max, "LIMIT", 0, store_PAGE_SIZE))
+	}
+
+	return &pagedResultSet{
+		ctx: context.ctx,
+		fetch: fetch,
+		last: from,
+		limit: limit,
+	}
+}
+
+func (context *redisContext) write(args ...interface{}) {
+	context.batch = append(context.batch, args)
+}
+
+// -----------------------------------------------
+// Commands
+// -----------------------------------------------
+
+func (store *redisStore) key(parts ...string) string {
+	return store.opts.Prefix + strings.Join(parts, "")
+}
+
+func (store *redisStore) linkKey(kind string, ref objRef, key LogeKey) string {
+	return store.key(kind, ref.Type.Name, ":", ref.LinkName, ":", string(key))
+}
+
+func (store *redisStore) do(args ...interface{}) interface{} {
+	var conn = store.conn()
+	reply, err := conn.do(args...)
+	store.release(conn, err)
+	if err != nil {
+		panic(storeError("Redis %s: %v", args[0], err))
+	}
+	return reply
+}
+
+// Runs the commands in one MULTI/EXEC, pipelined
+func (store *redisStore) exec(commands [][]interface{}) (err error) {
+	var conn = store.conn()
+	defer func() { store.release(conn, err) }()
+
+	conn.send("MULTI")
+	for _, args := range commands {
+		conn.send(args...)
+	}
+	conn.send("EXEC")
+	if err = conn.flush(); err != nil {
+		return err
+	}
+
+	// Errors while queueing show up again as EXECABORT
+	for i := 0; i < len(commands) + 1; i++ {
+		if _, err = conn.receive(); err != nil && !isRedisError(err) {
+			return err
+		}
+	}
+	results, err := conn.receive()
+	if err != nil {
+		return err
+	}
+	for _, result := range results.([]interface{}) {
+		if err, ok := result.(redisError); ok {
+			return err
+		}
+	}
+	return nil
+}
+
+func (store *redisStore) keys(reply interface{}) []LogeKey {
+	var members = reply.([]interface{})
+	var keys = make([]LogeKey, len(members))
+	for i, member := range members {
+		keys[i] = LogeKey(member.([]byte))
+	}
+	return keys
+}
+
+func (store *redisStore) scan(pattern string) []string {
+	var keys = make([]string, 0)
+	var cursor = "0"
+	for {
+		var reply = store.do("SCAN", cursor, "MATCH", pattern, "COUNT", 1000).([]interface{})
+		for _, key := range reply[1].([]interface{}) {
+			keys = append(keys, string(key.([]byte)))
+		}
+		cursor = string(reply[0].([]byte))
+		if cursor == "0" {
+			return keys
+		}
+	}
+}
+
+func globEscape(s string) string {
+	var buf strings.Builder
+	for _, c := range s {
+		if strings.ContainsRune(`*?[]\`, c) {
+			buf.WriteByte('\\')
+		}
+		buf.WriteRune(c)
+	}
+	return buf.String()
+}
+
+// -----------------------------------------------
+// Internals
+// -----------------------------------------------
+
+func (store *redisStore) loadTypeMetadata() {
+	var typeType = store.types.Type("_type")
+	var fields = store.do("HGETALL", store.key("meta")).([]interface{})
+	for i := 0; i + 1 < len(fields); i += 2 {
+		if !strings.HasPrefix(string(fields[i].([]byte)), "type:") {
+			continue
+		}
+		var typeInfo, _, err = typeType.DecodeObj(fields[i+1].([]byte), false)
+		if err != nil {
+			panic(storeError("Error loading type info: %v", err))
+		}
+		store.types.LoadType(typeInfo.(*spack.VersionedType))
+	}
+}
+
+func (store *redisStore) checkFormat() error {
+	var stamp []byte
+	if val := store.do("HGET", store.key("meta"), "format"); val != nil {
+		stamp = val.([]byte)
+	}
+	return checkFormatStamp(store.addr, stamp, redis_FORMAT_VERSION, true,
+		func (stamp []byte) error {
+			store.do("HSET", store.key("meta"), "format", stamp)
+			return nil
+		})
+}
+
+// -----------------------------------------------
+// Connections
+// -----------------------------------------------
+
+// Just enough RESP for the commands above
+type redisConn struct {
+	net.Conn
+	reader *bufio.Reader
+	writer *bufio.Writer
+}
+
+type redisError string
+
+func (err redisError) Error() string {
+	return string(err)
+}
+
+func isRedisError(err error) bool {
+	var rerr redisError
+	return errors.As(err, &rerr)
+}
+
+func (store *redisStore) conn() *redisConn {
+	select {
+	case conn := <-store.pool:
+		return conn
+	default:
+	}
+
+	conn, err := store.dial()
+	if err != nil {
+		panic(storeError("Can't connect to Redis at %s: %v", store.addr, err))
+	}
+	return conn
+}
+
+// Connections that failed, other than with a Redis error, are dropped
+func (store *redisStore) release(conn *redisConn, err error) {
+	if err != nil && !isRedisError(err) {
+		conn.Close()
+		return
+	}
+	select {
+	case store.pool <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+func (store *redisStore) dial() (*redisConn, error) {
+	netConn, err := net.DialTimeout("tcp", store.addr, store.opts.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	var conn = &redisConn{ netConn, bufio.NewReader(netConn), bufio.NewWriter(netConn) }
+	var setup = make([][]interface{}, 0)
+	if store.opts.Password != "" {
+		setup = append(setup, []interface{}{ "AUTH", store.opts.Password })
+	}
+	if store.opts.DB != 0 {
+		setup = append(setup, []interface{}{ "SELECT", store.opts.DB })
+	}
+	for _, args := range setup {
+		if _, err := conn.do(args...); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func (conn *redisConn) do(args ...interface{}) (interface{}, error) {
+	conn.send(args...)
+	if err := conn.flush(); err != nil {
+		return nil, err
+	}
+	return conn.receive()
+}
+
+func (conn *redisConn) send(args ...interface{}) {
+	fmt.Fprintf(conn.writer, "*%d\r\n", len(args))
+	for _, arg := range args {
+		var bulk []byte
+		switch arg := arg.(type) {
+		case []byte:
+			bulk = arg
+		case string:
+			bulk = []byte(arg)
+		case int:
+			bulk = []byte(strconv.Itoa(arg))
+		default:
+			panic(fmt.Sprintf("Can't send %T to Redis", arg))
+		}
+		fmt.Fprintf(conn.writer, "$%d\r\n", len(bulk))
+		conn.writer.Write(bulk)
+		conn.writer.WriteString("\r\n")
+	}
+}
+
+func (conn *redisConn) flush() error {
+	return conn.writer.Flush()
+}
+
+// Bulk strings come back as []byte, nil bulks and arrays as nil, and
+// error replies as a redisError
+func (conn *redisConn) receive() (interface{}, error) {
+	line, err := conn.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, fmt.Errorf("bad reply %q", line)
+	}
+	var body = line[1:len(line)-2]
+
+	switch line[0] {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, redisError(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		size, err := strconv.Atoi(body)
+		if err != nil || size < 0 {
+			return nil, err
+		}
+		var bulk = make([]byte, size + 2)
+		if _, err := io.ReadFull(conn.reader, bulk); err != nil {
+			return nil, err
+		}
+		return bulk[:size], nil
+	case '*':
+		size, err := strconv.Atoi(body)
+		if err != nil || size < 0 {
+			return nil, err
+		}
+		var items = make([]interface{}, size)
+		for i := range items {
+			item, err := conn.receive()
+			if err, ok := err.(redisError); ok {
+				items[i] = err
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("bad reply %q", line)
+}
@@ -0,0 +1,257 @@
+package loge
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Enough of Redis for the store, in memory
+type fakeRedis struct {
+	lock sync.Mutex
+	hashes map[string]map[string]string
+	sets map[string]map[string]bool
+}
+
+func startFakeRedis(test *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		test.Fatal(err)
+	}
+	test.Cleanup(func() { listener.Close() })
+
+	var redis = &fakeRedis{
+		hashes: make(map[string]map[string]string),
+		sets: make(map[string]map[string]bool),
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go redis.serve(conn)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func (redis *fakeRedis) serve(netConn net.Conn) {
+	defer netConn.Close()
+	var conn = &redisConn{ netConn, bufio.NewReader(netConn), bufio.NewWriter(netConn) }
+	var queued [][]string
+	var inMulti = false
+
+	for {
+		var args, err = conn.receive()
+		if err != nil {
+			return
+		}
+		var cmd = make([]string, len(args.([]interface{})))
+		for i, arg := range args.([]interface{}) {
+			cmd[i] = string(arg.([]byte))
+		}
+
+		switch {
+		case cmd[0] == "MULTI":
+			inMulti, queued = true, nil
+			conn.writer.WriteString("+OK\r\n")
+		case cmd[0] == "EXEC":
+			redis.lock.Lock()
+			fmt.Fprintf(conn.writer, "*%d\r\n", len(queued))
+			for _, queuedCmd := range queued {
+				redis.reply(conn.writer, redis.run(queuedCmd))
+			}
+			redis.lock.Unlock()
+			inMulti = false
+		case inMulti:
+			queued = append(queued, cmd)
+			conn.writer.WriteString("+QUEUED\r\n")
+		default:
+			redis.lock.Lock()
+			redis.reply(conn.writer, redis.run(cmd))
+			redis.lock.Unlock()
+		}
+		conn.writer.Flush()
+	}
+}
+
+func (redis *fakeRedis) reply(w *bufio.Writer, reply interface{}) {
+	switch reply := reply.(type) {
+	case nil:
+		w.WriteString("$-1\r\n")
+	case int:
+		fmt.Fprintf(w, ":%d\r\n", reply)
+	case string:
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(reply), reply)
+	case error:
+		fmt.Fprintf(w, "-ERR %v\r\n", reply)
+	case []string:
+		fmt.Fprintf(w, "*%d\r\n", len(reply))
+		for _, item := range reply {
+			fmt.Fprintf(w, "$%d\r\n%s\r\n", len(item), item)
+		}
+	case []interface{}:
+		fmt.Fprintf(w, "*%d\r\n", len(reply))
+		for _, item := range reply {
+			redis.reply(w, item)
+		}
+	}
+}
+
+func (redis *fakeRedis) run(cmd []string) interface{} {
+	var hash = func() map[string]string {
+		if redis.hashes[cmd[1]] == nil {
+			redis.hashes[cmd[1]] = make(map[string]string)
+		}
+		return redis.hashes[cmd[1]]
+	}
+	var set = func() map[string]bool {
+		if redis.sets[cmd[1]] == nil {
+			redis.sets[cmd[1]] = make(map[string]bool)
+		}
+		return redis.sets[cmd[1]]
+	}
+	var members = func() []string {
+		var sorted = make([]string, 0)
+		for member := range set() {
+			sorted = append(sorted, member)
+		}
+		sort.Strings(sorted)
+		return sorted
+	}
+
+	switch cmd[0] {
+	case "HGET":
+		if val, ok := hash()[cmd[2]]; ok {
+			return val
+		}
+		return nil
+	case "HSET":
+		hash()[cmd[2]] = cmd[3]
+		return 1
+	case "HDEL":
+		delete(hash(), cmd[2])
+		return 1
+	case "HGETALL":
+		var fields = make([]string, 0)
+		for field, val := range hash() {
+			fields = append(fields, field, val)
+		}
+		return fields
+	case "ZADD":
+		for i := 3; i < len(cmd); i += 2 {
+			set()[cmd[i]] = true
+		}
+		return 1
+	case "ZREM":
+		delete(set(), cmd[2])
+		return 1
+	case "ZCARD":
+		return len(set())
+	case "ZRANGE":
+		return members()
+	case "ZRANGEBYLEX":
+		var inRange = func(member string, bound string, above bool) bool {
+			switch {
+			case bound == "-":
+				return above
+			case bound == "+":
+				return !above
+			case above && bound[0] == '[':
+				return member >= bound[1:]
+			case above:
+				return member > bound[1:]
+			case bound[0] == '[':
+				return member <= bound[1:]
+			}
+			return member < bound[1:]
+		}
+		var count, _ = strconv.Atoi(cmd[6])
+		var found = make([]string, 0)
+		for _, member := range members() {
+			if len(found) < count && inRange(member, cmd[2], true) && inRange(member, cmd[3], false) {
+				found = append(found, member)
+			}
+		}
+		return found
+	case "DEL":
+		for _, key := range cmd[1:] {
+			delete(redis.hashes, key)
+			delete(redis.sets, key)
+		}
+		return len(cmd) - 1
+	case "SCAN":
+		var found = make([]string, 0)
+		for key := range redis.sets {
+			if ok, _ := path.Match(cmd[3], key); ok {
+				found = append(found, key)
+			}
+		}
+		return []interface{}{ "0", found }
+	}
+	return fmt.Errorf("unknown command '%s'", strings.ToLower(cmd[0]))
+}
+
+func TestRedisStore(test *testing.T) {
+	var addr = startFakeRedis(test)
+	var open = func() *LogeDB {
+		var db = NewLogeDB(NewRedisStore(addr, nil))
+		var def = NewTypeDef("test", 1, &TestObj{})
+		def.Links = LinkSpec{ "other": "test" }
+		db.CreateType(def)
+		return db
+	}
+
+	var db = open()
+	db.Transact(func (t *Transaction) {
+		for i := 0; i < store_PAGE_SIZE + 10; i++ {
+			t.Set("test", Key("many", fmt.Sprintf("%04d", i)), &TestObj{ "Many" })
+		}
+		t.Set("test", "one", &TestObj{ "One" })
+		t.AddLink("test", "other", "one", Key("many", "0001"))
+		t.AddLink("test", "other", "one", Key("many", "0002"))
+	}, 0)
+	db.Transact(func (t *Transaction) {
+		t.RemoveLink("test", "other", "one", Key("many", "0001"))
+		t.Delete("test", Key("many", "0000"))
+	}, 0)
+	db.Close()
+
+	db = open()
+	defer db.Close()
+	if obj := db.ReadOne("test", "one").(*TestObj); obj == nil || obj.Name != "One" {
+		test.Errorf("Object lost on reopen: %v", obj)
+	}
+	db.Transact(func (t *Transaction) {
+		var keys = t.ListPrefix("test", KeyPrefix("many"), "", -1).All()
+		if len(keys) != store_PAGE_SIZE + 9 || keys[0] != Key("many", "0001") {
+			test.Errorf("Wrong keys across pages: %d", len(keys))
+		}
+		var from = t.ListPrefix("test", KeyPrefix("many"), Key("many", "0002"), 2).All()
+		if len(from) != 2 || from[0] != Key("many", "0003") {
+			test.Errorf("Wrong slice: %v", from)
+		}
+		if links := t.ReadLinks("test", "other", "one"); len(links) != 1 || links[0] != Key("many", "0002") {
+			test.Errorf("Wrong links: %v", links)
+		}
+		if found := t.Find("test", "other", Key("many", "0002")).All(); len(found) != 1 || found[0] != "one" {
+			test.Errorf("Wrong find: %v", found)
+		}
+	}, 0)
+
+	if count := db.Truncate("test"); count != store_PAGE_SIZE + 10 {
+		test.Errorf("Wrong truncate count: %d", count)
+	}
+	db.Transact(func (t *Transaction) {
+		if found := t.Find("test", "other", Key("many", "0002")).All(); len(found) != 0 {
+			test.Errorf("Index left after truncate: %v", found)
+		}
+	}, 0)
+}
@@ -0,0 +1,94 @@
+package loge
+
+// Reads an object and everything it links to through the named links,
+// so code walking the links afterwards doesn't go to the store once per
+// target:
+//
+//   var user = t.ReadWith("user", "brendon", "friends", "posts").(*User)
+//   for _, post := range t.Related("user", "posts", "brendon").All() {
+//       ...   // Already loaded
+//   }
+//
+// Link sets are loaded together, then each link's targets in one batch
+// as ReadMany does.
+func (t *Transaction) ReadWith(typeName string, key LogeKey, linkNames ...string) interface{} {
+	return t.ReadManyWith(typeName, []LogeKey{ key }, linkNames...)[0]
+}
+
+// ReadWith for several objects, batching each link's targets across all
+// of them
+func (t *Transaction) ReadManyWith(typeName string, keys []LogeKey, linkNames ...string) []interface{} {
+	var typ = t.db.lookupType(typeName)
+
+	var refs = t.objRefs(typeName, keys)
+	for _, linkName := range linkNames {
+		for _, key := range keys {
+			refs = append(refs, t.db.makeLinkRef(typeName, linkName, key))
+		}
+	}
+	t.loadMany(refs)
+
+	for _, linkName := range linkNames {
+		var targets []LogeKey
+		for _, key := range keys {
+			targets = append(targets, t.ReadLinks(typeName, linkName, key)...)
+		}
+		t.loadMany(t.objRefs(typ.Links[linkName].Target, targets))
+	}
+
+	var objects = make([]interface{}, len(keys))
+	for i, key := range keys {
+		objects[i] = t.Read(typeName, key)
+	}
+	return objects
+}
+
+// A link's targets, not read until something asks for them
+type Related struct {
+	t *Transaction
+	typeName string
+	linkName string
+	key LogeKey
+	targetType string
+	keys []LogeKey
+	read bool
+}
+
+func (t *Transaction) Related(typeName string, linkName string, key LogeKey) *Related {
+	t.db.makeLinkRef(typeName, linkName, key)
+	return &Related{
+		t: t,
+		typeName: typeName,
+		linkName: linkName,
+		key: key,
+		targetType: t.db.lookupType(typeName).Links[linkName].Target,
+	}
+}
+
+func (r *Related) Keys() []LogeKey {
+	if !r.read {
+		r.keys = r.t.ReadLinks(r.typeName, r.linkName, r.key)
+		r.read = true
+	}
+	return r.keys
+}
+
+func (r *Related) Len() int {
+	return len(r.Keys())
+}
+
+// Every target, loaded in one batch. Targets which don't exist come
+// back as their type's nil value, as with Read.
+func (r *Related) All() []interface{} {
+	return r.t.ReadMany(r.targetType, r.Keys())
+}
+
+// One target, or the nil value if it isn't linked
+func (r *Related) Get(target LogeKey) interface{} {
+	for _, key := range r.Keys() {
+		if key == target {
+			return r.t.Read(r.targetType, target)
+		}
+	}
+	return r.t.db.lookupType(r.targetType).NilValue()
+}
@@ -0,0 +1,71 @@
+package loge
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestReadWith(test *testing.T) {
+	var store = NewFaultStore(NewMemStore())
+	var db = NewLogeDB(store)
+	var def = NewTypeDef("person", 1, &TestObj{})
+	def.Links = LinkSpec{ "friends": "person", "posts": "post" }
+	db.CreateType(def)
+	db.CreateType(NewTypeDef("post", 1, &TestObj{}))
+
+	db.Transact(func (t *Transaction) {
+		for _, key := range []LogeKey{ "alice", "bob", "carol" } {
+			t.Set("person", key, &TestObj{ string(key) })
+		}
+		t.Set("post", "p1", &TestObj{ "First" })
+		t.Set("post", "p2", &TestObj{ "Second" })
+		t.SetLinks("person", "friends", "alice", []LogeKey{ "bob", "carol" })
+		t.SetLinks("person", "posts", "alice", []LogeKey{ "p1", "p2" })
+		t.SetLinks("person", "posts", "bob", []LogeKey{ "p2" })
+	}, 0)
+	db.FlushCache()
+
+	var broken = errors.New("broken")
+	db.Transact(func (t *Transaction) {
+		var people = t.ReadManyWith("person", []LogeKey{ "alice", "bob" }, "friends", "posts")
+		if people[0].(*TestObj).Name != "alice" || people[1].(*TestObj).Name != "bob" {
+			test.Errorf("Wrong objects: %v", people)
+		}
+
+		// Any further store read would fail
+		store.Script(FaultGet, Fault{ Err: broken })
+		var friends = t.Related("person", "friends", "alice").All()
+		if len(friends) != 2 || friends[1].(*TestObj).Name != "carol" {
+			test.Errorf("Wrong friends: %v", friends)
+		}
+		var posts = t.Related("person", "posts", "bob")
+		if posts.Len() != 1 || posts.Get("p2").(*TestObj).Name != "Second" || posts.Get("p1").(*TestObj) != nil {
+			test.Error("Wrong posts")
+		}
+		if store.Pending(FaultGet) != 1 {
+			test.Error("Related objects weren't preloaded")
+		}
+	}, 0)
+	store.Clear()
+
+	db.Transact(func (t *Transaction) {
+		var lazy = t.Related("person", "friends", "carol")
+		if len(t.versions) != 0 {
+			test.Error("Related read before use")
+		}
+		if lazy.Len() != 0 {
+			test.Error("Wrong empty link")
+		}
+	}, 0)
+
+	var t = db.CreateTransaction()
+	if _, err := t.TryReadWith("person", "alice", "nope"); !errors.Is(err, ErrNoSuchLink) {
+		test.Errorf("Wrong error for TryReadWith: %v", err)
+	}
+	if _, err := t.TryReadManyWith("nope", []LogeKey{ "alice" }); !errors.Is(err, ErrNoSuchType) {
+		test.Errorf("Wrong error for TryReadManyWith: %v", err)
+	}
+	if _, err := t.TryRelated("person", "nope", "alice"); !errors.Is(err, ErrNoSuchLink) {
+		test.Errorf("Wrong error for TryRelated: %v", err)
+	}
+}
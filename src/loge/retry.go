@@ -0,0 +1,64 @@
+package loge
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// How Transact and the rest retry a transaction whose commit conflicted.
+// Retry n waits InitialDelay * Exponent^(n-1), up to MaxDelay, less a
+// random part of up to Jitter of it so contenders spread out. The zero
+// policy retries at once, for as long as the timeout allows, which
+// suits short transactions on lightly contended objects.
+//
+//   db.SetRetryPolicy(loge.RetryPolicy{
+//       InitialDelay: time.Millisecond,
+//       Exponent: 2,
+//       MaxDelay: 100 * time.Millisecond,
+//       Jitter: 0.5,
+//   })
+type RetryPolicy struct {
+	InitialDelay time.Duration
+	Exponent float64 // 1 if less
+	MaxDelay time.Duration // Zero for no limit
+	Jitter float64 // 0 to 1
+	MaxAttempts int // Counting the first; zero for no limit
+	// After this many conflicts, zero for never: see ContentionReport
+	ReportAfter int
+	SerializeAfter int
+}
+
+// Set before use. TransactOptions can override it per call.
+func (db *LogeDB) SetRetryPolicy(policy RetryPolicy) {
+	db.retry = policy
+}
+
+func (db *LogeDB) RetryPolicy() RetryPolicy {
+	return db.retry
+}
+
+// Before retry number retry
+func (policy RetryPolicy) delay(retry int) time.Duration {
+	if policy.InitialDelay <= 0 {
+		return 0
+	}
+
+	var exponent = math.Max(policy.Exponent, 1)
+	var delay = float64(policy.InitialDelay) * math.Pow(exponent, float64(retry - 1))
+	if policy.MaxDelay > 0 && delay > float64(policy.MaxDelay) {
+		delay = float64(policy.MaxDelay)
+	}
+	if policy.Jitter > 0 {
+		delay -= delay * math.Min(policy.Jitter, 1) * rand.Float64()
+	}
+	return time.Duration(delay)
+}
+
+func (policy RetryPolicy) serialized(attempt int) bool {
+	return policy.SerializeAfter > 0 && attempt > policy.SerializeAfter
+}
+
+func (policy RetryPolicy) exhausted(attempts int) bool {
+	return policy.MaxAttempts > 0 && attempts >= policy.MaxAttempts
+}
@@ -0,0 +1,61 @@
+package loge
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	var clock = &manualClock{ now: time.Unix(1000, 0) }
+	db.SetClock(clock)
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+	db.SetRetryPolicy(RetryPolicy{
+		InitialDelay: 10 * time.Millisecond,
+		Exponent: 2,
+		MaxDelay: 30 * time.Millisecond,
+		MaxAttempts: 5,
+	})
+
+	var attempts = 0
+	var conflicting = func (t *Transaction) {
+		attempts++
+		t.Write("test", "one")
+		db.SetOne("test", "one", &TestObj{ "Other" })
+	}
+
+	if db.Transact(conflicting, 0) {
+		test.Fatal("Conflicting transaction committed")
+	}
+	if attempts != 5 || clock.Now() != time.Unix(1000, 0).Add(90 * time.Millisecond) {
+		test.Errorf("Wrong retries: %d attempts, %v waited", attempts, clock.Now().Sub(time.Unix(1000, 0)))
+	}
+
+	// The timeout still applies, counting the wait
+	attempts = 0
+	if db.Transact(conflicting, 25 * time.Millisecond) || attempts != 2 {
+		test.Errorf("Wrong retries within timeout: %d attempts", attempts)
+	}
+
+	attempts = 0
+	_, err := TransactResult(db, func (t *Transaction) (int, error) {
+		conflicting(t)
+		return 0, nil
+	}, TransactOptions{ Retry: &RetryPolicy{ MaxAttempts: 2 } })
+	if attempts != 2 || !errors.Is(err, ErrConflict) {
+		test.Errorf("Wrong retries with options: %d attempts (%v)", attempts, err)
+	}
+}
+
+func TestRetryJitter(test *testing.T) {
+	var policy = RetryPolicy{ InitialDelay: 100 * time.Millisecond, Jitter: 0.5 }
+	for i := 0; i < 100; i++ {
+		if delay := policy.delay(3); delay < 50 * time.Millisecond || delay > 100 * time.Millisecond {
+			test.Fatalf("Delay out of range: %v", delay)
+		}
+	}
+	if delay := (RetryPolicy{}).delay(1); delay != 0 {
+		test.Errorf("Zero policy waits %v", delay)
+	}
+}
@@ -0,0 +1,509 @@
+package loge
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"runtime"
+	"sync"
+
+	"github.com/brendonh/spack"
+	"github.com/linxGnu/grocksdb"
+)
+
+// Column families:
+//
+//   default        format stamp, and type:<name> -> spack type
+//   type:<name>    key -> object, one family per type
+//   links          <type> \0 <link> \0 <source> -> link set
+//   index          <type> \0 <link> \0 <target> \0 <source> -> empty
+//
+// Giving each type its own family keeps their memtables and compaction
+// apart, and lets Truncate drop a type whole.
+const rocks_LINKS_CF = "links"
+const rocks_INDEX_CF = "index"
+const rocks_TYPE_CF_PREFIX = "type:"
+
+const rocks_FORMAT_VERSION uint32 = 1
+
+var rocksFormatKey = []byte("format")
+
+
+type rocksDBStore struct {
+	basePath string
+	db *grocksdb.DB
+	types *spack.TypeSet
+	typeNames map[uint16]string
+
+	meta *grocksdb.ColumnFamilyHandle
+	links *grocksdb.ColumnFamilyHandle
+	index *grocksdb.ColumnFamilyHandle
+
+	// Truncate swaps a type's family for a fresh one
+	cfLock sync.RWMutex
+	typeCFs map[string]*grocksdb.ColumnFamilyHandle
+}
+
+type rocksDBResultSet struct {
+	ctx context.Context
+	it *grocksdb.Iterator
+	prefix []byte
+	stripLen int
+	limit int
+	count int
+	closed bool
+}
+
+type rocksDBContext struct {
+	rstore *rocksDBStore
+	ctx context.Context
+	snapshot *grocksdb.Snapshot
+	snapshotID uint64
+	readOptions *grocksdb.ReadOptions
+	batch *grocksdb.WriteBatch
+}
+
+var rocksWriteOptions = grocksdb.NewDefaultWriteOptions()
+var rocksReadOptions = grocksdb.NewDefaultReadOptions()
+
+// Laid out for write-heavy loads: commits are single write batches, and
+// compaction runs on every core.
+func NewRocksDBStore(basePath string) LogeStore {
+	store, err := OpenRocksDBStore(basePath)
+	if err != nil {
+		panic(err)
+	}
+	return store
+}
+
+func OpenRocksDBStore(basePath string) (store LogeStore, err error) {
+	defer recoverError(&err)
+
+	var opts = grocksdb.NewDefaultOptions()
+	opts.SetCreateIfMissing(true)
+	opts.SetCreateIfMissingColumnFamilies(true)
+	opts.IncreaseParallelism(runtime.NumCPU())
+	opts.OptimizeLevelStyleCompaction(512 << 20)
+
+	// Every existing family has to be opened along with the DB
+	var names = []string{ "default", rocks_LINKS_CF, rocks_INDEX_CF }
+	if existing, err := grocksdb.ListColumnFamilies(opts, basePath); err == nil {
+		for _, name := range existing {
+			if bytes.HasPrefix([]byte(name), []byte(rocks_TYPE_CF_PREFIX)) {
+				names = append(names, name)
+			}
+		}
+	}
+	var cfOpts = make([]*grocksdb.Options, len(names))
+	for i := range cfOpts {
+		cfOpts[i] = opts
+	}
+
+	db, handles, err := grocksdb.OpenDbColumnFamilies(opts, basePath, names, cfOpts)
+	if err != nil {
+		return nil, storeError("Can't open DB at %s: %v", basePath, err)
+	}
+
+	var rocksStore = &rocksDBStore{
+		basePath: basePath,
+		db: db,
+		types: spack.NewTypeSet(),
+		typeNames: make(map[uint16]string),
+		meta: handles[0],
+		links: handles[1],
+		index: handles[2],
+		typeCFs: make(map[string]*grocksdb.ColumnFamilyHandle),
+	}
+	for i, name := range names[3:] {
+		rocksStore.typeCFs[name[len(rocks_TYPE_CF_PREFIX):]] = handles[i + 3]
+	}
+
+	if err := rocksStore.checkFormat(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	rocksStore.loadTypeMetadata()
+	return rocksStore, nil
+}
+
+func (store *rocksDBStore) close() {
+	store.db.Close()
+}
+
+func (store *rocksDBStore) compact() {
+	store.cfLock.RLock()
+	defer store.cfLock.RUnlock()
+	for _, cf := range store.typeCFs {
+		store.db.CompactRangeCF(cf, grocksdb.Range{})
+	}
+	store.db.CompactRangeCF(store.links, grocksdb.Range{})
+	store.db.CompactRangeCF(store.index, grocksdb.Range{})
+}
+
+// Commits overwrite, so only live snapshots can see the past
+func (store *rocksDBStore) retainsVersions() bool {
+	return false
+}
+
+// A checkpoint: hard links to the live files where it can, so cheap
+func (store *rocksDBStore) backup(path string) error {
+	checkpoint, err := store.db.NewCheckpoint()
+	if err != nil {
+		return err
+	}
+	defer checkpoint.Destroy()
+	return checkpoint.CreateCheckpoint(path, 0)
+}
+
+func (store *rocksDBStore) describe() string {
+	return fmt.Sprintf("RocksDB: %s", store.basePath)
+}
+
+func (store *rocksDBStore) rebuildIndexes(db *LogeDB) int {
+	var wb = grocksdb.NewWriteBatch()
+	defer wb.Destroy()
+
+	var it = store.db.NewIteratorCF(rocksReadOptions, store.index)
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		wb.DeleteCF(store.index, it.Key().Data())
+	}
+	it.Close()
+
+	var count = 0
+	for _, typ := range db.types {
+		for linkName := range typ.Links {
+			var prefix = rocksLinkKey(typ.Name, linkName, "")
+			var it = store.db.NewIteratorCF(rocksReadOptions, store.links)
+			for it.Seek(prefix); it.Valid() && bytes.HasPrefix(it.Key().Data(), prefix); it.Next() {
+				var source = LogeKey(it.Key().Data()[len(prefix):])
+				var targets []string
+				spack.DecodeFromBytes(&targets, db.linkTypeSpec, it.Value().Data())
+				for _, target := range targets {
+					wb.PutCF(store.index, rocksIndexKey(typ.Name, linkName, LogeKey(target), source), []byte{})
+					count++
+				}
+			}
+			it.Close()
+		}
+	}
+
+	if err := store.db.Write(rocksWriteOptions, wb); err != nil {
+		panic(storeError("Write error: %v", err))
+	}
+	return count
+}
+
+func (store *rocksDBStore) truncate(typ *logeType) int {
+	store.cfLock.Lock()
+	defer store.cfLock.Unlock()
+
+	var old = store.typeCFs[typ.Name]
+	var count = 0
+	var it = store.db.NewIteratorCF(rocksReadOptions, old)
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		count++
+	}
+	it.Close()
+
+	if err := store.db.DropColumnFamily(old); err != nil {
+		panic(storeError("Can't drop %s: %v", typ.Name, err))
+	}
+	old.Destroy()
+	cf, err := store.db.CreateColumnFamily(grocksdb.NewDefaultOptions(), rocks_TYPE_CF_PREFIX + typ.Name)
+	if err != nil {
+		panic(storeError("Can't recreate %s: %v", typ.Name, err))
+	}
+	store.typeCFs[typ.Name] = cf
+
+	// Everything for the type sorts between <type> \0 and <type> \1
+	var wb = grocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	var start, end = []byte(typ.Name + "\x00"), []byte(typ.Name + "\x01")
+	wb.DeleteRangeCF(store.links, start, end)
+	wb.DeleteRangeCF(store.index, start, end)
+	if err := store.db.Write(rocksWriteOptions, wb); err != nil {
+		panic(storeError("Write error: %v", err))
+	}
+	return count
+}
+
+func (store *rocksDBStore) registerType(typ *logeType) {
+	store.typeNames[typ.SpackType.Tag] = typ.Name
+
+	store.cfLock.Lock()
+	if _, ok := store.typeCFs[typ.Name]; !ok {
+		cf, err := store.db.CreateColumnFamily(grocksdb.NewDefaultOptions(), rocks_TYPE_CF_PREFIX + typ.Name)
+		if err != nil {
+			store.cfLock.Unlock()
+			panic(storeError("Can't create family for %s: %v", typ.Name, err))
+		}
+		store.typeCFs[typ.Name] = cf
+	}
+	store.cfLock.Unlock()
+
+	registerTypeInfo(store.types, typ, func(name string, info []byte) error {
+		return store.db.PutCF(rocksWriteOptions, store.meta, []byte("type:" + name), info)
+	})
+}
+
+func (store *rocksDBStore) getSpackType(name string) *spack.VersionedType {
+	return store.types.RegisterType(name)
+}
+
+func (store *rocksDBStore) typeCF(name string) *grocksdb.ColumnFamilyHandle {
+	store.cfLock.RLock()
+	defer store.cfLock.RUnlock()
+	return store.typeCFs[name]
+}
+
+
+// -----------------------------------------------
+// Search
+// -----------------------------------------------
+
+func (rs *rocksDBResultSet) Valid() bool {
+	if rs.closed {
+		return false
+	}
+	if !rs.it.Valid() || !bytes.HasPrefix(rs.it.Key().Data(), rs.prefix) ||
+		(rs.limit >= 0 && rs.count >= rs.limit) {
+		rs.Close()
+		return false
+	}
+	return true
+}
+
+func (rs *rocksDBResultSet) Next() LogeKey {
+	if !rs.Valid() {
+		return ""
+	}
+	if rs.ctx.Err() != nil {
+		rs.Close()
+		checkContext(rs.ctx)
+	}
+	var next = LogeKey(rs.it.Key().Data()[rs.stripLen:])
+	rs.it.Next()
+	rs.count++
+	return next
+}
+
+func (rs *rocksDBResultSet) All() []LogeKey {
+	var keys = make([]LogeKey, 0)
+	for rs.Valid() {
+		keys = append(keys, rs.Next())
+	}
+	return keys
+}
+
+func (rs *rocksDBResultSet) Close() {
+	if rs.closed {
+		return
+	}
+	if rs.it != nil {
+		rs.it.Close()
+	}
+	rs.closed = true
+}
+
+
+// -----------------------------------------------
+// Transaction Contexts
+// -----------------------------------------------
+
+func (store *rocksDBStore) newContext(ctx context.Context, sID uint64) transactionContext {
+	var snapshot = store.db.NewSnapshot()
+	var options = grocksdb.NewDefaultReadOptions()
+	options.SetSnapshot(snapshot)
+	return &rocksDBContext{
+		rstore: store,
+		ctx: ctx,
+		readOptions: options,
+		snapshot: snapshot,
+		snapshotID: sID,
+		batch: grocksdb.NewWriteBatch(),
+	}
+}
+
+func (context *rocksDBContext) getSnapshotID() uint64 {
+	return context.snapshotID
+}
+
+func (context *rocksDBContext) commit(sID uint64) error {
+	defer context.cleanup()
+	if context.batch.Count() == 0 {
+		return nil
+	}
+	return context.rstore.db.Write(rocksWriteOptions, context.batch)
+}
+
+func (context *rocksDBContext) rollback() {
+	context.cleanup()
+}
+
+func (context *rocksDBContext) cleanup() {
+	context.rstore.db.ReleaseSnapshot(context.snapshot)
+	context.readOptions.Destroy()
+	context.batch.Destroy()
+}
+
+
+// -----------------------------------------------
+// transactionContext API
+// -----------------------------------------------
+
+func (context *rocksDBContext) get(ref objRef) []byte {
+	checkContext(context.ctx)
+	var cf, key = context.rstore.locate(ref)
+	val, err := context.rstore.db.GetCF(context.readOptions, cf, key)
+	if err != nil {
+		panic(storeError("Read error: %v", err))
+	}
+	defer val.Free()
+
+	if !val.Exists() {
+		return nil
+	}
+	return append([]byte{}, val.Data()...)
+}
+
+func (context *rocksDBContext) contains(ref objRef) bool {
+	return context.get(ref) != nil
+}
+
+func (context *rocksDBContext) store(ref objRef, enc []byte) error {
+	var cf, key = context.rstore.locate(ref)
+	if len(enc) == 0 {
+		context.batch.DeleteCF(cf, key)
+	} else {
+		context.batch.PutCF(cf, key, enc)
+	}
+	return nil
+}
+
+func (context *rocksDBContext) addIndex(ref objRef, source LogeKey) {
+	var key = rocksIndexKey(ref.Type.Name, ref.LinkName, ref.Key, source)
+	context.batch.PutCF(context.rstore.index, key, []byte{})
+}
+
+func (context *rocksDBContext) remIndex(ref objRef, source LogeKey) {
+	var key = rocksIndexKey(ref.Type.Name, ref.LinkName, ref.Key, source)
+	context.batch.DeleteCF(context.rstore.index, key)
+}
+
+func (context *rocksDBContext) find(ref objRef) ResultSet {
+	return context.findSlice(ref, "", "", -1)
+}
+
+func (context *rocksDBContext) findSlice(ref objRef, keyPrefix LogeKey, from LogeKey, limit int) ResultSet {
+	var base = rocksIndexKey(ref.Type.Name, ref.LinkName, ref.Key, "")
+	return context.slice(context.rstore.index, base, keyPrefix, from, limit)
+}
+
+func (context *rocksDBContext) listSlice(typePrefix []byte, keyPrefix LogeKey, from LogeKey, limit int) ResultSet {
+	var tag = uint16(binary.BigEndian.Uint32(typePrefix) >> 16)
+	var name, ok = context.rstore.typeNames[tag]
+	if !ok {
+		panic(storeError("No type with tag %d", tag))
+	}
+	return context.slice(context.rstore.typeCF(name), []byte{}, keyPrefix, from, limit)
+}
+
+// Keys in cf under base which start with keyPrefix, after from
+func (context *rocksDBContext) slice(cf *grocksdb.ColumnFamilyHandle, base []byte, keyPrefix LogeKey, from LogeKey, limit int) ResultSet {
+	checkContext(context.ctx)
+	if limit == 0 {
+		return &rocksDBResultSet{ closed: true }
+	}
+
+	if from != "" && !from.HasPrefix(keyPrefix) {
+		if from > keyPrefix {
+			return &rocksDBResultSet{ closed: true }
+		}
+		from = ""
+	}
+
+	var prefix = append(append([]byte{}, base...), keyPrefix...)
+	var it = context.rstore.db.NewIteratorCF(context.readOptions, cf)
+	if from == "" {
+		it.Seek(prefix)
+	} else {
+		var start = append(append([]byte{}, base...), from...)
+		it.Seek(start)
+		if it.Valid() && bytes.Equal(it.Key().Data(), start) {
+			it.Next()
+		}
+	}
+	if err := it.Err(); err != nil {
+		it.Close()
+		panic(storeError("Read error: %v", err))
+	}
+
+	return &rocksDBResultSet{
+		ctx: context.ctx,
+		it: it,
+		prefix: prefix,
+		stripLen: len(base),
+		limit: limit,
+	}
+}
+
+// -----------------------------------------------
+// Internals
+// -----------------------------------------------
+
+func (store *rocksDBStore) locate(ref objRef) (*grocksdb.ColumnFamilyHandle, []byte) {
+	if ref.IsLink() {
+		return store.links, rocksLinkKey(ref.Type.Name, ref.LinkName, ref.Key)
+	}
+	return store.typeCF(ref.Type.Name), []byte(ref.Key)
+}
+
+func rocksLinkKey(typeName string, linkName string, source LogeKey) []byte {
+	var key = make([]byte, 0, len(typeName) + len(linkName) + len(source) + 2)
+	key = append(append(key, typeName...), 0)
+	key = append(append(key, linkName...), 0)
+	return append(key, source...)
+}
+
+func rocksIndexKey(typeName string, linkName string, target LogeKey, source LogeKey) []byte {
+	var key = rocksLinkKey(typeName, linkName, target)
+	key = append(key, 0)
+	return append(key, source...)
+}
+
+func (store *rocksDBStore) loadTypeMetadata() {
+	var typeType = store.types.Type("_type")
+	var prefix = []byte("type:")
+	var it = store.db.NewIteratorCF(rocksReadOptions, store.meta)
+	defer it.Close()
+
+	for it.Seek(prefix); it.Valid() && bytes.HasPrefix(it.Key().Data(), prefix); it.Next() {
+		var typeInfo, _, err = typeType.DecodeObj(it.Value().Data(), false)
+		if err != nil {
+			panic(storeError("Error loading type info: %v", err))
+		}
+		store.types.LoadType(typeInfo.(*spack.VersionedType))
+	}
+}
+
+func (store *rocksDBStore) checkFormat() error {
+	val, err := store.db.GetCF(rocksReadOptions, store.meta, rocksFormatKey)
+	if err != nil {
+		return storeError("Read error: %v", err)
+	}
+	defer val.Free()
+
+	var stamp []byte
+	if val.Exists() {
+		stamp = val.Data()
+	}
+	return checkFormatStamp(store.basePath, stamp, rocks_FORMAT_VERSION, false,
+		func (stamp []byte) error {
+			if err := store.db.PutCF(rocksWriteOptions, store.meta, rocksFormatKey, stamp); err != nil {
+				return storeError("Write error: %v", err)
+			}
+			return nil
+		})
+}
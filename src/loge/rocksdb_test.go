@@ -0,0 +1,60 @@
+package loge
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestRocksDBReopen(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "loge-rocks")
+	defer os.RemoveAll(dir)
+
+	var open = func() *LogeDB {
+		var db = NewLogeDB(NewRocksDBStore(dir))
+		var def = NewTypeDef("test", 1, &TestObj{})
+		def.Links = LinkSpec{ "other": "test" }
+		db.CreateType(def)
+		db.CreateType(NewTypeDef("kept", 1, &TestObj{}))
+		return db
+	}
+
+	var db = open()
+	db.Transact(func (t *Transaction) {
+		t.Set("test", "one", &TestObj{ "One" })
+		t.Set("test", "two", &TestObj{ "Two" })
+		t.Set("kept", "one", &TestObj{ "Kept" })
+		t.AddLink("test", "other", "two", "one")
+	}, 0)
+	db.Close()
+
+	// Type families have to be found and opened again
+	db = open()
+	defer db.Close()
+	if obj := db.ReadOne("test", "one").(*TestObj); obj == nil || obj.Name != "One" {
+		test.Errorf("Object lost on reopen: %v", obj)
+	}
+	var find = func() (found []LogeKey) {
+		db.Transact(func (t *Transaction) {
+			found = t.Find("test", "other", "one").All()
+		}, 0)
+		return
+	}
+	if found := find(); len(found) != 1 || found[0] != "two" {
+		test.Errorf("Index lost on reopen: %v", found)
+	}
+
+	if count := db.Truncate("test"); count != 2 {
+		test.Errorf("Wrong truncate count: %d", count)
+	}
+	if db.ExistsOne("test", "two") || len(find()) != 0 {
+		test.Error("Type survived truncate")
+	}
+	if db.ReadOne("kept", "one").(*TestObj) == nil {
+		test.Error("Truncate went past its type")
+	}
+	db.SetOne("test", "three", &TestObj{ "Three" })
+	if db.ReadOne("test", "three").(*TestObj) == nil {
+		test.Error("Truncated type not writable")
+	}
+}
@@ -0,0 +1,164 @@
+package loge
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Enough of S3 for cold storage: GET, PUT and DELETE of single objects,
+// signed with AWS signature version 4. Requests are path-style, which
+// S3-compatible servers (MinIO, Ceph, R2...) all take.
+type S3Config struct {
+	// e.g. https://s3.eu-west-1.amazonaws.com
+	Endpoint string
+	Region string
+	Bucket string
+	// Put in front of every key
+	Prefix string
+	AccessKey string
+	SecretKey string
+	// http.DefaultClient if nil
+	Client *http.Client
+}
+
+type S3Storage struct {
+	config S3Config
+	endpoint *url.URL
+}
+
+func NewS3Storage(config S3Config) *S3Storage {
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil {
+		panic(fmt.Errorf("Bad S3 endpoint %q: %v", config.Endpoint, err))
+	}
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+	}
+	return &S3Storage{ config, endpoint }
+}
+
+func (s3 *S3Storage) Get(ctx context.Context, key string) ([]byte, error) {
+	resp, err := s3.do(ctx, "GET", key, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+func (s3 *S3Storage) Put(ctx context.Context, key string, blob []byte) error {
+	resp, err := s3.do(ctx, "PUT", key, blob)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s3 *S3Storage) Delete(ctx context.Context, key string) error {
+	resp, err := s3.do(ctx, "DELETE", key, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Non-2xx responses come back as errors, 404 as ErrNoSuchObject
+func (s3 *S3Storage) do(ctx context.Context, method string, key string, body []byte) (*http.Response, error) {
+	var path = "/" + s3Escape(s3.config.Bucket) + "/" + s3Escape(s3.config.Prefix + key)
+	req, err := http.NewRequestWithContext(ctx, method, s3.endpoint.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	// Sent escaped exactly as signed
+	req.URL.Path = "/" + s3.config.Bucket + "/" + s3.config.Prefix + key
+	req.URL.RawPath = path
+	req.ContentLength = int64(len(body))
+	s3.sign(req, path, body, time.Now().UTC())
+
+	resp, err := s3.config.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: s3 %s", ErrNoSuchObject, key)
+	}
+	if resp.StatusCode / 100 != 2 {
+		var detail, _ = io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, fmt.Errorf("S3 %s %s: %s %s", method, key, resp.Status, detail)
+	}
+	return resp, nil
+}
+
+func (s3 *S3Storage) sign(req *http.Request, path string, body []byte, now time.Time) {
+	var amzDate = now.Format("20060102T150405Z")
+	var date = amzDate[:8]
+	var payloadHash = s3Hash(body)
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	var signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+	var canonical = strings.Join([]string{
+		req.Method,
+		path,
+		"",
+		"host:" + s3.endpoint.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	var scope = date + "/" + s3.config.Region + "/s3/aws4_request"
+	var toSign = "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + s3Hash([]byte(canonical))
+
+	var signingKey = []byte("AWS4" + s3.config.SecretKey)
+	for _, part := range []string{ date, s3.config.Region, "s3", "aws4_request" } {
+		signingKey = s3HMAC(signingKey, part)
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3.config.AccessKey, scope, signedHeaders, hex.EncodeToString(s3HMAC(signingKey, toSign))))
+}
+
+func s3Hash(data []byte) string {
+	var sum = sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func s3HMAC(key []byte, data string) []byte {
+	var mac = hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// URI encoding as SigV4 wants it: everything but unreserved characters
+// and slashes
+func s3Escape(path string) string {
+	var buf strings.Builder
+	for _, b := range []byte(path) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9',
+			b == '-', b == '_', b == '.', b == '~', b == '/':
+			buf.WriteByte(b)
+		default:
+			fmt.Fprintf(&buf, "%%%02X", b)
+		}
+	}
+	return buf.String()
+}
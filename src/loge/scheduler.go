@@ -0,0 +1,287 @@
+package loge
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Runs periodic maintenance jobs on the DB's clock:
+//
+//   var sched = loge.NewScheduler(db)
+//   sched.Add(loge.CompactJob(time.Hour))
+//   sched.Add(loge.Job{ Name: "refresh", Every: time.Minute, Jitter: 10 * time.Second,
+//       Transact: func (t *loge.Transaction) { ... } })
+//   sched.Start()
+//   defer sched.Stop()
+//
+// Each job waits Every plus up to Jitter between runs, so instances
+// started together don't run in lockstep. A job has either Transact,
+// run as a transaction, or Run for work which isn't one. With replicas,
+// set Leader so only one instance does the work (e.g. a logerepl
+// Replica's Promoted); runs while it's false are skipped.
+type Scheduler struct {
+	Leader func() bool
+
+	db *LogeDB
+	lock sync.Mutex
+	jobs map[string]*scheduledJob
+	rand *rand.Rand
+	running bool
+	generation int
+	wg sync.WaitGroup
+}
+
+type Job struct {
+	Name string
+	Every time.Duration
+	Jitter time.Duration
+	Transact Transactor
+	Run func(*LogeDB) error
+	Timeout time.Duration // For Transact, as with db.Transact
+}
+
+// How a job has been doing
+type JobStats struct {
+	Name string
+	Runs int
+	Failures int
+	Skipped int
+	LastRun time.Time
+	LastDuration time.Duration
+	LastErr error
+	Next time.Time
+}
+
+type scheduledJob struct {
+	job Job
+	stats JobStats
+	removed bool
+	runLock sync.Mutex
+}
+
+func NewScheduler(db *LogeDB) *Scheduler {
+	return &Scheduler{
+		db: db,
+		jobs: make(map[string]*scheduledJob),
+		rand: rand.New(rand.NewSource(db.clock.Now().UnixNano())),
+	}
+}
+
+func (s *Scheduler) Add(job Job) {
+	if (job.Transact == nil) == (job.Run == nil) {
+		panic(fmt.Sprintf("Job %s needs one of Transact or Run", job.Name))
+	}
+	if job.Every <= 0 {
+		panic(fmt.Sprintf("Job %s has no interval", job.Name))
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.jobs[job.Name]; ok {
+		panic(fmt.Sprintf("Job %s already exists", job.Name))
+	}
+	var sj = &scheduledJob{ job: job, stats: JobStats{ Name: job.Name } }
+	s.jobs[job.Name] = sj
+	if s.running {
+		s.startJob(sj)
+	}
+}
+
+// A run in progress finishes first
+func (s *Scheduler) Remove(name string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	sj, ok := s.jobs[name]
+	if ok {
+		sj.removed = true
+		delete(s.jobs, name)
+	}
+	return ok
+}
+
+func (s *Scheduler) Start() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.running {
+		return
+	}
+	s.running = true
+	s.generation++
+	for _, sj := range s.jobs {
+		s.startJob(sj)
+	}
+}
+
+// Waits for running jobs. Jobs asleep until their next run aren't
+// woken; they notice they've stopped when they wake.
+func (s *Scheduler) Stop() {
+	s.lock.Lock()
+	s.running = false
+	s.lock.Unlock()
+	s.wg.Wait()
+}
+
+// Runs a job straight away, leader or not, whether or not the
+// scheduler has started
+func (s *Scheduler) RunNow(name string) error {
+	s.lock.Lock()
+	sj, ok := s.jobs[name]
+	s.lock.Unlock()
+	if !ok {
+		return fmt.Errorf("No such job: %s", name)
+	}
+	return s.run(sj)
+}
+
+// By job name
+func (s *Scheduler) Stats() []JobStats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var stats = make([]JobStats, 0, len(s.jobs))
+	for _, sj := range s.jobs {
+		stats = append(stats, sj.stats)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats
+}
+
+// Called with the lock held
+func (s *Scheduler) startJob(sj *scheduledJob) {
+	var generation = s.generation
+	go func() {
+		for {
+			var wait = s.nextWait(sj)
+			s.db.clock.Sleep(wait)
+
+			s.lock.Lock()
+			if !s.running || s.generation != generation || sj.removed {
+				s.lock.Unlock()
+				return
+			}
+			var leader = s.Leader == nil || s.Leader()
+			if !leader {
+				sj.stats.Skipped++
+			}
+			s.wg.Add(1)
+			s.lock.Unlock()
+
+			if leader {
+				s.run(sj)
+			}
+			s.wg.Done()
+		}
+	}()
+}
+
+func (s *Scheduler) nextWait(sj *scheduledJob) time.Duration {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var wait = sj.job.Every
+	if sj.job.Jitter > 0 {
+		wait += time.Duration(s.rand.Int63n(int64(sj.job.Jitter)))
+	}
+	sj.stats.Next = s.db.clock.Now().Add(wait)
+	return wait
+}
+
+func (s *Scheduler) run(sj *scheduledJob) (err error) {
+	sj.runLock.Lock()
+	defer sj.runLock.Unlock()
+
+	var start = s.db.clock.Now()
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("Job %s panicked: %v", sj.job.Name, r)
+		}
+
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		sj.stats.Runs++
+		sj.stats.LastRun = start
+		sj.stats.LastDuration = s.db.clock.Now().Sub(start)
+		sj.stats.LastErr = err
+		if err != nil {
+			sj.stats.Failures++
+		}
+	}()
+
+	if sj.job.Run != nil {
+		return sj.job.Run(s.db)
+	}
+	ok, err := s.db.TryTransact(sj.job.Transact, sj.job.Timeout)
+	if err == nil && !ok {
+		err = ErrNotCommitted
+	}
+	return err
+}
+
+// -----------------------------------------------
+// Stock jobs
+// -----------------------------------------------
+
+func CompactJob(every time.Duration) Job {
+	return Job{
+		Name: "compact",
+		Every: every,
+		Jitter: every / 10,
+		Run: func(db *LogeDB) error {
+			db.Compact()
+			return nil
+		},
+	}
+}
+
+// Drops superseded versions from the cache; see FlushCache
+func FlushCacheJob(every time.Duration) Job {
+	return Job{
+		Name: "flush-cache",
+		Every: every,
+		Jitter: every / 10,
+		Run: func(db *LogeDB) error {
+			db.FlushCache()
+			return nil
+		},
+	}
+}
+
+// Deletes objects of a type for which expired is true, with their links,
+// in transactions of up to batch objects. The store has to support
+// List.
+func SweepJob(typeName string, every time.Duration, batch int, expired func(obj interface{}, now time.Time) bool) Job {
+	return Job{
+		Name: "sweep-" + typeName,
+		Every: every,
+		Jitter: every / 10,
+		Run: func(db *LogeDB) (err error) {
+			defer recoverError(&err)
+			var typ = db.lookupType(typeName)
+			var from LogeKey
+			for {
+				var keys = db.ListSlice(typeName, from, batch)
+				if len(keys) == 0 {
+					return nil
+				}
+				var now = db.clock.Now()
+				db.Transact(func (t *Transaction) {
+					for _, key := range keys {
+						obj, ok := t.ReadOK(typeName, key)
+						if !ok || !expired(obj, now) {
+							continue
+						}
+						t.Delete(typeName, key)
+						for linkName := range typ.Links {
+							t.SetLinks(typeName, linkName, key, nil)
+						}
+					}
+				}, 0)
+				if len(keys) < batch {
+					return nil
+				}
+				from = keys[len(keys) - 1]
+			}
+		},
+	}
+}
@@ -0,0 +1,98 @@
+package loge
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestScheduler(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	defer db.Close()
+	db.CreateType(NewTypeDef("counter", 1, &TestCounter{}))
+
+	var sched = NewScheduler(db)
+	var leader int32 = 1
+	sched.Leader = func() bool { return atomic.LoadInt32(&leader) == 1 }
+	sched.Add(Job{
+		Name: "tick",
+		Every: 2 * time.Millisecond,
+		Jitter: time.Millisecond,
+		Transact: func (t *Transaction) {
+			var counter = t.Write("counter", "ticks").(*TestCounter)
+			if counter == nil {
+				t.Set("counter", "ticks", &TestCounter{ 1 })
+			} else {
+				counter.Value++
+			}
+		},
+	})
+	var broken = errors.New("broken")
+	sched.Add(Job{
+		Name: "broken",
+		Every: time.Hour,
+		Run: func(db *LogeDB) error { return broken },
+	})
+
+	if err := sched.RunNow("broken"); err != broken {
+		test.Errorf("Wrong RunNow error: %v", err)
+	}
+
+	sched.Start()
+	var waitFor = func(done func(JobStats) bool) {
+		var deadline = time.Now().Add(5 * time.Second)
+		for !done(sched.Stats()[1]) {
+			if time.Now().After(deadline) {
+				test.Fatalf("Timed out: %+v", sched.Stats())
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	waitFor(func(stats JobStats) bool { return stats.Runs >= 3 })
+	atomic.StoreInt32(&leader, 0)
+	var skipped = sched.Stats()[1].Skipped
+	waitFor(func(stats JobStats) bool { return stats.Skipped > skipped })
+	sched.Stop()
+
+	var stats = sched.Stats()
+	if stats[0].Name != "broken" || stats[0].Failures != 1 || stats[0].LastErr != broken {
+		test.Errorf("Wrong failed job stats: %+v", stats[0])
+	}
+	var ticks = db.ReadOne("counter", "ticks").(*TestCounter).Value
+	if int(ticks) != stats[1].Runs - stats[1].Failures {
+		test.Errorf("Ran %d times but counted %d", stats[1].Runs, ticks)
+	}
+	if !sched.Remove("tick") || sched.Remove("tick") {
+		test.Error("Wrong job removal")
+	}
+}
+
+func TestSweepJob(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "loge-sweep")
+	defer os.RemoveAll(dir)
+
+	var db = NewLogeDB(NewLevelDBStore(dir))
+	defer db.Close()
+	db.CreateType(NewTypeDef("counter", 1, &TestCounter{}))
+	db.Transact(func (t *Transaction) {
+		for i, key := range []LogeKey{ "a", "b", "c", "d", "e" } {
+			t.Set("counter", key, &TestCounter{ uint32(i) })
+		}
+	}, 0)
+
+	var sched = NewScheduler(db)
+	sched.Add(SweepJob("counter", time.Hour, 2, func(obj interface{}, now time.Time) bool {
+		return obj.(*TestCounter).Value % 2 == 0
+	}))
+	if err := sched.RunNow("sweep-counter"); err != nil {
+		test.Fatal(err)
+	}
+
+	var left = db.ListSlice("counter", "", 10)
+	if len(left) != 2 || left[0] != "b" || left[1] != "d" {
+		test.Errorf("Wrong objects left: %v", left)
+	}
+}
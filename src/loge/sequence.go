@@ -0,0 +1,64 @@
+package loge
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+)
+
+// Snapshot IDs taken by commits whose store writes haven't finished.
+// The store gets them in ID order, each write waiting for the ones
+// before it, and transactions only open below the oldest unwritten one,
+// so the snapshot lock is only held while an ID is taken.
+type commitSequence struct {
+	lock sync.Mutex
+	cond *sync.Cond
+	pending []uint64
+	// Below the oldest write not in the store yet
+	visible uint64
+}
+
+// Under the snapshot lock, so IDs are reserved in order
+func (seq *commitSequence) reserve(sID uint64) {
+	seq.lock.Lock()
+	defer seq.lock.Unlock()
+	if seq.cond == nil {
+		seq.cond = sync.NewCond(&seq.lock)
+	}
+
+	if len(seq.pending) == 0 {
+		atomic.StoreUint64(&seq.visible, sID - 1)
+	}
+	seq.pending = append(seq.pending, sID)
+}
+
+// Waits until every ID reserved before sID is written
+func (seq *commitSequence) wait(sID uint64) {
+	seq.lock.Lock()
+	defer seq.lock.Unlock()
+	for seq.pending[0] != sID {
+		seq.cond.Wait()
+	}
+}
+
+// After sID's store write, whether or not it worked
+func (seq *commitSequence) done(sID uint64) {
+	seq.lock.Lock()
+	defer seq.lock.Unlock()
+	seq.pending = seq.pending[1:]
+	if len(seq.pending) > 0 {
+		atomic.StoreUint64(&seq.visible, seq.pending[0] - 1)
+	} else {
+		atomic.StoreUint64(&seq.visible, math.MaxUint64)
+	}
+	seq.cond.Broadcast()
+}
+
+// Waits for every reserved ID to be written
+func (seq *commitSequence) drain() {
+	seq.lock.Lock()
+	defer seq.lock.Unlock()
+	for len(seq.pending) > 0 {
+		seq.cond.Wait()
+	}
+}
@@ -0,0 +1,95 @@
+package loge
+
+import (
+	"sync/atomic"
+)
+
+// Makes the transaction serializable: as well as aborting if an object
+// it read or wrote was committed since its snapshot, as every commit
+// does, it aborts if a Find or List query it ran since would now give
+// different keys, e.g. because a matching object was added. Queries are
+// run again as the commit applies, while no other commit can, so the
+// more there are the longer other commits wait. Read-only transactions
+// have nothing to check.
+func (t *Transaction) SetSerializable() {
+	t.SetIsolation(Serializable)
+}
+
+func (t *Transaction) Serializable() bool {
+	return t.isolation == Serializable
+}
+
+// A Find or List call, to run again at commit
+type query struct {
+	typ *logeType
+	ref objRef // For Find
+	typePrefix []byte // For List
+	keyPrefix LogeKey
+	from LogeKey
+	limit int
+}
+
+func (t *Transaction) recordQuery(q query) {
+	if t.isolation == Serializable {
+		t.queries = append(t.queries, q)
+	}
+}
+
+func (q query) run(context transactionContext) []LogeKey {
+	var results ResultSet
+	if q.typePrefix != nil {
+		results = context.listSlice(q.typePrefix, q.keyPrefix, q.from, q.limit)
+	} else {
+		results = context.findSlice(q.ref, q.keyPrefix, q.from, q.limit)
+	}
+	defer results.Close()
+	return results.All()
+}
+
+// The first query whose results changed since the snapshot, as a
+// conflict on the first key to differ. Under the snapshot lock.
+func (t *Transaction) checkQueries() *ConflictInfo {
+	if len(t.queries) == 0 {
+		return nil
+	}
+
+	var latestID = atomic.LoadUint64(&t.db.lastSnapshotID)
+	var latest = t.db.store.newContext(t.ctx, latestID)
+	defer latest.rollback()
+
+	for _, q := range t.queries {
+		var before, after = q.run(t.context), q.run(latest)
+		var key, changed = firstDifference(before, after)
+		if !changed {
+			continue
+		}
+		var info = &ConflictInfo{
+			Type: q.typ.Name,
+			Key: key,
+			SnapshotID: t.snapshotID,
+			CurrentID: latestID,
+			Label: t.label,
+		}
+		if q.typePrefix == nil {
+			info.Link = q.ref.LinkName
+		}
+		return info
+	}
+	return nil
+}
+
+func firstDifference(before []LogeKey, after []LogeKey) (LogeKey, bool) {
+	for i := 0; i < len(before) || i < len(after); i++ {
+		switch {
+		case i >= len(before):
+			return after[i], true
+		case i >= len(after):
+			return before[i], true
+		case before[i] < after[i]:
+			return before[i], true
+		case before[i] > after[i]:
+			return after[i], true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,59 @@
+package loge
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestSerializable(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "loge-serializable")
+	defer os.RemoveAll(dir)
+
+	var db = NewLogeDB(NewLevelDBStore(dir))
+	defer db.Close()
+	var def = NewTypeDef("test", 1, &TestObj{})
+	def.Links = LinkSpec{ "other": "test" }
+	db.CreateType(def)
+	db.CreateType(NewTypeDef("skew", 1, &TestObj{}))
+	db.SetOne("test", "one", &TestObj{ "One" })
+	db.SetOne("skew", "one", &TestObj{ "One" })
+
+	// Write skew on a query: each sees only the one object and adds its own
+	var onCall = func (typeName string, key LogeKey, serializable bool) *Transaction {
+		var t = db.CreateTransaction()
+		if serializable {
+			t.SetSerializable()
+		}
+		if keys := t.ListSlice(typeName, "", -1).All(); len(keys) == 1 {
+			t.Set(typeName, key, &TestObj{ "On call" })
+		}
+		return t
+	}
+
+	var first, second = onCall("test", "a", true), onCall("test", "b", true)
+	if !first.Commit() {
+		test.Fatal("First serializable commit failed")
+	}
+	var info *ConflictInfo
+	if second.Commit() || !errors.As(second.Err(), &info) || info.Type != "test" || info.Key != "a" {
+		test.Errorf("Phantom not detected: %v", second.Err())
+	}
+
+	first, second = onCall("skew", "a", false), onCall("skew", "b", false)
+	if !first.Commit() || !second.Commit() {
+		test.Error("Snapshot isolation commit aborted")
+	}
+
+	var t = db.CreateTransaction()
+	t.SetSerializable()
+	t.Find("test", "other", "one").All()
+	t.Set("test", "three", &TestObj{ "Three" })
+	db.Transact(func (t *Transaction) {
+		t.AddLink("test", "other", "two", "one")
+	}, 0)
+	if t.Commit() || !errors.As(t.Err(), &info) || info.Link != "other" || info.Key != "two" {
+		test.Errorf("Changed find not detected: %v", t.Err())
+	}
+}
@@ -1,8 +1,6 @@
 package loge
 
 import (
-	"fmt"
-
 	. "github.com/brendonh/go-service"
 )
 
@@ -49,13 +47,7 @@ func GetService() *Service {
 func method_info(args APIData, session Session, context ServerContext) (bool, APIData) {
 	var db = context.(LogeServiceContext).DB()
 
-	var dbInfo string
-	switch db.store.(type) {
-	case *memStore:
-		dbInfo = "Memory"
-	case *levelDBStore:
-		dbInfo = fmt.Sprintf("LevelDB: %s", db.store.(*levelDBStore).basePath)
-	}
+	var dbInfo = db.store.describe()
 
 	var types []string
 	for typeName := range db.types {
@@ -100,7 +92,7 @@ func method_get(args APIData, session Session, context ServerContext) (bool, API
 	var key = LogeKey(args["key"].(string))
 
 	var obj interface{}
-	var links  = make(map[string][]string)
+	var links  = make(map[string][]LogeKey)
 	db.TransactJSON(func (t *Transaction) {
 		obj = t.Read(typeName, key)
 		if obj != nil {
@@ -0,0 +1,312 @@
+package loge
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/brendonh/spack"
+)
+
+// A store spreading objects across several others by a hash of their
+// keys, e.g. one per disk:
+//
+//   var store = loge.NewShardedStore(
+//       loge.NewLevelDBStore("/disk1/loge"),
+//       loge.NewLevelDBStore("/disk2/loge"))
+//
+// An object's links and their Find index entries live on its shard, so
+// every transaction opens a context on each shard, and Find and List
+// merge what all of them return. Commits go to every shard at once.
+// They aren't atomic across shards: if one fails the others may already
+// have their part.
+//
+// Which shard a key goes to depends on the number of shards, so open a
+// dataset with the same shards, in the same order, every time.
+type ShardedStore struct {
+	shards []LogeStore
+}
+
+type shardedContext struct {
+	shards []transactionContext
+	snapshotID uint64
+}
+
+func NewShardedStore(shards ...LogeStore) *ShardedStore {
+	if len(shards) == 0 {
+		panic("ShardedStore needs at least one shard")
+	}
+	return &ShardedStore{ shards }
+}
+
+func (store *ShardedStore) Shards() []LogeStore {
+	return store.shards
+}
+
+func shardIndex(key LogeKey, shards int) int {
+	var hasher = fnv.New32a()
+	hasher.Write([]byte(key))
+	return int(hasher.Sum32() % uint32(shards))
+}
+
+func (store *ShardedStore) close() {
+	for _, shard := range store.shards {
+		shard.close()
+	}
+}
+
+func (store *ShardedStore) compact() {
+	for _, shard := range store.shards {
+		shard.compact()
+	}
+}
+
+// Each shard's backup goes in path, named by its position
+func (store *ShardedStore) backup(path string) error {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return err
+	}
+	for i, shard := range store.shards {
+		if err := shard.backup(filepath.Join(path, strconv.Itoa(i))); err != nil {
+			return fmt.Errorf("Shard %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (store *ShardedStore) describe() string {
+	var shards = make([]string, 0, len(store.shards))
+	for _, shard := range store.shards {
+		shards = append(shards, shard.describe())
+	}
+	return fmt.Sprintf("Sharded over %s", strings.Join(shards, ", "))
+}
+
+func (store *ShardedStore) rebuildIndexes(db *LogeDB) int {
+	var count = 0
+	for _, shard := range store.shards {
+		count += shard.rebuildIndexes(db)
+	}
+	return count
+}
+
+func (store *ShardedStore) truncate(typ *logeType) int {
+	var count = 0
+	for _, shard := range store.shards {
+		count += shard.truncate(typ)
+	}
+	return count
+}
+
+func (store *ShardedStore) retainsVersions() bool {
+	for _, shard := range store.shards {
+		if !shard.retainsVersions() {
+			return false
+		}
+	}
+	return true
+}
+
+// Every shard writes the type info it hasn't got, not just the first
+func (store *ShardedStore) registerType(typ *logeType) {
+	var dirty = typ.SpackType.Dirty
+	for _, shard := range store.shards {
+		typ.SpackType.Dirty = dirty
+		shard.registerType(typ)
+	}
+}
+
+// The first shard's types are the ones in use; the rest are handed
+// them by registerType
+func (store *ShardedStore) getSpackType(name string) *spack.VersionedType {
+	return store.shards[0].getSpackType(name)
+}
+
+
+// -----------------------------------------------
+// Transaction Contexts
+// -----------------------------------------------
+
+// Opened together, so all of them see the same snapshot
+func (store *ShardedStore) newContext(ctx context.Context, sID uint64) transactionContext {
+	var shards = make([]transactionContext, len(store.shards))
+	for i, shard := range store.shards {
+		shards[i] = shard.newContext(ctx, sID)
+	}
+	return &shardedContext{
+		shards: shards,
+		snapshotID: sID,
+	}
+}
+
+func (context *shardedContext) getSnapshotID() uint64 {
+	return context.snapshotID
+}
+
+// A link set is keyed by its source object, so it follows it
+func (context *shardedContext) shardFor(key LogeKey) transactionContext {
+	return context.shards[shardIndex(key, len(context.shards))]
+}
+
+func (context *shardedContext) get(ref objRef) []byte {
+	return context.shardFor(ref.Key).get(ref)
+}
+
+func (context *shardedContext) contains(ref objRef) bool {
+	return context.shardFor(ref.Key).contains(ref)
+}
+
+func (context *shardedContext) store(ref objRef, enc []byte) error {
+	return context.shardFor(ref.Key).store(ref, enc)
+}
+
+// Index entries go with the link set they come from, on the source's
+// shard, so they commit together
+func (context *shardedContext) addIndex(ref objRef, source LogeKey) {
+	context.shardFor(source).addIndex(ref, source)
+}
+
+func (context *shardedContext) remIndex(ref objRef, source LogeKey) {
+	context.shardFor(source).remIndex(ref, source)
+}
+
+func (context *shardedContext) find(ref objRef) ResultSet {
+	return context.findSlice(ref, "", "", -1)
+}
+
+func (context *shardedContext) findSlice(ref objRef, keyPrefix LogeKey, from LogeKey, limit int) ResultSet {
+	var sets = make([]ResultSet, len(context.shards))
+	for i, shard := range context.shards {
+		sets[i] = shard.findSlice(ref, keyPrefix, from, limit)
+	}
+	return newMergedResultSet(sets, limit)
+}
+
+func (context *shardedContext) listSlice(typePrefix []byte, keyPrefix LogeKey, from LogeKey, limit int) ResultSet {
+	var sets = make([]ResultSet, len(context.shards))
+	for i, shard := range context.shards {
+		sets[i] = shard.listSlice(typePrefix, keyPrefix, from, limit)
+	}
+	return newMergedResultSet(sets, limit)
+}
+
+func (context *shardedContext) commit(sID uint64) error {
+	var errs = make([]error, len(context.shards))
+	var wg sync.WaitGroup
+	for i, shard := range context.shards {
+		wg.Add(1)
+		go func(i int, shard transactionContext) {
+			defer wg.Done()
+			errs[i] = shard.commit(sID)
+		}(i, shard)
+	}
+	wg.Wait()
+
+	var failed = make([]string, 0)
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("shard %d: %v", i, err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("Commit failed on %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func (context *shardedContext) rollback() {
+	for _, shard := range context.shards {
+		shard.rollback()
+	}
+}
+
+
+// -----------------------------------------------
+// Merged result sets
+// -----------------------------------------------
+
+// Sorted keys from several sorted result sets, which share none
+type mergedResultSet struct {
+	sets []ResultSet
+	heads []LogeKey
+	limit int
+	count int
+	closed bool
+}
+
+func newMergedResultSet(sets []ResultSet, limit int) *mergedResultSet {
+	var rs = &mergedResultSet{
+		sets: sets,
+		heads: make([]LogeKey, len(sets)),
+		limit: limit,
+	}
+	for i := range sets {
+		rs.advance(i)
+	}
+	return rs
+}
+
+// Takes the next key from set i into its head, or drops the set
+func (rs *mergedResultSet) advance(i int) {
+	if rs.sets[i] != nil && rs.sets[i].Valid() {
+		rs.heads[i] = rs.sets[i].Next()
+	} else if rs.sets[i] != nil {
+		rs.sets[i].Close()
+		rs.sets[i] = nil
+	}
+}
+
+func (rs *mergedResultSet) lowest() int {
+	var lowest = -1
+	for i, set := range rs.sets {
+		if set != nil && (lowest < 0 || rs.heads[i] < rs.heads[lowest]) {
+			lowest = i
+		}
+	}
+	return lowest
+}
+
+func (rs *mergedResultSet) Valid() bool {
+	if rs.closed {
+		return false
+	}
+	if (rs.limit >= 0 && rs.count >= rs.limit) || rs.lowest() < 0 {
+		rs.Close()
+		return false
+	}
+	return true
+}
+
+func (rs *mergedResultSet) Next() LogeKey {
+	if !rs.Valid() {
+		return ""
+	}
+	var i = rs.lowest()
+	var next = rs.heads[i]
+	rs.advance(i)
+	rs.count++
+	return next
+}
+
+func (rs *mergedResultSet) All() []LogeKey {
+	var keys = make([]LogeKey, 0)
+	for rs.Valid() {
+		keys = append(keys, rs.Next())
+	}
+	return keys
+}
+
+func (rs *mergedResultSet) Close() {
+	rs.closed = true
+	for i, set := range rs.sets {
+		if set != nil {
+			set.Close()
+			rs.sets[i] = nil
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package loge
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestShardedStore(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "loge-sharded")
+	defer os.RemoveAll(dir)
+
+	var shards = make([]LogeStore, 3)
+	for i := range shards {
+		shards[i] = NewBoltStore(filepath.Join(dir, fmt.Sprintf("%d.db", i)))
+	}
+	var db = NewLogeDB(NewShardedStore(shards...))
+	defer db.Close()
+	var def = NewTypeDef("test", 1, &TestObj{})
+	def.Links = LinkSpec{ "other": "test" }
+	db.CreateType(def)
+
+	var keys = make([]LogeKey, 0)
+	db.Transact(func (t *Transaction) {
+		for i := 0; i < 20; i++ {
+			var key = LogeKey(fmt.Sprintf("key%02d", i))
+			keys = append(keys, key)
+			t.Set("test", key, &TestObj{ string(key) })
+			t.AddLink("test", "other", key, "target")
+		}
+	}, 0)
+
+	// Each object and its links on one shard
+	var typ = db.lookupType("test")
+	var counts = make([]int, len(shards))
+	for _, key := range keys {
+		for i, shard := range shards {
+			var shardContext = shard.newContext(context.Background(), db.lastSnapshotID)
+			var hasObj = shardContext.get(makeObjRef(typ, key)) != nil
+			var hasLinks = shardContext.get(makeLinkRef(typ, "other", key)) != nil
+			shardContext.rollback()
+			if hasObj != hasLinks || hasObj != (i == shardIndex(key, len(shards))) {
+				test.Errorf("%s in the wrong place on shard %d", key, i)
+			}
+			if hasObj {
+				counts[i]++
+			}
+		}
+	}
+	for i, count := range counts {
+		if count == 0 {
+			test.Errorf("Nothing on shard %d", i)
+		}
+	}
+
+	if all := db.ListSlice("test", "", -1); !reflect.DeepEqual(all, keys) {
+		test.Errorf("Wrong merged list: %v", all)
+	}
+	if page := db.ListSlice("test", "key04", 3); !reflect.DeepEqual(page, keys[5:8]) {
+		test.Errorf("Wrong merged page: %v", page)
+	}
+
+	var found = db.Find("test", "other", "target")
+	if !sort.SliceIsSorted(found, func(i, j int) bool { return found[i] < found[j] }) || !reflect.DeepEqual(found, keys) {
+		test.Errorf("Wrong merged find: %v", found)
+	}
+
+	if count := db.Truncate("test"); count != len(keys) {
+		test.Errorf("Wrong truncate count: %d", count)
+	}
+}
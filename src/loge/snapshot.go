@@ -0,0 +1,179 @@
+package loge
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A point in time several goroutines can read together, e.g. for a
+// report which has to be consistent across them:
+//
+//   var snap = db.Snapshot()
+//   defer snap.Release()
+//
+//   go snap.View(func (t *loge.Transaction) { ... })
+//   go snap.View(func (t *loge.Transaction) { ... })
+//
+// Views are transactions sharing the snapshot's store context. Writing in
+// one panics with ErrReadOnly.
+//
+// Until it's released, the snapshot is pinned: its store context stays
+// open, and FlushCache keeps the cached versions it can see, so it stays
+// consistent however long it's held. PinnedSnapshots lists them, to
+// find readers holding old versions for too long.
+type Snapshot struct {
+	db *LogeDB
+	snapshotID uint64
+	context transactionContext
+	lock sync.RWMutex
+	released bool
+	label string
+	pinned time.Time
+}
+
+type PinnedSnapshot struct {
+	ID uint64
+	Label string
+	Pinned time.Time
+}
+
+type snapshotPins struct {
+	lock spinLock
+	snaps map[*Snapshot]bool
+}
+
+func (db *LogeDB) Snapshot() *Snapshot {
+	return db.PinSnapshot("")
+}
+
+// A snapshot labelled for PinnedSnapshots, e.g. with what's reading it
+func (db *LogeDB) PinSnapshot(label string) *Snapshot {
+	var sID, context = db.currentContext(context.Background())
+	var snap = &Snapshot{
+		db: db,
+		snapshotID: sID,
+		context: context,
+		label: label,
+		pinned: db.clock.Now(),
+	}
+	db.pins.add(snap)
+	return snap
+}
+
+// Oldest first
+func (db *LogeDB) PinnedSnapshots() []PinnedSnapshot {
+	var pins = &db.pins
+	pins.lock.SpinLock()
+	defer pins.lock.Unlock()
+
+	var list = make([]PinnedSnapshot, 0, len(pins.snaps))
+	for snap := range pins.snaps {
+		list = append(list, PinnedSnapshot{ snap.snapshotID, snap.label, snap.pinned })
+	}
+	sort.Slice(list, func (i, j int) bool {
+		if list[i].ID != list[j].ID {
+			return list[i].ID < list[j].ID
+		}
+		return list[i].Pinned.Before(list[j].Pinned)
+	})
+	return list
+}
+
+func (pins *snapshotPins) add(snap *Snapshot) {
+	pins.lock.SpinLock()
+	defer pins.lock.Unlock()
+	if pins.snaps == nil {
+		pins.snaps = make(map[*Snapshot]bool)
+	}
+	pins.snaps[snap] = true
+}
+
+func (pins *snapshotPins) remove(snap *Snapshot) {
+	pins.lock.SpinLock()
+	defer pins.lock.Unlock()
+	delete(pins.snaps, snap)
+}
+
+// Snapshot IDs still pinned, oldest first
+func (pins *snapshotPins) ids() []uint64 {
+	pins.lock.SpinLock()
+	defer pins.lock.Unlock()
+	var ids = make([]uint64, 0, len(pins.snaps))
+	for snap := range pins.snaps {
+		ids = append(ids, snap.snapshotID)
+	}
+	sort.Slice(ids, func (i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func (snap *Snapshot) ID() uint64 {
+	return snap.snapshotID
+}
+
+func (snap *Snapshot) View(actor Transactor) {
+	snap.lock.RLock()
+	defer snap.lock.RUnlock()
+	if snap.released {
+		panic(fmt.Errorf("%w: released snapshot %d", ErrInactive, snap.snapshotID))
+	}
+
+	var t = &Transaction{
+		db: snap.db,
+		ctx: context.Background(),
+		context: snap.context,
+		versions: make(map[string]*liveVersion),
+		state: ACTIVE,
+		snapshotID: snap.snapshotID,
+		view: true,
+	}
+	defer func() {
+		if t.state == ACTIVE {
+			t.abandon()
+		}
+	}()
+
+	actor(t)
+	if t.state == ACTIVE {
+		t.state = FINISHED
+		snap.db.releaseVersions(t.liveVersions())
+	}
+}
+
+// Waits for running views
+func (snap *Snapshot) Release() {
+	snap.lock.Lock()
+	defer snap.lock.Unlock()
+	if !snap.released {
+		snap.released = true
+		snap.context.rollback()
+		snap.db.pins.remove(snap)
+	}
+}
+
+// Reads an object as it stood at a past snapshot ID, such as the
+// SnapshotID of a Change or an object's Meta. Only stores which retain
+// versions can look back; others raise ErrNotSupported.
+func (db *LogeDB) ReadAt(typeName string, key LogeKey, sID uint64) (obj interface{}) {
+	if !db.store.retainsVersions() {
+		panic(fmt.Errorf("%w: ReadAt", ErrNotSupported))
+	}
+	if sID == 0 || sID > atomic.LoadUint64(&db.lastSnapshotID) {
+		panic(fmt.Errorf("%w: %d", ErrNoSuchSnapshot, sID))
+	}
+
+	var snap = &Snapshot{
+		db: db,
+		snapshotID: sID,
+		context: db.store.newContext(context.Background(), sID),
+	}
+	defer snap.Release()
+
+	snap.View(func (t *Transaction) {
+		obj = t.Read(typeName, key)
+	})
+	return
+}
@@ -0,0 +1,213 @@
+package loge
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSnapshotHandle(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "loge-snapshot")
+	defer os.RemoveAll(dir)
+
+	var db = NewLogeDB(NewLevelDBStore(dir))
+	defer db.Close()
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+	db.SetOne("test", "one", &TestObj{ "One" })
+
+	var snap = db.Snapshot()
+	db.SetOne("test", "one", &TestObj{ "Uno" })
+	db.SetOne("test", "two", &TestObj{ "Two" })
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			snap.View(func (t *Transaction) {
+				if t.Read("test", "one").(*TestObj).Name != "One" {
+					test.Error("View saw a later commit")
+				}
+				if t.Exists("test", "two") {
+					test.Error("View saw a later object")
+				}
+			})
+		}()
+	}
+	wg.Wait()
+
+	func() {
+		defer func() {
+			if err, _ := recover().(error); !errors.Is(err, ErrReadOnly) {
+				test.Errorf("Write in view gave %v", err)
+			}
+		}()
+		snap.View(func (t *Transaction) {
+			t.Write("test", "one")
+		})
+	}()
+
+	snap.Release()
+	if db.ReadOne("test", "one").(*TestObj).Name != "Uno" {
+		test.Error("Wrong current object")
+	}
+	if db.Stats().CachedObjects != 0 {
+		test.Error("Views left objects cached")
+	}
+
+	defer func() {
+		if err, _ := recover().(error); !errors.Is(err, ErrInactive) {
+			test.Errorf("View after release gave %v", err)
+		}
+	}()
+	snap.View(func (t *Transaction) {})
+}
+
+func TestReadAt(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+
+	db.SetOne("test", "one", &TestObj{ "One" })
+	var first = db.lastSnapshotID
+	db.SetOne("test", "one", &TestObj{ "Uno" })
+	var second = db.lastSnapshotID
+	db.DeleteOne("test", "one")
+
+	if db.ReadAt("test", "one", first).(*TestObj).Name != "One" {
+		test.Error("Wrong object at first snapshot")
+	}
+	if db.ReadAt("test", "one", second).(*TestObj).Name != "Uno" {
+		test.Error("Wrong object at second snapshot")
+	}
+	if db.ReadAt("test", "one", db.lastSnapshotID).(*TestObj) != nil {
+		test.Error("Deleted object still readable")
+	}
+	if db.ReadOne("test", "one").(*TestObj) != nil {
+		test.Error("Historic read leaked into the present")
+	}
+
+	var _, err = db.TryReadAt("test", "one", db.lastSnapshotID + 1)
+	if !errors.Is(err, ErrNoSuchSnapshot) {
+		test.Errorf("Wrong error for future snapshot: %v", err)
+	}
+}
+
+// A transaction opened while a commit is in the store sees all of it,
+// in the cache and in the store, or none
+func TestTransactionDuringCommit(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "loge-snapshot")
+	defer os.RemoveAll(dir)
+
+	var store = NewFaultStore(NewLevelDBStore(dir))
+	var db = NewLogeDB(store)
+	defer db.Close()
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+	db.SetOne("test", "one", &TestObj{ "One" })
+
+	store.Script(FaultCommit, Fault{ Delay: 50 * time.Millisecond })
+	var committed = make(chan bool)
+	go func() {
+		db.SetOne("test", "two", &TestObj{ "Two" })
+		committed <- true
+	}()
+	for store.Pending(FaultCommit) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	var t = db.CreateTransaction()
+	var listed = len(t.ListSlice("test", "", -1).All()) == 2
+	if _, read := t.ReadOK("test", "two"); read != listed {
+		test.Errorf("Cache and store disagree: listed %v", listed)
+	}
+	<-committed
+}
+
+func TestSlowCommitDoesNotBlockTransactions(test *testing.T) {
+	var store = NewFaultStore(NewMemStore())
+	var db = NewLogeDB(store)
+	defer db.Close()
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+	db.SetOne("test", "one", &TestObj{ "One" })
+
+	store.Script(FaultCommit, Fault{ Delay: 200 * time.Millisecond })
+	var committed = make(chan bool, 1)
+	go func() {
+		db.SetOne("test", "two", &TestObj{ "Two" })
+		committed <- true
+	}()
+	for store.Pending(FaultCommit) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	var t = db.CreateTransaction()
+	select {
+	case <-committed:
+		test.Fatal("Transaction waited for the commit")
+	default:
+	}
+	if t.Exists("test", "two") {
+		test.Error("Transaction sees a commit the store doesn't have")
+	}
+	if !t.Exists("test", "one") {
+		test.Error("Transaction doesn't see earlier commit")
+	}
+
+	// Written after the slow commit, so both are visible once it's done
+	db.SetOne("test", "three", &TestObj{ "Three" })
+	var after = db.CreateTransaction()
+	if !after.Exists("test", "two") || !after.Exists("test", "three") {
+		test.Error("Commits not visible once written")
+	}
+	<-committed
+}
+
+func TestPinnedSnapshots(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	var clock = &manualClock{ now: time.Unix(1000, 0) }
+	db.SetClock(clock)
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+
+	var holder = db.CreateTransaction()
+	holder.Read("test", "one")
+
+	db.SetOne("test", "one", &TestObj{ "One" })
+	var report = db.PinSnapshot("report")
+	db.SetOne("test", "one", &TestObj{ "Uno" })
+	clock.Sleep(time.Minute)
+	var other = db.Snapshot()
+	db.SetOne("test", "one", &TestObj{ "Eins" })
+
+	var pins = db.PinnedSnapshots()
+	var expected = []PinnedSnapshot{
+		{ report.ID(), "report", time.Unix(1000, 0) },
+		{ other.ID(), "", time.Unix(1060, 0) },
+	}
+	if !reflect.DeepEqual(pins, expected) {
+		test.Errorf("Wrong pins: %v", pins)
+	}
+
+	// Only the holder's is dropped: the pins see the other two
+	var stats = db.Stats()
+	if dropped := db.FlushCache(); dropped != stats.CachedVersions - 3 {
+		test.Errorf("Wrong drop count with pins: %d of %d", dropped, stats.CachedVersions)
+	}
+	report.View(func (t *Transaction) {
+		if t.Read("test", "one").(*TestObj).Name != "One" {
+			test.Error("Pinned snapshot changed by flush")
+		}
+	})
+
+	report.Release()
+	other.Release()
+	if pins = db.PinnedSnapshots(); len(pins) != 0 {
+		test.Errorf("Released snapshots still pinned: %v", pins)
+	}
+	if dropped := db.FlushCache(); dropped != 2 {
+		test.Errorf("Wrong drop count after release: %d", dropped)
+	}
+	holder.Cancel()
+}
@@ -0,0 +1,27 @@
+package loge
+
+import (
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var sqliteDialect = &sqlDialect{
+	Name: "SQLite",
+	KeyType: "TEXT",
+	BlobType: "BLOB",
+}
+
+// A store in a SQLite file, in tables which can be queried alongside,
+// e.g. with the sqlite3 shell. See sqlStore for the layout. The file is
+// opened in WAL mode, so those readers don't block commits.
+func NewSQLiteStore(path string) LogeStore {
+	store, err := OpenSQLiteStore(path)
+	if err != nil {
+		panic(err)
+	}
+	return store
+}
+
+func OpenSQLiteStore(path string) (store LogeStore, err error) {
+	defer recoverError(&err)
+	return openSQLStore(sqliteDialect, "sqlite3", path + "?_journal_mode=WAL&_busy_timeout=5000", path)
+}
@@ -0,0 +1,58 @@
+package loge
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSQLiteTables(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "loge-sqlite")
+	defer os.RemoveAll(dir)
+
+	var store = NewSQLiteStore(filepath.Join(dir, "loge.sqlite")).(*sqlStore)
+	var db = NewLogeDB(store)
+	defer db.Close()
+	var def = NewTypeDef("test", 1, &TestObj{})
+	def.Links = LinkSpec{ "other": "test" }
+	db.CreateType(def)
+
+	db.Transact(func (t *Transaction) {
+		for i := 0; i < store_PAGE_SIZE + 10; i++ {
+			t.Set("test", Key("many", fmt.Sprintf("%04d", i)), &TestObj{ "Many" })
+		}
+		t.Set("test", "one", &TestObj{ "One" })
+		t.AddLink("test", "other", "one", Key("many", "0001"))
+		t.AddLink("test", "other", "one", Key("many", "0002"))
+	}, 0)
+	db.Transact(func (t *Transaction) {
+		t.RemoveLink("test", "other", "one", Key("many", "0001"))
+	}, 0)
+
+	var name string
+	var err = store.db.QueryRow(`SELECT json_extract(json, '$.Name') FROM "loge_test" WHERE key = 'one'`).Scan(&name)
+	if err != nil || name != "One" {
+		test.Errorf("Object not readable in SQL: %q %v", name, err)
+	}
+	var links int
+	store.db.QueryRow(`SELECT COUNT(*) FROM loge_links WHERE type = 'test' AND source = 'one'`).Scan(&links)
+	if links != 1 {
+		test.Errorf("Wrong link rows: %d", links)
+	}
+
+	db.Transact(func (t *Transaction) {
+		var keys = t.ListPrefix("test", KeyPrefix("many"), "", -1).All()
+		if len(keys) != store_PAGE_SIZE + 10 || keys[len(keys)-1] != Key("many", fmt.Sprintf("%04d", store_PAGE_SIZE + 9)) {
+			test.Errorf("Wrong keys across pages: %d", len(keys))
+		}
+		var from = t.ListPrefix("test", KeyPrefix("many"), Key("many", "0002"), 2).All()
+		if len(from) != 2 || from[0] != Key("many", "0003") {
+			test.Errorf("Wrong slice: %v", from)
+		}
+		if found := t.Find("test", "other", Key("many", "0002")).All(); len(found) != 1 || found[0] != "one" {
+			test.Errorf("Wrong find: %v", found)
+		}
+	}, 0)
+}
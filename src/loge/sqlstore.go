@@ -0,0 +1,510 @@
+package loge
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/brendonh/spack"
+)
+
+// Stores over database/sql, laid out to be read with plain SQL:
+//
+//   loge_<type>   key, value (encoded object), json (the same, readable)
+//   loge_links    type, link, source, target: one row per link
+//   loge_meta     name, value: format stamp and spack type info
+//
+// The links table is both the link sets and their index. Dialects
+// cover the differences between databases.
+type sqlDialect struct {
+	Name string
+	KeyType string
+	BlobType string
+	Placeholder func(n int) string
+	ReadOptions *sql.TxOptions
+
+	// Keys go in as bytes rather than text
+	BinaryKeys bool
+
+	// Commits go through the transaction the reads were made in, so
+	// the database can refuse writes to rows changed since its snapshot
+	WriteInSnapshot bool
+}
+
+const sql_FORMAT_VERSION uint32 = 1
+
+var linkSetSpec = spack.MakeTypeSpec([]string{})
+
+
+type sqlStore struct {
+	dialect *sqlDialect
+	name string
+	db *sql.DB
+	types *spack.TypeSet
+	typeNames map[uint16]string
+
+	// One writer at a time, rather than relying on the database's retries,
+	// unless it's writing in snapshots
+	writeLock sync.Mutex
+}
+
+// Holds a read transaction as its snapshot. Queries on it take the lock,
+// so concurrent reads don't interleave on its connection.
+type sqlContext struct {
+	sstore *sqlStore
+	ctx context.Context
+	lock sync.Mutex
+	tx *sql.Tx
+	snapshotID uint64
+	batch []sqlWriteEntry
+}
+
+type sqlWriteEntry struct {
+	Query string
+	Args []interface{}
+}
+
+// name is for messages, so should leave out any password in dsn
+func openSQLStore(dialect *sqlDialect, driver string, dsn string, name string) (*sqlStore, error) {
+	db, err := sql.Open(driver, dsn)
+	if err == nil {
+		err = db.Ping()
+	}
+	if err != nil {
+		return nil, storeError("Can't open %s DB at %s: %v", dialect.Name, name, err)
+	}
+
+	var store = &sqlStore{
+		dialect: dialect,
+		name: name,
+		db: db,
+		types: spack.NewTypeSet(),
+		typeNames: make(map[uint16]string),
+	}
+
+	if err := store.checkFormat(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	store.loadTypeMetadata()
+	return store, nil
+}
+
+func (store *sqlStore) close() {
+	store.db.Close()
+}
+
+// Left to the database's own vacuuming
+func (store *sqlStore) compact() {
+}
+
+func (store *sqlStore) backup(path string) error {
+	return fmt.Errorf("%w: Backup on %s store, use the database's tools", ErrNotSupported, store.dialect.Name)
+}
+
+func (store *sqlStore) describe() string {
+	return fmt.Sprintf("%s: %s", store.dialect.Name, store.name)
+}
+
+// Commits overwrite, so only live snapshots can see the past
+func (store *sqlStore) retainsVersions() bool {
+	return false
+}
+
+// Link rows are their own index
+func (store *sqlStore) rebuildIndexes(db *LogeDB) int {
+	return 0
+}
+
+func (store *sqlStore) truncate(typ *logeType) int {
+	store.writeLock.Lock()
+	defer store.writeLock.Unlock()
+
+	res, err := store.db.Exec(fmt.Sprintf("DELETE FROM %s", store.table(typ.Name)))
+	if err == nil {
+		_, err = store.db.Exec(store.query("DELETE FROM loge_links WHERE type = ?"), typ.Name)
+	}
+	if err != nil {
+		panic(storeError("Write error: %v", err))
+	}
+
+	count, _ := res.RowsAffected()
+	return int(count)
+}
+
+func (store *sqlStore) registerType(typ *logeType) {
+	store.typeNames[typ.SpackType.Tag] = typ.Name
+
+	var create = fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s (key %s PRIMARY KEY, value %s NOT NULL, json TEXT)",
+		store.table(typ.Name), store.dialect.KeyType, store.dialect.BlobType)
+	if _, err := store.db.Exec(create); err != nil {
+		panic(storeError("Couldn't create table for %s: %v", typ.Name, err))
+	}
+
+	registerTypeInfo(store.types, typ, func(name string, info []byte) error {
+		return store.setMeta("type:" + name, info)
+	})
+}
+
+func (store *sqlStore) getSpackType(name string) *spack.VersionedType {
+	return store.types.RegisterType(name)
+}
+
+
+// -----------------------------------------------
+// Transaction Contexts
+// -----------------------------------------------
+
+func (store *sqlStore) newContext(ctx context.Context, sID uint64) transactionContext {
+	tx, err := store.db.BeginTx(ctx, store.dialect.ReadOptions)
+	if err == nil {
+		// Transactions only take their snapshot at the first read
+		_, err = tx.Exec("SELECT 1 FROM loge_meta")
+	}
+	if err != nil {
+		panic(storeError("Can't start read: %v", err))
+	}
+
+	return &sqlContext{
+		sstore: store,
+		ctx: ctx,
+		tx: tx,
+		snapshotID: sID,
+		batch: make([]sqlWriteEntry, 0),
+	}
+}
+
+func (context *sqlContext) getSnapshotID() uint64 {
+	return context.snapshotID
+}
+
+func (context *sqlContext) commit(sID uint64) error {
+	var store = context.sstore
+	if store.dialect.WriteInSnapshot {
+		context.lock.Lock()
+		var tx = context.tx
+		context.tx = nil
+		context.lock.Unlock()
+		return context.apply(tx)
+	}
+
+	context.cleanup()
+	if len(context.batch) == 0 {
+		return nil
+	}
+
+	store.writeLock.Lock()
+	defer store.writeLock.Unlock()
+
+	tx, err := store.db.Begin()
+	if err != nil {
+		return err
+	}
+	return context.apply(tx)
+}
+
+func (context *sqlContext) apply(tx *sql.Tx) error {
+	if len(context.batch) == 0 {
+		return tx.Rollback()
+	}
+	for _, entry := range context.batch {
+		if _, err := tx.Exec(entry.Query, entry.Args...); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (context *sqlContext) rollback() {
+	context.cleanup()
+}
+
+func (context *sqlContext) cleanup() {
+	context.lock.Lock()
+	defer context.lock.Unlock()
+	if context.tx != nil {
+		context.tx.Rollback()
+		context.tx = nil
+	}
+}
+
+
+// -----------------------------------------------
+// transactionContext API
+// -----------------------------------------------
+
+func (context *sqlContext) get(ref objRef) []byte {
+	var store = context.sstore
+
+	if ref.IsLink() {
+		var targets = context.keys(
+			"SELECT target FROM loge_links WHERE type = ? AND link = ? AND source = ? ORDER BY target",
+			ref.Type.Name, ref.LinkName, store.key(ref.Key))
+		if len(targets) == 0 {
+			return nil
+		}
+		enc, _ := spack.EncodeToBytes(linkList(targets).strings(), linkSetSpec)
+		return enc
+	}
+
+	var val []byte
+	var err = context.queryRow(
+		fmt.Sprintf("SELECT value FROM %s WHERE key = ?", store.table(ref.Type.Name)),
+		store.key(ref.Key)).Scan(&val)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		panic(storeError("Read error: %v", err))
+	}
+	return val
+}
+
+func (context *sqlContext) contains(ref objRef) bool {
+	return context.get(ref) != nil
+}
+
+// Link sets are written a row at a time, by addIndex and remIndex
+func (context *sqlContext) store(ref objRef, enc []byte) error {
+	if ref.IsLink() {
+		return nil
+	}
+
+	var store = context.sstore
+	var table = store.table(ref.Type.Name)
+
+	if len(enc) == 0 {
+		context.write(fmt.Sprintf("DELETE FROM %s WHERE key = ?", table), store.key(ref.Key))
+		return nil
+	}
+
+	var obj, _ = ref.Type.Decode(enc, true)
+	readable, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+
+	context.write(
+		fmt.Sprintf("INSERT INTO %s (key, value, json) VALUES (?, ?, ?) " +
+			"ON CONFLICT (key) DO UPDATE SET value = excluded.value, json = excluded.json", table),
+		store.key(ref.Key), enc, string(readable))
+	return nil
+}
+
+func (context *sqlContext) addIndex(ref objRef, source LogeKey) {
+	context.write(
+		"INSERT INTO loge_links (type, link, source, target) VALUES (?, ?, ?, ?) ON CONFLICT DO NOTHING",
+		ref.Type.Name, ref.LinkName, context.sstore.key(source), context.sstore.key(ref.Key))
+}
+
+func (context *sqlContext) remIndex(ref objRef, source LogeKey) {
+	context.write(
+		"DELETE FROM loge_links WHERE type = ? AND link = ? AND source = ? AND target = ?",
+		ref.Type.Name, ref.LinkName, context.sstore.key(source), context.sstore.key(ref.Key))
+}
+
+func (context *sqlContext) find(ref objRef) ResultSet {
+	return context.findSlice(ref, "", "", -1)
+}
+
+func (context *sqlContext) findSlice(ref objRef, keyPrefix LogeKey, from LogeKey, limit int) ResultSet {
+	return context.slice(
+		"SELECT source FROM loge_links WHERE type = ? AND link = ? AND target = ? AND ",
+		[]interface{}{ ref.Type.Name, ref.LinkName, context.sstore.key(ref.Key) },
+		"source", keyPrefix, from, limit)
+}
+
+func (context *sqlContext) listSlice(typePrefix []byte, keyPrefix LogeKey, from LogeKey, limit int) ResultSet {
+	var tag = uint16(binary.BigEndian.Uint32(typePrefix) >> 16)
+	var name, ok = context.sstore.typeNames[tag]
+	if !ok {
+		panic(storeError("No type with tag %d", tag))
+	}
+	var table = context.sstore.table(name)
+	return context.slice(fmt.Sprintf("SELECT key FROM %s WHERE ", table), nil, "key", keyPrefix, from, limit)
+}
+
+// Keys in column which start with keyPrefix, after from, a page per
+// query. Prefixes become ranges, which keep to the column's index.
+func (context *sqlContext) slice(query string, args []interface{}, column string, keyPrefix LogeKey, from LogeKey, limit int) ResultSet {
+	checkContext(context.ctx)
+	if limit == 0 {
+		return &pagedResultSet{ closed: true }
+	}
+
+	query += fmt.Sprintf("%s >= ? AND %s > ?", column, column)
+	var end, bounded = prefixEnd(keyPrefix)
+	if bounded {
+		query += fmt.Sprintf(" AND %s < ?", column)
+	}
+	query += fmt.Sprintf(" ORDER BY %s LIMIT %d", column, store_PAGE_SIZE)
+
+	var fetch = func(after LogeKey) []LogeKey {
+		var store = context.sstore
+		var pageArgs = append(append([]interface{}{}, args...), store.key(keyPrefix), store.key(after))
+		if bounded {
+			pageArgs = append(pageArgs, store.key(end))
+		}
+		return context.keys(query, pageArgs...)
+	}
+
+	return &pagedResultSet{
+		ctx: context.ctx,
+		fetch: fetch,
+		last: from,
+		limit: limit,
+	}
+}
+
+// -----------------------------------------------
+// Helpers
+// -----------------------------------------------
+
+func (context *sqlContext) write(query string, args ...interface{}) {
+	context.batch = append(context.batch, sqlWriteEntry{ context.sstore.query(query), args })
+}
+
+func (context *sqlContext) queryRow(query string, args ...interface{}) *sql.Row {
+	checkContext(context.ctx)
+	context.lock.Lock()
+	defer context.lock.Unlock()
+	if context.tx == nil {
+		panic(storeError("Read after transaction ended"))
+	}
+	return context.tx.QueryRowContext(context.ctx, context.sstore.query(query), args...)
+}
+
+func (context *sqlContext) keys(query string, args ...interface{}) []LogeKey {
+	checkContext(context.ctx)
+	context.lock.Lock()
+	defer context.lock.Unlock()
+	if context.tx == nil {
+		panic(storeError("Read after transaction ended"))
+	}
+
+	rows, err := context.tx.QueryContext(context.ctx, context.sstore.query(query), args...)
+	if err != nil {
+		panic(storeError("Read error: %v", err))
+	}
+	defer rows.Close()
+
+	var keys = make([]LogeKey, 0)
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			panic(storeError("Read error: %v", err))
+		}
+		keys = append(keys, LogeKey(key))
+	}
+	if err := rows.Err(); err != nil {
+		panic(storeError("Read error: %v", err))
+	}
+	return keys
+}
+
+// The first key after everything starting with prefix, if there is one
+func prefixEnd(prefix LogeKey) (LogeKey, bool) {
+	var end = []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return LogeKey(end[:i+1]), true
+		}
+	}
+	return "", false
+}
+
+func (store *sqlStore) key(key LogeKey) interface{} {
+	if store.dialect.BinaryKeys {
+		return []byte(key)
+	}
+	return string(key)
+}
+
+// Rewrites ? placeholders for the dialect
+func (store *sqlStore) query(query string) string {
+	if store.dialect.Placeholder == nil {
+		return query
+	}
+	var parts = strings.Split(query, "?")
+	var buf strings.Builder
+	for i, part := range parts {
+		if i > 0 {
+			buf.WriteString(store.dialect.Placeholder(i))
+		}
+		buf.WriteString(part)
+	}
+	return buf.String()
+}
+
+func (store *sqlStore) table(typeName string) string {
+	return `"loge_` + strings.Replace(typeName, `"`, `""`, -1) + `"`
+}
+
+// -----------------------------------------------
+// Internals
+// -----------------------------------------------
+
+func (store *sqlStore) loadTypeMetadata() {
+	var typeType = store.types.Type("_type")
+	rows, err := store.db.Query("SELECT value FROM loge_meta WHERE name LIKE 'type:%'")
+	if err != nil {
+		panic(storeError("Error loading type info: %v", err))
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var val []byte
+		if err := rows.Scan(&val); err != nil {
+			panic(storeError("Error loading type info: %v", err))
+		}
+		var typeInfo, _, err = typeType.DecodeObj(val, false)
+		if err != nil {
+			panic(storeError("Error loading type info: %v", err))
+		}
+		store.types.LoadType(typeInfo.(*spack.VersionedType))
+	}
+}
+
+func (store *sqlStore) setMeta(name string, val []byte) error {
+	var _, err = store.db.Exec(store.query(
+		"INSERT INTO loge_meta (name, value) VALUES (?, ?) " +
+		"ON CONFLICT (name) DO UPDATE SET value = excluded.value"), name, val)
+	return err
+}
+
+// Creates the shared tables and checks the format stamp
+func (store *sqlStore) checkFormat() error {
+	var setup = []string{
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS loge_meta (name TEXT PRIMARY KEY, value %s)",
+			store.dialect.BlobType),
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS loge_links (type TEXT, link TEXT, source %s, target %s, " +
+			"PRIMARY KEY (type, link, source, target))", store.dialect.KeyType, store.dialect.KeyType),
+		"CREATE INDEX IF NOT EXISTS loge_links_target ON loge_links (type, link, target, source)",
+	}
+	for _, stmt := range setup {
+		if _, err := store.db.Exec(stmt); err != nil {
+			return storeError("Can't initialise %s: %v", store.name, err)
+		}
+	}
+
+	var val []byte
+	var err = store.db.QueryRow(store.query("SELECT value FROM loge_meta WHERE name = ?"), "format").Scan(&val)
+	if err == sql.ErrNoRows {
+		val = nil
+	} else if err != nil {
+		return storeError("Read error: %v", err)
+	}
+
+	return checkFormatStamp(store.name, val, sql_FORMAT_VERSION, true,
+		func (stamp []byte) error {
+			return store.setMeta("format", stamp)
+		})
+}
@@ -1,14 +1,26 @@
 package loge
 
 import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"sync"
+
 	"github.com/brendonh/spack"
 )
 
 type LogeStore interface {
 	close()
+	compact()
+	backup(path string) error
+	describe() string
+	rebuildIndexes(db *LogeDB) int
+	truncate(typ *logeType) int
+	retainsVersions() bool
 	registerType(*logeType)
 	getSpackType(name string) *spack.VersionedType
-	newContext(uint64) transactionContext
+	newContext(context.Context, uint64) transactionContext
 }
 
 type ResultSet interface {
@@ -22,20 +34,84 @@ type transactionContext interface {
 	getSnapshotID() uint64
 
 	get(objRef) []byte
+	contains(objRef) bool
 	store(objRef, []byte) error
 
 	addIndex(objRef, LogeKey)
 	remIndex(objRef, LogeKey)
 
 	find(objRef) ResultSet
-	findSlice(objRef, LogeKey, int) ResultSet
+	findSlice(ref objRef, keyPrefix LogeKey, from LogeKey, limit int) ResultSet
 
-	listSlice([]byte, LogeKey, int) ResultSet
+	listSlice(typePrefix []byte, keyPrefix LogeKey, from LogeKey, limit int) ResultSet
 
 	commit(uint64) error
 	rollback()
 }
 
+// The registerType of stores which keep each type's spack info under
+// its name: tags typ's links, then writes the info with put if it has
+// changed
+func registerTypeInfo(types *spack.TypeSet, typ *logeType, put func(name string, info []byte) error) {
+	tagLinks(typ)
+
+	var vt = typ.SpackType
+	if (!vt.Dirty) {
+		return
+	}
+
+	fmt.Printf("Updating type info: %s (%d)\n", typ.Name, typ.Version)
+
+	var typeVal, err = types.Type("_type").EncodeObj(vt)
+	if err != nil {
+		panic(fmt.Sprintf("Error encoding type %s: %v", vt.Name, err))
+	}
+
+	if err := put(vt.Name, typeVal); err != nil {
+		panic(storeError("Couldn't write type metadata: %v", err))
+	}
+
+	vt.Dirty = false
+}
+
+// Every backend stamps new stores with its layout's format version,
+// bumped along with an upgrade path whenever the layout changes, and
+// refuses stores stamped by a newer loge rather than misreading them.
+//
+// This is the check behind their checkFormat: stamp is as read from the
+// store, nil if it has none yet, in which case put stores a new one.
+// Stamps are 4 bytes big-endian, or decimal if the store keeps text.
+func checkFormatStamp(name string, stamp []byte, current uint32, text bool, put func(stamp []byte) error) error {
+	if stamp == nil {
+		if text {
+			return put([]byte(strconv.FormatUint(uint64(current), 10)))
+		}
+		stamp = make([]byte, 4)
+		binary.BigEndian.PutUint32(stamp, current)
+		return put(stamp)
+	}
+
+	var version uint32
+	if text {
+		var parsed, err = strconv.ParseUint(string(stamp), 10, 32)
+		if err != nil {
+			return fmt.Errorf("%w: unreadable format stamp %q", ErrIncompatibleFormat, stamp)
+		}
+		version = uint32(parsed)
+	} else {
+		if len(stamp) != 4 {
+			return fmt.Errorf("%w: unreadable format stamp %x", ErrIncompatibleFormat, stamp)
+		}
+		version = binary.BigEndian.Uint32(stamp)
+	}
+
+	if version > current {
+		return fmt.Errorf("%w: %s is format %d, this loge reads up to %d",
+			ErrIncompatibleFormat, name, version, current)
+	}
+	return nil
+}
+
 type memVersion struct {
 	snapshotID uint64
 	blob []byte
@@ -58,10 +134,20 @@ type memStore struct {
 	objects objectMap
 	lock spinLock
 	spackTypes *spack.TypeSet
+	typeInfo map[string][]byte
+
+	// Only when persisting, see NewPersistentMemStore
+	path string
+	changes uint64
+	saved uint64
+	saveLock sync.Mutex
+	stop chan bool
+	done chan bool
 }
 
 type memContext struct {
 	mstore *memStore
+	ctx context.Context
 	snapshotID uint64
 	writes []memWriteEntry
 }
@@ -75,14 +161,88 @@ func NewMemStore() LogeStore {
 	return &memStore{
 		objects: make(objectMap),
 		spackTypes: spack.NewTypeSet(),
+		typeInfo: make(map[string][]byte),
 	}
 }
 
 func (store *memStore) close() {
+	if store.path == "" {
+		return
+	}
+	if store.stop != nil {
+		close(store.stop)
+		<-store.done
+	}
+	if err := store.save(); err != nil {
+		panic(storeError("Couldn't write %s: %v", store.path, err))
+	}
+}
+
+func (store *memStore) compact() {
+}
+
+// A snapshot file, which NewPersistentMemStore can open
+func (store *memStore) backup(path string) error {
+	store.saveLock.Lock()
+	defer store.saveLock.Unlock()
+	return store.writeSnapshot(path)
+}
+
+func (store *memStore) describe() string {
+	if store.path != "" {
+		return fmt.Sprintf("Memory: %s", store.path)
+	}
+	return "Memory"
+}
+
+// No indexes to rebuild
+func (store *memStore) rebuildIndexes(db *LogeDB) int {
+	return 0
+}
+
+func (store *memStore) truncate(typ *logeType) int {
+	store.lock.SpinLock()
+	defer store.lock.Unlock()
+
+	var prefix = string(typePrefix(typ))
+	var count = 0
+	for cacheKey := range store.objects {
+		// Objects and links of a type share the top half of the tag
+		if cacheKey[:2] != prefix[:2] {
+			continue
+		}
+		if cacheKey[:4] == prefix {
+			count++
+		}
+		delete(store.objects, cacheKey)
+	}
+	store.changes++
+	return count
+}
+
+// Every committed version stays in the history
+func (store *memStore) retainsVersions() bool {
+	return true
 }
 
 func (store *memStore) registerType(typ *logeType) {
 	store.spackTypes.RegisterType(typ.Name)
+	tagLinks(typ)
+
+	// Kept for snapshots, which need tags to stay put
+	var vt = typ.SpackType
+	if (!vt.Dirty) {
+		return
+	}
+	var typeVal, err = store.spackTypes.Type("_type").EncodeObj(vt)
+	if err != nil {
+		panic(fmt.Sprintf("Error encoding type %s: %v", vt.Name, err))
+	}
+	store.lock.SpinLock()
+	store.typeInfo[vt.Name] = typeVal
+	store.changes++
+	store.lock.Unlock()
+	vt.Dirty = false
 }
 
 func (store *memStore) getSpackType(name string) *spack.VersionedType {
@@ -90,9 +250,10 @@ func (store *memStore) getSpackType(name string) *spack.VersionedType {
 }
 
 
-func (store *memStore) newContext(sID uint64) transactionContext {
+func (store *memStore) newContext(ctx context.Context, sID uint64) transactionContext {
 	return &memContext{
 		mstore: store,
+		ctx: ctx,
 		snapshotID: sID,
 	}
 }
@@ -103,6 +264,9 @@ func (context *memContext) getSnapshotID() uint64 {
 
 
 func (context *memContext) get(ref objRef) []byte {
+	checkContext(context.ctx)
+	context.mstore.lock.SpinLock()
+	defer context.mstore.lock.Unlock()
 	mvh, ok := context.mstore.objects[ref.CacheKey]
 	if !ok {
 		return nil
@@ -110,6 +274,10 @@ func (context *memContext) get(ref objRef) []byte {
 	return mvh.findPrevious(context.snapshotID)
 }
 
+func (context *memContext) contains(ref objRef) bool {
+	return context.get(ref) != nil
+}
+
 func (context *memContext) store(ref objRef, enc []byte) error {
 	context.writes = append(
 		context.writes,
@@ -128,17 +296,17 @@ func (context *memContext) remIndex(ref objRef, key LogeKey) {
 }
 func (context *memContext) find(ref objRef) ResultSet {
 	// Until I can be bothered
-	panic("Find not implemented on memstore")
+	panic(fmt.Errorf("%w: Find on memstore", ErrNotSupported))
 }
 
-func (context *memContext) findSlice(ref objRef, from LogeKey, limit int) ResultSet {
+func (context *memContext) findSlice(ref objRef, keyPrefix LogeKey, from LogeKey, limit int) ResultSet {
 	// Until I can be bothered
-	panic("Find not implemented on memstore")
+	panic(fmt.Errorf("%w: Find on memstore", ErrNotSupported))
 }
 
-func (context *memContext) listSlice(prefix []byte, from LogeKey, limit int) ResultSet {
+func (context *memContext) listSlice(typePrefix []byte, keyPrefix LogeKey, from LogeKey, limit int) ResultSet {
 	// Until I can be bothered
-	panic("List not implemented on memstore")
+	panic(fmt.Errorf("%w: List on memstore", ErrNotSupported))
 }
 
 func (context *memContext) commit(sID uint64) error {
@@ -150,8 +318,77 @@ func (context *memContext) commit(sID uint64) error {
 		var mvh = store.objects[entry.CacheKey]
 		store.objects[entry.CacheKey] = append(mvh, mv)
 	}
+	store.changes++
 	return nil
 }
 
 func (context *memContext) rollback() {
-}
\ No newline at end of file
+}
+
+// -----------------------------------------------
+// Paged result sets
+// -----------------------------------------------
+
+// Keys fetched per page
+const store_PAGE_SIZE = 256
+
+// For stores which can't hold an iterator open between reads: fetch
+// gives the next store_PAGE_SIZE keys after the one given, "" for the
+// first page.
+type pagedResultSet struct {
+	ctx context.Context
+	fetch func(after LogeKey) []LogeKey
+	last LogeKey
+	page []LogeKey
+	exhausted bool
+	limit int
+	count int
+	closed bool
+}
+
+func (rs *pagedResultSet) Valid() bool {
+	if rs.closed {
+		return false
+	}
+	if rs.limit >= 0 && rs.count >= rs.limit {
+		rs.Close()
+		return false
+	}
+	if len(rs.page) == 0 && !rs.exhausted {
+		rs.page = rs.fetch(rs.last)
+		rs.exhausted = len(rs.page) < store_PAGE_SIZE
+	}
+	if len(rs.page) == 0 {
+		rs.Close()
+		return false
+	}
+	return true
+}
+
+func (rs *pagedResultSet) Next() LogeKey {
+	if !rs.Valid() {
+		return ""
+	}
+	if rs.ctx.Err() != nil {
+		rs.Close()
+		checkContext(rs.ctx)
+	}
+	var next = rs.page[0]
+	rs.page = rs.page[1:]
+	rs.last = next
+	rs.count++
+	return next
+}
+
+func (rs *pagedResultSet) All() []LogeKey {
+	var keys = make([]LogeKey, 0)
+	for rs.Valid() {
+		keys = append(keys, rs.Next())
+	}
+	return keys
+}
+
+func (rs *pagedResultSet) Close() {
+	rs.closed = true
+	rs.page = nil
+}
@@ -0,0 +1,32 @@
+package loge
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFormatStamp(test *testing.T) {
+	for _, text := range []bool{ false, true } {
+		var stored []byte
+		var put = func (stamp []byte) error {
+			stored = stamp
+			return nil
+		}
+
+		if err := checkFormatStamp("new", nil, 2, text, put); err != nil || stored == nil {
+			test.Fatalf("New store not stamped (text %v): %v", text, err)
+		}
+		if err := checkFormatStamp("same", stored, 2, text, nil); err != nil {
+			test.Errorf("Own stamp refused (text %v): %v", text, err)
+		}
+		if err := checkFormatStamp("older", stored, 3, text, nil); err != nil {
+			test.Errorf("Older stamp refused (text %v): %v", text, err)
+		}
+		if err := checkFormatStamp("newer", stored, 1, text, nil); !errors.Is(err, ErrIncompatibleFormat) {
+			test.Errorf("Newer stamp accepted (text %v): %v", text, err)
+		}
+		if err := checkFormatStamp("junk", []byte("x"), 2, text, nil); !errors.Is(err, ErrIncompatibleFormat) {
+			test.Errorf("Unreadable stamp accepted (text %v): %v", text, err)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package loge
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/brendonh/spack"
+)
+
+// The interface for storage backends outside this package. Wrap one
+// with NewExternalStore to get a LogeStore for NewLogeDB:
+//
+//   var db = loge.NewLogeDB(loge.NewExternalStore(myStore))
+//
+// Loge hands the backend opaque blobs under StoreKeys, and does its own
+// encoding, caching and conflict checking on top. What it needs back:
+//
+// Snapshots. Every context is opened at a snapshot ID, and has to see
+// exactly the commits made at that ID or below, and none made later,
+// for as long as it's open. Commit IDs only go up, and no context opens
+// while a commit is under way, so a backend can keep just the newest
+// version of each blob as long as open contexts still see theirs (a
+// read transaction, say). Snapshot IDs start again from 1 each time a
+// LogeDB opens, so anything already stored counts as committed at 0.
+//
+// Commits. Puts are buffered in their context, and Commit writes all of
+// them at once, at the ID given, or none. Every context ends with one
+// call to Commit or Rollback, including contexts which put nothing.
+//
+// Links. A link set is a blob like any other, under a key with Link set,
+// and read with Get. Find goes the other way, from a link target to the
+// keys linking to it: AddIndex and RemoveIndex keep that index, and are
+// called in the same context as the Put which changes the link set.
+// Backends without Find can ignore them.
+//
+// Errors are raised to the caller as *StoreError, except ones matching
+// loge's own (ErrNotSupported, context.Canceled...) which go as they are.
+type Store interface {
+	// Everything PutType wrote, by name, read once on open
+	Types() (map[string][]byte, error)
+	PutType(name string, info []byte) error
+
+	NewContext(ctx context.Context, snapshotID uint64) StoreContext
+
+	// Removes every object of the type, with its links and their index
+	// entries, outside any transaction. Returns how many objects went.
+	Truncate(typeName string) (int, error)
+	// Writes a copy the same backend can open to path
+	Backup(path string) error
+	// Reclaims space, if the backend has a way to
+	Compact() error
+	// Whether a context can be opened at any past snapshot ID, rather
+	// than only the latest
+	RetainsVersions() bool
+	Close() error
+}
+
+type StoreContext interface {
+	// The blob as of the context's snapshot, nil if there isn't one
+	Get(key StoreKey) ([]byte, error)
+	// Until Commit. An empty blob deletes.
+	Put(key StoreKey, blob []byte) error
+
+	// Source's link set named key.Link now includes key.Key
+	AddIndex(key StoreKey, source LogeKey) error
+	// And doesn't any more
+	RemoveIndex(key StoreKey, source LogeKey) error
+
+	// Up to count keys starting with prefix and sorting after after (""
+	// for the first), in order. Find gives the sources of links named
+	// key.Link on key.Type to key.Key; List gives the keys of objects of
+	// the type. Loge pages through with the last key it got.
+	// ErrNotSupported if the backend can't.
+	Find(key StoreKey, prefix LogeKey, after LogeKey, count int) ([]LogeKey, error)
+	List(typeName string, prefix LogeKey, after LogeKey, count int) ([]LogeKey, error)
+
+	Commit(snapshotID uint64) error
+	Rollback()
+}
+
+// An object of Type, or with Link set, that link set on it. Raw is the
+// same thing as one string, unique across types and links, for backends
+// which just want a byte key. It stays the same across opens as long as
+// the type info from PutType comes back from Types.
+type StoreKey struct {
+	Type string
+	Link string
+	Key LogeKey
+	Raw string
+}
+
+type externalStore struct {
+	store Store
+	types *spack.TypeSet
+	lock sync.Mutex
+	typeNames map[uint16]string
+}
+
+type externalContext struct {
+	estore *externalStore
+	ctx context.Context
+	context StoreContext
+	snapshotID uint64
+}
+
+func NewExternalStore(store Store) LogeStore {
+	estore, err := OpenExternalStore(store)
+	if err != nil {
+		panic(err)
+	}
+	return estore
+}
+
+func OpenExternalStore(store Store) (estore LogeStore, err error) {
+	defer recoverError(&err)
+
+	var externalStore = &externalStore{
+		store: store,
+		types: spack.NewTypeSet(),
+		typeNames: make(map[uint16]string),
+	}
+
+	types, err := store.Types()
+	if err != nil {
+		return nil, &StoreError{ err }
+	}
+	var typeType = externalStore.types.Type("_type")
+	for _, typeVal := range types {
+		var typeInfo, _, err = typeType.DecodeObj(typeVal, false)
+		if err != nil {
+			return nil, storeError("Error loading type info: %v", err)
+		}
+		externalStore.types.LoadType(typeInfo.(*spack.VersionedType))
+	}
+	return externalStore, nil
+}
+
+func (store *externalStore) close() {
+	store.check(store.store.Close())
+}
+
+func (store *externalStore) compact() {
+	store.check(store.store.Compact())
+}
+
+func (store *externalStore) backup(path string) error {
+	return store.store.Backup(path)
+}
+
+func (store *externalStore) describe() string {
+	return fmt.Sprintf("External: %T", store.store)
+}
+
+// Needs every link read back, which a backend can do better itself
+func (store *externalStore) rebuildIndexes(db *LogeDB) int {
+	panic(fmt.Errorf("%w: RebuildIndexes on external store", ErrNotSupported))
+}
+
+func (store *externalStore) truncate(typ *logeType) int {
+	var count, err = store.store.Truncate(typ.Name)
+	store.check(err)
+	return count
+}
+
+func (store *externalStore) retainsVersions() bool {
+	return store.store.RetainsVersions()
+}
+
+func (store *externalStore) registerType(typ *logeType) {
+	store.lock.Lock()
+	store.typeNames[typ.SpackType.Tag] = typ.Name
+	store.lock.Unlock()
+
+	registerTypeInfo(store.types, typ, store.store.PutType)
+}
+
+func (store *externalStore) getSpackType(name string) *spack.VersionedType {
+	return store.types.RegisterType(name)
+}
+
+// Panics with err as the API promises
+func (store *externalStore) check(err error) {
+	if err == nil {
+		return
+	}
+	if isLogeError(err) {
+		panic(err)
+	}
+	panic(&StoreError{ err })
+}
+
+func makeStoreKey(ref objRef) StoreKey {
+	return StoreKey{
+		Type: ref.Type.Name,
+		Link: ref.LinkName,
+		Key: ref.Key,
+		Raw: ref.CacheKey,
+	}
+}
+
+
+// -----------------------------------------------
+// Transaction Contexts
+// -----------------------------------------------
+
+func (store *externalStore) newContext(ctx context.Context, sID uint64) transactionContext {
+	return &externalContext{
+		estore: store,
+		ctx: ctx,
+		context: store.store.NewContext(ctx, sID),
+		snapshotID: sID,
+	}
+}
+
+func (context *externalContext) getSnapshotID() uint64 {
+	return context.snapshotID
+}
+
+func (context *externalContext) get(ref objRef) []byte {
+	checkContext(context.ctx)
+	var blob, err = context.context.Get(makeStoreKey(ref))
+	if errors.Is(err, ErrNoSuchObject) {
+		return nil
+	}
+	context.estore.check(err)
+	if len(blob) == 0 {
+		return nil
+	}
+	return blob
+}
+
+func (context *externalContext) contains(ref objRef) bool {
+	return context.get(ref) != nil
+}
+
+func (context *externalContext) store(ref objRef, enc []byte) error {
+	return context.context.Put(makeStoreKey(ref), enc)
+}
+
+func (context *externalContext) addIndex(ref objRef, source LogeKey) {
+	context.estore.check(context.context.AddIndex(makeStoreKey(ref), source))
+}
+
+func (context *externalContext) remIndex(ref objRef, source LogeKey) {
+	context.estore.check(context.context.RemoveIndex(makeStoreKey(ref), source))
+}
+
+func (context *externalContext) find(ref objRef) ResultSet {
+	return context.findSlice(ref, "", "", -1)
+}
+
+func (context *externalContext) findSlice(ref objRef, keyPrefix LogeKey, from LogeKey, limit int) ResultSet {
+	var key = makeStoreKey(ref)
+	return context.slice(from, limit, func(after LogeKey) ([]LogeKey, error) {
+		return context.context.Find(key, keyPrefix, after, store_PAGE_SIZE)
+	})
+}
+
+func (context *externalContext) listSlice(typePrefix []byte, keyPrefix LogeKey, from LogeKey, limit int) ResultSet {
+	var tag = uint16(binary.BigEndian.Uint32(typePrefix) >> 16)
+	var store = context.estore
+	store.lock.Lock()
+	var name, ok = store.typeNames[tag]
+	store.lock.Unlock()
+	if !ok {
+		panic(storeError("No type with tag %d", tag))
+	}
+	return context.slice(from, limit, func(after LogeKey) ([]LogeKey, error) {
+		return context.context.List(name, keyPrefix, after, store_PAGE_SIZE)
+	})
+}
+
+// The first page is fetched up front, so a backend without Find or
+// List fails at the call rather than at the first Next
+func (context *externalContext) slice(from LogeKey, limit int, fetch func(LogeKey) ([]LogeKey, error)) ResultSet {
+	checkContext(context.ctx)
+	if limit == 0 {
+		return &pagedResultSet{ closed: true }
+	}
+
+	var first, err = fetch(from)
+	context.estore.check(err)
+
+	return &pagedResultSet{
+		ctx: context.ctx,
+		fetch: func(after LogeKey) []LogeKey {
+			var keys, err = fetch(after)
+			context.estore.check(err)
+			return keys
+		},
+		last: from,
+		page: first,
+		exhausted: len(first) < store_PAGE_SIZE,
+		limit: limit,
+	}
+}
+
+func (context *externalContext) commit(sID uint64) error {
+	return context.context.Commit(sID)
+}
+
+func (context *externalContext) rollback() {
+	context.context.Rollback()
+}
@@ -0,0 +1,246 @@
+package loge
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+)
+
+// A store wrapper keeping recently used blobs in memory over a slower
+// store underneath:
+//
+//   var store = loge.NewTieredStore(loge.NewLevelDBStore(path), nil)
+//
+// Commits go to the store underneath, then to memory. Reads try memory
+// first, falling through to the store underneath, and fill memory from
+// what they read there. Past either limit in TieredOptions the least
+// recently used blobs are dropped from memory.
+//
+// Memory holds only the newest version of each object, along with the
+// snapshot it's good from, so older snapshots still read underneath.
+type TieredStore struct {
+	LogeStore
+	opts TieredOptions
+
+	lock sync.Mutex
+	entries map[string]*list.Element
+	lru *list.List
+	bytes int64
+	stats TieredStats
+
+	// When the blobs dropped from memory were last written, so a read
+	// from an older snapshot can't bring back a stale one
+	evicted evictionMemory
+	// Keys with a commit under way, which reads mustn't fill
+	pending map[string]int
+	// Bumped by truncate, which no read from before may fill across
+	generation uint64
+}
+
+type TieredOptions struct {
+	// Zero for no limit
+	MaxEntries int
+	MaxBytes int64
+}
+
+var DefaultTieredOptions = TieredOptions{
+	MaxEntries: 100000,
+	MaxBytes: 256 << 20,
+}
+
+type TieredStats struct {
+	Hits uint64
+	Misses uint64
+	Evictions uint64
+	Entries int
+	Bytes int64
+}
+
+type tierEntry struct {
+	cacheKey string
+	blob []byte
+	validFrom uint64
+}
+
+type tieredContext struct {
+	transactionContext
+	tstore *TieredStore
+	snapshotID uint64
+	writes []memWriteEntry
+}
+
+func NewTieredStore(store LogeStore, opts *TieredOptions) *TieredStore {
+	if opts == nil {
+		opts = &DefaultTieredOptions
+	}
+	return &TieredStore{
+		LogeStore: store,
+		opts: *opts,
+		entries: make(map[string]*list.Element),
+		lru: list.New(),
+		pending: make(map[string]int),
+	}
+}
+
+func (store *TieredStore) Stats() TieredStats {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	var stats = store.stats
+	stats.Entries = len(store.entries)
+	stats.Bytes = store.bytes
+	return stats
+}
+
+func (store *TieredStore) describe() string {
+	return fmt.Sprintf("Memory over %s", store.LogeStore.describe())
+}
+
+func (store *TieredStore) truncate(typ *logeType) int {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	var count = store.LogeStore.truncate(typ)
+	store.generation++
+
+	// Objects and links of a type share the top half of the tag
+	var prefix = string(typePrefix(typ)[:2])
+	for cacheKey, el := range store.entries {
+		if cacheKey[:2] == prefix {
+			store.remove(el)
+		}
+	}
+	return count
+}
+
+func (store *TieredStore) lookup(cacheKey string, sID uint64) ([]byte, bool) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if el, ok := store.entries[cacheKey]; ok {
+		var entry = el.Value.(*tierEntry)
+		if entry.validFrom <= sID {
+			store.lru.MoveToFront(el)
+			store.stats.Hits++
+			return entry.blob, true
+		}
+	}
+	store.stats.Misses++
+	return nil, false
+}
+
+// With a blob read underneath at sID, when memory had nothing for it
+func (store *TieredStore) fill(cacheKey string, blob []byte, sID uint64, generation uint64) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if generation != store.generation || store.pending[cacheKey] > 0 {
+		return
+	}
+	if _, ok := store.entries[cacheKey]; ok {
+		return
+	}
+
+	var written = store.evicted.recall(cacheKey)
+	if written > sID {
+		store.evicted.remember(cacheKey, written)
+		return
+	}
+	store.set(cacheKey, blob, written)
+}
+
+func (store *TieredStore) set(cacheKey string, blob []byte, validFrom uint64) {
+	if el, ok := store.entries[cacheKey]; ok {
+		var entry = el.Value.(*tierEntry)
+		store.bytes += int64(len(blob) - len(entry.blob))
+		entry.blob, entry.validFrom = blob, validFrom
+		store.lru.MoveToFront(el)
+	} else {
+		store.entries[cacheKey] = store.lru.PushFront(&tierEntry{ cacheKey, blob, validFrom })
+		store.bytes += int64(len(cacheKey) + len(blob))
+	}
+
+	for store.lru.Len() > 0 && store.overLimit() {
+		var el = store.lru.Back()
+		store.evicted.remember(el.Value.(*tierEntry).cacheKey, el.Value.(*tierEntry).validFrom)
+		store.remove(el)
+		store.stats.Evictions++
+	}
+}
+
+func (store *TieredStore) overLimit() bool {
+	return (store.opts.MaxEntries > 0 && store.lru.Len() > store.opts.MaxEntries) ||
+		(store.opts.MaxBytes > 0 && store.bytes > store.opts.MaxBytes)
+}
+
+func (store *TieredStore) remove(el *list.Element) {
+	var entry = el.Value.(*tierEntry)
+	store.bytes -= int64(len(entry.cacheKey) + len(entry.blob))
+	delete(store.entries, entry.cacheKey)
+	store.lru.Remove(el)
+}
+
+
+// -----------------------------------------------
+// Transaction Contexts
+// -----------------------------------------------
+
+func (store *TieredStore) newContext(ctx context.Context, sID uint64) transactionContext {
+	return &tieredContext{
+		transactionContext: store.LogeStore.newContext(ctx, sID),
+		tstore: store,
+		snapshotID: sID,
+	}
+}
+
+func (context *tieredContext) get(ref objRef) []byte {
+	var store = context.tstore
+	if blob, ok := store.lookup(ref.CacheKey, context.snapshotID); ok {
+		return blob
+	}
+
+	store.lock.Lock()
+	var generation = store.generation
+	store.lock.Unlock()
+
+	var blob = context.transactionContext.get(ref)
+	store.fill(ref.CacheKey, blob, context.snapshotID, generation)
+	return blob
+}
+
+func (context *tieredContext) contains(ref objRef) bool {
+	return context.get(ref) != nil
+}
+
+func (context *tieredContext) store(ref objRef, enc []byte) error {
+	context.writes = append(context.writes, memWriteEntry{ ref.CacheKey, enc })
+	return context.transactionContext.store(ref, enc)
+}
+
+func (context *tieredContext) commit(sID uint64) error {
+	var store = context.tstore
+	store.lock.Lock()
+	for _, entry := range context.writes {
+		store.pending[entry.CacheKey]++
+	}
+	store.lock.Unlock()
+
+	var err = context.transactionContext.commit(sID)
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	for _, entry := range context.writes {
+		if store.pending[entry.CacheKey]--; store.pending[entry.CacheKey] == 0 {
+			delete(store.pending, entry.CacheKey)
+		}
+		if err != nil {
+			continue
+		}
+		var blob = entry.Value
+		if len(blob) == 0 {
+			blob = nil
+		}
+		store.set(entry.CacheKey, blob, sID)
+	}
+	return err
+}
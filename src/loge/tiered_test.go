@@ -0,0 +1,62 @@
+package loge
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTieredStore(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "loge-tiered")
+	defer os.RemoveAll(dir)
+
+	var store = NewTieredStore(NewBoltStore(filepath.Join(dir, "loge.db")), &TieredOptions{ MaxEntries: 10 })
+	var db = NewLogeDB(store)
+	defer db.Close()
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+
+	for i := 0; i < 20; i++ {
+		db.SetOne("test", LogeKey(fmt.Sprintf("%02d", i)), &TestObj{ "First" })
+	}
+	var stats = store.Stats()
+	if stats.Entries != 10 || stats.Evictions != 10 {
+		test.Errorf("Memory not bounded: %+v", stats)
+	}
+
+	// Evicted objects are read underneath, and back in memory after
+	if obj := db.ReadOne("test", "00").(*TestObj); obj == nil || obj.Name != "First" {
+		test.Errorf("Wrong evicted object: %v", obj)
+	}
+	var hits = store.Stats().Hits
+	db.ReadOne("test", "00")
+	if store.Stats().Hits != hits + 1 {
+		test.Error("Read didn't fill memory")
+	}
+
+	// Memory only has the newest version, so older snapshots go
+	// underneath
+	var ref = makeObjRef(db.lookupType("test"), "19")
+	var _, old = db.currentContext(context.Background())
+	var seen = old.get(ref)
+	db.SetOne("test", "19", &TestObj{ "Second" })
+	if blob := old.get(ref); string(blob) != string(seen) {
+		test.Error("Old snapshot read the new version")
+	}
+	old.rollback()
+	if obj := db.ReadOne("test", "19").(*TestObj); obj == nil || obj.Name != "Second" {
+		test.Errorf("Wrong object: %v", obj)
+	}
+
+	if count := db.Truncate("test"); count != 20 {
+		test.Errorf("Wrong truncate count: %d", count)
+	}
+	if stats := store.Stats(); stats.Entries != 0 || stats.Bytes != 0 {
+		test.Errorf("Memory left after truncate: %+v", stats)
+	}
+	if db.ExistsOne("test", "19") {
+		test.Error("Object survived truncate")
+	}
+}
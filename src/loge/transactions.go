@@ -1,13 +1,18 @@
 package loge
 
 import (
+	"context"
 	"fmt"
-	"time"
-	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
 )
 
 type TransactionState int
 
+// Concurrent store reads per ReadMany
+const readManyParallelism = 16
+
 const (
 	ACTIVE = iota
 	CANCELLED
@@ -15,6 +20,7 @@ const (
 	FINISHED
 	ABORTED
 	ERROR
+	PREPARED
 )
 
 
@@ -22,46 +28,169 @@ type liveVersion struct {
 	version *objectVersion
 	object interface{}
 	dirty bool
+	// From ReadLazy, with object not decoded yet
+	lazy bool
+	// From WriteLocked, and latest committed so it can't conflict
+	locked bool
+	current bool
+}
+
+func (lv *liveVersion) exists() bool {
+	if lv.lazy {
+		return len(lv.version.Blob) > 0
+	}
+	return lv.object != nil && lv.version.LogeObj.hasValue(lv.object)
 }
 
 
 type Transaction struct {
 	db *LogeDB
+	ctx context.Context
 	context transactionContext
 	versions map[string]*liveVersion
 	state TransactionState
 	snapshotID uint64
 	cancelled bool
 	giveJSON bool
+	view bool
+	readOnly bool
+	err error
+	conflict *ConflictInfo
+	isolation IsolationLevel
+	queries []query
+	async bool
+	durable func(error)
+	limits TransactionLimits
+	bytes int
+	opCtx *opContext
+	label string
+	// What a successful commit wrote, at commitID
+	committed []*logeObject
+	commitID uint64
 }
 
 func NewTransaction(db *LogeDB, sID uint64) *Transaction {
+	var ctx = context.Background()
+	var opCtx = newOpContext(ctx, db.opTimeout)
+	var t = newTransaction(db, ctx, db.store.newContext(opCtx, sID), sID)
+	t.opCtx = opCtx
+	return t
+}
+
+func newTransaction(db *LogeDB, ctx context.Context, context transactionContext, sID uint64) *Transaction {
 	return &Transaction{
 		db: db,
-		context: db.store.newContext(sID),
+		ctx: ctx,
+		context: context,
 		versions: make(map[string]*liveVersion),
 		state: ACTIVE,
 		snapshotID: sID,
+		limits: db.limits,
 	}
 }
 
 
 func (t *Transaction) String() string {
+	if t.label != "" {
+		return fmt.Sprintf("Transaction<%s: %s>", t.label, t.state.String())
+	}
 	return fmt.Sprintf("Transaction<%s>", t.state.String())
 }
 
+// Names the transaction in panics, commit errors, conflicts and
+// contention reports, e.g. with a request or trace ID
+func (t *Transaction) SetLabel(label string) {
+	t.label = label
+}
+
+func (t *Transaction) Label() string {
+	return t.label
+}
+
 func (t *Transaction) GetState() TransactionState {
 	return t.state
 }
 
+// Objects the transaction hasn't touched are probed in the store without
+// being loaded. They don't become part of the transaction, so a
+// concurrent create or delete of one won't abort its commit; Read it if
+// that matters.
 func (t *Transaction) Exists(typeName string, key LogeKey) bool {
-	var lv = t.getVersion(t.db.makeObjRef(typeName, key), false, true)
-	return lv.version.LogeObj.hasValue(lv.object)
+	return t.exists(t.db.makeObjRef(typeName, key))
+}
+
+func (t *Transaction) exists(ref objRef) bool {
+	if t.state != ACTIVE {
+		panic(fmt.Errorf("%w: %s", ErrInactive, t))
+	}
+	if lv, ok := t.versions[ref.CacheKey]; ok {
+		return lv.exists()
+	}
+	defer t.operation()()
+	return t.context.contains(ref)
 }
 
 
 func (t *Transaction) Read(typeName string, key LogeKey) interface{} {
-	return t.getVersion(t.db.makeObjRef(typeName, key), false, true).object
+	return t.readObject(t.getVersion(t.db.makeObjRef(typeName, key), false, true))
+}
+
+
+// Read, with ok false if the object doesn't exist, rather than the
+// type's nil value
+func (t *Transaction) ReadOK(typeName string, key LogeKey) (obj interface{}, ok bool) {
+	var lv = t.getVersion(t.db.makeObjRef(typeName, key), false, true)
+	if lv.object == nil || !lv.version.LogeObj.hasValue(lv.object) {
+		return nil, false
+	}
+	return t.readObject(lv), true
+}
+
+// Like Read for each key, but objects not yet in the transaction are
+// loaded together: in one store call where the store supports it,
+// otherwise concurrently
+func (t *Transaction) ReadMany(typeName string, keys []LogeKey) []interface{} {
+	var refs = t.objRefs(typeName, keys)
+	t.loadMany(refs)
+
+	var objects = make([]interface{}, len(refs))
+	for i, ref := range refs {
+		objects[i] = t.readObject(t.getVersion(ref, false, true))
+	}
+	return objects
+}
+
+
+// Which of keys exist, probed like Exists
+func (t *Transaction) ExistsMany(typeName string, keys []LogeKey) map[LogeKey]bool {
+	var exists = make(map[LogeKey]bool, len(keys))
+	for _, ref := range t.objRefs(typeName, keys) {
+		exists[ref.Key] = t.exists(ref)
+	}
+	return exists
+}
+
+// Deletes every object of the type whose key starts with prefix, and
+// clears its links, returning how many objects there were
+func (t *Transaction) DeleteAll(typeName string, prefix LogeKey) int {
+	var typ = t.db.lookupType(typeName)
+	var keys = t.ListPrefix(typeName, prefix, "", -1).All()
+
+	var refs = t.objRefs(typeName, keys)
+	for linkName := range typ.Links {
+		for _, key := range keys {
+			refs = append(refs, makeLinkRef(typ, linkName, key))
+		}
+	}
+	t.loadMany(refs)
+
+	for _, key := range keys {
+		t.Delete(typeName, key)
+		for linkName := range typ.Links {
+			t.SetLinks(typeName, linkName, key, nil)
+		}
+	}
+	return len(keys)
 }
 
 
@@ -73,6 +202,7 @@ func (t *Transaction) Write(typeName string, key LogeKey) interface{} {
 func (t *Transaction) Set(typeName string, key LogeKey, obj interface{}) {
 	var version = t.getVersion(t.db.makeObjRef(typeName, key), true, false)
 	version.object = obj
+	version.version.LogeObj.populateMeta(obj, t.snapshotID)
 }
 
 
@@ -82,52 +212,96 @@ func (t *Transaction) Delete(typeName string, key LogeKey) {
 }
 
 
-func (t *Transaction) ReadLinks(typeName string, linkName string, key LogeKey) []string {
+func (t *Transaction) ReadLinks(typeName string, linkName string, key LogeKey) []LogeKey {
 	return t.getLink(t.db.makeLinkRef(typeName, linkName, key), false, true).ReadKeys()
 }
 
+// Up to limit targets after afterTarget, in order, or all of them after
+// it if limit is negative. Pass a page's last target for the next:
+//
+//   var page = t.ReadLinksPage("person", "friends", key, "", 100)
+//   for ; len(page) > 0; page = t.ReadLinksPage("person", "friends", key, page[len(page) - 1], 100) {
+//       ...
+//   }
+//
+// Stores keep an object's links in one record, read whole on a cache
+// miss. It's decoded once per cached version and shared by transactions
+// reading it, so after that a page costs its length. Like ReadLinks,
+// the result mustn't be modified.
+func (t *Transaction) ReadLinksPage(typeName string, linkName string, key LogeKey, afterTarget LogeKey, limit int) []LogeKey {
+	return t.getLink(t.db.makeLinkRef(typeName, linkName, key), false, true).Page(afterTarget, limit)
+}
+
+// How many targets ReadLinks would give. Cached versions keep their
+// keys, set when they're committed, so the count is their length plus
+// the transaction's changes, without merging or decoding. Stores don't
+// keep counts: on a cache miss the links are loaded as with ReadLinks.
+func (t *Transaction) LinkCount(typeName string, linkName string, key LogeKey) int {
+	return t.getLink(t.db.makeLinkRef(typeName, linkName, key), false, true).Len()
+}
+
 func (t *Transaction) HasLink(typeName string, linkName string, key LogeKey, target LogeKey) bool {
-	return t.getLink(t.db.makeLinkRef(typeName, linkName, key), false, true).Has(string(target))
+	return t.getLink(t.db.makeLinkRef(typeName, linkName, key), false, true).Has(target)
 }
 
 func (t *Transaction) AddLink(typeName string, linkName string, key LogeKey, target LogeKey) {
-	t.getLink(t.db.makeLinkRef(typeName, linkName, key), true, true).Add(string(target))
+	checkKey(target)
+	t.getLink(t.db.makeLinkRef(typeName, linkName, key), true, true).Add(target)
 }
 
 func (t *Transaction) RemoveLink(typeName string, linkName string, key LogeKey, target LogeKey) {
-	t.getLink(t.db.makeLinkRef(typeName, linkName, key), true, true).Remove(string(target))
+	t.getLink(t.db.makeLinkRef(typeName, linkName, key), true, true).Remove(target)
 }
 
 func (t *Transaction) SetLinks(typeName string, linkName string, key LogeKey, targets []LogeKey) {
-	// XXX BGH: Yargh
-	var stringTargets = make([]string, 0, len(targets))
-	for _, key := range targets {
-		stringTargets = append(stringTargets, string(key))
+	for _, target := range targets {
+		checkKey(target)
 	}
-	t.getLink(t.db.makeLinkRef(typeName, linkName, key), true, true).Set(stringTargets)
+	t.getLink(t.db.makeLinkRef(typeName, linkName, key), true, true).Set(targets)
 }
 
 func (t *Transaction) Find(typeName string, linkName string, target LogeKey) ResultSet {
-	return t.context.find(t.db.makeLinkRef(typeName, linkName, target))
+	var ref = t.db.makeLinkRef(typeName, linkName, target)
+	t.recordQuery(query{ typ: ref.Type, ref: ref, limit: -1 })
+	defer t.operation()()
+	return t.context.find(ref)
 }
 
 func (t *Transaction) FindSlice(typeName string, linkName string, target LogeKey, from LogeKey, limit int) ResultSet {	
-	return t.context.findSlice(t.db.makeLinkRef(typeName, linkName, target), from, limit)
+	return t.FindPrefix(typeName, linkName, target, "", from, limit)
+}
+
+// Only sources whose keys start with prefix, e.g. a KeyPrefix
+func (t *Transaction) FindPrefix(typeName string, linkName string, target LogeKey, prefix LogeKey, from LogeKey, limit int) ResultSet {
+	var ref = t.db.makeLinkRef(typeName, linkName, target)
+	t.recordQuery(query{ typ: ref.Type, ref: ref, keyPrefix: prefix, from: from, limit: limit })
+	defer t.operation()()
+	return t.context.findSlice(ref, prefix, from, limit)
 }
 
 func (t *Transaction) ListSlice(typeName string, from LogeKey, limit int) ResultSet {	
-	typ, ok := t.db.types[typeName]
-	if !ok {
-		panic(fmt.Sprintf("No such type %s\n", typeName))
-	}
-	var prefix = typePrefix(typ)
-	return t.context.listSlice(prefix, from, limit)
+	return t.ListPrefix(typeName, "", from, limit)
+}
+
+func (t *Transaction) ListPrefix(typeName string, prefix LogeKey, from LogeKey, limit int) ResultSet {
+	var typ = t.db.lookupType(typeName)
+	t.recordQuery(query{ typ: typ, typePrefix: typePrefix(typ), keyPrefix: prefix, from: from, limit: limit })
+	defer t.operation()()
+	return t.context.listSlice(typePrefix(typ), prefix, from, limit)
 }
 
 // -----------------------------------------------
 // Internals
 // -----------------------------------------------
 
+func (t *Transaction) objRefs(typeName string, keys []LogeKey) []objRef {
+	var refs = make([]objRef, len(keys))
+	for i, key := range keys {
+		refs[i] = t.db.makeObjRef(typeName, key)
+	}
+	return refs
+}
+
 func (t *Transaction) getLink(ref objRef, forWrite bool, load bool) *linkSet {
 	var version = t.getVersion(ref, forWrite, load)
 	return version.object.(*linkSet)
@@ -136,47 +310,188 @@ func (t *Transaction) getLink(ref objRef, forWrite bool, load bool) *linkSet {
 func (t *Transaction) getVersion(ref objRef, forWrite bool, load bool) *liveVersion {
 
 	if t.state != ACTIVE {
-		panic(fmt.Sprintf("GetObj from inactive transaction %s\n", t))
+		panic(fmt.Errorf("%w: %s", ErrInactive, t))
 	}
 
 	var objKey = ref.CacheKey
 
+	if forWrite && t.ReadOnly() {
+		panic(fmt.Errorf("%w: %s", ErrReadOnly, t))
+	}
+	if forWrite {
+		checkKey(ref.Key)
+	}
+
 	lv, ok := t.versions[objKey]
 
 	if ok {
+		if lv.lazy {
+			t.decodeLazy(lv)
+		}
 		if forWrite {
 			lv.dirty = true
 		}
 		return lv
 	}
 
-	var version = t.db.acquireVersion(ref, t.context, load)
+	if forWrite {
+		t.checkLimits(1)
+	}
+	defer t.operation()()
+	return t.addVersion(objKey, t.acquire(ref, load), forWrite)
+}
 
+func (t *Transaction) addVersion(objKey string, version *objectVersion, forWrite bool) *liveVersion {
 	object, upgraded := version.getObject(t.giveJSON)
+	version.LogeObj.populateMeta(object, t.snapshotID)
 
-	lv = &liveVersion{
+	var lv = &liveVersion{
 		version: version,
 		object: object,
-		dirty: forWrite || upgraded,
+		dirty: forWrite || (upgraded && !t.readOnly),
 	}
 
 	t.versions[objKey] = lv
+	t.countVersion(objKey, version)
 	return lv
 }
 
+// Acquires and loads every ref the transaction doesn't have yet: in one
+// call if the store can, otherwise up to readManyParallelism store reads
+// at a time
+func (t *Transaction) loadMany(refs []objRef) {
+	if t.state != ACTIVE {
+		panic(fmt.Errorf("%w: %s", ErrInactive, t))
+	}
+
+	defer t.operation()()
+	var missing = t.missingRefs(refs)
+	if getter, ok := t.context.(multiGetter); ok && len(missing) > 1 {
+		t.loadBatched(getter, missing)
+		return
+	}
+
+	var versions = make([]*objectVersion, len(missing))
+	var failure interface{}
+	var failureLock sync.Mutex
+	var sem = make(chan bool, readManyParallelism)
+	var wg sync.WaitGroup
+
+	for i, ref := range missing {
+		wg.Add(1)
+		sem <- true
+		go func(i int, ref objRef) {
+			defer func() {
+				if r := recover(); r != nil {
+					failureLock.Lock()
+					failure = r
+					failureLock.Unlock()
+				}
+				<-sem
+				wg.Done()
+			}()
+			versions[i] = t.acquire(ref, true)
+		}(i, ref)
+	}
+	wg.Wait()
+
+	for i, version := range versions {
+		if version != nil {
+			t.addVersion(missing[i].CacheKey, version, false)
+		}
+	}
+
+	if failure != nil {
+		panic(failure)
+	}
+}
 
-const t_BACKOFF_EXPONENT = 1.05
 
 func (t *Transaction) Cancel() {
 	if (t.state != ACTIVE) {
 		panic(fmt.Sprintf("Cancel on transaction %s\n", t))
 	}
 
+	t.abandon()
+}
+
+// Discards the transaction, giving back the objects it holds. Unlike
+// Cancel it's a no-op once the transaction has finished, so it can be
+// deferred straight after creating one:
+//
+//   var t = db.CreateTransaction()
+//   defer t.Abort()
+//
+// Within Transact, the transaction isn't committed or retried. A
+// prepared transaction gives back its locks; see Prepare.
+func (t *Transaction) Abort() {
+	if t.state != ACTIVE && t.state != PREPARED {
+		return
+	}
+	t.abandon()
+	t.state = ABORTED
+	t.cancelled = true
+}
+
+// As Abort
+func (t *Transaction) Rollback() {
+	t.Abort()
+}
+
+// Cancels without committing, giving back everything the transaction holds
+func (t *Transaction) abandon() {
 	t.state = CANCELLED
+	if !t.view {
+		t.context.rollback()
+	}
+	t.unlockWrites()
+	t.release()
 }
 
 func (t *Transaction) Commit() bool {
-	if (t.state == CANCELLED) {
+	return t.CommitContext(context.Background())
+}
+
+// Commit, returning Err rather than false
+func (t *Transaction) CommitErr() error {
+	return t.CommitErrContext(context.Background())
+}
+
+func (t *Transaction) CommitErrContext(ctx context.Context) error {
+	if t.CommitContext(ctx) {
+		return nil
+	}
+	return t.Err()
+}
+
+// Why a finished transaction didn't commit: a *ConflictInfo, which is
+// ErrConflict, if another commit got to its objects first, a *ValidationError if a type's
+// Validate rejected an object, a *StoreError if the store failed,
+// the context's error if it was done, otherwise ErrAborted if it was
+// cancelled or aborted. Nil while it's active and once it's committed.
+func (t *Transaction) Err() error {
+	switch t.state {
+	case ABORTED:
+		if t.cancelled {
+			return ErrAborted
+		}
+		if t.conflict != nil {
+			return t.conflict
+		}
+		return ErrConflict
+	case CANCELLED:
+		if t.err != nil {
+			return t.err
+		}
+		return ErrAborted
+	case ERROR:
+		return t.err
+	}
+	return nil
+}
+
+func (t *Transaction) CommitContext(ctx context.Context) bool {
+	if (t.state == CANCELLED || t.cancelled) {
 		return false
 	}
 
@@ -184,61 +499,257 @@ func (t *Transaction) Commit() bool {
 		panic(fmt.Sprintf("Commit on transaction %s\n", t))
 	}
 
-	t.state = COMMITTING
+	if t.view {
+		panic(fmt.Errorf("%w: Commit on snapshot view %s", ErrReadOnly, t))
+	}
+
+	// Nothing to write, so nothing to conflict with
+	if t.readOnly {
+		t.state = FINISHED
+		t.context.rollback()
+		t.nothingToWrite()
+		return true
+	}
+
+	t.checkReads()
 
-	var versions = make([]*liveVersion, 0, len(t.versions))
-	for _, v := range t.versions {
-		versions = append(versions, v)
+	if t.db.readOnly {
+		t.state = FINISHED
+		t.context.rollback()
+		t.db.releaseVersions(t.liveVersions())
+		t.nothingToWrite()
+		return true
 	}
-	
-	var delayFact = 10.0
-	for {
-		if t.tryCommit(versions) {
-			break
+
+	var admission = t.db.admission
+	if err := admission.acquire(ctx); err != nil {
+		t.abandon()
+		t.err = err
+		return false
+	}
+	defer admission.release()
+
+	var writes = t.writes()
+	if writes {
+		if err := t.db.quiescence.enter(ctx); err != nil {
+			t.abandon()
+			t.err = err
+			return false
 		}
-		var delay = time.Duration(delayFact - float64(rand.Intn(10)))
-		time.Sleep(delay * time.Millisecond)
-		delayFact *= t_BACKOFF_EXPONENT
 	}
 
+	t.state = COMMITTING
+
+	var versions = t.liveVersions()
+
+	func() {
+		if writes {
+			defer t.db.quiescence.exit()
+		}
+		t.tryCommit(ctx, versions)
+	}()
+	return t.finishCommit(versions)
+}
+
+// Gives back what the commit held, whether or not it went through
+func (t *Transaction) finishCommit(versions []*liveVersion) bool {
+	t.unlockWrites()
 	t.db.releaseVersions(versions)
 
+	if t.state == FINISHED {
+		t.db.commitHooks.run(t.commitID, t.committed)
+	}
+
+	switch t.state {
+	case FINISHED:
+		atomic.AddUint64(&t.db.counters.commits, 1)
+	case ABORTED:
+		atomic.AddUint64(&t.db.counters.aborts, 1)
+	}
+
 	return t.state == FINISHED
 }
 
-func (t *Transaction) tryCommit(versions []*liveVersion) bool {
+// Sorted by key: locks are always taken in this order, so committers
+// can queue on them without deadlocking each other.
+func (t *Transaction) liveVersions() []*liveVersion {
+	var keys = make([]string, 0, len(t.versions))
+	for key := range t.versions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var versions = make([]*liveVersion, 0, len(keys))
+	for _, key := range keys {
+		versions = append(versions, t.versions[key])
+	}
+	return versions
+}
+
+func (t *Transaction) tryCommit(ctx context.Context, versions []*liveVersion) {
 	for _, lv := range versions {
 		var obj = lv.version.LogeObj
 
-		if !obj.Lock.TryLock() {
-			return false
+		if !t.checksVersion(lv) {
+			continue
 		}
+
+		obj.Lock.SpinLock()
 		defer obj.Lock.Unlock()
 
-		if obj.Current.snapshotID > t.snapshotID {
+		if lv.dirty && obj.lockedAgainst(t) {
+			t.conflict = newConflictInfo(t, lv)
 			t.state = ABORTED
-			return true
+			t.context.rollback()
+			return
+		}
+
+		if obj.Current.snapshotID > lv.version.snapshotID && !lv.current {
+			if !t.canMerge(lv) {
+				t.conflict = newConflictInfo(t, lv)
+				t.state = ABORTED
+				t.context.rollback()
+				return
+			}
+			t.merge(lv)
 		}
 	}
 
+	// Cancelled rather than aborted, so it isn't retried
+	if err := t.validate(versions); err != nil {
+		t.state = CANCELLED
+		t.err = err
+		t.context.rollback()
+		return
+	}
+
+	// Last chance to give up: once versions are applied the store write
+	// has to go through, or the cache would disagree with it
+	if err := ctx.Err(); err != nil {
+		t.state = CANCELLED
+		t.err = err
+		t.context.rollback()
+		return
+	}
+
+	t.apply(versions)
+}
+
+// Writes the versions under a new snapshot ID. Under their objects' locks.
+func (t *Transaction) apply(versions []*liveVersion) {
 	var context = t.context
-	var sID = t.db.newSnapshotID()
+	var sID uint64
+	var dirty []*logeObject
+
+	// Transactions opening meanwhile see below sID until the store has
+	// it, so the lock only covers taking the ID
+	t.conflict = func() *ConflictInfo {
+		t.db.snapshotLock.Lock()
+		defer t.db.snapshotLock.Unlock()
+
+		// Queries are checked against the store
+		if len(t.queries) > 0 {
+			t.db.commits.drain()
+		}
 
+		if conflict := t.checkQueries(); conflict != nil {
+			return conflict
+		}
+
+		sID = t.db.newSnapshotID()
+		t.db.commits.reserve(sID)
+		// The async queue has to be in ID order, and the write applied
+		// before it's queued
+		if t.async {
+			dirty = t.applyVersions(versions, sID)
+			t.db.async.enqueue(context, &t.db.commits, sID, t.label, t.durable)
+		}
+		return nil
+	}()
+	if t.conflict != nil {
+		t.state = ABORTED
+		t.context.rollback()
+		return
+	}
+
+	if !t.async {
+		dirty = t.applyVersions(versions, sID)
+		t.db.commits.wait(sID)
+		var err = context.commit(sID)
+		t.db.commits.done(sID)
+		if err != nil {
+			t.state = ERROR
+			t.err = &StoreError{ err }
+			fmt.Printf("Commit error in %s: %v\n", t, err)
+			return
+		}
+	}
+
+	var feed, triggers = t.db.feed.active(), t.db.triggers.active()
+	if len(dirty) > 0 && (feed || triggers) {
+		var changes = make([]Change, 0, len(dirty))
+		var now = t.db.clock.Now()
+		for _, obj := range dirty {
+			changes = append(changes, obj.change(sID, now))
+		}
+		if feed {
+			t.db.feed.publish(changes)
+		}
+		if triggers {
+			t.db.triggers.enqueue(changes)
+		}
+	}
+
+	t.committed = dirty
+	t.commitID = sID
+	t.state = FINISHED
+}
+
+func (t *Transaction) applyVersions(versions []*liveVersion, sID uint64) []*logeObject {
+	var dirty = make([]*logeObject, 0, len(versions))
 	for _, lv := range versions {
 		if lv.dirty {
 			var obj = lv.version.LogeObj
-			obj.applyVersion(lv.object, context, sID)
+			obj.applyVersion(lv.object, t.context, sID)
+			dirty = append(dirty, obj)
 		}
 	}
+	return dirty
+}
+
+func (t *Transaction) canMerge(lv *liveVersion) bool {
+	var obj = lv.version.LogeObj
+	return lv.dirty && obj.Type.Merger != nil && obj.LinkName == "" && !t.giveJSON
+}
 
-	var err = context.commit(sID)
-	if err != nil {
-		t.state = ERROR
-		fmt.Printf("Commit error: %v\n", err)
+func (t *Transaction) merge(lv *liveVersion) {
+	var obj = lv.version.LogeObj
+	var ref = obj.makeObjRef()
+
+	var baseBlob = lv.version.Blob
+	if !lv.version.loaded {
+		baseBlob = t.context.get(ref)
 	}
 
-	t.state = FINISHED
-	return true
+	// Every commit since we acquired the object is in its version
+	// chain, so the newest loaded version is the committed state
+	var current = obj.Current
+	for current != nil && !current.loaded {
+		current = current.Previous
+	}
+
+	var currentBlob []byte
+	if current != nil {
+		currentBlob = current.Blob
+	} else {
+		var _, context = t.db.currentContext(t.ctx)
+		currentBlob = context.get(ref)
+		context.rollback()
+	}
+
+	base, _ := obj.decode(baseBlob, false)
+	currentObj, _ := obj.decode(currentBlob, false)
+	lv.object = obj.Type.Merger(base, lv.object, currentObj)
 }
 
 
@@ -256,6 +767,8 @@ func (ts TransactionState) String() string {
 		return "ABORTED"
 	case ERROR: 
 		return "ERROR"
+	case PREPARED:
+		return "PREPARED"
 	}
 	return "UNKNOWN STATE"
 }
\ No newline at end of file
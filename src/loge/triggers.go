@@ -0,0 +1,267 @@
+package loge
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Runs Action in a transaction of its own after each commit with a
+// matching change, e.g. to keep a denormalized count up to date:
+//
+//   db.AddTrigger(&loge.Trigger{
+//       Name: "post-count",
+//       Type: "post",
+//       Action: func (t *loge.Transaction, change loge.Change) {
+//           ...
+//       },
+//   })
+//
+// Changes match on Type, then Link (object changes if empty), Prefix and
+// Match, which sees the committed object. Actions run one at a time in
+// commit order, after the commit returns; changes made by actions fire
+// triggers too. An action which panics or doesn't commit is retried
+// with Backoff doubling each time, and after Attempts tries the change
+// becomes a DeadLetter. Triggers queued when the database closes are
+// dropped.
+type Trigger struct {
+	Name string
+	Type string
+	Link string
+	Prefix LogeKey
+	Match func(Change) bool
+	Action func(*Transaction, Change)
+
+	Attempts int // defaultTriggerAttempts if zero
+	Backoff time.Duration
+	Timeout time.Duration // For each transaction, as with Transact
+}
+
+type DeadLetter struct {
+	Trigger string
+	Change Change
+	Attempts int
+	Err error
+}
+
+var defaultTriggerAttempts = 3
+
+// Oldest dead letters are dropped past this
+var deadLetterLimit = 1000
+
+type triggerSet struct {
+	lock sync.Mutex
+	cond *sync.Cond
+	triggers []*Trigger
+	queue []triggerJob
+	started bool
+	busy bool
+	stopped bool
+	done chan bool
+	dead []DeadLetter
+	onDead func(DeadLetter)
+}
+
+type triggerJob struct {
+	trigger *Trigger
+	change Change
+}
+
+func (db *LogeDB) AddTrigger(trigger *Trigger) {
+	var typ = db.lookupType(trigger.Type)
+	if trigger.Link != "" {
+		if _, ok := typ.Links[trigger.Link]; !ok {
+			panic(fmt.Errorf("%w: %s.%s", ErrNoSuchLink, trigger.Type, trigger.Link))
+		}
+	}
+
+	var ts = &db.triggers
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+	for _, existing := range ts.triggers {
+		if existing.Name == trigger.Name {
+			panic(fmt.Sprintf("Trigger %s already exists", trigger.Name))
+		}
+	}
+	ts.triggers = append(ts.triggers[:len(ts.triggers):len(ts.triggers)], trigger)
+
+	if !ts.started {
+		ts.started = true
+		ts.cond = sync.NewCond(&ts.lock)
+		ts.done = make(chan bool)
+		go db.runTriggers()
+	}
+}
+
+// Changes already queued for the trigger still run
+func (db *LogeDB) RemoveTrigger(name string) bool {
+	var ts = &db.triggers
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+	for i, trigger := range ts.triggers {
+		if trigger.Name == name {
+			var triggers = make([]*Trigger, 0, len(ts.triggers) - 1)
+			ts.triggers = append(append(triggers, ts.triggers[:i]...), ts.triggers[i + 1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Called from the trigger goroutine for each new dead letter, which is
+// also kept for DeadLetters
+func (db *LogeDB) OnDeadLetter(handler func(DeadLetter)) {
+	db.triggers.lock.Lock()
+	defer db.triggers.lock.Unlock()
+	db.triggers.onDead = handler
+}
+
+func (db *LogeDB) DeadLetters() []DeadLetter {
+	db.triggers.lock.Lock()
+	defer db.triggers.lock.Unlock()
+	return append([]DeadLetter(nil), db.triggers.dead...)
+}
+
+// Waits until every queued trigger has run
+func (db *LogeDB) WaitTriggers() {
+	var ts = &db.triggers
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+	for ts.started && !ts.stopped && (len(ts.queue) > 0 || ts.busy) {
+		ts.cond.Wait()
+	}
+}
+
+func (ts *triggerSet) active() bool {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+	return len(ts.triggers) > 0
+}
+
+func (ts *triggerSet) enqueue(changes []Change) {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+	var queued = false
+	for _, change := range changes {
+		for _, trigger := range ts.triggers {
+			if trigger.matches(change) {
+				ts.queue = append(ts.queue, triggerJob{ trigger, change })
+				queued = true
+			}
+		}
+	}
+	if queued {
+		ts.cond.Broadcast()
+	}
+}
+
+// Drops anything queued and waits for a running action
+func (ts *triggerSet) stop() {
+	ts.lock.Lock()
+	if !ts.started || ts.stopped {
+		ts.lock.Unlock()
+		return
+	}
+	ts.stopped = true
+	ts.queue = nil
+	ts.cond.Broadcast()
+	ts.lock.Unlock()
+	<-ts.done
+}
+
+func (trigger *Trigger) matches(change Change) bool {
+	return change.Type == trigger.Type &&
+		change.Link == trigger.Link &&
+		change.Key.HasPrefix(trigger.Prefix) &&
+		(trigger.Match == nil || trigger.Match(change))
+}
+
+func (db *LogeDB) runTriggers() {
+	var ts = &db.triggers
+	defer close(ts.done)
+
+	ts.lock.Lock()
+	for {
+		for len(ts.queue) == 0 && !ts.stopped {
+			ts.busy = false
+			ts.cond.Broadcast()
+			ts.cond.Wait()
+		}
+		if ts.stopped {
+			ts.lock.Unlock()
+			return
+		}
+		var job = ts.queue[0]
+		ts.queue = ts.queue[1:]
+		ts.busy = true
+		ts.lock.Unlock()
+
+		db.runTrigger(job)
+
+		ts.lock.Lock()
+	}
+}
+
+func (db *LogeDB) runTrigger(job triggerJob) {
+	var attempts = job.trigger.Attempts
+	if attempts <= 0 {
+		attempts = defaultTriggerAttempts
+	}
+
+	var delay = job.trigger.Backoff
+	for attempt := 1; ; attempt++ {
+		var err = db.fireTrigger(job)
+		if err == nil {
+			return
+		}
+		if attempt >= attempts {
+			db.deadLetter(DeadLetter{ job.trigger.Name, job.change, attempt, err })
+			return
+		}
+		db.clock.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func (db *LogeDB) fireTrigger(job triggerJob) (err error) {
+	var actionErr error
+	ok, err := db.TryTransact(func (t *Transaction) {
+		defer func() {
+			if r := recover(); r != nil {
+				if rerr, isErr := r.(error); isErr && isLogeError(rerr) {
+					panic(r)
+				}
+				actionErr = fmt.Errorf("Trigger %s: %v", job.trigger.Name, r)
+				if t.state == ACTIVE {
+					t.abandon()
+				}
+			}
+		}()
+		job.trigger.Action(t, job.change)
+	}, job.trigger.Timeout)
+
+	switch {
+	case err != nil:
+		return err
+	case actionErr != nil:
+		return actionErr
+	case !ok:
+		return ErrNotCommitted
+	}
+	return nil
+}
+
+func (db *LogeDB) deadLetter(letter DeadLetter) {
+	var ts = &db.triggers
+	ts.lock.Lock()
+	ts.dead = append(ts.dead, letter)
+	if len(ts.dead) > deadLetterLimit {
+		ts.dead = ts.dead[len(ts.dead) - deadLetterLimit:]
+	}
+	var handler = ts.onDead
+	ts.lock.Unlock()
+
+	if handler != nil {
+		handler(letter)
+	}
+}
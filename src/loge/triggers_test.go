@@ -0,0 +1,86 @@
+package loge
+
+import (
+	"testing"
+)
+
+func TestTriggers(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	defer db.Close()
+	db.CreateType(NewTypeDef("post", 1, &TestObj{}))
+	db.CreateType(NewTypeDef("counter", 1, &TestCounter{}))
+
+	db.AddTrigger(&Trigger{
+		Name: "count",
+		Type: "post",
+		Prefix: "p",
+		Match: func(change Change) bool {
+			return !change.Deleted && change.Object.(*TestObj).Name != "skip"
+		},
+		Action: func(t *Transaction, change Change) {
+			var counter = t.Write("counter", "posts").(*TestCounter)
+			if counter == nil {
+				t.Set("counter", "posts", &TestCounter{ 1 })
+			} else {
+				counter.Value++
+			}
+		},
+	})
+
+	db.Transact(func (t *Transaction) {
+		t.Set("post", "p1", &TestObj{ "One" })
+		t.Set("post", "p2", &TestObj{ "Two" })
+		t.Set("post", "x1", &TestObj{ "Other" })
+		t.Set("post", "p3", &TestObj{ "skip" })
+	}, 0)
+	db.DeleteOne("post", "p1")
+	db.WaitTriggers()
+
+	if count := db.ReadOne("counter", "posts").(*TestCounter).Value; count != 2 {
+		test.Errorf("Trigger ran %d times, not 2", count)
+	}
+
+	var failures = 0
+	var dead = make(chan DeadLetter, 1)
+	db.OnDeadLetter(func(letter DeadLetter) { dead <- letter })
+	db.AddTrigger(&Trigger{
+		Name: "flaky",
+		Type: "post",
+		Attempts: 2,
+		Action: func(t *Transaction, change Change) {
+			failures++
+			if change.Key == "bad" || failures == 1 {
+				panic("boom")
+			}
+			t.Set("post", "seen-" + change.Key, &TestObj{ "Seen" })
+		},
+		Match: func(change Change) bool {
+			return !change.Key.HasPrefix("seen-")
+		},
+	})
+
+	db.SetOne("post", "good", &TestObj{ "Good" })
+	db.WaitTriggers()
+	if !db.ExistsOne("post", "seen-good") {
+		test.Error("Retried trigger didn't commit")
+	}
+
+	db.SetOne("post", "bad", &TestObj{ "Bad" })
+	var letter = <-dead
+	db.WaitTriggers()
+	if letter.Trigger != "flaky" || letter.Change.Key != "bad" || letter.Attempts != 2 || letter.Err == nil {
+		test.Errorf("Wrong dead letter: %+v", letter)
+	}
+	if len(db.DeadLetters()) != 1 {
+		test.Error("Dead letter not kept")
+	}
+
+	if !db.RemoveTrigger("flaky") || db.RemoveTrigger("flaky") {
+		test.Error("Wrong trigger removal")
+	}
+	db.SetOne("post", "later", &TestObj{ "Later" })
+	db.WaitTriggers()
+	if db.ExistsOne("post", "seen-later") {
+		test.Error("Removed trigger ran")
+	}
+}
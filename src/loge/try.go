@@ -0,0 +1,346 @@
+package loge
+
+import (
+	"context"
+	"time"
+)
+
+// Error-returning twins of the panicking API, for servers handling
+// untrusted type names and keys. They return ErrNoSuchType,
+// ErrNoSuchLink, ErrInactive, ErrNotSupported or a *StoreError.
+
+func (db *LogeDB) TryCreateType(def *TypeDef) (typ *logeType, err error) {
+	defer recoverError(&err)
+	return db.CreateType(def), nil
+}
+
+// Like Transact, but a loge error raised inside the actor cancels the
+// transaction and is returned, so the actor can use the terse panicking
+// API. If the last attempt didn't commit, its Err is returned.
+func (db *LogeDB) TryTransact(actor Transactor, timeout time.Duration) (bool, error) {
+	return db.TryTransactContext(context.Background(), actor, timeout)
+}
+
+func (db *LogeDB) TryTransactContext(ctx context.Context, actor Transactor, timeout time.Duration) (bool, error) {
+	return db.tryTransact(ctx, actor, timeout, false, db.retry)
+}
+
+func (db *LogeDB) tryTransact(ctx context.Context, actor Transactor, timeout time.Duration, giveJSON bool, policy RetryPolicy) (ok bool, err error) {
+	var t *Transaction
+	defer func() {
+		var r = recover()
+		if r == nil {
+			return
+		}
+		err = logeError(r)
+		if t != nil && t.state == ACTIVE {
+			t.abandon()
+		}
+	}()
+
+	ok = db.doTransact(ctx, func (trans *Transaction) {
+		t = trans
+		actor(trans)
+	}, timeout, giveJSON, policy)
+	if !ok && t != nil {
+		err = t.Err()
+	}
+	return ok, err
+}
+
+type TransactOptions struct {
+	Timeout time.Duration
+	JSON bool
+	Retry *RetryPolicy // The DB's if nil
+	IdempotencyKey string // See TransactOnce. Skipped calls give T's zero value
+	Isolation IsolationLevel
+}
+
+// Runs actor as a transaction and returns what it computed once it
+// commits. An error from actor cancels the transaction and is returned
+// as-is; otherwise errors are returned as with TryTransact.
+//
+//   count, err := loge.TransactResult(db, func (t *loge.Transaction) (int, error) {
+//       var counter = t.Write("counter", "hits").(*Counter)
+//       counter.Value++
+//       return counter.Value, nil
+//   }, loge.TransactOptions{})
+func TransactResult[T any](db *LogeDB, actor func(*Transaction) (T, error), opts TransactOptions) (T, error) {
+	return TransactResultContext(context.Background(), db, actor, opts)
+}
+
+func TransactResultContext[T any](ctx context.Context, db *LogeDB, actor func(*Transaction) (T, error), opts TransactOptions) (T, error) {
+	var result, zero T
+	var actorErr error
+	var policy = db.retry
+	if opts.Retry != nil {
+		policy = *opts.Retry
+	}
+
+	var run Transactor = func (t *Transaction) {
+		t.SetIsolation(opts.Isolation)
+		result, actorErr = actor(t)
+		if actorErr != nil && t.state == ACTIVE {
+			t.abandon()
+		}
+	}
+	if opts.IdempotencyKey != "" {
+		var once = db.onceActor(opts.IdempotencyKey, run)
+		run = func (t *Transaction) {
+			result = zero // Left over if an earlier attempt conflicted
+			once(t)
+		}
+	}
+
+	ok, err := db.tryTransact(ctx, run, opts.Timeout, opts.JSON, policy)
+
+	switch {
+	case actorErr != nil:
+		return zero, actorErr
+	case err != nil:
+		return zero, err
+	case !ok:
+		return zero, ErrNotCommitted
+	}
+	return result, nil
+}
+
+func (db *LogeDB) TryExistsOne(typeName string, key LogeKey) (exists bool, err error) {
+	_, err = db.TryTransact(func (t *Transaction) {
+		exists = t.Exists(typeName, key)
+	}, 0)
+	return
+}
+
+func (db *LogeDB) TryReadOne(typeName string, key LogeKey) (obj interface{}, err error) {
+	_, err = db.TryTransact(func (t *Transaction) {
+		obj = t.Read(typeName, key)
+	}, 0)
+	return
+}
+
+func (db *LogeDB) TryReadAt(typeName string, key LogeKey, sID uint64) (obj interface{}, err error) {
+	defer recoverError(&err)
+	return db.ReadAt(typeName, key, sID), nil
+}
+
+func (db *LogeDB) TryReadLinksOne(typeName string, linkName string, key LogeKey) (links []LogeKey, err error) {
+	_, err = db.TryTransact(func (t *Transaction) {
+		links = t.ReadLinks(typeName, linkName, key)
+	}, 0)
+	return
+}
+
+func (db *LogeDB) TrySetOne(typeName string, key LogeKey, obj interface{}) error {
+	_, err := db.TryTransact(func (t *Transaction) {
+		t.Set(typeName, key, obj)
+	}, 0)
+	return err
+}
+
+func (db *LogeDB) TryDeleteOne(typeName string, key LogeKey) error {
+	_, err := db.TryTransact(func (t *Transaction) {
+		t.Delete(typeName, key)
+	}, 0)
+	return err
+}
+
+func (db *LogeDB) TryFind(typeName string, linkName string, target LogeKey) (results []LogeKey, err error) {
+	_, err = db.TryTransact(func (t *Transaction) {
+		results = t.Find(typeName, linkName, target).All()
+	}, 0)
+	return
+}
+
+func (db *LogeDB) TryFindSlice(typeName string, linkName string, target LogeKey, from LogeKey, limit int) (results []LogeKey, err error) {
+	_, err = db.TryTransact(func (t *Transaction) {
+		results = t.FindSlice(typeName, linkName, target, from, limit).All()
+	}, 0)
+	return
+}
+
+func (db *LogeDB) TryListSlice(typeName string, from LogeKey, limit int) (results []LogeKey, err error) {
+	_, err = db.TryTransact(func (t *Transaction) {
+		results = t.ListSlice(typeName, from, limit).All()
+	}, 0)
+	return
+}
+
+func (db *LogeDB) TryFindPrefix(typeName string, linkName string, target LogeKey, prefix LogeKey, from LogeKey, limit int) (results []LogeKey, err error) {
+	_, err = db.TryTransact(func (t *Transaction) {
+		results = t.FindPrefix(typeName, linkName, target, prefix, from, limit).All()
+	}, 0)
+	return
+}
+
+func (db *LogeDB) TryListPrefix(typeName string, prefix LogeKey, from LogeKey, limit int) (results []LogeKey, err error) {
+	_, err = db.TryTransact(func (t *Transaction) {
+		results = t.ListPrefix(typeName, prefix, from, limit).All()
+	}, 0)
+	return
+}
+
+func (db *LogeDB) TryBackup(path string) (err error) {
+	defer recoverError(&err)
+	return db.Backup(path)
+}
+
+// -----------------------------------------------
+// Transactions
+// -----------------------------------------------
+
+func (t *Transaction) TryExists(typeName string, key LogeKey) (exists bool, err error) {
+	defer recoverError(&err)
+	return t.Exists(typeName, key), nil
+}
+
+func (t *Transaction) TryExistsMany(typeName string, keys []LogeKey) (exists map[LogeKey]bool, err error) {
+	defer recoverError(&err)
+	return t.ExistsMany(typeName, keys), nil
+}
+
+func (t *Transaction) TryRead(typeName string, key LogeKey) (obj interface{}, err error) {
+	defer recoverError(&err)
+	return t.Read(typeName, key), nil
+}
+
+func (t *Transaction) TryReadMany(typeName string, keys []LogeKey) (objs []interface{}, err error) {
+	defer recoverError(&err)
+	return t.ReadMany(typeName, keys), nil
+}
+
+func (t *Transaction) TryReadOK(typeName string, key LogeKey) (obj interface{}, ok bool, err error) {
+	defer recoverError(&err)
+	obj, ok = t.ReadOK(typeName, key)
+	return obj, ok, nil
+}
+
+func (t *Transaction) TryReadWith(typeName string, key LogeKey, linkNames ...string) (obj interface{}, err error) {
+	defer recoverError(&err)
+	return t.ReadWith(typeName, key, linkNames...), nil
+}
+
+func (t *Transaction) TryReadManyWith(typeName string, keys []LogeKey, linkNames ...string) (objs []interface{}, err error) {
+	defer recoverError(&err)
+	return t.ReadManyWith(typeName, keys, linkNames...), nil
+}
+
+func (t *Transaction) TryRelated(typeName string, linkName string, key LogeKey) (related *Related, err error) {
+	defer recoverError(&err)
+	return t.Related(typeName, linkName, key), nil
+}
+
+func (t *Transaction) TryReadLazy(typeName string, key LogeKey) (obj *LazyObject, err error) {
+	defer recoverError(&err)
+	return t.ReadLazy(typeName, key), nil
+}
+
+func (t *Transaction) TryWrite(typeName string, key LogeKey) (obj interface{}, err error) {
+	defer recoverError(&err)
+	return t.Write(typeName, key), nil
+}
+
+func (t *Transaction) TryWriteLocked(typeName string, key LogeKey) (obj interface{}, err error) {
+	defer recoverError(&err)
+	return t.WriteLocked(typeName, key), nil
+}
+
+func (t *Transaction) TryWriteMany(typeName string, keys []LogeKey) (objs []interface{}, err error) {
+	defer recoverError(&err)
+	return t.WriteMany(typeName, keys), nil
+}
+
+func (t *Transaction) TrySet(typeName string, key LogeKey, obj interface{}) (err error) {
+	defer recoverError(&err)
+	t.Set(typeName, key, obj)
+	return nil
+}
+
+func (t *Transaction) TryDelete(typeName string, key LogeKey) (err error) {
+	defer recoverError(&err)
+	t.Delete(typeName, key)
+	return nil
+}
+
+func (t *Transaction) TryDeleteAll(typeName string, prefix LogeKey) (deleted int, err error) {
+	defer recoverError(&err)
+	return t.DeleteAll(typeName, prefix), nil
+}
+
+func (t *Transaction) TryReadLinks(typeName string, linkName string, key LogeKey) (links []LogeKey, err error) {
+	defer recoverError(&err)
+	return t.ReadLinks(typeName, linkName, key), nil
+}
+
+func (t *Transaction) TryReadLinksPage(typeName string, linkName string, key LogeKey, afterTarget LogeKey, limit int) (links []LogeKey, err error) {
+	defer recoverError(&err)
+	return t.ReadLinksPage(typeName, linkName, key, afterTarget, limit), nil
+}
+
+func (t *Transaction) TryLinkCount(typeName string, linkName string, key LogeKey) (count int, err error) {
+	defer recoverError(&err)
+	return t.LinkCount(typeName, linkName, key), nil
+}
+
+func (t *Transaction) TryHasLink(typeName string, linkName string, key LogeKey, target LogeKey) (has bool, err error) {
+	defer recoverError(&err)
+	return t.HasLink(typeName, linkName, key, target), nil
+}
+
+func (t *Transaction) TryAddLink(typeName string, linkName string, key LogeKey, target LogeKey) (err error) {
+	defer recoverError(&err)
+	t.AddLink(typeName, linkName, key, target)
+	return nil
+}
+
+func (t *Transaction) TryRemoveLink(typeName string, linkName string, key LogeKey, target LogeKey) (err error) {
+	defer recoverError(&err)
+	t.RemoveLink(typeName, linkName, key, target)
+	return nil
+}
+
+func (t *Transaction) TrySetLinks(typeName string, linkName string, key LogeKey, targets []LogeKey) (err error) {
+	defer recoverError(&err)
+	t.SetLinks(typeName, linkName, key, targets)
+	return nil
+}
+
+func (t *Transaction) TryFind(typeName string, linkName string, target LogeKey) (results ResultSet, err error) {
+	defer recoverError(&err)
+	return t.Find(typeName, linkName, target), nil
+}
+
+func (t *Transaction) TryFindSlice(typeName string, linkName string, target LogeKey, from LogeKey, limit int) (results ResultSet, err error) {
+	defer recoverError(&err)
+	return t.FindSlice(typeName, linkName, target, from, limit), nil
+}
+
+func (t *Transaction) TryListSlice(typeName string, from LogeKey, limit int) (results ResultSet, err error) {
+	defer recoverError(&err)
+	return t.ListSlice(typeName, from, limit), nil
+}
+
+func (t *Transaction) TryFindPrefix(typeName string, linkName string, target LogeKey, prefix LogeKey, from LogeKey, limit int) (results ResultSet, err error) {
+	defer recoverError(&err)
+	return t.FindPrefix(typeName, linkName, target, prefix, from, limit), nil
+}
+
+func (t *Transaction) TryListPrefix(typeName string, prefix LogeKey, from LogeKey, limit int) (results ResultSet, err error) {
+	defer recoverError(&err)
+	return t.ListPrefix(typeName, prefix, from, limit), nil
+}
+
+// Errors are Err's when the commit doesn't happen, so false always
+// comes with one
+func (t *Transaction) TryCommit() (bool, error) {
+	return t.TryCommitContext(context.Background())
+}
+
+func (t *Transaction) TryCommitContext(ctx context.Context) (ok bool, err error) {
+	defer recoverError(&err)
+	if t.state != ACTIVE && t.state != CANCELLED {
+		return false, ErrInactive
+	}
+	ok = t.CommitContext(ctx)
+	return ok, t.Err()
+}
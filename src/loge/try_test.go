@@ -0,0 +1,137 @@
+package loge
+
+import (
+	"testing"
+	"errors"
+	"time"
+)
+
+func TestTryErrors(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	var def = NewTypeDef("test", 1, &TestObj{})
+	def.Links = LinkSpec{ "other": "test" }
+	db.CreateType(def)
+
+	if _, err := db.TryReadOne("nope", "one"); !errors.Is(err, ErrNoSuchType) {
+		test.Errorf("Wrong error for missing type: %v", err)
+	}
+	if _, err := db.TryReadLinksOne("test", "nope", "one"); !errors.Is(err, ErrNoSuchLink) {
+		test.Errorf("Wrong error for missing link: %v", err)
+	}
+	if _, err := db.TryFind("test", "other", "one"); !errors.Is(err, ErrNotSupported) {
+		test.Errorf("Wrong error for memstore find: %v", err)
+	}
+	if db.Stats().CachedObjects != 0 {
+		test.Error("Failed transactions left objects cached")
+	}
+
+	if err := db.TrySetOne("test", "one", &TestObj{ "One" }); err != nil {
+		test.Errorf("TrySetOne failed: %v", err)
+	}
+	if obj, err := db.TryReadOne("test", "one"); err != nil || obj.(*TestObj).Name != "One" {
+		test.Errorf("Wrong TryReadOne: %v (%v)", obj, err)
+	}
+
+	var t = db.CreateTransaction()
+	if _, err := t.TryRead("test", "one"); err != nil {
+		test.Errorf("TryRead failed: %v", err)
+	}
+	if ok, err := t.TryCommit(); !ok || err != nil {
+		test.Errorf("TryCommit failed: %v", err)
+	}
+	if _, err := t.TryRead("test", "one"); !errors.Is(err, ErrInactive) {
+		test.Errorf("Wrong error for finished transaction: %v", err)
+	}
+	if _, err := t.TryCommit(); !errors.Is(err, ErrInactive) {
+		test.Errorf("Wrong error for second commit: %v", err)
+	}
+}
+
+func TestTryOtherPanics(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+
+	defer func() {
+		if r := recover(); r != "Oops" {
+			test.Errorf("Wrong panic: %v", r)
+		}
+	}()
+
+	db.TryTransact(func (t *Transaction) {
+		panic("Oops")
+	}, 0)
+	test.Error("Panic swallowed")
+}
+
+func TestTransactResult(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+	db.SetOne("test", "one", &TestObj{ "One" })
+
+	name, err := TransactResult(db, func (t *Transaction) (string, error) {
+		var obj = t.Write("test", "one").(*TestObj)
+		obj.Name += "!"
+		return obj.Name, nil
+	}, TransactOptions{})
+	if err != nil || name != "One!" {
+		test.Errorf("Wrong result: %q (%v)", name, err)
+	}
+
+	var failure = errors.New("Nope")
+	name, err = TransactResult(db, func (t *Transaction) (string, error) {
+		t.Write("test", "one").(*TestObj).Name = "Lost"
+		return "ignored", failure
+	}, TransactOptions{})
+	if err != failure || name != "" {
+		test.Errorf("Wrong failure: %q (%v)", name, err)
+	}
+	if db.ReadOne("test", "one").(*TestObj).Name != "One!" {
+		test.Error("Failed actor's write committed")
+	}
+
+	_, err = TransactResult(db, func (t *Transaction) (bool, error) {
+		return t.Exists("nope", "one"), nil
+	}, TransactOptions{})
+	if !errors.Is(err, ErrNoSuchType) {
+		test.Errorf("Wrong loge error: %v", err)
+	}
+
+	if db.Stats().CachedObjects != 0 {
+		test.Error("Objects left in cache")
+	}
+}
+
+func TestCommitErrors(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+	db.SetOne("test", "one", &TestObj{ "One" })
+
+	var t = db.CreateTransaction()
+	t.Write("test", "one")
+	db.SetOne("test", "one", &TestObj{ "Other" })
+	if err := t.CommitErr(); !errors.Is(err, ErrConflict) || !errors.Is(err, ErrNotCommitted) || t.Err() != err {
+		test.Errorf("Wrong error for conflict: %v", err)
+	}
+
+	t = db.CreateTransaction()
+	if t.Err() != nil {
+		test.Errorf("Error on active transaction: %v", t.Err())
+	}
+	t.Cancel()
+	if ok, err := t.TryCommit(); ok || !errors.Is(err, ErrAborted) {
+		test.Errorf("Wrong error for cancelled commit: %v", err)
+	}
+
+	t = db.CreateTransaction()
+	if err := t.CommitErr(); err != nil || t.Err() != nil {
+		test.Errorf("Error on commit: %v", err)
+	}
+
+	var ok, err = db.TryTransact(func (t *Transaction) {
+		t.Write("test", "one")
+		db.SetOne("test", "one", &TestObj{ "Again" })
+	}, time.Nanosecond)
+	if ok || !errors.Is(err, ErrConflict) {
+		test.Errorf("Wrong error for conflicted TryTransact: %v", err)
+	}
+}
@@ -13,8 +13,32 @@ type TypeDef struct {
 	Exemplar interface{}
 	Links LinkSpec
 	Upgrader spack.UpgradeFunc
+	Merger MergeFunc
+	// By the version each upgrades from, for objects stored at earlier
+	// versions. Without an Upgrader those are read by field name, run
+	// through the upgraders from their version on, e.g. 1 then 2 for a
+	// version 3 type, then have fields renamed, so fields can also come
+	// and go (see evolve). Codec types get these if their codec can
+	// unmarshal into an interface{}, as JSON, MessagePack and CBOR can.
+	Upgraders map[uint16]RecordUpgrader
+	// Old field name to new
+	Renames map[string]string
+	Validate ValidateFunc
+	// If nil, the exemplar's own MarshalLoge and UnmarshalLoge if it has
+	// them, ProtobufCodec for proto.Message exemplars, otherwise the DB's
+	// (see SetCodec)
+	Codec Codec
 }
 
+// Takes an object stored at one version, by field name, to the next
+type RecordUpgrader func(record map[string]interface{}) (map[string]interface{}, error)
+
+// Combines a transaction's write with a version committed since the
+// transaction started: base is what the transaction saw, ours is what
+// it wrote, current is what's there now. Types with a merger don't
+// abort on write conflicts.
+type MergeFunc func(base interface{}, ours interface{}, current interface{}) interface{}
+
 func NewTypeDef(name string, version uint16, exemplar interface{}) *TypeDef {
 	return &TypeDef {
 		Name: name,
@@ -34,6 +58,14 @@ type logeType struct {
 	Exemplar interface{}
 	SpackType *spack.VersionedType
 	Links map[string]*linkInfo
+	Merger MergeFunc
+	// Nil for spack
+	Codec Codec
+	Renames map[string]string
+	Upgraders map[uint16]RecordUpgrader
+	Validate ValidateFunc
+	// No upgrader, so objects from earlier versions are read by name
+	Evolve bool
 }
 
 func newType(name string, version uint16, exemplar interface{}, linkSpec LinkSpec, spackType *spack.VersionedType) *logeType {
@@ -42,7 +74,6 @@ func newType(name string, version uint16, exemplar interface{}, linkSpec LinkSpe
 		infos[k] = &linkInfo{
 			Name: k,
 			Target: v,
-			Tag: 1,
 		}
 	}
 
@@ -59,6 +90,10 @@ func (t *logeType) NilValue() interface{} {
 	return reflect.Zero(reflect.TypeOf(t.Exemplar)).Interface()
 }
 
+func (t *logeType) NewValue() interface{} {
+	return reflect.New(reflect.TypeOf(t.Exemplar).Elem()).Interface()
+}
+
 func (t *logeType) Decode(enc []byte, toJSON bool) (interface{}, bool) {
 	if len(enc) == 0 {
 		if toJSON {
@@ -68,15 +103,25 @@ func (t *logeType) Decode(enc []byte, toJSON bool) (interface{}, bool) {
 		}
 	}
 
+	if t.Codec != nil {
+		return t.codecDecode(enc, toJSON)
+	}
+	if t.evolves(enc) {
+		return t.spackEvolve(enc, toJSON), true
+	}
+
 	obj, upgraded, err := t.SpackType.DecodeObj(enc, toJSON)
 	if err != nil {
-		panic(fmt.Sprintf("Decode error: %v", err))
+		panic(storeError("Decode error: %v", err))
 	}
 	
 	return obj, upgraded
 }
 
 func (t *logeType) Encode(obj interface{}) []byte {
+	if t.Codec != nil {
+		return t.codecEncode(obj)
+	}
 	enc, err := t.SpackType.EncodeObj(obj)
 	if err != nil {
 		panic(fmt.Sprintf("Encode error: %v", err))
@@ -1,6 +1,11 @@
 package loge
 
-import "testing"
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
 
 func TestSimpleUpdate(test *testing.T) {
 	var db = NewLogeDB(NewMemStore())
@@ -141,4 +146,107 @@ func TestUpdateConflict(test *testing.T) {
 			test.Error("Wrong name after update")
 		}
 	}, 0)
-}
\ No newline at end of file
+}
+
+// The object leaves the cache between trans2's commit and trans1's
+// write, but trans1 still mustn't overwrite it
+func TestConflictAfterEviction(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+	db.SetOne("test", "one", &TestObj{Name: "One"})
+
+	var trans1 = db.CreateTransaction()
+	db.SetOne("test", "one", &TestObj{Name: "Two Update"})
+	if db.Stats().CachedObjects != 0 {
+		test.Fatal("Object not evicted")
+	}
+
+	trans1.Set("test", "one", &TestObj{Name: "One Update"})
+	if trans1.Commit() {
+		test.Error("Commit over evicted object succeeded")
+	}
+}
+
+func TestReadMany(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+
+	var keys []LogeKey
+	db.Transact(func (t *Transaction) {
+		for i := 0; i < 50; i++ {
+			var key = LogeKey(fmt.Sprintf("obj%d", i))
+			keys = append(keys, key)
+			t.Set("test", key, &TestObj{ string(key) })
+		}
+	}, 0)
+	keys = append(keys, "missing", "obj0")
+
+	db.Transact(func (t *Transaction) {
+		t.Write("test", "obj1").(*TestObj).Name = "changed"
+		var objs = t.ReadMany("test", keys)
+		if len(objs) != len(keys) {
+			test.Fatalf("Wrong count: %d", len(objs))
+		}
+		if objs[1].(*TestObj).Name != "changed" {
+			test.Error("ReadMany didn't see the transaction's write")
+		}
+		if objs[2].(*TestObj).Name != "obj2" || objs[len(keys) - 1].(*TestObj).Name != "obj0" {
+			test.Error("Wrong objects")
+		}
+		if objs[len(keys) - 2].(*TestObj) != nil {
+			test.Error("Missing object isn't nil")
+		}
+	}, 0)
+
+	if _, err := db.CreateTransaction().TryReadMany("nope", keys); !errors.Is(err, ErrNoSuchType) {
+		test.Errorf("Wrong error for TryReadMany: %v", err)
+	}
+
+	if db.Stats().CachedObjects != 0 {
+		test.Error("ReadMany leaked cached objects")
+	}
+}
+
+func TestExistsMany(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+	db.SetOne("test", "one", &TestObj{ "One" })
+	db.SetOne("test", "two", &TestObj{ "Two" })
+
+	db.Transact(func (t *Transaction) {
+		t.Delete("test", "two")
+		t.Set("test", "three", &TestObj{ "Three" })
+
+		var exists = t.ExistsMany("test", []LogeKey{ "one", "two", "three", "four" })
+		var want = map[LogeKey]bool{ "one": true, "two": false, "three": true, "four": false }
+		if !reflect.DeepEqual(exists, want) {
+			test.Errorf("Wrong existence: %v", exists)
+		}
+	}, 0)
+
+	if _, err := db.CreateTransaction().TryExistsMany("nope", []LogeKey{ "one" }); !errors.Is(err, ErrNoSuchType) {
+		test.Errorf("Wrong error for TryExistsMany: %v", err)
+	}
+}
+
+func TestReadOK(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	db.CreateType(NewTypeDef("test", 1, &TestObj{}))
+	db.SetOne("test", "empty", &TestObj{})
+
+	db.Transact(func (t *Transaction) {
+		if obj, ok := t.ReadOK("test", "empty"); !ok || obj.(*TestObj).Name != "" {
+			test.Errorf("Zero-valued object: %v, %v", obj, ok)
+		}
+		if obj, ok := t.ReadOK("test", "missing"); ok || obj != nil {
+			test.Errorf("Missing object: %v, %v", obj, ok)
+		}
+		if _, ok := Collection[TestObj](db, "test").ReadOK(t, "empty"); !ok {
+			test.Error("Typed ReadOK missed the object")
+		}
+	}, 0)
+
+	if _, _, err := db.CreateTransaction().TryReadOK("nope", "empty"); !errors.Is(err, ErrNoSuchType) {
+		test.Errorf("Wrong error for TryReadOK: %v", err)
+	}
+}
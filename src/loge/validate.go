@@ -0,0 +1,47 @@
+package loge
+
+import (
+	"fmt"
+)
+
+// Checks an object of the type before any commit writes it, whichever
+// code wrote it; an error stops the commit, which Err then reports as a
+// *ValidationError. Deletes aren't checked. JSON transactions' objects
+// are decoded to the exemplar's type first.
+type ValidateFunc func(obj interface{}) error
+
+type ValidationError struct {
+	Type string
+	Key LogeKey
+	Err error
+}
+
+func (err *ValidationError) Error() string {
+	return fmt.Sprintf("Invalid %s/%s: %v", err.Type, err.Key, err.Err)
+}
+
+func (err *ValidationError) Unwrap() error {
+	return err.Err
+}
+
+// Run by tryCommit once the versions are locked and merged
+func (t *Transaction) validate(versions []*liveVersion) error {
+	for _, lv := range versions {
+		var obj = lv.version.LogeObj
+		if !lv.dirty || obj.LinkName != "" || obj.Type.Validate == nil {
+			continue
+		}
+		if lv.object == nil || !obj.hasValue(lv.object) {
+			continue
+		}
+
+		var object = lv.object
+		if t.giveJSON {
+			object, _ = obj.decode(obj.encode(object), false)
+		}
+		if err := obj.Type.Validate(object); err != nil {
+			return &ValidationError{ obj.Type.Name, obj.Key, err }
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package loge
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidate(test *testing.T) {
+	var db = NewLogeDB(NewMemStore())
+	var def = NewTypeDef("test", 1, &TestObj{})
+	var empty = errors.New("Empty name")
+	def.Validate = func (obj interface{}) error {
+		if obj.(*TestObj).Name == "" {
+			return empty
+		}
+		return nil
+	}
+	db.CreateType(def)
+	db.SetOne("test", "one", &TestObj{ "One" })
+
+	var attempts = 0
+	var ok, err = db.TryTransact(func (t *Transaction) {
+		attempts++
+		t.Write("test", "one").(*TestObj).Name = ""
+		t.Set("test", "two", &TestObj{ "Two" })
+	}, 0)
+	var verr *ValidationError
+	if ok || !errors.As(err, &verr) || verr.Key != "one" || !errors.Is(err, empty) || attempts != 1 {
+		test.Errorf("Wrong validation failure: %v (%d attempts)", err, attempts)
+	}
+	if db.ReadOne("test", "one").(*TestObj).Name != "One" || db.ExistsOne("test", "two") {
+		test.Error("Invalid transaction written")
+	}
+
+	ok = db.TransactJSON(func (t *Transaction) {
+		t.Set("test", "two", map[string]interface{}{ "Name": "" })
+	}, 0)
+	if ok {
+		test.Error("Invalid JSON transaction committed")
+	}
+
+	db.Transact(func (t *Transaction) {
+		t.Delete("test", "one")
+	}, 0)
+	if db.ExistsOne("test", "one") {
+		test.Error("Delete not committed")
+	}
+}
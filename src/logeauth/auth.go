@@ -0,0 +1,195 @@
+package logeauth
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+)
+
+type Operation string
+
+const (
+	OpRead Operation = "read"
+	OpWrite Operation = "write"
+	OpDelete Operation = "delete"
+	OpLink Operation = "link"
+	OpList Operation = "list"
+	OpFind Operation = "find"
+	OpAdmin Operation = "admin"
+)
+
+// What a server could learn about a caller. Certificates is the client
+// certificate's verified chain, leaf first. Servers take it from the
+// connection's VerifiedChains, so it's empty unless the TLS config has
+// verified the certificate: with RequestClientCert or
+// RequireAnyClientCert a client can present any certificate it likes.
+type Credentials struct {
+	Token string
+	Certificates []*x509.Certificate
+}
+
+type Principal struct {
+	Name string
+	Groups []string
+}
+
+type Authenticator interface {
+	Authenticate(creds Credentials) (*Principal, error)
+}
+
+// typeName is empty for operations not tied to a type
+type Authorizer interface {
+	Authorize(principal *Principal, op Operation, typeName string) error
+}
+
+var ErrUnauthenticated = errors.New("Not authenticated")
+
+type ForbiddenError struct {
+	Principal string
+	Op Operation
+	Type string
+}
+
+func (err *ForbiddenError) Error() string {
+	if err.Type == "" {
+		return fmt.Sprintf("%s may not %s", err.Principal, err.Op)
+	}
+	return fmt.Sprintf("%s may not %s %s", err.Principal, err.Op, err.Type)
+}
+
+func IsForbidden(err error) bool {
+	_, ok := err.(*ForbiddenError)
+	return ok
+}
+
+// -----------------------------------------------
+// Guard
+// -----------------------------------------------
+
+// Servers hold one of these. A nil Authorizer lets any authenticated
+// principal do anything.
+type Guard struct {
+	Authenticator Authenticator
+	Authorizer Authorizer
+}
+
+func (g *Guard) Authenticate(creds Credentials) (*Principal, error) {
+	if g.Authenticator == nil {
+		return nil, ErrUnauthenticated
+	}
+	return g.Authenticator.Authenticate(creds)
+}
+
+func (g *Guard) Check(creds Credentials, op Operation, typeName string) (*Principal, error) {
+	principal, err := g.Authenticate(creds)
+	if err != nil {
+		return nil, err
+	}
+	if g.Authorizer != nil {
+		if err := g.Authorizer.Authorize(principal, op, typeName); err != nil {
+			return nil, err
+		}
+	}
+	return principal, nil
+}
+
+// -----------------------------------------------
+// Authenticators
+// -----------------------------------------------
+
+// Static bearer tokens
+type TokenAuthenticator map[string]*Principal
+
+func (tokens TokenAuthenticator) Authenticate(creds Credentials) (*Principal, error) {
+	if principal, ok := tokens[creds.Token]; ok && creds.Token != "" {
+		return principal, nil
+	}
+	return nil, ErrUnauthenticated
+}
+
+// Client certificates, named by subject CommonName. Groups come from
+// the certificate's OrganizationalUnit.
+type CertAuthenticator struct{}
+
+func (CertAuthenticator) Authenticate(creds Credentials) (*Principal, error) {
+	if len(creds.Certificates) == 0 || creds.Certificates[0].Subject.CommonName == "" {
+		return nil, ErrUnauthenticated
+	}
+	var subject = creds.Certificates[0].Subject
+	return &Principal{
+		Name: subject.CommonName,
+		Groups: subject.OrganizationalUnit,
+	}, nil
+}
+
+// Tries each in turn
+type MultiAuthenticator []Authenticator
+
+func (auths MultiAuthenticator) Authenticate(creds Credentials) (*Principal, error) {
+	for _, auth := range auths {
+		if principal, err := auth.Authenticate(creds); err == nil {
+			return principal, nil
+		}
+	}
+	return nil, ErrUnauthenticated
+}
+
+// -----------------------------------------------
+// Policies
+// -----------------------------------------------
+
+// Who may match a principal name or "group:<name>"; "*" matches anything
+// in any field.
+type Rule struct {
+	Who []string
+	Types []string
+	Ops []Operation
+}
+
+// Allows an operation if any rule matches it
+type Policy []Rule
+
+func (policy Policy) Authorize(principal *Principal, op Operation, typeName string) error {
+	for _, rule := range policy {
+		if rule.matches(principal, op, typeName) {
+			return nil
+		}
+	}
+	return &ForbiddenError{
+		Principal: principal.Name,
+		Op: op,
+		Type: typeName,
+	}
+}
+
+func (rule Rule) matches(principal *Principal, op Operation, typeName string) bool {
+	var who = false
+	for _, name := range rule.Who {
+		if name == "*" || name == principal.Name {
+			who = true
+		}
+		for _, group := range principal.Groups {
+			if name == "group:" + group {
+				who = true
+			}
+		}
+	}
+
+	var ops = false
+	for _, ruleOp := range rule.Ops {
+		if ruleOp == "*" || ruleOp == op {
+			ops = true
+		}
+	}
+
+	// Operations without a type, such as admin, only match rules which
+	// aren't limited to some types
+	var types = typeName == "" && len(rule.Types) == 0
+	for _, ruleType := range rule.Types {
+		if ruleType == "*" || ruleType == typeName {
+			types = true
+		}
+	}
+
+	return who && ops && types
+}
@@ -0,0 +1,77 @@
+package logeauth
+
+import (
+	"testing"
+	"crypto/x509"
+	"crypto/x509/pkix"
+)
+
+func testGuard() *Guard {
+	return &Guard{
+		Authenticator: MultiAuthenticator{
+			TokenAuthenticator{
+				"secret": &Principal{ Name: "alice" },
+			},
+			CertAuthenticator{},
+		},
+		Authorizer: Policy{
+			{ Who: []string{"alice"}, Types: []string{"*"}, Ops: []Operation{"*"} },
+			{ Who: []string{"group:readers"}, Types: []string{"person"}, Ops: []Operation{OpRead, OpFind} },
+		},
+	}
+}
+
+func TestGuard(test *testing.T) {
+	var guard = testGuard()
+
+	if _, err := guard.Check(Credentials{ Token: "wrong" }, OpRead, "person"); err != ErrUnauthenticated {
+		test.Errorf("Bad token accepted: %v", err)
+	}
+
+	principal, err := guard.Check(Credentials{ Token: "secret" }, OpDelete, "pet")
+	if err != nil || principal.Name != "alice" {
+		test.Errorf("Token principal rejected: %v", err)
+	}
+
+	var cert = &x509.Certificate{
+		Subject: pkix.Name{ CommonName: "bob", OrganizationalUnit: []string{"readers"} },
+	}
+	var creds = Credentials{ Certificates: []*x509.Certificate{cert} }
+
+	if _, err := guard.Check(creds, OpRead, "person"); err != nil {
+		test.Errorf("Certificate reader rejected: %v", err)
+	}
+
+	_, err = guard.Check(creds, OpWrite, "person")
+	if !IsForbidden(err) || err.Error() != "bob may not write person" {
+		test.Errorf("Wrong error for forbidden write: %v", err)
+	}
+
+	if _, err := guard.Check(creds, OpRead, "pet"); !IsForbidden(err) {
+		test.Errorf("Read of other type allowed: %v", err)
+	}
+}
+
+func TestTypelessOperations(test *testing.T) {
+	var policy = Policy{
+		{ Who: []string{"alice"}, Types: []string{"post"}, Ops: []Operation{"*"} },
+		{ Who: []string{"ops"}, Ops: []Operation{OpAdmin} },
+		{ Who: []string{"root"}, Types: []string{"*"}, Ops: []Operation{"*"} },
+	}
+	var alice = &Principal{ Name: "alice" }
+
+	if err := policy.Authorize(alice, OpAdmin, ""); !IsForbidden(err) {
+		test.Errorf("Type-scoped rule allowed admin: %v", err)
+	}
+	if err := policy.Authorize(alice, OpWrite, "post"); err != nil {
+		test.Errorf("Type-scoped rule denied its type: %v", err)
+	}
+	for _, name := range []string{ "ops", "root" } {
+		if err := policy.Authorize(&Principal{ Name: name }, OpAdmin, ""); err != nil {
+			test.Errorf("%s denied admin: %v", name, err)
+		}
+	}
+	if err := policy.Authorize(&Principal{ Name: "ops" }, OpAdmin, "post"); !IsForbidden(err) {
+		test.Errorf("Typeless rule allowed a type: %v", err)
+	}
+}
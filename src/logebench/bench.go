@@ -0,0 +1,271 @@
+// Standard workloads run against several stores, for picking one on
+// numbers:
+//
+//   var backends, _ = logebench.ParseBackends([]string{ "memory", "leveldb" })
+//   logebench.Compare(backends, logebench.Workloads, 10000).Print(os.Stdout)
+//
+// Each workload gets a fresh store in a temporary directory.
+package logebench
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"loge"
+)
+
+type Backend struct {
+	Name string
+	Open func(dir string) loge.LogeStore
+}
+
+// Stores the bench command knows by name. Packages providing other
+// stores can add theirs.
+var Backends = map[string]Backend{
+	"memory": { "memory", func(dir string) loge.LogeStore { return loge.NewMemStore() } },
+	"leveldb": { "leveldb", func(dir string) loge.LogeStore { return loge.NewLevelDBStore(dir) } },
+	"rocksdb": { "rocksdb", func(dir string) loge.LogeStore { return loge.NewRocksDBStore(dir) } },
+	"bolt": { "bolt", func(dir string) loge.LogeStore { return loge.NewBoltStore(filepath.Join(dir, "loge.db")) } },
+	"log": { "log", func(dir string) loge.LogeStore { return loge.NewLogStore(filepath.Join(dir, "loge.log"), nil) } },
+	"badger": { "badger", func(dir string) loge.LogeStore { return loge.NewBadgerStore(dir) } },
+	"mmap": { "mmap", func(dir string) loge.LogeStore { return loge.NewMmapStore(dir) } },
+	"tiered": { "tiered", func(dir string) loge.LogeStore { return loge.NewTieredStore(loge.NewLevelDBStore(dir), nil) } },
+	"zstd": { "zstd", func(dir string) loge.LogeStore { return loge.NewCompressedStore(loge.NewLevelDBStore(dir), loge.CompressZstd, 256) } },
+	"sqlite": { "sqlite", func(dir string) loge.LogeStore { return loge.NewSQLiteStore(filepath.Join(dir, "loge.sqlite")) } },
+}
+
+type Workload struct {
+	Name string
+	Run func(db *loge.LogeDB, ops int)
+}
+
+var Workloads = []Workload{
+	{ "write", runWrite },
+	{ "batch-write", runBatchWrite },
+	{ "read", runRead },
+	{ "contended", runContended },
+	{ "links", runLinks },
+}
+
+// One cell of the table: zero Duration with Err set if the workload
+// failed, e.g. with ErrNotSupported
+type Result struct {
+	Backend string
+	Workload string
+	Ops int
+	Duration time.Duration
+	Err error
+}
+
+func (r Result) OpsPerSecond() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Ops) / r.Duration.Seconds()
+}
+
+type Results []Result
+
+func ParseBackends(names []string) ([]Backend, error) {
+	var backends = make([]Backend, 0, len(names))
+	for _, name := range names {
+		backend, ok := Backends[name]
+		if !ok {
+			return nil, fmt.Errorf("Unknown backend: %s (have %s)", name, strings.Join(backendNames(), ", "))
+		}
+		backends = append(backends, backend)
+	}
+	return backends, nil
+}
+
+func Compare(backends []Backend, workloads []Workload, ops int) Results {
+	var results Results
+	for _, workload := range workloads {
+		for _, backend := range backends {
+			results = append(results, runOne(backend, workload, ops))
+		}
+	}
+	return results
+}
+
+func runOne(backend Backend, workload Workload, ops int) (result Result) {
+	result = Result{ Backend: backend.Name, Workload: workload.Name, Ops: ops }
+
+	dir, err := ioutil.TempDir("", "logebench")
+	if err != nil {
+		result.Err = err
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	var db = loge.NewLogeDB(backend.Open(dir))
+	defer db.Close()
+	setupTypes(db)
+
+	defer func() {
+		if r := recover(); r != nil {
+			result.Duration = 0
+			if err, ok := r.(error); ok {
+				result.Err = err
+			} else {
+				result.Err = fmt.Errorf("%v", r)
+			}
+		}
+	}()
+
+	var start = time.Now()
+	workload.Run(db, ops)
+	result.Duration = time.Since(start)
+	return
+}
+
+// Operations per second, workloads down and backends across
+func (results Results) Print(out io.Writer) {
+	var backends []string
+	var workloads []string
+	var cells = make(map[string]Result)
+	for _, r := range results {
+		if !contains(backends, r.Backend) {
+			backends = append(backends, r.Backend)
+		}
+		if !contains(workloads, r.Workload) {
+			workloads = append(workloads, r.Workload)
+		}
+		cells[r.Workload + "/" + r.Backend] = r
+	}
+
+	var w = tabwriter.NewWriter(out, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "ops/s\t%s\t\n", strings.Join(backends, "\t"))
+	for _, workload := range workloads {
+		var row = []string{ workload }
+		for _, backend := range backends {
+			var r = cells[workload + "/" + backend]
+			switch {
+			case errors.Is(r.Err, loge.ErrNotSupported):
+				row = append(row, "n/a")
+			case r.Err != nil:
+				row = append(row, "error")
+			default:
+				row = append(row, fmt.Sprintf("%.0f", r.OpsPerSecond()))
+			}
+		}
+		fmt.Fprintf(w, "%s\t\n", strings.Join(row, "\t"))
+	}
+	w.Flush()
+
+	for _, r := range results {
+		if r.Err != nil && !errors.Is(r.Err, loge.ErrNotSupported) {
+			fmt.Fprintf(out, "%s on %s: %v\n", r.Workload, r.Backend, r.Err)
+		}
+	}
+}
+
+// -----------------------------------------------
+// Workloads
+// -----------------------------------------------
+
+type benchRecord struct {
+	Name string
+	Count int
+}
+
+func setupTypes(db *loge.LogeDB) {
+	var def = loge.NewTypeDef("record", 1, &benchRecord{})
+	def.Links = loge.LinkSpec{ "tag": "record" }
+	db.CreateType(def)
+}
+
+func benchKey(i int) loge.LogeKey {
+	return loge.LogeKey(fmt.Sprintf("r%08d", i))
+}
+
+func runWrite(db *loge.LogeDB, ops int) {
+	for i := 0; i < ops; i++ {
+		db.SetOne("record", benchKey(i), &benchRecord{ Name: "record", Count: i })
+	}
+}
+
+func runBatchWrite(db *loge.LogeDB, ops int) {
+	const batch = 100
+	for start := 0; start < ops; start += batch {
+		db.Transact(func (t *loge.Transaction) {
+			for i := start; i < start + batch && i < ops; i++ {
+				t.Set("record", benchKey(i), &benchRecord{ Name: "record", Count: i })
+			}
+		}, 0)
+	}
+}
+
+// Over keys written first, in the same way for every backend
+func runRead(db *loge.LogeDB, ops int) {
+	const keys = 1000
+	runBatchWrite(db, keys)
+	for i := 0; i < ops; i++ {
+		db.ReadOne("record", benchKey(i % keys))
+	}
+}
+
+// Workers incrementing a handful of shared counters
+func runContended(db *loge.LogeDB, ops int) {
+	const workers, counters = 8, 4
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < ops; i += workers {
+				var key = benchKey(i % counters)
+				db.Transact(func (t *loge.Transaction) {
+					var rec = t.Write("record", key).(*benchRecord)
+					if rec == nil {
+						t.Set("record", key, &benchRecord{ Count: 1 })
+					} else {
+						rec.Count++
+					}
+				}, 0)
+			}
+		}(w)
+	}
+	wg.Wait()
+}
+
+// Half link writes, half reverse lookups
+func runLinks(db *loge.LogeDB, ops int) {
+	const tags = 10
+	for i := 0; i < ops; i++ {
+		if i % 2 == 0 {
+			db.Transact(func (t *loge.Transaction) {
+				t.AddLink("record", "tag", benchKey(i), benchKey(i % tags))
+			}, 0)
+		} else {
+			db.Find("record", "tag", benchKey(i % tags))
+		}
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func backendNames() []string {
+	var names = make([]string, 0, len(Backends))
+	for name := range Backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
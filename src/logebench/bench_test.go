@@ -0,0 +1,35 @@
+package logebench
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCompare(test *testing.T) {
+	var backends, err = ParseBackends([]string{ "memory", "leveldb" })
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	var results = Compare(backends, Workloads, 200)
+	if len(results) != len(Workloads) * 2 {
+		test.Fatalf("Wrong result count: %d", len(results))
+	}
+
+	var out bytes.Buffer
+	results.Print(&out)
+	var table = out.String()
+	for _, want := range []string{ "memory", "leveldb", "batch-write", "contended", "n/a" } {
+		if !strings.Contains(table, want) {
+			test.Errorf("Missing %q in table:\n%s", want, table)
+		}
+	}
+	if strings.Contains(table, "error") {
+		test.Errorf("Workload failed:\n%s", table)
+	}
+
+	if _, err := ParseBackends([]string{ "floppy" }); err == nil {
+		test.Error("Unknown backend accepted")
+	}
+}
@@ -0,0 +1,38 @@
+package logecli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+
+	"logebench"
+)
+
+// Runs the standard workloads against each named backend (all known
+// ones by default) and prints a table of operations per second
+func Bench(args []string, out io.Writer) error {
+	var flags = flag.NewFlagSet("bench", flag.ContinueOnError)
+	flags.SetOutput(out)
+	var ops = flags.Int("ops", 10000, "Operations per workload")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var names = flags.Args()
+	if len(names) == 0 {
+		for name := range logebench.Backends {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	backends, err := logebench.ParseBackends(names)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "%d operations per workload\n\n", *ops)
+	logebench.Compare(backends, logebench.Workloads, *ops).Print(out)
+	return nil
+}
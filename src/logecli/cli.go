@@ -0,0 +1,408 @@
+package logecli
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"loge"
+)
+
+// Command-line inspection and maintenance for a loge database. Objects
+// are Go types, so the application provides a tiny main that registers
+// them:
+//
+//   func main() {
+//       logecli.Main(func(db *loge.LogeDB) {
+//           db.CreateType(loge.NewTypeDef("person", 1, &Person{}))
+//       })
+//   }
+//
+// and then:
+//
+//   mytool -store data/mydb get person brendon
+//   mytool -store data/mydb shell
+//
+// With -remote, commands go to a logehttp server instead. "bench" needs
+// neither; see Bench.
+
+const restoreBatchSize = 1000
+
+type SetupFunc func(*loge.LogeDB)
+
+type command struct {
+	usage string
+	minArgs int
+	run func(db *loge.LogeDB, args []string, in io.Reader, out io.Writer)
+}
+
+var commands = map[string]command{
+	"types": { "types", 0, cmdTypes },
+	"get": { "get <type> <key>", 2, cmdGet },
+	"set": { "set <type> <key> [json]  (reads stdin without json)", 2, cmdSet },
+	"delete": { "delete <type> <key>", 2, cmdDelete },
+	"list": { "list <type> [from] [limit]", 1, cmdList },
+	"links": { "links <type> <link> <key>", 3, cmdLinks },
+	"link": { "link <type> <link> <key> <target>", 4, cmdLink },
+	"unlink": { "unlink <type> <link> <key> <target>", 4, cmdUnlink },
+	"find": { "find <type> <link> <target> [from] [limit]", 3, cmdFind },
+	"dump": { "dump [type...]  (JSON lines to stdout)", 0, cmdDump },
+	"restore": { "restore  (JSON lines from stdin)", 0, cmdRestore },
+	"compact": { "compact", 0, cmdCompact },
+	"migrate": { "migrate [type...]  (rewrites objects in their current encoding)", 0, cmdMigrate },
+}
+
+type dumpRecord struct {
+	Type string `json:"type"`
+	Key loge.LogeKey `json:"key"`
+	Object json.RawMessage `json:"object"`
+	Links map[string][]loge.LogeKey `json:"links,omitempty"`
+}
+
+func Main(setup SetupFunc) {
+	var flags = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	var storePath = flags.String("store", "", "LevelDB store path")
+	var remoteURL = flags.String("remote", "", "logehttp server URL, instead of -store")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s (-store <path> | -remote <url>) <command> [args]\n\nCommands:\n", os.Args[0])
+		printHelp(os.Stderr)
+		fmt.Fprintf(os.Stderr, "  shell\n")
+		fmt.Fprintf(os.Stderr, "  bench [-ops n] [backend...]\n")
+	}
+	flags.Parse(os.Args[1:])
+
+	if flags.Arg(0) == "bench" {
+		if err := Bench(flags.Args()[1:], os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if (*storePath == "") == (*remoteURL == "") || flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	var run Runner
+	var db *loge.LogeDB
+	if *remoteURL != "" {
+		run = Remote(*remoteURL)
+	} else {
+		db = loge.NewLogeDB(loge.NewLevelDBStore(*storePath))
+		setup(db)
+		run = Local(db)
+	}
+
+	var args = flags.Args()
+	var err error
+	switch args[0] {
+	case "shell":
+		err = Shell(run)
+	case "watch":
+		err = Watch(run, args[1:], os.Stdout)
+	default:
+		err = run(args, os.Stdin, os.Stdout)
+	}
+
+	if db != nil {
+		db.Close()
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
+
+func Run(db *loge.LogeDB, args []string, in io.Reader, out io.Writer) (err error) {
+	if len(args) == 0 {
+		return errors.New("No command given")
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("Unknown command: %s", args[0])
+	}
+
+	if len(args) - 1 < cmd.minArgs {
+		return fmt.Errorf("Usage: %s", cmd.usage)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%s failed: %v", args[0], r)
+		}
+	}()
+
+	cmd.run(db, args[1:], in, out)
+	return nil
+}
+
+// -----------------------------------------------
+// Commands
+// -----------------------------------------------
+
+func cmdTypes(db *loge.LogeDB, args []string, in io.Reader, out io.Writer) {
+	for _, typ := range db.Types() {
+		fmt.Fprintf(out, "%s (v%d)\n", typ.Name, typ.Version)
+		for name, info := range typ.Links {
+			fmt.Fprintf(out, "  %s -> %s\n", name, info.Target)
+		}
+	}
+}
+
+func cmdGet(db *loge.LogeDB, args []string, in io.Reader, out io.Writer) {
+	var typeName = checkType(db, args[0])
+	var key = loge.LogeKey(args[1])
+
+	var obj interface{}
+	var found bool
+	db.Transact(func (t *loge.Transaction) {
+		found = t.Exists(typeName, key)
+		obj = t.Read(typeName, key)
+	}, 0)
+
+	if !found {
+		panic(fmt.Sprintf("No such object: %s/%s", typeName, key))
+	}
+	writeJSON(out, obj)
+}
+
+func cmdSet(db *loge.LogeDB, args []string, in io.Reader, out io.Writer) {
+	var typeName = checkType(db, args[0])
+
+	var enc []byte
+	if len(args) > 2 {
+		enc = []byte(args[2])
+	} else {
+		var err error
+		enc, err = ioutil.ReadAll(in)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	var obj = decodeObject(db, typeName, enc)
+	db.SetOne(typeName, loge.LogeKey(args[1]), obj)
+}
+
+func cmdDelete(db *loge.LogeDB, args []string, in io.Reader, out io.Writer) {
+	db.DeleteOne(checkType(db, args[0]), loge.LogeKey(args[1]))
+}
+
+func cmdList(db *loge.LogeDB, args []string, in io.Reader, out io.Writer) {
+	var from, limit = sliceArgs(args[1:])
+	writeKeys(out, db.ListSlice(checkType(db, args[0]), from, limit))
+}
+
+func cmdLinks(db *loge.LogeDB, args []string, in io.Reader, out io.Writer) {
+	var typeName = checkType(db, args[0])
+	var linkName = checkLink(db, typeName, args[1])
+	for _, key := range db.ReadLinksOne(typeName, linkName, loge.LogeKey(args[2])) {
+		fmt.Fprintln(out, key)
+	}
+}
+
+func cmdLink(db *loge.LogeDB, args []string, in io.Reader, out io.Writer) {
+	var typeName = checkType(db, args[0])
+	var linkName = checkLink(db, typeName, args[1])
+	db.Transact(func (t *loge.Transaction) {
+		t.AddLink(typeName, linkName, loge.LogeKey(args[2]), loge.LogeKey(args[3]))
+	}, 0)
+}
+
+func cmdUnlink(db *loge.LogeDB, args []string, in io.Reader, out io.Writer) {
+	var typeName = checkType(db, args[0])
+	var linkName = checkLink(db, typeName, args[1])
+	db.Transact(func (t *loge.Transaction) {
+		t.RemoveLink(typeName, linkName, loge.LogeKey(args[2]), loge.LogeKey(args[3]))
+	}, 0)
+}
+
+func cmdFind(db *loge.LogeDB, args []string, in io.Reader, out io.Writer) {
+	var typeName = checkType(db, args[0])
+	var linkName = checkLink(db, typeName, args[1])
+	var from, limit = sliceArgs(args[3:])
+	writeKeys(out, db.FindSlice(typeName, linkName, loge.LogeKey(args[2]), from, limit))
+}
+
+func cmdDump(db *loge.LogeDB, args []string, in io.Reader, out io.Writer) {
+	var typeNames = args
+	if len(typeNames) == 0 {
+		for _, typ := range db.Types() {
+			typeNames = append(typeNames, typ.Name)
+		}
+	}
+
+	var encoder = json.NewEncoder(out)
+	for _, typeName := range typeNames {
+		var typ = db.Type(checkType(db, typeName))
+		var from loge.LogeKey = ""
+		for {
+			var keys = db.ListSlice(typeName, from, restoreBatchSize)
+			if len(keys) == 0 {
+				break
+			}
+
+			db.Transact(func (t *loge.Transaction) {
+				for _, key := range keys {
+					enc, err := json.Marshal(t.Read(typeName, key))
+					if err != nil {
+						panic(err)
+					}
+					var record = dumpRecord{ Type: typeName, Key: key, Object: enc }
+					for linkName := range typ.Links {
+						var links = t.ReadLinks(typeName, linkName, key)
+						if len(links) == 0 {
+							continue
+						}
+						if record.Links == nil {
+							record.Links = make(map[string][]loge.LogeKey)
+						}
+						record.Links[linkName] = links
+					}
+					encoder.Encode(record)
+				}
+			}, 0)
+
+			from = keys[len(keys) - 1]
+		}
+	}
+}
+
+func cmdRestore(db *loge.LogeDB, args []string, in io.Reader, out io.Writer) {
+	var scanner = bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64 * 1024), 64 * 1024 * 1024)
+
+	var batch []dumpRecord
+	var count = 0
+	var flush = func() {
+		db.Transact(func (t *loge.Transaction) {
+			for _, record := range batch {
+				t.Set(record.Type, record.Key, decodeObject(db, record.Type, record.Object))
+				for linkName, targets := range record.Links {
+					t.SetLinks(record.Type, linkName, record.Key, targets)
+				}
+			}
+		}, 0)
+		count += len(batch)
+		batch = batch[:0]
+	}
+
+	for scanner.Scan() {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var record dumpRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			panic(fmt.Sprintf("Bad record after %d: %v", count + len(batch), err))
+		}
+		checkType(db, record.Type)
+		batch = append(batch, record)
+		if len(batch) >= restoreBatchSize {
+			flush()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		panic(err)
+	}
+	flush()
+
+	fmt.Fprintf(out, "Restored %d objects\n", count)
+}
+
+func cmdCompact(db *loge.LogeDB, args []string, in io.Reader, out io.Writer) {
+	db.Compact()
+}
+
+func cmdMigrate(db *loge.LogeDB, args []string, in io.Reader, out io.Writer) {
+	for _, typeName := range args {
+		checkType(db, typeName)
+	}
+
+	checkpoint, err := db.Migrate(nil, loge.MigrateOptions{
+		Types: args,
+		Progress: func(checkpoint loge.MigrateCheckpoint) error {
+			fmt.Fprintf(out, "%s: up to %s\n", checkpoint.Type, checkpoint.After)
+			return nil
+		},
+	})
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintf(out, "Migrated %d objects\n", checkpoint.Count)
+}
+
+// -----------------------------------------------
+// Helpers
+// -----------------------------------------------
+
+func commandNames() []string {
+	var names = make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func checkType(db *loge.LogeDB, typeName string) string {
+	if db.Type(typeName) == nil {
+		panic(fmt.Sprintf("No such type: %s", typeName))
+	}
+	return typeName
+}
+
+func checkLink(db *loge.LogeDB, typeName string, linkName string) string {
+	if _, ok := db.Type(typeName).Links[linkName]; !ok {
+		panic(fmt.Sprintf("No such link: %s.%s", typeName, linkName))
+	}
+	return linkName
+}
+
+func decodeObject(db *loge.LogeDB, typeName string, enc []byte) interface{} {
+	var obj = db.Type(typeName).NewValue()
+	if err := json.Unmarshal(enc, obj); err != nil {
+		panic(fmt.Sprintf("Bad JSON for %s: %v", typeName, err))
+	}
+	return obj
+}
+
+func sliceArgs(args []string) (loge.LogeKey, int) {
+	var from loge.LogeKey = ""
+	var limit = -1
+	if len(args) > 0 {
+		from = loge.LogeKey(args[0])
+	}
+	if len(args) > 1 {
+		var err error
+		limit, err = strconv.Atoi(args[1])
+		if err != nil {
+			panic(fmt.Sprintf("Bad limit: %s", args[1]))
+		}
+	}
+	return from, limit
+}
+
+func writeJSON(out io.Writer, value interface{}) {
+	enc, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintf(out, "%s\n", enc)
+}
+
+func writeKeys(out io.Writer, keys []loge.LogeKey) {
+	for _, key := range keys {
+		fmt.Fprintln(out, key)
+	}
+}
@@ -0,0 +1,142 @@
+package logecli
+
+import (
+	"testing"
+	"bytes"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+
+	"loge"
+	"logehttp"
+)
+
+type TestObj struct {
+	Name string
+}
+
+func testDB() *loge.LogeDB {
+	var db = loge.NewLogeDB(loge.NewMemStore())
+	var def = loge.NewTypeDef("test", 1, &TestObj{})
+	def.Links = loge.LinkSpec{ "other": "test" }
+	db.CreateType(def)
+	return db
+}
+
+func run(test *testing.T, db *loge.LogeDB, input string, args ...string) string {
+	var out bytes.Buffer
+	if err := Run(db, args, strings.NewReader(input), &out); err != nil {
+		test.Fatalf("%v failed: %v", args, err)
+	}
+	return out.String()
+}
+
+func TestObjectCommands(test *testing.T) {
+	var db = testDB()
+
+	run(test, db, "", "set", "test", "one", `{"Name": "One"}`)
+	run(test, db, `{"Name": "Two"}`, "set", "test", "two")
+
+	if out := run(test, db, "", "get", "test", "two"); !strings.Contains(out, `"Name": "Two"`) {
+		test.Errorf("Wrong get output: %s", out)
+	}
+
+	run(test, db, "", "link", "test", "other", "one", "two")
+	if out := run(test, db, "", "links", "test", "other", "one"); out != "two\n" {
+		test.Errorf("Wrong links output: %q", out)
+	}
+
+	run(test, db, "", "delete", "test", "one")
+	if Run(db, []string{"get", "test", "one"}, nil, &bytes.Buffer{}) == nil {
+		test.Error("Get of deleted object succeeded")
+	}
+
+	if Run(db, []string{"get", "nope", "one"}, nil, &bytes.Buffer{}) == nil {
+		test.Error("Get of unknown type succeeded")
+	}
+
+	if Run(db, []string{"get", "test"}, nil, &bytes.Buffer{}) == nil {
+		test.Error("Get without key succeeded")
+	}
+}
+
+func TestRestore(test *testing.T) {
+	var db = testDB()
+
+	var input = `{"type": "test", "key": "one", "object": {"Name": "One"}, "links": {"other": ["two"]}}
+{"type": "test", "key": "two", "object": {"Name": "Two"}}
+`
+	if out := run(test, db, input, "restore"); out != "Restored 2 objects\n" {
+		test.Errorf("Wrong restore output: %q", out)
+	}
+
+	if db.ReadOne("test", "two").(*TestObj).Name != "Two" {
+		test.Error("Restored object missing")
+	}
+
+	if links := db.ReadLinksOne("test", "other", "one"); len(links) != 1 || links[0] != "two" {
+		test.Errorf("Wrong restored links: %v", links)
+	}
+}
+
+func TestRemote(test *testing.T) {
+	var server = httptest.NewServer(logehttp.NewServer(testDB()))
+	defer server.Close()
+
+	var run = Remote(server.URL)
+	var out bytes.Buffer
+
+	if err := run([]string{"set", "test", "a/b", `{"Name": "Slashed"}`}, nil, &out); err != nil {
+		test.Fatalf("Remote set failed: %v", err)
+	}
+
+	if err := run([]string{"get", "test", "a/b"}, nil, &out); err != nil || !strings.Contains(out.String(), "Slashed") {
+		test.Errorf("Wrong remote get: %s (%v)", out.String(), err)
+	}
+
+	out.Reset()
+	run([]string{"link", "test", "other", "a/b", "two"}, nil, &out)
+	run([]string{"links", "test", "other", "a/b"}, nil, &out)
+	if out.String() != "two\n" {
+		test.Errorf("Wrong remote links: %q", out.String())
+	}
+
+	if err := run([]string{"get", "test", "missing"}, nil, &out); err == nil || err.Error() != "No such object" {
+		test.Errorf("Wrong error for missing object: %v", err)
+	}
+}
+
+func TestSplitArgs(test *testing.T) {
+	args, err := splitArgs(`set test 'one two' '{"Name": "One"}' "a\"b"`)
+	var expected = []string{"set", "test", "one two", `{"Name": "One"}`, `a"b`}
+	if err != nil || !reflect.DeepEqual(args, expected) {
+		test.Errorf("Wrong split: %#v (%v)", args, err)
+	}
+
+	if _, err := splitArgs(`get "test`); err == nil {
+		test.Error("Unterminated quote accepted")
+	}
+}
+
+func TestHelpListsCommands(test *testing.T) {
+	var out bytes.Buffer
+	printHelp(&out)
+	for _, cmd := range commands {
+		if !strings.Contains(out.String(), cmd.usage) {
+			test.Errorf("Help leaves out %q", cmd.usage)
+		}
+	}
+}
+
+func TestBench(test *testing.T) {
+	var out bytes.Buffer
+	if err := Bench([]string{ "-ops", "50", "memory" }, &out); err != nil {
+		test.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "memory") || !strings.Contains(out.String(), "contended") {
+		test.Errorf("Wrong bench output:\n%s", out.String())
+	}
+	if Bench([]string{ "floppy" }, &out) == nil {
+		test.Error("Unknown backend accepted")
+	}
+}
@@ -0,0 +1,169 @@
+package logecli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Runs commands against a logehttp server instead of a local store.
+// The server knows the types, so no setup is needed.
+
+type remoteClient struct {
+	baseURL string
+	http *http.Client
+}
+
+func Remote(baseURL string) Runner {
+	var client = &remoteClient{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		http: http.DefaultClient,
+	}
+	return client.run
+}
+
+func (c *remoteClient) run(args []string, in io.Reader, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("No command given")
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("Unknown command: %s", args[0])
+	}
+
+	if len(args) - 1 < cmd.minArgs {
+		return fmt.Errorf("Usage: %s", cmd.usage)
+	}
+
+	var rest = args[1:]
+
+	switch args[0] {
+	case "types":
+		var types []struct {
+			Name string
+			Version int
+			Links map[string]string
+		}
+		if err := c.call("GET", nil, &types, nil, "types"); err != nil {
+			return err
+		}
+		for _, typ := range types {
+			fmt.Fprintf(out, "%s (v%d)\n", typ.Name, typ.Version)
+			for name, target := range typ.Links {
+				fmt.Fprintf(out, "  %s -> %s\n", name, target)
+			}
+		}
+		return nil
+
+	case "get":
+		var obj json.RawMessage
+		if err := c.call("GET", nil, &obj, nil, "objects", rest[0], rest[1]); err != nil {
+			return err
+		}
+		var pretty bytes.Buffer
+		json.Indent(&pretty, obj, "", "  ")
+		fmt.Fprintf(out, "%s\n", pretty.Bytes())
+		return nil
+
+	case "set":
+		var body io.Reader = in
+		if len(rest) > 2 {
+			body = strings.NewReader(rest[2])
+		}
+		return c.call("PUT", body, nil, nil, "objects", rest[0], rest[1])
+
+	case "delete":
+		return c.call("DELETE", nil, nil, nil, "objects", rest[0], rest[1])
+
+	case "list":
+		return c.callKeys(out, sliceQuery(rest[1:]), "objects", rest[0])
+
+	case "links":
+		return c.callKeys(out, nil, "links", rest[0], rest[1], rest[2])
+
+	case "link":
+		return c.call("PUT", nil, nil, nil, "links", rest[0], rest[1], rest[2], rest[3])
+
+	case "unlink":
+		return c.call("DELETE", nil, nil, nil, "links", rest[0], rest[1], rest[2], rest[3])
+
+	case "find":
+		return c.callKeys(out, sliceQuery(rest[3:]), "find", rest[0], rest[1], rest[2])
+	}
+
+	return fmt.Errorf("%s isn't available remotely", args[0])
+}
+
+func (c *remoteClient) callKeys(out io.Writer, query url.Values, path ...string) error {
+	var result struct {
+		Keys []string `json:"keys"`
+	}
+	if err := c.call("GET", nil, &result, query, path...); err != nil {
+		return err
+	}
+	for _, key := range result.Keys {
+		fmt.Fprintln(out, key)
+	}
+	return nil
+}
+
+func (c *remoteClient) call(method string, body io.Reader, result interface{}, query url.Values, path ...string) error {
+	var escaped = make([]string, 0, len(path))
+	for _, part := range path {
+		escaped = append(escaped, url.PathEscape(part))
+	}
+
+	var target = c.baseURL + "/" + strings.Join(escaped, "/")
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	enc, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 300 {
+		var failure struct {
+			Error string `json:"error"`
+		}
+		json.Unmarshal(enc, &failure)
+		if failure.Error == "" {
+			failure.Error = resp.Status
+		}
+		return fmt.Errorf("%s", failure.Error)
+	}
+
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(enc, result)
+}
+
+func sliceQuery(args []string) url.Values {
+	var query = url.Values{}
+	if len(args) > 0 {
+		query.Set("from", args[0])
+	}
+	if len(args) > 1 {
+		query.Set("limit", args[1])
+	}
+	return query
+}
@@ -0,0 +1,170 @@
+package logecli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"loge"
+
+	"github.com/chzyer/readline"
+)
+
+type Runner func(args []string, in io.Reader, out io.Writer) error
+
+func Local(db *loge.LogeDB) Runner {
+	return func(args []string, in io.Reader, out io.Writer) error {
+		return Run(db, args, in, out)
+	}
+}
+
+func Shell(run Runner) error {
+	var history = ""
+	if home, err := os.UserHomeDir(); err == nil {
+		history = filepath.Join(home, ".loge_history")
+	}
+
+	rl, err := readline.NewEx(&readline.Config{
+		Prompt: "loge> ",
+		HistoryFile: history,
+		InterruptPrompt: "^C",
+		EOFPrompt: "exit",
+	})
+	if err != nil {
+		return err
+	}
+	defer rl.Close()
+
+	for {
+		line, err := rl.Readline()
+		if err == readline.ErrInterrupt {
+			continue
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		args, err := splitArgs(line)
+		if err == nil && len(args) > 0 {
+			switch args[0] {
+			case "exit", "quit":
+				return nil
+			case "help":
+				printHelp(rl.Stdout())
+			case "watch":
+				err = Watch(run, args[1:], rl.Stdout())
+			default:
+				err = run(args, strings.NewReader(""), rl.Stdout())
+			}
+		}
+
+		if err != nil {
+			fmt.Fprintf(rl.Stderr(), "%v\n", err)
+		}
+	}
+}
+
+// Polls an object and prints it whenever it changes, until interrupted
+func Watch(run Runner, args []string, out io.Writer) error {
+	if len(args) < 2 {
+		return fmt.Errorf("Usage: watch <type> <key> [interval]")
+	}
+
+	var interval = time.Second
+	if len(args) > 2 {
+		var err error
+		interval, err = time.ParseDuration(args[2])
+		if err != nil {
+			return fmt.Errorf("Bad interval: %v", err)
+		}
+	}
+
+	var stop = make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+	defer signal.Stop(stop)
+
+	var last = ""
+	for first := true; ; first = false {
+		var buf bytes.Buffer
+		var current string
+		if err := run([]string{"get", args[0], args[1]}, nil, &buf); err != nil {
+			current = fmt.Sprintf("<%v>\n", err)
+		} else {
+			current = buf.String()
+		}
+
+		if first || current != last {
+			fmt.Fprintf(out, "[%s] %s", time.Now().Format("15:04:05"), current)
+			last = current
+		}
+
+		select {
+		case <-stop:
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+func printHelp(out io.Writer) {
+	for _, name := range commandNames() {
+		fmt.Fprintf(out, "  %s\n", commands[name].usage)
+	}
+	fmt.Fprintf(out, "  watch <type> <key> [interval]\n")
+	fmt.Fprintf(out, "  exit\n")
+}
+
+// Splits a line on whitespace, honouring quotes and backslashes, so
+// JSON can be passed as a single argument
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	var inArg = false
+	var quote rune = 0
+	var escaped = false
+
+	for _, c := range line {
+		switch {
+		case escaped:
+			current.WriteRune(c)
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				current.WriteRune(c)
+			}
+		case c == '"' || c == '\'':
+			quote = c
+			inArg = true
+		case c == ' ' || c == '\t':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(c)
+			inArg = true
+		}
+	}
+
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("Unterminated quote or escape")
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
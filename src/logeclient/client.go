@@ -0,0 +1,356 @@
+package logeclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"logehttp"
+)
+
+// A client for a logehttp server which keeps a local cache of objects and
+// links, invalidated from the server's change feed:
+//
+//   var client = logeclient.New("http://loge:8080")
+//   go client.Run(ctx)
+//   found, err := client.Get("person", "brendon", &person)
+//
+// The cache is only used while the feed is connected, so reads are never
+// staler than the feed's delivery delay. While it's down, every read
+// goes to the server.
+type Client struct {
+	BaseURL string
+	Header http.Header
+	HTTP *http.Client
+	MaxEntries int
+	Reconnect time.Duration
+
+	lock sync.Mutex
+	connected bool
+	epoch uint64
+	cache map[string]cacheEntry
+	stats Stats
+}
+
+type cacheEntry struct {
+	found bool
+	value []byte
+}
+
+type Stats struct {
+	Hits uint64
+	Misses uint64
+	Invalidations uint64
+	Connected bool
+}
+
+type StatusError struct {
+	Status int
+	Message string
+}
+
+func (err *StatusError) Error() string {
+	return fmt.Sprintf("%d: %s", err.Status, err.Message)
+}
+
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		Header: make(http.Header),
+		HTTP: http.DefaultClient,
+		MaxEntries: 100000,
+		Reconnect: time.Second,
+		cache: make(map[string]cacheEntry),
+	}
+}
+
+// Follows the change feed, reconnecting after Reconnect when it drops,
+// until ctx is done
+func (c *Client) Run(ctx context.Context) error {
+	for {
+		c.follow(ctx)
+		c.setConnected(false)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(c.Reconnect):
+		}
+	}
+}
+
+func (c *Client) Stats() Stats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var stats = c.stats
+	stats.Connected = c.connected
+	return stats
+}
+
+// -----------------------------------------------
+// Operations
+// -----------------------------------------------
+
+// Decodes the object into obj if it exists
+func (c *Client) Get(typeName string, key string, obj interface{}) (bool, error) {
+	var cacheKey = objectCacheKey(typeName, key)
+	entry, err := c.cached(cacheKey, func() (cacheEntry, error) {
+		var body, status, err = c.do("GET", objectPath(typeName, key), nil)
+		switch {
+		case err != nil:
+			return cacheEntry{}, err
+		case status == http.StatusNotFound:
+			return cacheEntry{ found: false }, nil
+		}
+		return cacheEntry{ found: true, value: body }, nil
+	})
+	if err != nil || !entry.found {
+		return false, err
+	}
+	return true, json.Unmarshal(entry.value, obj)
+}
+
+func (c *Client) Set(typeName string, key string, obj interface{}) error {
+	enc, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	_, _, err = c.do("PUT", objectPath(typeName, key), enc)
+	c.invalidate(objectCacheKey(typeName, key))
+	return err
+}
+
+func (c *Client) Delete(typeName string, key string) error {
+	_, _, err := c.do("DELETE", objectPath(typeName, key), nil)
+	c.invalidate(objectCacheKey(typeName, key))
+	return err
+}
+
+func (c *Client) ReadLinks(typeName string, linkName string, key string) ([]string, error) {
+	var cacheKey = linkCacheKey(typeName, linkName, key)
+	entry, err := c.cached(cacheKey, func() (cacheEntry, error) {
+		var body, _, err = c.do("GET", linkPath(typeName, linkName, key), nil)
+		return cacheEntry{ found: true, value: body }, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return decodeKeys(entry.value)
+}
+
+func (c *Client) SetLinks(typeName string, linkName string, key string, targets []string) error {
+	enc, err := json.Marshal(targets)
+	if err != nil {
+		return err
+	}
+	_, _, err = c.do("PUT", linkPath(typeName, linkName, key), enc)
+	c.invalidate(linkCacheKey(typeName, linkName, key))
+	return err
+}
+
+func (c *Client) AddLink(typeName string, linkName string, key string, target string) error {
+	_, _, err := c.do("PUT", linkPath(typeName, linkName, key) + "/" + url.PathEscape(target), nil)
+	c.invalidate(linkCacheKey(typeName, linkName, key))
+	return err
+}
+
+func (c *Client) RemoveLink(typeName string, linkName string, key string, target string) error {
+	_, _, err := c.do("DELETE", linkPath(typeName, linkName, key) + "/" + url.PathEscape(target), nil)
+	c.invalidate(linkCacheKey(typeName, linkName, key))
+	return err
+}
+
+// Not cached. Limit < 0 means no limit.
+func (c *Client) Find(typeName string, linkName string, target string, from string, limit int) ([]string, error) {
+	var path = fmt.Sprintf("/find/%s/%s/%s", url.PathEscape(typeName), url.PathEscape(linkName), url.PathEscape(target))
+	body, _, err := c.do("GET", path + sliceQuery(from, limit), nil)
+	if err != nil {
+		return nil, err
+	}
+	return decodeKeys(body)
+}
+
+// Not cached. Limit < 0 means no limit.
+func (c *Client) List(typeName string, from string, limit int) ([]string, error) {
+	body, _, err := c.do("GET", "/objects/" + url.PathEscape(typeName) + sliceQuery(from, limit), nil)
+	if err != nil {
+		return nil, err
+	}
+	return decodeKeys(body)
+}
+
+// -----------------------------------------------
+// Cache
+// -----------------------------------------------
+
+// A fetch that overlaps any invalidation isn't cached: it may have read
+// the value from before the change.
+func (c *Client) cached(cacheKey string, fetch func() (cacheEntry, error)) (cacheEntry, error) {
+	c.lock.Lock()
+	if entry, ok := c.cache[cacheKey]; ok {
+		c.stats.Hits++
+		c.lock.Unlock()
+		return entry, nil
+	}
+	c.stats.Misses++
+	var connected = c.connected
+	var epoch = c.epoch
+	c.lock.Unlock()
+
+	entry, err := fetch()
+	if err != nil || !connected {
+		return entry, err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.connected && c.epoch == epoch {
+		if len(c.cache) >= c.MaxEntries {
+			for evict := range c.cache {
+				delete(c.cache, evict)
+				break
+			}
+		}
+		c.cache[cacheKey] = entry
+	}
+	return entry, nil
+}
+
+func (c *Client) invalidate(cacheKey string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.epoch++
+	c.stats.Invalidations++
+	delete(c.cache, cacheKey)
+}
+
+func (c *Client) setConnected(connected bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.connected = connected
+	c.epoch++
+	c.cache = make(map[string]cacheEntry)
+}
+
+func (c *Client) follow(ctx context.Context) {
+	feed, err := logehttp.DialFeed(ctx, c.BaseURL + "/feed", c.Header)
+	if err != nil {
+		return
+	}
+	defer feed.Close()
+
+	go func() {
+		<-ctx.Done()
+		feed.Close()
+	}()
+
+	c.setConnected(true)
+
+	for {
+		msg, err := feed.Next()
+		if err != nil {
+			return
+		}
+		if msg.Link != "" {
+			c.invalidate(linkCacheKey(msg.Type, msg.Link, string(msg.Key)))
+		} else {
+			c.invalidate(objectCacheKey(msg.Type, string(msg.Key)))
+		}
+	}
+}
+
+func objectCacheKey(typeName string, key string) string {
+	return typeName + "\x00\x00" + key
+}
+
+func linkCacheKey(typeName string, linkName string, key string) string {
+	return typeName + "\x00" + linkName + "\x00" + key
+}
+
+// -----------------------------------------------
+// HTTP
+// -----------------------------------------------
+
+// Returns the body and status for 2xx and 404; other statuses are errors
+func (c *Client) do(method string, path string, body []byte) ([]byte, int, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, c.BaseURL + path, reader)
+	if err != nil {
+		return nil, 0, err
+	}
+	for name, values := range c.Header {
+		req.Header[name] = values
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound && method == "GET" && strings.HasPrefix(path, "/objects/") {
+		var result map[string]string
+		json.Unmarshal(respBody, &result)
+		if result["error"] == "No such object" {
+			return nil, resp.StatusCode, nil
+		}
+	}
+
+	if resp.StatusCode >= 300 {
+		var result map[string]string
+		json.Unmarshal(respBody, &result)
+		return nil, resp.StatusCode, &StatusError{ resp.StatusCode, result["error"] }
+	}
+	return respBody, resp.StatusCode, nil
+}
+
+func objectPath(typeName string, key string) string {
+	return "/objects/" + url.PathEscape(typeName) + "/" + url.PathEscape(key)
+}
+
+func linkPath(typeName string, linkName string, key string) string {
+	return "/links/" + url.PathEscape(typeName) + "/" + url.PathEscape(linkName) + "/" + url.PathEscape(key)
+}
+
+func sliceQuery(from string, limit int) string {
+	var query = url.Values{}
+	if from != "" {
+		query.Set("from", from)
+	}
+	if limit >= 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	if len(query) == 0 {
+		return ""
+	}
+	return "?" + query.Encode()
+}
+
+func decodeKeys(body []byte) ([]string, error) {
+	var result struct {
+		Keys []string `json:"keys"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+	if result.Keys == nil {
+		result.Keys = []string{}
+	}
+	return result.Keys, nil
+}
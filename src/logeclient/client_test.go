@@ -0,0 +1,82 @@
+package logeclient
+
+import (
+	"testing"
+	"context"
+	"net/http/httptest"
+	"time"
+
+	"loge"
+	"logehttp"
+)
+
+type TestObj struct {
+	Name string
+}
+
+func waitFor(test *testing.T, what string, check func() bool) {
+	var deadline = time.Now().Add(5 * time.Second)
+	for !check() {
+		if time.Now().After(deadline) {
+			test.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestCache(test *testing.T) {
+	var db = loge.NewLogeDB(loge.NewMemStore())
+	var def = loge.NewTypeDef("test", 1, &TestObj{})
+	def.Links = loge.LinkSpec{ "other": "test" }
+	db.CreateType(def)
+	db.SetOne("test", "one", &TestObj{ "One" })
+
+	var server = httptest.NewServer(logehttp.NewServer(db))
+	defer server.Close()
+
+	var client = New(server.URL)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go client.Run(ctx)
+	waitFor(test, "feed", func() bool { return client.Stats().Connected })
+
+	var obj TestObj
+	for i := 0; i < 3; i++ {
+		found, err := client.Get("test", "one", &obj)
+		if err != nil || !found || obj.Name != "One" {
+			test.Fatalf("Wrong read: %v %v (%v)", found, obj, err)
+		}
+	}
+	if stats := client.Stats(); stats.Hits != 2 || stats.Misses != 1 {
+		test.Errorf("Wrong cache stats: %#v", stats)
+	}
+
+	// Written behind the client's back; the feed invalidates
+	db.SetOne("test", "one", &TestObj{ "Uno" })
+	waitFor(test, "invalidation", func() bool {
+		client.Get("test", "one", &obj)
+		return obj.Name == "Uno"
+	})
+
+	if found, _ := client.Get("test", "missing", &obj); found {
+		test.Error("Missing object found")
+	}
+
+	if err := client.AddLink("test", "other", "one", "two"); err != nil {
+		test.Fatalf("AddLink failed: %v", err)
+	}
+	if links, err := client.ReadLinks("test", "other", "one"); err != nil || len(links) != 1 || links[0] != "two" {
+		test.Errorf("Wrong links: %v (%v)", links, err)
+	}
+
+	if keys, err := client.List("test", "", -1); err == nil {
+		test.Errorf("List on memstore didn't fail: %v", keys)
+	}
+
+	if _, err := client.Get("nope", "one", &obj); err == nil {
+		test.Error("Missing type didn't fail")
+	}
+
+	cancel()
+	waitFor(test, "disconnect", func() bool { return !client.Stats().Connected })
+}
@@ -0,0 +1,154 @@
+package logegraphql
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"loge"
+	"logeauth"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+// Serves GraphQL over HTTP: POST with a JSON body, or GET ?query= for
+// queries only, so that a link or an image can't run a mutation from
+// someone's browser. Each request runs in one transaction, which is
+// cancelled if the operation errors.
+//
+// With a Guard set, callers authenticate as with logehttp, 401 if they
+// can't, and each field is authorized for its type (see NewSchema).
+type Handler struct {
+	DB *loge.LogeDB
+	Schema graphql.Schema
+	Timeout time.Duration
+	Guard *logeauth.Guard
+}
+
+type graphQLRequest struct {
+	Query string `json:"query"`
+	Variables map[string]interface{} `json:"variables"`
+	OperationName string `json:"operationName"`
+}
+
+func NewHandler(db *loge.LogeDB) (*Handler, error) {
+	schema, err := NewSchema(db)
+	if err != nil {
+		return nil, err
+	}
+	return &Handler{
+		DB: db,
+		Schema: schema,
+		Timeout: 5 * time.Second,
+	}, nil
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req graphQLRequest
+	switch r.Method {
+	case "GET":
+		req.Query = r.URL.Query().Get("query")
+		req.OperationName = r.URL.Query().Get("operationName")
+		if operationType(req.Query, req.OperationName) == ast.OperationTypeMutation {
+			writeResult(w, http.StatusMethodNotAllowed, errorResult("Mutations must be POSTed"))
+			return
+		}
+	case "POST":
+		// Forms can't send JSON, so can't post mutations from elsewhere
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+			writeResult(w, http.StatusUnsupportedMediaType, errorResult("Content-Type must be application/json"))
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeResult(w, http.StatusBadRequest, errorResult(err.Error()))
+			return
+		}
+	default:
+		writeResult(w, http.StatusMethodNotAllowed, errorResult("Method not allowed"))
+		return
+	}
+
+	var ctx = r.Context()
+	if h.Guard != nil {
+		principal, err := h.Guard.Authenticate(requestCredentials(r))
+		if err != nil {
+			writeResult(w, http.StatusUnauthorized, errorResult(err.Error()))
+			return
+		}
+		ctx = withAccess(ctx, h.Guard, principal)
+	}
+
+	var result *graphql.Result
+	var ok = h.DB.Transact(func (t *loge.Transaction) {
+		result = graphql.Do(graphql.Params{
+			Schema: h.Schema,
+			RequestString: req.Query,
+			VariableValues: req.Variables,
+			OperationName: req.OperationName,
+			Context: WithTransaction(ctx, t),
+		})
+		if result.HasErrors() {
+			t.Cancel()
+		}
+	}, h.Timeout)
+
+	if !ok && !result.HasErrors() {
+		writeResult(w, http.StatusConflict, errorResult("Transaction failed"))
+		return
+	}
+
+	writeResult(w, http.StatusOK, result)
+}
+
+// The type of the operation a request would run, or "" if it doesn't
+// parse or name one; graphql.Do then reports why
+func operationType(query string, operationName string) string {
+	doc, err := parser.Parse(parser.ParseParams{ Source: query })
+	if err != nil {
+		return ""
+	}
+
+	var found = ""
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if operationName == "" || op.Name != nil && op.Name.Value == operationName {
+			if found != "" {
+				return ""
+			}
+			found = op.Operation
+		}
+	}
+	return found
+}
+
+func requestCredentials(r *http.Request) logeauth.Credentials {
+	var creds logeauth.Credentials
+	var header = r.Header.Get("Authorization")
+	if strings.HasPrefix(header, "Bearer ") {
+		creds.Token = strings.TrimSpace(header[len("Bearer "):])
+	}
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		creds.Certificates = r.TLS.VerifiedChains[0]
+	}
+	return creds
+}
+
+func errorResult(message string) *graphql.Result {
+	return &graphql.Result{
+		Errors: []gqlerrors.FormattedError{ { Message: message } },
+	}
+}
+
+func writeResult(w http.ResponseWriter, status int, result *graphql.Result) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,131 @@
+package logegraphql
+
+import (
+	"testing"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+
+	"loge"
+	"logeauth"
+)
+
+type response struct {
+	Data map[string]interface{}
+	Errors []struct{ Message string }
+}
+
+func post(test *testing.T, server *httptest.Server, token string, contentType string, query string) (int, response) {
+	var body, _ = json.Marshal(map[string]string{ "query": query })
+	req, _ := http.NewRequest("POST", server.URL, strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", contentType)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer " + token)
+	}
+	return send(test, req)
+}
+
+func get(test *testing.T, server *httptest.Server, query string) (int, response) {
+	req, _ := http.NewRequest("GET", server.URL + "?query=" + url.QueryEscape(query), nil)
+	return send(test, req)
+}
+
+func send(test *testing.T, req *http.Request) (int, response) {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var result response
+	json.NewDecoder(resp.Body).Decode(&result)
+	return resp.StatusCode, result
+}
+
+func testHandler(test *testing.T, db *loge.LogeDB) *Handler {
+	handler, err := NewHandler(db)
+	if err != nil {
+		test.Fatalf("Handler failed: %v", err)
+	}
+	return handler
+}
+
+func TestHandler(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "logegraphql")
+	defer os.RemoveAll(dir)
+	var db = testDB(dir)
+	defer db.Close()
+	var server = httptest.NewServer(testHandler(test, db))
+	defer server.Close()
+
+	var mutation = `mutation { set_person(key: "carol", value: { Name: "Carol" }) { _key } }`
+
+	if status, result := get(test, server, `{ person(key: "alice") { Name } }`); status != 200 || result.Data["person"] == nil {
+		test.Errorf("GET query gave %d: %v", status, result)
+	}
+	if status, _ := get(test, server, mutation); status != http.StatusMethodNotAllowed || db.ExistsOne("person", "carol") {
+		test.Errorf("GET mutation gave %d", status)
+	}
+	if status, _ := post(test, server, "", "text/plain", mutation); status != http.StatusUnsupportedMediaType || db.ExistsOne("person", "carol") {
+		test.Errorf("Form-like POST gave %d", status)
+	}
+	if status, result := post(test, server, "", "application/json; charset=utf-8", mutation); status != 200 || len(result.Errors) > 0 {
+		test.Errorf("POST mutation gave %d: %v", status, result.Errors)
+	}
+	if !db.ExistsOne("person", "carol") {
+		test.Error("POSTed mutation not committed")
+	}
+
+	// Nothing is written when any of it fails
+	var status, result = post(test, server, "", "application/json", `mutation {
+		set_person(key: "dave", value: { Name: "Dave" }) { _key }
+		link_person_friends(key: "dave", target: "") { _key }
+	}`)
+	if status != 200 || len(result.Errors) == 0 || db.ExistsOne("person", "dave") {
+		test.Errorf("Failed mutation gave %d: %v", status, result.Errors)
+	}
+}
+
+func TestHandlerAuth(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "logegraphql")
+	defer os.RemoveAll(dir)
+	var db = testDB(dir)
+	defer db.Close()
+
+	var handler = testHandler(test, db)
+	handler.Guard = &logeauth.Guard{
+		Authenticator: logeauth.TokenAuthenticator{
+			"writer": &logeauth.Principal{ Name: "writer" },
+			"reader": &logeauth.Principal{ Name: "reader" },
+		},
+		Authorizer: logeauth.Policy{
+			{ Who: []string{"writer"}, Types: []string{"*"}, Ops: []logeauth.Operation{"*"} },
+			{ Who: []string{"reader"}, Types: []string{"person"}, Ops: []logeauth.Operation{logeauth.OpRead} },
+		},
+	}
+	var server = httptest.NewServer(handler)
+	defer server.Close()
+
+	var query = `{ person(key: "alice") { Name friends { Name } } }`
+	if status, _ := post(test, server, "", "application/json", query); status != http.StatusUnauthorized {
+		test.Errorf("Anonymous query gave %d", status)
+	}
+	if _, result := post(test, server, "reader", "application/json", query); len(result.Errors) > 0 {
+		test.Errorf("Reader query failed: %v", result.Errors)
+	}
+	if _, result := post(test, server, "reader", "application/json", `{ person_keys }`); len(result.Errors) == 0 {
+		test.Error("Reader listed keys")
+	}
+
+	var mutation = `mutation { delete_person(key: "bob") }`
+	if _, result := post(test, server, "reader", "application/json", mutation); len(result.Errors) == 0 || !db.ExistsOne("person", "bob") {
+		test.Errorf("Reader deleted: %v", result.Errors)
+	}
+	if _, result := post(test, server, "writer", "application/json", mutation); len(result.Errors) > 0 || db.ExistsOne("person", "bob") {
+		test.Errorf("Writer couldn't delete: %v", result.Errors)
+	}
+}
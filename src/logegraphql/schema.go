@@ -0,0 +1,390 @@
+package logegraphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"loge"
+	"logeauth"
+
+	"github.com/graphql-go/graphql"
+)
+
+// Each registered type becomes a GraphQL object type with its exported
+// fields, a _key field, and one list field per link. The generated
+// operations are:
+//
+//   query    {type}(key)                     the object, or null
+//   query    {type}_keys(from, limit)        keys of the type
+//   query    {type}_find_{link}(target, ...) objects linking to target
+//   mutation set_{type}(key, value)
+//   mutation delete_{type}(key)
+//   mutation link_{type}_{link}(key, target)
+//   mutation unlink_{type}_{link}(key, target)
+//
+// Resolvers expect the transaction in the context; see Handler. With a
+// Guard, reading an object, including through a link or as a mutation's
+// result, needs read; _keys list, _find_ find, set_ write, delete_
+// delete, and link_ and unlink_ link.
+
+type transactionKey struct{}
+
+type accessKey struct{}
+
+// Who's asking, for resolvers to authorize against
+type access struct {
+	guard *logeauth.Guard
+	principal *logeauth.Principal
+}
+
+type node struct {
+	typeName string
+	key loge.LogeKey
+	object interface{}
+}
+
+type schemaBuilder struct {
+	db *loge.LogeDB
+	objects map[string]*graphql.Object
+	inputs map[string]*graphql.InputObject
+}
+
+func NewSchema(db *loge.LogeDB) (graphql.Schema, error) {
+	var builder = &schemaBuilder{
+		db: db,
+		objects: make(map[string]*graphql.Object),
+		inputs: make(map[string]*graphql.InputObject),
+	}
+	return builder.build()
+}
+
+func WithTransaction(ctx context.Context, t *loge.Transaction) context.Context {
+	return context.WithValue(ctx, transactionKey{}, t)
+}
+
+func withAccess(ctx context.Context, guard *logeauth.Guard, principal *logeauth.Principal) context.Context {
+	return context.WithValue(ctx, accessKey{}, &access{ guard, principal })
+}
+
+// Nil without a Guard in the context, or if its Authorizer allows op
+func authorize(p graphql.ResolveParams, op logeauth.Operation, typeName string) error {
+	a, ok := p.Context.Value(accessKey{}).(*access)
+	if !ok || a.guard.Authorizer == nil {
+		return nil
+	}
+	return a.guard.Authorizer.Authorize(a.principal, op, typeName)
+}
+
+func transaction(p graphql.ResolveParams) *loge.Transaction {
+	t, ok := p.Context.Value(transactionKey{}).(*loge.Transaction)
+	if !ok {
+		panic("No transaction in GraphQL context")
+	}
+	return t
+}
+
+func (b *schemaBuilder) build() (graphql.Schema, error) {
+	var types = b.db.Types()
+	if len(types) == 0 {
+		return graphql.Schema{}, fmt.Errorf("No types registered")
+	}
+
+	for _, typ := range types {
+		var typ = typ
+		b.objects[typ.Name] = graphql.NewObject(graphql.ObjectConfig{
+			Name: typ.Name,
+			Fields: graphql.FieldsThunk(func() graphql.Fields {
+				return b.objectFields(typ.Name)
+			}),
+		})
+		b.inputs[typ.Name] = graphql.NewInputObject(graphql.InputObjectConfig{
+			Name: typ.Name + "_input",
+			Fields: b.inputFields(typ.Name),
+		})
+	}
+
+	var queries = graphql.Fields{}
+	var mutations = graphql.Fields{}
+	for _, typ := range types {
+		b.addQueries(queries, typ.Name)
+		b.addMutations(mutations, typ.Name)
+	}
+
+	return graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{ Name: "Query", Fields: queries }),
+		Mutation: graphql.NewObject(graphql.ObjectConfig{ Name: "Mutation", Fields: mutations }),
+	})
+}
+
+// -----------------------------------------------
+// Object types
+// -----------------------------------------------
+
+func (b *schemaBuilder) objectFields(typeName string) graphql.Fields {
+	var typ = b.db.Type(typeName)
+	var fields = graphql.Fields{
+		"_key": &graphql.Field{
+			Type: graphql.String,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return string(p.Source.(*node).key), nil
+			},
+		},
+	}
+
+	var structType = reflect.TypeOf(typ.Exemplar).Elem()
+	for i := 0; i < structType.NumField(); i++ {
+		var field = structType.Field(i)
+		var output = outputType(field.Type)
+		if field.PkgPath != "" || output == nil {
+			continue
+		}
+
+		var index = i
+		fields[field.Name] = &graphql.Field{
+			Type: output,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return reflect.ValueOf(p.Source.(*node).object).Elem().Field(index).Interface(), nil
+			},
+		}
+	}
+
+	for linkName, info := range typ.Links {
+		var linkName = linkName
+		var target = info.Target
+		var output graphql.Output = graphql.NewList(graphql.String)
+		if obj, ok := b.objects[target]; ok {
+			output = graphql.NewList(obj)
+		}
+
+		fields[linkName] = &graphql.Field{
+			Type: output,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				var source = p.Source.(*node)
+				var keys = transaction(p).ReadLinks(source.typeName, linkName, source.key)
+				if _, ok := b.objects[target]; !ok {
+					return keys, nil
+				}
+				return readNodes(p, target, keys)
+			},
+		}
+	}
+
+	return fields
+}
+
+func (b *schemaBuilder) inputFields(typeName string) graphql.InputObjectConfigFieldMap {
+	var fields = graphql.InputObjectConfigFieldMap{}
+	var structType = reflect.TypeOf(b.db.Type(typeName).Exemplar).Elem()
+	for i := 0; i < structType.NumField(); i++ {
+		var field = structType.Field(i)
+		var input = inputType(field.Type)
+		if field.PkgPath != "" || input == nil {
+			continue
+		}
+		fields[field.Name] = &graphql.InputObjectFieldConfig{ Type: input }
+	}
+	return fields
+}
+
+// -----------------------------------------------
+// Operations
+// -----------------------------------------------
+
+func (b *schemaBuilder) addQueries(fields graphql.Fields, typeName string) {
+	var keyArgs = graphql.FieldConfigArgument{
+		"key": &graphql.ArgumentConfig{ Type: graphql.NewNonNull(graphql.String) },
+	}
+
+	fields[typeName] = &graphql.Field{
+		Type: b.objects[typeName],
+		Args: keyArgs,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return readNode(p, typeName, argKey(p, "key"))
+		},
+	}
+
+	fields[typeName + "_keys"] = &graphql.Field{
+		Type: graphql.NewList(graphql.String),
+		Args: sliceArgs(graphql.FieldConfigArgument{}),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			if err := authorize(p, logeauth.OpList, typeName); err != nil {
+				return nil, err
+			}
+			var from, limit = argSlice(p)
+			return transaction(p).ListSlice(typeName, from, limit).All(), nil
+		},
+	}
+
+	for linkName := range b.db.Type(typeName).Links {
+		var linkName = linkName
+		fields[typeName + "_find_" + linkName] = &graphql.Field{
+			Type: graphql.NewList(b.objects[typeName]),
+			Args: sliceArgs(graphql.FieldConfigArgument{
+				"target": &graphql.ArgumentConfig{ Type: graphql.NewNonNull(graphql.String) },
+			}),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				if err := authorize(p, logeauth.OpFind, typeName); err != nil {
+					return nil, err
+				}
+				var from, limit = argSlice(p)
+				var keys = transaction(p).FindSlice(typeName, linkName, argKey(p, "target"), from, limit).All()
+				return readNodes(p, typeName, keys)
+			},
+		}
+	}
+}
+
+func (b *schemaBuilder) addMutations(fields graphql.Fields, typeName string) {
+	var keyArg = &graphql.ArgumentConfig{ Type: graphql.NewNonNull(graphql.String) }
+
+	fields["set_" + typeName] = &graphql.Field{
+		Type: b.objects[typeName],
+		Args: graphql.FieldConfigArgument{
+			"key": keyArg,
+			"value": &graphql.ArgumentConfig{ Type: graphql.NewNonNull(b.inputs[typeName]) },
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			if err := authorize(p, logeauth.OpWrite, typeName); err != nil {
+				return nil, err
+			}
+			var obj = b.db.Type(typeName).NewValue()
+			enc, err := json.Marshal(p.Args["value"])
+			if err == nil {
+				err = json.Unmarshal(enc, obj)
+			}
+			if err != nil {
+				return nil, err
+			}
+			var key = argKey(p, "key")
+			transaction(p).Set(typeName, key, obj)
+			return &node{ typeName, key, obj }, nil
+		},
+	}
+
+	fields["delete_" + typeName] = &graphql.Field{
+		Type: graphql.Boolean,
+		Args: graphql.FieldConfigArgument{ "key": keyArg },
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			if err := authorize(p, logeauth.OpDelete, typeName); err != nil {
+				return nil, err
+			}
+			var t = transaction(p)
+			var key = argKey(p, "key")
+			var existed = t.Exists(typeName, key)
+			t.Delete(typeName, key)
+			return existed, nil
+		},
+	}
+
+	for linkName := range b.db.Type(typeName).Links {
+		var linkName = linkName
+		var linkArgs = graphql.FieldConfigArgument{
+			"key": keyArg,
+			"target": &graphql.ArgumentConfig{ Type: graphql.NewNonNull(graphql.String) },
+		}
+
+		fields["link_" + typeName + "_" + linkName] = &graphql.Field{
+			Type: b.objects[typeName],
+			Args: linkArgs,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				if err := authorize(p, logeauth.OpLink, typeName); err != nil {
+					return nil, err
+				}
+				var key = argKey(p, "key")
+				transaction(p).AddLink(typeName, linkName, key, argKey(p, "target"))
+				return readNode(p, typeName, key)
+			},
+		}
+
+		fields["unlink_" + typeName + "_" + linkName] = &graphql.Field{
+			Type: b.objects[typeName],
+			Args: linkArgs,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				if err := authorize(p, logeauth.OpLink, typeName); err != nil {
+					return nil, err
+				}
+				var key = argKey(p, "key")
+				transaction(p).RemoveLink(typeName, linkName, key, argKey(p, "target"))
+				return readNode(p, typeName, key)
+			},
+		}
+	}
+}
+
+// -----------------------------------------------
+// Helpers
+// -----------------------------------------------
+
+func readNode(p graphql.ResolveParams, typeName string, key loge.LogeKey) (*node, error) {
+	if err := authorize(p, logeauth.OpRead, typeName); err != nil {
+		return nil, err
+	}
+	var t = transaction(p)
+	if !t.Exists(typeName, key) {
+		return nil, nil
+	}
+	return &node{ typeName, key, t.Read(typeName, key) }, nil
+}
+
+// Skipping any which don't exist
+func readNodes(p graphql.ResolveParams, typeName string, keys []loge.LogeKey) ([]*node, error) {
+	var nodes = make([]*node, 0, len(keys))
+	for _, key := range keys {
+		n, err := readNode(p, typeName, key)
+		if err != nil {
+			return nil, err
+		}
+		if n != nil {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes, nil
+}
+
+func argKey(p graphql.ResolveParams, name string) loge.LogeKey {
+	var key, _ = p.Args[name].(string)
+	return loge.LogeKey(key)
+}
+
+func sliceArgs(args graphql.FieldConfigArgument) graphql.FieldConfigArgument {
+	args["from"] = &graphql.ArgumentConfig{ Type: graphql.String, DefaultValue: "" }
+	args["limit"] = &graphql.ArgumentConfig{ Type: graphql.Int, DefaultValue: -1 }
+	return args
+}
+
+func argSlice(p graphql.ResolveParams) (loge.LogeKey, int) {
+	var limit, ok = p.Args["limit"].(int)
+	if !ok {
+		limit = -1
+	}
+	return argKey(p, "from"), limit
+}
+
+func outputType(t reflect.Type) graphql.Output {
+	switch t.Kind() {
+	case reflect.String:
+		return graphql.String
+	case reflect.Bool:
+		return graphql.Boolean
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return graphql.Int
+	case reflect.Float32, reflect.Float64:
+		return graphql.Float
+	case reflect.Slice, reflect.Array:
+		if elem := outputType(t.Elem()); elem != nil {
+			return graphql.NewList(elem)
+		}
+	}
+	return nil
+}
+
+func inputType(t reflect.Type) graphql.Input {
+	var output = outputType(t)
+	if output == nil {
+		return nil
+	}
+	return output.(graphql.Input)
+}
@@ -0,0 +1,132 @@
+package logegraphql
+
+import (
+	"testing"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+
+	"loge"
+
+	"github.com/graphql-go/graphql"
+)
+
+type Person struct {
+	Name string
+	Age int
+}
+
+// In dir, since the memory store can't list or find
+func testDB(dir string) *loge.LogeDB {
+	var db = loge.NewLogeDB(loge.NewLevelDBStore(dir))
+
+	var def = loge.NewTypeDef("person", 1, &Person{})
+	def.Links = loge.LinkSpec{ "friends": "person" }
+	db.CreateType(def)
+
+	db.Transact(func (t *loge.Transaction) {
+		t.Set("person", "alice", &Person{ "Alice", 30 })
+		t.Set("person", "bob", &Person{ "Bob", 25 })
+		t.AddLink("person", "friends", "alice", "bob")
+	}, 0)
+	return db
+}
+
+func run(test *testing.T, db *loge.LogeDB, query string, vars map[string]interface{}) *graphql.Result {
+	schema, err := NewSchema(db)
+	if err != nil {
+		test.Fatalf("Schema failed: %v", err)
+	}
+
+	var result *graphql.Result
+	db.Transact(func (t *loge.Transaction) {
+		result = graphql.Do(graphql.Params{
+			Schema: schema,
+			RequestString: query,
+			VariableValues: vars,
+			Context: WithTransaction(context.Background(), t),
+		})
+	}, 0)
+	return result
+}
+
+func checkData(test *testing.T, result *graphql.Result, expected string) {
+	if result.HasErrors() {
+		test.Fatalf("Errors: %v", result.Errors)
+	}
+	enc, _ := json.Marshal(result.Data)
+	if string(enc) != expected {
+		test.Errorf("Wrong data:\n%s\nnot\n%s", enc, expected)
+	}
+}
+
+func TestQueries(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "logegraphql")
+	defer os.RemoveAll(dir)
+	var db = testDB(dir)
+	defer db.Close()
+
+	checkData(test, run(test, db, `{
+		person(key: "alice") { _key Name Age friends { _key Name } }
+		missing: person(key: "carol") { Name }
+		person_keys
+		first: person_keys(limit: 1)
+		person_find_friends(target: "bob") { _key }
+	}`, nil),
+		`{"first":["alice"],"missing":null,` +
+		`"person":{"Age":30,"Name":"Alice","_key":"alice","friends":[{"Name":"Bob","_key":"bob"}]},` +
+		`"person_find_friends":[{"_key":"alice"}],"person_keys":["alice","bob"]}`)
+}
+
+func TestMutations(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "logegraphql")
+	defer os.RemoveAll(dir)
+	var db = testDB(dir)
+	defer db.Close()
+
+	checkData(test, run(test, db, `mutation {
+		set_person(key: "carol", value: { Name: "Carol", Age: 40 }) { _key Name }
+		link_person_friends(key: "carol", target: "alice") { friends { _key } }
+	}`, nil),
+		`{"link_person_friends":{"friends":[{"_key":"alice"}]},"set_person":{"Name":"Carol","_key":"carol"}}`)
+	if db.ReadOne("person", "carol").(*Person).Age != 40 {
+		test.Error("Set not written")
+	}
+
+	checkData(test, run(test, db, `mutation ($value: person_input!) {
+		set_person(key: "dave", value: $value) { Age }
+	}`, map[string]interface{}{ "value": map[string]interface{}{ "Name": "Dave", "Age": 50 } }),
+		`{"set_person":{"Age":50}}`)
+
+	checkData(test, run(test, db, `mutation {
+		unlink_person_friends(key: "carol", target: "alice") { friends { _key } }
+		delete_person(key: "carol")
+		again: delete_person(key: "nobody")
+	}`, nil),
+		`{"again":false,"delete_person":true,"unlink_person_friends":{"friends":[]}}`)
+	if db.ExistsOne("person", "carol") {
+		test.Error("Delete not written")
+	}
+}
+
+func TestErrors(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "logegraphql")
+	defer os.RemoveAll(dir)
+	var db = testDB(dir)
+	defer db.Close()
+
+	var cases = []string{
+		`{ person(key: "alice") { Height } }`,
+		`{ nobody(key: "alice") { Name } }`,
+		`{ person { Name } }`,
+		`{ person(key: "alice") }`,
+		`mutation { link_person_friends(key: "alice", target: "") { _key } }`,
+		`{ person(key: `,
+	}
+	for _, query := range cases {
+		if result := run(test, db, query, nil); !result.HasErrors() {
+			test.Errorf("No error for %s", query)
+		}
+	}
+}
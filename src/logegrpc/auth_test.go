@@ -0,0 +1,86 @@
+package logegrpc
+
+import (
+	"testing"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+
+	"logeauth"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func tokenContext(token string) context.Context {
+	var md, _ = TokenCredentials(token).GetRequestMetadata(context.Background())
+	return metadata.NewIncomingContext(context.Background(),
+		metadata.Pairs("authorization", md["authorization"]))
+}
+
+func TestAuth(test *testing.T) {
+	var server = testServer()
+	server.Guard = &logeauth.Guard{
+		Authenticator: logeauth.TokenAuthenticator{
+			"alice": &logeauth.Principal{ Name: "alice" },
+			"bob": &logeauth.Principal{ Name: "bob" },
+		},
+		Authorizer: logeauth.Policy{
+			{ Who: []string{"*"}, Types: []string{"test"}, Ops: []logeauth.Operation{logeauth.OpRead} },
+		},
+	}
+
+	_, err := server.Begin(context.Background(), &BeginRequest{})
+	if status.Code(err) != codes.Unauthenticated {
+		test.Errorf("Anonymous begin gave %v", err)
+	}
+
+	var alice = tokenContext("alice")
+	begin, err := server.Begin(alice, &BeginRequest{})
+	if err != nil {
+		test.Fatalf("Begin failed: %v", err)
+	}
+	var tid = begin.Transaction
+
+	if _, err := server.Read(alice, &ReadRequest{ tid, "test", "one" }); err != nil {
+		test.Errorf("Read failed: %v", err)
+	}
+
+	_, err = server.Write(alice, &WriteRequest{ tid, "test", "two", []byte(`{"Name":"Two"}`) })
+	if status.Code(err) != codes.PermissionDenied {
+		test.Errorf("Forbidden write gave %v", err)
+	}
+
+	_, err = server.Read(tokenContext("bob"), &ReadRequest{ tid, "test", "one" })
+	if status.Code(err) != codes.NotFound {
+		test.Errorf("Other principal's transaction gave %v", err)
+	}
+
+	if _, err := server.Rollback(alice, &RollbackRequest{ tid }); err != nil {
+		test.Errorf("Rollback failed: %v", err)
+	}
+}
+
+func TestUnverifiedCertificates(test *testing.T) {
+	var cert = &x509.Certificate{ Subject: pkix.Name{ CommonName: "alice" } }
+	var certContext = func(state tls.ConnectionState) context.Context {
+		return peer.NewContext(context.Background(), &peer.Peer{ AuthInfo: credentials.TLSInfo{ State: state } })
+	}
+
+	var creds = contextCredentials(certContext(tls.ConnectionState{ PeerCertificates: []*x509.Certificate{cert} }))
+	if len(creds.Certificates) != 0 {
+		test.Error("Unverified certificate used")
+	}
+
+	creds = contextCredentials(certContext(tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{cert},
+		VerifiedChains: [][]*x509.Certificate{{cert}},
+	}))
+	if len(creds.Certificates) != 1 || creds.Certificates[0] != cert {
+		test.Error("Verified certificate not used")
+	}
+}
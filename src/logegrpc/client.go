@@ -0,0 +1,86 @@
+package logegrpc
+
+import (
+	"context"
+	"encoding/json"
+
+	"google.golang.org/grpc"
+)
+
+type Client struct {
+	conn grpc.ClientConnInterface
+}
+
+type Transaction struct {
+	client *Client
+	id uint64
+}
+
+// Sends a bearer token with every call:
+//
+//   grpc.Dial(addr, grpc.WithPerRPCCredentials(logegrpc.TokenCredentials("...")), ...)
+type TokenCredentials string
+
+func (token TokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{ "authorization": "Bearer " + string(token) }, nil
+}
+
+func (token TokenCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
+func NewClient(conn grpc.ClientConnInterface) *Client {
+	return &Client{ conn: conn }
+}
+
+func (c *Client) invoke(ctx context.Context, method string, req interface{}, resp interface{}) error {
+	return c.conn.Invoke(ctx, "/" + serviceName + "/" + method, req, resp,
+		grpc.CallContentSubtype(codecName))
+}
+
+func (c *Client) Begin(ctx context.Context) (*Transaction, error) {
+	var resp BeginResponse
+	if err := c.invoke(ctx, "Begin", &BeginRequest{}, &resp); err != nil {
+		return nil, err
+	}
+	return &Transaction{ client: c, id: resp.Transaction }, nil
+}
+
+// Decodes the object into obj if it exists
+func (t *Transaction) Read(ctx context.Context, typeName string, key string, obj interface{}) (bool, error) {
+	var resp ReadResponse
+	var req = &ReadRequest{ Transaction: t.id, Type: typeName, Key: key }
+	if err := t.client.invoke(ctx, "Read", req, &resp); err != nil {
+		return false, err
+	}
+	if !resp.Found {
+		return false, nil
+	}
+	return true, json.Unmarshal(resp.Object, obj)
+}
+
+func (t *Transaction) Write(ctx context.Context, typeName string, key string, obj interface{}) error {
+	enc, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	var req = &WriteRequest{ Transaction: t.id, Type: typeName, Key: key, Object: enc }
+	return t.client.invoke(ctx, "Write", req, &WriteResponse{})
+}
+
+func (t *Transaction) Delete(ctx context.Context, typeName string, key string) error {
+	var req = &DeleteRequest{ Transaction: t.id, Type: typeName, Key: key }
+	return t.client.invoke(ctx, "Delete", req, &DeleteResponse{})
+}
+
+func (t *Transaction) Commit(ctx context.Context) (bool, error) {
+	var resp CommitResponse
+	if err := t.client.invoke(ctx, "Commit", &CommitRequest{ Transaction: t.id }, &resp); err != nil {
+		return false, err
+	}
+	return resp.Committed, nil
+}
+
+func (t *Transaction) Rollback(ctx context.Context) error {
+	return t.client.invoke(ctx, "Rollback", &RollbackRequest{ Transaction: t.id }, &RollbackResponse{})
+}
@@ -0,0 +1,83 @@
+package logegrpc
+
+import (
+	"encoding/json"
+
+	"google.golang.org/grpc/encoding"
+)
+
+// Messages travel as JSON via a registered codec, so there's no protoc
+// step. Objects are carried as raw JSON of the registered exemplar type.
+
+const codecName = "json"
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) Name() string {
+	return codecName
+}
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+type BeginRequest struct {
+}
+
+type BeginResponse struct {
+	Transaction uint64
+}
+
+type ReadRequest struct {
+	Transaction uint64
+	Type string
+	Key string
+}
+
+type ReadResponse struct {
+	Found bool
+	Object json.RawMessage
+}
+
+type WriteRequest struct {
+	Transaction uint64
+	Type string
+	Key string
+	Object json.RawMessage
+}
+
+type WriteResponse struct {
+}
+
+type DeleteRequest struct {
+	Transaction uint64
+	Type string
+	Key string
+}
+
+type DeleteResponse struct {
+}
+
+type CommitRequest struct {
+	Transaction uint64
+}
+
+type CommitResponse struct {
+	Committed bool
+	Retries int
+}
+
+type RollbackRequest struct {
+	Transaction uint64
+}
+
+type RollbackResponse struct {
+}
@@ -0,0 +1,463 @@
+package logegrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"loge"
+	"logeauth"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const serviceName = "loge.Loge"
+
+// With a Guard set, callers authenticate with "authorization: Bearer
+// <token>" metadata (see TokenCredentials) or a verified TLS client
+// certificate. Reads, writes and deletes are authorized per type, and
+// a transaction can only be used by the principal who began it.
+//
+// A transaction belongs to the connection which began it, and is
+// cancelled once it has gone unused for IdleTimeout (zero never does).
+type Server struct {
+	DB *loge.LogeDB
+	RetryTimeout time.Duration
+	IdleTimeout time.Duration
+	Guard *logeauth.Guard
+
+	lock sync.Mutex
+	lastID uint64
+	sessions map[uint64]*session
+}
+
+// Everything a client did in a transaction, so the server can replay it
+// when the commit conflicts instead of making the client start over.
+type session struct {
+	lock sync.Mutex
+	principal string
+	conn string
+	lastUsed time.Time
+	trans *loge.Transaction
+	ops []sessionOp
+}
+
+type sessionOp struct {
+	write bool
+	typeName string
+	key loge.LogeKey
+	found bool
+	object interface{}
+	encoded []byte
+}
+
+func NewServer(db *loge.LogeDB) *Server {
+	return &Server{
+		DB: db,
+		RetryTimeout: 5 * time.Second,
+		IdleTimeout: 10 * time.Minute,
+		sessions: make(map[uint64]*session),
+	}
+}
+
+func (s *Server) Register(registrar grpc.ServiceRegistrar) {
+	registrar.RegisterService(&serviceDesc, s)
+}
+
+// -----------------------------------------------
+// Methods
+// -----------------------------------------------
+
+func (s *Server) Begin(ctx context.Context, req *BeginRequest) (resp *BeginResponse, err error) {
+	defer recoverStatus(&err)
+
+	var principal = s.authenticate(ctx)
+	s.reapSessions()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.lastID++
+	s.sessions[s.lastID] = &session{
+		principal: principal,
+		conn: connection(ctx),
+		lastUsed: s.DB.Clock().Now(),
+		trans: s.DB.CreateTransaction(),
+	}
+	return &BeginResponse{ Transaction: s.lastID }, nil
+}
+
+func (s *Server) Read(ctx context.Context, req *ReadRequest) (resp *ReadResponse, err error) {
+	defer recoverStatus(&err)
+
+	var sess = s.getSession(ctx, req.Transaction)
+	sess.lock.Lock()
+	defer sess.lock.Unlock()
+
+	var op = sessionOp{
+		typeName: s.authorize(ctx, logeauth.OpRead, s.checkType(req.Type)),
+		key: loge.LogeKey(req.Key),
+	}
+	sess.read(sess.trans, &op)
+	sess.ops = append(sess.ops, op)
+
+	return &ReadResponse{ Found: op.found, Object: op.encoded }, nil
+}
+
+func (s *Server) Write(ctx context.Context, req *WriteRequest) (resp *WriteResponse, err error) {
+	defer recoverStatus(&err)
+
+	var sess = s.getSession(ctx, req.Transaction)
+	sess.lock.Lock()
+	defer sess.lock.Unlock()
+
+	var typeName = s.authorize(ctx, logeauth.OpWrite, s.checkType(req.Type))
+	var obj = s.DB.Type(typeName).NewValue()
+	if err := json.Unmarshal(req.Object, obj); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Bad object: %v", err)
+	}
+
+	var op = sessionOp{
+		write: true,
+		typeName: typeName,
+		key: loge.LogeKey(req.Key),
+		object: obj,
+	}
+	sess.apply(sess.trans, &op)
+	sess.ops = append(sess.ops, op)
+
+	return &WriteResponse{}, nil
+}
+
+func (s *Server) Delete(ctx context.Context, req *DeleteRequest) (resp *DeleteResponse, err error) {
+	defer recoverStatus(&err)
+
+	var sess = s.getSession(ctx, req.Transaction)
+	sess.lock.Lock()
+	defer sess.lock.Unlock()
+
+	var op = sessionOp{
+		write: true,
+		typeName: s.authorize(ctx, logeauth.OpDelete, s.checkType(req.Type)),
+		key: loge.LogeKey(req.Key),
+	}
+	sess.apply(sess.trans, &op)
+	sess.ops = append(sess.ops, op)
+
+	return &DeleteResponse{}, nil
+}
+
+func (s *Server) Commit(ctx context.Context, req *CommitRequest) (resp *CommitResponse, err error) {
+	defer recoverStatus(&err)
+
+	var sess = s.takeSession(ctx, req.Transaction)
+	sess.lock.Lock()
+	defer sess.lock.Unlock()
+
+	// Gives back whichever transaction a failed or panicking replay left
+	defer func() {
+		sess.trans.Abort()
+	}()
+
+	resp = &CommitResponse{}
+	if sess.trans.CommitContext(ctx) {
+		resp.Committed = true
+		return resp, nil
+	}
+
+	var clock = s.DB.Clock()
+	var start = clock.Now()
+	for sess.trans.GetState() == loge.ABORTED && clock.Now().Sub(start) < s.RetryTimeout {
+		resp.Retries++
+		sess.trans = s.DB.CreateTransaction()
+		if !sess.replay() {
+			break
+		}
+		if sess.trans.CommitContext(ctx) {
+			resp.Committed = true
+			break
+		}
+	}
+
+	return resp, nil
+}
+
+func (s *Server) Rollback(ctx context.Context, req *RollbackRequest) (resp *RollbackResponse, err error) {
+	defer recoverStatus(&err)
+
+	var sess = s.takeSession(ctx, req.Transaction)
+	sess.lock.Lock()
+	defer sess.lock.Unlock()
+
+	sess.trans.Cancel()
+	return &RollbackResponse{}, nil
+}
+
+// -----------------------------------------------
+// Sessions
+// -----------------------------------------------
+
+func (sess *session) read(trans *loge.Transaction, op *sessionOp) {
+	op.found = trans.Exists(op.typeName, op.key)
+	if !op.found {
+		op.encoded = nil
+		return
+	}
+
+	var enc, err = json.Marshal(trans.Read(op.typeName, op.key))
+	if err != nil {
+		panic(status.Errorf(codes.Internal, "Encode error: %v", err))
+	}
+	op.encoded = enc
+}
+
+func (sess *session) apply(trans *loge.Transaction, op *sessionOp) {
+	if op.object == nil {
+		trans.Delete(op.typeName, op.key)
+	} else {
+		trans.Set(op.typeName, op.key, op.object)
+	}
+}
+
+// Re-runs the recorded operations in a fresh transaction. Fails if any
+// read would now give the client a different answer.
+func (sess *session) replay() bool {
+	for _, op := range sess.ops {
+		if op.write {
+			sess.apply(sess.trans, &op)
+			continue
+		}
+
+		var check = op
+		sess.read(sess.trans, &check)
+		if check.found != op.found || !bytes.Equal(check.encoded, op.encoded) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Server) getSession(ctx context.Context, id uint64) *session {
+	var principal = s.authenticate(ctx)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	sess, ok := s.sessions[id]
+	if !ok || sess.principal != principal || sess.conn != connection(ctx) {
+		panic(status.Errorf(codes.NotFound, "No such transaction: %d", id))
+	}
+	sess.lastUsed = s.DB.Clock().Now()
+	return sess
+}
+
+func (s *Server) takeSession(ctx context.Context, id uint64) *session {
+	var sess = s.getSession(ctx, id)
+	s.lock.Lock()
+	delete(s.sessions, id)
+	s.lock.Unlock()
+	return sess
+}
+
+// Cancels the transactions of clients which have gone quiet, such as
+// those whose connections dropped. Done on Begin, so abandoned sessions
+// can't pile up.
+func (s *Server) reapSessions() {
+	if s.IdleTimeout <= 0 {
+		return
+	}
+
+	var now = s.DB.Clock().Now()
+	var idle = make([]*session, 0)
+	s.lock.Lock()
+	for id, sess := range s.sessions {
+		if now.Sub(sess.lastUsed) >= s.IdleTimeout {
+			delete(s.sessions, id)
+			idle = append(idle, sess)
+		}
+	}
+	s.lock.Unlock()
+
+	for _, sess := range idle {
+		sess.lock.Lock()
+		sess.trans.Abort()
+		sess.lock.Unlock()
+	}
+}
+
+// The client's address, which stays the same for as long as its
+// connection does
+func connection(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return p.Addr.String()
+	}
+	return ""
+}
+
+func (s *Server) checkType(typeName string) string {
+	if s.DB.Type(typeName) == nil {
+		panic(status.Errorf(codes.NotFound, "No such type: %s", typeName))
+	}
+	return typeName
+}
+
+// -----------------------------------------------
+// Auth
+// -----------------------------------------------
+
+// Returns the principal's name, or "" when there's no Guard
+func (s *Server) authenticate(ctx context.Context) string {
+	if s.Guard == nil {
+		return ""
+	}
+	principal, err := s.Guard.Authenticate(contextCredentials(ctx))
+	if err != nil {
+		panic(authStatus(err))
+	}
+	return principal.Name
+}
+
+func (s *Server) authorize(ctx context.Context, op logeauth.Operation, typeName string) string {
+	if s.Guard == nil {
+		return typeName
+	}
+	if _, err := s.Guard.Check(contextCredentials(ctx), op, typeName); err != nil {
+		panic(authStatus(err))
+	}
+	return typeName
+}
+
+func authStatus(err error) error {
+	switch {
+	case err == logeauth.ErrUnauthenticated:
+		return status.Error(codes.Unauthenticated, err.Error())
+	case logeauth.IsForbidden(err):
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+func contextCredentials(ctx context.Context) logeauth.Credentials {
+	var creds logeauth.Credentials
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, value := range md.Get("authorization") {
+			if strings.HasPrefix(value, "Bearer ") {
+				creds.Token = strings.TrimSpace(value[len("Bearer "):])
+			}
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(info.State.VerifiedChains) > 0 {
+			creds.Certificates = info.State.VerifiedChains[0]
+		}
+	}
+	return creds
+}
+
+func recoverStatus(err *error) {
+	var r = recover()
+	if r == nil {
+		return
+	}
+	if rerr, ok := r.(error); ok {
+		if _, ok := status.FromError(rerr); ok {
+			*err = rerr
+			return
+		}
+	}
+	*err = status.Error(codes.Internal, fmt.Sprintf("%v", r))
+}
+
+// -----------------------------------------------
+// Service description
+// -----------------------------------------------
+
+type loge_Server interface {
+	Begin(context.Context, *BeginRequest) (*BeginResponse, error)
+	Read(context.Context, *ReadRequest) (*ReadResponse, error)
+	Write(context.Context, *WriteRequest) (*WriteResponse, error)
+	Delete(context.Context, *DeleteRequest) (*DeleteResponse, error)
+	Commit(context.Context, *CommitRequest) (*CommitResponse, error)
+	Rollback(context.Context, *RollbackRequest) (*RollbackResponse, error)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*loge_Server)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Begin",
+			Handler: unaryHandler("Begin", func() interface{} { return &BeginRequest{} },
+				func(srv loge_Server, ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.Begin(ctx, req.(*BeginRequest))
+				}),
+		},
+		{
+			MethodName: "Read",
+			Handler: unaryHandler("Read", func() interface{} { return &ReadRequest{} },
+				func(srv loge_Server, ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.Read(ctx, req.(*ReadRequest))
+				}),
+		},
+		{
+			MethodName: "Write",
+			Handler: unaryHandler("Write", func() interface{} { return &WriteRequest{} },
+				func(srv loge_Server, ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.Write(ctx, req.(*WriteRequest))
+				}),
+		},
+		{
+			MethodName: "Delete",
+			Handler: unaryHandler("Delete", func() interface{} { return &DeleteRequest{} },
+				func(srv loge_Server, ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.Delete(ctx, req.(*DeleteRequest))
+				}),
+		},
+		{
+			MethodName: "Commit",
+			Handler: unaryHandler("Commit", func() interface{} { return &CommitRequest{} },
+				func(srv loge_Server, ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.Commit(ctx, req.(*CommitRequest))
+				}),
+		},
+		{
+			MethodName: "Rollback",
+			Handler: unaryHandler("Rollback", func() interface{} { return &RollbackRequest{} },
+				func(srv loge_Server, ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.Rollback(ctx, req.(*RollbackRequest))
+				}),
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+type unaryCall func(srv loge_Server, ctx context.Context, req interface{}) (interface{}, error)
+
+func unaryHandler(method string, newRequest func() interface{}, call unaryCall) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		var req = newRequest()
+		if err := dec(req); err != nil {
+			return nil, err
+		}
+		if interceptor == nil {
+			return call(srv.(loge_Server), ctx, req)
+		}
+		var info = &grpc.UnaryServerInfo{
+			Server: srv,
+			FullMethod: "/" + serviceName + "/" + method,
+		}
+		var handler = func(ctx context.Context, req interface{}) (interface{}, error) {
+			return call(srv.(loge_Server), ctx, req)
+		}
+		return interceptor(ctx, req, info, handler)
+	}
+}
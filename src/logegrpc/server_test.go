@@ -0,0 +1,164 @@
+package logegrpc
+
+import (
+	"testing"
+	"context"
+	"io"
+	"net"
+	"time"
+
+	"loge"
+	"logetest"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type TestObj struct {
+	Name string
+}
+
+func testServer() *Server {
+	var db = loge.NewLogeDB(loge.NewMemStore())
+	db.CreateType(loge.NewTypeDef("test", 1, &TestObj{}))
+	db.SetOne("test", "one", &TestObj{ Name: "One" })
+	return NewServer(db)
+}
+
+func begin(server *Server) uint64 {
+	resp, _ := server.Begin(context.Background(), &BeginRequest{})
+	return resp.Transaction
+}
+
+func TestReadWrite(test *testing.T) {
+	var server = testServer()
+	var ctx = context.Background()
+	var tid = begin(server)
+
+	resp, err := server.Read(ctx, &ReadRequest{ tid, "test", "one" })
+	if err != nil || !resp.Found || string(resp.Object) != `{"Name":"One"}` {
+		test.Fatalf("Wrong read: %v %s (%v)", resp.Found, resp.Object, err)
+	}
+
+	_, err = server.Write(ctx, &WriteRequest{ tid, "test", "two", []byte(`{"Name":"Two"}`) })
+	if err != nil {
+		test.Fatalf("Write failed: %v", err)
+	}
+
+	commit, err := server.Commit(ctx, &CommitRequest{ tid })
+	if err != nil || !commit.Committed {
+		test.Fatalf("Commit failed: %v", err)
+	}
+
+	if server.DB.ReadOne("test", "two").(*TestObj).Name != "Two" {
+		test.Error("Write missing after commit")
+	}
+
+	_, err = server.Read(ctx, &ReadRequest{ tid, "test", "one" })
+	if status.Code(err) != codes.NotFound {
+		test.Errorf("Read from committed transaction: %v", err)
+	}
+
+	_, err = server.Read(ctx, &ReadRequest{ begin(server), "nope", "one" })
+	if status.Code(err) != codes.NotFound {
+		test.Errorf("Read of unknown type: %v", err)
+	}
+}
+
+func TestCommitRetry(test *testing.T) {
+	var server = testServer()
+	var ctx = context.Background()
+
+	var tid = begin(server)
+	server.Write(ctx, &WriteRequest{ tid, "test", "one", []byte(`{"Name":"Mine"}`) })
+
+	server.DB.SetOne("test", "one", &TestObj{ Name: "Theirs" })
+
+	commit, _ := server.Commit(ctx, &CommitRequest{ tid })
+	if !commit.Committed || commit.Retries != 1 {
+		test.Errorf("Blind write wasn't retried: %#v", commit)
+	}
+
+	if server.DB.ReadOne("test", "one").(*TestObj).Name != "Mine" {
+		test.Error("Retried write missing")
+	}
+}
+
+func TestCommitStaleRead(test *testing.T) {
+	var server = testServer()
+	var ctx = context.Background()
+
+	var tid = begin(server)
+	server.Read(ctx, &ReadRequest{ tid, "test", "one" })
+	server.Write(ctx, &WriteRequest{ tid, "test", "one", []byte(`{"Name":"Mine"}`) })
+
+	server.DB.SetOne("test", "one", &TestObj{ Name: "Theirs" })
+
+	commit, _ := server.Commit(ctx, &CommitRequest{ tid })
+	if commit.Committed {
+		test.Error("Commit succeeded after stale read")
+	}
+
+	if server.DB.ReadOne("test", "one").(*TestObj).Name != "Theirs" {
+		test.Error("Stale write applied")
+	}
+}
+
+func TestCommitReplayPanic(test *testing.T) {
+	var store = loge.NewFaultStore(loge.NewMemStore())
+	var db = loge.NewLogeDB(store)
+	db.CreateType(loge.NewTypeDef("test", 1, &TestObj{}))
+	db.SetOne("test", "one", &TestObj{ Name: "One" })
+	var server = NewServer(db)
+	var ctx = context.Background()
+
+	var tid = begin(server)
+	server.Write(ctx, &WriteRequest{ tid, "test", "two", []byte(`{"Name":"Two"}`) })
+	server.Read(ctx, &ReadRequest{ tid, "test", "one" })
+
+	db.SetOne("test", "two", &TestObj{ Name: "Theirs" })
+	store.Script(loge.FaultGet, loge.Fault{ Err: io.ErrUnexpectedEOF })
+
+	if _, err := server.Commit(ctx, &CommitRequest{ tid }); err == nil {
+		test.Fatal("Commit succeeded through a failed replay")
+	}
+	if cached := db.Stats().CachedObjects; cached != 0 {
+		test.Errorf("Replayed transaction left %d objects cached", cached)
+	}
+}
+
+func TestSessionConnection(test *testing.T) {
+	var server = testServer()
+	var mine = peer.NewContext(context.Background(), &peer.Peer{ Addr: &net.TCPAddr{ Port: 1 } })
+	var theirs = peer.NewContext(context.Background(), &peer.Peer{ Addr: &net.TCPAddr{ Port: 2 } })
+
+	resp, _ := server.Begin(mine, &BeginRequest{})
+	if _, err := server.Read(theirs, &ReadRequest{ resp.Transaction, "test", "one" }); status.Code(err) != codes.NotFound {
+		test.Errorf("Read from another connection: %v", err)
+	}
+	if _, err := server.Read(mine, &ReadRequest{ resp.Transaction, "test", "one" }); err != nil {
+		test.Errorf("Read from own connection failed: %v", err)
+	}
+}
+
+func TestIdleSessions(test *testing.T) {
+	var server = testServer()
+	var clock = logetest.NewVirtualClock(time.Unix(1000, 0))
+	server.DB.SetClock(clock)
+	var ctx = context.Background()
+
+	var idle = begin(server)
+	var busy = begin(server)
+	clock.Advance(server.IdleTimeout / 2)
+	server.Read(ctx, &ReadRequest{ busy, "test", "one" })
+	clock.Advance(server.IdleTimeout / 2)
+	begin(server)
+
+	if _, err := server.Read(ctx, &ReadRequest{ idle, "test", "one" }); status.Code(err) != codes.NotFound {
+		test.Errorf("Idle transaction not reaped: %v", err)
+	}
+	if _, err := server.Read(ctx, &ReadRequest{ busy, "test", "one" }); err != nil {
+		test.Errorf("Busy transaction reaped: %v", err)
+	}
+}
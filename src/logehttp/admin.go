@@ -0,0 +1,78 @@
+package logehttp
+
+import (
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"logeauth"
+)
+
+// Admin routes, only served with a Guard, and only to principals allowed
+// the "admin" operation:
+//
+//   GET  /admin/stats
+//   POST /admin/flush-cache
+//   POST /admin/compact
+//   POST /admin/backup              {"path": "mydb-20240101"}
+//   POST /admin/rebuild-indexes
+//
+// Backup paths are relative to the server's BackupDir, and can't leave
+// it; without one, backups are refused.
+func (s *Server) handleAdmin(w http.ResponseWriter, r *http.Request, args []string) {
+	if s.Guard == nil {
+		fail(http.StatusForbidden, "Admin routes need a Guard")
+	}
+	if len(args) != 1 {
+		fail(http.StatusNotFound, "Not found")
+	}
+
+	if args[0] == "stats" {
+		checkRoute(r, args, 1, "GET")
+		s.authorize(r, logeauth.OpAdmin, "")
+		writeJSON(w, http.StatusOK, s.DB.Stats())
+		return
+	}
+
+	checkRoute(r, args, 1, "POST")
+	s.authorize(r, logeauth.OpAdmin, "")
+
+	switch args[0] {
+	case "flush-cache":
+		writeJSON(w, http.StatusOK, map[string]int{ "dropped": s.DB.FlushCache() })
+	case "compact":
+		s.DB.Compact()
+		w.WriteHeader(http.StatusNoContent)
+	case "backup":
+		var req struct {
+			Path string `json:"path"`
+		}
+		readJSON(r, &req)
+		if err := s.DB.Backup(s.backupPath(req.Path)); err != nil {
+			fail(http.StatusInternalServerError, err.Error())
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case "rebuild-indexes":
+		writeJSON(w, http.StatusOK, map[string]int{ "entries": s.DB.RebuildIndexes() })
+	default:
+		fail(http.StatusNotFound, "Not found")
+	}
+}
+
+func (s *Server) backupPath(path string) string {
+	if s.BackupDir == "" {
+		fail(http.StatusForbidden, "Backups need a BackupDir")
+	}
+	if path == "" {
+		fail(http.StatusBadRequest, "Backup needs a path")
+	}
+	if filepath.IsAbs(path) || strings.HasPrefix(path, "/") {
+		fail(http.StatusBadRequest, "Backup path must be relative")
+	}
+	for _, part := range strings.Split(filepath.ToSlash(path), "/") {
+		if part == ".." {
+			fail(http.StatusBadRequest, "Backup path can't contain ..")
+		}
+	}
+	return filepath.Join(s.BackupDir, path)
+}
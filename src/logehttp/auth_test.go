@@ -0,0 +1,178 @@
+package logehttp
+
+import (
+	"testing"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"loge"
+	"logeauth"
+)
+
+func TestAuth(test *testing.T) {
+	var db = loge.NewLogeDB(loge.NewMemStore())
+	db.CreateType(loge.NewTypeDef("test", 1, &TestObj{}))
+
+	var server = NewServer(db)
+	server.Guard = &logeauth.Guard{
+		Authenticator: logeauth.TokenAuthenticator{
+			"writer": &logeauth.Principal{ Name: "writer" },
+			"reader": &logeauth.Principal{ Name: "reader" },
+		},
+		Authorizer: logeauth.Policy{
+			{ Who: []string{"writer"}, Types: []string{"*"}, Ops: []logeauth.Operation{"*"} },
+			{ Who: []string{"reader"}, Types: []string{"test"}, Ops: []logeauth.Operation{logeauth.OpRead} },
+		},
+	}
+	var ts = httptest.NewServer(server)
+	defer ts.Close()
+
+	var do = func(method string, token string, body string) int {
+		req, _ := http.NewRequest(method, ts.URL + "/objects/test/one", strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer " + token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			test.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := do("GET", "", ""); status != http.StatusUnauthorized {
+		test.Errorf("Anonymous read gave %d", status)
+	}
+	if status := do("PUT", "writer", `{"Name": "One"}`); status != http.StatusOK {
+		test.Errorf("Writer PUT gave %d", status)
+	}
+	if status := do("GET", "reader", ""); status != http.StatusOK {
+		test.Errorf("Reader GET gave %d", status)
+	}
+	if status := do("DELETE", "reader", ""); status != http.StatusForbidden {
+		test.Errorf("Reader DELETE gave %d", status)
+	}
+}
+
+func TestAdmin(test *testing.T) {
+	var db = loge.NewLogeDB(loge.NewMemStore())
+	db.CreateType(loge.NewTypeDef("test", 1, &TestObj{}))
+	db.SetOne("test", "one", &TestObj{ "One" })
+
+	var server = NewServer(db)
+	var ts = httptest.NewServer(server)
+	defer ts.Close()
+
+	if status := request(test, "GET", ts.URL + "/admin/stats", "", nil); status != http.StatusForbidden {
+		test.Errorf("Admin without Guard gave %d", status)
+	}
+
+	server.Guard = &logeauth.Guard{
+		Authenticator: logeauth.TokenAuthenticator{
+			"ops": &logeauth.Principal{ Name: "ops" },
+			"app": &logeauth.Principal{ Name: "app" },
+		},
+		Authorizer: logeauth.Policy{
+			{ Who: []string{"ops"}, Ops: []logeauth.Operation{logeauth.OpAdmin} },
+			{ Who: []string{"app"}, Types: []string{"*"}, Ops: []logeauth.Operation{logeauth.OpRead} },
+		},
+	}
+
+	var do = func(method string, path string, token string) (int, map[string]interface{}) {
+		req, _ := http.NewRequest(method, ts.URL + path, nil)
+		req.Header.Set("Authorization", "Bearer " + token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			test.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var result map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&result)
+		return resp.StatusCode, result
+	}
+
+	if status, _ := do("GET", "/admin/stats", "app"); status != http.StatusForbidden {
+		test.Errorf("Non-admin stats gave %d", status)
+	}
+
+	status, stats := do("GET", "/admin/stats", "ops")
+	if status != http.StatusOK || stats["Commits"] != 1.0 {
+		test.Errorf("Wrong stats: %d %v", status, stats)
+	}
+
+	if status, _ := do("POST", "/admin/flush-cache", "ops"); status != http.StatusOK {
+		test.Errorf("Flush gave %d", status)
+	}
+	if status, _ := do("POST", "/admin/compact", "ops"); status != http.StatusNoContent {
+		test.Errorf("Compact gave %d", status)
+	}
+	if status, _ := do("GET", "/admin/compact", "ops"); status != http.StatusMethodNotAllowed {
+		test.Errorf("GET compact gave %d", status)
+	}
+}
+
+func TestAdminBackup(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "logehttp-backup")
+	defer os.RemoveAll(dir)
+
+	var db = loge.NewLogeDB(loge.NewMemStore())
+	db.CreateType(loge.NewTypeDef("test", 1, &TestObj{}))
+	var server = NewServer(db)
+	server.Guard = &logeauth.Guard{
+		Authenticator: logeauth.TokenAuthenticator{ "ops": &logeauth.Principal{ Name: "ops" } },
+	}
+	var ts = httptest.NewServer(server)
+	defer ts.Close()
+
+	var backup = func(path string) int {
+		var body, _ = json.Marshal(map[string]string{ "path": path })
+		req, _ := http.NewRequest("POST", ts.URL + "/admin/backup", strings.NewReader(string(body)))
+		req.Header.Set("Authorization", "Bearer ops")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			test.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := backup("copy"); status != http.StatusForbidden {
+		test.Errorf("Backup without BackupDir gave %d", status)
+	}
+
+	server.BackupDir = dir
+	for _, path := range []string{ "", filepath.Join(dir, "copy"), "../copy", "a/../../copy" } {
+		if status := backup(path); status != http.StatusBadRequest {
+			test.Errorf("Backup to %q gave %d", path, status)
+		}
+	}
+	if status := backup("copy"); status != http.StatusNoContent {
+		test.Errorf("Backup gave %d", status)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "copy")); err != nil {
+		test.Errorf("Backup not in BackupDir: %v", err)
+	}
+}
+
+func TestUnverifiedCertificates(test *testing.T) {
+	var cert = &x509.Certificate{ Subject: pkix.Name{ CommonName: "alice" } }
+	var req = httptest.NewRequest("GET", "/types", nil)
+
+	req.TLS = &tls.ConnectionState{ PeerCertificates: []*x509.Certificate{cert} }
+	if creds := requestCredentials(req); len(creds.Certificates) != 0 {
+		test.Error("Unverified certificate used")
+	}
+
+	req.TLS.VerifiedChains = [][]*x509.Certificate{{cert}}
+	if creds := requestCredentials(req); len(creds.Certificates) != 1 || creds.Certificates[0] != cert {
+		test.Error("Verified certificate not used")
+	}
+}
@@ -0,0 +1,78 @@
+package logehttp
+
+import (
+	"testing"
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"loge"
+)
+
+func TestFeed(test *testing.T) {
+	var db = loge.NewLogeDB(loge.NewMemStore())
+	db.CreateType(loge.NewTypeDef("test", 1, &TestObj{}))
+	var server = httptest.NewServer(NewServer(db))
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	io.WriteString(conn, "GET /feed?type=test&prefix=a HTTP/1.1\r\n" +
+		"Host: loge\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+
+	var reader = bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if resp.StatusCode != 101 || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		test.Fatalf("Bad handshake: %v %v", resp.Status, resp.Header)
+	}
+
+	// Wait for the handler to subscribe
+	time.Sleep(50 * time.Millisecond)
+
+	db.SetOne("test", "bee", &TestObj{ Name: "Filtered" })
+	db.SetOne("test", "ant", &TestObj{ Name: "Ant" })
+
+	var header = make([]byte, 2)
+	io.ReadFull(reader, header)
+	var payload = make([]byte, header[1])
+	io.ReadFull(reader, payload)
+
+	var message map[string]interface{}
+	if err := json.Unmarshal(payload, &message); err != nil {
+		test.Fatalf("Bad message %q: %v", payload, err)
+	}
+
+	if header[0] != 0x81 || message["key"] != "ant" || message["object"].(map[string]interface{})["Name"] != "Ant" {
+		test.Errorf("Wrong feed message: %x %v", header, message)
+	}
+
+	// Masked close frame
+	conn.Write([]byte{ 0x88, 0x80, 1, 2, 3, 4 })
+	io.ReadFull(reader, header)
+	if header[0] != 0x88 {
+		test.Errorf("No close reply: %x", header)
+	}
+}
+
+func TestFeedRequiresUpgrade(test *testing.T) {
+	var server = testServer()
+	defer server.Close()
+
+	if request(test, "GET", server.URL + "/feed", "", nil) != 400 {
+		test.Error("Plain request to feed accepted")
+	}
+}
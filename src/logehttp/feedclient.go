@@ -0,0 +1,157 @@
+package logehttp
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"loge"
+)
+
+// A connection to a server's /feed. Changes committed after DialFeed
+// returns are all delivered, in order, until Next fails.
+type FeedClient struct {
+	conn net.Conn
+	reader *bufio.Reader
+}
+
+// One change from the feed, with the object left as JSON
+type FeedMessage struct {
+	Type string `json:"type"`
+	Key loge.LogeKey `json:"key"`
+	Link string `json:"link"`
+	SnapshotID uint64 `json:"snapshot"`
+	Time time.Time `json:"time"`
+	Object json.RawMessage `json:"object"`
+	Links []loge.LogeKey `json:"links"`
+	Deleted bool `json:"deleted"`
+}
+
+var ErrFeedClosed = errors.New("Feed closed")
+
+// feedURL is e.g. "http://host:8080/feed?type=person"; ws and wss
+// schemes work too. The header is sent with the upgrade request, for
+// Authorization.
+func DialFeed(ctx context.Context, feedURL string, header http.Header) (*FeedClient, error) {
+	u, err := url.Parse(feedURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var dialer net.Dialer
+	var conn net.Conn
+	switch u.Scheme {
+	case "http", "ws":
+		conn, err = dialer.DialContext(ctx, "tcp", hostPort(u, "80"))
+	case "https", "wss":
+		conn, err = (&tls.Dialer{ NetDialer: &dialer }).DialContext(ctx, "tcp", hostPort(u, "443"))
+	default:
+		err = fmt.Errorf("Unsupported feed URL: %s", feedURL)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var nonce = make([]byte, 16)
+	rand.Read(nonce)
+
+	var req = &http.Request{
+		Method: "GET",
+		URL: &url.URL{ Path: u.Path, RawQuery: u.RawQuery },
+		Host: u.Host,
+		Header: make(http.Header),
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", base64.StdEncoding.EncodeToString(nonce))
+	req.Header.Set("Sec-WebSocket-Version", "13")
+
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	var reader = bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		conn.Close()
+		return nil, fmt.Errorf("Feed refused: %s", resp.Status)
+	}
+
+	return &FeedClient{ conn: conn, reader: reader }, nil
+}
+
+func (fc *FeedClient) Next() (*FeedMessage, error) {
+	payload, err := fc.readFrame()
+	if err != nil {
+		return nil, err
+	}
+	var msg FeedMessage
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return nil, fmt.Errorf("Bad feed message: %v", err)
+	}
+	return &msg, nil
+}
+
+func (fc *FeedClient) Close() error {
+	return fc.conn.Close()
+}
+
+// The server only sends unfragmented, unmasked text and close frames
+func (fc *FeedClient) readFrame() ([]byte, error) {
+	var header = make([]byte, 2)
+	if _, err := io.ReadFull(fc.reader, header); err != nil {
+		return nil, err
+	}
+
+	var length = uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext = make([]byte, 2)
+		if _, err := io.ReadFull(fc.reader, ext); err != nil {
+			return nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		var ext = make([]byte, 8)
+		if _, err := io.ReadFull(fc.reader, ext); err != nil {
+			return nil, err
+		}
+		length = binary.BigEndian.Uint64(ext)
+	}
+
+	var payload = make([]byte, length)
+	if _, err := io.ReadFull(fc.reader, payload); err != nil {
+		return nil, err
+	}
+
+	if header[0] & 0x0F == ws_OP_CLOSE {
+		return nil, ErrFeedClosed
+	}
+	return payload, nil
+}
+
+func hostPort(u *url.URL, defaultPort string) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	return net.JoinHostPort(u.Hostname(), defaultPort)
+}
@@ -0,0 +1,470 @@
+package logehttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"loge"
+	"logeauth"
+)
+
+// Routes:
+//
+//   GET    /types
+//   GET    /objects/{type}?prefix=&from=&limit=
+//   GET    /objects/{type}/{key}
+//   PUT    /objects/{type}/{key}
+//   DELETE /objects/{type}/{key}
+//   GET    /links/{type}/{link}/{key}
+//   PUT    /links/{type}/{link}/{key}
+//   PUT    /links/{type}/{link}/{key}/{target}
+//   DELETE /links/{type}/{link}/{key}/{target}
+//   GET    /find/{type}/{link}/{target}?prefix=&from=&limit=
+//   GET    /feed?type=&prefix=                       (WebSocket)
+//   /admin/...                                       (see admin.go)
+//
+// Keys are in their Path form, escaped as one segment, so
+// "/objects/post/user%2F2024" is loge.Key("user", "2024"); a key without
+// a "/" is a plain key. A prefix ending in "/" covers every key under
+// the parts before it.
+//
+// Each request runs in its own transaction. The feed streams committed
+// changes as JSON text messages, optionally filtered by type and key
+// prefix.
+//
+// With a Guard set, callers authenticate with "Authorization: Bearer
+// <token>" or a verified TLS client certificate, and every request is
+// checked against its Authorizer: 401 if unauthenticated, 403 if
+// forbidden.
+type Server struct {
+	DB *loge.LogeDB
+	Timeout time.Duration
+	FeedBuffer int
+	Guard *logeauth.Guard
+	BackupDir string
+}
+
+type httpError struct {
+	Status int
+	Message string
+}
+
+func NewServer(db *loge.LogeDB) *Server {
+	return &Server{
+		DB: db,
+		Timeout: 5 * time.Second,
+		FeedBuffer: 1000,
+	}
+}
+
+func (s *Server) ListenAndServe(addr string) error {
+	return http.ListenAndServe(addr, s)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	defer func() {
+		if err := recover(); err != nil {
+			if herr, ok := err.(httpError); ok {
+				writeJSON(w, herr.Status, map[string]string{ "error": herr.Message })
+				return
+			}
+			writeJSON(w, http.StatusInternalServerError,
+				map[string]string{ "error": fmt.Sprintf("%v", err) })
+		}
+	}()
+
+	var parts = splitPath(r.URL)
+	if len(parts) == 0 {
+		fail(http.StatusNotFound, "Not found")
+	}
+
+	switch parts[0] {
+	case "types":
+		s.handleTypes(w, r, parts[1:])
+	case "objects":
+		s.handleObjects(w, r, parts[1:])
+	case "links":
+		s.handleLinks(w, r, parts[1:])
+	case "find":
+		s.handleFind(w, r, parts[1:])
+	case "feed":
+		s.handleFeed(w, r, parts[1:])
+	case "admin":
+		s.handleAdmin(w, r, parts[1:])
+	default:
+		fail(http.StatusNotFound, "Not found")
+	}
+}
+
+// -----------------------------------------------
+// Handlers
+// -----------------------------------------------
+
+func (s *Server) handleTypes(w http.ResponseWriter, r *http.Request, args []string) {
+	checkRoute(r, args, 0, "GET")
+	s.authorize(r, logeauth.OpList, "")
+
+	var types = make([]map[string]interface{}, 0)
+	for _, typ := range s.DB.Types() {
+		var links = make(map[string]string)
+		for name, info := range typ.Links {
+			links[name] = info.Target
+		}
+		types = append(types, map[string]interface{}{
+			"name": typ.Name,
+			"version": typ.Version,
+			"links": links,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, types)
+}
+
+func (s *Server) handleObjects(w http.ResponseWriter, r *http.Request, args []string) {
+	if len(args) == 1 {
+		checkRoute(r, args, 1, "GET")
+		var typeName = s.checkType(args[0])
+		s.authorize(r, logeauth.OpList, typeName)
+		var from, limit = sliceArgs(r)
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"keys": s.DB.ListPrefix(typeName, prefixArg(r), from, limit),
+		})
+		return
+	}
+
+	checkRoute(r, args, 2, "GET", "PUT", "DELETE")
+	var typeName = s.checkType(args[0])
+	var key = parseKey(args[1])
+	s.authorize(r, methodOps[r.Method], typeName)
+
+	switch r.Method {
+	case "GET":
+		var obj interface{}
+		var found bool
+		s.transact(func (t *loge.Transaction) {
+			found = t.Exists(typeName, key)
+			obj = t.Read(typeName, key)
+		})
+		if !found {
+			fail(http.StatusNotFound, "No such object")
+		}
+		writeJSON(w, http.StatusOK, obj)
+
+	case "PUT":
+		var obj = s.DB.Type(typeName).NewValue()
+		readJSON(r, obj)
+		s.transact(func (t *loge.Transaction) {
+			t.Set(typeName, key, obj)
+		})
+		writeJSON(w, http.StatusOK, obj)
+
+	case "DELETE":
+		s.transact(func (t *loge.Transaction) {
+			t.Delete(typeName, key)
+		})
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *Server) handleLinks(w http.ResponseWriter, r *http.Request, args []string) {
+	if len(args) == 4 {
+		checkRoute(r, args, 4, "PUT", "DELETE")
+	} else {
+		checkRoute(r, args, 3, "GET", "PUT")
+	}
+
+	var typeName = s.checkType(args[0])
+	var linkName = s.checkLink(typeName, args[1])
+	var key = parseKey(args[2])
+	if r.Method == "GET" {
+		s.authorize(r, logeauth.OpRead, typeName)
+	} else {
+		s.authorize(r, logeauth.OpLink, typeName)
+	}
+
+	var targets []loge.LogeKey
+	if len(args) == 3 && r.Method == "PUT" {
+		readJSON(r, &targets)
+		for _, target := range targets {
+			if loge.ValidateKey(target) != nil {
+				fail(http.StatusBadRequest, fmt.Sprintf("Bad key: %q", target))
+			}
+		}
+	}
+
+	var links []loge.LogeKey
+	s.transact(func (t *loge.Transaction) {
+		switch {
+		case len(args) == 4 && r.Method == "PUT":
+			t.AddLink(typeName, linkName, key, parseKey(args[3]))
+		case len(args) == 4 && r.Method == "DELETE":
+			t.RemoveLink(typeName, linkName, key, parseKey(args[3]))
+		case r.Method == "PUT":
+			t.SetLinks(typeName, linkName, key, targets)
+		}
+		links = t.ReadLinks(typeName, linkName, key)
+	})
+
+	if links == nil {
+		links = []loge.LogeKey{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{ "keys": links })
+}
+
+func (s *Server) handleFind(w http.ResponseWriter, r *http.Request, args []string) {
+	checkRoute(r, args, 3, "GET")
+	var typeName = s.checkType(args[0])
+	var linkName = s.checkLink(typeName, args[1])
+	var target = parseKey(args[2])
+	s.authorize(r, logeauth.OpFind, typeName)
+	var from, limit = sliceArgs(r)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": s.DB.FindPrefix(typeName, linkName, target, prefixArg(r), from, limit),
+	})
+}
+
+type feedMessage struct {
+	Type string `json:"type"`
+	Key loge.LogeKey `json:"key"`
+	Link string `json:"link,omitempty"`
+	SnapshotID uint64 `json:"snapshot"`
+	Time time.Time `json:"time"`
+	Object interface{} `json:"object,omitempty"`
+	Links []loge.LogeKey `json:"links,omitempty"`
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+func (s *Server) handleFeed(w http.ResponseWriter, r *http.Request, args []string) {
+	checkRoute(r, args, 0, "GET")
+
+	var typeName = r.URL.Query().Get("type")
+	// Unfiltered, each change is authorized for its own type instead
+	var principal *logeauth.Principal
+	if typeName != "" {
+		principal = s.authorize(r, logeauth.OpRead, s.checkType(typeName))
+	} else {
+		principal = s.authenticate(r)
+	}
+	var prefix = prefixArg(r)
+
+	// Subscribed before the handshake completes, so clients see every
+	// change committed after it
+	var sub = s.DB.Subscribe(s.FeedBuffer)
+	defer sub.Close()
+
+	ws, ok := upgradeWebsocket(w, r)
+	if !ok {
+		fail(http.StatusBadRequest, "WebSocket upgrade required")
+	}
+	defer ws.Close()
+
+	var closed = make(chan bool)
+	go func() {
+		ws.waitClose()
+		close(closed)
+	}()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case change, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if typeName != "" && change.Type != typeName {
+				continue
+			}
+			if !change.Key.HasPrefix(prefix) {
+				continue
+			}
+			if typeName == "" && !s.allowed(principal, logeauth.OpRead, change.Type) {
+				continue
+			}
+
+			enc, err := json.Marshal(feedMessage(change))
+			if err != nil {
+				continue
+			}
+			if ws.WriteText(enc) != nil {
+				return
+			}
+		}
+	}
+}
+
+// -----------------------------------------------
+// Helpers
+// -----------------------------------------------
+
+func (s *Server) transact(actor loge.Transactor) {
+	if !s.DB.Transact(actor, s.Timeout) {
+		fail(http.StatusConflict, "Transaction failed")
+	}
+}
+
+var methodOps = map[string]logeauth.Operation{
+	"GET": logeauth.OpRead,
+	"PUT": logeauth.OpWrite,
+	"DELETE": logeauth.OpDelete,
+}
+
+// Returns nil when there's no Guard
+func (s *Server) authenticate(r *http.Request) *logeauth.Principal {
+	if s.Guard == nil {
+		return nil
+	}
+
+	principal, err := s.Guard.Authenticate(requestCredentials(r))
+	if err != nil {
+		fail(http.StatusUnauthorized, err.Error())
+	}
+	return principal
+}
+
+// Returns nil when there's no Guard
+func (s *Server) authorize(r *http.Request, op logeauth.Operation, typeName string) *logeauth.Principal {
+	if s.Guard == nil {
+		return nil
+	}
+
+	principal, err := s.Guard.Check(requestCredentials(r), op, typeName)
+	switch {
+	case err == logeauth.ErrUnauthenticated:
+		fail(http.StatusUnauthorized, err.Error())
+	case logeauth.IsForbidden(err):
+		fail(http.StatusForbidden, err.Error())
+	case err != nil:
+		panic(err)
+	}
+	return principal
+}
+
+func (s *Server) allowed(principal *logeauth.Principal, op logeauth.Operation, typeName string) bool {
+	if s.Guard == nil || s.Guard.Authorizer == nil {
+		return true
+	}
+	return s.Guard.Authorizer.Authorize(principal, op, typeName) == nil
+}
+
+func requestCredentials(r *http.Request) logeauth.Credentials {
+	var creds logeauth.Credentials
+	var header = r.Header.Get("Authorization")
+	if strings.HasPrefix(header, "Bearer ") {
+		creds.Token = strings.TrimSpace(header[len("Bearer "):])
+	}
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		creds.Certificates = r.TLS.VerifiedChains[0]
+	}
+	return creds
+}
+
+func (s *Server) checkType(typeName string) string {
+	if s.DB.Type(typeName) == nil {
+		fail(http.StatusNotFound, fmt.Sprintf("No such type: %s", typeName))
+	}
+	return typeName
+}
+
+func (s *Server) checkLink(typeName string, linkName string) string {
+	if _, ok := s.DB.Type(typeName).Links[linkName]; !ok {
+		fail(http.StatusNotFound, fmt.Sprintf("No such link: %s", linkName))
+	}
+	return linkName
+}
+
+func checkRoute(r *http.Request, args []string, count int, methods ...string) {
+	if len(args) != count {
+		fail(http.StatusNotFound, "Not found")
+	}
+	for _, method := range methods {
+		if r.Method == method {
+			return
+		}
+	}
+	fail(http.StatusMethodNotAllowed, "Method not allowed")
+}
+
+func fail(status int, message string) {
+	panic(httpError{ status, message })
+}
+
+func splitPath(u *url.URL) []string {
+	var parts []string
+	for _, part := range strings.Split(strings.Trim(u.EscapedPath(), "/"), "/") {
+		if part == "" {
+			continue
+		}
+		unescaped, err := url.PathUnescape(part)
+		if err != nil {
+			fail(http.StatusBadRequest, "Bad path")
+		}
+		parts = append(parts, unescaped)
+	}
+	return parts
+}
+
+func sliceArgs(r *http.Request) (loge.LogeKey, int) {
+	var query = r.URL.Query()
+	var limit = -1
+	if query.Get("limit") != "" {
+		var err error
+		limit, err = strconv.Atoi(query.Get("limit"))
+		if err != nil {
+			fail(http.StatusBadRequest, "Bad limit")
+		}
+	}
+	var from loge.LogeKey
+	if query.Get("from") != "" {
+		from = parseKey(query.Get("from"))
+	}
+	return from, limit
+}
+
+func prefixArg(r *http.Request) loge.LogeKey {
+	var prefix = r.URL.Query().Get("prefix")
+	switch {
+	case prefix == "":
+		return ""
+	case strings.HasSuffix(prefix, "/"):
+		return parseKeyPath(strings.TrimSuffix(prefix, "/"))
+	}
+	return parseKey(prefix)
+}
+
+func parseKey(path string) loge.LogeKey {
+	if strings.Contains(path, "/") {
+		return parseKeyPath(path)
+	}
+	if loge.ValidateKey(loge.LogeKey(path)) != nil {
+		fail(http.StatusBadRequest, fmt.Sprintf("Bad key: %q", path))
+	}
+	return loge.LogeKey(path)
+}
+
+func parseKeyPath(path string) loge.LogeKey {
+	key, err := loge.ParseKeyPath(path)
+	if err != nil {
+		fail(http.StatusBadRequest, fmt.Sprintf("Bad key: %q", path))
+	}
+	return key
+}
+
+func readJSON(r *http.Request, target interface{}) {
+	var err = json.NewDecoder(r.Body).Decode(target)
+	if err != nil {
+		fail(http.StatusBadRequest, fmt.Sprintf("Bad JSON: %v", err))
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
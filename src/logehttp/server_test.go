@@ -0,0 +1,141 @@
+package logehttp
+
+import (
+	"testing"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+
+	"loge"
+)
+
+type TestObj struct {
+	Name string
+}
+
+func testServer() *httptest.Server {
+	var db = loge.NewLogeDB(loge.NewMemStore())
+	var def = loge.NewTypeDef("test", 1, &TestObj{})
+	def.Links = loge.LinkSpec{ "other": "test" }
+	db.CreateType(def)
+	return httptest.NewServer(NewServer(db))
+}
+
+func request(test *testing.T, method string, url string, body string, result interface{}) int {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if result != nil {
+		json.NewDecoder(resp.Body).Decode(result)
+	}
+	return resp.StatusCode
+}
+
+func TestObjects(test *testing.T) {
+	var server = testServer()
+	defer server.Close()
+
+	if request(test, "GET", server.URL + "/objects/test/one", "", nil) != 404 {
+		test.Error("Missing object found")
+	}
+
+	if request(test, "PUT", server.URL + "/objects/test/one", `{"Name": "One"}`, nil) != 200 {
+		test.Error("Put failed")
+	}
+
+	var obj TestObj
+	if request(test, "GET", server.URL + "/objects/test/one", "", &obj) != 200 || obj.Name != "One" {
+		test.Errorf("Wrong object after put: %v", obj)
+	}
+
+	if request(test, "DELETE", server.URL + "/objects/test/one", "", nil) != 204 {
+		test.Error("Delete failed")
+	}
+
+	if request(test, "GET", server.URL + "/objects/test/one", "", nil) != 404 {
+		test.Error("Deleted object found")
+	}
+
+	if request(test, "GET", server.URL + "/objects/nope/one", "", nil) != 404 {
+		test.Error("Unknown type found")
+	}
+
+	if request(test, "PUT", server.URL + "/objects/test/one", `{"Name":`, nil) != 400 {
+		test.Error("Bad JSON accepted")
+	}
+}
+
+func TestLinks(test *testing.T) {
+	var server = testServer()
+	defer server.Close()
+
+	var result map[string][]string
+	request(test, "PUT", server.URL + "/links/test/other/one", `["b", "a"]`, &result)
+	if !reflect.DeepEqual(result["keys"], []string{"a", "b"}) {
+		test.Errorf("Wrong links after set: %v", result)
+	}
+
+	request(test, "PUT", server.URL + "/links/test/other/one/c", "", nil)
+	request(test, "DELETE", server.URL + "/links/test/other/one/a", "", nil)
+
+	request(test, "GET", server.URL + "/links/test/other/one", "", &result)
+	if !reflect.DeepEqual(result["keys"], []string{"b", "c"}) {
+		test.Errorf("Wrong links after add/remove: %v", result)
+	}
+
+	if request(test, "GET", server.URL + "/links/test/nope/one", "", nil) != 404 {
+		test.Error("Unknown link found")
+	}
+}
+
+func TestKeyPaths(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "logehttp")
+	defer os.RemoveAll(dir)
+
+	// The memory store can't list or find
+	var db = loge.NewLogeDB(loge.NewLevelDBStore(dir))
+	defer db.Close()
+	var def = loge.NewTypeDef("test", 1, &TestObj{})
+	def.Links = loge.LinkSpec{ "other": "test" }
+	db.CreateType(def)
+	var server = httptest.NewServer(NewServer(db))
+	defer server.Close()
+
+	request(test, "PUT", server.URL + "/objects/test/user%2F2024%2F03", `{"Name": "March"}`, nil)
+	request(test, "PUT", server.URL + "/objects/test/user%2F2025", `{"Name": "2025"}`, nil)
+	request(test, "PUT", server.URL + "/objects/test/users", `{"Name": "Plain"}`, nil)
+
+	var result map[string][]string
+	request(test, "GET", server.URL + "/objects/test?prefix=user/", "", &result)
+	var expected = []string{ string(loge.Key("user", "2024", "03")), string(loge.Key("user", "2025")) }
+	if !reflect.DeepEqual(result["keys"], expected) {
+		test.Errorf("Wrong keys under user/: %q", result["keys"])
+	}
+
+	request(test, "PUT", server.URL + "/links/test/other/users/user%2F2025", "", nil)
+	request(test, "GET", server.URL + "/find/test/other/user%2F2025", "", &result)
+	if !reflect.DeepEqual(result["keys"], []string{ "users" }) {
+		test.Errorf("Wrong sources of user/2025: %q", result["keys"])
+	}
+
+	for _, path := range []string{ "/objects/test/a%00b", "/objects/test/a%2F%25zz", "/links/test/other/users/a%00b" } {
+		if status := request(test, "PUT", server.URL + path, `{"Name": "Bad"}`, nil); status != 400 {
+			test.Errorf("Bad key in %s gave %d", path, status)
+		}
+	}
+	if status := request(test, "PUT", server.URL + "/links/test/other/users", `["a\u0000b"]`, nil); status != 400 {
+		test.Errorf("Bad link target gave %d", status)
+	}
+}
@@ -0,0 +1,126 @@
+package logehttp
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Just enough of RFC 6455 to push text frames to a client and notice
+// when it goes away.
+
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	ws_OP_TEXT = 0x1
+	ws_OP_CLOSE = 0x8
+)
+
+type websocketConn struct {
+	conn net.Conn
+	rw *bufio.ReadWriter
+	writeLock sync.Mutex
+}
+
+func upgradeWebsocket(w http.ResponseWriter, r *http.Request) (*websocketConn, bool) {
+	var key = r.Header.Get("Sec-WebSocket-Key")
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") || key == "" {
+		return nil, false
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, false
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, false
+	}
+
+	var hash = sha1.Sum([]byte(key + websocketGUID))
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	rw.WriteString("Upgrade: websocket\r\n")
+	rw.WriteString("Connection: Upgrade\r\n")
+	rw.WriteString("Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(hash[:]) + "\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, false
+	}
+
+	return &websocketConn{ conn: conn, rw: rw }, true
+}
+
+func (ws *websocketConn) WriteText(payload []byte) error {
+	return ws.writeFrame(ws_OP_TEXT, payload)
+}
+
+func (ws *websocketConn) writeFrame(opcode byte, payload []byte) error {
+	ws.writeLock.Lock()
+	defer ws.writeLock.Unlock()
+
+	var header = []byte{ 0x80 | opcode }
+	switch {
+	case len(payload) < 126:
+		header = append(header, byte(len(payload)))
+	case len(payload) <= 0xFFFF:
+		header = append(header, 126, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(len(payload)))
+	default:
+		header = append(header, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(len(payload)))
+	}
+
+	ws.rw.Write(header)
+	ws.rw.Write(payload)
+	return ws.rw.Flush()
+}
+
+// Discards client frames until a close frame or error, then returns
+func (ws *websocketConn) waitClose() {
+	for {
+		var header = make([]byte, 2)
+		if _, err := io.ReadFull(ws.rw, header); err != nil {
+			return
+		}
+
+		var length = uint64(header[1] & 0x7F)
+		switch length {
+		case 126:
+			var ext = make([]byte, 2)
+			if _, err := io.ReadFull(ws.rw, ext); err != nil {
+				return
+			}
+			length = uint64(binary.BigEndian.Uint16(ext))
+		case 127:
+			var ext = make([]byte, 8)
+			if _, err := io.ReadFull(ws.rw, ext); err != nil {
+				return
+			}
+			length = binary.BigEndian.Uint64(ext)
+		}
+
+		if header[1] & 0x80 != 0 {
+			length += 4
+		}
+
+		if _, err := io.CopyN(io.Discard, ws.rw, int64(length)); err != nil {
+			return
+		}
+
+		if header[0] & 0x0F == ws_OP_CLOSE {
+			ws.writeFrame(ws_OP_CLOSE, nil)
+			return
+		}
+	}
+}
+
+func (ws *websocketConn) Close() error {
+	return ws.conn.Close()
+}
@@ -0,0 +1,70 @@
+package logekafka
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// How far the sink got: the snapshot ID of the last change it handled,
+// and whether it stopped with everything delivered
+type Checkpoint struct {
+	SnapshotID uint64 `json:"snapshot"`
+	Clean bool `json:"clean"`
+}
+
+// Load gives the zero Checkpoint if nothing has been saved
+type CheckpointStore interface {
+	Load() (Checkpoint, error)
+	Save(Checkpoint) error
+}
+
+type memoryCheckpoints struct {
+	lock sync.Mutex
+	checkpoint Checkpoint
+}
+
+func (m *memoryCheckpoints) Load() (Checkpoint, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.checkpoint, nil
+}
+
+func (m *memoryCheckpoints) Save(checkpoint Checkpoint) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.checkpoint = checkpoint
+	return nil
+}
+
+// Keeps the checkpoint as JSON in a file, replaced atomically on save
+func FileCheckpoints(path string) CheckpointStore {
+	return fileCheckpoints(path)
+}
+
+type fileCheckpoints string
+
+func (path fileCheckpoints) Load() (checkpoint Checkpoint, err error) {
+	data, err := ioutil.ReadFile(string(path))
+	if os.IsNotExist(err) {
+		return checkpoint, nil
+	}
+	if err != nil {
+		return checkpoint, err
+	}
+	err = json.Unmarshal(data, &checkpoint)
+	return checkpoint, err
+}
+
+func (path fileCheckpoints) Save(checkpoint Checkpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	var tmp = string(path) + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, string(path))
+}
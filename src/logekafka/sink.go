@@ -0,0 +1,301 @@
+package logekafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"loge"
+)
+
+// Publishes committed changes to Kafka, one topic per type ("loge.person"
+// by default), keyed by object key so an object's changes stay in order
+// on one partition. Values are JSON in the shape of the logehttp feed,
+// so logehttp.FeedMessage decodes them:
+//
+//   var sink = logekafka.NewSink(db, []string{ "kafka:9092" })
+//   sink.Checkpoints = logekafka.FileCheckpoints("data/kafka.checkpoint")
+//   go sink.Run(ctx)
+//
+// Delivery is at least once. A failed write is retried, batch and all,
+// until it succeeds or ctx ends, so consumers may see a change twice.
+// Changes committed while the sink isn't listening can't be replayed,
+// so it resyncs instead, publishing the current state of every object
+// and link: on its first run, after a run which didn't finish cleanly,
+// when the database has moved on since a clean one, and whenever it
+// falls behind the feed. Resyncing needs a store supporting List.
+type Sink struct {
+	DB *loge.LogeDB
+	Producer Producer
+	Checkpoints CheckpointStore
+	TopicPrefix string
+	Types []string // Every registered type if empty
+	BatchSize int
+	FeedBuffer int
+	RetryDelay time.Duration
+}
+
+// What the sink writes to; *kafka.Writer is one
+type Producer interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// The same JSON as a logehttp feed message
+type Message struct {
+	Type string `json:"type"`
+	Key loge.LogeKey `json:"key"`
+	Link string `json:"link,omitempty"`
+	SnapshotID uint64 `json:"snapshot"`
+	Time time.Time `json:"time"`
+	Object interface{} `json:"object,omitempty"`
+	Links []loge.LogeKey `json:"links,omitempty"`
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+var errFeedOverflow = errors.New("Sink fell behind the feed")
+
+func NewSink(db *loge.LogeDB, brokers []string) *Sink {
+	return &Sink{
+		DB: db,
+		Producer: &kafka.Writer{
+			Addr: kafka.TCP(brokers...),
+			Balancer: &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			AllowAutoTopicCreation: true,
+		},
+		Checkpoints: &memoryCheckpoints{},
+		TopicPrefix: "loge.",
+		BatchSize: 100,
+		FeedBuffer: 10000,
+		RetryDelay: time.Second,
+	}
+}
+
+// Publishes until ctx ends, which returns ctx.Err(), or a checkpoint
+// can't be loaded or saved or a resync fails
+func (s *Sink) Run(ctx context.Context) error {
+	checkpoint, err := s.Checkpoints.Load()
+	if err != nil {
+		return err
+	}
+
+	for {
+		err := s.follow(ctx, &checkpoint)
+		if err != errFeedOverflow {
+			return err
+		}
+		checkpoint.Clean = false
+	}
+}
+
+func (s *Sink) follow(ctx context.Context, checkpoint *Checkpoint) error {
+	var sub = s.DB.Subscribe(s.FeedBuffer)
+	defer sub.Close()
+
+	// Subscribed first, so nothing commits unseen between the two. Snapshot
+	// IDs start again from 1 whenever the database opens.
+	var snap = s.DB.Snapshot()
+	var resynced uint64
+	if !checkpoint.Clean || (snap.ID() != checkpoint.SnapshotID && snap.ID() > 1) {
+		if err := s.resync(ctx, snap); err != nil {
+			snap.Release()
+			return err
+		}
+		resynced = snap.ID()
+	}
+	snap.Release()
+
+	*checkpoint = Checkpoint{ SnapshotID: snap.ID() }
+	if err := s.Checkpoints.Save(*checkpoint); err != nil {
+		return err
+	}
+
+	for {
+		var batch, err = s.nextBatch(ctx, sub)
+		if err != nil {
+			if ctx.Err() != nil {
+				return s.stop(ctx, sub, checkpoint, true)
+			}
+			return err
+		}
+
+		var msgs []kafka.Message
+		for _, change := range batch {
+			checkpoint.SnapshotID = change.SnapshotID
+			if change.SnapshotID > resynced && s.wants(change.Type) {
+				msgs = append(msgs, s.message(change))
+			}
+		}
+		if err := s.deliver(ctx, msgs); err != nil {
+			return s.stop(ctx, sub, checkpoint, false)
+		}
+		if err := s.Checkpoints.Save(*checkpoint); err != nil {
+			return err
+		}
+	}
+}
+
+// Waits for a change, then takes whatever else is waiting up to
+// BatchSize. Returns errFeedOverflow if the feed dropped the sink.
+func (s *Sink) nextBatch(ctx context.Context, sub *loge.Subscription) ([]loge.Change, error) {
+	var batch []loge.Change
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case change, ok := <-sub.C:
+		if !ok {
+			return nil, errFeedOverflow
+		}
+		batch = append(batch, change)
+	}
+
+	for len(batch) < s.BatchSize {
+		select {
+		case change, ok := <-sub.C:
+			if !ok {
+				return nil, errFeedOverflow
+			}
+			batch = append(batch, change)
+		default:
+			return batch, nil
+		}
+	}
+	return batch, nil
+}
+
+// Clean only if everything the feed gave us went out
+func (s *Sink) stop(ctx context.Context, sub *loge.Subscription, checkpoint *Checkpoint, delivered bool) error {
+	sub.Close()
+	var _, more = <-sub.C
+	checkpoint.Clean = delivered && !more && !sub.Overflowed()
+	if err := s.Checkpoints.Save(*checkpoint); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+func (s *Sink) deliver(ctx context.Context, msgs []kafka.Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	for {
+		var err = s.Producer.WriteMessages(ctx, msgs...)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		s.DB.Clock().Sleep(s.RetryDelay)
+	}
+}
+
+func (s *Sink) wants(typeName string) bool {
+	if len(s.Types) == 0 {
+		return true
+	}
+	for _, t := range s.Types {
+		if t == typeName {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Sink) message(change loge.Change) kafka.Message {
+	var value, err = json.Marshal(Message{
+		Type: change.Type,
+		Key: change.Key,
+		Link: change.Link,
+		SnapshotID: change.SnapshotID,
+		Time: change.Time,
+		Object: change.Object,
+		Links: change.Links,
+		Deleted: change.Deleted,
+	})
+	if err != nil {
+		panic(fmt.Sprintf("Encoding %s %s: %v", change.Type, change.Key, err))
+	}
+	return kafka.Message{
+		Topic: s.TopicPrefix + change.Type,
+		Key: []byte(change.Key),
+		Value: value,
+		Time: change.Time,
+	}
+}
+
+// -----------------------------------------------
+// Resync
+// -----------------------------------------------
+
+func (s *Sink) resync(ctx context.Context, snap *loge.Snapshot) error {
+	var typeNames = s.Types
+	if len(typeNames) == 0 {
+		for _, typ := range s.DB.Types() {
+			typeNames = append(typeNames, typ.Name)
+		}
+	}
+
+	for _, typeName := range typeNames {
+		var typ = s.DB.Type(typeName)
+		if typ == nil {
+			return fmt.Errorf("%w: %s", loge.ErrNoSuchType, typeName)
+		}
+
+		var after loge.LogeKey
+		for {
+			var listed = 0
+			var changes []loge.Change
+			var err = s.view(snap, func (t *loge.Transaction) {
+				var now = s.DB.Clock().Now()
+				var keys = t.ListSlice(typeName, after, s.BatchSize)
+				defer keys.Close()
+				for _, key := range keys.All() {
+					after = key
+					listed++
+					if obj, ok := t.ReadOK(typeName, key); ok {
+						changes = append(changes, loge.Change{ Type: typeName, Key: key, SnapshotID: snap.ID(), Time: now, Object: obj })
+					}
+					for linkName := range typ.Links {
+						if links := t.ReadLinks(typeName, linkName, key); len(links) > 0 {
+							changes = append(changes, loge.Change{ Type: typeName, Key: key, Link: linkName, SnapshotID: snap.ID(), Time: now, Links: links })
+						}
+					}
+				}
+			})
+			if err != nil {
+				return err
+			}
+
+			var msgs = make([]kafka.Message, len(changes))
+			for i, change := range changes {
+				msgs[i] = s.message(change)
+			}
+			if err := s.deliver(ctx, msgs); err != nil {
+				return err
+			}
+			if listed < s.BatchSize {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Sink) view(snap *loge.Snapshot, actor loge.Transactor) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if rerr, ok := r.(error); ok && errors.Is(rerr, loge.ErrNotSupported) {
+				err = fmt.Errorf("Resync needs a store supporting List: %w", rerr)
+				return
+			}
+			panic(r)
+		}
+	}()
+	snap.View(actor)
+	return nil
+}
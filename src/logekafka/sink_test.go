@@ -0,0 +1,139 @@
+package logekafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"loge"
+	"logetest"
+)
+
+type fakeProducer struct {
+	lock sync.Mutex
+	failures int
+	messages []kafka.Message
+}
+
+func (p *fakeProducer) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.failures > 0 {
+		p.failures--
+		return errors.New("broker down")
+	}
+	p.messages = append(p.messages, msgs...)
+	return nil
+}
+
+// Keys published so far, waiting for at least count of them
+func (p *fakeProducer) wait(test *testing.T, count int) []string {
+	var deadline = time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		p.lock.Lock()
+		if len(p.messages) >= count {
+			var keys []string
+			for _, msg := range p.messages {
+				keys = append(keys, msg.Topic + "/" + string(msg.Key))
+			}
+			p.messages = nil
+			p.lock.Unlock()
+			return keys
+		}
+		p.lock.Unlock()
+		time.Sleep(time.Millisecond)
+	}
+	test.Fatalf("Only %d of %d messages published", len(p.messages), count)
+	return nil
+}
+
+func TestSink(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "logekafka")
+	defer os.RemoveAll(dir)
+
+	var db = loge.NewLogeDB(loge.NewLevelDBStore(dir + "/db"))
+	defer db.Close()
+	var clock = logetest.NewVirtualClock(time.Time{})
+	db.SetClock(clock)
+	db.CreateType(loge.NewTypeDef("record", 1, &logetest.Record{}))
+	db.SetOne("record", "a", &logetest.Record{ Name: "A" })
+
+	var producer = &fakeProducer{}
+	var checkpoints = FileCheckpoints(dir + "/checkpoint")
+	var run = func() (context.CancelFunc, chan error) {
+		var sink = NewSink(db, nil)
+		sink.Producer = producer
+		sink.Checkpoints = checkpoints
+		var ctx, cancel = context.WithCancel(context.Background())
+		var done = make(chan error, 1)
+		go func() { done <- sink.Run(ctx) }()
+		return cancel, done
+	}
+
+	// First run resyncs, then retries a failed write
+	var cancel, done = run()
+	if keys := producer.wait(test, 1); keys[0] != "loge.record/a" {
+		test.Fatalf("Wrong resync: %v", keys)
+	}
+	producer.lock.Lock()
+	producer.failures = 1
+	producer.lock.Unlock()
+	db.SetOne("record", "b", &logetest.Record{ Name: "B" })
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	var keys = producer.wait(test, 1)
+	if len(keys) != 1 || keys[0] != "loge.record/b" {
+		test.Fatalf("Wrong messages: %v", keys)
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		test.Fatalf("Run returned %v", err)
+	}
+	if checkpoint, _ := checkpoints.Load(); !checkpoint.Clean {
+		test.Fatalf("Unclean stop: %+v", checkpoint)
+	}
+
+	// Nothing missed, so no resync
+	cancel, done = run()
+	for checkpoint, _ := checkpoints.Load(); checkpoint.Clean; checkpoint, _ = checkpoints.Load() {
+		time.Sleep(time.Millisecond)
+	}
+	db.SetOne("record", "c", &logetest.Record{ Name: "C" })
+	keys = producer.wait(test, 1)
+	if len(keys) != 1 || keys[0] != "loge.record/c" {
+		test.Fatalf("Wrong messages after restart: %v", keys)
+	}
+	cancel()
+	<-done
+
+	// A commit while stopped means resyncing everything
+	db.SetOne("record", "d", &logetest.Record{ Name: "D" })
+	cancel, done = run()
+	keys = producer.wait(test, 4)
+	if len(keys) != 4 || keys[3] != "loge.record/d" {
+		test.Fatalf("Wrong resync: %v", keys)
+	}
+	cancel()
+	<-done
+}
+
+func TestMessageFormat(test *testing.T) {
+	var sink = &Sink{ TopicPrefix: "loge." }
+	var msg = sink.message(loge.Change{ Type: "record", Key: "a", Link: "other", SnapshotID: 3, Links: []loge.LogeKey{ "b" } })
+
+	var decoded map[string]interface{}
+	json.Unmarshal(msg.Value, &decoded)
+	if decoded["type"] != "record" || decoded["link"] != "other" || decoded["snapshot"] != 3.0 {
+		test.Errorf("Wrong message: %s", msg.Value)
+	}
+	if _, ok := decoded["object"]; ok {
+		test.Errorf("Link change has an object: %s", msg.Value)
+	}
+}
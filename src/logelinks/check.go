@@ -0,0 +1,114 @@
+package logelinks
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Reports the first broken invariant (see the package comment), or nil
+func (ls *Set[K]) Check() error {
+	for name, list := range map[string][]K{
+		"Original": ls.Original,
+		"Added": ls.Added,
+		"Removed": ls.Removed,
+	} {
+		for i := 1; i < len(list); i++ {
+			if list[i-1] >= list[i] {
+				return fmt.Errorf("%s not sorted and unique at %d: %v", name, i, list)
+			}
+		}
+	}
+
+	for _, key := range ls.Added {
+		if has(ls.Original, key) {
+			return fmt.Errorf("Added key %q already in Original", key)
+		}
+	}
+	for _, key := range ls.Removed {
+		if !has(ls.Original, key) {
+			return fmt.Errorf("Removed key %q not in Original", key)
+		}
+	}
+	return nil
+}
+
+// The plain set a Set's operations should amount to, for checking one
+// against the other:
+//
+//   var set, model = logelinks.New(keys), logelinks.NewModel(keys)
+//   for _, op := range ops {
+//       op(set); op(model)
+//       if err := logelinks.Verify(set, model); err != nil { ... }
+//   }
+type Model[K ~string] map[K]bool
+
+func NewModel[K ~string](keys []K) Model[K] {
+	var model = make(Model[K])
+	model.Set(keys)
+	return model
+}
+
+func (model Model[K]) Set(keys []K) {
+	for key := range model {
+		delete(model, key)
+	}
+	for _, key := range keys {
+		model[key] = true
+	}
+}
+
+func (model Model[K]) Add(key K) {
+	model[key] = true
+}
+
+func (model Model[K]) Remove(key K) {
+	delete(model, key)
+}
+
+func (model Model[K]) Has(key K) bool {
+	return model[key]
+}
+
+// Sorted
+func (model Model[K]) ReadKeys() []K {
+	var keys = make([]K, 0, len(model))
+	for key := range model {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+// Checks the set's invariants, and that it holds exactly the model's
+// keys
+func Verify[K ~string](ls *Set[K], model Model[K]) error {
+	if err := ls.Check(); err != nil {
+		return err
+	}
+
+	if ls.Len() != len(model) {
+		return fmt.Errorf("Len %d, model has %d keys", ls.Len(), len(model))
+	}
+
+	var keys, want = ls.ReadKeys(), model.ReadKeys()
+	if len(keys) != len(want) {
+		return fmt.Errorf("Keys %v, model has %v", keys, want)
+	}
+	for i := range keys {
+		if keys[i] != want[i] {
+			return fmt.Errorf("Keys %v, model has %v", keys, want)
+		}
+	}
+
+	for _, key := range want {
+		if !ls.Has(key) {
+			return fmt.Errorf("Has(%q) false for a key in the model", key)
+		}
+	}
+	for _, key := range append(ls.Original, ls.Removed...) {
+		if ls.Has(key) != model.Has(key) {
+			return fmt.Errorf("Has(%q) is %v, model says %v", key, ls.Has(key), model.Has(key))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+// Sorted key sets with pending changes, as loge stores links.
+//
+// A Set is the links from one object, as read from the store
+// (Original), plus the changes made to them since (Added and Removed).
+// Its invariants, checked by Check:
+//
+//   - Original, Added and Removed are sorted and free of duplicates
+//   - Added holds no key in Original
+//   - Removed holds only keys in Original
+//
+// so Added and Removed never overlap, and the keys are Original minus
+// Removed plus Added. Lists are never modified in place once set, so
+// Original can be shared between versions.
+package logelinks
+
+import (
+	"sort"
+)
+
+type Set[K ~string] struct {
+	Original []K
+	Added []K
+	Removed []K
+	merged []K
+}
+
+// Sorts and deduplicates a copy of original
+func New[K ~string](original []K) *Set[K] {
+	return &Set[K]{
+		Original: sorted(original),
+	}
+}
+
+// A set with this one's keys as its original, and no changes
+func (ls *Set[K]) NewVersion() *Set[K] {
+	return &Set[K]{
+		Original: ls.ReadKeys(),
+	}
+}
+
+// Folds the changes into Original
+func (ls *Set[K]) Freeze() {
+	ls.Original = ls.ReadKeys()
+	ls.Added = nil
+	ls.Removed = nil
+	ls.merged = nil
+}
+
+// Replaces the keys, recorded as the difference from Original
+func (ls *Set[K]) Set(keys []K) {
+	var target = sorted(keys)
+	var added, removed []K
+	for _, key := range target {
+		if !has(ls.Original, key) {
+			added = append(added, key)
+		}
+	}
+	for _, key := range ls.Original {
+		if !has(target, key) {
+			removed = append(removed, key)
+		}
+	}
+	ls.Added = added
+	ls.Removed = removed
+	ls.merged = nil
+}
+
+func (ls *Set[K]) Add(key K) {
+	switch {
+	case has(ls.Removed, key):
+		ls.Removed = without(ls.Removed, key)
+	case !has(ls.Original, key) && !has(ls.Added, key):
+		ls.Added = with(ls.Added, key)
+	default:
+		return
+	}
+	ls.merged = nil
+}
+
+func (ls *Set[K]) Remove(key K) {
+	switch {
+	case has(ls.Added, key):
+		ls.Added = without(ls.Added, key)
+	case has(ls.Original, key) && !has(ls.Removed, key):
+		ls.Removed = with(ls.Removed, key)
+	default:
+		return
+	}
+	ls.merged = nil
+}
+
+func (ls *Set[K]) Has(key K) bool {
+	if has(ls.Added, key) {
+		return true
+	}
+	return has(ls.Original, key) && !has(ls.Removed, key)
+}
+
+// Without merging: by the invariants, the changes can simply be counted
+func (ls *Set[K]) Len() int {
+	return len(ls.Original) - len(ls.Removed) + len(ls.Added)
+}
+
+// Sorted. The result is shared and cached until the next change;
+// callers mustn't modify it.
+func (ls *Set[K]) ReadKeys() []K {
+	if len(ls.Added) == 0 && len(ls.Removed) == 0 {
+		return ls.Original
+	}
+
+	if ls.merged == nil {
+		ls.merged = ls.merge()
+	}
+	return ls.merged
+}
+
+// Up to limit keys after after, in order, or all of them if limit is
+// negative. Walks the lists from there rather than merging them, so a
+// page costs its length; like ReadKeys, it may be shared.
+func (ls *Set[K]) Page(after K, limit int) []K {
+	if ls.merged != nil || (len(ls.Added) == 0 && len(ls.Removed) == 0) {
+		return page(ls.ReadKeys(), after, limit)
+	}
+
+	var keys []K
+	var original, added, removed = above(ls.Original, after), above(ls.Added, after), above(ls.Removed, after)
+	for limit < 0 || len(keys) < limit {
+		for original < len(ls.Original) {
+			for removed < len(ls.Removed) && ls.Removed[removed] < ls.Original[original] {
+				removed++
+			}
+			if removed == len(ls.Removed) || ls.Removed[removed] != ls.Original[original] {
+				break
+			}
+			original++
+		}
+
+		switch {
+		case original < len(ls.Original) && (added == len(ls.Added) || ls.Original[original] < ls.Added[added]):
+			keys = append(keys, ls.Original[original])
+			original++
+		case added < len(ls.Added):
+			keys = append(keys, ls.Added[added])
+			added++
+		default:
+			return keys
+		}
+	}
+	return keys
+}
+
+// All three lists are sorted, so one pass merges them
+func (ls *Set[K]) merge() []K {
+	var keys = make([]K, 0, len(ls.Original) + len(ls.Added))
+	var added, removed = 0, 0
+
+	for _, key := range ls.Original {
+		for removed < len(ls.Removed) && ls.Removed[removed] < key {
+			removed++
+		}
+		if removed < len(ls.Removed) && ls.Removed[removed] == key {
+			continue
+		}
+
+		for added < len(ls.Added) && ls.Added[added] < key {
+			keys = append(keys, ls.Added[added])
+			added++
+		}
+
+		keys = append(keys, key)
+	}
+
+	return append(keys, ls.Added[added:]...)
+}
+
+// -----------------------------------------------
+// Sorted lists
+// -----------------------------------------------
+
+func search[K ~string](list []K, key K) int {
+	return sort.Search(len(list), func(i int) bool { return list[i] >= key })
+}
+
+// Index of the first key after key
+func above[K ~string](list []K, key K) int {
+	return sort.Search(len(list), func(i int) bool { return list[i] > key })
+}
+
+func page[K ~string](list []K, after K, limit int) []K {
+	var start, end = above(list, after), len(list)
+	if limit >= 0 && start + limit < end {
+		end = start + limit
+	}
+	return list[start:end]
+}
+
+func has[K ~string](list []K, key K) bool {
+	var i = search(list, key)
+	return i < len(list) && list[i] == key
+}
+
+// Copies rather than appending in place, since list may be shared
+func with[K ~string](list []K, key K) []K {
+	var i = search(list, key)
+	var result = make([]K, 0, len(list) + 1)
+	result = append(result, list[:i]...)
+	result = append(result, key)
+	return append(result, list[i:]...)
+}
+
+func without[K ~string](list []K, key K) []K {
+	var i = search(list, key)
+	var result = make([]K, 0, len(list))
+	result = append(result, list[:i]...)
+	return append(result, list[i+1:]...)
+}
+
+func sorted[K ~string](keys []K) []K {
+	var result = append([]K{}, keys...)
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+
+	var unique = result[:0]
+	for i, key := range result {
+		if i == 0 || key != result[i-1] {
+			unique = append(unique, key)
+		}
+	}
+	return unique
+}
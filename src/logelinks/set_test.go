@@ -0,0 +1,128 @@
+package logelinks
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestSetThenAdd(test *testing.T) {
+	var set = New([]string{ "b", "a", "c", "a" })
+	if !reflect.DeepEqual(set.Original, []string{ "a", "b", "c" }) {
+		test.Fatalf("Original not sorted and unique: %v", set.Original)
+	}
+	var original = set.Original
+
+	set.Set([]string{ "c", "d" })
+	set.Add("a")
+	set.Remove("c")
+	set.Add("c")
+
+	if err := Verify(set, NewModel([]string{ "a", "c", "d" })); err != nil {
+		test.Error(err)
+	}
+	if !reflect.DeepEqual(original, []string{ "a", "b", "c" }) {
+		test.Errorf("Original modified in place: %v", original)
+	}
+
+	set.Freeze()
+	if set.Added != nil || set.Removed != nil || !reflect.DeepEqual(set.Original, []string{ "a", "c", "d" }) {
+		test.Errorf("Wrong frozen set: %+v", set)
+	}
+}
+
+func TestCheck(test *testing.T) {
+	var broken = []*Set[string]{
+		{ Original: []string{ "b", "a" } },
+		{ Original: []string{ "a" }, Added: []string{ "a" } },
+		{ Original: []string{ "a" }, Removed: []string{ "b" } },
+		{ Added: []string{ "a", "a" } },
+	}
+	for _, set := range broken {
+		if set.Check() == nil {
+			test.Errorf("Broken set passed: %+v", set)
+		}
+	}
+}
+
+// Random operations against the model
+func TestModel(test *testing.T) {
+	var rnd = rand.New(rand.NewSource(1))
+	var key = func() string { return fmt.Sprintf("k%d", rnd.Intn(8)) }
+	var keys = func() []string {
+		var keys = make([]string, rnd.Intn(6))
+		for i := range keys {
+			keys[i] = key()
+		}
+		return keys
+	}
+
+	for round := 0; round < 200; round++ {
+		var start = keys()
+		var set, model = New(start), NewModel(start)
+		var ops []string
+
+		for step := 0; step < 20; step++ {
+			switch rnd.Intn(5) {
+			case 0:
+				var k = keys()
+				set.Set(k)
+				model.Set(k)
+				ops = append(ops, fmt.Sprintf("Set(%v)", k))
+			case 1:
+				set.Freeze()
+				ops = append(ops, "Freeze()")
+			case 2, 3:
+				var k = key()
+				set.Add(k)
+				model.Add(k)
+				ops = append(ops, fmt.Sprintf("Add(%s)", k))
+			default:
+				var k = key()
+				set.Remove(k)
+				model.Remove(k)
+				ops = append(ops, fmt.Sprintf("Remove(%s)", k))
+			}
+
+			if err := Verify(set, model); err != nil {
+				test.Fatalf("From %v after %v: %v", start, ops, err)
+			}
+		}
+	}
+}
+
+// Pages of unmerged sets against the model's keys
+func TestPage(test *testing.T) {
+	var rnd = rand.New(rand.NewSource(1))
+	var key = func() string { return fmt.Sprintf("k%d", rnd.Intn(10)) }
+
+	for round := 0; round < 200; round++ {
+		var start = []string{ key(), key(), key(), key(), key() }
+		var set, model = New(start), NewModel(start)
+		for step := 0; step < 6; step++ {
+			var k = key()
+			if rnd.Intn(2) == 0 {
+				set.Add(k)
+				model.Add(k)
+			} else {
+				set.Remove(k)
+				model.Remove(k)
+			}
+		}
+
+		var after, limit = key(), rnd.Intn(5) - 1
+		var want = []string{}
+		for _, k := range model.ReadKeys() {
+			if k > after && (limit < 0 || len(want) < limit) {
+				want = append(want, k)
+			}
+		}
+		var walked = append([]string{}, set.Page(after, limit)...)
+		set.ReadKeys()
+		var merged = append([]string{}, set.Page(after, limit)...)
+		if !reflect.DeepEqual(walked, want) || !reflect.DeepEqual(merged, want) {
+			test.Fatalf("Page(%s, %d) of %+v gave %v and %v, want %v", after, limit, set, walked, merged, want)
+		}
+	}
+}
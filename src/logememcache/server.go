@@ -0,0 +1,150 @@
+package logememcache
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"loge"
+)
+
+// A read-only memcached text protocol endpoint, so edge caches can fetch
+// objects with an ordinary memcached client. Keys are {type}:{key} and
+// values are the object's JSON:
+//
+//   get test:one test:two
+//   VALUE test:one 0 14
+//   {"Name":"One"}
+//   END
+//
+// Each get runs in one transaction, so a multi-key get sees a consistent
+// snapshot. Storage commands are refused.
+type Server struct {
+	DB *loge.LogeDB
+	Timeout time.Duration
+}
+
+const maxKeyLength = 250
+
+var storageCommands = map[string]bool{
+	"set": true, "add": true, "replace": true, "append": true, "prepend": true,
+	"cas": true, "delete": true, "incr": true, "decr": true, "touch": true,
+	"flush_all": true,
+}
+
+func NewServer(db *loge.LogeDB) *Server {
+	return &Server{
+		DB: db,
+		Timeout: 5 * time.Second,
+	}
+}
+
+func (s *Server) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+func (s *Server) Serve(listener net.Listener) error {
+	defer listener.Close()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go s.ServeConn(conn)
+	}
+}
+
+func (s *Server) ServeConn(conn io.ReadWriteCloser) {
+	defer conn.Close()
+
+	var reader = bufio.NewReader(conn)
+	var writer = bufio.NewWriter(conn)
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		var fields = strings.Fields(line)
+		if len(fields) == 0 {
+			writer.WriteString("ERROR\r\n")
+		} else if fields[0] == "quit" {
+			return
+		} else {
+			s.handle(writer, fields[0], fields[1:])
+		}
+
+		if writer.Flush() != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) handle(w *bufio.Writer, cmd string, args []string) {
+	switch {
+	case cmd == "get" && len(args) > 0:
+		s.get(w, args)
+	case cmd == "version":
+		w.WriteString("VERSION loge\r\n")
+	case storageCommands[cmd]:
+		// The client's data block, if any, is read as an unknown command
+		// and answered with ERROR; clients stop at the first error line.
+		w.WriteString("SERVER_ERROR read-only\r\n")
+	default:
+		w.WriteString("ERROR\r\n")
+	}
+}
+
+func (s *Server) get(w *bufio.Writer, keys []string) {
+	var typeNames = make([]string, len(keys))
+	var objKeys = make([]loge.LogeKey, len(keys))
+	for i, key := range keys {
+		if len(key) > maxKeyLength {
+			w.WriteString("CLIENT_ERROR key too long\r\n")
+			return
+		}
+		var parts = strings.SplitN(key, ":", 2)
+		if len(parts) == 2 && s.DB.Type(parts[0]) != nil {
+			typeNames[i], objKeys[i] = parts[0], loge.LogeKey(parts[1])
+		}
+	}
+
+	var values [][]byte
+	var ok = s.DB.Transact(func (t *loge.Transaction) {
+		values = make([][]byte, len(keys))
+		for i, typeName := range typeNames {
+			if typeName == "" || !t.Exists(typeName, objKeys[i]) {
+				continue
+			}
+			enc, err := json.Marshal(t.Read(typeName, objKeys[i]))
+			if err != nil {
+				panic(err)
+			}
+			values[i] = enc
+		}
+	}, s.Timeout)
+
+	if !ok {
+		w.WriteString("SERVER_ERROR transaction failed\r\n")
+		return
+	}
+
+	for i, value := range values {
+		if value == nil {
+			continue
+		}
+		fmt.Fprintf(w, "VALUE %s 0 %d\r\n", keys[i], len(value))
+		w.Write(value)
+		w.WriteString("\r\n")
+	}
+	w.WriteString("END\r\n")
+}
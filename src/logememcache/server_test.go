@@ -0,0 +1,58 @@
+package logememcache
+
+import (
+	"testing"
+	"bufio"
+	"net"
+	"strings"
+
+	"loge"
+)
+
+type TestObj struct {
+	Name string
+}
+
+func TestGet(test *testing.T) {
+	var db = loge.NewLogeDB(loge.NewMemStore())
+	db.CreateType(loge.NewTypeDef("test", 1, &TestObj{}))
+	db.SetOne("test", "one", &TestObj{ Name: "One" })
+	db.SetOne("test", "two", &TestObj{ Name: "Two" })
+
+	serverConn, clientConn := net.Pipe()
+	go NewServer(db).ServeConn(serverConn)
+	defer clientConn.Close()
+
+	var reader = bufio.NewReader(clientConn)
+	var request = func(line string, replyLines int) string {
+		clientConn.Write([]byte(line + "\r\n"))
+		var reply []string
+		for i := 0; i < replyLines; i++ {
+			text, err := reader.ReadString('\n')
+			if err != nil {
+				test.Fatal(err)
+			}
+			reply = append(reply, strings.TrimRight(text, "\r\n"))
+		}
+		return strings.Join(reply, "|")
+	}
+
+	var checks = []struct {
+		line string
+		lines int
+		reply string
+	}{
+		{ "get test:one", 3, `VALUE test:one 0 14|{"Name":"One"}|END` },
+		{ "get test:missing nope:one test:two", 3, `VALUE test:two 0 14|{"Name":"Two"}|END` },
+		{ "get test:missing", 1, "END" },
+		{ "set test:one 0 0 2", 1, "SERVER_ERROR read-only" },
+		{ "bogus", 1, "ERROR" },
+		{ "version", 1, "VERSION loge" },
+	}
+
+	for _, check := range checks {
+		if reply := request(check.line, check.lines); reply != check.reply {
+			test.Errorf("%s: expected %s, got %s", check.line, check.reply, reply)
+		}
+	}
+}
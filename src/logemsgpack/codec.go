@@ -0,0 +1,336 @@
+package logemsgpack
+
+import (
+	"bufio"
+	"bytes"
+	"encoding"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"loge"
+)
+
+// Stores objects as MessagePack, for a smaller store than spack or JSON:
+//
+//   db.SetCodec(logemsgpack.Codec)
+//
+// Structs are maps keyed by field name, or the name in a `msgpack:"..."`
+// tag ("-" to leave a field out), so fields can come and go between type
+// versions. ArrayCodec drops the names and writes fields in order, which
+// is smaller still, but then fields may only be added at the end.
+// Either decodes what the other wrote. Values with a MarshalText method
+// (time.Time, say) are stored as its text.
+var Codec loge.Codec = &codec{ "msgpack", false }
+var ArrayCodec loge.Codec = &codec{ "msgpack-array", true }
+
+type codec struct {
+	name string
+	arrays bool
+}
+
+type fieldInfo struct {
+	name string
+	index []int
+}
+
+var fieldCache sync.Map
+
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+func (c *codec) Name() string {
+	return c.name
+}
+
+func (c *codec) Marshal(obj interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	var w = bufio.NewWriter(&buf)
+	if err := c.encode(w, reflect.ValueOf(obj)); err != nil {
+		return nil, err
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *codec) Unmarshal(blob []byte, obj interface{}) error {
+	var target = reflect.ValueOf(obj)
+	if target.Kind() != reflect.Ptr || target.IsNil() {
+		return fmt.Errorf("Can't decode into %T", obj)
+	}
+	value, err := readValue(bufio.NewReader(bytes.NewReader(blob)))
+	if err != nil {
+		return err
+	}
+	return assign(target.Elem(), value)
+}
+
+
+// -----------------------------------------------
+// Encoding
+// -----------------------------------------------
+
+func (c *codec) encode(w *bufio.Writer, v reflect.Value) error {
+	if !v.IsValid() || ((v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil()) {
+		return w.WriteByte(0xc0)
+	}
+	if v.Type().Implements(textMarshalerType) {
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return err
+		}
+		return writeValue(w, string(text))
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return c.encode(w, v.Elem())
+	case reflect.Bool:
+		return writeValue(w, v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		writeInt(w, v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return writeValue(w, v.Uint())
+	case reflect.Float32:
+		w.WriteByte(0xca)
+		writeUint(w, uint64(math.Float32bits(float32(v.Float()))), 4)
+	case reflect.Float64:
+		return writeValue(w, v.Float())
+	case reflect.String:
+		return writeValue(w, v.String())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return w.WriteByte(0xc0)
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			var data = make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(data), v)
+			return writeValue(w, data)
+		}
+		writeHeader(w, v.Len(), 0x90, 15, 0, 0xdc, 0xdd)
+		for i := 0; i < v.Len(); i++ {
+			if err := c.encode(w, v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			return w.WriteByte(0xc0)
+		}
+		if v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("Can't encode %s: map keys must be strings", v.Type())
+		}
+		// Sorted, so equal maps encode the same
+		var keys = v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		writeHeader(w, len(keys), 0x80, 15, 0, 0xde, 0xdf)
+		for _, key := range keys {
+			writeValue(w, key.String())
+			if err := c.encode(w, v.MapIndex(key)); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		var fields = structFields(v.Type())
+		if c.arrays {
+			writeHeader(w, len(fields), 0x90, 15, 0, 0xdc, 0xdd)
+		} else {
+			writeHeader(w, len(fields), 0x80, 15, 0, 0xde, 0xdf)
+		}
+		for _, field := range fields {
+			if !c.arrays {
+				writeValue(w, field.name)
+			}
+			if err := c.encode(w, v.FieldByIndex(field.index)); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("Can't encode %s", v.Type())
+	}
+	return nil
+}
+
+// Exported fields in order, with those of embedded structs in place of
+// the struct
+func structFields(typ reflect.Type) []fieldInfo {
+	if cached, ok := fieldCache.Load(typ); ok {
+		return cached.([]fieldInfo)
+	}
+
+	var fields = make([]fieldInfo, 0, typ.NumField())
+	for i := 0; i < typ.NumField(); i++ {
+		var field = typ.Field(i)
+		var tag = field.Tag.Get("msgpack")
+		if tag == "-" {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && tag == "" {
+			for _, inner := range structFields(field.Type) {
+				fields = append(fields, fieldInfo{ inner.name, append([]int{ i }, inner.index...) })
+			}
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		var name = field.Name
+		if tagName := strings.Split(tag, ",")[0]; tagName != "" {
+			name = tagName
+		}
+		fields = append(fields, fieldInfo{ name, []int{ i } })
+	}
+
+	fieldCache.Store(typ, fields)
+	return fields
+}
+
+
+// -----------------------------------------------
+// Decoding
+// -----------------------------------------------
+
+// From what readValue gives
+func assign(dst reflect.Value, value interface{}) error {
+	if value == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+	if dst.Kind() == reflect.Ptr {
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return assign(dst.Elem(), value)
+	}
+	if text, ok := value.(string); ok && reflect.PtrTo(dst.Type()).Implements(textUnmarshalerType) {
+		return dst.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(text))
+	}
+
+	var mismatch = fmt.Errorf("Can't decode %T into %s", value, dst.Type())
+
+	switch dst.Kind() {
+	case reflect.Interface:
+		if dst.NumMethod() > 0 {
+			return mismatch
+		}
+		dst.Set(reflect.ValueOf(value))
+	case reflect.Bool:
+		b, ok := value.(bool)
+		if !ok {
+			return mismatch
+		}
+		dst.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := value.(int64)
+		if !ok || dst.OverflowInt(i) {
+			return mismatch
+		}
+		dst.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var u uint64
+		switch n := value.(type) {
+		case int64:
+			if n < 0 {
+				return mismatch
+			}
+			u = uint64(n)
+		case uint64:
+			u = n
+		default:
+			return mismatch
+		}
+		if dst.OverflowUint(u) {
+			return mismatch
+		}
+		dst.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		switch n := value.(type) {
+		case float64:
+			dst.SetFloat(n)
+		case int64:
+			dst.SetFloat(float64(n))
+		default:
+			return mismatch
+		}
+	case reflect.String:
+		s, ok := value.(string)
+		if !ok {
+			return mismatch
+		}
+		dst.SetString(s)
+	case reflect.Slice, reflect.Array:
+		return assignList(dst, value, mismatch)
+	case reflect.Map:
+		items, ok := value.(map[string]interface{})
+		if !ok || dst.Type().Key().Kind() != reflect.String {
+			return mismatch
+		}
+		var m = reflect.MakeMapWithSize(dst.Type(), len(items))
+		for key, item := range items {
+			var elem = reflect.New(dst.Type().Elem()).Elem()
+			if err := assign(elem, item); err != nil {
+				return err
+			}
+			m.SetMapIndex(reflect.ValueOf(key).Convert(dst.Type().Key()), elem)
+		}
+		dst.Set(m)
+	case reflect.Struct:
+		return assignStruct(dst, value, mismatch)
+	default:
+		return mismatch
+	}
+	return nil
+}
+
+func assignList(dst reflect.Value, value interface{}, mismatch error) error {
+	if data, ok := value.([]byte); ok && dst.Type().Elem().Kind() == reflect.Uint8 {
+		if dst.Kind() == reflect.Slice {
+			dst.Set(reflect.MakeSlice(dst.Type(), len(data), len(data)))
+		}
+		reflect.Copy(dst, reflect.ValueOf(data))
+		return nil
+	}
+	items, ok := value.([]interface{})
+	if !ok {
+		return mismatch
+	}
+	if dst.Kind() == reflect.Slice {
+		dst.Set(reflect.MakeSlice(dst.Type(), len(items), len(items)))
+	}
+	for i := 0; i < len(items) && i < dst.Len(); i++ {
+		if err := assign(dst.Index(i), items[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Fields by name from a map, or by position from an array. Missing ones
+// are left alone and unknown ones ignored.
+func assignStruct(dst reflect.Value, value interface{}, mismatch error) error {
+	var fields = structFields(dst.Type())
+	switch items := value.(type) {
+	case map[string]interface{}:
+		for _, field := range fields {
+			if item, ok := items[field.name]; ok {
+				if err := assign(dst.FieldByIndex(field.index), item); err != nil {
+					return err
+				}
+			}
+		}
+	case []interface{}:
+		for i := 0; i < len(items) && i < len(fields); i++ {
+			if err := assign(dst.FieldByIndex(fields[i].index), items[i]); err != nil {
+				return err
+			}
+		}
+	default:
+		return mismatch
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package logemsgpack
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"loge"
+)
+
+type codecObj struct {
+	loge.Meta
+	Name string `msgpack:"name"`
+	Count int
+	Ratio float32
+	Tags []string
+	Data []byte
+	Extra map[string]interface{}
+	When time.Time
+	Next *TestObj
+	Scratch string `msgpack:"-"`
+}
+
+func TestStorageCodec(test *testing.T) {
+	var db = loge.NewLogeDB(loge.NewMemStore())
+	var def = loge.NewTypeDef("test", 1, &codecObj{})
+	def.Codec = Codec
+	db.CreateType(def)
+
+	var when = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	db.SetOne("test", "one", &codecObj{
+		Name: "One",
+		Count: -300,
+		Ratio: 0.5,
+		Tags: []string{ "a", "b" },
+		Data: []byte{ 0, 1, 2 },
+		Extra: map[string]interface{}{ "x": int64(1), "y": "why" },
+		When: when,
+		Next: &TestObj{ "Two", 2 },
+		Scratch: "Gone",
+	})
+
+	var obj = db.ReadOne("test", "one").(*codecObj)
+	var expected = &codecObj{
+		Name: "One",
+		Count: -300,
+		Ratio: 0.5,
+		Tags: []string{ "a", "b" },
+		Data: []byte{ 0, 1, 2 },
+		Extra: map[string]interface{}{ "x": int64(1), "y": "why" },
+		When: when,
+		Next: &TestObj{ "Two", 2 },
+	}
+	obj.Meta = loge.Meta{}
+	if !reflect.DeepEqual(obj, expected) {
+		test.Errorf("Wrong object through codec: %+v", obj)
+	}
+}
+
+func TestStorageCodecSize(test *testing.T) {
+	var obj = &TestObj{ "One", 3 }
+	var jsonBlob, _ = loge.JSONCodec.Marshal(obj)
+	var mapBlob, _ = Codec.Marshal(obj)
+	var arrayBlob, _ = ArrayCodec.Marshal(obj)
+
+	if len(mapBlob) >= len(jsonBlob) || len(arrayBlob) >= len(mapBlob) {
+		test.Errorf("Wrong sizes: json %d, map %d, array %d", len(jsonBlob), len(mapBlob), len(arrayBlob))
+	}
+
+	var decoded TestObj
+	if err := Codec.Unmarshal(arrayBlob, &decoded); err != nil || decoded != *obj {
+		test.Errorf("Wrong object from array form: %v (%v)", decoded, err)
+	}
+}
+
+func TestStorageCodecFieldChanges(test *testing.T) {
+	type oldObj struct {
+		Name string
+		Gone string
+	}
+	var blob, _ = Codec.Marshal(&oldObj{ "One", "Gone" })
+
+	var obj = TestObj{ Count: 5 }
+	if err := Codec.Unmarshal(blob, &obj); err != nil || obj.Name != "One" || obj.Count != 5 {
+		test.Errorf("Wrong object from old fields: %v (%v)", obj, err)
+	}
+
+	type smallObj struct {
+		Count int8
+	}
+	blob, _ = Codec.Marshal(&TestObj{ "Big", 1000 })
+	if err := Codec.Unmarshal(blob, &smallObj{}); err == nil {
+		test.Errorf("No error decoding into too small a field")
+	}
+}
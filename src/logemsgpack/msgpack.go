@@ -0,0 +1,253 @@
+package logemsgpack
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+// Just enough MessagePack for RPC frames and JSON-shaped objects. Maps
+// decode to map[string]interface{}, integers to int64 (or uint64 when
+// they don't fit), and extension types are refused.
+
+func writeValue(w *bufio.Writer, value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		return w.WriteByte(0xc0)
+	case bool:
+		if v {
+			return w.WriteByte(0xc3)
+		}
+		return w.WriteByte(0xc2)
+	case int:
+		writeInt(w, int64(v))
+	case int64:
+		writeInt(w, v)
+	case uint64:
+		if v <= math.MaxInt64 {
+			writeInt(w, int64(v))
+		} else {
+			w.WriteByte(0xcf)
+			writeUint(w, v, 8)
+		}
+	case float64:
+		w.WriteByte(0xcb)
+		writeUint(w, math.Float64bits(v), 8)
+	case json.Number:
+		if i, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			writeInt(w, i)
+		} else if f, err := strconv.ParseFloat(string(v), 64); err == nil {
+			return writeValue(w, f)
+		} else {
+			return writeValue(w, string(v))
+		}
+	case string:
+		writeHeader(w, len(v), 0xa0, 31, 0xd9, 0xda, 0xdb)
+		w.WriteString(v)
+	case []byte:
+		writeHeader(w, len(v), 0, -1, 0xc4, 0xc5, 0xc6)
+		w.Write(v)
+	case []string:
+		writeHeader(w, len(v), 0x90, 15, 0, 0xdc, 0xdd)
+		for _, item := range v {
+			writeValue(w, item)
+		}
+	case []interface{}:
+		writeHeader(w, len(v), 0x90, 15, 0, 0xdc, 0xdd)
+		for _, item := range v {
+			if err := writeValue(w, item); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		writeHeader(w, len(v), 0x80, 15, 0, 0xde, 0xdf)
+		for key, item := range v {
+			writeValue(w, key)
+			if err := writeValue(w, item); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("Can't encode %T", value)
+	}
+	return nil
+}
+
+func writeInt(w *bufio.Writer, v int64) {
+	switch {
+	case v >= 0 && v <= 0x7f:
+		w.WriteByte(byte(v))
+	case v < 0 && v >= -32:
+		w.WriteByte(byte(v))
+	case v >= math.MinInt8 && v <= math.MaxInt8:
+		w.WriteByte(0xd0)
+		w.WriteByte(byte(v))
+	case v >= math.MinInt16 && v <= math.MaxInt16:
+		w.WriteByte(0xd1)
+		writeUint(w, uint64(v), 2)
+	case v >= math.MinInt32 && v <= math.MaxInt32:
+		w.WriteByte(0xd2)
+		writeUint(w, uint64(v), 4)
+	default:
+		w.WriteByte(0xd3)
+		writeUint(w, uint64(v), 8)
+	}
+}
+
+// Fixed-size formats take fixMax >= 0; format8 is zero for types
+// without an 8-bit length
+func writeHeader(w *bufio.Writer, length int, fix byte, fixMax int, format8 byte, format16 byte, format32 byte) {
+	switch {
+	case length <= fixMax:
+		w.WriteByte(fix | byte(length))
+	case format8 != 0 && length <= math.MaxUint8:
+		w.WriteByte(format8)
+		w.WriteByte(byte(length))
+	case length <= math.MaxUint16:
+		w.WriteByte(format16)
+		writeUint(w, uint64(length), 2)
+	default:
+		w.WriteByte(format32)
+		writeUint(w, uint64(length), 4)
+	}
+}
+
+func writeUint(w *bufio.Writer, v uint64, size int) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	w.Write(buf[8 - size:])
+}
+
+func readValue(r *bufio.Reader) (interface{}, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case tag <= 0x7f:
+		return int64(tag), nil
+	case tag >= 0xe0:
+		return int64(int8(tag)), nil
+	case tag & 0xf0 == 0x80:
+		return readMap(r, int(tag & 0x0f))
+	case tag & 0xf0 == 0x90:
+		return readArray(r, int(tag & 0x0f))
+	case tag & 0xe0 == 0xa0:
+		return readString(r, int(tag & 0x1f))
+	}
+
+	switch tag {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		length, err := readUint(r, 1 << (tag - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		return readBytes(r, int(length))
+	case 0xca:
+		bits, err := readUint(r, 4)
+		return float64(math.Float32frombits(uint32(bits))), err
+	case 0xcb:
+		bits, err := readUint(r, 8)
+		return math.Float64frombits(bits), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		v, err := readUint(r, 1 << (tag - 0xcc))
+		if v > math.MaxInt64 {
+			return v, err
+		}
+		return int64(v), err
+	case 0xd0:
+		v, err := readUint(r, 1)
+		return int64(int8(v)), err
+	case 0xd1:
+		v, err := readUint(r, 2)
+		return int64(int16(v)), err
+	case 0xd2:
+		v, err := readUint(r, 4)
+		return int64(int32(v)), err
+	case 0xd3:
+		v, err := readUint(r, 8)
+		return int64(v), err
+	case 0xd9, 0xda, 0xdb:
+		length, err := readUint(r, 1 << (tag - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return readString(r, int(length))
+	case 0xdc, 0xdd:
+		length, err := readUint(r, 2 << (tag - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return readArray(r, int(length))
+	case 0xde, 0xdf:
+		length, err := readUint(r, 2 << (tag - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return readMap(r, int(length))
+	}
+
+	return nil, fmt.Errorf("Unsupported msgpack type 0x%02x", tag)
+}
+
+func readUint(r *bufio.Reader, size int) (uint64, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(r, buf[8 - size:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(buf[:]), nil
+}
+
+func readBytes(r *bufio.Reader, length int) ([]byte, error) {
+	var buf = make([]byte, length)
+	_, err := io.ReadFull(r, buf)
+	return buf, err
+}
+
+func readString(r *bufio.Reader, length int) (interface{}, error) {
+	buf, err := readBytes(r, length)
+	return string(buf), err
+}
+
+func readArray(r *bufio.Reader, length int) (interface{}, error) {
+	var items = make([]interface{}, 0, length)
+	for i := 0; i < length; i++ {
+		item, err := readValue(r)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func readMap(r *bufio.Reader, length int) (interface{}, error) {
+	var items = make(map[string]interface{}, length)
+	for i := 0; i < length; i++ {
+		key, err := readValue(r)
+		if err != nil {
+			return nil, err
+		}
+		value, err := readValue(r)
+		if err != nil {
+			return nil, err
+		}
+		strKey, ok := key.(string)
+		if !ok {
+			return nil, fmt.Errorf("Map keys must be strings, not %T", key)
+		}
+		items[strKey] = value
+	}
+	return items, nil
+}
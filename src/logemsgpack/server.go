@@ -0,0 +1,286 @@
+package logemsgpack
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+
+	"loge"
+)
+
+// Remote transactions over msgpack-RPC, for small clients where a gRPC
+// toolchain is unwelcome. Requests are [0, msgid, method, params] and
+// responses [1, msgid, error, result]; objects are plain msgpack maps.
+//
+//   begin                                   -> transaction id
+//   read      [id, type, key]               -> object or nil
+//   write     [id, type, key, object]
+//   delete    [id, type, key]
+//   links     [id, type, link, key]         -> [target...]
+//   add_link  [id, type, link, key, target]
+//   remove_link [id, type, link, key, target]
+//   commit    [id]                          -> true if committed
+//   rollback  [id]
+//
+// A transaction belongs to the connection that began it, and is
+// cancelled if the connection closes first.
+type Server struct {
+	DB *loge.LogeDB
+}
+
+const (
+	msgRequest = 0
+	msgResponse = 1
+)
+
+type method struct {
+	args int
+	run func(c *conn, args []interface{}) interface{}
+}
+
+var methods = map[string]method{
+	"begin": { 0, rpcBegin },
+	"read": { 3, rpcRead },
+	"write": { 4, rpcWrite },
+	"delete": { 3, rpcDelete },
+	"links": { 4, rpcLinks },
+	"add_link": { 5, rpcAddLink },
+	"remove_link": { 5, rpcRemoveLink },
+	"commit": { 1, rpcCommit },
+	"rollback": { 1, rpcRollback },
+}
+
+func NewServer(db *loge.LogeDB) *Server {
+	return &Server{ DB: db }
+}
+
+func (s *Server) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+func (s *Server) Serve(listener net.Listener) error {
+	defer listener.Close()
+	for {
+		netConn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go s.ServeConn(netConn)
+	}
+}
+
+func (s *Server) ServeConn(netConn io.ReadWriteCloser) {
+	var c = &conn{
+		server: s,
+		reader: bufio.NewReader(netConn),
+		writer: bufio.NewWriter(netConn),
+		transactions: make(map[int64]*loge.Transaction),
+	}
+
+	defer func() {
+		for _, trans := range c.transactions {
+			trans.Cancel()
+		}
+		netConn.Close()
+	}()
+
+	for {
+		frame, err := readValue(c.reader)
+		if err != nil {
+			return
+		}
+		msg, ok := frame.([]interface{})
+		if !ok || len(msg) != 4 || msg[0] != int64(msgRequest) {
+			return
+		}
+		if !c.handle(msg[1], msg[2], msg[3]) {
+			return
+		}
+	}
+}
+
+// -----------------------------------------------
+// Connections
+// -----------------------------------------------
+
+type conn struct {
+	server *Server
+	reader *bufio.Reader
+	writer *bufio.Writer
+	lastID int64
+	transactions map[int64]*loge.Transaction
+}
+
+func (c *conn) handle(msgID interface{}, name interface{}, params interface{}) bool {
+	var result interface{}
+	var rerr interface{}
+
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				rerr = fmt.Sprint(r)
+			}
+		}()
+
+		m, ok := methods[fmt.Sprint(name)]
+		if !ok {
+			panic(fmt.Sprintf("No such method: %v", name))
+		}
+		args, ok := params.([]interface{})
+		if !ok || len(args) != m.args {
+			panic(fmt.Sprintf("%v takes %d params", name, m.args))
+		}
+		result = m.run(c, args)
+	}()
+
+	if writeValue(c.writer, []interface{}{ int64(msgResponse), msgID, rerr, result }) != nil {
+		return false
+	}
+	return c.writer.Flush() == nil
+}
+
+// -----------------------------------------------
+// Methods
+// -----------------------------------------------
+
+func rpcBegin(c *conn, args []interface{}) interface{} {
+	c.lastID++
+	c.transactions[c.lastID] = c.server.DB.CreateTransaction()
+	return c.lastID
+}
+
+func rpcRead(c *conn, args []interface{}) interface{} {
+	var trans = c.transaction(args[0])
+	var typeName, key = c.objectArgs(args[1:])
+	if !trans.Exists(typeName, key) {
+		return nil
+	}
+	return toValue(trans.Read(typeName, key))
+}
+
+func rpcWrite(c *conn, args []interface{}) interface{} {
+	var trans = c.transaction(args[0])
+	var typeName, key = c.objectArgs(args[1:])
+	trans.Set(typeName, key, c.fromValue(typeName, args[3]))
+	return nil
+}
+
+func rpcDelete(c *conn, args []interface{}) interface{} {
+	var trans = c.transaction(args[0])
+	var typeName, key = c.objectArgs(args[1:])
+	trans.Delete(typeName, key)
+	return nil
+}
+
+func rpcLinks(c *conn, args []interface{}) interface{} {
+	var trans = c.transaction(args[0])
+	var typeName, linkName, key = c.linkArgs(args[1:])
+	var links = trans.ReadLinks(typeName, linkName, key)
+	var keys = make([]string, 0, len(links))
+	for _, link := range links {
+		keys = append(keys, string(link))
+	}
+	return keys
+}
+
+func rpcAddLink(c *conn, args []interface{}) interface{} {
+	var trans = c.transaction(args[0])
+	var typeName, linkName, key = c.linkArgs(args[1:])
+	trans.AddLink(typeName, linkName, key, loge.LogeKey(stringArg(args[4])))
+	return nil
+}
+
+func rpcRemoveLink(c *conn, args []interface{}) interface{} {
+	var trans = c.transaction(args[0])
+	var typeName, linkName, key = c.linkArgs(args[1:])
+	trans.RemoveLink(typeName, linkName, key, loge.LogeKey(stringArg(args[4])))
+	return nil
+}
+
+func rpcCommit(c *conn, args []interface{}) interface{} {
+	var trans = c.transaction(args[0])
+	delete(c.transactions, args[0].(int64))
+	return trans.Commit()
+}
+
+func rpcRollback(c *conn, args []interface{}) interface{} {
+	var trans = c.transaction(args[0])
+	delete(c.transactions, args[0].(int64))
+	trans.Cancel()
+	return nil
+}
+
+// -----------------------------------------------
+// Helpers
+// -----------------------------------------------
+
+func (c *conn) transaction(arg interface{}) *loge.Transaction {
+	id, _ := arg.(int64)
+	trans, ok := c.transactions[id]
+	if !ok {
+		panic(fmt.Sprintf("No such transaction: %v", arg))
+	}
+	return trans
+}
+
+func (c *conn) objectArgs(args []interface{}) (string, loge.LogeKey) {
+	var typeName = stringArg(args[0])
+	if c.server.DB.Type(typeName) == nil {
+		panic(fmt.Sprintf("No such type: %s", typeName))
+	}
+	return typeName, loge.LogeKey(stringArg(args[1]))
+}
+
+func (c *conn) linkArgs(args []interface{}) (string, string, loge.LogeKey) {
+	var typeName, _ = c.objectArgs(args)
+	var linkName = stringArg(args[1])
+	if _, ok := c.server.DB.Type(typeName).Links[linkName]; !ok {
+		panic(fmt.Sprintf("No such link: %s.%s", typeName, linkName))
+	}
+	return typeName, linkName, loge.LogeKey(stringArg(args[2]))
+}
+
+func stringArg(arg interface{}) string {
+	switch v := arg.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	}
+	panic(fmt.Sprintf("Expected string, got %T", arg))
+}
+
+// Objects go through their JSON form, so field names and tags match the
+// other remote interfaces
+func toValue(obj interface{}) interface{} {
+	enc, err := json.Marshal(obj)
+	if err != nil {
+		panic(err)
+	}
+	var decoder = json.NewDecoder(bytes.NewReader(enc))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		panic(err)
+	}
+	return value
+}
+
+func (c *conn) fromValue(typeName string, value interface{}) interface{} {
+	enc, err := json.Marshal(value)
+	if err != nil {
+		panic(fmt.Sprintf("Bad object: %v", err))
+	}
+	var obj = c.server.DB.Type(typeName).NewValue()
+	if err := json.Unmarshal(enc, obj); err != nil {
+		panic(fmt.Sprintf("Bad object for %s: %v", typeName, err))
+	}
+	return obj
+}
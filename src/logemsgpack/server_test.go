@@ -0,0 +1,115 @@
+package logemsgpack
+
+import (
+	"testing"
+	"bufio"
+	"net"
+	"reflect"
+
+	"loge"
+)
+
+type TestObj struct {
+	Name string
+	Count int
+}
+
+type client struct {
+	test *testing.T
+	reader *bufio.Reader
+	writer *bufio.Writer
+	lastID int64
+}
+
+func testClient(test *testing.T) (*client, *loge.LogeDB) {
+	var db = loge.NewLogeDB(loge.NewMemStore())
+	var def = loge.NewTypeDef("test", 1, &TestObj{})
+	def.Links = loge.LinkSpec{ "other": "test" }
+	db.CreateType(def)
+
+	serverConn, clientConn := net.Pipe()
+	go NewServer(db).ServeConn(serverConn)
+	return &client{ test, bufio.NewReader(clientConn), bufio.NewWriter(clientConn), 0 }, db
+}
+
+func (c *client) call(method string, params ...interface{}) (interface{}, interface{}) {
+	c.lastID++
+	if params == nil {
+		params = []interface{}{}
+	}
+	writeValue(c.writer, []interface{}{ int64(msgRequest), c.lastID, method, params })
+	c.writer.Flush()
+
+	frame, err := readValue(c.reader)
+	if err != nil {
+		c.test.Fatal(err)
+	}
+	var msg = frame.([]interface{})
+	if msg[0] != int64(msgResponse) || msg[1] != c.lastID {
+		c.test.Fatalf("Bad response frame: %v", msg)
+	}
+	return msg[2], msg[3]
+}
+
+func TestTransaction(test *testing.T) {
+	var c, db = testClient(test)
+
+	_, tid := c.call("begin")
+	c.call("write", tid, "test", "one", map[string]interface{}{ "Name": "One", "Count": int64(300) })
+	c.call("add_link", tid, "test", "other", "one", "two")
+	if rerr, ok := c.call("commit", tid); rerr != nil || ok != true {
+		test.Fatalf("Commit failed: %v", rerr)
+	}
+
+	if obj := db.ReadOne("test", "one").(*TestObj); obj.Name != "One" || obj.Count != 300 {
+		test.Errorf("Wrong object stored: %v", obj)
+	}
+
+	_, tid = c.call("begin")
+	rerr, obj := c.call("read", tid, "test", "one")
+	var expected = map[string]interface{}{ "Name": "One", "Count": int64(300) }
+	if rerr != nil || !reflect.DeepEqual(obj, expected) {
+		test.Errorf("Wrong read: %v (%v)", obj, rerr)
+	}
+	if _, links := c.call("links", tid, "test", "other", "one"); !reflect.DeepEqual(links, []interface{}{ "two" }) {
+		test.Errorf("Wrong links: %v", links)
+	}
+	if _, obj := c.call("read", tid, "test", "missing"); obj != nil {
+		test.Errorf("Missing object read as %v", obj)
+	}
+	c.call("rollback", tid)
+
+	if rerr, _ := c.call("read", tid, "test", "one"); rerr != "No such transaction: 2" {
+		test.Errorf("Wrong error after rollback: %v", rerr)
+	}
+	if rerr, _ := c.call("frobnicate"); rerr != "No such method: frobnicate" {
+		test.Errorf("Wrong error for bad method: %v", rerr)
+	}
+}
+
+func TestCodec(test *testing.T) {
+	var values = []interface{}{
+		nil, true, false, int64(0), int64(-1), int64(-33), int64(200), int64(-200),
+		int64(70000), int64(-70000), int64(1 << 40), 3.5, "", "short",
+		string(make([]byte, 300)), []byte{ 1, 2, 3 },
+		[]interface{}{ int64(1), "two", nil },
+		map[string]interface{}{ "a": int64(1), "b": []interface{}{} },
+	}
+
+	serverConn, clientConn := net.Pipe()
+	var writer = bufio.NewWriter(serverConn)
+	go func() {
+		for _, value := range values {
+			writeValue(writer, value)
+		}
+		writer.Flush()
+	}()
+
+	var reader = bufio.NewReader(clientConn)
+	for _, value := range values {
+		decoded, err := readValue(reader)
+		if err != nil || !reflect.DeepEqual(decoded, value) {
+			test.Errorf("Round trip of %#v gave %#v (%v)", value, decoded, err)
+		}
+	}
+}
@@ -0,0 +1,436 @@
+package logeredis
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"loge"
+	"logeauth"
+)
+
+// A subset of the Redis protocol over a loge database, so existing Redis
+// clients can read and write it during a migration. Keys map onto
+// objects and links:
+//
+//   GET/SET/DEL/EXISTS  {type}:{key}           object, as JSON
+//   SADD/SREM/SMEMBERS  {type}:{link}:{key}    link targets
+//   SISMEMBER/SCARD
+//
+// plus PING, AUTH and QUIT. Each command runs in its own transaction.
+// With a Guard set, clients must AUTH with a token first.
+type Server struct {
+	DB *loge.LogeDB
+	Timeout time.Duration
+	Guard *logeauth.Guard
+}
+
+type redisError struct {
+	Prefix string
+	Message string
+}
+
+type command struct {
+	minArgs int
+	maxArgs int
+	run func(c *conn, args []string)
+}
+
+var commands = map[string]command{
+	"PING": { 0, 1, cmdPing },
+	"AUTH": { 1, 2, cmdAuth },
+	"QUIT": { 0, 0, cmdQuit },
+	"GET": { 1, 1, cmdGet },
+	"SET": { 2, 2, cmdSet },
+	"DEL": { 1, -1, cmdDel },
+	"EXISTS": { 1, -1, cmdExists },
+	"SADD": { 2, -1, cmdSAdd },
+	"SREM": { 2, -1, cmdSRem },
+	"SMEMBERS": { 1, 1, cmdSMembers },
+	"SISMEMBER": { 2, 2, cmdSIsMember },
+	"SCARD": { 1, 1, cmdSCard },
+}
+
+func NewServer(db *loge.LogeDB) *Server {
+	return &Server{
+		DB: db,
+		Timeout: 5 * time.Second,
+	}
+}
+
+func (s *Server) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+func (s *Server) Serve(listener net.Listener) error {
+	defer listener.Close()
+	for {
+		netConn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go s.ServeConn(netConn)
+	}
+}
+
+func (s *Server) ServeConn(netConn io.ReadWriteCloser) {
+	defer netConn.Close()
+
+	var c = &conn{
+		server: s,
+		reader: bufio.NewReader(netConn),
+		writer: bufio.NewWriter(netConn),
+	}
+
+	for !c.quit {
+		args, err := c.readCommand()
+		if err != nil {
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		c.dispatch(args)
+		if c.writer.Flush() != nil {
+			return
+		}
+	}
+}
+
+// -----------------------------------------------
+// Connections
+// -----------------------------------------------
+
+type conn struct {
+	server *Server
+	reader *bufio.Reader
+	writer *bufio.Writer
+	principal *logeauth.Principal
+	quit bool
+}
+
+func (c *conn) dispatch(args []string) {
+	defer func() {
+		if r := recover(); r != nil {
+			if rerr, ok := r.(redisError); ok {
+				c.writeError(rerr.Prefix, rerr.Message)
+				return
+			}
+			c.writeError("ERR", fmt.Sprintf("%v", r))
+		}
+	}()
+
+	var name = strings.ToUpper(args[0])
+	cmd, ok := commands[name]
+	if !ok {
+		fail("ERR", fmt.Sprintf("unknown command '%s'", args[0]))
+	}
+
+	var count = len(args) - 1
+	if count < cmd.minArgs || (cmd.maxArgs >= 0 && count > cmd.maxArgs) {
+		fail("ERR", fmt.Sprintf("wrong number of arguments for '%s' command", strings.ToLower(name)))
+	}
+
+	if c.server.Guard != nil && c.principal == nil && name != "AUTH" && name != "PING" && name != "QUIT" {
+		fail("NOAUTH", "Authentication required.")
+	}
+
+	cmd.run(c, args[1:])
+}
+
+// Multibulk arrays from clients, or inline commands from telnet
+func (c *conn) readCommand() ([]string, error) {
+	line, err := c.readLine()
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(line, "*") {
+		return strings.Fields(line), nil
+	}
+
+	count, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return nil, fmt.Errorf("Bad array length: %s", line)
+	}
+
+	var args = make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		header, err := c.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(header, "$") {
+			return nil, fmt.Errorf("Expected bulk string: %s", header)
+		}
+		size, err := strconv.Atoi(header[1:])
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("Bad bulk length: %s", header)
+		}
+		var buf = make([]byte, size + 2)
+		if _, err := io.ReadFull(c.reader, buf); err != nil {
+			return nil, err
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+func (c *conn) readLine() (string, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (c *conn) writeStatus(status string) {
+	fmt.Fprintf(c.writer, "+%s\r\n", status)
+}
+
+func (c *conn) writeError(prefix string, message string) {
+	fmt.Fprintf(c.writer, "-%s %s\r\n", prefix, message)
+}
+
+func (c *conn) writeInt(value int) {
+	fmt.Fprintf(c.writer, ":%d\r\n", value)
+}
+
+func (c *conn) writeBulk(value []byte) {
+	if value == nil {
+		c.writer.WriteString("$-1\r\n")
+		return
+	}
+	fmt.Fprintf(c.writer, "$%d\r\n", len(value))
+	c.writer.Write(value)
+	c.writer.WriteString("\r\n")
+}
+
+func (c *conn) writeArray(values []string) {
+	fmt.Fprintf(c.writer, "*%d\r\n", len(values))
+	for _, value := range values {
+		c.writeBulk([]byte(value))
+	}
+}
+
+// -----------------------------------------------
+// Commands
+// -----------------------------------------------
+
+func cmdPing(c *conn, args []string) {
+	if len(args) == 1 {
+		c.writeBulk([]byte(args[0]))
+		return
+	}
+	c.writeStatus("PONG")
+}
+
+// AUTH <token> or AUTH <username> <token>
+func cmdAuth(c *conn, args []string) {
+	if c.server.Guard == nil {
+		fail("ERR", "AUTH called without any password configured")
+	}
+	var creds = logeauth.Credentials{ Token: args[len(args) - 1] }
+	principal, err := c.server.Guard.Authenticate(creds)
+	if err != nil {
+		fail("WRONGPASS", "invalid token")
+	}
+	c.principal = principal
+	c.writeStatus("OK")
+}
+
+func cmdQuit(c *conn, args []string) {
+	c.quit = true
+	c.writeStatus("OK")
+}
+
+func cmdGet(c *conn, args []string) {
+	var typeName, key = c.objectKey(args[0], logeauth.OpRead)
+
+	var enc []byte
+	c.transact(func (t *loge.Transaction) {
+		enc = nil
+		if !t.Exists(typeName, key) {
+			return
+		}
+		var err error
+		enc, err = json.Marshal(t.Read(typeName, key))
+		if err != nil {
+			panic(err)
+		}
+	})
+	c.writeBulk(enc)
+}
+
+func cmdSet(c *conn, args []string) {
+	var typeName, key = c.objectKey(args[0], logeauth.OpWrite)
+
+	var obj = c.server.DB.Type(typeName).NewValue()
+	if err := json.Unmarshal([]byte(args[1]), obj); err != nil {
+		fail("ERR", fmt.Sprintf("Bad JSON for %s: %v", typeName, err))
+	}
+
+	c.transact(func (t *loge.Transaction) {
+		t.Set(typeName, key, obj)
+	})
+	c.writeStatus("OK")
+}
+
+func cmdDel(c *conn, args []string) {
+	var count int
+	c.eachObject(args, logeauth.OpDelete, &count, func (t *loge.Transaction, typeName string, key loge.LogeKey) {
+		t.Delete(typeName, key)
+	})
+	c.writeInt(count)
+}
+
+func cmdExists(c *conn, args []string) {
+	var count int
+	c.eachObject(args, logeauth.OpRead, &count, nil)
+	c.writeInt(count)
+}
+
+func cmdSAdd(c *conn, args []string) {
+	var typeName, linkName, key = c.linkKey(args[0], logeauth.OpLink)
+
+	var count int
+	c.transact(func (t *loge.Transaction) {
+		count = 0
+		for _, target := range args[1:] {
+			if !t.HasLink(typeName, linkName, key, loge.LogeKey(target)) {
+				t.AddLink(typeName, linkName, key, loge.LogeKey(target))
+				count++
+			}
+		}
+	})
+	c.writeInt(count)
+}
+
+func cmdSRem(c *conn, args []string) {
+	var typeName, linkName, key = c.linkKey(args[0], logeauth.OpLink)
+
+	var count int
+	c.transact(func (t *loge.Transaction) {
+		count = 0
+		for _, target := range args[1:] {
+			if t.HasLink(typeName, linkName, key, loge.LogeKey(target)) {
+				t.RemoveLink(typeName, linkName, key, loge.LogeKey(target))
+				count++
+			}
+		}
+	})
+	c.writeInt(count)
+}
+
+func cmdSMembers(c *conn, args []string) {
+	c.writeArray(c.readLinks(args[0]))
+}
+
+func cmdSIsMember(c *conn, args []string) {
+	var typeName, linkName, key = c.linkKey(args[0], logeauth.OpRead)
+
+	var found bool
+	c.transact(func (t *loge.Transaction) {
+		found = t.HasLink(typeName, linkName, key, loge.LogeKey(args[1]))
+	})
+	if found {
+		c.writeInt(1)
+	} else {
+		c.writeInt(0)
+	}
+}
+
+func cmdSCard(c *conn, args []string) {
+	c.writeInt(len(c.readLinks(args[0])))
+}
+
+// -----------------------------------------------
+// Helpers
+// -----------------------------------------------
+
+func (c *conn) transact(actor loge.Transactor) {
+	if !c.server.DB.Transact(actor, c.server.Timeout) {
+		fail("ERR", "Transaction failed")
+	}
+}
+
+func (c *conn) readLinks(redisKey string) []string {
+	var typeName, linkName, key = c.linkKey(redisKey, logeauth.OpRead)
+
+	var links []string
+	c.transact(func (t *loge.Transaction) {
+		links = nil
+		for _, link := range t.ReadLinks(typeName, linkName, key) {
+			links = append(links, string(link))
+		}
+	})
+	return links
+}
+
+// Counts the keys which exist, and runs action on them, all in one
+// transaction
+func (c *conn) eachObject(redisKeys []string, op logeauth.Operation, count *int, action func(*loge.Transaction, string, loge.LogeKey)) {
+	var typeNames = make([]string, len(redisKeys))
+	var keys = make([]loge.LogeKey, len(redisKeys))
+	for i, redisKey := range redisKeys {
+		typeNames[i], keys[i] = c.objectKey(redisKey, op)
+	}
+
+	c.transact(func (t *loge.Transaction) {
+		*count = 0
+		for i, key := range keys {
+			if !t.Exists(typeNames[i], key) {
+				continue
+			}
+			*count++
+			if action != nil {
+				action(t, typeNames[i], key)
+			}
+		}
+	})
+}
+
+func (c *conn) objectKey(redisKey string, op logeauth.Operation) (string, loge.LogeKey) {
+	var parts = strings.SplitN(redisKey, ":", 2)
+	if len(parts) != 2 {
+		fail("ERR", fmt.Sprintf("Key must be type:key: %s", redisKey))
+	}
+	return c.checkType(parts[0], op), loge.LogeKey(parts[1])
+}
+
+func (c *conn) linkKey(redisKey string, op logeauth.Operation) (string, string, loge.LogeKey) {
+	var parts = strings.SplitN(redisKey, ":", 3)
+	if len(parts) != 3 {
+		fail("ERR", fmt.Sprintf("Key must be type:link:key: %s", redisKey))
+	}
+	var typeName = c.checkType(parts[0], op)
+	if _, ok := c.server.DB.Type(typeName).Links[parts[1]]; !ok {
+		fail("ERR", fmt.Sprintf("No such link: %s.%s", typeName, parts[1]))
+	}
+	return typeName, parts[1], loge.LogeKey(parts[2])
+}
+
+func (c *conn) checkType(typeName string, op logeauth.Operation) string {
+	if c.server.DB.Type(typeName) == nil {
+		fail("ERR", fmt.Sprintf("No such type: %s", typeName))
+	}
+	if c.server.Guard != nil && c.server.Guard.Authorizer != nil {
+		if err := c.server.Guard.Authorizer.Authorize(c.principal, op, typeName); err != nil {
+			fail("NOPERM", err.Error())
+		}
+	}
+	return typeName
+}
+
+func fail(prefix string, message string) {
+	panic(redisError{ prefix, message })
+}
@@ -0,0 +1,154 @@
+package logeredis
+
+import (
+	"testing"
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+
+	"loge"
+	"logeauth"
+)
+
+type TestObj struct {
+	Name string
+}
+
+type client struct {
+	test *testing.T
+	conn net.Conn
+	reader *bufio.Reader
+}
+
+func testClient(test *testing.T, guard *logeauth.Guard) *client {
+	var db = loge.NewLogeDB(loge.NewMemStore())
+	var def = loge.NewTypeDef("test", 1, &TestObj{})
+	def.Links = loge.LinkSpec{ "other": "test" }
+	db.CreateType(def)
+
+	var server = NewServer(db)
+	server.Guard = guard
+
+	serverConn, clientConn := net.Pipe()
+	go server.ServeConn(serverConn)
+	return &client{ test, clientConn, bufio.NewReader(clientConn) }
+}
+
+// Sends a command and returns the reply flattened to one line
+func (c *client) do(args ...string) string {
+	var req = fmt.Sprintf("*%d\r\n", len(args))
+	for _, arg := range args {
+		req += fmt.Sprintf("$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := c.conn.Write([]byte(req)); err != nil {
+		c.test.Fatal(err)
+	}
+	return c.readReply()
+}
+
+func (c *client) readReply() string {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		c.test.Fatal(err)
+	}
+	line = strings.TrimRight(line, "\r\n")
+
+	switch line[0] {
+	case '$':
+		if line == "$-1" {
+			return "(nil)"
+		}
+		body, _ := c.reader.ReadString('\n')
+		return strings.TrimRight(body, "\r\n")
+	case '*':
+		var count int
+		fmt.Sscanf(line[1:], "%d", &count)
+		var items []string
+		for i := 0; i < count; i++ {
+			items = append(items, c.readReply())
+		}
+		return "[" + strings.Join(items, " ") + "]"
+	}
+	return line
+}
+
+func TestObjects(test *testing.T) {
+	var c = testClient(test, nil)
+	defer c.conn.Close()
+
+	var checks = [][]string{
+		{ "+PONG", "PING" },
+		{ "(nil)", "GET", "test:one" },
+		{ "+OK", "SET", "test:one", `{"Name":"One"}` },
+		{ `{"Name":"One"}`, "GET", "test:one" },
+		{ ":1", "EXISTS", "test:one", "test:two" },
+		{ ":1", "DEL", "test:one" },
+		{ "(nil)", "GET", "test:one" },
+		{ "-ERR No such type: nope", "GET", "nope:one" },
+		{ "-ERR unknown command 'FLUSHALL'", "FLUSHALL" },
+	}
+
+	for _, check := range checks {
+		if reply := c.do(check[1:]...); reply != check[0] {
+			test.Errorf("%v: expected %s, got %s", check[1:], check[0], reply)
+		}
+	}
+}
+
+func TestLinks(test *testing.T) {
+	var c = testClient(test, nil)
+	defer c.conn.Close()
+
+	var checks = [][]string{
+		{ ":2", "SADD", "test:other:one", "two", "three" },
+		{ ":1", "SADD", "test:other:one", "two", "four" },
+		{ "[four three two]", "SMEMBERS", "test:other:one" },
+		{ ":1", "SISMEMBER", "test:other:one", "three" },
+		{ ":1", "SREM", "test:other:one", "three", "five" },
+		{ ":2", "SCARD", "test:other:one" },
+		{ "-ERR No such link: test.nope", "SMEMBERS", "test:nope:one" },
+	}
+
+	for _, check := range checks {
+		if reply := c.do(check[1:]...); reply != check[0] {
+			test.Errorf("%v: expected %s, got %s", check[1:], check[0], reply)
+		}
+	}
+}
+
+func TestAuth(test *testing.T) {
+	var c = testClient(test, &logeauth.Guard{
+		Authenticator: logeauth.TokenAuthenticator{
+			"secret": &logeauth.Principal{ Name: "reader" },
+		},
+		Authorizer: logeauth.Policy{
+			{ Who: []string{"reader"}, Types: []string{"test"}, Ops: []logeauth.Operation{logeauth.OpRead} },
+		},
+	})
+	defer c.conn.Close()
+
+	var checks = [][]string{
+		{ "-NOAUTH Authentication required.", "GET", "test:one" },
+		{ "-WRONGPASS invalid token", "AUTH", "wrong" },
+		{ "+OK", "AUTH", "secret" },
+		{ "(nil)", "GET", "test:one" },
+		{ "-NOPERM reader may not write test", "SET", "test:one", "{}" },
+	}
+
+	for _, check := range checks {
+		if reply := c.do(check[1:]...); reply != check[0] {
+			test.Errorf("%v: expected %s, got %s", check[1:], check[0], reply)
+		}
+	}
+}
+
+func TestInline(test *testing.T) {
+	var c = testClient(test, nil)
+	defer c.conn.Close()
+
+	c.conn.Write([]byte("PING hello\r\n"))
+	if reply := c.readReply(); reply != "hello" {
+		test.Errorf("Wrong inline reply: %s", reply)
+	}
+}
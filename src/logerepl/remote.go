@@ -0,0 +1,78 @@
+package logerepl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"loge"
+	"logehttp"
+)
+
+// Follows a primary's logehttp feed, e.g. "http://primary:8080/feed".
+// Objects are decoded into the replica's own registered types. Returns
+// when the connection or ctx ends; the caller decides whether to
+// reconnect, and must resync if changes may have been missed meanwhile.
+func (r *Replica) FollowURL(ctx context.Context, feedURL string, header http.Header) error {
+	feed, err := logehttp.DialFeed(ctx, feedURL, header)
+	if err != nil {
+		return err
+	}
+	defer feed.Close()
+
+	go func() {
+		<-ctx.Done()
+		feed.Close()
+	}()
+
+	var changes = make(chan loge.Change, 1000)
+	var readErr error
+	go func() {
+		defer close(changes)
+		for {
+			msg, err := feed.Next()
+			if err != nil {
+				readErr = err
+				return
+			}
+			change, err := r.decodeChange(msg)
+			if err != nil {
+				readErr = err
+				return
+			}
+			changes <- change
+		}
+	}()
+
+	r.Follow(changes)
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return readErr
+}
+
+func (r *Replica) decodeChange(msg *logehttp.FeedMessage) (loge.Change, error) {
+	var change = loge.Change{
+		Type: msg.Type,
+		Key: msg.Key,
+		Link: msg.Link,
+		SnapshotID: msg.SnapshotID,
+		Time: msg.Time,
+		Links: msg.Links,
+		Deleted: msg.Deleted,
+	}
+
+	var typ = r.DB.Type(msg.Type)
+	if typ == nil {
+		return change, fmt.Errorf("Replica has no type %s", msg.Type)
+	}
+	if msg.Link == "" && !msg.Deleted {
+		change.Object = typ.NewValue()
+		if err := json.Unmarshal(msg.Object, change.Object); err != nil {
+			return change, fmt.Errorf("Bad %s object: %v", msg.Type, err)
+		}
+	}
+	return change, nil
+}
@@ -0,0 +1,221 @@
+package logerepl
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"loge"
+)
+
+// Asynchronous replication from a primary's change feed into a read
+// replica in another region. Replicas start from a copy of the primary
+// (Backup, or logecli dump/restore) taken after they subscribe, then
+// apply changes in commit order; each primary commit is applied in one
+// local transaction.
+//
+// When the primary is lost, Promote turns a replica into a writable
+// primary. Anything the old primary committed after the replica's last
+// applied change is then a conflict: it is recorded rather than applied,
+// noting whether the key was also written locally since promotion.
+type Replica struct {
+	Region string
+	DB *loge.LogeDB
+
+	lock sync.Mutex
+	applied uint64
+	seen uint64
+	delay time.Duration
+	appliedAt time.Time
+
+	promoted bool
+	promotedAt uint64
+	localSub *loge.Subscription
+	localWrites map[string]uint64
+	localOverflow bool
+	conflicts []Conflict
+}
+
+// Snapshot IDs are the primary's. Delay is the time between the primary
+// committing the last applied change and the replica applying it, so it
+// includes any clock skew between regions.
+type Lag struct {
+	Applied uint64
+	Behind uint64
+	Delay time.Duration
+	Idle time.Duration
+}
+
+type Conflict struct {
+	Change loge.Change
+	LocalWrite bool
+}
+
+var ErrResync = errors.New("Change feed overflowed; replica needs a fresh copy")
+
+const promotedFeedBuffer = 10000
+
+func NewReplica(region string, db *loge.LogeDB) *Replica {
+	return &Replica{
+		Region: region,
+		DB: db,
+	}
+}
+
+// Applies changes until the channel closes
+func (r *Replica) Follow(changes <-chan loge.Change) {
+	for change := range changes {
+		var batch = []loge.Change{ change }
+		for len(changes) > 0 {
+			batch = append(batch, <-changes)
+		}
+		r.Apply(batch)
+	}
+}
+
+// Follows a subscription to a primary in the same process, returning
+// ErrResync if the replica fell too far behind and was dropped
+func (r *Replica) FollowSubscription(sub *loge.Subscription) error {
+	r.Follow(sub.C)
+	if sub.Overflowed() {
+		return ErrResync
+	}
+	return nil
+}
+
+// Changes must be in commit order. Changes with the same snapshot ID
+// came from one commit, and are applied together.
+func (r *Replica) Apply(changes []loge.Change) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for len(changes) > 0 {
+		var end = 1
+		for end < len(changes) && changes[end].SnapshotID == changes[0].SnapshotID {
+			end++
+		}
+		r.applyCommit(changes[:end])
+		changes = changes[end:]
+	}
+}
+
+func (r *Replica) applyCommit(changes []loge.Change) {
+	var sID = changes[0].SnapshotID
+	if sID > r.seen {
+		r.seen = sID
+	}
+	if sID <= r.applied {
+		return
+	}
+
+	if r.promoted {
+		r.recordConflicts(changes)
+		return
+	}
+
+	var ok = r.DB.Transact(func (t *loge.Transaction) {
+		for _, change := range changes {
+			applyChange(t, change)
+		}
+	}, 0)
+	if !ok {
+		panic(fmt.Sprintf("Replica %s couldn't apply snapshot %d", r.Region, sID))
+	}
+
+	r.applied = sID
+	r.appliedAt = time.Now()
+	r.delay = r.appliedAt.Sub(changes[0].Time)
+}
+
+func applyChange(t *loge.Transaction, change loge.Change) {
+	switch {
+	case change.Link != "":
+		t.SetLinks(change.Type, change.Link, change.Key, change.Links)
+	case change.Deleted:
+		t.Delete(change.Type, change.Key)
+	default:
+		t.Set(change.Type, change.Key, change.Object)
+	}
+}
+
+func (r *Replica) Lag() Lag {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var lag = Lag{
+		Applied: r.applied,
+		Behind: r.seen - r.applied,
+		Delay: r.delay,
+	}
+	if !r.appliedAt.IsZero() {
+		lag.Idle = time.Since(r.appliedAt)
+	}
+	return lag
+}
+
+// -----------------------------------------------
+// Failover
+// -----------------------------------------------
+
+// Stops applying the old primary's changes. Returns the last primary
+// snapshot this replica has, which is where it diverges.
+func (r *Replica) Promote() uint64 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if !r.promoted {
+		r.promoted = true
+		r.promotedAt = r.applied
+		r.localWrites = make(map[string]uint64)
+		r.localSub = r.DB.Subscribe(promotedFeedBuffer)
+	}
+	return r.promotedAt
+}
+
+func (r *Replica) Promoted() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.promoted
+}
+
+// Changes from the old primary which this replica never applied
+func (r *Replica) Conflicts() []Conflict {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.collectLocalWrites()
+	return append([]Conflict(nil), r.conflicts...)
+}
+
+func (r *Replica) recordConflicts(changes []loge.Change) {
+	r.collectLocalWrites()
+	for _, change := range changes {
+		var _, local = r.localWrites[changeKey(change)]
+		r.conflicts = append(r.conflicts, Conflict{
+			Change: change,
+			LocalWrite: local || r.localOverflow,
+		})
+	}
+}
+
+// Local commits publish synchronously, so everything committed so far
+// is already waiting in the subscription
+func (r *Replica) collectLocalWrites() {
+	if r.localSub == nil {
+		return
+	}
+	for len(r.localSub.C) > 0 {
+		var change = <-r.localSub.C
+		r.localWrites[changeKey(change)] = change.SnapshotID
+	}
+	if r.localSub.Overflowed() {
+		// Too many local writes to track individually: assume every key
+		// was written from here on
+		r.localSub = nil
+		r.localOverflow = true
+	}
+}
+
+func changeKey(change loge.Change) string {
+	return change.Type + "\x00" + change.Link + "\x00" + string(change.Key)
+}
@@ -0,0 +1,163 @@
+package logerepl
+
+import (
+	"testing"
+	"context"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"loge"
+	"logehttp"
+)
+
+type TestObj struct {
+	Name string
+}
+
+func testDB() *loge.LogeDB {
+	var db = loge.NewLogeDB(loge.NewMemStore())
+	var def = loge.NewTypeDef("test", 1, &TestObj{})
+	def.Links = loge.LinkSpec{ "other": "test" }
+	db.CreateType(def)
+	return db
+}
+
+func waitFor(test *testing.T, what string, check func() bool) {
+	var deadline = time.Now().Add(5 * time.Second)
+	for !check() {
+		if time.Now().After(deadline) {
+			test.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestReplicate(test *testing.T) {
+	var primary = testDB()
+	var replica = NewReplica("eu", testDB())
+
+	var sub = primary.Subscribe(100)
+	var done = make(chan error)
+	go func() {
+		done <- replica.FollowSubscription(sub)
+	}()
+
+	primary.Transact(func (t *loge.Transaction) {
+		t.Set("test", "one", &TestObj{ "One" })
+		t.AddLink("test", "other", "one", "two")
+	}, 0)
+	primary.SetOne("test", "two", &TestObj{ "Two" })
+	primary.DeleteOne("test", "two")
+
+	var last = primary.Stats().LastSnapshotID
+	waitFor(test, "replication", func() bool { return replica.Lag().Applied == last })
+
+	if replica.DB.ReadOne("test", "one").(*TestObj).Name != "One" {
+		test.Error("Object not replicated")
+	}
+	if links := replica.DB.ReadLinksOne("test", "other", "one"); len(links) != 1 || links[0] != "two" {
+		test.Errorf("Links not replicated: %v", links)
+	}
+	if replica.DB.ExistsOne("test", "two") {
+		test.Error("Delete not replicated")
+	}
+
+	var lag = replica.Lag()
+	if lag.Behind != 0 || lag.Delay < 0 {
+		test.Errorf("Wrong lag: %#v", lag)
+	}
+
+	var topo = NewTopology("us", primary)
+	topo.AddReplica(replica)
+	if topo.Reader("eu") != replica.DB || topo.Reader("ap") != primary {
+		test.Error("Wrong readers")
+	}
+	if _, ok := topo.Lags()["eu"]; !ok {
+		test.Error("No lag for replica")
+	}
+
+	sub.Close()
+	if err := <-done; err != nil {
+		test.Errorf("Follow failed: %v", err)
+	}
+}
+
+func TestFailover(test *testing.T) {
+	var primary = testDB()
+	var replica = NewReplica("eu", testDB())
+	var topo = NewTopology("us", primary)
+	topo.AddReplica(replica)
+
+	var sub = primary.Subscribe(100)
+	primary.SetOne("test", "one", &TestObj{ "One" })
+	replica.Apply(drain(sub))
+
+	topo.Failover("eu")
+	if region, db := topo.Primary(); region != "eu" || db != replica.DB {
+		test.Errorf("Wrong primary after failover: %s", region)
+	}
+
+	// Committed on the old primary, but never replicated before failover
+	primary.SetOne("test", "one", &TestObj{ "Lost" })
+	primary.SetOne("test", "two", &TestObj{ "Lost" })
+	replica.DB.SetOne("test", "one", &TestObj{ "Local" })
+	replica.Apply(drain(sub))
+
+	var conflicts = replica.Conflicts()
+	if len(conflicts) != 2 {
+		test.Fatalf("Wrong conflicts: %#v", conflicts)
+	}
+	if conflicts[0].Change.Key != "one" || !conflicts[0].LocalWrite {
+		test.Errorf("Local write not detected: %#v", conflicts[0])
+	}
+	if conflicts[1].Change.Key != "two" || conflicts[1].LocalWrite {
+		test.Errorf("Wrong conflict: %#v", conflicts[1])
+	}
+	if replica.DB.ReadOne("test", "one").(*TestObj).Name != "Local" {
+		test.Error("Old primary's change applied after promotion")
+	}
+}
+
+func drain(sub *loge.Subscription) []loge.Change {
+	var changes []loge.Change
+	for len(sub.C) > 0 {
+		changes = append(changes, <-sub.C)
+	}
+	return changes
+}
+
+func TestFollowURL(test *testing.T) {
+	var primary = testDB()
+	var server = httptest.NewServer(logehttp.NewServer(primary))
+	defer server.Close()
+
+	var replica = NewReplica("eu", testDB())
+	ctx, cancel := context.WithCancel(context.Background())
+	var done = make(chan error)
+	go func() {
+		done <- replica.FollowURL(ctx, strings.Replace(server.URL, "http:", "ws:", 1) + "/feed", nil)
+	}()
+
+	waitFor(test, "subscription", func() bool { return primary.Stats().Subscribers == 1 })
+
+	primary.SetOne("test", "one", &TestObj{ "One" })
+	primary.Transact(func (t *loge.Transaction) {
+		t.AddLink("test", "other", "one", "two")
+	}, 0)
+
+	var last = primary.Stats().LastSnapshotID
+	waitFor(test, "replication", func() bool { return replica.Lag().Applied == last })
+
+	if replica.DB.ReadOne("test", "one").(*TestObj).Name != "One" {
+		test.Error("Object not replicated")
+	}
+	if links := replica.DB.ReadLinksOne("test", "other", "one"); len(links) != 1 {
+		test.Errorf("Links not replicated: %v", links)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		test.Errorf("Wrong error after cancel: %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package logerepl
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"loge"
+)
+
+// Which region is primary, and the read replicas in the others
+type Topology struct {
+	lock sync.Mutex
+	primaryRegion string
+	primary *loge.LogeDB
+	replicas map[string]*Replica
+}
+
+func NewTopology(region string, primary *loge.LogeDB) *Topology {
+	return &Topology{
+		primaryRegion: region,
+		primary: primary,
+		replicas: make(map[string]*Replica),
+	}
+}
+
+func (topo *Topology) AddReplica(replica *Replica) {
+	topo.lock.Lock()
+	defer topo.lock.Unlock()
+	topo.replicas[replica.Region] = replica
+}
+
+func (topo *Topology) Primary() (string, *loge.LogeDB) {
+	topo.lock.Lock()
+	defer topo.lock.Unlock()
+	return topo.primaryRegion, topo.primary
+}
+
+// The database to read from in a region: its replica if it has one,
+// otherwise the primary
+func (topo *Topology) Reader(region string) *loge.LogeDB {
+	topo.lock.Lock()
+	defer topo.lock.Unlock()
+	if replica, ok := topo.replicas[region]; ok {
+		return replica.DB
+	}
+	return topo.primary
+}
+
+func (topo *Topology) Regions() []string {
+	topo.lock.Lock()
+	defer topo.lock.Unlock()
+
+	var regions = []string{ topo.primaryRegion }
+	for region := range topo.replicas {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+	return regions
+}
+
+func (topo *Topology) Lags() map[string]Lag {
+	topo.lock.Lock()
+	defer topo.lock.Unlock()
+
+	var lags = make(map[string]Lag, len(topo.replicas))
+	for region, replica := range topo.replicas {
+		lags[region] = replica.Lag()
+	}
+	return lags
+}
+
+// Promotes a region's replica to primary. Reads in the old primary's
+// region go to the new primary until a replica is added there.
+func (topo *Topology) Failover(region string) *Replica {
+	topo.lock.Lock()
+	defer topo.lock.Unlock()
+
+	replica, ok := topo.replicas[region]
+	if !ok {
+		panic(fmt.Sprintf("No replica in region %s", region))
+	}
+
+	replica.Promote()
+	delete(topo.replicas, region)
+	topo.primaryRegion = region
+	topo.primary = replica.DB
+	return replica
+}
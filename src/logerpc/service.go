@@ -0,0 +1,225 @@
+package logerpc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/rpc"
+	"time"
+
+	"loge"
+)
+
+// A net/rpc service over a LogeDB, for services which already run an RPC
+// server:
+//
+//   logerpc.Register(rpcServer, db)
+//
+// and then, from a client (gob or jsonrpc codec):
+//
+//   client.Call("Loge.Get", &logerpc.ObjectArgs{ Type: "person", Key: "brendon" }, &reply)
+//
+// Objects travel as JSON so clients need not register Go types with gob.
+// Each call runs in its own transaction.
+type Service struct {
+	db *loge.LogeDB
+	Timeout time.Duration
+}
+
+const ServiceName = "Loge"
+
+type ObjectArgs struct {
+	Type string
+	Key string
+	Object json.RawMessage
+}
+
+type ObjectReply struct {
+	Found bool
+	Object json.RawMessage
+}
+
+type LinkArgs struct {
+	Type string
+	Link string
+	Key string
+	Targets []loge.LogeKey
+}
+
+type SliceArgs struct {
+	Type string
+	Link string
+	Target string
+	From string
+	Limit int
+}
+
+type KeysReply struct {
+	Keys []loge.LogeKey
+}
+
+type Empty struct{}
+
+func NewService(db *loge.LogeDB) *Service {
+	return &Service{
+		db: db,
+		Timeout: 5 * time.Second,
+	}
+}
+
+func Register(server *rpc.Server, db *loge.LogeDB) error {
+	return server.RegisterName(ServiceName, NewService(db))
+}
+
+// -----------------------------------------------
+// Methods
+// -----------------------------------------------
+
+func (s *Service) Get(args *ObjectArgs, reply *ObjectReply) (err error) {
+	defer recoverError(&err)
+	var typeName = s.checkType(args.Type)
+
+	s.transact(func (t *loge.Transaction) {
+		reply.Found = t.Exists(typeName, loge.LogeKey(args.Key))
+		reply.Object = nil
+		if reply.Found {
+			reply.Object = encode(t.Read(typeName, loge.LogeKey(args.Key)))
+		}
+	})
+	return nil
+}
+
+func (s *Service) Set(args *ObjectArgs, reply *Empty) (err error) {
+	defer recoverError(&err)
+	var typeName = s.checkType(args.Type)
+
+	var obj = s.db.Type(typeName).NewValue()
+	if err := json.Unmarshal(args.Object, obj); err != nil {
+		return fmt.Errorf("Bad JSON for %s: %v", typeName, err)
+	}
+
+	s.transact(func (t *loge.Transaction) {
+		t.Set(typeName, loge.LogeKey(args.Key), obj)
+	})
+	return nil
+}
+
+func (s *Service) Delete(args *ObjectArgs, reply *Empty) (err error) {
+	defer recoverError(&err)
+	var typeName = s.checkType(args.Type)
+
+	s.transact(func (t *loge.Transaction) {
+		t.Delete(typeName, loge.LogeKey(args.Key))
+	})
+	return nil
+}
+
+func (s *Service) ReadLinks(args *LinkArgs, reply *KeysReply) (err error) {
+	defer recoverError(&err)
+	var typeName, linkName = s.checkLink(args.Type, args.Link)
+
+	s.transact(func (t *loge.Transaction) {
+		reply.Keys = t.ReadLinks(typeName, linkName, loge.LogeKey(args.Key))
+	})
+	return nil
+}
+
+// Replaces all of a key's links with Targets
+func (s *Service) SetLinks(args *LinkArgs, reply *Empty) (err error) {
+	defer recoverError(&err)
+	var typeName, linkName = s.checkLink(args.Type, args.Link)
+
+	s.transact(func (t *loge.Transaction) {
+		t.SetLinks(typeName, linkName, loge.LogeKey(args.Key), args.Targets)
+	})
+	return nil
+}
+
+func (s *Service) AddLinks(args *LinkArgs, reply *Empty) (err error) {
+	defer recoverError(&err)
+	var typeName, linkName = s.checkLink(args.Type, args.Link)
+
+	s.transact(func (t *loge.Transaction) {
+		for _, target := range args.Targets {
+			t.AddLink(typeName, linkName, loge.LogeKey(args.Key), target)
+		}
+	})
+	return nil
+}
+
+func (s *Service) RemoveLinks(args *LinkArgs, reply *Empty) (err error) {
+	defer recoverError(&err)
+	var typeName, linkName = s.checkLink(args.Type, args.Link)
+
+	s.transact(func (t *loge.Transaction) {
+		for _, target := range args.Targets {
+			t.RemoveLink(typeName, linkName, loge.LogeKey(args.Key), target)
+		}
+	})
+	return nil
+}
+
+// Limit 0 means no limit
+func (s *Service) Find(args *SliceArgs, reply *KeysReply) (err error) {
+	defer recoverError(&err)
+	var typeName, linkName = s.checkLink(args.Type, args.Link)
+
+	reply.Keys = s.db.FindSlice(typeName, linkName, loge.LogeKey(args.Target),
+		loge.LogeKey(args.From), limit(args.Limit))
+	return nil
+}
+
+// Limit 0 means no limit
+func (s *Service) List(args *SliceArgs, reply *KeysReply) (err error) {
+	defer recoverError(&err)
+	var typeName = s.checkType(args.Type)
+
+	reply.Keys = s.db.ListSlice(typeName, loge.LogeKey(args.From), limit(args.Limit))
+	return nil
+}
+
+// -----------------------------------------------
+// Helpers
+// -----------------------------------------------
+
+func (s *Service) transact(actor loge.Transactor) {
+	if !s.db.Transact(actor, s.Timeout) {
+		panic("Transaction failed")
+	}
+}
+
+func (s *Service) checkType(typeName string) string {
+	if s.db.Type(typeName) == nil {
+		panic(fmt.Sprintf("No such type: %s", typeName))
+	}
+	return typeName
+}
+
+func (s *Service) checkLink(typeName string, linkName string) (string, string) {
+	s.checkType(typeName)
+	if _, ok := s.db.Type(typeName).Links[linkName]; !ok {
+		panic(fmt.Sprintf("No such link: %s.%s", typeName, linkName))
+	}
+	return typeName, linkName
+}
+
+func encode(obj interface{}) json.RawMessage {
+	enc, err := json.Marshal(obj)
+	if err != nil {
+		panic(err)
+	}
+	return enc
+}
+
+func limit(limit int) int {
+	if limit <= 0 {
+		return -1
+	}
+	return limit
+}
+
+func recoverError(err *error) {
+	if r := recover(); r != nil {
+		*err = errors.New(fmt.Sprint(r))
+	}
+}
@@ -0,0 +1,89 @@
+package logerpc
+
+import (
+	"testing"
+	"encoding/json"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+
+	"loge"
+)
+
+type TestObj struct {
+	Name string
+}
+
+func testClient(test *testing.T, useJSON bool) *rpc.Client {
+	var db = loge.NewLogeDB(loge.NewMemStore())
+	var def = loge.NewTypeDef("test", 1, &TestObj{})
+	def.Links = loge.LinkSpec{ "other": "test" }
+	db.CreateType(def)
+
+	var server = rpc.NewServer()
+	if err := Register(server, db); err != nil {
+		test.Fatal(err)
+	}
+
+	serverConn, clientConn := net.Pipe()
+	if useJSON {
+		go server.ServeCodec(jsonrpc.NewServerCodec(serverConn))
+		return jsonrpc.NewClient(clientConn)
+	}
+	go server.ServeConn(serverConn)
+	return rpc.NewClient(clientConn)
+}
+
+func TestObjects(test *testing.T) {
+	for _, useJSON := range []bool{ false, true } {
+		var client = testClient(test, useJSON)
+
+		var obj = json.RawMessage(`{"Name":"One"}`)
+		if err := client.Call("Loge.Set", &ObjectArgs{ Type: "test", Key: "one", Object: obj }, &Empty{}); err != nil {
+			test.Fatalf("Set failed: %v", err)
+		}
+
+		var reply ObjectReply
+		if err := client.Call("Loge.Get", &ObjectArgs{ Type: "test", Key: "one" }, &reply); err != nil {
+			test.Fatalf("Get failed: %v", err)
+		}
+		if !reply.Found || string(reply.Object) != `{"Name":"One"}` {
+			test.Errorf("Wrong object: %v %s", reply.Found, reply.Object)
+		}
+
+		client.Call("Loge.Delete", &ObjectArgs{ Type: "test", Key: "one" }, &Empty{})
+		reply = ObjectReply{}
+		client.Call("Loge.Get", &ObjectArgs{ Type: "test", Key: "one" }, &reply)
+		if reply.Found {
+			test.Error("Object still there after delete")
+		}
+
+		var err = client.Call("Loge.Get", &ObjectArgs{ Type: "nope", Key: "one" }, &reply)
+		if err == nil || err.Error() != "No such type: nope" {
+			test.Errorf("Wrong error for missing type: %v", err)
+		}
+
+		client.Close()
+	}
+}
+
+func TestLinks(test *testing.T) {
+	var client = testClient(test, false)
+	defer client.Close()
+
+	var args = &LinkArgs{ Type: "test", Link: "other", Key: "one", Targets: []loge.LogeKey{ "two", "three" } }
+	if err := client.Call("Loge.AddLinks", args, &Empty{}); err != nil {
+		test.Fatalf("AddLinks failed: %v", err)
+	}
+
+	args.Targets = []loge.LogeKey{ "two" }
+	client.Call("Loge.RemoveLinks", args, &Empty{})
+
+	var reply KeysReply
+	if err := client.Call("Loge.ReadLinks", args, &reply); err != nil {
+		test.Fatalf("ReadLinks failed: %v", err)
+	}
+	if len(reply.Keys) != 1 || reply.Keys[0] != "three" {
+		test.Errorf("Wrong links: %v", reply.Keys)
+	}
+}
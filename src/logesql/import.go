@@ -0,0 +1,475 @@
+// Imports rows from a relational database into loge, one table per type,
+// driven by a declarative mapping:
+//
+//   {"tables": [
+//     {"table": "people", "type": "person", "key": ["id"]},
+//     {"table": "pets", "type": "pet", "key": ["owner_id", "name"],
+//      "fields": {"name": "Name", "species": "Kind"},
+//      "links": [{"link": "owner", "columns": ["owner_id"]}]}
+//   ]}
+//
+// Without "fields", every column whose name matches a field of the
+// type's struct (ignoring case and underscores, so user_name fills
+// UserName) is copied. Keys of more than one column, and links to them,
+// are composite keys built with loge.Key. Foreign key columns which are
+// NULL make no link.
+//
+// Any database/sql driver works; the application imports its own:
+//
+//   var src, _ = sql.Open("postgres", dsn)
+//   var mapping, _ = logesql.LoadMapping("mapping.json")
+//   reports, err := logesql.Import(ctx, src, db, mapping)
+package logesql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"loge"
+)
+
+type Mapping struct {
+	Tables []Table `json:"tables"`
+
+	// Rows per loge transaction; DefaultBatchSize if zero
+	BatchSize int `json:"batch_size,omitempty"`
+}
+
+type Table struct {
+	Table string `json:"table"`
+	Type string `json:"type"`
+	Key []string `json:"key"`
+	Fields map[string]string `json:"fields,omitempty"` // Column to field
+	Links []Link `json:"links,omitempty"`
+
+	// Appended to the query as-is, e.g. "deleted_at IS NULL"
+	Where string `json:"where,omitempty"`
+}
+
+// A foreign key: the columns hold the target's key
+type Link struct {
+	Link string `json:"link"`
+	Columns []string `json:"columns"`
+}
+
+type Report struct {
+	Table string
+	Type string
+	Rows int
+	Links int
+}
+
+var DefaultBatchSize = 500
+
+func ParseMapping(r io.Reader) (*Mapping, error) {
+	var mapping Mapping
+	var dec = json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&mapping); err != nil {
+		return nil, fmt.Errorf("Invalid mapping: %v", err)
+	}
+	return &mapping, nil
+}
+
+func LoadMapping(path string) (*Mapping, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ParseMapping(file)
+}
+
+// Imports each table in order, returning what was imported before any
+// error. Objects are written with Set, so importing again overwrites
+// them; links are added to any already there.
+func Import(ctx context.Context, src *sql.DB, db *loge.LogeDB, mapping *Mapping) ([]Report, error) {
+	var batchSize = mapping.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	var reports []Report
+	for i := range mapping.Tables {
+		var table = &mapping.Tables[i]
+		if err := table.check(db); err != nil {
+			return reports, err
+		}
+		var report = Report{ Table: table.Table, Type: table.Type }
+		var err = importTable(ctx, src, db, table, batchSize, &report)
+		reports = append(reports, report)
+		if err != nil {
+			return reports, err
+		}
+	}
+	return reports, nil
+}
+
+// -----------------------------------------------
+// Rows
+// -----------------------------------------------
+
+type row struct {
+	key loge.LogeKey
+	obj interface{}
+	links map[string]loge.LogeKey
+}
+
+// Which struct field each result column fills, nil for none
+type plan struct {
+	columns []string
+	fields [][]int
+}
+
+func (table *Table) check(db *loge.LogeDB) error {
+	var typ = db.Type(table.Type)
+	if typ == nil {
+		return fmt.Errorf("%s: %v: %s", table.Table, loge.ErrNoSuchType, table.Type)
+	}
+	if len(table.Key) == 0 {
+		return fmt.Errorf("%s: No key columns", table.Table)
+	}
+	if reflect.TypeOf(typ.Exemplar).Kind() != reflect.Ptr ||
+		reflect.TypeOf(typ.Exemplar).Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("%s: Type %s isn't a struct pointer", table.Table, table.Type)
+	}
+	for _, link := range table.Links {
+		if _, ok := typ.Links[link.Link]; !ok {
+			return fmt.Errorf("%s: %v: %s.%s", table.Table, loge.ErrNoSuchLink, table.Type, link.Link)
+		}
+		if len(link.Columns) == 0 {
+			return fmt.Errorf("%s: No columns for link %s", table.Table, link.Link)
+		}
+	}
+	return nil
+}
+
+func (table *Table) query() string {
+	var query = "SELECT * FROM " + table.Table
+	if table.Where != "" {
+		query += " WHERE " + table.Where
+	}
+	return query
+}
+
+func (table *Table) plan(structType reflect.Type, columns []string) (*plan, error) {
+	var p = &plan{ columns: columns, fields: make([][]int, len(columns)) }
+
+	for i, column := range columns {
+		if table.Fields == nil {
+			if field, ok := matchField(structType, column); ok {
+				p.fields[i] = field.Index
+			}
+			continue
+		}
+		name, ok := table.Fields[column]
+		if !ok {
+			continue
+		}
+		field, ok := structType.FieldByName(name)
+		if !ok || field.PkgPath != "" {
+			return nil, fmt.Errorf("%s: No exported field %s for column %s", table.Table, name, column)
+		}
+		p.fields[i] = field.Index
+	}
+
+	for column := range table.Fields {
+		if p.index(column) < 0 {
+			return nil, fmt.Errorf("%s: No column %s", table.Table, column)
+		}
+	}
+	for _, column := range table.Key {
+		if p.index(column) < 0 {
+			return nil, fmt.Errorf("%s: No key column %s", table.Table, column)
+		}
+	}
+	for _, link := range table.Links {
+		for _, column := range link.Columns {
+			if p.index(column) < 0 {
+				return nil, fmt.Errorf("%s: No column %s for link %s", table.Table, column, link.Link)
+			}
+		}
+	}
+	return p, nil
+}
+
+func (p *plan) index(column string) int {
+	for i, c := range p.columns {
+		if c == column {
+			return i
+		}
+	}
+	return -1
+}
+
+func matchField(structType reflect.Type, column string) (reflect.StructField, bool) {
+	var want = strings.ToLower(strings.Replace(column, "_", "", -1))
+	for i := 0; i < structType.NumField(); i++ {
+		var field = structType.Field(i)
+		if field.PkgPath == "" && strings.ToLower(field.Name) == want {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func importTable(ctx context.Context, src *sql.DB, db *loge.LogeDB, table *Table, batchSize int, report *Report) error {
+	var typ = db.Type(table.Type)
+
+	rows, err := src.QueryContext(ctx, table.query())
+	if err != nil {
+		return fmt.Errorf("%s: %v", table.Table, err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return fmt.Errorf("%s: %v", table.Table, err)
+	}
+	p, err := table.plan(reflect.TypeOf(typ.Exemplar).Elem(), columns)
+	if err != nil {
+		return err
+	}
+
+	var values = make([]interface{}, len(columns))
+	var dest = make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+
+	var batch []row
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return fmt.Errorf("%s row %d: %v", table.Table, report.Rows + len(batch) + 1, err)
+		}
+		r, err := table.convert(typ.NewValue(), p, values)
+		if err != nil {
+			return fmt.Errorf("%s row %d: %v", table.Table, report.Rows + len(batch) + 1, err)
+		}
+		batch = append(batch, r)
+
+		if len(batch) == batchSize {
+			if err := writeBatch(ctx, db, table.Type, batch, report); err != nil {
+				return fmt.Errorf("%s: %v", table.Table, err)
+			}
+			batch = batch[:0]
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("%s: %v", table.Table, err)
+	}
+	if err := writeBatch(ctx, db, table.Type, batch, report); err != nil {
+		return fmt.Errorf("%s: %v", table.Table, err)
+	}
+	return nil
+}
+
+func (table *Table) convert(obj interface{}, p *plan, values []interface{}) (r row, err error) {
+	var value = reflect.ValueOf(obj).Elem()
+	for i, index := range p.fields {
+		if index == nil {
+			continue
+		}
+		if err := assign(value.FieldByIndex(index), values[i]); err != nil {
+			return r, fmt.Errorf("Column %s: %v", p.columns[i], err)
+		}
+	}
+
+	key, ok, err := columnsKey(p, table.Key, values)
+	if err != nil {
+		return r, err
+	}
+	if !ok {
+		return r, fmt.Errorf("NULL key")
+	}
+
+	r = row{ key: key, obj: obj, links: make(map[string]loge.LogeKey) }
+	for _, link := range table.Links {
+		target, ok, err := columnsKey(p, link.Columns, values)
+		if err != nil {
+			return r, err
+		}
+		if ok {
+			r.links[link.Link] = target
+		}
+	}
+	return r, nil
+}
+
+// False if any of the columns is NULL
+func columnsKey(p *plan, columns []string, values []interface{}) (loge.LogeKey, bool, error) {
+	var parts = make([]string, len(columns))
+	for i, column := range columns {
+		var v = values[p.index(column)]
+		if v == nil {
+			return "", false, nil
+		}
+		s, err := asString(v)
+		if err != nil {
+			return "", false, fmt.Errorf("Column %s: %v", column, err)
+		}
+		parts[i] = s
+	}
+	if len(parts) == 1 {
+		return loge.LogeKey(parts[0]), true, nil
+	}
+	return loge.Key(parts...), true, nil
+}
+
+func writeBatch(ctx context.Context, db *loge.LogeDB, typeName string, batch []row, report *Report) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	var links = 0
+	_, err := loge.TransactResultContext(ctx, db, func (t *loge.Transaction) (bool, error) {
+		links = 0
+		for _, r := range batch {
+			t.Set(typeName, r.key, r.obj)
+			for linkName, target := range r.links {
+				t.AddLink(typeName, linkName, r.key, target)
+				links++
+			}
+		}
+		return true, nil
+	}, loge.TransactOptions{})
+	if err != nil {
+		return err
+	}
+
+	report.Rows += len(batch)
+	report.Links += links
+	return nil
+}
+
+// -----------------------------------------------
+// Values
+// -----------------------------------------------
+
+// Drivers hand back int64, float64, bool, []byte, string or time.Time.
+// NULL leaves the field at its zero value.
+func assign(field reflect.Value, v interface{}) error {
+	if v == nil {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+	if b, ok := v.([]byte); ok {
+		v = string(b)
+	}
+
+	var src = reflect.ValueOf(v)
+	if src.Type().AssignableTo(field.Type()) {
+		field.Set(src)
+		return nil
+	}
+
+	if field.Kind() == reflect.Ptr {
+		var elem = reflect.New(field.Type().Elem())
+		if err := assign(elem.Elem(), v); err != nil {
+			return err
+		}
+		field.Set(elem)
+		return nil
+	}
+
+	if s, ok := v.(string); ok {
+		return assignString(field, s)
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		s, err := asString(v)
+		if err != nil {
+			return err
+		}
+		field.SetString(s)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		switch src.Kind() {
+		case reflect.Int64, reflect.Float64:
+			field.Set(src.Convert(field.Type()))
+			return nil
+		}
+	case reflect.Bool:
+		if n, ok := v.(int64); ok {
+			field.SetBool(n != 0)
+			return nil
+		}
+	}
+	return fmt.Errorf("Can't store %T in %s", v, field.Type())
+}
+
+func assignString(field reflect.Value, s string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(s)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.Uint8 {
+			return fmt.Errorf("Can't store text in %s", field.Type())
+		}
+		field.SetBytes([]byte(s))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	default:
+		if field.Type() == reflect.TypeOf(time.Time{}) {
+			t, err := time.Parse(time.RFC3339Nano, s)
+			if err != nil {
+				return err
+			}
+			field.Set(reflect.ValueOf(t))
+			return nil
+		}
+		return fmt.Errorf("Can't store text in %s", field.Type())
+	}
+	return nil
+}
+
+func asString(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	}
+	return "", fmt.Errorf("Can't use %T as text", v)
+}
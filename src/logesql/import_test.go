@@ -0,0 +1,165 @@
+package logesql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"loge"
+)
+
+// Just enough of a driver to serve fixed tables to SELECT * FROM
+type fakeDriver struct{}
+type fakeConn struct{}
+type fakeStmt struct{ table string }
+
+type fakeTable struct {
+	columns []string
+	rows [][]driver.Value
+}
+
+type fakeRows struct {
+	table *fakeTable
+	next int
+}
+
+var fakeTables = map[string]*fakeTable{
+	"people": {
+		[]string{ "id", "user_name", "age", "nickname" },
+		[][]driver.Value{
+			{ int64(1), []byte("brendon"), int64(38), nil },
+			{ int64(2), []byte("leo"), "29", []byte("lb") },
+		},
+	},
+	"pets": {
+		[]string{ "owner_id", "name", "species", "legs" },
+		[][]driver.Value{
+			{ int64(1), "rex", "dog", int64(4) },
+			{ int64(2), "tweety", "bird", int64(2) },
+			{ nil, "stray", "cat", int64(4) },
+		},
+	},
+}
+
+func init() {
+	sql.Register("logesql-fake", fakeDriver{})
+}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) { return fakeConn{}, nil }
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) {
+	var fields = strings.Fields(query)
+	if len(fields) < 4 || fakeTables[fields[3]] == nil {
+		return nil, errors.New("no such table")
+	}
+	return fakeStmt{ fields[3] }, nil
+}
+func (fakeConn) Close() error { return nil }
+func (fakeConn) Begin() (driver.Tx, error) { return nil, errors.New("read only") }
+
+func (fakeStmt) Close() error { return nil }
+func (fakeStmt) NumInput() int { return 0 }
+func (fakeStmt) Exec(args []driver.Value) (driver.Result, error) { return nil, errors.New("read only") }
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return &fakeRows{ table: fakeTables[s.table] }, nil
+}
+
+func (r *fakeRows) Columns() []string { return r.table.columns }
+func (r *fakeRows) Close() error { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next == len(r.table.rows) {
+		return io.EOF
+	}
+	copy(dest, r.table.rows[r.next])
+	r.next++
+	return nil
+}
+
+// -----------------------------------------------
+
+type Person struct {
+	UserName string
+	Age int
+	Nickname *string
+}
+
+type Pet struct {
+	Name string
+	Kind string
+}
+
+func TestImport(test *testing.T) {
+	var db = loge.NewLogeDB(loge.NewMemStore())
+	defer db.Close()
+	db.CreateType(loge.NewTypeDef("person", 1, &Person{}))
+	var def = loge.NewTypeDef("pet", 1, &Pet{})
+	def.Links = loge.LinkSpec{ "owner": "person" }
+	db.CreateType(def)
+
+	mapping, err := ParseMapping(strings.NewReader(`{"batch_size": 2, "tables": [
+		{"table": "people", "type": "person", "key": ["id"]},
+		{"table": "pets", "type": "pet", "key": ["species", "name"],
+		 "fields": {"name": "Name", "species": "Kind"},
+		 "links": [{"link": "owner", "columns": ["owner_id"]}]}
+	]}`))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	src, _ := sql.Open("logesql-fake", "")
+	reports, err := Import(context.Background(), src, db, mapping)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(reports) != 2 || reports[0].Rows != 2 || reports[1].Rows != 3 || reports[1].Links != 2 {
+		test.Errorf("Wrong reports: %+v", reports)
+	}
+
+	var leo = db.ReadOne("person", "2").(*Person)
+	if leo.UserName != "leo" || leo.Age != 29 || leo.Nickname == nil || *leo.Nickname != "lb" {
+		test.Errorf("Wrong person: %+v", leo)
+	}
+	if db.ReadOne("person", "1").(*Person).Nickname != nil {
+		test.Error("NULL column wasn't left nil")
+	}
+
+	var rex = db.ReadOne("pet", loge.Key("dog", "rex")).(*Pet)
+	if rex.Name != "rex" || rex.Kind != "dog" {
+		test.Errorf("Wrong pet: %+v", rex)
+	}
+	var owner = db.ReadLinksOne("pet", "owner", loge.Key("bird", "tweety"))
+	if len(owner) != 1 || owner[0] != "2" {
+		test.Errorf("Wrong links: %v", owner)
+	}
+	if len(db.ReadLinksOne("pet", "owner", loge.Key("cat", "stray"))) != 0 {
+		test.Error("NULL foreign key made a link")
+	}
+}
+
+func TestImportMappingErrors(test *testing.T) {
+	var db = loge.NewLogeDB(loge.NewMemStore())
+	defer db.Close()
+	db.CreateType(loge.NewTypeDef("person", 1, &Person{}))
+	src, _ := sql.Open("logesql-fake", "")
+
+	for _, table := range []Table{
+		{ Table: "people", Type: "nobody", Key: []string{ "id" } },
+		{ Table: "people", Type: "person" },
+		{ Table: "people", Type: "person", Key: []string{ "uuid" } },
+		{ Table: "people", Type: "person", Key: []string{ "id" }, Fields: map[string]string{ "age": "Years" } },
+		{ Table: "people", Type: "person", Key: []string{ "id" }, Links: []Link{ { "friend", []string{ "id" } } } },
+	} {
+		var mapping = &Mapping{ Tables: []Table{ table } }
+		if _, err := Import(context.Background(), src, db, mapping); err == nil {
+			test.Errorf("No error for %+v", table)
+		}
+	}
+
+	if _, err := ParseMapping(strings.NewReader(`{"tabels": []}`)); err == nil {
+		test.Error("Unknown mapping field accepted")
+	}
+}
@@ -0,0 +1,122 @@
+package logetest
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// A loge.Clock which only moves when told to, so timeouts and delays
+// happen at exactly the points a test chooses:
+//
+//   var clock = logetest.NewVirtualClock(time.Time{})
+//   db.SetClock(clock)
+//   store.Clock = clock
+//
+//   go db.ReadOne("person", "brendon")   // Stalled by a scripted Fault
+//   clock.BlockUntil(1)
+//   clock.Advance(time.Second)
+//
+// Sleepers wake in deadline order, ties in the order they went to sleep.
+// Go doesn't let us schedule goroutines, so sleepers woken by the same
+// Advance then run concurrently; Step wakes one deadline at a time for
+// tests which need them strictly ordered.
+type VirtualClock struct {
+	lock sync.Mutex
+	cond *sync.Cond
+	now time.Time
+	sleepers []*sleeper
+	seq uint64
+}
+
+type sleeper struct {
+	deadline time.Time
+	seq uint64
+	wake chan bool
+}
+
+func NewVirtualClock(start time.Time) *VirtualClock {
+	var clock = &VirtualClock{ now: start }
+	clock.cond = sync.NewCond(&clock.lock)
+	return clock
+}
+
+func (clock *VirtualClock) Now() time.Time {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+	return clock.now
+}
+
+func (clock *VirtualClock) Sleep(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+
+	clock.lock.Lock()
+	clock.seq++
+	var s = &sleeper{
+		deadline: clock.now.Add(d),
+		seq: clock.seq,
+		wake: make(chan bool),
+	}
+	clock.sleepers = append(clock.sleepers, s)
+	sort.Slice(clock.sleepers, func(i, j int) bool {
+		var a, b = clock.sleepers[i], clock.sleepers[j]
+		if a.deadline.Equal(b.deadline) {
+			return a.seq < b.seq
+		}
+		return a.deadline.Before(b.deadline)
+	})
+	clock.cond.Broadcast()
+	clock.lock.Unlock()
+
+	<-s.wake
+}
+
+// Moves the clock forward, waking everything due by the new time
+func (clock *VirtualClock) Advance(d time.Duration) {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+	clock.now = clock.now.Add(d)
+	clock.wake()
+}
+
+// Jumps to the next deadline and wakes only the sleepers due then.
+// False if nothing is asleep.
+func (clock *VirtualClock) Step() bool {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+	if len(clock.sleepers) == 0 {
+		return false
+	}
+	if clock.sleepers[0].deadline.After(clock.now) {
+		clock.now = clock.sleepers[0].deadline
+	}
+	clock.wake()
+	return true
+}
+
+// Waits for count goroutines to be asleep on the clock, so a test can
+// be sure they've reached their Sleep before advancing past it
+func (clock *VirtualClock) BlockUntil(count int) {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+	for len(clock.sleepers) < count {
+		clock.cond.Wait()
+	}
+}
+
+func (clock *VirtualClock) Sleepers() int {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+	return len(clock.sleepers)
+}
+
+func (clock *VirtualClock) wake() {
+	var due = 0
+	for due < len(clock.sleepers) && !clock.sleepers[due].deadline.After(clock.now) {
+		close(clock.sleepers[due].wake)
+		due++
+	}
+	clock.sleepers = clock.sleepers[due:]
+}
@@ -0,0 +1,90 @@
+package logetest
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"loge"
+)
+
+func TestVirtualClock(test *testing.T) {
+	var start = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	var clock = NewVirtualClock(start)
+
+	var lock sync.Mutex
+	var woken []int
+	var sleep = func(id int, d time.Duration) {
+		clock.Sleep(d)
+		lock.Lock()
+		woken = append(woken, id)
+		lock.Unlock()
+	}
+
+	var wg sync.WaitGroup
+	for id, d := range []time.Duration{ 3 * time.Second, time.Second, 2 * time.Second } {
+		wg.Add(1)
+		go func(id int, d time.Duration) {
+			defer wg.Done()
+			sleep(id, d)
+		}(id, d)
+	}
+	clock.BlockUntil(3)
+
+	for _, want := range []int{ 1, 2, 0 } {
+		var before = clock.Sleepers()
+		clock.Step()
+		for {
+			lock.Lock()
+			var n = len(woken)
+			lock.Unlock()
+			if n == 4 - before {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		if woken[len(woken) - 1] != want {
+			test.Fatalf("Wrong wake order: %v", woken)
+		}
+	}
+	wg.Wait()
+
+	if !clock.Now().Equal(start.Add(3 * time.Second)) || clock.Step() {
+		test.Errorf("Wrong time after steps: %v", clock.Now())
+	}
+}
+
+func TestVirtualClockDB(test *testing.T) {
+	var clock = NewVirtualClock(time.Time{})
+	var store = loge.NewFaultStore(loge.NewMemStore())
+	store.Clock = clock
+
+	var db = loge.NewLogeDB(store)
+	db.SetClock(clock)
+	db.CreateType(loge.NewTypeDef("record", 1, &Record{}))
+	var sub = db.Subscribe(10)
+	defer sub.Close()
+
+	clock.Advance(time.Hour)
+	db.SetOne("record", "one", &Record{ "One" })
+	var change = <-sub.C
+	if !change.Time.Equal(time.Time{}.Add(time.Hour)) {
+		test.Errorf("Feed used the wrong clock: %v", change.Time)
+	}
+
+	store.Script(loge.FaultGet, loge.Fault{ Delay: time.Hour })
+	var done = make(chan bool)
+	go func() {
+		db.ReadOne("record", "one")
+		close(done)
+	}()
+
+	clock.BlockUntil(1)
+	select {
+	case <-done:
+		test.Fatal("Delayed read didn't wait for the clock")
+	default:
+	}
+	clock.Advance(time.Hour)
+	<-done
+}
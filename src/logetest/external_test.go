@@ -0,0 +1,217 @@
+package logetest
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"loge"
+)
+
+// A backend as a third party would write one, against loge.Store only.
+// Names are "o", "l" or "i" for objects, link sets and the Find index,
+// then the parts of the key, NUL-separated.
+type externalStore struct {
+	lock sync.Mutex
+	types map[string][]byte
+	blobs map[string][]externalVersion
+}
+
+type externalVersion struct {
+	snapshotID uint64
+	blob []byte
+}
+
+type externalContext struct {
+	store *externalStore
+	snapshotID uint64
+	writes map[string][]byte
+}
+
+func newExternalStore() *externalStore {
+	return &externalStore{
+		types: make(map[string][]byte),
+		blobs: make(map[string][]externalVersion),
+	}
+}
+
+func externalName(parts ...string) string {
+	return strings.Join(parts, "\x00")
+}
+
+func storeName(key loge.StoreKey) string {
+	if key.Link != "" {
+		return externalName("l", key.Type, key.Link, string(key.Key))
+	}
+	return externalName("o", key.Type, string(key.Key))
+}
+
+func (store *externalStore) Types() (map[string][]byte, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	var types = make(map[string][]byte)
+	for name, info := range store.types {
+		types[name] = info
+	}
+	return types, nil
+}
+
+func (store *externalStore) PutType(name string, info []byte) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	store.types[name] = info
+	return nil
+}
+
+func (store *externalStore) NewContext(ctx context.Context, snapshotID uint64) loge.StoreContext {
+	return &externalContext{ store, snapshotID, make(map[string][]byte) }
+}
+
+func (store *externalStore) Truncate(typeName string) (int, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	var count = 0
+	for name, versions := range store.blobs {
+		var parts = strings.SplitN(name, "\x00", 3)
+		if parts[1] != typeName {
+			continue
+		}
+		if parts[0] == "o" && len(versions[len(versions)-1].blob) > 0 {
+			count++
+		}
+		delete(store.blobs, name)
+	}
+	return count, nil
+}
+
+func (store *externalStore) Backup(path string) error {
+	return loge.ErrNotSupported
+}
+
+func (store *externalStore) Compact() error {
+	return nil
+}
+
+func (store *externalStore) RetainsVersions() bool {
+	return true
+}
+
+// Snapshot IDs start again on the next open, so history goes
+func (store *externalStore) Close() error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	for name, versions := range store.blobs {
+		if blob := versions[len(versions)-1].blob; len(blob) > 0 {
+			store.blobs[name] = []externalVersion{ { 0, blob } }
+		} else {
+			delete(store.blobs, name)
+		}
+	}
+	return nil
+}
+
+func (context *externalContext) read(name string) []byte {
+	var versions = context.store.blobs[name]
+	for i := len(versions)-1; i >= 0; i-- {
+		if versions[i].snapshotID <= context.snapshotID {
+			return versions[i].blob
+		}
+	}
+	return nil
+}
+
+func (context *externalContext) Get(key loge.StoreKey) ([]byte, error) {
+	context.store.lock.Lock()
+	defer context.store.lock.Unlock()
+	return context.read(storeName(key)), nil
+}
+
+func (context *externalContext) Put(key loge.StoreKey, blob []byte) error {
+	context.writes[storeName(key)] = blob
+	return nil
+}
+
+func (context *externalContext) AddIndex(key loge.StoreKey, source loge.LogeKey) error {
+	context.writes[externalName("i", key.Type, key.Link, string(key.Key), string(source))] = []byte{ 1 }
+	return nil
+}
+
+func (context *externalContext) RemoveIndex(key loge.StoreKey, source loge.LogeKey) error {
+	context.writes[externalName("i", key.Type, key.Link, string(key.Key), string(source))] = nil
+	return nil
+}
+
+func (context *externalContext) Find(key loge.StoreKey, prefix loge.LogeKey, after loge.LogeKey, count int) ([]loge.LogeKey, error) {
+	return context.scan(externalName("i", key.Type, key.Link, string(key.Key), ""), prefix, after, count), nil
+}
+
+func (context *externalContext) List(typeName string, prefix loge.LogeKey, after loge.LogeKey, count int) ([]loge.LogeKey, error) {
+	return context.scan(externalName("o", typeName, ""), prefix, after, count), nil
+}
+
+func (context *externalContext) scan(namePrefix string, prefix loge.LogeKey, after loge.LogeKey, count int) []loge.LogeKey {
+	context.store.lock.Lock()
+	defer context.store.lock.Unlock()
+	var keys = make([]loge.LogeKey, 0)
+	for name := range context.store.blobs {
+		var key = loge.LogeKey(strings.TrimPrefix(name, namePrefix))
+		if len(key) == len(name) || !strings.HasPrefix(string(key), string(prefix)) || key <= after {
+			continue
+		}
+		if len(context.read(name)) > 0 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	if len(keys) > count {
+		keys = keys[:count]
+	}
+	return keys
+}
+
+func (context *externalContext) Commit(snapshotID uint64) error {
+	context.store.lock.Lock()
+	defer context.store.lock.Unlock()
+	for name, blob := range context.writes {
+		context.store.blobs[name] = append(context.store.blobs[name], externalVersion{ snapshotID, blob })
+	}
+	return nil
+}
+
+func (context *externalContext) Rollback() {
+}
+
+func TestExternalStore(test *testing.T) {
+	TestStore(test, func() loge.LogeStore {
+		return loge.NewExternalStore(newExternalStore())
+	})
+}
+
+func TestExternalStoreReopen(test *testing.T) {
+	var backend = newExternalStore()
+	var open = func() *loge.LogeDB {
+		var db = loge.NewLogeDB(loge.NewExternalStore(backend))
+		var def = loge.NewTypeDef("record", 1, &Record{})
+		def.Links = loge.LinkSpec{ "friend": "record" }
+		db.CreateType(def)
+		return db
+	}
+
+	var db = open()
+	db.SetOne("record", "one", &Record{ "One" })
+	db.Transact(func (t *loge.Transaction) {
+		t.AddLink("record", "friend", "one", "two")
+	}, 0)
+	db.Close()
+
+	db = open()
+	defer db.Close()
+	if obj := db.ReadOne("record", "one").(*Record); obj == nil || obj.Name != "One" {
+		test.Errorf("Wrong object on reopen: %v", obj)
+	}
+	if keys := db.Find("record", "friend", "two"); len(keys) != 1 || keys[0] != "one" {
+		test.Errorf("Wrong find on reopen: %v", keys)
+	}
+}
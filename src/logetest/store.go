@@ -0,0 +1,197 @@
+// Helpers for testing loge stores and the applications built on them.
+package logetest
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"loge"
+)
+
+type Record struct {
+	Name string
+}
+
+// Conformance suite for LogeStore implementations. newStore is called
+// once per subtest and has to return a fresh, empty store; the DB built
+// on it is closed when the subtest ends.
+//
+// Find and list are optional: stores raising ErrNotSupported for them
+// skip those subtests.
+func TestStore(test *testing.T, newStore func() loge.LogeStore) {
+	var run = func(name string, check func(*testing.T, *loge.LogeDB)) {
+		test.Run(name, func (test *testing.T) {
+			var db = loge.NewLogeDB(newStore())
+			defer db.Close()
+			var def = loge.NewTypeDef("record", 1, &Record{})
+			def.Links = loge.LinkSpec{ "friend": "record" }
+			db.CreateType(def)
+			check(test, db)
+		})
+	}
+
+	run("ReadWrite", checkReadWrite)
+	run("Links", checkLinks)
+	run("Isolation", checkIsolation)
+	run("Conflict", checkConflict)
+	run("List", checkList)
+	run("Find", checkFind)
+	run("Truncate", checkTruncate)
+}
+
+func checkReadWrite(test *testing.T, db *loge.LogeDB) {
+	if db.ReadOne("record", "one").(*Record) != nil {
+		test.Fatal("Empty store returned an object")
+	}
+
+	db.SetOne("record", "one", &Record{ "One" })
+	if rec := db.ReadOne("record", "one").(*Record); rec == nil || rec.Name != "One" {
+		test.Fatalf("Wrong object after write: %v", rec)
+	}
+
+	db.SetOne("record", "one", &Record{ "Uno" })
+	if rec := db.ReadOne("record", "one").(*Record); rec == nil || rec.Name != "Uno" {
+		test.Fatalf("Wrong object after overwrite: %v", rec)
+	}
+	if !db.ExistsOne("record", "one") {
+		test.Error("Written object doesn't exist")
+	}
+
+	db.DeleteOne("record", "one")
+	if db.ReadOne("record", "one").(*Record) != nil || db.ExistsOne("record", "one") {
+		test.Error("Deleted object still there")
+	}
+}
+
+func checkLinks(test *testing.T, db *loge.LogeDB) {
+	db.Transact(func (t *loge.Transaction) {
+		t.AddLink("record", "friend", "one", "three")
+		t.AddLink("record", "friend", "one", "two")
+	}, 0)
+
+	var links = db.ReadLinksOne("record", "friend", "one")
+	if !reflect.DeepEqual(links, []loge.LogeKey{ "three", "two" }) {
+		test.Fatalf("Wrong links: %v", links)
+	}
+
+	db.Transact(func (t *loge.Transaction) {
+		t.RemoveLink("record", "friend", "one", "three")
+	}, 0)
+	links = db.ReadLinksOne("record", "friend", "one")
+	if !reflect.DeepEqual(links, []loge.LogeKey{ "two" }) {
+		test.Fatalf("Wrong links after remove: %v", links)
+	}
+
+	db.Transact(func (t *loge.Transaction) {
+		t.SetLinks("record", "friend", "one", []loge.LogeKey{ "four" })
+	}, 0)
+	links = db.ReadLinksOne("record", "friend", "one")
+	if !reflect.DeepEqual(links, []loge.LogeKey{ "four" }) {
+		test.Errorf("Wrong links after set: %v", links)
+	}
+}
+
+func checkIsolation(test *testing.T, db *loge.LogeDB) {
+	db.SetOne("record", "one", &Record{ "One" })
+
+	var before = db.CreateTransaction()
+	db.SetOne("record", "one", &Record{ "Uno" })
+
+	if rec := before.Read("record", "one").(*Record); rec == nil || rec.Name != "One" {
+		test.Errorf("Transaction saw a later commit: %v", rec)
+	}
+	before.Commit()
+
+	var after = db.CreateTransaction()
+	before = db.CreateTransaction()
+	after.Set("record", "one", &Record{ "Eins" })
+	if rec := before.Read("record", "one").(*Record); rec == nil || rec.Name != "Uno" {
+		test.Errorf("Transaction saw uncommitted write: %v", rec)
+	}
+	after.Commit()
+	before.Commit()
+}
+
+func checkConflict(test *testing.T, db *loge.LogeDB) {
+	db.SetOne("record", "one", &Record{ "One" })
+
+	var first = db.CreateTransaction()
+	var second = db.CreateTransaction()
+	first.Write("record", "one").(*Record).Name = "First"
+	second.Write("record", "one").(*Record).Name = "Second"
+
+	if !first.Commit() {
+		test.Fatal("First commit failed")
+	}
+	if second.Commit() {
+		test.Fatal("Conflicting commit succeeded")
+	}
+	if rec := db.ReadOne("record", "one").(*Record); rec.Name != "First" {
+		test.Errorf("Wrong object after conflict: %v", rec)
+	}
+}
+
+func checkList(test *testing.T, db *loge.LogeDB) {
+	for _, key := range []loge.LogeKey{ "c", "a", "b" } {
+		db.SetOne("record", key, &Record{ string(key) })
+	}
+
+	keys, err := db.TryListSlice("record", "", -1)
+	if errors.Is(err, loge.ErrNotSupported) {
+		test.Skip("List not supported")
+	}
+	if err != nil {
+		test.Fatalf("List failed: %v", err)
+	}
+	if !reflect.DeepEqual(keys, []loge.LogeKey{ "a", "b", "c" }) {
+		test.Errorf("Wrong list: %v", keys)
+	}
+
+	keys, _ = db.TryListSlice("record", "a", 1)
+	if !reflect.DeepEqual(keys, []loge.LogeKey{ "b" }) {
+		test.Errorf("Wrong list slice: %v", keys)
+	}
+}
+
+func checkFind(test *testing.T, db *loge.LogeDB) {
+	db.Transact(func (t *loge.Transaction) {
+		t.AddLink("record", "friend", "b", "target")
+		t.AddLink("record", "friend", "a", "target")
+		t.AddLink("record", "friend", "c", "other")
+	}, 0)
+
+	keys, err := db.TryFind("record", "friend", "target")
+	if errors.Is(err, loge.ErrNotSupported) {
+		test.Skip("Find not supported")
+	}
+	if err != nil {
+		test.Fatalf("Find failed: %v", err)
+	}
+	if !reflect.DeepEqual(keys, []loge.LogeKey{ "a", "b" }) {
+		test.Errorf("Wrong find results: %v", keys)
+	}
+
+	db.Transact(func (t *loge.Transaction) {
+		t.RemoveLink("record", "friend", "a", "target")
+	}, 0)
+	keys, _ = db.TryFind("record", "friend", "target")
+	if !reflect.DeepEqual(keys, []loge.LogeKey{ "b" }) {
+		test.Errorf("Wrong find results after remove: %v", keys)
+	}
+}
+
+func checkTruncate(test *testing.T, db *loge.LogeDB) {
+	db.SetOne("record", "one", &Record{ "One" })
+	db.SetOne("record", "two", &Record{ "Two" })
+	db.Transact(func (t *loge.Transaction) {
+		t.AddLink("record", "friend", "one", "two")
+	}, 0)
+
+	if count := db.Truncate("record"); count != 2 {
+		test.Errorf("Wrong truncate count: %d", count)
+	}
+	if db.ExistsOne("record", "one") || len(db.ReadLinksOne("record", "friend", "one")) != 0 {
+		test.Error("Truncate left data behind")
+	}
+}
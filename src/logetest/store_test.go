@@ -0,0 +1,202 @@
+package logetest
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"loge"
+)
+
+func TestMemStore(test *testing.T) {
+	TestStore(test, loge.NewMemStore)
+}
+
+func TestPersistentMemStore(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "logetest")
+	defer os.RemoveAll(dir)
+
+	var count = 0
+	TestStore(test, func() loge.LogeStore {
+		count++
+		return loge.NewPersistentMemStore(fmt.Sprintf("%s/%d.snap", dir, count), 0)
+	})
+}
+
+func TestLevelDBStore(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "logetest")
+	defer os.RemoveAll(dir)
+
+	var count = 0
+	TestStore(test, func() loge.LogeStore {
+		count++
+		return loge.NewLevelDBStore(fmt.Sprintf("%s/%d", dir, count))
+	})
+}
+
+func TestFaultStore(test *testing.T) {
+	TestStore(test, func() loge.LogeStore {
+		return loge.NewFaultStore(loge.NewMemStore())
+	})
+}
+
+func TestRocksDBStore(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "logetest")
+	defer os.RemoveAll(dir)
+
+	var count = 0
+	TestStore(test, func() loge.LogeStore {
+		count++
+		return loge.NewRocksDBStore(fmt.Sprintf("%s/%d", dir, count))
+	})
+}
+
+func TestBoltStore(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "logetest")
+	defer os.RemoveAll(dir)
+
+	var count = 0
+	TestStore(test, func() loge.LogeStore {
+		count++
+		return loge.NewBoltStore(fmt.Sprintf("%s/%d.db", dir, count))
+	})
+}
+
+func TestBadgerStore(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "logetest")
+	defer os.RemoveAll(dir)
+
+	var count = 0
+	TestStore(test, func() loge.LogeStore {
+		count++
+		return loge.NewBadgerStore(fmt.Sprintf("%s/%d", dir, count))
+	})
+}
+
+func TestLogStore(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "logetest")
+	defer os.RemoveAll(dir)
+
+	var count = 0
+	TestStore(test, func() loge.LogeStore {
+		count++
+		return loge.NewLogStore(fmt.Sprintf("%s/%d.log", dir, count), nil)
+	})
+}
+
+func TestMmapStore(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "logetest")
+	defer os.RemoveAll(dir)
+
+	var count = 0
+	TestStore(test, func() loge.LogeStore {
+		count++
+		return loge.NewMmapStore(fmt.Sprintf("%s/%d", dir, count))
+	})
+}
+
+func TestShardedStore(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "logetest")
+	defer os.RemoveAll(dir)
+
+	var count = 0
+	TestStore(test, func() loge.LogeStore {
+		count++
+		var shards = make([]loge.LogeStore, 3)
+		for i := range shards {
+			shards[i] = loge.NewBoltStore(fmt.Sprintf("%s/%d-%d.db", dir, count, i))
+		}
+		return loge.NewShardedStore(shards...)
+	})
+}
+
+func TestTieredStore(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "logetest")
+	defer os.RemoveAll(dir)
+
+	var count = 0
+	TestStore(test, func() loge.LogeStore {
+		count++
+		var disk = loge.NewBoltStore(fmt.Sprintf("%s/%d.db", dir, count))
+		return loge.NewTieredStore(disk, &loge.TieredOptions{ MaxEntries: 4 })
+	})
+}
+
+func TestCompressedStore(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "logetest")
+	defer os.RemoveAll(dir)
+
+	var count = 0
+	TestStore(test, func() loge.LogeStore {
+		count++
+		var disk = loge.NewBoltStore(fmt.Sprintf("%s/%d.db", dir, count))
+		return loge.NewCompressedStore(disk, loge.CompressSnappy, 0)
+	})
+}
+
+func TestSQLiteStore(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "logetest")
+	defer os.RemoveAll(dir)
+
+	var count = 0
+	TestStore(test, func() loge.LogeStore {
+		count++
+		return loge.NewSQLiteStore(fmt.Sprintf("%s/%d.sqlite", dir, count))
+	})
+}
+
+// Against a scratch database named by LOGE_POSTGRES, e.g.
+// "postgres://localhost/logetest?sslmode=disable". Each subtest gets its
+// own schema.
+func TestPostgresStore(test *testing.T) {
+	var dsn = os.Getenv("LOGE_POSTGRES")
+	if dsn == "" {
+		test.Skip("LOGE_POSTGRES not set")
+	}
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer admin.Close()
+
+	var count = 0
+	TestStore(test, func() loge.LogeStore {
+		count++
+		var schema = fmt.Sprintf("logetest_%d_%d", os.Getpid(), count)
+		if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+			panic(err)
+		}
+		test.Cleanup(func() { admin.Exec("DROP SCHEMA " + schema + " CASCADE") })
+		return loge.NewPostgresStore(withSearchPath(dsn, schema), nil)
+	})
+}
+
+func withSearchPath(dsn string, schema string) string {
+	if strings.Contains(dsn, "://") {
+		if strings.Contains(dsn, "?") {
+			return dsn + "&search_path=" + schema
+		}
+		return dsn + "?search_path=" + schema
+	}
+	return dsn + " search_path=" + schema
+}
+
+// Against a scratch Redis at LOGE_REDIS, e.g. "localhost:6379". Each
+// subtest writes under its own prefix.
+func TestRedisStore(test *testing.T) {
+	var addr = os.Getenv("LOGE_REDIS")
+	if addr == "" {
+		test.Skip("LOGE_REDIS not set")
+	}
+
+	var count = 0
+	TestStore(test, func() loge.LogeStore {
+		count++
+		var opts = loge.DefaultRedisOptions
+		opts.Prefix = fmt.Sprintf("logetest:%d:%d:", os.Getpid(), count)
+		return loge.NewRedisStore(addr, &opts)
+	})
+}
@@ -0,0 +1,224 @@
+package logetest
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+
+	"loge"
+)
+
+// Randomized concurrent transactors checking invariants which only hold
+// if commits serialize:
+//
+//   - Counters are incremented read-modify-write; at the end each one
+//     has to equal the number of increments which committed.
+//   - Peer links are added and removed in both directions at once; every
+//     snapshot, and the final state, has to be symmetric.
+//
+// Stress registers its own types ("stress_counter", "stress_node") on
+// the DB. Run it under the race detector to catch data races as well.
+type StressConfig struct {
+	Workers int
+	Transactions int // Per worker
+	Keys int
+
+	// Above 1, keys are drawn from a Zipf distribution with this
+	// exponent, so a few hot keys take most of the traffic. Otherwise
+	// keys are uniform.
+	Skew float64
+
+	// Fractions of transactions which only read, and which touch links
+	// rather than counters
+	ReadRatio float64
+	LinkRatio float64
+
+	Seed int64
+}
+
+type StressCounter struct {
+	Value int
+}
+
+type StressNode struct {
+}
+
+type StressReport struct {
+	Commits int64
+	Conflicts int64
+	Reads int64
+}
+
+var DefaultStressConfig = StressConfig{
+	Workers: 8,
+	Transactions: 500,
+	Keys: 20,
+	Skew: 1.5,
+	ReadRatio: 0.3,
+	LinkRatio: 0.3,
+	Seed: 1,
+}
+
+type stressRun struct {
+	db *loge.LogeDB
+	config StressConfig
+	increments []int64
+	report StressReport
+
+	lock sync.Mutex
+	violations []string
+}
+
+func Stress(db *loge.LogeDB, config StressConfig) (*StressReport, error) {
+	if config.Keys < 2 {
+		return nil, fmt.Errorf("Stress needs at least 2 keys")
+	}
+
+	db.CreateType(loge.NewTypeDef("stress_counter", 1, &StressCounter{}))
+	var def = loge.NewTypeDef("stress_node", 1, &StressNode{})
+	def.Links = loge.LinkSpec{ "peer": "stress_node" }
+	db.CreateType(def)
+
+	var run = &stressRun{
+		db: db,
+		config: config,
+		increments: make([]int64, config.Keys),
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < config.Workers; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			run.worker(rand.New(rand.NewSource(seed)))
+		}(config.Seed + int64(i))
+	}
+	wg.Wait()
+
+	run.checkFinal()
+
+	if len(run.violations) > 0 {
+		return &run.report, fmt.Errorf("%d invariant violations, first: %s",
+			len(run.violations), run.violations[0])
+	}
+	return &run.report, nil
+}
+
+func (run *stressRun) worker(rnd *rand.Rand) {
+	var pick = keyPicker(rnd, run.config)
+	for i := 0; i < run.config.Transactions; i++ {
+		var reading = rnd.Float64() < run.config.ReadRatio
+		var linking = rnd.Float64() < run.config.LinkRatio
+		switch {
+		case reading && linking:
+			run.readLinks(pick())
+		case reading:
+			run.readCounter(pick())
+		case linking:
+			var a, b = pick(), pick()
+			if a != b {
+				run.toggleLink(a, b)
+			}
+		default:
+			run.increment(pick())
+		}
+	}
+}
+
+func keyPicker(rnd *rand.Rand, config StressConfig) func() int {
+	if config.Skew > 1 {
+		var zipf = rand.NewZipf(rnd, config.Skew, 1, uint64(config.Keys - 1))
+		return func() int { return int(zipf.Uint64()) }
+	}
+	return func() int { return rnd.Intn(config.Keys) }
+}
+
+func stressKey(idx int) loge.LogeKey {
+	return loge.LogeKey(fmt.Sprintf("k%04d", idx))
+}
+
+func (run *stressRun) increment(idx int) {
+	var t = run.db.CreateTransaction()
+	var counter = t.Write("stress_counter", stressKey(idx)).(*StressCounter)
+	if counter == nil {
+		t.Set("stress_counter", stressKey(idx), &StressCounter{ 1 })
+	} else {
+		counter.Value++
+	}
+	if run.commit(t) {
+		atomic.AddInt64(&run.increments[idx], 1)
+	}
+}
+
+func (run *stressRun) toggleLink(a int, b int) {
+	var ka, kb = stressKey(a), stressKey(b)
+	var t = run.db.CreateTransaction()
+	if t.HasLink("stress_node", "peer", ka, kb) {
+		t.RemoveLink("stress_node", "peer", ka, kb)
+		t.RemoveLink("stress_node", "peer", kb, ka)
+	} else {
+		t.AddLink("stress_node", "peer", ka, kb)
+		t.AddLink("stress_node", "peer", kb, ka)
+	}
+	run.commit(t)
+}
+
+func (run *stressRun) readCounter(idx int) {
+	var t = run.db.CreateTransaction()
+	var counter = t.Read("stress_counter", stressKey(idx)).(*StressCounter)
+	if counter != nil && counter.Value < 0 {
+		run.violation("Counter %s went negative: %d", stressKey(idx), counter.Value)
+	}
+	run.commit(t)
+	atomic.AddInt64(&run.report.Reads, 1)
+}
+
+func (run *stressRun) readLinks(idx int) {
+	var key = stressKey(idx)
+	var t = run.db.CreateTransaction()
+	for _, peer := range t.ReadLinks("stress_node", "peer", key) {
+		if !t.HasLink("stress_node", "peer", peer, key) {
+			run.violation("Snapshot has %s -> %s without its reverse", key, peer)
+		}
+	}
+	run.commit(t)
+	atomic.AddInt64(&run.report.Reads, 1)
+}
+
+func (run *stressRun) commit(t *loge.Transaction) bool {
+	if t.Commit() {
+		atomic.AddInt64(&run.report.Commits, 1)
+		return true
+	}
+	atomic.AddInt64(&run.report.Conflicts, 1)
+	return false
+}
+
+func (run *stressRun) checkFinal() {
+	run.db.Transact(func (t *loge.Transaction) {
+		for idx := range run.increments {
+			var key = stressKey(idx)
+			var value = 0
+			if counter := t.Read("stress_counter", key).(*StressCounter); counter != nil {
+				value = counter.Value
+			}
+			if int64(value) != run.increments[idx] {
+				run.violation("Counter %s is %d after %d committed increments",
+					key, value, run.increments[idx])
+			}
+
+			for _, peer := range t.ReadLinks("stress_node", "peer", key) {
+				if !t.HasLink("stress_node", "peer", peer, key) {
+					run.violation("Final state has %s -> %s without its reverse", key, peer)
+				}
+			}
+		}
+	}, 0)
+}
+
+func (run *stressRun) violation(format string, args ...interface{}) {
+	run.lock.Lock()
+	defer run.lock.Unlock()
+	run.violations = append(run.violations, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,33 @@
+package logetest
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"loge"
+)
+
+func TestStressMemStore(test *testing.T) {
+	var report, err = Stress(loge.NewLogeDB(loge.NewMemStore()), DefaultStressConfig)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if report.Commits == 0 || report.Reads == 0 {
+		test.Errorf("Nothing happened: %+v", report)
+	}
+}
+
+func TestStressLevelDB(test *testing.T) {
+	var dir, _ = ioutil.TempDir("", "logetest-stress")
+	defer os.RemoveAll(dir)
+
+	var db = loge.NewLogeDB(loge.NewLevelDBStore(dir))
+	defer db.Close()
+
+	var config = DefaultStressConfig
+	config.Skew = 0
+	if _, err := Stress(db, config); err != nil {
+		test.Fatal(err)
+	}
+}